@@ -4,6 +4,21 @@ const path = require('path');
 // Load environment variables
 dotenv.config();
 
+/**
+ * Parse per-runtime pool sizes from a "runtime:size" list, e.g. "go:3,python:2"
+ */
+const parsePoolSizes = (value) => {
+  if (!value) return {};
+  return value.split(',').reduce((sizes, entry) => {
+    const [runtime, size] = entry.split(':').map(part => part.trim());
+    const parsed = parseInt(size);
+    if (runtime && !Number.isNaN(parsed) && parsed >= 0) {
+      sizes[runtime] = parsed;
+    }
+    return sizes;
+  }, {});
+};
+
 const config = {
   // Server configuration
   port: process.env.PORT || 3001,
@@ -38,6 +53,49 @@ const config = {
     legacyHeaders: false
   },
 
+  // Token buckets per authenticated user, or per client IP for unauthenticated
+  // traffic (middleware/rateLimiter). Buckets refill continuously.
+  tokenBuckets: {
+    enabled: process.env.RATE_LIMIT_ENABLED !== 'false',
+    store: process.env.RATE_LIMIT_STORE || 'memory', // 'redis' shares buckets between nodes
+    keyPrefix: process.env.RATE_LIMIT_KEY_PREFIX || 'ratelimit:',
+    buckets: {
+      // Cheap endpoints: file reads and listings
+      read: {
+        user: {
+          capacity: parseInt(process.env.RATE_LIMIT_READ_CAPACITY) || 120,
+          refillPerSecond: parseFloat(process.env.RATE_LIMIT_READ_REFILL) || 10
+        },
+        anonymous: {
+          capacity: parseInt(process.env.RATE_LIMIT_ANON_READ_CAPACITY) || 30,
+          refillPerSecond: parseFloat(process.env.RATE_LIMIT_ANON_READ_REFILL) || 1
+        }
+      },
+      // Expensive endpoints: anything that runs code in a container
+      execute: {
+        user: {
+          capacity: parseInt(process.env.RATE_LIMIT_EXECUTE_CAPACITY) || 10,
+          refillPerSecond: parseFloat(process.env.RATE_LIMIT_EXECUTE_REFILL) || 0.5
+        },
+        anonymous: {
+          capacity: parseInt(process.env.RATE_LIMIT_ANON_EXECUTE_CAPACITY) || 2,
+          refillPerSecond: parseFloat(process.env.RATE_LIMIT_ANON_EXECUTE_REFILL) || 0.05
+        }
+      },
+      // Code formatting: a container exec, but short and frequent (format on save)
+      format: {
+        user: {
+          capacity: parseInt(process.env.RATE_LIMIT_FORMAT_CAPACITY) || 30,
+          refillPerSecond: parseFloat(process.env.RATE_LIMIT_FORMAT_REFILL) || 2
+        },
+        anonymous: {
+          capacity: parseInt(process.env.RATE_LIMIT_ANON_FORMAT_CAPACITY) || 5,
+          refillPerSecond: parseFloat(process.env.RATE_LIMIT_ANON_FORMAT_REFILL) || 0.2
+        }
+      }
+    }
+  },
+
   // Security configuration
   security: {
     helmet: {
@@ -117,6 +175,443 @@ const config = {
     }
   },
 
+  // Firebase UIDs with admin access besides users whose role is 'admin' (comma separated)
+  admin: {
+    uids: (process.env.ADMIN_UIDS || '').split(',').map(uid => uid.trim()).filter(Boolean)
+  },
+
+  // Warm container pool configuration
+  containerPool: {
+    enabled: process.env.CONTAINER_POOL_ENABLED
+      ? process.env.CONTAINER_POOL_ENABLED === 'true'
+      : process.env.NODE_ENV !== 'test',
+    defaultSize: parseInt(process.env.CONTAINER_POOL_SIZE) || 1, // idle containers kept per runtime
+    sizes: parsePoolSizes(process.env.CONTAINER_POOL_SIZES), // per-runtime overrides
+    idleTtlMs: parseInt(process.env.CONTAINER_POOL_IDLE_TTL_MS) || 10 * 60 * 1000, // 10 minutes
+    reapIntervalMs: parseInt(process.env.CONTAINER_POOL_REAP_INTERVAL_MS) || 60 * 1000 // 1 minute
+  },
+
+  // Background sweep for containers and volumes labelled studio.owner that no
+  // live execution, pool entry or session tracks (leaks after crashes or
+  // Docker API errors)
+  resourceReaper: {
+    enabled: process.env.RESOURCE_REAPER_ENABLED
+      ? process.env.RESOURCE_REAPER_ENABLED === 'true'
+      : process.env.NODE_ENV !== 'test',
+    intervalMs: parseInt(process.env.RESOURCE_REAPER_INTERVAL_MS) || 5 * 60 * 1000, // 5 minutes
+    jitter: parseFloat(process.env.RESOURCE_REAPER_JITTER) || 0.2, // each interval varies by up to ±20%
+    gracePeriodMs: parseInt(process.env.RESOURCE_REAPER_GRACE_MS) || 10 * 60 * 1000, // younger resources may still be starting up
+    dryRun: process.env.RESOURCE_REAPER_DRY_RUN === 'true' // only log what would be removed
+  },
+
+  // Execution request limits
+  execution: {
+    maxCodeBytes: parseInt(process.env.EXECUTION_MAX_CODE_BYTES) || 1024 * 1024, // a single-file program
+    maxFiles: parseInt(process.env.EXECUTION_MAX_FILES) || 200,
+    maxFilesBytes: parseInt(process.env.EXECUTION_MAX_FILES_BYTES) || 5 * 1024 * 1024, // total size of a files map
+    cancelGraceMs: parseInt(process.env.EXECUTION_CANCEL_GRACE_MS) || 2000, // SIGTERM -> SIGKILL grace period
+    maxArgs: parseInt(process.env.EXECUTION_MAX_ARGS) || 32, // command-line arguments per execution
+    maxArgsBytes: parseInt(process.env.EXECUTION_MAX_ARGS_BYTES) || 16 * 1024,
+    maxEnvBytes: parseInt(process.env.EXECUTION_MAX_ENV_BYTES) || 4 * 1024, // total NAME=value bytes
+    deniedEnv: (process.env.EXECUTION_DENIED_ENV || '') // names denied on top of the built-in list
+      .split(',')
+      .map(name => name.trim())
+      .filter(Boolean)
+  },
+
+  // Screening of submitted source before it runs (services/screening), for
+  // cryptominers and scanners. Screeners return allow, flag or block:
+  // blocked code is refused with a 422, flagged code runs but is audited and
+  // adds to the user's abuse score, which raises the token cost of the
+  // penalized rate limit buckets. The rules file is reloaded when it changes.
+  // Runtimes for trusted internal use opt out with "screening": false.
+  screening: {
+    enabled: process.env.SCREENING_ENABLED !== 'false',
+    screeners: (process.env.SCREENING_SCREENERS || 'rules,heuristics') // add "yara" for yara-style rules
+      .split(',')
+      .map(name => name.trim())
+      .filter(Boolean),
+    rulesFile: process.env.SCREENING_RULES_FILE || path.join(__dirname, 'screening-rules.json'),
+    reloadIntervalMs: parseInt(process.env.SCREENING_RELOAD_INTERVAL_MS) || 5000, // how often the rules file is checked
+    maxScanBytes: parseInt(process.env.SCREENING_MAX_SCAN_BYTES) || 2 * 1024 * 1024, // of a workspace's files
+    largeSourceBytes: parseInt(process.env.SCREENING_LARGE_SOURCE_BYTES) || 256 * 1024, // flagged above this
+    base64BlobBytes: parseInt(process.env.SCREENING_BASE64_BLOB_BYTES) || 4096, // flagged at this length
+    abuse: {
+      flagPoints: parseFloat(process.env.SCREENING_FLAG_POINTS) || 1,
+      blockPoints: parseFloat(process.env.SCREENING_BLOCK_POINTS) || 3,
+      halfLifeMs: parseInt(process.env.SCREENING_SCORE_HALF_LIFE_MS) || 60 * 60 * 1000, // 1 hour
+      costPerPoint: parseFloat(process.env.SCREENING_COST_PER_POINT) || 1, // extra tokens per point
+      buckets: (process.env.SCREENING_PENALIZED_BUCKETS || 'execute')
+        .split(',')
+        .map(name => name.trim())
+        .filter(Boolean)
+    }
+  },
+
+  // Sandbox providers: "docker" runs containers on the default runtime (runc),
+  // "gvisor" on the runsc runtime for a user-space kernel between untrusted code
+  // and the host. Runtimes pick one with `sandbox`; gvisor falls back to docker
+  // (with a warning) when the daemon has no runsc runtime registered.
+  sandbox: {
+    defaultProvider: process.env.SANDBOX_PROVIDER || 'docker',
+    gvisorRuntime: process.env.SANDBOX_GVISOR_RUNTIME || 'runsc' // name of the runtime in the daemon's config
+  },
+
+  // Sandbox networking: containers get NetworkMode "none" unless their runtime
+  // sets allowNetwork, in which case they join an internal network whose only
+  // way out is the allowlisting egress proxy
+  sandboxNetwork: {
+    egressNetwork: process.env.SANDBOX_EGRESS_NETWORK || 'studio-egress',
+    proxyPort: parseInt(process.env.SANDBOX_EGRESS_PROXY_PORT) || 3128,
+    proxyHost: process.env.SANDBOX_EGRESS_PROXY_HOST || null, // defaults to the egress network gateway
+    allowlist: (process.env.SANDBOX_EGRESS_ALLOWLIST || '') // extra hosts allowed for every runtime
+      .split(',')
+      .map(host => host.trim().toLowerCase())
+      .filter(Boolean)
+  },
+
+  // Writable scratch space in otherwise read-only sandboxes. tmpfs pages count
+  // against the container's memory limit, so both mounts are sized as a share
+  // of it and fill up (ENOSPC) before the program is OOM killed.
+  sandboxFilesystem: {
+    buildDir: process.env.SANDBOX_BUILD_DIR || '/build', // compiler output, the only exec-able scratch mount
+    tmpPercent: parseInt(process.env.SANDBOX_TMP_PERCENT) || 50, // /tmp size as % of memoryBytes
+    buildPercent: parseInt(process.env.SANDBOX_BUILD_PERCENT) || 25, // buildDir size as % of memoryBytes
+    minTmpfsBytes: parseInt(process.env.SANDBOX_MIN_TMPFS_BYTES) || 16 * 1024 * 1024 // 16MB
+  },
+
+  // Shared per-runtime dependency caches (Go modules, pip wheels, npm) mounted
+  // read-only into sandboxes, pruned LRU-first above maxBytes
+  cacheVolumes: {
+    enabled: process.env.CACHE_VOLUMES_ENABLED
+      ? process.env.CACHE_VOLUMES_ENABLED === 'true'
+      : process.env.NODE_ENV !== 'test',
+    basePath: process.env.CACHE_VOLUME_PATH || './cache',
+    hostBasePath: process.env.CACHE_HOST_PATH || null, // path of basePath as seen by the Docker daemon
+    maxBytes: parseInt(process.env.CACHE_VOLUME_MAX_BYTES) || 2 * 1024 * 1024 * 1024, // 2GB per cache
+    pruneIntervalMs: parseInt(process.env.CACHE_VOLUME_PRUNE_INTERVAL_MS) || 60 * 60 * 1000 // 1 hour
+  },
+
+  // Compiled binaries of single-file builds (runtimes with a buildCache entry),
+  // keyed by source and toolchain so identical re-runs skip the compile phase
+  buildCache: {
+    enabled: process.env.BUILD_CACHE_ENABLED
+      ? process.env.BUILD_CACHE_ENABLED === 'true'
+      : process.env.NODE_ENV !== 'test',
+    basePath: process.env.BUILD_CACHE_PATH || './cache/builds',
+    maxBytes: parseInt(process.env.BUILD_CACHE_MAX_BYTES) || 512 * 1024 * 1024, // 512MB, least recently used evicted first
+    maxArtifactBytes: parseInt(process.env.BUILD_CACHE_MAX_ARTIFACT_BYTES) || 64 * 1024 * 1024 // larger binaries aren't cached
+  },
+
+  // Output caps for streamed executions: past maxStreamBytes a stream is still
+  // drained but no longer buffered or forwarded. With spilling enabled the full
+  // output (up to spillMaxBytes) is kept on disk for GET /api/executions/:id/output.
+  outputLimits: {
+    maxStreamBytes: parseInt(process.env.OUTPUT_MAX_STREAM_BYTES) || 1024 * 1024, // per stream
+    spillEnabled: process.env.OUTPUT_SPILL_ENABLED === 'true',
+    spillPath: process.env.OUTPUT_SPILL_PATH || './cache/output',
+    spillMaxBytes: parseInt(process.env.OUTPUT_SPILL_MAX_BYTES) || 64 * 1024 * 1024, // per stream
+    spillRetentionMs: parseInt(process.env.OUTPUT_SPILL_RETENTION_MS) || 24 * 60 * 60 * 1000 // removed by the history prune job
+  },
+
+  // Output files an execution asks for with `artifacts` globs, copied out of
+  // /workspace once the program exits and downloadable from
+  // GET /api/executions/:id/artifacts/:name. They are removed with the
+  // execution's history record (executionHistory.retentionDays).
+  artifacts: {
+    enabled: process.env.ARTIFACTS_ENABLED !== 'false',
+    path: process.env.ARTIFACTS_PATH || './cache/artifacts',
+    maxPatterns: parseInt(process.env.ARTIFACTS_MAX_PATTERNS) || 20,
+    maxFiles: parseInt(process.env.ARTIFACTS_MAX_FILES) || 50, // per execution
+    maxBytes: parseInt(process.env.ARTIFACTS_MAX_BYTES) || 50 * 1024 * 1024 // per execution
+  },
+
+  // Prometheus scrape endpoint
+  metrics: {
+    enabled: process.env.METRICS_ENABLED !== 'false',
+    token: process.env.METRICS_TOKEN || null // require "Authorization: Bearer <token>" when set
+  },
+
+  // OpenTelemetry tracing, exported over OTLP/HTTP. On when TRACING_ENABLED is
+  // set or an OTLP endpoint is; the exporter reads OTEL_EXPORTER_OTLP_* itself.
+  tracing: {
+    enabled: process.env.TRACING_ENABLED
+      ? process.env.TRACING_ENABLED === 'true'
+      : Boolean(process.env.OTEL_EXPORTER_OTLP_ENDPOINT || process.env.OTEL_EXPORTER_OTLP_TRACES_ENDPOINT),
+    serviceName: process.env.OTEL_SERVICE_NAME || 'studio-backend'
+  },
+
+  // Execution queue (global concurrency, per-user limit, bounded wait queue)
+  executionQueue: {
+    enabled: process.env.EXECUTION_QUEUE_ENABLED
+      ? process.env.EXECUTION_QUEUE_ENABLED === 'true'
+      : process.env.NODE_ENV !== 'test',
+    maxConcurrent: parseInt(process.env.EXECUTION_MAX_CONCURRENT) || 40, // global running executions
+    perUserLimit: parseInt(process.env.EXECUTION_PER_USER_LIMIT) || 2,
+    maxQueueDepth: parseInt(process.env.EXECUTION_QUEUE_DEPTH) || 100, // waiting executions before 429
+    retryAfterSeconds: parseInt(process.env.EXECUTION_QUEUE_RETRY_AFTER) || 5,
+    // A slot held longer than this (or the ticket's own timeoutMs) counts as wedged for /readyz
+    stuckAfterMs: parseInt(process.env.EXECUTION_STUCK_AFTER_MS) || 15 * 60 * 1000
+  },
+
+  // Readiness probe (GET /readyz): results are reused for cacheMs so probes don't hammer Docker
+  readiness: {
+    cacheMs: parseInt(process.env.READINESS_CACHE_MS) || 5000,
+    dockerTimeoutMs: parseInt(process.env.READINESS_DOCKER_TIMEOUT_MS) || 2000, // for Ping and the image listing
+    // Runtimes whose images must be present locally; all registered runtimes by default
+    requiredRuntimes: process.env.READINESS_REQUIRED_RUNTIMES
+      ? process.env.READINESS_REQUIRED_RUNTIMES.split(',').map(name => name.trim()).filter(Boolean)
+      : null
+  },
+
+  // Persisted per-user execution history (GET /api/executions)
+  executionHistory: {
+    store: process.env.EXECUTION_HISTORY_STORE || (process.env.NODE_ENV === 'test' ? 'memory' : 'mongodb'),
+    outputLimitBytes: parseInt(process.env.EXECUTION_HISTORY_OUTPUT_LIMIT) || 64 * 1024, // per record
+    retentionDays: parseInt(process.env.EXECUTION_HISTORY_RETENTION_DAYS) || 30,
+    pruneIntervalMs: parseInt(process.env.EXECUTION_HISTORY_PRUNE_INTERVAL_MS) || 60 * 60 * 1000, // 1 hour
+    defaultPageSize: 20,
+    maxPageSize: 100
+  },
+
+  // Comparing two runs from the history (GET /api/executions/:id/diff/:otherId)
+  executionDiff: {
+    contextLines: parseInt(process.env.EXECUTION_DIFF_CONTEXT_LINES) || 3, // unchanged lines around each hunk
+    maxEdits: parseInt(process.env.EXECUTION_DIFF_MAX_EDITS) || 1000, // more different outputs are shown as one replacement
+    maxPatterns: 10, // normalize patterns per request
+    maxPatternLength: 200,
+    patternTimeoutMs: parseInt(process.env.EXECUTION_DIFF_PATTERN_TIMEOUT_MS) || 1000 // all normalize patterns of a request together
+  },
+
+  // Streaming execution sessions shared between replicas so a client can
+  // reattach (execution:reattach) after a reconnect or a redeploy. "redis"
+  // is needed once there is more than one backend instance.
+  executionSessions: {
+    store: process.env.EXECUTION_SESSION_STORE || 'memory',
+    keyPrefix: process.env.EXECUTION_SESSION_KEY_PREFIX || 'execsession:',
+    instanceId: process.env.INSTANCE_ID || null, // defaults to hostname and PID
+    ringFrames: parseInt(process.env.EXECUTION_SESSION_RING_FRAMES) || 500, // output frames kept for replay
+    ttlMs: parseInt(process.env.EXECUTION_SESSION_TTL_MS) || 60 * 60 * 1000, // state kept after the last update
+    heartbeatIntervalMs: parseInt(process.env.EXECUTION_SESSION_HEARTBEAT_MS) || 5000,
+    heartbeatTtlMs: parseInt(process.env.EXECUTION_SESSION_HEARTBEAT_TTL_MS) || 15000, // an instance missing this long is gone
+    reattachGraceMs: parseInt(process.env.EXECUTION_SESSION_REATTACH_GRACE_MS) || 30 * 1000 // before a disconnected run is cancelled
+  },
+
+  // Background executions (POST /api/executions?mode=async): each job gets its
+  // own container and the longer timeout tier below, and may be reported to a
+  // callback URL signed with callbackSecret
+  asyncJobs: {
+    perUserLimit: parseInt(process.env.ASYNC_JOBS_PER_USER_LIMIT) || 3, // queued + running, separate from interactive runs
+    compileTimeoutMs: parseInt(process.env.ASYNC_JOBS_COMPILE_TIMEOUT_MS) || 5 * 60 * 1000,
+    runTimeoutMs: parseInt(process.env.ASYNC_JOBS_RUN_TIMEOUT_MS) || 30 * 60 * 1000,
+    callbackSecret: process.env.ASYNC_JOBS_CALLBACK_SECRET || null, // HMAC-SHA256 key; callbacks are refused without one
+    allowPrivateCallbackHosts: process.env.ASYNC_JOBS_ALLOW_PRIVATE_CALLBACKS === 'true', // e.g. localhost receivers in development
+    callbackTimeoutMs: parseInt(process.env.ASYNC_JOBS_CALLBACK_TIMEOUT_MS) || 10 * 1000,
+    callbackMaxAttempts: parseInt(process.env.ASYNC_JOBS_CALLBACK_MAX_ATTEMPTS) || 6,
+    callbackBackoffMs: parseInt(process.env.ASYNC_JOBS_CALLBACK_BACKOFF_MS) || 1000, // doubled after every failed attempt
+    jobRetentionMs: parseInt(process.env.ASYNC_JOBS_RETENTION_MS) || 60 * 60 * 1000 // finished jobs' callback state kept in memory
+  },
+
+  // Per-workspace secrets (PUT /api/workspaces/:id/secrets/:name), stored
+  // AES-256-GCM encrypted under key and injected into executions that ask for
+  // them with use_secrets. Without a key secrets can't be stored or used.
+  workspaceSecrets: {
+    store: process.env.WORKSPACE_SECRETS_STORE || (process.env.NODE_ENV === 'test' ? 'memory' : 'mongodb'),
+    key: process.env.WORKSPACE_SECRETS_KEY || null, // 32 bytes, base64 or hex
+    maxPerWorkspace: parseInt(process.env.WORKSPACE_SECRETS_MAX) || 50,
+    maxValueBytes: parseInt(process.env.WORKSPACE_SECRETS_MAX_VALUE_BYTES) || 8 * 1024
+  },
+
+  // Batch executions (POST /api/executions/batch): one program run against
+  // many variants (stdin/args/env), compiled once and fanned out over up to
+  // maxParallel containers, each holding one of the user's execution slots
+  batchExecutions: {
+    maxVariants: parseInt(process.env.BATCH_MAX_VARIANTS) || 50,
+    maxParallel: parseInt(process.env.BATCH_MAX_PARALLEL) || 4, // further capped by executionQueue.perUserLimit
+    outputLimitBytes: parseInt(process.env.BATCH_OUTPUT_LIMIT_BYTES) || 64 * 1024, // stdout and stderr kept per variant
+    retentionMs: parseInt(process.env.BATCH_RETENTION_MS) || 60 * 60 * 1000 // finished batches kept in memory
+  },
+
+  // Judge mode (POST /api/execution/judge): compile once, then run each test
+  // case's stdin against its expected stdout
+  judge: {
+    maxCases: parseInt(process.env.JUDGE_MAX_CASES) || 100,
+    caseTimeoutMs: parseInt(process.env.JUDGE_CASE_TIMEOUT_MS) || 2000, // per case, capped by the runtime's run timeout
+    maxFailures: parseInt(process.env.JUDGE_MAX_FAILURES) || null, // stop after this many failed cases; null runs them all
+    diffLimitBytes: parseInt(process.env.JUDGE_DIFF_LIMIT_BYTES) || 1024, // expected/actual output returned per failed case
+    floatTolerance: parseFloat(process.env.JUDGE_FLOAT_TOLERANCE) || 1e-6 // absolute or relative, for comparison "float"
+  },
+
+  // Benchmark mode (POST /api/execution/benchmark): a fresh container, never
+  // one from the warm pool, runs the program `trials` times on CPUs set aside
+  // for benchmarks. Every run takes cpusPerRun of them, so there are
+  // cpus / cpusPerRun benchmark slots with a queue of their own; all other
+  // containers are kept off these CPUs. Without a usable cpuset benchmarks
+  // run unpinned, unpinnedConcurrency at a time, and say so in the result.
+  benchmark: {
+    cpus: process.env.BENCHMARK_CPUS || '', // e.g. "6-7"; empty disables pinning
+    cpusPerRun: parseInt(process.env.BENCHMARK_CPUS_PER_RUN) || 1,
+    unpinnedConcurrency: parseInt(process.env.BENCHMARK_UNPINNED_CONCURRENCY) || 1,
+    maxTrials: 10,
+    defaultTrials: parseInt(process.env.BENCHMARK_DEFAULT_TRIALS) || 5,
+    maxQueueDepth: parseInt(process.env.BENCHMARK_QUEUE_DEPTH) || 20, // waiting benchmarks before 429
+    maxWaitMs: parseInt(process.env.BENCHMARK_MAX_WAIT_MS) || 10 * 60 * 1000, // for a slot, before giving up with 429
+    retryAfterSeconds: parseInt(process.env.BENCHMARK_RETRY_AFTER) || 30,
+    outputLimitBytes: parseInt(process.env.BENCHMARK_OUTPUT_LIMIT_BYTES) || 4096 // stdout/stderr returned from a trial
+  },
+
+  // gRPC API (proto/execution.proto) on its own port for CI systems and CLI
+  // tools. Plaintext unless both TLS files are set; reflection lets grpcurl
+  // and similar clients discover the service without the .proto.
+  grpc: {
+    enabled: process.env.GRPC_ENABLED !== 'false',
+    host: process.env.GRPC_HOST || '0.0.0.0',
+    port: parseInt(process.env.GRPC_PORT) || 50051,
+    reflection: process.env.GRPC_REFLECTION !== 'false',
+    tlsCertFile: process.env.GRPC_TLS_CERT_FILE || '',
+    tlsKeyFile: process.env.GRPC_TLS_KEY_FILE || '',
+    maxMessageBytes: parseInt(process.env.GRPC_MAX_MESSAGE_BYTES) || 4 * 1024 * 1024
+  },
+
+  // Graceful shutdown: new executions get 503 while running ones get up to
+  // drainTimeoutMs to finish, then their containers are killed and removed
+  shutdown: {
+    drainTimeoutMs: parseInt(process.env.SHUTDOWN_DRAIN_TIMEOUT_MS) || 30 * 1000, // 30 seconds
+    retryAfterSeconds: parseInt(process.env.SHUTDOWN_RETRY_AFTER) || 10,
+    // Remove labelled execution containers left behind by a previous process on startup
+    reconcileOnStartup: process.env.SHUTDOWN_RECONCILE_ON_STARTUP !== 'false'
+  },
+
+  // Pushes file:changes events to sockets subscribed with file:watch. "fsnotify"
+  // watches the workspace directory (inotify); "diff" rescans it after each
+  // execution that mounted it, for hosts where the sandbox writes to storage
+  // the backend can't watch.
+  workspaceWatcher: {
+    enabled: process.env.WORKSPACE_WATCHER_ENABLED !== 'false',
+    mode: process.env.WORKSPACE_WATCHER_MODE || 'fsnotify',
+    batchWindowMs: parseInt(process.env.WORKSPACE_WATCHER_BATCH_MS) || 200,
+    attributionMs: parseInt(process.env.WORKSPACE_WATCHER_ATTRIBUTION_MS) || 2000, // file API writes claim events on their paths this long
+    maxEntries: parseInt(process.env.WORKSPACE_WATCHER_MAX_ENTRIES) || 5000 // per workspace snapshot
+  },
+
+  // Disk usage against the workspace quota (WORKSPACE_MAX_SIZE/WORKSPACE_MAX_FILES).
+  // "walk" totals the directory after writes; "xfs" reads and enforces it as an
+  // XFS project quota on the volume at xfsMountPoint (needs xfs_quota and root).
+  workspaceQuota: {
+    provider: process.env.WORKSPACE_QUOTA_PROVIDER || 'walk',
+    xfsMountPoint: process.env.WORKSPACE_QUOTA_XFS_MOUNT || '/workspaces',
+    xfsProjectBase: parseInt(process.env.WORKSPACE_QUOTA_XFS_PROJECT_BASE) || 100000,
+    warnPercent: parseInt(process.env.WORKSPACE_QUOTA_WARN_PERCENT) || 90,
+    refreshDelayMs: parseInt(process.env.WORKSPACE_QUOTA_REFRESH_MS) || 1000, // post-write walk, coalescing bursts
+    cacheTtlMs: parseInt(process.env.WORKSPACE_QUOTA_CACHE_MS) || 30 * 1000,
+    // Capped tmpfs over this workspace directory in sandboxes, for build output
+    artifactDir: process.env.WORKSPACE_ARTIFACT_DIR || '.build',
+    artifactBytes: parseInt(process.env.WORKSPACE_ARTIFACT_BYTES) || 256 * 1024 * 1024
+  },
+
+  // Workspace file API. Files are read and written as raw bytes; the JSON
+  // base64 form (?encoding=base64, { content, encoding: 'base64' }) is only
+  // for files up to jsonMaxBytes.
+  fileTransfer: {
+    jsonMaxBytes: parseInt(process.env.FILE_JSON_MAX_BYTES) || 1024 * 1024 // 1MB
+  },
+
+  // Workspace containers stopped (not removed) after idleTimeoutMs without file
+  // API calls, terminal traffic or executions, and started again on next use
+  workspaceHibernation: {
+    enabled: process.env.WORKSPACE_HIBERNATION_ENABLED
+      ? process.env.WORKSPACE_HIBERNATION_ENABLED === 'true'
+      : process.env.NODE_ENV !== 'test',
+    idleTimeoutMs: parseInt(process.env.WORKSPACE_HIBERNATION_IDLE_MS) || 30 * 60 * 1000, // 30 minutes
+    checkIntervalMs: parseInt(process.env.WORKSPACE_HIBERNATION_CHECK_MS) || 60 * 1000
+  },
+
+  // Interactive PTY sessions inside sandbox containers
+  sandboxTerminal: {
+    maxPerUser: parseInt(process.env.SANDBOX_TERMINAL_MAX_PER_USER) || 3,
+    idleTimeoutMs: parseInt(process.env.SANDBOX_TERMINAL_IDLE_TIMEOUT_MS) || 15 * 60 * 1000, // 15 minutes
+    defaultLanguage: process.env.SANDBOX_TERMINAL_LANGUAGE || 'node'
+  },
+
+  // REPL sessions (POST /api/repl): an interpreter kept alive in its own
+  // container between evaluations
+  repl: {
+    maxPerUser: parseInt(process.env.REPL_MAX_PER_USER) || 3, // the least recently used session is evicted beyond this
+    idleTimeoutMs: parseInt(process.env.REPL_IDLE_TIMEOUT_MS) || 10 * 60 * 1000, // 10 minutes
+    startTimeoutMs: parseInt(process.env.REPL_START_TIMEOUT_MS) || 15 * 1000, // until the first prompt
+    evalTimeoutMs: parseInt(process.env.REPL_EVAL_TIMEOUT_MS) || 30 * 1000, // then the snippet is interrupted (Ctrl-C)
+    maxOutputBytes: parseInt(process.env.REPL_MAX_OUTPUT_BYTES) || 1024 * 1024 // returned per evaluation
+  },
+
+  // Code formatting (POST /api/format) with the runtimes' `format` commands.
+  // Formatting skips the execution queue: each runtime has a few warm
+  // containers of its own and a short wait list in front of them.
+  format: {
+    workers: parseInt(process.env.FORMAT_WORKERS) || 2, // containers per runtime
+    maxQueued: parseInt(process.env.FORMAT_MAX_QUEUED) || 20, // waiting requests per runtime, then 429
+    timeoutMs: parseInt(process.env.FORMAT_TIMEOUT_MS) || 5000,
+    maxSourceBytes: parseInt(process.env.FORMAT_MAX_SOURCE_BYTES) || 1024 * 1024,
+    idleTimeoutMs: parseInt(process.env.FORMAT_IDLE_TIMEOUT_MS) || 10 * 60 * 1000 // idle containers are removed after this
+  },
+
+  // Language servers run inside workspace containers and bridged to the editor (lsp:* socket events)
+  lspGateway: {
+    idleTimeoutMs: parseInt(process.env.LSP_IDLE_TIMEOUT_MS) || 10 * 60 * 1000, // 10 minutes without editor traffic
+    maxRestarts: parseInt(process.env.LSP_MAX_RESTARTS) || 3, // crashes tolerated per restartWindowMs
+    restartWindowMs: parseInt(process.env.LSP_RESTART_WINDOW_MS) || 60 * 1000,
+    maxMessageBytes: parseInt(process.env.LSP_MAX_MESSAGE_BYTES) || 16 * 1024 * 1024
+  },
+
+  // Operational-transform editing sessions over workspace files (collab:* socket events)
+  collaboration: {
+    flushIntervalMs: parseInt(process.env.COLLAB_FLUSH_INTERVAL_MS) || 5000, // write the merged file at most this often
+    historyLimit: parseInt(process.env.COLLAB_HISTORY_LIMIT) || 500, // revisions kept for transforming late ops
+    maxOpComponents: parseInt(process.env.COLLAB_MAX_OP_COMPONENTS) || 200
+  },
+
+  // Workspace sharing by link (POST /api/workspaces/:workspaceId/invites)
+  workspaceInvites: {
+    defaultTtlHours: parseInt(process.env.WORKSPACE_INVITE_TTL_HOURS) || 72,
+    maxTtlHours: parseInt(process.env.WORKSPACE_INVITE_MAX_TTL_HOURS) || 30 * 24,
+    maxPerWorkspace: parseInt(process.env.WORKSPACE_INVITE_MAX_PER_WORKSPACE) || 20 // active (unexpired) links
+  },
+
+  // Runtime registry (extra file entries override or extend the bundled runtimes)
+  runtimes: {
+    file: path.join(__dirname, 'runtimes.json'),
+    extraFile: process.env.RUNTIMES_FILE || null
+  },
+
+  // Starter projects for POST /api/workspaces?template= (extra directory
+  // templates override or extend the bundled ones)
+  templates: {
+    dir: path.join(__dirname, '../templates'),
+    extraDir: process.env.TEMPLATES_DIR || null
+  },
+
+  // Admin-triggered runtime image builds (POST /api/admin/runtimes/:name/build)
+  imageBuilds: {
+    contextDir: process.env.RUNTIME_BUILD_CONTEXT || path.join(__dirname, '../docker'), // holds Dockerfile.<runtime>
+    repository: process.env.RUNTIME_IMAGE_REPOSITORY || 'studio-runtime', // tagged <repository>/<runtime>:<digest>
+    // Images that passed their smoke test, overriding the runtime files
+    imagesFile: process.env.RUNTIME_IMAGES_FILE || path.join(__dirname, '../data/runtime-images.json'),
+    smokeTimeoutMs: parseInt(process.env.RUNTIME_SMOKE_TIMEOUT_MS) || 60 * 1000
+  },
+
+  // Per-execution resource limits (plans in the plans file override these defaults)
+  resourceLimits: {
+    defaults: {
+      cpuQuota: parseInt(process.env.EXECUTION_CPU_QUOTA) || 50000, // 0.5 CPU
+      cpuPeriod: parseInt(process.env.EXECUTION_CPU_PERIOD) || 100000,
+      memoryBytes: parseInt(process.env.EXECUTION_MEMORY_BYTES) || 256 * 1024 * 1024, // 256MB
+      pidsLimit: parseInt(process.env.EXECUTION_PIDS_LIMIT) || 64,
+      diskWriteBps: parseInt(process.env.EXECUTION_DISK_WRITE_BPS) || 10 * 1024 * 1024 // 10MB/s
+    },
+    defaultPlan: process.env.EXECUTION_DEFAULT_PLAN || 'free',
+    diskDevice: process.env.EXECUTION_DISK_DEVICE || '/dev/sda', // device throttled by diskWriteBps
+    plansFile: process.env.RESOURCE_PLANS_FILE || path.join(__dirname, 'resource-plans.json')
+  },
+
   // Logging configuration
   logging: {
     level: process.env.LOG_LEVEL || 'info',
@@ -10,6 +10,10 @@ RUN apk update && apk upgrade && \
     apk add --no-cache dumb-init git && \
     rm -rf /var/cache/apk/*
 
+# Formatter for POST /api/format (gofmt plus import fixing)
+RUN GOBIN=/usr/local/bin go install golang.org/x/tools/cmd/goimports@v0.16.1 && \
+    rm -rf /go/pkg/mod /root/.cache
+
 # Create workspace directory
 RUN mkdir -p /workspace && \
     chown appuser:appgroup /workspace
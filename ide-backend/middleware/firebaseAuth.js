@@ -1,5 +1,6 @@
 const { verifyIdToken } = require('../config/firebase');
 const User = require('../models/User');
+const config = require('../config');
 const logger = require('../utils/logger');
 const { AppError } = require('./errorHandler');
 
@@ -297,7 +298,19 @@ const getFirebaseClaims = (req) => {
 };
 
 /**
- * Require admin role middleware (placeholder - implement based on your role system)
+ * Whether a user may use the admin API: their Firebase UID is listed in
+ * config.admin.uids or their role is 'admin'. Nothing the user controls,
+ * such as their email address, counts.
+ */
+const isAdmin = (user) => {
+  return Boolean(user) && (
+    (Boolean(user.firebaseUid) && config.admin.uids.includes(user.firebaseUid)) ||
+    user.role === 'admin'
+  );
+};
+
+/**
+ * Require admin role middleware
  */
 const requireAdmin = (req, res, next) => {
   try {
@@ -310,14 +323,7 @@ const requireAdmin = (req, res, next) => {
       });
     }
 
-    // For now, check if user email contains "admin" or has admin role
-    // In production, you should have a proper role system
-    const isAdmin = user.email?.includes('admin') || 
-                   user.role === 'admin' || 
-                   user.isAdmin === true ||
-                   user.email?.endsWith('@yourdomain.com'); // Replace with your admin domain
-
-    if (!isAdmin) {
+    if (!isAdmin(user)) {
       logger.warn('Non-admin user attempted admin access', {
         userId: user._id,
         firebaseUid: user.firebaseUid,
@@ -371,5 +377,6 @@ module.exports = {
   getFirebaseClaims,
   recordFailedAttempt,
   requireAdmin,
+  isAdmin,
   getSecurityStats
 };
\ No newline at end of file
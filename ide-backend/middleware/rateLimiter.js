@@ -0,0 +1,98 @@
+const config = require('../config');
+const logger = require('../utils/logger');
+const rateLimitStore = require('../services/rateLimitStore');
+const screening = require('../services/screening');
+
+const bucketFor = (bucketName) => {
+  const bucket = config.tokenBuckets.buckets[bucketName];
+  if (!bucket) {
+    throw new Error(`Unknown rate limit bucket: ${bucketName}`);
+  }
+  return bucket;
+};
+
+/**
+ * Take `cost` tokens from a caller's bucket, for the HTTP middleware below
+ * and for transports without a req/res such as the gRPC server
+ * @param {string} bucketName - Key of config.tokenBuckets.buckets
+ * @param {Object} caller - { userId } or { ip } when unauthenticated
+ * @returns {Promise<Object|null>} { key, limits, allowed, remaining, resetMs, retryAfter },
+ *   or null when rate limiting is off or the store is down
+ */
+const consume = async (bucketName, { userId = null, ip = null }, { cost = 1 } = {}) => {
+  const bucket = bucketFor(bucketName);
+  if (!config.tokenBuckets.enabled) {
+    return null;
+  }
+
+  const key = userId ? `${bucketName}:user:${userId}` : `${bucketName}:ip:${ip}`;
+  const limits = { ...(userId ? bucket.user : bucket.anonymous) };
+  limits.cost = Math.max(cost, Math.min(cost * screening.costMultiplier(userId, bucketName), limits.capacity));
+
+  let result;
+  try {
+    result = await rateLimitStore.getStore().take(key, limits);
+  } catch (error) {
+    logger.warn(`Rate limit store unavailable, allowing ${key}:`, error.message);
+    return null;
+  }
+
+  const retryAfter = Number.isFinite(result.retryAfterMs) ? Math.max(1, Math.ceil(result.retryAfterMs / 1000)) : 3600;
+  return { key, limits, ...result, retryAfter };
+};
+
+/**
+ * Token bucket rate limiting for one class of endpoint (config.tokenBuckets).
+ * Authenticated requests draw from a bucket per user ID, everything else
+ * from a bucket per client IP, so mount it after authenticateFirebase.
+ *
+ * Every response carries X-RateLimit-Limit (bucket capacity),
+ * X-RateLimit-Remaining and X-RateLimit-Reset (epoch seconds when the
+ * bucket is full again); a 429 adds Retry-After. If the store is down the
+ * request is let through rather than failing the endpoint.
+ *
+ * Users with an abuse score from code screening pay more tokens per request
+ * in the buckets config.screening.abuse.buckets names, up to the capacity.
+ *
+ * @param {string} bucketName - Key of config.tokenBuckets.buckets, e.g. 'read' or 'execute'
+ * @param {Object} options - { cost } tokens per request (default 1)
+ */
+const rateLimit = (bucketName, { cost = 1 } = {}) => {
+  bucketFor(bucketName);
+
+  return async (req, res, next) => {
+    const userId = req.user && (req.user.id || req.user._id);
+    const result = await consume(bucketName, { userId, ip: req.ip }, { cost });
+    if (!result) {
+      return next();
+    }
+    const { key, limits, retryAfter } = result;
+
+    res.set('X-RateLimit-Limit', String(limits.capacity));
+    res.set('X-RateLimit-Remaining', String(result.remaining));
+    if (Number.isFinite(result.resetMs)) {
+      res.set('X-RateLimit-Reset', String(Math.ceil((Date.now() + result.resetMs) / 1000)));
+    }
+
+    if (result.allowed) {
+      return next();
+    }
+
+    res.set('Retry-After', String(retryAfter));
+
+    logger.warn(`Rate limit exceeded for ${key}`, {
+      url: req.originalUrl,
+      ip: req.ip,
+      requestId: req.requestId
+    });
+
+    return res.status(429).json({
+      error: 'Too many requests',
+      message: `Rate limit exceeded for ${bucketName} requests, try again in ${retryAfter} seconds`,
+      retryAfter,
+      requestId: req.requestId
+    });
+  };
+};
+
+module.exports = { rateLimit, consume };
\ No newline at end of file
@@ -8,6 +8,7 @@ const config = require('../config');
 const { AppError } = require('./errorHandler');
 const logger = require('../utils/logger');
 const crypto = require('crypto');
+const requestContext = require('../utils/requestContext');
 
 // Rate limiting middleware
 const createRateLimiter = (options = {}) => {
@@ -253,14 +254,19 @@ const validationRules = {
 };
 
 
+// Workspace secret values are stored exactly as sent and never logged
+const SECRET_PATH = /^\/api\/workspaces\/[^/]+\/secrets\/[^/]+\/?$/;
+
 // Enhanced request sanitization middleware
 const sanitizeRequest = (req, res, next) => {
   try {
+    const isSecret = SECRET_PATH.test(req.path);
+
     // MongoDB injection protection
     mongoSanitize()(req, res, () => {});
     
     // XSS protection for request body
-    if (req.body && typeof req.body === 'object') {
+    if (req.body && typeof req.body === 'object' && !isSecret) {
       req.body = sanitizeObject(req.body);
     }
     
@@ -293,7 +299,7 @@ const sanitizeRequest = (req, res, next) => {
       /\/proc\/self\/environ/gi, // File inclusion
     ];
     
-    const requestString = JSON.stringify(req.body) + req.originalUrl + JSON.stringify(req.query);
+    const requestString = (isSecret ? '' : JSON.stringify(req.body)) + req.originalUrl + JSON.stringify(req.query);
     const detectedPatterns = suspiciousPatterns.filter(pattern => pattern.test(requestString));
     
     if (detectedPatterns.length > 0) {
@@ -303,7 +309,7 @@ const sanitizeRequest = (req, res, next) => {
         url: req.originalUrl,
         method: req.method,
         detectedPatterns: detectedPatterns.map(p => p.toString()),
-        body: req.body,
+        body: isSecret ? undefined : req.body,
         query: req.query,
         severity: detectedPatterns.length > 2 ? 'high' : 'medium'
       });
@@ -474,7 +480,8 @@ const ipWhitelist = (allowedIPs = []) => {
 // Request logging middleware with audit trail
 const requestLogger = (req, res, next) => {
   const start = Date.now();
-  const requestId = crypto.randomUUID();
+  // Honour an upstream X-Request-ID (proxy, client) so logs can be joined across hops
+  const requestId = requestContext.resolveRequestId(req.get('X-Request-ID'));
   
   // Add request ID to request object
   req.requestId = requestId;
@@ -512,7 +519,8 @@ const requestLogger = (req, res, next) => {
     logger[logLevel](`${req.method} ${req.originalUrl}`, logData);
   });
   
-  next();
+  // Everything downstream (including the executor) logs with this request ID
+  requestContext.run({ requestId }, next);
 };
 
 // Audit logging middleware for sensitive operations
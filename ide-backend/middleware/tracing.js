@@ -0,0 +1,40 @@
+const tracing = require('../utils/tracing');
+
+/**
+ * One span per HTTP request, continuing the caller's trace when it sends a
+ * traceparent header. Everything the handler does (queue wait, containers,
+ * execs) nests under it. Named after the matched route once it's known.
+ */
+const traceRequests = (req, res, next) => {
+  const span = tracing.startSpan(`HTTP ${req.method}`, {
+    'http.request.method': req.method,
+    'url.path': req.path,
+    'studio.request_id': req.requestId
+  }, tracing.extract(req.get('traceparent')));
+
+  let ended = false;
+  const end = () => {
+    if (ended) {
+      return;
+    }
+    ended = true;
+
+    const route = req.route ? `${req.baseUrl}${req.route.path}` : null;
+    if (route) {
+      span.updateName(`${req.method} ${route}`);
+    }
+    tracing.endSpan(span, {
+      'http.route': route,
+      'http.response.status_code': res.statusCode,
+      'studio.user_id': req.user ? req.user.id : null
+    }, res.statusCode >= 500 ? `HTTP ${res.statusCode}` : null);
+  };
+
+  // 'close' alone when the client goes away before the response completes
+  res.on('finish', end);
+  res.on('close', end);
+
+  tracing.runWithSpan(span, next);
+};
+
+module.exports = { traceRequests };
\ No newline at end of file
@@ -0,0 +1,68 @@
+const mongoose = require('mongoose');
+const Workspace = require('../models/Workspace');
+const logger = require('../utils/logger');
+const workspaceHibernation = require('../services/workspaceHibernation');
+
+// Safe methods only need to read; anything else changes the workspace
+const SAFE_METHODS = new Set(['GET', 'HEAD', 'OPTIONS']);
+
+/**
+ * Resolve the caller's role on the workspace in `req.params.workspaceId` and
+ * require one of its permissions (read, write, execute or admin). Without a
+ * permission, safe methods need read and all others need write.
+ * Sets req.workspace and req.userRole for the handler, and counts as
+ * activity on the workspace (resuming it if it hibernated).
+ * @param {string|null} permission - Required permission
+ */
+const authorizeWorkspace = (permission = null) => {
+  return async (req, res, next) => {
+    try {
+      const { workspaceId } = req.params;
+      const required = permission || (SAFE_METHODS.has(req.method) ? 'read' : 'write');
+
+      if (!mongoose.Types.ObjectId.isValid(workspaceId)) {
+        return res.status(400).json({
+          success: false,
+          message: 'Invalid workspace ID format'
+        });
+      }
+
+      const workspace = await Workspace.findById(workspaceId);
+      if (!workspace) {
+        return res.status(404).json({
+          success: false,
+          message: 'Workspace not found'
+        });
+      }
+
+      const role = workspace.getRole(req.user.id);
+      if (!role) {
+        return res.status(403).json({
+          success: false,
+          message: 'Access denied to this workspace'
+        });
+      }
+
+      if (!Workspace.permissionsForRole(role)[required]) {
+        return res.status(403).json({
+          success: false,
+          message: `Insufficient permissions: ${required} access required`,
+          role
+        });
+      }
+
+      req.workspace = workspace;
+      req.userRole = role;
+      workspaceHibernation.touch(workspaceId);
+      next();
+    } catch (error) {
+      logger.error('Error checking workspace access:', error);
+      res.status(500).json({
+        success: false,
+        message: 'Internal server error'
+      });
+    }
+  };
+};
+
+module.exports = { authorizeWorkspace };
\ No newline at end of file
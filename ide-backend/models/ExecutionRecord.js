@@ -0,0 +1,129 @@
+const mongoose = require('mongoose');
+
+// What one output stream produced; past config.outputLimits.maxStreamBytes
+// it was cut, and `spilled` means the full stream can be downloaded
+const streamStatsSchema = new mongoose.Schema({
+  bytes: { type: Number, default: 0 },
+  truncated: { type: Boolean, default: false },
+  spilled: { type: Boolean, default: false },
+  spillTruncated: { type: Boolean, default: false } // hit config.outputLimits.spillMaxBytes too
+}, { _id: false });
+
+// A finished execution as shown in the user's history. Holds what was run
+// (so it can be re-run) and a capped copy of the output.
+const executionRecordSchema = new mongoose.Schema({
+  executionId: {
+    type: String,
+    required: true,
+    unique: true
+  },
+
+  // Firebase UID of the user who ran it
+  userId: {
+    type: String,
+    required: [true, 'User ID is required']
+  },
+
+  runtime: {
+    type: String,
+    required: [true, 'Runtime is required']
+  },
+
+  // async: a background job (POST /api/executions?mode=async)
+  mode: {
+    type: String,
+    enum: ['interactive', 'async'],
+    default: 'interactive'
+  },
+
+  requestId: {
+    type: String,
+    default: null
+  },
+
+  // What was run
+  source: {
+    code: { type: String, default: null },
+    filename: { type: String, default: 'main' },
+    files: [{
+      _id: false,
+      path: { type: String, required: true },
+      content: { type: String, default: '' }
+    }],
+    entrypoint: { type: String, default: null },
+    workspaceId: { type: String, default: null }, // runs from a mounted workspace store no files
+    stdin: { type: String, default: null },
+    args: { type: [String], default: [] }, // appended to the run command
+    env: { type: Map, of: String, default: () => new Map() },
+    secretsWorkspaceId: { type: String, default: null }, // ran with this workspace's secrets; re-runs read them again
+    artifacts: { type: [String], default: [] } // glob patterns of the files to collect
+  },
+
+  codeHash: {
+    type: String,
+    required: true
+  },
+
+  // How it ended
+  status: {
+    type: String,
+    enum: ['completed', 'cancelled', 'stopped', 'error'],
+    required: true
+  },
+
+  exitCode: { type: Number, default: null },
+  killedReason: { type: String, default: null },
+  timeoutPhase: { type: String, default: null },
+  error: { type: String, default: null },
+  errorCode: { type: String, default: null }, // e.g. ACCESS_DENIED when a re-run couldn't start
+
+  // Combined stdout/stderr, capped at config.executionHistory.outputLimitBytes
+  output: {
+    text: { type: String, default: '' },
+    bytes: { type: Number, default: 0 }, // size before truncation
+    truncated: { type: Boolean, default: false },
+    // Each stream on its own under the same cap, for diffs (null on older records)
+    stdout: { type: String, default: null },
+    stderr: { type: String, default: null },
+    streams: {
+      type: new mongoose.Schema({
+        stdout: streamStatsSchema,
+        stderr: streamStatsSchema
+      }, { _id: false }),
+      default: null
+    }
+  },
+
+  timing: {
+    startedAt: { type: Date, required: true },
+    finishedAt: { type: Date, default: null },
+    durationMs: { type: Number, default: null },
+    compileDurationMs: { type: Number, default: null },
+    buildCache: { type: String, enum: ['hit', 'miss', null], default: null }, // hit: compile phase skipped
+    queueWaitMs: { type: Number, default: null }
+  },
+
+  // Files collected through source.artifacts, stored by services/artifactStore
+  artifacts: [{
+    _id: false,
+    name: { type: String, required: true }, // path relative to /workspace
+    size: { type: Number, default: 0 },
+    mimeType: { type: String, default: 'application/octet-stream' }
+  }],
+  artifactsTruncated: { type: Boolean, default: false }, // hit config.artifacts.maxFiles or maxBytes
+
+  rerunOf: {
+    type: String,
+    default: null
+  }
+}, {
+  timestamps: true
+});
+
+// Newest first per user, with executionId as the cursor tie-breaker
+executionRecordSchema.index({ userId: 1, 'timing.startedAt': -1, executionId: -1 });
+executionRecordSchema.index({ 'timing.startedAt': 1 });
+
+const ExecutionRecord = mongoose.model('ExecutionRecord', executionRecordSchema);
+
+module.exports = ExecutionRecord;
\ No newline at end of file
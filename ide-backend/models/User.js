@@ -113,6 +113,20 @@ const userSchema = new mongoose.Schema({
     default: false
   },
   
+  // Plan name used to resolve execution resource limits (see config/resource-plans.json)
+  plan: {
+    type: String,
+    trim: true,
+    default: 'free'
+  },
+  
+  // 'admin' opens the admin API (see requireAdmin); set by operators in the database only
+  role: {
+    type: String,
+    enum: ['user', 'admin'],
+    default: 'user'
+  },
+  
   // Timestamps
   lastLogin: {
     type: Date,
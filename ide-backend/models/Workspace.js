@@ -1,4 +1,5 @@
 const mongoose = require('mongoose');
+const crypto = require('crypto');
 
 const fileSchema = new mongoose.Schema({
   path: {
@@ -88,6 +89,50 @@ const collaboratorSchema = new mongoose.Schema({
   timestamps: true
 });
 
+// A share link: whoever opens it while it's valid joins with its role.
+// Only a hash of the token is stored.
+const inviteSchema = new mongoose.Schema({
+  tokenHash: {
+    type: String,
+    required: true
+  },
+  
+  role: {
+    type: String,
+    enum: ['editor', 'viewer'],
+    required: true,
+    default: 'viewer'
+  },
+  
+  expiresAt: {
+    type: Date,
+    required: true
+  },
+  
+  createdBy: {
+    type: mongoose.Schema.Types.ObjectId,
+    ref: 'User'
+  },
+  
+  uses: {
+    type: Number,
+    default: 0
+  }
+}, {
+  timestamps: true,
+  toJSON: { transform: (doc, ret) => { delete ret.tokenHash; return ret; } },
+  toObject: { transform: (doc, ret) => { delete ret.tokenHash; return ret; } }
+});
+
+// What each role may do in a workspace
+const ROLE_PERMISSIONS = {
+  owner: { read: true, write: true, execute: true, admin: true },
+  editor: { read: true, write: true, execute: true, admin: false },
+  viewer: { read: true, write: false, execute: false, admin: false }
+};
+
+const hashInviteToken = (token) => crypto.createHash('sha256').update(String(token)).digest('hex');
+
 const workspaceSchema = new mongoose.Schema({
   name: {
     type: String,
@@ -119,6 +164,8 @@ const workspaceSchema = new mongoose.Schema({
   
   collaborators: [collaboratorSchema],
   
+  invites: [inviteSchema],
+  
   files: [fileSchema],
   
   // Runtime settings
@@ -281,6 +328,12 @@ const workspaceSchema = new mongoose.Schema({
     default: false
   },
   
+  // Catalog template the workspace was created from (services/templateCatalog)
+  createdFromTemplate: {
+    type: String,
+    default: null
+  },
+  
   // Statistics
   stats: {
     totalFiles: {
@@ -323,6 +376,7 @@ const workspaceSchema = new mongoose.Schema({
 // Indexes for better query performance
 workspaceSchema.index({ owner: 1, createdAt: -1 });
 workspaceSchema.index({ 'collaborators.userId': 1 });
+workspaceSchema.index({ 'invites.tokenHash': 1 });
 workspaceSchema.index({ name: 'text', description: 'text' });
 workspaceSchema.index({ isPublic: 1, isArchived: 1 });
 workspaceSchema.index({ 'stats.lastActivity': -1 });
@@ -364,18 +418,10 @@ workspaceSchema.methods.addCollaborator = function(userId, role = 'viewer', invi
     throw new Error('User is already a collaborator');
   }
   
-  // Set permissions based on role
-  const permissions = {
-    read: true,
-    write: role === 'editor' || role === 'owner',
-    execute: role === 'editor' || role === 'owner',
-    admin: role === 'owner'
-  };
-  
   this.collaborators.push({
     userId,
     role,
-    permissions,
+    permissions: { ...ROLE_PERMISSIONS[role] },
     invitedBy
   });
   
@@ -401,16 +447,83 @@ workspaceSchema.methods.updateCollaboratorRole = function(userId, newRole) {
   }
   
   collaborator.role = newRole;
-  collaborator.permissions = {
-    read: true,
-    write: newRole === 'editor' || newRole === 'owner',
-    execute: newRole === 'editor' || newRole === 'owner',
-    admin: newRole === 'owner'
-  };
+  collaborator.permissions = { ...ROLE_PERMISSIONS[newRole] };
   
   return this.save();
 };
 
+// Instance method to resolve a user's role (owner, editor, viewer), or null without access
+workspaceSchema.methods.getRole = function(userId) {
+  if (!userId) {
+    return null;
+  }
+  if (this.owner.toString() === userId.toString()) {
+    return 'owner';
+  }
+
+  const collaborator = this.collaborators.find(
+    collab => collab.userId.toString() === userId.toString()
+  );
+
+  return collaborator ? collaborator.role : null;
+};
+
+// Instance method to check a user's permission (read, write, execute, admin)
+workspaceSchema.methods.hasPermission = function(userId, permission = 'read') {
+  const role = this.getRole(userId);
+  return Boolean(role && ROLE_PERMISSIONS[role][permission]);
+};
+
+// Instance method to create a share link; returns the token, which is not stored
+workspaceSchema.methods.createInvite = async function(role, createdBy, ttlMs) {
+  const token = crypto.randomBytes(24).toString('base64url');
+
+  // Expired links are dropped whenever a new one is made
+  this.invites = this.invites.filter(invite => invite.expiresAt > new Date());
+  this.invites.push({
+    tokenHash: hashInviteToken(token),
+    role,
+    expiresAt: new Date(Date.now() + ttlMs),
+    createdBy
+  });
+
+  await this.save();
+  return { token, invite: this.invites[this.invites.length - 1] };
+};
+
+// Instance method to revoke a share link
+workspaceSchema.methods.revokeInvite = function(inviteId) {
+  const invite = this.invites.id(inviteId);
+  if (!invite) {
+    throw new Error('Invite not found');
+  }
+
+  this.invites.pull(invite._id);
+  return this.save();
+};
+
+// Instance method to join through a share link. Existing members keep their role.
+workspaceSchema.methods.acceptInvite = async function(token, userId) {
+  const tokenHash = hashInviteToken(token);
+  const invite = this.invites.find(entry => entry.tokenHash === tokenHash);
+
+  if (!invite) {
+    throw new Error('Invite not found');
+  }
+  if (invite.expiresAt <= new Date()) {
+    throw new Error('Invite has expired');
+  }
+
+  const existingRole = this.getRole(userId);
+  if (existingRole) {
+    return existingRole;
+  }
+
+  invite.uses += 1;
+  await this.addCollaborator(userId, invite.role, invite.createdBy);
+  return invite.role;
+};
+
 // Instance method to add or update file
 workspaceSchema.methods.updateFile = function(filePath, content, language, modifiedBy) {
   const existingFileIndex = this.files.findIndex(
@@ -461,6 +574,19 @@ workspaceSchema.statics.findByUser = function(userId) {
     .sort({ 'stats.lastActivity': -1 });
 };
 
+// Static method to find the workspace a share link belongs to
+workspaceSchema.statics.findByInviteToken = function(token) {
+  return this.findOne({
+    'invites.tokenHash': hashInviteToken(token),
+    isArchived: false
+  });
+};
+
+// Static method for the permissions granted by a role
+workspaceSchema.statics.permissionsForRole = function(role) {
+  return { ...(ROLE_PERMISSIONS[role] || { read: false, write: false, execute: false, admin: false }) };
+};
+
 // Static method to find public workspaces
 workspaceSchema.statics.findPublic = function(limit = 20) {
   return this.find({
@@ -0,0 +1,35 @@
+const mongoose = require('mongoose');
+
+// One secret of a workspace, encrypted by services/workspaceSecrets. The key
+// never leaves the server and the plaintext is never stored or returned.
+const workspaceSecretSchema = new mongoose.Schema({
+  workspaceId: {
+    type: String,
+    required: [true, 'Workspace ID is required']
+  },
+
+  // Injected as an environment variable of this name
+  name: {
+    type: String,
+    required: [true, 'Secret name is required']
+  },
+
+  // AES-256-GCM, base64; the workspace ID and name are the associated data
+  iv: { type: String, required: true },
+  ciphertext: { type: String, required: true },
+  tag: { type: String, required: true },
+
+  // Firebase UID of whoever set the current value
+  updatedBy: {
+    type: String,
+    default: null
+  }
+}, {
+  timestamps: true
+});
+
+workspaceSecretSchema.index({ workspaceId: 1, name: 1 }, { unique: true });
+
+const WorkspaceSecret = mongoose.model('WorkspaceSecret', workspaceSecretSchema);
+
+module.exports = WorkspaceSecret;
\ No newline at end of file
@@ -2,9 +2,13 @@
 const User = require('./User');
 const Workspace = require('./Workspace');
 const ExecutionJob = require('./ExecutionJob');
+const ExecutionRecord = require('./ExecutionRecord');
+const WorkspaceSecret = require('./WorkspaceSecret');
 
 module.exports = {
   User,
   Workspace,
-  ExecutionJob
+  ExecutionJob,
+  ExecutionRecord,
+  WorkspaceSecret
 };
\ No newline at end of file
@@ -0,0 +1,145 @@
+const express = require('express');
+const imageBuilder = require('../services/imageBuilder');
+const configManager = require('../services/configManager');
+const logger = require('../utils/logger');
+const { authenticateFirebase, requireAdmin } = require('../middleware/firebaseAuth');
+
+const router = express.Router();
+
+// Every admin route needs an authenticated admin
+router.use(authenticateFirebase, requireAdmin);
+
+const BUILD_ERROR_STATUS = {
+  RUNTIME_NOT_FOUND: 404,
+  NO_SMOKE_TEST: 400,
+  NO_DOCKERFILE: 400,
+  BUILD_IN_PROGRESS: 409,
+  BUILD_FAILED: 422,
+  SMOKE_FAILED: 422
+};
+
+/**
+ * Rebuild a runtime image from docker/Dockerfile.<name> and switch the
+ * runtime to it once its smoke test passes
+ * POST /api/admin/runtimes/:name/build
+ *
+ * Clients asking for text/event-stream get the build output as it happens;
+ * anyone else gets the result and the full log once the build is done.
+ */
+router.post('/runtimes/:name/build', async (req, res) => {
+  const sse = req.accepts(['application/json', 'text/event-stream']) === 'text/event-stream';
+  const sendFrame = (frame) => res.write(`data: ${JSON.stringify(frame)}\n\n`);
+  const log = [];
+
+  // The stream opens with the first build event, so requests rejected up
+  // front (unknown runtime, build already running) still get a status code
+  const onEvent = (frame) => {
+    if (frame.event === 'output') {
+      log.push(frame.text);
+    }
+    if (!sse || res.writableEnded) {
+      return;
+    }
+    if (!res.headersSent) {
+      res.writeHead(200, {
+        'Content-Type': 'text/event-stream',
+        'Cache-Control': 'no-cache',
+        'Connection': 'keep-alive'
+      });
+    }
+    sendFrame(frame);
+  };
+
+  try {
+    const result = await imageBuilder.build(req.params.name, { userId: req.user.id, onEvent });
+
+    logger.info(`Runtime ${result.runtime} switched to ${result.image}`, {
+      previousImage: result.previousImage,
+      userId: req.user.id
+    });
+
+    if (sse) {
+      sendFrame({ event: 'switched', ...result });
+      return res.end();
+    }
+
+    res.json({
+      success: true,
+      data: { ...result, log: log.join('') }
+    });
+  } catch (error) {
+    let status = BUILD_ERROR_STATUS[error.code] || 500;
+    if (error.message === 'Docker is not available') {
+      status = 503;
+    }
+    if (status === 500) {
+      logger.error(`Error building image for runtime ${req.params.name}:`, error);
+    } else {
+      logger.warn(`Image build for runtime ${req.params.name} failed: ${error.message}`);
+    }
+
+    const message = status === 500 ? 'Failed to build runtime image' : error.message;
+
+    if (res.headersSent) {
+      sendFrame({ event: 'error', code: error.code, message, smoke: error.smoke });
+      return res.end();
+    }
+
+    res.status(status).json({
+      success: false,
+      message,
+      code: error.code,
+      smoke: error.smoke,
+      log: log.join('')
+    });
+  }
+});
+
+/**
+ * Runtime timeouts, resource limits and warm pool sizes in effect
+ * GET /api/admin/config
+ */
+router.get('/config', (req, res) => {
+  res.json({
+    success: true,
+    data: configManager.get()
+  });
+});
+
+/**
+ * Change settings without a restart. The body holds only the settings to
+ * change, e.g. { "containerPool": { "sizes": { "python": 3 } } }; when any
+ * of them is invalid none is applied. Running executions keep their limits.
+ * PUT /api/admin/config
+ */
+router.put('/config', async (req, res) => {
+  try {
+    const { config, changes } = await configManager.update(req.body, {
+      userId: req.user.id,
+      ip: req.ip,
+      userAgent: req.get('User-Agent')
+    });
+
+    res.json({
+      success: true,
+      data: { config, changes }
+    });
+  } catch (error) {
+    if (error.code === 'INVALID_CONFIG') {
+      return res.status(400).json({
+        success: false,
+        message: 'Invalid configuration',
+        code: error.code,
+        errors: error.errors
+      });
+    }
+
+    logger.error('Error updating runtime configuration:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to update configuration'
+    });
+  }
+});
+
+module.exports = router;
\ No newline at end of file
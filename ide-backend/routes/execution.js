@@ -1,8 +1,28 @@
 const express = require('express');
+const crypto = require('crypto');
 const { body, param, validationResult } = require('express-validator');
 const dockerService = require('../services/dockerService');
+const executionService = require('../services/executionService');
+const executionQueue = require('../services/executionQueue');
+const executionAudit = require('../services/executionAudit');
+const judgeService = require('../services/judgeService');
+const benchmarkService = require('../services/benchmarkService');
+const workspaceSecrets = require('../services/workspaceSecrets');
+const sandboxes = require('../services/sandboxes');
 const logger = require('../utils/logger');
 const { authenticateFirebase } = require('../middleware/firebaseAuth');
+const { rateLimit } = require('../middleware/rateLimiter');
+const resourceLimits = require('../services/resourceLimits');
+const runtimeRegistry = require('../services/runtimeRegistry');
+const projectFiles = require('../utils/projectFiles');
+const programInput = require('../utils/programInput');
+const artifactPatterns = require('../utils/artifactPatterns');
+const fileSystem = require('../utils/fileSystem');
+const Workspace = require('../models/Workspace');
+const config = require('../config');
+const { COMPARISON_MODES } = require('../utils/judgeComparison');
+const execErrors = require('../utils/execErrors');
+const { ExecError } = execErrors;
 
 const router = express.Router();
 
@@ -13,37 +33,48 @@ router.use(authenticateFirebase);
  * Create and start a new execution container
  * POST /api/execution/containers
  */
-router.post('/containers', [
+router.post('/containers', rateLimit('execute'), [
   body('language')
-    .isIn(['node', 'python', 'java', 'cpp', 'go', 'rust'])
+    .custom(value => runtimeRegistry.has(value))
     .withMessage('Unsupported language'),
   body('workspaceId')
     .isString()
     .isLength({ min: 1 })
-    .withMessage('Workspace ID is required')
+    .withMessage('Workspace ID is required'),
+  body('workspace_id')
+    .optional()
+    .isMongoId()
+    .withMessage('workspace_id must be a valid persistent workspace ID')
 ], async (req, res) => {
   try {
     if (!dockerService.isAvailable) {
-      return res.status(503).json({
-        error: 'Service unavailable',
-        message: 'Code execution is not available: Docker is not running'
-      });
+      return execErrors.send(res, execErrors.dockerUnavailable(), { requestId: req.requestId });
     }
 
     const errors = validationResult(req);
     if (!errors.isEmpty()) {
-      return res.status(400).json({
-        error: 'Validation failed',
-        details: errors.array()
-      });
+      return execErrors.send(res, execErrors.validationFailed(errors.array()), { requestId: req.requestId });
     }
 
-    const { language, workspaceId } = req.body;
+    const { language, workspaceId, workspace_id: mountWorkspaceId } = req.body;
     const userId = req.user.id;
 
     logger.info(`Creating container for user ${userId}, workspace ${workspaceId}, language ${language}`);
 
-    const container = await dockerService.createContainer(language, workspaceId, userId);
+    const options = {
+      limits: resourceLimits.resolveForUser(req.user)
+    };
+
+    // Persistent workspaces are mounted read-write to run code in, so viewers can't mount them
+    if (mountWorkspaceId) {
+      const workspace = await Workspace.findById(mountWorkspaceId);
+      if (!workspace || !workspace.hasPermission(userId, 'execute')) {
+        throw new ExecError('forbidden', 'ACCESS_DENIED', 'Workspace not found or access denied');
+      }
+      options.mountWorkspaceId = mountWorkspaceId;
+    }
+
+    const container = await dockerService.createContainer(language, workspaceId, userId, options);
 
     res.status(201).json({
       success: true,
@@ -52,10 +83,7 @@ router.post('/containers', [
 
   } catch (error) {
     logger.error('Container creation failed:', error);
-    res.status(500).json({
-      error: 'Container creation failed',
-      message: error.message
-    });
+    execErrors.send(res, error, { requestId: req.requestId, title: 'Container creation failed' });
   }
 });
 
@@ -63,87 +91,575 @@ router.post('/containers', [
  * Execute code in a container
  * POST /api/execution/execute
  */
-router.post('/execute', [
+router.post('/execute', rateLimit('execute'), [
   body('containerId')
     .isString()
     .isLength({ min: 1 })
     .withMessage('Container ID is required'),
   body('code')
+    .if(body('files').not().exists())
+    .if(body('workspace_id').not().exists())
     .isString()
     .isLength({ min: 1 })
     .withMessage('Code is required'),
+  body('files')
+    .optional()
+    .isObject()
+    .withMessage('files must be an object of path to contents'),
+  body('entrypoint')
+    .optional()
+    .isString()
+    .withMessage('entrypoint must be a string'),
+  body('workspace_id')
+    .optional()
+    .isMongoId()
+    .withMessage('workspace_id must be a valid persistent workspace ID'),
   body('filename')
     .optional()
     .isString()
-    .withMessage('Filename must be a string')
+    .withMessage('Filename must be a string'),
+  body('stdin')
+    .optional()
+    .isString()
+    .isLength({ max: 1024 * 1024 })
+    .withMessage('stdin must be a string of at most 1MB'),
+  body('args')
+    .optional()
+    .isArray()
+    .withMessage('args must be an array of strings'),
+  body('env')
+    .optional()
+    .isObject()
+    .withMessage('env must be an object of variable name to string'),
+  body('artifacts')
+    .optional()
+    .isArray()
+    .withMessage('artifacts must be an array of glob patterns'),
+  body('use_secrets')
+    .optional()
+    .isBoolean()
+    .toBoolean()
+    .withMessage('use_secrets must be a boolean'),
+  body('compile_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('compile_timeout_ms must be a positive integer'),
+  body('run_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('run_timeout_ms must be a positive integer')
 ], async (req, res) => {
   try {
     if (!dockerService.isAvailable) {
-      return res.status(503).json({
-        error: 'Service unavailable',
-        message: 'Code execution is not available: Docker is not running'
-      });
+      return execErrors.send(res, execErrors.dockerUnavailable(), { requestId: req.requestId });
     }
 
     const errors = validationResult(req);
     if (!errors.isEmpty()) {
-      return res.status(400).json({
-        error: 'Validation failed',
-        details: errors.array()
-      });
+      return execErrors.send(res, execErrors.validationFailed(errors.array()), { requestId: req.requestId });
     }
 
-    const { containerId, code, filename = 'main' } = req.body;
+    const { containerId, code, filename = 'main', stdin = null, files = null, entrypoint = null, workspace_id: workspaceId = null, args = null, env = null } = req.body;
     const userId = req.user.id;
+    execErrors.checkCodeSize(code);
+
+    if (files) {
+      const project = projectFiles.validate(files, entrypoint);
+      if (!project.isValid) {
+        return execErrors.send(res, execErrors.validationFailed(project.errors.map(msg => ({ param: 'files', msg }))), { requestId: req.requestId });
+      }
+    }
 
     logger.info(`Executing code for user ${userId}, container ${containerId}`);
 
-    // Verify container belongs to user
-    const containerInfo = await dockerService.getContainerInfo(containerId);
+    // Verify container belongs to user, asking the provider that created it
+    const sandbox = sandboxes.forContainer(containerId);
+    const containerInfo = await sandbox.inspect(containerId);
     if (!containerInfo || containerInfo.userId !== userId) {
-      return res.status(403).json({
-        error: 'Access denied',
-        message: 'Container not found or access denied'
-      });
+      throw new ExecError('forbidden', 'ACCESS_DENIED', 'Container not found or access denied');
+    }
+
+    // Env names are checked against the runtime the container runs
+    const argsInput = programInput.validateArgs(args);
+    const envInput = programInput.validateEnv(env, runtimeRegistry.get(containerInfo.language));
+    const artifactsInput = artifactPatterns.validate(req.body.artifacts);
+    if (!argsInput.isValid || !envInput.isValid || !artifactsInput.isValid) {
+      return execErrors.send(res, execErrors.validationFailed([
+        ...argsInput.errors.map(msg => ({ param: 'args', msg })),
+        ...envInput.errors.map(msg => ({ param: 'env', msg })),
+        ...artifactsInput.errors.map(msg => ({ param: 'artifacts', msg }))
+      ]), { requestId: req.requestId });
+    }
+
+    // Secrets belong to the persistent workspace mounted in the container;
+    // their values are read once a slot is free, right before the run
+    let secretsWorkspaceId = null;
+    if (req.body.use_secrets) {
+      if (!containerInfo.mountWorkspaceId) {
+        return execErrors.send(res, execErrors.validationFailed([
+          { param: 'use_secrets', msg: 'use_secrets needs a container created with a persistent workspace (workspace_id) mounted' }
+        ]), { requestId: req.requestId });
+      }
+
+      // SECRETS_DISABLED and ACCESS_DENIED become 503 and 403 below
+      await workspaceSecrets.authorize(containerInfo.mountWorkspaceId, userId);
+      secretsWorkspaceId = containerInfo.mountWorkspaceId;
     }
 
-    const execution = await dockerService.executeCode(containerId, code, filename);
+    const networkEnabled = Boolean(containerInfo.networkEnabled);
+    const execOptions = { stdin, files, entrypoint, args: argsInput.args, env: envInput.env };
+
+    // Requests may tighten the runtime's compile/run limits, never extend them
+    if (req.body.compile_timeout_ms !== undefined) {
+      execOptions.compileTimeoutMs = parseInt(req.body.compile_timeout_ms, 10);
+    }
+    if (req.body.run_timeout_ms !== undefined) {
+      execOptions.runTimeoutMs = parseInt(req.body.run_timeout_ms, 10);
+    }
+
+    // Run straight from the mounted persistent workspace instead of shipping files
+    if (workspaceId) {
+      if (containerInfo.mountWorkspaceId !== workspaceId) {
+        return execErrors.send(res, execErrors.validationFailed([
+          { param: 'workspace_id', msg: 'Container was not created with this workspace mounted' }
+        ]), { requestId: req.requestId });
+      }
+
+      const mountedFiles = await fileSystem.listFilesRecursive(workspaceId);
+      if (!entrypoint || !mountedFiles.includes(entrypoint)) {
+        return execErrors.send(res, execErrors.validationFailed([
+          { param: 'entrypoint', msg: 'entrypoint must be a file in the workspace' }
+        ]), { requestId: req.requestId });
+      }
+
+      execOptions.files = null;
+      execOptions.mountedFiles = mountedFiles;
+    }
+
+    // Blocked code is a 422 before anything is streamed
+    await executionService.screen(userId, {
+      language: containerInfo.language,
+      code,
+      files: execOptions.files,
+      workspaceId,
+      mountedFiles: execOptions.mountedFiles
+    });
+
+    // Clients asking for text/event-stream get framed JSON events,
+    // everyone else gets the raw demultiplexed output
+    const sse = req.accepts(['text/plain', 'text/event-stream']) === 'text/event-stream';
+
+    const sendFrame = (frame) => {
+      res.write(`data: ${JSON.stringify(frame)}\n\n`);
+    };
+
+    // Wait for an execution slot; a full queue is backpressure (429), not a failure
+    const ticket = executionQueue.enqueue(userId, {
+      onPosition: (position) => {
+        if (sse && res.headersSent && !res.writableEnded) {
+          sendFrame({ event: 'queued', position });
+        }
+      }
+    });
+
+    const executionId = crypto.randomUUID();
 
     // Set up streaming response
     res.writeHead(200, {
-      'Content-Type': 'text/plain',
+      'Content-Type': sse ? 'text/event-stream' : 'text/plain',
       'Transfer-Encoding': 'chunked',
       'Cache-Control': 'no-cache',
-      'Connection': 'keep-alive'
+      'Connection': 'keep-alive',
+      'X-Execution-ID': executionId,
+      'X-Network-Enabled': String(networkEnabled)
+    });
+
+    // The ID is usable with DELETE /api/executions/:id right away; network_enabled
+    // tells users whether outbound requests can work at all
+    if (sse) {
+      sendFrame({ event: 'started', executionId, request_id: req.requestId, network_enabled: networkEnabled });
+      if (ticket.state === 'waiting') {
+        sendFrame({ event: 'queued', position: ticket.position });
+      }
+    }
+
+    // Handle client disconnect: leave the queue, or cancel the execution and kill the container.
+    // While sandbox.exec is still starting the program (compile included) the slot stays
+    // held; the program is killed once exec returns
+    let aborted = false;
+    res.on('close', () => {
+      if (res.writableEnded) {
+        return;
+      }
+      if (executionService.activeExecutions.has(executionId)) {
+        logger.info('Client disconnected, cancelling execution');
+        executionService.cancelExecution(executionId, 'client_disconnected').catch(error =>
+          logger.error('Failed to cancel execution after disconnect:', error)
+        );
+      } else if (ticket.state === 'waiting') {
+        ticket.cancel();
+      } else {
+        aborted = true;
+      }
     });
 
+    await ticket.ready;
+    if (ticket.state === 'cancelled') {
+      return;
+    }
+
+    let execution;
+    try {
+      if (secretsWorkspaceId) {
+        execOptions.secrets = await workspaceSecrets.forExecution(secretsWorkspaceId, userId);
+      }
+      if (aborted) {
+        ticket.release();
+        return;
+      }
+      execution = await sandbox.exec(containerId, code, filename, execOptions);
+    } catch (error) {
+      ticket.release();
+      logger.error('Code execution failed:', error);
+      // The 200 is already sent; the frame carries the code and kind instead
+      if (sse) {
+        sendFrame(execErrors.toFrame(error, req.requestId));
+      } else {
+        res.write(`\nExecution error: ${error.message}\n`);
+      }
+      return res.end();
+    }
+    if (aborted) {
+      return executionService.abandonStart(containerId, execution, ticket);
+    }
+
+    const executionData = {
+      id: executionId,
+      containerId,
+      userId,
+      code,
+      filename,
+      files,
+      entrypoint,
+      stdin,
+      args: argsInput.args,
+      env: envInput.env,
+      workspaceId,
+      secretsWorkspaceId,
+      artifactPatterns: artifactsInput.patterns,
+      language: containerInfo.language,
+      startTime: new Date(),
+      status: 'running',
+      output: '',
+      stdout: '',
+      stderr: '',
+      execution,
+      queueTicket: ticket,
+      requestId: req.requestId,
+      ...executionAudit.measureCode(code, files)
+    };
+    executionService.registerExecution(executionData, { secrets: execOptions.secrets });
+
     // Stream output to client
-    execution.stream.on('data', (chunk) => {
-      res.write(chunk);
+    executionService.streamExecution(execution, executionData, {
+      onFrame: (frame) => {
+        if (sse) {
+          sendFrame(frame);
+        } else {
+          res.write(frame.data);
+        }
+      },
+      onExit: ({ status, code, duration_ms, killed_reason, timeout_phase, diagnostics, cache, compile_ms, stdout_truncated, stderr_truncated, artifacts }) => {
+        executionService.finishExecution(executionId);
+        // Compile errors, crashes, timeouts and OOM kills are results, reported in `status`
+        if (sse) {
+          sendFrame({ event: 'exit', status, code, duration_ms, killed_reason, timeout_phase, diagnostics, cache, compile_ms, stdout_truncated, stderr_truncated, artifacts });
+        } else if (killed_reason === 'timeout' && timeout_phase) {
+          res.write(`\nProcess killed: ${timeout_phase} timeout\n`);
+        } else if (killed_reason === 'disk_limit') {
+          res.write('\nDisk limit exceeded: scratch space is full\n');
+        } else if (killed_reason) {
+          res.write(`\nProcess killed: ${killed_reason}\n`);
+        }
+        res.end();
+      },
+      onError: (error) => {
+        executionService.finishExecution(executionId);
+        logger.error('Execution stream error:', error);
+        if (sse) {
+          sendFrame(execErrors.toFrame(error, req.requestId));
+        } else {
+          res.write(`\nExecution error: ${error.message}\n`);
+        }
+        res.end();
+      },
+      onCancel: () => {
+        if (res.writableEnded) {
+          return;
+        }
+        if (sse) {
+          sendFrame({ event: 'cancelled' });
+        } else {
+          res.write('\nExecution cancelled\n');
+        }
+        res.end();
+      }
     });
 
-    execution.stream.on('end', () => {
-      res.end();
+  } catch (error) {
+    logger.error('Code execution failed:', error);
+    if (res.headersSent) {
+      if (!res.writableEnded) {
+        if (req.accepts(['text/plain', 'text/event-stream']) === 'text/event-stream') {
+          res.write(`data: ${JSON.stringify(execErrors.toFrame(error, req.requestId))}\n\n`);
+        }
+        res.end();
+      }
+      return;
+    }
+    execErrors.send(res, error, { requestId: req.requestId, title: 'Code execution failed' });
+  }
+});
+
+/**
+ * Judge code against input/output test cases
+ * POST /api/execution/judge
+ */
+router.post('/judge', rateLimit('execute'), [
+  body('containerId')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Container ID is required'),
+  body('code')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Code is required'),
+  body('filename')
+    .optional()
+    .isString()
+    .withMessage('Filename must be a string'),
+  body('cases')
+    .isArray({ min: 1, max: config.judge.maxCases })
+    .withMessage(`cases must be an array of 1 to ${config.judge.maxCases} test cases`),
+  body('cases.*.stdin')
+    .optional()
+    .isString()
+    .isLength({ max: 1024 * 1024 })
+    .withMessage('stdin must be a string of at most 1MB'),
+  body('cases.*.expected_stdout')
+    .isString()
+    .withMessage('expected_stdout is required for every case'),
+  body(['comparison', 'cases.*.comparison'])
+    .optional()
+    .isIn(COMPARISON_MODES)
+    .withMessage(`comparison must be one of ${COMPARISON_MODES.join(', ')}`),
+  body(['tolerance', 'cases.*.tolerance'])
+    .optional()
+    .isFloat({ min: 0 })
+    .withMessage('tolerance must be a non-negative number'),
+  body('max_failures')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('max_failures must be a positive integer'),
+  body('case_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('case_timeout_ms must be a positive integer'),
+  body('compile_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('compile_timeout_ms must be a positive integer')
+], async (req, res) => {
+  // Clients asking for text/event-stream get each verdict as its case finishes
+  const sse = req.accepts(['application/json', 'text/event-stream']) === 'text/event-stream';
+  const sendFrame = (frame) => res.write(`data: ${JSON.stringify(frame)}\n\n`);
+  let ticket = null;
+
+  try {
+    if (!dockerService.isAvailable) {
+      return execErrors.send(res, execErrors.dockerUnavailable(), { requestId: req.requestId });
+    }
+
+    const errors = validationResult(req);
+    if (!errors.isEmpty()) {
+      return execErrors.send(res, execErrors.validationFailed(errors.array()), { requestId: req.requestId });
+    }
+
+    const { containerId, code, filename = 'main', cases } = req.body;
+    const userId = req.user.id;
+    execErrors.checkCodeSize(code);
+
+    const containerInfo = await sandboxes.forContainer(containerId).inspect(containerId);
+    if (!containerInfo || containerInfo.userId !== userId) {
+      throw new ExecError('forbidden', 'ACCESS_DENIED', 'Container not found or access denied');
+    }
+
+    await executionService.screen(userId, { language: containerInfo.language, code });
+
+    // The whole submission holds one execution slot, cases run one at a time
+    ticket = executionQueue.enqueue(userId);
+
+    if (sse) {
+      res.writeHead(200, {
+        'Content-Type': 'text/event-stream',
+        'Cache-Control': 'no-cache',
+        'Connection': 'keep-alive'
+      });
+      res.on('close', () => ticket.cancel());
+    }
+
+    await ticket.ready;
+    if (ticket.state === 'cancelled') {
+      return;
+    }
+
+    const optionalInt = (value) => (value !== undefined ? parseInt(value, 10) : undefined);
+    const report = await judgeService.run(containerId, { code, filename, cases }, {
+      comparison: req.body.comparison,
+      tolerance: req.body.tolerance !== undefined ? parseFloat(req.body.tolerance) : undefined,
+      maxFailures: optionalInt(req.body.max_failures),
+      caseTimeoutMs: optionalInt(req.body.case_timeout_ms),
+      compileTimeoutMs: optionalInt(req.body.compile_timeout_ms),
+      onCase: (result) => {
+        if (sse && !res.writableEnded) {
+          sendFrame({ event: 'case', ...result });
+        }
+      }
     });
 
-    execution.stream.on('error', (error) => {
-      logger.error('Execution stream error:', error);
-      res.write(`\nExecution error: ${error.message}\n`);
-      res.end();
+    logger.info(`Judged submission for user ${userId}, container ${containerId}: ${report.verdict}`);
+
+    if (sse) {
+      sendFrame({ event: 'verdict', ...report });
+      return res.end();
+    }
+
+    res.json({
+      success: true,
+      ...report
     });
+  } catch (error) {
+    logger.error('Judge run failed:', error);
+    if (res.headersSent) {
+      sendFrame(execErrors.toFrame(error, req.requestId));
+      return res.end();
+    }
+    execErrors.send(res, error, { requestId: req.requestId, title: 'Judge run failed' });
+  } finally {
+    if (ticket) {
+      ticket.release();
+    }
+  }
+});
+
+/**
+ * Run a program several times on CPUs reserved for benchmarks and report
+ * per-trial wall/user/sys times with min/median/stddev. Each benchmark gets
+ * a fresh container; `pinning.pinned` is false when it couldn't be pinned.
+ * POST /api/execution/benchmark
+ */
+router.post('/benchmark', rateLimit('execute'), [
+  body('language')
+    .custom(value => runtimeRegistry.has(value))
+    .withMessage('Unsupported language'),
+  body('code')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Code is required'),
+  body('filename')
+    .optional()
+    .isString()
+    .withMessage('Filename must be a string'),
+  body('stdin')
+    .optional()
+    .isString()
+    .isLength({ max: 1024 * 1024 })
+    .withMessage('stdin must be a string of at most 1MB'),
+  body('trials')
+    .optional()
+    .isInt({ min: 1, max: config.benchmark.maxTrials })
+    .withMessage(`trials must be between 1 and ${config.benchmark.maxTrials}`),
+  body('run_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('run_timeout_ms must be a positive integer'),
+  body('compile_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('compile_timeout_ms must be a positive integer')
+], async (req, res) => {
+  // Clients asking for text/event-stream see their queue position and each trial as it finishes
+  const sse = req.accepts(['application/json', 'text/event-stream']) === 'text/event-stream';
+  const sendFrame = (frame) => res.write(`data: ${JSON.stringify(frame)}\n\n`);
+  const aborted = new AbortController();
+
+  try {
+    if (!dockerService.isAvailable) {
+      return execErrors.send(res, execErrors.dockerUnavailable(), { requestId: req.requestId });
+    }
 
-    // Handle client disconnect
-    req.on('close', () => {
-      logger.info('Client disconnected, cleaning up execution');
-      execution.stream.destroy();
+    const errors = validationResult(req);
+    if (!errors.isEmpty()) {
+      return execErrors.send(res, execErrors.validationFailed(errors.array()), { requestId: req.requestId });
+    }
+
+    const { language, code, filename = 'main', stdin = null } = req.body;
+    const userId = req.user.id;
+    execErrors.checkCodeSize(code);
+
+    await executionService.screen(userId, { language, code });
+
+    if (sse) {
+      res.writeHead(200, {
+        'Content-Type': 'text/event-stream',
+        'Cache-Control': 'no-cache',
+        'Connection': 'keep-alive'
+      });
+    }
+    res.on('close', () => aborted.abort());
+
+    const optionalInt = (value) => (value !== undefined ? parseInt(value, 10) : undefined);
+    const report = await benchmarkService.run(userId, {
+      language,
+      code,
+      filename,
+      stdin,
+      trials: optionalInt(req.body.trials)
+    }, {
+      runTimeoutMs: optionalInt(req.body.run_timeout_ms),
+      compileTimeoutMs: optionalInt(req.body.compile_timeout_ms),
+      signal: aborted.signal,
+      onQueued: (position) => {
+        if (sse && !res.writableEnded) {
+          sendFrame({ event: 'queued', position });
+        }
+      },
+      onTrial: (trial) => {
+        if (sse && !res.writableEnded) {
+          sendFrame({ event: 'trial', ...trial });
+        }
+      }
     });
+    if (!report) {
+      return; // the client went away while it waited for a slot
+    }
 
-  } catch (error) {
-    logger.error('Code execution failed:', error);
-    res.status(500).json({
-      error: 'Code execution failed',
-      message: error.message
+    if (sse) {
+      sendFrame({ event: 'result', ...report });
+      return res.end();
+    }
+
+    res.json({
+      success: true,
+      ...report
     });
+  } catch (error) {
+    logger.error('Benchmark run failed:', error);
+    if (res.headersSent) {
+      sendFrame(execErrors.toFrame(error, req.requestId));
+      return res.end();
+    }
+    execErrors.send(res, error, { requestId: req.requestId, title: 'Benchmark run failed' });
   }
 });
 
@@ -315,7 +831,8 @@ router.get('/stats', async (req, res) => {
           totalContainers: 0,
           containersByLanguage: {},
           containersByWorkspace: {},
-          activeContainers: 0
+          activeContainers: 0,
+          queue: executionQueue.getMetrics()
         }
       });
     }
@@ -328,7 +845,8 @@ router.get('/stats', async (req, res) => {
       totalContainers: userContainers.length,
       containersByLanguage: {},
       containersByWorkspace: {},
-      activeContainers: 0
+      activeContainers: 0,
+      queue: executionQueue.getMetrics()
     };
 
     for (const container of userContainers) {
@@ -0,0 +1,808 @@
+const fs = require('fs');
+const path = require('path');
+const express = require('express');
+const { body, param, query, validationResult } = require('express-validator');
+const executionService = require('../services/executionService');
+const executionHistory = require('../services/executionHistory');
+const outputSpill = require('../services/outputSpill');
+const artifactStore = require('../services/artifactStore');
+const asyncJobs = require('../services/asyncJobs');
+const batchExecutions = require('../services/batchExecutions');
+const executionDiff = require('../services/executionDiff');
+const workspaceSecrets = require('../services/workspaceSecrets');
+const dockerService = require('../services/dockerService');
+const sandboxes = require('../services/sandboxes');
+const runtimeRegistry = require('../services/runtimeRegistry');
+const projectFiles = require('../utils/projectFiles');
+const programInput = require('../utils/programInput');
+const artifactPatterns = require('../utils/artifactPatterns');
+const config = require('../config');
+const logger = require('../utils/logger');
+const execErrors = require('../utils/execErrors');
+const { authenticateFirebase } = require('../middleware/firebaseAuth');
+const { rateLimit } = require('../middleware/rateLimiter');
+
+const router = express.Router();
+
+// Apply authentication to all execution routes
+router.use(authenticateFirebase);
+
+const OUTPUT_STREAMS = ['stdout', 'stderr'];
+
+// Records from before per-stream caps have no stream stats
+const streamStats = (record, stream) => (record.output.streams && record.output.streams[stream]) || { bytes: 0, truncated: false, spilled: false };
+
+// History list entries leave out code and output; GET /:id has those
+const toSummary = (record) => ({
+  executionId: record.executionId,
+  runtime: record.runtime,
+  mode: record.mode || 'interactive',
+  status: record.status,
+  exitCode: record.exitCode,
+  killedReason: record.killedReason,
+  timeoutPhase: record.timeoutPhase,
+  codeHash: record.codeHash,
+  startedAt: record.timing.startedAt,
+  finishedAt: record.timing.finishedAt,
+  durationMs: record.timing.durationMs,
+  compileDurationMs: record.timing.compileDurationMs,
+  buildCache: record.timing.buildCache || null,
+  queueWaitMs: record.timing.queueWaitMs,
+  outputBytes: record.output.bytes,
+  outputTruncated: record.output.truncated,
+  stdoutTruncated: streamStats(record, 'stdout').truncated,
+  stderrTruncated: streamStats(record, 'stderr').truncated,
+  rerunOf: record.rerunOf
+});
+
+const toDetail = (record) => ({
+  ...toSummary(record),
+  requestId: record.requestId,
+  error: record.error,
+  errorCode: record.errorCode || null,
+  source: {
+    code: record.source.code,
+    filename: record.source.filename,
+    files: record.source.files,
+    entrypoint: record.source.entrypoint,
+    workspaceId: record.source.workspaceId,
+    stdin: record.source.stdin,
+    args: record.source.args || [],
+    env: record.source.env || {},
+    useSecrets: Boolean(record.source.secretsWorkspaceId),
+    artifacts: record.source.artifacts || []
+  },
+  output: record.output.text,
+  // Full output of streams cut at the cap, while the spill file is kept
+  downloads: Object.fromEntries(OUTPUT_STREAMS
+    .filter(stream => streamStats(record, stream).spilled)
+    .map(stream => [stream, `/api/executions/${record.executionId}/output?stream=${stream}`])),
+  artifacts: (record.artifacts || []).map(artifact => ({
+    name: artifact.name,
+    size: artifact.size,
+    mimeType: artifact.mimeType,
+    url: artifactStore.urlFor(record.executionId, artifact.name)
+  })),
+  artifactsTruncated: Boolean(record.artifactsTruncated)
+});
+
+const sendValidationErrors = (req, res) => {
+  const errors = validationResult(req);
+  if (!errors.isEmpty()) {
+    execErrors.send(res, execErrors.validationFailed(errors.array()), { requestId: req.requestId });
+    return true;
+  }
+  return false;
+};
+
+/**
+ * List the user's finished executions, newest first
+ * GET /api/executions?limit=&cursor=
+ */
+router.get('/', [
+  query('limit')
+    .optional()
+    .isInt({ min: 1, max: config.executionHistory.maxPageSize })
+    .withMessage(`limit must be between 1 and ${config.executionHistory.maxPageSize}`),
+  query('cursor')
+    .optional()
+    .isString()
+    .isLength({ min: 1, max: 512 })
+    .withMessage('cursor must be a nextCursor from a previous page')
+], async (req, res) => {
+  try {
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    const { records, nextCursor } = await executionHistory.list(req.user.id, {
+      limit: req.query.limit ? parseInt(req.query.limit, 10) : undefined,
+      cursor: req.query.cursor || null
+    });
+
+    res.json({
+      success: true,
+      executions: records.map(toSummary),
+      nextCursor
+    });
+  } catch (error) {
+    if (error.code === 'INVALID_CURSOR') {
+      return res.status(400).json({
+        error: 'Validation failed',
+        details: [{ param: 'cursor', msg: error.message }]
+      });
+    }
+    logger.error('Failed to list executions:', error);
+    res.status(500).json({
+      error: 'Failed to list executions',
+      message: error.message
+    });
+  }
+});
+
+/**
+ * Run code as a background job. Responds 202 with the job's execution ID right
+ * away; poll GET /api/executions/:id or pass callback_url to be POSTed the result.
+ * POST /api/executions?mode=async
+ */
+router.post('/', rateLimit('execute'), [
+  query('mode')
+    .equals('async')
+    .withMessage('mode must be async; interactive runs use POST /api/execution/execute'),
+  body('language')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('language is required'),
+  body('code')
+    .if(body('files').not().exists())
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Code is required'),
+  body('files')
+    .optional()
+    .isObject()
+    .withMessage('files must be an object of path to contents'),
+  body('entrypoint')
+    .optional()
+    .isString()
+    .withMessage('entrypoint must be a string'),
+  body('filename')
+    .optional()
+    .isString()
+    .withMessage('Filename must be a string'),
+  body('stdin')
+    .optional()
+    .isString()
+    .isLength({ max: 1024 * 1024 })
+    .withMessage('stdin must be a string of at most 1MB'),
+  body('args')
+    .optional()
+    .isArray()
+    .withMessage('args must be an array of strings'),
+  body('env')
+    .optional()
+    .isObject()
+    .withMessage('env must be an object of variable name to string'),
+  body('artifacts')
+    .optional()
+    .isArray()
+    .withMessage('artifacts must be an array of glob patterns'),
+  body('compile_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('compile_timeout_ms must be a positive integer'),
+  body('run_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('run_timeout_ms must be a positive integer'),
+  body('use_secrets')
+    .optional()
+    .isBoolean()
+    .toBoolean()
+    .withMessage('use_secrets must be a boolean'),
+  body('workspace_id')
+    .if(body('use_secrets').equals('true'))
+    .isMongoId()
+    .withMessage('use_secrets needs the workspace_id whose secrets to use'),
+  body('callback_url')
+    .optional()
+    .isString()
+    .isLength({ min: 1, max: 2048 })
+    .withMessage('callback_url must be a URL')
+], async (req, res) => {
+  try {
+    if (!dockerService.isAvailable) {
+      return execErrors.send(res, execErrors.dockerUnavailable(), { requestId: req.requestId });
+    }
+
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    execErrors.checkCodeSize(req.body.code);
+    const { files = null, entrypoint = null } = req.body;
+    if (files) {
+      const project = projectFiles.validate(files, entrypoint);
+      if (!project.isValid) {
+        return execErrors.send(res, execErrors.validationFailed(project.errors.map(msg => ({ param: 'files', msg }))), { requestId: req.requestId });
+      }
+    }
+
+    const argsInput = programInput.validateArgs(req.body.args);
+    const envInput = programInput.validateEnv(req.body.env, runtimeRegistry.get(req.body.language));
+    const artifactsInput = artifactPatterns.validate(req.body.artifacts);
+    if (!argsInput.isValid || !envInput.isValid || !artifactsInput.isValid) {
+      return execErrors.send(res, execErrors.validationFailed([
+        ...argsInput.errors.map(msg => ({ param: 'args', msg })),
+        ...envInput.errors.map(msg => ({ param: 'env', msg })),
+        ...artifactsInput.errors.map(msg => ({ param: 'artifacts', msg }))
+      ]), { requestId: req.requestId });
+    }
+
+    await executionService.screen(req.user.id, { language: req.body.language, code: req.body.code, files });
+
+    // Checked now so the caller hears about it; the values are read when the job starts
+    const secretsWorkspaceId = req.body.use_secrets ? req.body.workspace_id : null;
+    if (secretsWorkspaceId) {
+      await workspaceSecrets.authorize(secretsWorkspaceId, req.user.id);
+    }
+
+    // Bad runtimes and callbacks are 400s, limits 429 (see utils/execErrors)
+    const job = asyncJobs.submit(req.user.id, {
+      language: req.body.language,
+      code: req.body.code,
+      filename: req.body.filename,
+      files,
+      entrypoint,
+      stdin: req.body.stdin,
+      args: argsInput.args,
+      env: envInput.env,
+      secretsWorkspaceId,
+      artifacts: artifactsInput.patterns,
+      // Up to the async tier's limits rather than the interactive ones
+      compileTimeoutMs: req.body.compile_timeout_ms !== undefined ? parseInt(req.body.compile_timeout_ms, 10) : undefined,
+      runTimeoutMs: req.body.run_timeout_ms !== undefined ? parseInt(req.body.run_timeout_ms, 10) : undefined,
+      callbackUrl: req.body.callback_url
+    });
+
+    res.status(202)
+      .location(`${req.baseUrl}/${job.id}`)
+      .json({
+        success: true,
+        execution: asyncJobs.toJSON(job)
+      });
+  } catch (error) {
+    logger.error('Failed to submit background job:', error);
+    execErrors.send(res, error, { requestId: req.requestId, title: 'Failed to submit background job' });
+  }
+});
+
+/**
+ * Run one program against many variants (stdin/args/env) in parallel, up to
+ * the user's execution limit. Responds 202 with the batch; clients accepting
+ * text/event-stream instead get `started`, `progress` (completed/total) and
+ * `finished` (all results) events. Closing the stream doesn't cancel the
+ * batch; DELETE /api/executions/batch/:id does.
+ * POST /api/executions/batch
+ */
+router.post('/batch', rateLimit('execute'), [
+  body('language')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('language is required'),
+  body('code')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Code is required'),
+  body('filename')
+    .optional()
+    .isString()
+    .withMessage('Filename must be a string'),
+  body('variants')
+    .isArray({ min: 1, max: config.batchExecutions.maxVariants })
+    .withMessage(`variants must be an array of 1 to ${config.batchExecutions.maxVariants} variants`),
+  body('variants.*.stdin')
+    .optional()
+    .isString()
+    .isLength({ max: 1024 * 1024 })
+    .withMessage('stdin must be a string of at most 1MB'),
+  body('variants.*.args')
+    .optional()
+    .isArray()
+    .withMessage('args must be an array of strings'),
+  body('variants.*.env')
+    .optional()
+    .isObject()
+    .withMessage('env must be an object of variable name to string'),
+  body('compile_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('compile_timeout_ms must be a positive integer'),
+  body('run_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('run_timeout_ms must be a positive integer')
+], async (req, res) => {
+  try {
+    if (!dockerService.isAvailable) {
+      return execErrors.send(res, execErrors.dockerUnavailable(), { requestId: req.requestId });
+    }
+
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    execErrors.checkCodeSize(req.body.code);
+    await executionService.screen(req.user.id, { language: req.body.language, code: req.body.code });
+
+    const batch = batchExecutions.submit(req.user.id, {
+      language: req.body.language,
+      code: req.body.code,
+      filename: req.body.filename,
+      variants: req.body.variants,
+      compileTimeoutMs: req.body.compile_timeout_ms !== undefined ? parseInt(req.body.compile_timeout_ms, 10) : undefined,
+      runTimeoutMs: req.body.run_timeout_ms !== undefined ? parseInt(req.body.run_timeout_ms, 10) : undefined
+    });
+
+    if (req.accepts(['application/json', 'text/event-stream']) !== 'text/event-stream') {
+      return res.status(202)
+        .location(`${req.baseUrl}/batch/${batch.id}`)
+        .json({
+          success: true,
+          batch: batchExecutions.toJSON(batch)
+        });
+    }
+
+    res.writeHead(200, {
+      'Content-Type': 'text/event-stream',
+      'Cache-Control': 'no-cache',
+      'Connection': 'keep-alive',
+      'X-Batch-ID': batch.id
+    });
+
+    const sendFrame = (frame) => {
+      res.write(`data: ${JSON.stringify(frame)}\n\n`);
+    };
+    const onProgress = (progress) => sendFrame({ event: 'progress', ...progress });
+    const onFinished = (result) => {
+      sendFrame({ event: 'finished', ...result });
+      res.end();
+    };
+
+    batch.events.on('progress', onProgress);
+    batch.events.once('finished', onFinished);
+    res.on('close', () => {
+      batch.events.off('progress', onProgress);
+      batch.events.off('finished', onFinished);
+    });
+
+    sendFrame({ event: 'started', batchId: batch.id, total: batch.variants.length, request_id: req.requestId });
+  } catch (error) {
+    logger.error('Failed to submit batch:', error);
+    execErrors.send(res, error, { requestId: req.requestId, title: 'Failed to submit batch' });
+  }
+});
+
+/**
+ * Get a batch with the results of its finished variants, in variant order
+ * GET /api/executions/batch/:id
+ */
+router.get('/batch/:id', [
+  param('id')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Batch ID is required')
+], async (req, res) => {
+  if (sendValidationErrors(req, res)) {
+    return;
+  }
+
+  const batch = batchExecutions.get(req.user.id, req.params.id);
+  if (!batch) {
+    return res.status(404).json({
+      error: 'Batch not found',
+      message: 'Batch not found or no longer kept'
+    });
+  }
+
+  res.json({
+    success: true,
+    batch: batchExecutions.toJSON(batch)
+  });
+});
+
+/**
+ * Cancel a batch: queued variants are dropped, running ones killed
+ * DELETE /api/executions/batch/:id
+ */
+router.delete('/batch/:id', [
+  param('id')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Batch ID is required')
+], async (req, res) => {
+  if (sendValidationErrors(req, res)) {
+    return;
+  }
+
+  const { id } = req.params;
+  if (!batchExecutions.cancel(req.user.id, id)) {
+    return res.status(404).json({
+      error: 'Batch not found',
+      message: 'Batch is not running'
+    });
+  }
+
+  res.json({
+    success: true,
+    batchId: id,
+    event: 'cancelled'
+  });
+});
+
+/**
+ * Get one execution: the stored record, or the live state while it is queued
+ * or running. Background jobs report `state` queued, running or finished.
+ * GET /api/executions/:id
+ */
+router.get('/:id', [
+  param('id')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Execution ID is required')
+], async (req, res) => {
+  try {
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    const { id } = req.params;
+    const job = asyncJobs.get(req.user.id, id);
+    if (job && job.state !== 'finished') {
+      return res.json({
+        success: true,
+        execution: asyncJobs.toJSON(job)
+      });
+    }
+
+    const live = executionService.activeExecutions.get(id) || executionService.queuedReruns.get(id);
+    if (live && live.userId === req.user.id) {
+      return res.json({
+        success: true,
+        execution: {
+          executionId: id,
+          runtime: live.language,
+          status: live.status,
+          startedAt: live.startTime || null,
+          rerunOf: live.rerunOf || null
+        }
+      });
+    }
+
+    const record = await executionHistory.get(req.user.id, id);
+    if (!record) {
+      if (job) {
+        return res.json({
+          success: true,
+          execution: asyncJobs.toJSON(job)
+        });
+      }
+      return res.status(404).json({
+        error: 'Execution not found',
+        message: 'No such execution in your history'
+      });
+    }
+
+    const execution = toDetail(record);
+    if (record.mode === 'async') {
+      execution.state = 'finished';
+      execution.callback = job ? asyncJobs.toJSON(job).callback : null;
+    }
+
+    res.json({
+      success: true,
+      execution
+    });
+  } catch (error) {
+    logger.error('Failed to get execution:', error);
+    res.status(500).json({
+      error: 'Failed to get execution',
+      message: error.message
+    });
+  }
+});
+
+/**
+ * Download the full output of one stream, spilled to disk while it ran
+ * GET /api/executions/:id/output?stream=stdout|stderr
+ */
+router.get('/:id/output', [
+  param('id')
+    .matches(/^[\w-]+$/)
+    .withMessage('Invalid execution ID'),
+  query('stream')
+    .optional()
+    .isIn(OUTPUT_STREAMS)
+    .withMessage('stream must be stdout or stderr')
+], async (req, res) => {
+  try {
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    const { id } = req.params;
+    const stream = req.query.stream || 'stdout';
+    const record = await executionHistory.get(req.user.id, id);
+    if (!record) {
+      return res.status(404).json({
+        error: 'Execution not found',
+        message: 'No such execution in your history'
+      });
+    }
+
+    const file = streamStats(record, stream).spilled ? await outputSpill.find(id, stream) : null;
+    if (!file) {
+      return res.status(404).json({
+        error: 'Output not available',
+        message: `No full ${stream} was kept for this execution (spilling is off, the stream was empty, or the file expired)`
+      });
+    }
+
+    res.set({
+      'Content-Type': 'text/plain; charset=utf-8',
+      'Content-Length': String(file.size),
+      'Content-Disposition': `attachment; filename="${id}.${stream}.txt"`,
+      'X-Output-Truncated': String(Boolean(streamStats(record, stream).spillTruncated))
+    });
+
+    fs.createReadStream(file.path)
+      .on('error', (error) => {
+        logger.error(`Failed to read spilled output of ${id}:`, error);
+        res.destroy(error);
+      })
+      .pipe(res);
+  } catch (error) {
+    logger.error('Failed to get execution output:', error);
+    res.status(500).json({
+      error: 'Failed to get execution output',
+      message: error.message
+    });
+  }
+});
+
+/**
+ * Download a file the execution collected through `artifacts`. The name is
+ * its path relative to /workspace, e.g. out/plot.png.
+ * GET /api/executions/:id/artifacts/:name
+ */
+router.get('/:id/artifacts/:name(*)', [
+  param('id')
+    .matches(/^[\w-]+$/)
+    .withMessage('Invalid execution ID'),
+  param('name')
+    .isString()
+    .isLength({ min: 1, max: 1024 })
+    .withMessage('Invalid artifact name')
+], async (req, res) => {
+  try {
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    const { id, name } = req.params;
+    const record = await executionHistory.get(req.user.id, id);
+    if (!record) {
+      return res.status(404).json({
+        error: 'Execution not found',
+        message: 'No such execution in your history'
+      });
+    }
+
+    const artifact = (record.artifacts || []).find(candidate => candidate.name === name);
+    const file = artifact ? await artifactStore.find(id, name) : null;
+    if (!file) {
+      return res.status(404).json({
+        error: 'Artifact not found',
+        message: `${name} was not collected by this execution, or has expired`
+      });
+    }
+
+    res.set({
+      'Content-Type': artifact.mimeType,
+      'Content-Length': String(file.size),
+      // Program output is untrusted: never render it as a page of this origin
+      'X-Content-Type-Options': 'nosniff',
+      'Content-Security-Policy': "default-src 'none'; sandbox"
+    });
+    res.attachment(path.posix.basename(name));
+
+    fs.createReadStream(file.path)
+      .on('error', (error) => {
+        logger.error(`Failed to read artifact ${name} of ${id}:`, error);
+        res.destroy(error);
+      })
+      .pipe(res);
+  } catch (error) {
+    logger.error('Failed to get execution artifact:', error);
+    res.status(500).json({
+      error: 'Failed to get execution artifact',
+      message: error.message
+    });
+  }
+});
+
+/**
+ * Compare two of your executions: status, exit code, duration and a line
+ * diff of stdout and stderr as stored in the history. `presets` (comma
+ * separated: timestamps, addresses, uuids, durations) and `normalize` regexes
+ * (repeatable) blank out volatile output on both sides first.
+ * GET /api/executions/:id/diff/:otherId
+ */
+router.get('/:id/diff/:otherId', [
+  param('id')
+    .matches(/^[\w-]+$/)
+    .withMessage('Invalid execution ID'),
+  param('otherId')
+    .matches(/^[\w-]+$/)
+    .withMessage('Invalid execution ID'),
+  query('presets')
+    .optional()
+    .isString()
+    .withMessage('presets must be a comma separated list'),
+  query('normalize')
+    .optional()
+    .custom(value => typeof value === 'string' || (Array.isArray(value) && value.every(item => typeof item === 'string')))
+    .withMessage('normalize must be one or more patterns')
+], async (req, res) => {
+  try {
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    const { normalize } = req.query;
+    const diff = await executionDiff.diff(req.user.id, req.params.id, req.params.otherId, {
+      presets: req.query.presets ? req.query.presets.split(',').map(name => name.trim()).filter(Boolean) : [],
+      patterns: normalize === undefined ? [] : [].concat(normalize)
+    });
+
+    res.json({
+      success: true,
+      diff
+    });
+  } catch (error) {
+    const classified = execErrors.classify(error);
+    if (classified.kind === 'infrastructure') {
+      logger.error('Failed to diff executions:', error);
+    }
+    execErrors.send(res, classified, { requestId: req.requestId, title: 'Failed to diff executions' });
+  }
+});
+
+/**
+ * Run a stored execution again through the execution queue
+ * POST /api/executions/:id/rerun
+ */
+router.post('/:id/rerun', rateLimit('execute'), [
+  param('id')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Execution ID is required'),
+  body('containerId')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Container ID is required')
+], async (req, res) => {
+  try {
+    if (!dockerService.isAvailable) {
+      return execErrors.send(res, execErrors.dockerUnavailable(), { requestId: req.requestId });
+    }
+
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    const record = await executionHistory.get(req.user.id, req.params.id);
+    if (!record) {
+      return res.status(404).json({
+        error: 'Execution not found',
+        message: 'No such execution in your history'
+      });
+    }
+
+    const containerInfo = await sandboxes.forContainer(req.body.containerId).inspect(req.body.containerId);
+    if (!containerInfo || containerInfo.userId !== req.user.id) {
+      throw new execErrors.ExecError('forbidden', 'ACCESS_DENIED', 'Container not found or access denied');
+    }
+
+    if (containerInfo.language !== record.runtime) {
+      return execErrors.send(res, execErrors.validationFailed([
+        { param: 'containerId', msg: `Execution ran on ${record.runtime}, container runs ${containerInfo.language}` }
+      ]), { requestId: req.requestId });
+    }
+
+    if (record.source.workspaceId && containerInfo.mountWorkspaceId !== record.source.workspaceId) {
+      return execErrors.send(res, execErrors.validationFailed([
+        { param: 'containerId', msg: 'Container was not created with the execution\'s workspace mounted' }
+      ]), { requestId: req.requestId });
+    }
+
+    const rerun = await executionService.rerunExecution(record, containerInfo, req.user.id);
+
+    res.status(202).json({
+      success: true,
+      executionId: rerun.executionId,
+      status: rerun.status,
+      rerunOf: record.executionId
+    });
+  } catch (error) {
+    logger.error('Failed to re-run execution:', error);
+    execErrors.send(res, error, { requestId: req.requestId, title: 'Failed to re-run execution' });
+  }
+});
+
+/**
+ * Cancel a running execution
+ * DELETE /api/executions/:id
+ */
+router.delete('/:id', [
+  param('id')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Execution ID is required')
+], async (req, res) => {
+  try {
+    const errors = validationResult(req);
+    if (!errors.isEmpty()) {
+      return res.status(400).json({
+        error: 'Validation failed',
+        details: errors.array()
+      });
+    }
+
+    const { id } = req.params;
+
+    // Background jobs can also be cancelled before they start
+    if (asyncJobs.cancel(req.user.id, id)) {
+      logger.info(`Background job ${id} cancelled by user ${req.user.id}`);
+      return res.json({
+        success: true,
+        executionId: id,
+        event: 'cancelled'
+      });
+    }
+
+    const execution = executionService.activeExecutions.get(id);
+
+    // Finished, unknown and other users' executions all look the same
+    if (!execution || execution.userId !== req.user.id) {
+      return res.status(404).json({
+        error: 'Execution not found',
+        message: 'Execution is not running'
+      });
+    }
+
+    const cancelled = await executionService.cancelExecution(id, 'user_cancelled');
+    if (!cancelled) {
+      return res.status(404).json({
+        error: 'Execution not found',
+        message: 'Execution is not running'
+      });
+    }
+
+    logger.info(`Execution ${id} cancelled by user ${req.user.id}`);
+
+    res.json({
+      success: true,
+      executionId: id,
+      event: 'cancelled'
+    });
+  } catch (error) {
+    logger.error('Failed to cancel execution:', error);
+    res.status(500).json({
+      error: 'Failed to cancel execution',
+      message: error.message
+    });
+  }
+});
+
+module.exports = router;
\ No newline at end of file
@@ -4,13 +4,25 @@ const multer = require('multer');
 const path = require('path');
 
 const { authenticateFirebase } = require('../middleware/firebaseAuth');
-const { Workspace } = require('../models');
+const { rateLimit } = require('../middleware/rateLimiter');
+const { authorizeWorkspace } = require('../middleware/workspaceAccess');
 const fileSystem = require('../utils/fileSystem');
 const fileValidation = require('../utils/fileValidation');
+const fileTransfer = require('../utils/fileTransfer');
+const { detectContentType, isBinaryContentType } = require('../utils/contentType');
 const logger = require('../utils/logger');
+const config = require('../config');
+const workspaceQuota = require('../services/workspaceQuota');
 
 const router = express.Router();
 
+// Writes that would take the workspace past its quota, with where it stands now
+const sendQuotaExceeded = (res, error) => res.status(413).json({
+  error: error.message,
+  code: error.code,
+  usage: error.usage
+});
+
 // Configure multer for file uploads
 const upload = multer({
   storage: multer.memoryStorage(),
@@ -27,45 +39,6 @@ const upload = multer({
   }
 });
 
-// Middleware to check workspace access
-const checkWorkspaceAccess = async (req, res, next) => {
-  try {
-    const { workspaceId } = req.params;
-    const userId = req.user.id;
-
-    const workspace = await Workspace.findById(workspaceId);
-    if (!workspace) {
-      return res.status(404).json({ error: 'Workspace not found' });
-    }
-
-    // Check if user has access to workspace
-    const hasAccess = workspace.owner.toString() === userId ||
-      workspace.collaborators.some(collab => collab.userId.toString() === userId);
-
-    if (!hasAccess) {
-      return res.status(403).json({ error: 'Access denied to workspace' });
-    }
-
-    // Check permissions for write operations
-    const isWriteOperation = ['POST', 'PUT', 'DELETE'].includes(req.method);
-    if (isWriteOperation) {
-      const isOwner = workspace.owner.toString() === userId;
-      const collaborator = workspace.collaborators.find(collab => collab.userId.toString() === userId);
-      const hasWriteAccess = isOwner || (collaborator && collaborator.permissions.write);
-
-      if (!hasWriteAccess) {
-        return res.status(403).json({ error: 'Write access denied' });
-      }
-    }
-
-    req.workspace = workspace;
-    next();
-  } catch (error) {
-    logger.error('Error checking workspace access:', error);
-    res.status(500).json({ error: 'Internal server error' });
-  }
-};
-
 // Validation middleware
 const validateFilePath = [
   param('filePath').custom((value) => {
@@ -86,9 +59,10 @@ const validateFileContent = [
 // GET /api/files/:workspaceId - List files in workspace root
 router.get('/:workspaceId',
   authenticateFirebase,
+  rateLimit('read'),
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   query('path').optional().isString(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -123,8 +97,9 @@ router.get('/:workspaceId',
 // GET /api/files/:workspaceId/*filePath - Get file content
 router.get('/:workspaceId/*',
   authenticateFirebase,
+  rateLimit('read'),
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -164,14 +139,25 @@ router.get('/:workspaceId/*',
         });
       }
 
-      // Read file content
-      const content = await fileSystem.readFile(workspaceId, filePath);
+      // Binary files come base64 encoded, and only small ones (use /download)
+      const { mimeType, isBinary } = await fileSystem.detectFileType(workspaceId, filePath);
+      if (isBinary && stats.size > config.fileTransfer.jsonMaxBytes) {
+        return res.status(413).json({
+          error: `Binary files over ${config.fileTransfer.jsonMaxBytes} bytes can only be downloaded`,
+          code: 'FILE_TOO_LARGE'
+        });
+      }
+
+      const content = await fileSystem.readFile(workspaceId, filePath, isBinary ? 'base64' : 'utf8');
       const language = fileValidation.detectLanguage(filePath);
 
       res.json({
         type: 'file',
         path: filePath,
         content,
+        encoding: isBinary ? 'base64' : 'utf8',
+        mimeType,
+        isBinary,
         language,
         size: stats.size,
         lastModified: stats.modified
@@ -191,7 +177,7 @@ router.put('/:workspaceId/*',
   authenticateFirebase,
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   validateFileContent,
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -219,6 +205,8 @@ router.put('/:workspaceId/*',
         return res.status(400).json({ error: contentValidation.errors.join(', ') });
       }
 
+      await workspaceQuota.checkWrite(workspaceId, filePath, Buffer.byteLength(content, 'utf8'));
+
       // Write file to filesystem
       const size = await fileSystem.writeFile(workspaceId, filePath, content);
 
@@ -234,6 +222,12 @@ router.put('/:workspaceId/*',
         warnings: contentValidation.warnings
       });
     } catch (error) {
+      if (error.code === 'QUOTA_EXCEEDED') {
+        return sendQuotaExceeded(res, error);
+      }
+      if (error.code === 'SYMLINK_NOT_ALLOWED') {
+        return res.status(400).json({ error: error.message, code: error.code });
+      }
       logger.error('Error saving file:', error);
       res.status(500).json({ error: 'Failed to save file' });
     }
@@ -247,7 +241,7 @@ router.post('/:workspaceId/create',
   body('path').isString().notEmpty().withMessage('Path is required'),
   body('type').isIn(['file', 'directory']).withMessage('Type must be file or directory'),
   body('content').optional().isString(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -284,6 +278,8 @@ router.post('/:workspaceId/create',
           return res.status(400).json({ error: contentValidation.errors.join(', ') });
         }
 
+        await workspaceQuota.checkWrite(workspaceId, itemPath, Buffer.byteLength(content, 'utf8'));
+
         // Create file
         const size = await fileSystem.writeFile(workspaceId, itemPath, content);
         
@@ -300,6 +296,12 @@ router.post('/:workspaceId/create',
         });
       }
     } catch (error) {
+      if (error.code === 'QUOTA_EXCEEDED') {
+        return sendQuotaExceeded(res, error);
+      }
+      if (error.code === 'SYMLINK_NOT_ALLOWED') {
+        return res.status(400).json({ error: error.message, code: error.code });
+      }
       logger.error('Error creating item:', error);
       res.status(500).json({ error: 'Failed to create item' });
     }
@@ -310,7 +312,7 @@ router.post('/:workspaceId/create',
 router.delete('/:workspaceId/*',
   authenticateFirebase,
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -369,7 +371,7 @@ router.post('/:workspaceId/move',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   body('from').isString().notEmpty().withMessage('Source path is required'),
   body('to').isString().notEmpty().withMessage('Destination path is required'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -438,7 +440,7 @@ router.post('/:workspaceId/copy',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   body('from').isString().notEmpty().withMessage('Source path is required'),
   body('to').isString().notEmpty().withMessage('Destination path is required'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -475,6 +477,10 @@ router.post('/:workspaceId/copy',
       // Get source stats
       const sourceStats = await fileSystem.getItemStats(workspaceId, sourcePath);
 
+      // The copy adds everything under the source again
+      const copied = await fileSystem.getWorkspaceStats(workspaceId, sourcePath);
+      await workspaceQuota.checkGrowth(workspaceId, copied.totalSize, copied.fileCount);
+
       // Copy item
       await fileSystem.copyItem(workspaceId, sourcePath, destPath);
 
@@ -493,6 +499,12 @@ router.post('/:workspaceId/copy',
         type: sourceStats.type
       });
     } catch (error) {
+      if (error.code === 'QUOTA_EXCEEDED') {
+        return sendQuotaExceeded(res, error);
+      }
+      if (error.code === 'SYMLINK_NOT_ALLOWED') {
+        return res.status(400).json({ error: error.message, code: error.code });
+      }
       logger.error('Error copying item:', error);
       res.status(500).json({ error: 'Failed to copy item' });
     }
@@ -503,7 +515,7 @@ router.post('/:workspaceId/copy',
 router.post('/:workspaceId/upload',
   authenticateFirebase,
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   upload.array('files', 10),
   async (req, res) => {
     try {
@@ -522,6 +534,7 @@ router.post('/:workspaceId/upload',
 
       const results = [];
       const uploadErrors = [];
+      let quotaUsage = null;
 
       for (const file of files) {
         try {
@@ -542,27 +555,44 @@ router.post('/:workspaceId/upload',
             continue;
           }
 
-          // Convert buffer to string
-          const content = file.buffer.toString('utf8');
+          // Binary files are written as they are; text is checked and decoded
+          const isBinary = isBinaryContentType(detectContentType(file.buffer));
+          const content = isBinary ? file.buffer : file.buffer.toString('utf8');
 
           // Validate content
-          const contentValidation = fileValidation.validateFileContent(content, filePath);
+          const contentValidation = isBinary
+            ? { isValid: true, warnings: [], language: 'binary' }
+            : fileValidation.validateFileContent(content, filePath);
           if (!contentValidation.isValid) {
             uploadErrors.push({ file: fileName, error: contentValidation.errors.join(', ') });
             continue;
           }
 
+          try {
+            await workspaceQuota.checkWrite(workspaceId, filePath, file.buffer.length);
+          } catch (error) {
+            if (error.code !== 'QUOTA_EXCEEDED') {
+              throw error;
+            }
+            uploadErrors.push({ file: fileName, error: error.message, code: error.code });
+            quotaUsage = error.usage;
+            continue;
+          }
+
           // Save file
           const size = await fileSystem.writeFile(workspaceId, filePath, content);
           
-          // Update workspace model
-          await req.workspace.updateFile(filePath, content, contentValidation.language, req.user.id);
+          // Update workspace model (it only mirrors text files)
+          if (!isBinary) {
+            await req.workspace.updateFile(filePath, content, contentValidation.language, req.user.id);
+          }
 
           results.push({
             file: fileName,
             path: filePath,
             size,
             language: contentValidation.language,
+            isBinary,
             warnings: contentValidation.warnings
           });
         } catch (error) {
@@ -571,10 +601,12 @@ router.post('/:workspaceId/upload',
         }
       }
 
-      res.json({
+      // Nothing written because the workspace is full: the whole upload was refused
+      res.status(results.length === 0 && quotaUsage ? 413 : 200).json({
         message: `${results.length} files uploaded successfully`,
         uploaded: results,
-        errors: uploadErrors
+        errors: uploadErrors,
+        ...(quotaUsage && { usage: quotaUsage })
       });
     } catch (error) {
       logger.error('Error uploading files:', error);
@@ -586,8 +618,9 @@ router.post('/:workspaceId/upload',
 // GET /api/files/:workspaceId/download/*filePath - Download file
 router.get('/:workspaceId/download/*',
   authenticateFirebase,
+  rateLimit('read'),
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -621,17 +654,12 @@ router.get('/:workspaceId/download/*',
         return res.status(400).json({ error: 'Cannot download directory' });
       }
 
-      // Read file content
-      const content = await fileSystem.readFile(workspaceId, filePath);
-      const fileName = path.basename(filePath);
-
-      // Set appropriate headers
-      res.setHeader('Content-Disposition', `attachment; filename="${fileName}"`);
-      res.setHeader('Content-Type', 'application/octet-stream');
-      res.setHeader('Content-Length', Buffer.byteLength(content, 'utf8'));
-
-      res.send(content);
+      // Streamed with its sniffed type; Range requests resume downloads
+      await fileTransfer.sendFile(req, res, workspaceId, filePath, stats, { attachment: true });
     } catch (error) {
+      if (res.headersSent) {
+        return res.destroy(error);
+      }
       logger.error('Error downloading file:', error);
       res.status(500).json({ error: 'Failed to download file' });
     }
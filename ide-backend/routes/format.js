@@ -0,0 +1,61 @@
+const express = require('express');
+const { body, validationResult } = require('express-validator');
+const dockerService = require('../services/dockerService');
+const formatService = require('../services/formatService');
+const logger = require('../utils/logger');
+const execErrors = require('../utils/execErrors');
+const { authenticateFirebase } = require('../middleware/firebaseAuth');
+const { rateLimit } = require('../middleware/rateLimiter');
+
+const router = express.Router();
+
+// Apply authentication to all format routes
+router.use(authenticateFirebase);
+
+/**
+ * Format source code with the runtime's formatter (gofmt/goimports, black,
+ * prettier). Source the formatter can't parse is not a failed request: the
+ * response has status syntax_error and the errors with their positions.
+ * POST /api/format
+ */
+router.post('/', rateLimit('format'), [
+  body('runtime')
+    .isString()
+    .withMessage('runtime is required'),
+  body('source')
+    .isString()
+    .withMessage('source must be a string'),
+  body('filename')
+    .optional()
+    .matches(/^[A-Za-z0-9_-][A-Za-z0-9_.-]*$/)
+    .withMessage('filename must be a bare file name')
+], async (req, res) => {
+  try {
+    if (!dockerService.isAvailable) {
+      return execErrors.send(res, execErrors.dockerUnavailable(), { requestId: req.requestId });
+    }
+
+    const errors = validationResult(req);
+    if (!errors.isEmpty()) {
+      return execErrors.send(res, execErrors.validationFailed(errors.array()), { requestId: req.requestId });
+    }
+
+    const { runtime, source, filename } = req.body;
+    const result = await formatService.format(runtime, source, { filename });
+
+    res.json({
+      success: true,
+      runtime,
+      ...result,
+      requestId: req.requestId
+    });
+  } catch (error) {
+    const classified = execErrors.classify(error);
+    if (classified.kind === 'infrastructure') {
+      logger.error('Formatting failed:', error);
+    }
+    execErrors.send(res, classified, { requestId: req.requestId, title: 'Formatting failed' });
+  }
+});
+
+module.exports = router;
\ No newline at end of file
@@ -2,57 +2,18 @@ const express = require('express');
 const { body, param, query, validationResult } = require('express-validator');
 
 const { authenticateFirebase } = require('../middleware/firebaseAuth');
-const { Workspace } = require('../models');
+const { authorizeWorkspace } = require('../middleware/workspaceAccess');
 const gitManager = require('../utils/gitManager');
 const githubAPI = require('../utils/githubApi');
 const logger = require('../utils/logger');
 
 const router = express.Router();
 
-// Middleware to check workspace access
-const checkWorkspaceAccess = async (req, res, next) => {
-  try {
-    const { workspaceId } = req.params;
-    const userId = req.user.id;
-
-    const workspace = await Workspace.findById(workspaceId);
-    if (!workspace) {
-      return res.status(404).json({ error: 'Workspace not found' });
-    }
-
-    // Check if user has access to workspace
-    const hasAccess = workspace.owner.toString() === userId ||
-      workspace.collaborators.some(collab => collab.userId.toString() === userId);
-
-    if (!hasAccess) {
-      return res.status(403).json({ error: 'Access denied to workspace' });
-    }
-
-    // Check permissions for write operations
-    const isWriteOperation = ['POST', 'PUT', 'DELETE'].includes(req.method);
-    if (isWriteOperation) {
-      const isOwner = workspace.owner.toString() === userId;
-      const collaborator = workspace.collaborators.find(collab => collab.userId.toString() === userId);
-      const hasWriteAccess = isOwner || (collaborator && collaborator.permissions.write);
-
-      if (!hasWriteAccess) {
-        return res.status(403).json({ error: 'Write access denied' });
-      }
-    }
-
-    req.workspace = workspace;
-    next();
-  } catch (error) {
-    logger.error('Error checking workspace access:', error);
-    res.status(500).json({ error: 'Internal server error' });
-  }
-};
-
 // GET /api/git/:workspaceId/status - Get Git repository status
 router.get('/:workspaceId/status',
   authenticateFirebase,
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -102,7 +63,7 @@ router.post('/:workspaceId/init',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   body('userName').optional().isString().trim(),
   body('userEmail').optional().isEmail(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -155,7 +116,7 @@ router.post('/:workspaceId/clone',
   body('repoUrl').isURL().withMessage('Valid repository URL is required'),
   body('branch').optional().isString().trim(),
   body('depth').optional().isInt({ min: 1 }),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -209,7 +170,7 @@ router.post('/:workspaceId/add',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   body('files').optional().isArray(),
   body('files.*').isString(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -250,7 +211,7 @@ router.post('/:workspaceId/unstage',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   body('files').optional().isArray(),
   body('files.*').isString(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -292,7 +253,7 @@ router.post('/:workspaceId/commit',
   body('message').isString().trim().isLength({ min: 1 }).withMessage('Commit message is required'),
   body('author').optional().isString(),
   body('amend').optional().isBoolean(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -346,7 +307,7 @@ router.get('/:workspaceId/history',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   query('limit').optional().isInt({ min: 1, max: 100 }),
   query('since').optional().isISO8601(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -388,7 +349,7 @@ router.get('/:workspaceId/history',
 router.get('/:workspaceId/branches',
   authenticateFirebase,
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -425,7 +386,7 @@ router.post('/:workspaceId/branches',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   body('name').isString().trim().isLength({ min: 1 }).withMessage('Branch name is required'),
   body('startPoint').optional().isString(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -466,7 +427,7 @@ router.post('/:workspaceId/branches/switch',
   authenticateFirebase,
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   body('name').isString().trim().isLength({ min: 1 }).withMessage('Branch name is required'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -507,7 +468,7 @@ router.delete('/:workspaceId/branches/:branchName',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   param('branchName').isString().trim().isLength({ min: 1 }).withMessage('Branch name is required'),
   query('force').optional().isBoolean(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -548,7 +509,7 @@ router.delete('/:workspaceId/branches/:branchName',
 router.get('/:workspaceId/remotes',
   authenticateFirebase,
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -585,7 +546,7 @@ router.post('/:workspaceId/remotes',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   body('name').isString().trim().isLength({ min: 1 }).withMessage('Remote name is required'),
   body('url').isURL().withMessage('Valid remote URL is required'),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -629,7 +590,7 @@ router.post('/:workspaceId/push',
   body('branch').optional().isString(),
   body('setUpstream').optional().isBoolean(),
   body('force').optional().isBoolean(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -678,7 +639,7 @@ router.post('/:workspaceId/pull',
   body('remote').optional().isString(),
   body('branch').optional().isString(),
   body('rebase').optional().isBoolean(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -725,7 +686,7 @@ router.post('/:workspaceId/fetch',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   body('remote').optional().isString(),
   body('all').optional().isBoolean(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
@@ -770,7 +731,7 @@ router.get('/:workspaceId/diff',
   param('workspaceId').isMongoId().withMessage('Invalid workspace ID'),
   query('staged').optional().isBoolean(),
   query('file').optional().isString(),
-  checkWorkspaceAccess,
+  authorizeWorkspace(),
   async (req, res) => {
     try {
       const errors = validationResult(req);
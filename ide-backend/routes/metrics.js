@@ -0,0 +1,34 @@
+const express = require('express');
+const crypto = require('crypto');
+const config = require('../config');
+const { catchAsync } = require('../middleware/errorHandler');
+const executionMetrics = require('../services/metrics');
+
+const router = express.Router();
+
+// Scrapers authenticate with a static bearer token when METRICS_TOKEN is set
+const authorizeScrape = (req, res, next) => {
+  const { token } = config.metrics;
+  if (!token) {
+    return next();
+  }
+
+  const provided = Buffer.from((req.get('Authorization') || '').replace(/^Bearer /, ''));
+  const expected = Buffer.from(token);
+  if (provided.length !== expected.length || !crypto.timingSafeEqual(provided, expected)) {
+    return res.status(401).json({ error: 'Unauthorized' });
+  }
+
+  next();
+};
+
+/**
+ * Prometheus scrape endpoint
+ * GET /metrics
+ */
+router.get('/', authorizeScrape, catchAsync(async (req, res) => {
+  res.set('Content-Type', executionMetrics.contentType);
+  res.end(await executionMetrics.metrics());
+}));
+
+module.exports = router;
\ No newline at end of file
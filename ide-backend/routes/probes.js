@@ -0,0 +1,21 @@
+const express = require('express');
+const { catchAsync } = require('../middleware/errorHandler');
+const readiness = require('../services/readiness');
+
+const router = express.Router();
+
+// Liveness: the process is up and serving requests, no dependencies checked
+// so a Docker outage doesn't get the backend restarted
+router.get('/healthz', (req, res) => {
+  res.json({ status: 'ok', uptime: process.uptime() });
+});
+
+// Readiness: Docker, runtime images and the execution queue. 503 takes the
+// instance out of rotation until the checks pass again.
+router.get('/readyz', catchAsync(async (req, res) => {
+  const result = await readiness.check();
+  res.set('Cache-Control', 'no-store');
+  res.status(result.status === 'ready' ? 200 : 503).json(result);
+}));
+
+module.exports = router;
\ No newline at end of file
@@ -0,0 +1,185 @@
+const express = require('express');
+const { body, param, validationResult } = require('express-validator');
+const dockerService = require('../services/dockerService');
+const replSessions = require('../services/replSessions');
+const resourceLimits = require('../services/resourceLimits');
+const runtimeRegistry = require('../services/runtimeRegistry');
+const webSocketService = require('../services/websocket');
+const logger = require('../utils/logger');
+const { authenticateFirebase } = require('../middleware/firebaseAuth');
+const { rateLimit } = require('../middleware/rateLimiter');
+
+const router = express.Router();
+
+// Apply authentication to all REPL routes
+router.use(authenticateFirebase);
+
+const ERROR_STATUS = {
+  REPL_NOT_SUPPORTED: 400,
+  REPL_BUSY: 409,
+  REPL_LIMIT: 429,
+  REPL_START_FAILED: 502
+};
+
+const sendValidationErrors = (req, res) => {
+  const errors = validationResult(req);
+  if (!errors.isEmpty()) {
+    res.status(400).json({
+      error: 'Validation failed',
+      details: errors.array()
+    });
+    return true;
+  }
+  return false;
+};
+
+const sessionIdParam = param('sessionId')
+  .matches(/^repl_[0-9a-f]{24}$/)
+  .withMessage('Invalid REPL session ID');
+
+/**
+ * Start a REPL session
+ * POST /api/repl
+ */
+router.post('/', rateLimit('execute'), [
+  body('language')
+    .custom(value => runtimeRegistry.has(value))
+    .withMessage('Unsupported language')
+], async (req, res) => {
+  try {
+    if (!dockerService.isAvailable) {
+      return res.status(503).json({
+        error: 'Service unavailable',
+        message: 'Code execution is not available: Docker is not running'
+      });
+    }
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    const userId = req.user.id;
+    const session = await replSessions.createSession(userId, {
+      language: req.body.language,
+      limits: resourceLimits.resolveForUser(req.user)
+    }, {
+      onExit: ({ sessionId, reason }) => webSocketService.sendToUser(userId, 'repl:exit', { sessionId, reason })
+    });
+
+    res.status(201).json({
+      success: true,
+      session
+    });
+  } catch (error) {
+    const status = ERROR_STATUS[error.code] || 500;
+    if (status === 500) {
+      logger.error('REPL session creation failed:', error);
+    }
+    res.status(status).json({
+      error: status === 500 ? 'REPL session creation failed' : error.code,
+      message: error.message
+    });
+  }
+});
+
+/**
+ * List the user's REPL sessions
+ * GET /api/repl
+ */
+router.get('/', (req, res) => {
+  res.json({
+    success: true,
+    sessions: replSessions.getUserSessions(req.user.id)
+  });
+});
+
+/**
+ * Evaluate a snippet. `stream: true` also pushes output to the user's
+ * sockets as repl:output events while it runs.
+ * POST /api/repl/:sessionId/eval
+ */
+router.post('/:sessionId/eval', rateLimit('read'), [
+  sessionIdParam,
+  body('code')
+    .isString()
+    .isLength({ min: 1, max: 1024 * 1024 })
+    .withMessage('code must be a string of at most 1MB'),
+  body('timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('timeout_ms must be a positive integer'),
+  body('stream')
+    .optional()
+    .isBoolean()
+    .withMessage('stream must be a boolean')
+], async (req, res) => {
+  try {
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    const userId = req.user.id;
+    const { sessionId } = req.params;
+    const stream = req.body.stream === true || req.body.stream === 'true';
+
+    const result = await replSessions.evaluate(sessionId, userId, req.body.code, {
+      timeoutMs: req.body.timeout_ms !== undefined ? parseInt(req.body.timeout_ms, 10) : undefined,
+      onOutput: stream ? (data) => webSocketService.sendToUser(userId, 'repl:output', { sessionId, data }) : null
+    });
+
+    if (!result) {
+      return res.status(404).json({
+        error: 'Session not found',
+        message: 'REPL session not found or already closed'
+      });
+    }
+
+    res.json({
+      success: true,
+      sessionId,
+      ...result
+    });
+  } catch (error) {
+    const status = ERROR_STATUS[error.code] || 500;
+    if (status === 500) {
+      logger.error('REPL evaluation failed:', error);
+    }
+    res.status(status).json({
+      error: status === 500 ? 'REPL evaluation failed' : error.code,
+      message: error.message
+    });
+  }
+});
+
+/**
+ * Close a REPL session and remove its container
+ * DELETE /api/repl/:sessionId
+ */
+router.delete('/:sessionId', [sessionIdParam], async (req, res) => {
+  try {
+    if (sendValidationErrors(req, res)) {
+      return;
+    }
+
+    const { sessionId } = req.params;
+    if (!replSessions.getUserSession(sessionId, req.user.id)) {
+      return res.status(404).json({
+        error: 'Session not found',
+        message: 'REPL session not found or already closed'
+      });
+    }
+
+    await replSessions.destroySession(sessionId, 'closed');
+    res.json({
+      success: true,
+      sessionId
+    });
+  } catch (error) {
+    logger.error('Failed to close REPL session:', error);
+    res.status(500).json({
+      error: 'Failed to close REPL session',
+      message: error.message
+    });
+  }
+});
+
+module.exports = router;
\ No newline at end of file
@@ -0,0 +1,58 @@
+const express = require('express');
+const runtimeRegistry = require('../services/runtimeRegistry');
+const sandboxes = require('../services/sandboxes');
+const logger = require('../utils/logger');
+const { authenticateFirebase } = require('../middleware/firebaseAuth');
+
+const router = express.Router();
+
+// Runtime listing plus the sandbox actually in effect: `fallback` is set when
+// the runtime asked for a provider (e.g. gvisor) this host doesn't support
+const listRuntimes = () => runtimeRegistry.list().map(runtime => ({
+  ...runtime,
+  sandbox: sandboxes.describe(runtime.name)
+}));
+
+// Apply authentication to all runtime routes
+router.use(authenticateFirebase);
+
+/**
+ * List available runtimes for the language picker
+ * GET /api/runtimes
+ */
+router.get('/', (req, res) => {
+  try {
+    res.json({
+      success: true,
+      runtimes: listRuntimes(),
+      sandboxes: sandboxes.getCapabilities()
+    });
+  } catch (error) {
+    logger.error('Failed to list runtimes:', error);
+    res.status(500).json({
+      error: 'Failed to list runtimes',
+      message: error.message
+    });
+  }
+});
+
+/**
+ * Get a single runtime
+ * GET /api/runtimes/:name
+ */
+router.get('/:name', (req, res) => {
+  const runtime = listRuntimes().find(entry => entry.name === req.params.name);
+
+  if (!runtime) {
+    return res.status(404).json({
+      error: 'Runtime not found'
+    });
+  }
+
+  res.json({
+    success: true,
+    runtime
+  });
+});
+
+module.exports = router;
\ No newline at end of file
@@ -0,0 +1,30 @@
+const express = require('express');
+const templateCatalog = require('../services/templateCatalog');
+const logger = require('../utils/logger');
+const { authenticateFirebase } = require('../middleware/firebaseAuth');
+
+const router = express.Router();
+
+// Apply authentication to all template routes
+router.use(authenticateFirebase);
+
+/**
+ * List starter project templates for the new workspace dialog
+ * GET /api/templates
+ */
+router.get('/', (req, res) => {
+  try {
+    res.json({
+      success: true,
+      templates: templateCatalog.list()
+    });
+  } catch (error) {
+    logger.error('Failed to list templates:', error);
+    res.status(500).json({
+      error: 'Failed to list templates',
+      message: error.message
+    });
+  }
+});
+
+module.exports = router;
\ No newline at end of file
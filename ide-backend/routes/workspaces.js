@@ -4,15 +4,32 @@ const { body, param, query, validationResult } = require('express-validator');
 const Workspace = require('../models/Workspace');
 const User = require('../models/User');
 const { authenticateFirebase } = require('../middleware/firebaseAuth');
+const { rateLimit } = require('../middleware/rateLimiter');
+const { authorizeWorkspace } = require('../middleware/workspaceAccess');
+const config = require('../config');
 const logger = require('../utils/logger');
 const fileSystem = require('../utils/fileSystem');
+const fileValidation = require('../utils/fileValidation');
+const fileTransfer = require('../utils/fileTransfer');
+const { detectContentType, isBinaryContentType } = require('../utils/contentType');
+const workspaceArchive = require('../utils/workspaceArchive');
+const dockerService = require('../services/dockerService');
+const executionQueue = require('../services/executionQueue');
+const testRunner = require('../services/testRunner');
+const workspaceWatcher = require('../services/workspaceWatcher');
+const workspaceSecrets = require('../services/workspaceSecrets');
+const workspaceQuota = require('../services/workspaceQuota');
+const workspaceHibernation = require('../services/workspaceHibernation');
+const templateCatalog = require('../services/templateCatalog');
 
 const router = express.Router();
 
+// Accepted upload types for archive restores
+const ARCHIVE_TYPES = new Set(['application/gzip', 'application/x-gzip', 'application/x-tar']);
+
 // Validation middleware
 const validateRequest = (req, res, next) => {
   console.log('validateRequest middleware called');
-  console.log('Request body:', req.body);
   console.log('Request params:', req.params);
   console.log('Request query:', req.query);
   
@@ -52,9 +69,19 @@ const createWorkspaceValidation = [
   body('settings.runtime')
     .optional()
     .isIn(['node', 'python', 'java', 'cpp', 'go', 'rust', 'php', 'ruby'])
-    .withMessage('Invalid runtime specified')
+    .withMessage('Invalid runtime specified'),
+  query('template')
+    .optional()
+    .matches(/^[a-z][a-z0-9-]{0,63}$/)
+    .withMessage('Invalid template ID'),
+  body('templateVariables')
+    .optional()
+    .isObject()
+    .withMessage('templateVariables must be an object')
 ];
 
+const TEMPLATE_ERROR_STATUS = { TEMPLATE_NOT_FOUND: 404, INVALID_TEMPLATE_VARIABLE: 400, QUOTA_EXCEEDED: 413 };
+
 const updateWorkspaceValidation = [
   param('workspaceId')
     .isMongoId()
@@ -77,6 +104,43 @@ const updateWorkspaceValidation = [
     .withMessage('isPublic must be a boolean')
 ];
 
+// Roles that can be granted through /members and share links
+const MEMBER_ROLES = ['editor', 'viewer'];
+
+const memberValidation = [
+  param('workspaceId')
+    .isMongoId()
+    .withMessage('Invalid workspace ID'),
+  body('email')
+    .optional()
+    .isEmail()
+    .withMessage('Valid email is required'),
+  body('userId')
+    .optional()
+    .isMongoId()
+    .withMessage('Invalid user ID'),
+  body()
+    .custom(value => Boolean(value && (value.email || value.userId)))
+    .withMessage('email or userId is required'),
+  body('role')
+    .isIn(MEMBER_ROLES)
+    .withMessage('Role must be editor or viewer')
+];
+
+const inviteValidation = [
+  param('workspaceId')
+    .isMongoId()
+    .withMessage('Invalid workspace ID'),
+  body('role')
+    .optional()
+    .isIn(MEMBER_ROLES)
+    .withMessage('Role must be editor or viewer'),
+  body('expiresInHours')
+    .optional()
+    .isInt({ min: 1, max: config.workspaceInvites.maxTtlHours })
+    .withMessage(`expiresInHours must be between 1 and ${config.workspaceInvites.maxTtlHours}`)
+];
+
 const collaboratorValidation = [
   param('workspaceId')
     .isMongoId()
@@ -89,70 +153,6 @@ const collaboratorValidation = [
     .withMessage('Role must be owner, editor, or viewer')
 ];
 
-// Middleware to check workspace access
-const checkWorkspaceAccess = (requiredPermission = 'read') => {
-  return async (req, res, next) => {
-    try {
-      const { workspaceId } = req.params;
-      const userId = req.user.id;
-
-      // Validate ObjectId format
-      if (!mongoose.Types.ObjectId.isValid(workspaceId)) {
-        return res.status(400).json({
-          success: false,
-          message: 'Invalid workspace ID format'
-        });
-      }
-
-      const workspace = await Workspace.findById(workspaceId);
-      if (!workspace) {
-        return res.status(404).json({
-          success: false,
-          message: 'Workspace not found'
-        });
-      }
-
-      // Check if user is owner
-      if (workspace.owner.toString() === userId) {
-        req.workspace = workspace;
-        req.userRole = 'owner';
-        return next();
-      }
-
-      // Check if user is collaborator
-      const collaborator = workspace.collaborators.find(
-        collab => collab.userId.toString() === userId
-      );
-
-      if (!collaborator) {
-        return res.status(403).json({
-          success: false,
-          message: 'Access denied to this workspace'
-        });
-      }
-
-      // Check permissions
-      const hasPermission = collaborator.permissions[requiredPermission];
-      if (!hasPermission) {
-        return res.status(403).json({
-          success: false,
-          message: `Insufficient permissions: ${requiredPermission} access required`
-        });
-      }
-
-      req.workspace = workspace;
-      req.userRole = collaborator.role;
-      next();
-    } catch (error) {
-      logger.error('Error checking workspace access:', error);
-      res.status(500).json({
-        success: false,
-        message: 'Internal server error'
-      });
-    }
-  };
-};
-
 // GET /api/workspaces - List user workspaces
 router.get('/', authenticateFirebase, async (req, res) => {
   try {
@@ -244,7 +244,7 @@ router.post('/', authenticateFirebase, createWorkspaceValidation, validateReques
   
   try {
     const userId = req.user.id;
-    const { name, description, isPublic = false, settings = {} } = req.body;
+    const { name, description, isPublic = false, settings = {}, templateVariables = {} } = req.body;
 
     console.log('Extracted data:', { userId, name, description, isPublic, settings });
 
@@ -265,6 +265,11 @@ router.post('/', authenticateFirebase, createWorkspaceValidation, validateReques
       });
     }
 
+    // Render the starter template first so bad variables fail before anything is created
+    const rendered = req.query.template
+      ? templateCatalog.render(req.query.template, name.trim(), templateVariables)
+      : null;
+
     // Create workspace
     console.log('Creating new workspace...');
     const workspace = new Workspace({
@@ -272,8 +277,9 @@ router.post('/', authenticateFirebase, createWorkspaceValidation, validateReques
       description: description?.trim() || '',
       owner: userId,
       isPublic,
+      createdFromTemplate: rendered ? rendered.template.id : null,
       settings: {
-        runtime: settings.runtime || 'node',
+        runtime: rendered ? rendered.template.runtime : settings.runtime || 'node',
         version: settings.version || 'latest',
         dependencies: settings.dependencies || [],
         environment: new Map(Object.entries(settings.environment || {})),
@@ -284,8 +290,19 @@ router.post('/', authenticateFirebase, createWorkspaceValidation, validateReques
 
     await workspace.save();
 
-    // Initialize workspace file system
-    await fileSystem.initializeWorkspace(workspace._id.toString());
+    // Initialize workspace file system with the template or the default files
+    if (rendered) {
+      try {
+        await templateCatalog.instantiate(workspace._id.toString(), rendered);
+      } catch (error) {
+        await fileSystem.deleteWorkspace(workspace._id.toString()).catch(() => {});
+        await Workspace.findByIdAndDelete(workspace._id);
+        workspaceQuota.forget(workspace._id);
+        throw error;
+      }
+    } else {
+      await fileSystem.initializeWorkspace(workspace._id.toString());
+    }
 
     // Populate owner information
     await workspace.populate('owner', 'name email avatar');
@@ -303,6 +320,16 @@ router.post('/', authenticateFirebase, createWorkspaceValidation, validateReques
       }
     });
   } catch (error) {
+    if (TEMPLATE_ERROR_STATUS[error.code]) {
+      return res.status(TEMPLATE_ERROR_STATUS[error.code]).json({
+        success: false,
+        message: error.message,
+        code: error.code,
+        ...(error.param && { param: error.param }),
+        ...(error.usage && { usage: error.usage })
+      });
+    }
+
     logger.error('Error creating workspace:', error);
     res.status(500).json({
       success: false,
@@ -312,7 +339,7 @@ router.post('/', authenticateFirebase, createWorkspaceValidation, validateReques
 });
 
 // GET /api/workspaces/:workspaceId - Get workspace details
-router.get('/:workspaceId', authenticateFirebase, checkWorkspaceAccess('read'), async (req, res) => {
+router.get('/:workspaceId', authenticateFirebase, authorizeWorkspace('read'), async (req, res) => {
   try {
     const workspace = req.workspace;
     const userRole = req.userRole;
@@ -327,7 +354,9 @@ router.get('/:workspaceId', authenticateFirebase, checkWorkspaceAccess('read'),
         workspace: {
           ...workspace.toObject(),
           userRole
-        }
+        },
+        // active, hibernating, hibernated or resuming (see workspace:state)
+        state: workspaceHibernation.getState(workspace._id)
       }
     });
   } catch (error) {
@@ -340,7 +369,7 @@ router.get('/:workspaceId', authenticateFirebase, checkWorkspaceAccess('read'),
 });
 
 // PUT /api/workspaces/:workspaceId - Update workspace
-router.put('/:workspaceId', authenticateFirebase, updateWorkspaceValidation, validateRequest, checkWorkspaceAccess('admin'), async (req, res) => {
+router.put('/:workspaceId', authenticateFirebase, updateWorkspaceValidation, validateRequest, authorizeWorkspace('admin'), async (req, res) => {
   try {
     const workspace = req.workspace;
     const { name, description, isPublic, settings } = req.body;
@@ -412,7 +441,7 @@ router.put('/:workspaceId', authenticateFirebase, updateWorkspaceValidation, val
 });
 
 // DELETE /api/workspaces/:workspaceId - Delete workspace
-router.delete('/:workspaceId', authenticateFirebase, checkWorkspaceAccess('admin'), async (req, res) => {
+router.delete('/:workspaceId', authenticateFirebase, authorizeWorkspace('admin'), async (req, res) => {
   try {
     const workspace = req.workspace;
     const { permanent = false } = req.query;
@@ -421,6 +450,7 @@ router.delete('/:workspaceId', authenticateFirebase, checkWorkspaceAccess('admin
       // Permanently delete workspace
       await fileSystem.deleteWorkspace(workspace._id.toString());
       await Workspace.findByIdAndDelete(workspace._id);
+      workspaceQuota.forget(workspace._id);
       
       logger.info(`Workspace permanently deleted: ${workspace.name} by user ${req.user.id}`);
       
@@ -450,7 +480,7 @@ router.delete('/:workspaceId', authenticateFirebase, checkWorkspaceAccess('admin
 });
 
 // POST /api/workspaces/:workspaceId/collaborators - Add collaborator
-router.post('/:workspaceId/collaborators', authenticateFirebase, collaboratorValidation, validateRequest, checkWorkspaceAccess('admin'), async (req, res) => {
+router.post('/:workspaceId/collaborators', authenticateFirebase, collaboratorValidation, validateRequest, authorizeWorkspace('admin'), async (req, res) => {
   try {
     const workspace = req.workspace;
     const { email, role = 'viewer' } = req.body;
@@ -511,7 +541,7 @@ router.post('/:workspaceId/collaborators', authenticateFirebase, collaboratorVal
 });
 
 // PUT /api/workspaces/:workspaceId/collaborators/:userId - Update collaborator role
-router.put('/:workspaceId/collaborators/:userId', authenticateFirebase, checkWorkspaceAccess('admin'), async (req, res) => {
+router.put('/:workspaceId/collaborators/:userId', authenticateFirebase, authorizeWorkspace('admin'), async (req, res) => {
   try {
     const workspace = req.workspace;
     const { userId } = req.params;
@@ -569,7 +599,7 @@ router.put('/:workspaceId/collaborators/:userId', authenticateFirebase, checkWor
 });
 
 // DELETE /api/workspaces/:workspaceId/collaborators/:userId - Remove collaborator
-router.delete('/:workspaceId/collaborators/:userId', authenticateFirebase, checkWorkspaceAccess('admin'), async (req, res) => {
+router.delete('/:workspaceId/collaborators/:userId', authenticateFirebase, authorizeWorkspace('admin'), async (req, res) => {
   try {
     const workspace = req.workspace;
     const { userId } = req.params;
@@ -611,8 +641,278 @@ router.delete('/:workspaceId/collaborators/:userId', authenticateFirebase, check
   }
 });
 
+// Shape a member for API responses (collaborators.userId populated)
+const formatMember = (user, role, joinedAt = null) => ({
+  userId: user._id,
+  name: user.name,
+  email: user.email,
+  avatar: user.avatar,
+  role,
+  joinedAt
+});
+
+const formatInvite = (invite) => ({
+  id: invite._id,
+  role: invite.role,
+  expiresAt: invite.expiresAt,
+  uses: invite.uses,
+  createdBy: invite.createdBy,
+  createdAt: invite.createdAt
+});
+
+// POST /api/workspaces/invites/:token/accept - Join a workspace through a share link
+router.post('/invites/:token/accept', authenticateFirebase, rateLimit('read'), [
+  param('token')
+    .isLength({ min: 16, max: 128 })
+    .withMessage('Invalid invite token')
+], validateRequest, async (req, res) => {
+  try {
+    const { token } = req.params;
+    const workspace = await Workspace.findByInviteToken(token);
+    if (!workspace) {
+      return res.status(404).json({
+        success: false,
+        message: 'Invite not found or revoked'
+      });
+    }
+
+    const role = await workspace.acceptInvite(token, req.user.id);
+
+    logger.info(`User ${req.user.id} joined workspace ${workspace.name} through an invite as ${role}`);
+
+    res.json({
+      success: true,
+      message: 'Invite accepted',
+      data: {
+        workspaceId: workspace._id,
+        role
+      }
+    });
+  } catch (error) {
+    if (error.message === 'Invite has expired') {
+      return res.status(410).json({
+        success: false,
+        message: 'Invite has expired'
+      });
+    }
+    if (error.message === 'Invite not found') {
+      return res.status(404).json({
+        success: false,
+        message: 'Invite not found or revoked'
+      });
+    }
+
+    logger.error('Error accepting workspace invite:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to accept invite'
+    });
+  }
+});
+
+// GET /api/workspaces/:workspaceId/members - List members (and share links for admins)
+router.get('/:workspaceId/members', authenticateFirebase, authorizeWorkspace('read'), async (req, res) => {
+  try {
+    const workspace = req.workspace;
+
+    await workspace.populate('owner', 'name email avatar');
+    await workspace.populate('collaborators.userId', 'name email avatar');
+
+    const members = [
+      formatMember(workspace.owner, 'owner', workspace.createdAt),
+      ...workspace.collaborators
+        .filter(collab => collab.userId)
+        .map(collab => formatMember(collab.userId, collab.role, collab.joinedAt))
+    ];
+
+    const data = { members, userRole: req.userRole };
+    if (Workspace.permissionsForRole(req.userRole).admin) {
+      data.invites = workspace.invites
+        .filter(invite => invite.expiresAt > new Date())
+        .map(formatInvite);
+    }
+
+    res.json({
+      success: true,
+      data
+    });
+  } catch (error) {
+    logger.error('Error listing workspace members:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to list members'
+    });
+  }
+});
+
+// POST /api/workspaces/:workspaceId/members - Grant a user a role (or change it)
+router.post('/:workspaceId/members', authenticateFirebase, memberValidation, validateRequest, authorizeWorkspace('admin'), async (req, res) => {
+  try {
+    const workspace = req.workspace;
+    const { email, userId, role } = req.body;
+
+    const user = userId
+      ? await User.findById(userId)
+      : await User.findOne({ email: email.toLowerCase() });
+    if (!user) {
+      return res.status(404).json({
+        success: false,
+        message: 'User not found'
+      });
+    }
+
+    const memberId = user._id.toString();
+    if (workspace.owner.toString() === memberId) {
+      return res.status(400).json({
+        success: false,
+        message: 'User is already the owner of this workspace'
+      });
+    }
+
+    const currentRole = workspace.getRole(memberId);
+    if (currentRole) {
+      await workspace.updateCollaboratorRole(memberId, role);
+    } else {
+      await workspace.addCollaborator(user._id, role, req.user.id);
+    }
+
+    const collaborator = workspace.collaborators.find(collab => collab.userId.toString() === memberId);
+
+    logger.info(`Workspace ${workspace.name}: ${memberId} granted ${role} by user ${req.user.id}`);
+
+    res.status(currentRole ? 200 : 201).json({
+      success: true,
+      message: currentRole ? 'Member role updated' : 'Member added',
+      data: {
+        member: formatMember(user, role, collaborator.joinedAt)
+      }
+    });
+  } catch (error) {
+    logger.error('Error adding workspace member:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to add member'
+    });
+  }
+});
+
+// DELETE /api/workspaces/:workspaceId/members/:userId - Revoke a member (members may remove themselves)
+router.delete('/:workspaceId/members/:userId', authenticateFirebase, [
+  param('userId')
+    .isMongoId()
+    .withMessage('Invalid user ID')
+], validateRequest, authorizeWorkspace('read'), async (req, res) => {
+  try {
+    const workspace = req.workspace;
+    const { userId } = req.params;
+
+    if (userId !== req.user.id && !Workspace.permissionsForRole(req.userRole).admin) {
+      return res.status(403).json({
+        success: false,
+        message: 'Insufficient permissions: admin access required'
+      });
+    }
+
+    if (workspace.owner.toString() === userId) {
+      return res.status(400).json({
+        success: false,
+        message: 'Cannot remove workspace owner'
+      });
+    }
+    if (!workspace.getRole(userId)) {
+      return res.status(404).json({
+        success: false,
+        message: 'Member not found'
+      });
+    }
+
+    await workspace.removeCollaborator(userId);
+
+    logger.info(`Workspace ${workspace.name}: member ${userId} removed by user ${req.user.id}`);
+
+    res.json({
+      success: true,
+      message: 'Member removed'
+    });
+  } catch (error) {
+    logger.error('Error removing workspace member:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to remove member'
+    });
+  }
+});
+
+// POST /api/workspaces/:workspaceId/invites - Create a share link
+router.post('/:workspaceId/invites', authenticateFirebase, inviteValidation, validateRequest, authorizeWorkspace('admin'), async (req, res) => {
+  try {
+    const workspace = req.workspace;
+    const { role = 'viewer' } = req.body;
+    const { defaultTtlHours, maxPerWorkspace } = config.workspaceInvites;
+    const hours = req.body.expiresInHours !== undefined ? parseInt(req.body.expiresInHours, 10) : defaultTtlHours;
+
+    const active = workspace.invites.filter(invite => invite.expiresAt > new Date()).length;
+    if (active >= maxPerWorkspace) {
+      return res.status(429).json({
+        success: false,
+        message: `Too many active invites (max ${maxPerWorkspace}); revoke one first`
+      });
+    }
+
+    const { token, invite } = await workspace.createInvite(role, req.user.id, hours * 60 * 60 * 1000);
+
+    logger.info(`Invite created for workspace ${workspace.name} as ${role} by user ${req.user.id}`);
+
+    res.status(201).json({
+      success: true,
+      message: 'Invite created',
+      data: {
+        invite: formatInvite(invite),
+        // Only returned here; the server keeps a hash
+        token,
+        acceptPath: `/api/workspaces/invites/${token}/accept`
+      }
+    });
+  } catch (error) {
+    logger.error('Error creating workspace invite:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to create invite'
+    });
+  }
+});
+
+// DELETE /api/workspaces/:workspaceId/invites/:inviteId - Revoke a share link
+router.delete('/:workspaceId/invites/:inviteId', authenticateFirebase, [
+  param('inviteId')
+    .isMongoId()
+    .withMessage('Invalid invite ID')
+], validateRequest, authorizeWorkspace('admin'), async (req, res) => {
+  try {
+    await req.workspace.revokeInvite(req.params.inviteId);
+
+    res.json({
+      success: true,
+      message: 'Invite revoked'
+    });
+  } catch (error) {
+    if (error.message === 'Invite not found') {
+      return res.status(404).json({
+        success: false,
+        message: 'Invite not found'
+      });
+    }
+
+    logger.error('Error revoking workspace invite:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to revoke invite'
+    });
+  }
+});
+
 // POST /api/workspaces/:workspaceId/duplicate - Duplicate workspace
-router.post('/:workspaceId/duplicate', authenticateFirebase, checkWorkspaceAccess('read'), async (req, res) => {
+router.post('/:workspaceId/duplicate', authenticateFirebase, authorizeWorkspace('read'), async (req, res) => {
   try {
     const originalWorkspace = req.workspace;
     const { name } = req.body;
@@ -741,7 +1041,7 @@ router.post('/:workspaceId/restore', authenticateFirebase, async (req, res) => {
 });
 
 // GET /api/workspaces/public - List public workspaces
-router.get('/public/list', async (req, res) => {
+router.get('/public/list', rateLimit('read'), async (req, res) => {
   try {
     const { page = 1, limit = 20, search } = req.query;
     const skip = (parseInt(page) - 1) * parseInt(limit);
@@ -866,4 +1166,595 @@ router.get('/stats/overview', authenticateFirebase, async (req, res) => {
   }
 });
 
-module.exports = router;
+// Resolve and validate the wildcard file path of /:workspaceId/files/* routes
+const resolveFilePath = (req, res, next) => {
+  const filePath = req.params[0];
+
+  if (!filePath) {
+    return res.status(400).json({
+      success: false,
+      message: 'File path is required'
+    });
+  }
+
+  const validation = fileValidation.validateFilePath(filePath);
+  if (!validation.isValid) {
+    return res.status(400).json({
+      success: false,
+      message: validation.errors.join(', ')
+    });
+  }
+
+  req.filePath = filePath;
+  next();
+};
+
+// Compare an If-Match header against the current ETag (null when the file doesn't exist)
+const ifMatchFails = (req, currentETag) => {
+  const ifMatch = req.get('If-Match');
+  if (!ifMatch) {
+    return false;
+  }
+
+  if (ifMatch.trim() === '*') {
+    return currentETag === null;
+  }
+
+  return !ifMatch.split(',').map(tag => tag.trim()).includes(currentETag);
+};
+
+const readCurrentETag = async (workspaceId, filePath) => {
+  if (!(await fileSystem.exists(workspaceId, filePath))) {
+    return null;
+  }
+
+  const stats = await fileSystem.getItemStats(workspaceId, filePath);
+  if (stats.type !== 'file') {
+    return null;
+  }
+
+  return fileSystem.computeFileETag(workspaceId, filePath);
+};
+
+const jsonTooLarge = (res) => res.status(413).json({
+  success: false,
+  message: `Files over ${config.fileTransfer.jsonMaxBytes} bytes are only transferred as raw bytes, without encoding`,
+  code: 'FILE_TOO_LARGE'
+});
+
+// GET /api/workspaces/:workspaceId/files/* - Read a file as its raw bytes
+// (Range requests supported), or as JSON with ?encoding=base64
+router.get('/:workspaceId/files/*', authenticateFirebase, rateLimit('read'), [
+  query('encoding')
+    .optional()
+    .isIn(['base64'])
+    .withMessage('encoding must be base64')
+], validateRequest, authorizeWorkspace('read'), resolveFilePath, async (req, res) => {
+  try {
+    const workspaceId = req.workspace._id.toString();
+    const { filePath } = req;
+
+    if (!(await fileSystem.exists(workspaceId, filePath))) {
+      return res.status(404).json({
+        success: false,
+        message: 'File not found'
+      });
+    }
+
+    const stats = await fileSystem.getItemStats(workspaceId, filePath);
+
+    if (stats.type === 'directory') {
+      const files = await fileSystem.listDirectory(workspaceId, filePath);
+      return res.json({
+        success: true,
+        data: { type: 'directory', path: filePath, files }
+      });
+    }
+
+    // Hashed in a pass of its own so the file is never held in memory
+    const etag = await fileSystem.computeFileETag(workspaceId, filePath);
+
+    res.set('ETag', etag);
+    if (req.get('If-None-Match') === etag) {
+      return res.status(304).end();
+    }
+
+    if (req.query.encoding !== 'base64') {
+      return fileTransfer.sendFile(req, res, workspaceId, filePath, stats, { etag });
+    }
+
+    if (stats.size > config.fileTransfer.jsonMaxBytes) {
+      return jsonTooLarge(res);
+    }
+
+    const content = await fileSystem.readFile(workspaceId, filePath, null);
+    const mimeType = detectContentType(content);
+
+    res.json({
+      success: true,
+      data: {
+        type: 'file',
+        path: filePath,
+        content: content.toString('base64'),
+        encoding: 'base64',
+        mimeType,
+        isBinary: isBinaryContentType(mimeType),
+        language: fileValidation.detectLanguage(filePath),
+        size: stats.size,
+        lastModified: stats.modified,
+        etag
+      }
+    });
+  } catch (error) {
+    if (res.headersSent) {
+      return res.destroy(error);
+    }
+    logger.error('Error reading workspace file:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to read file'
+    });
+  }
+});
+
+// PUT /api/workspaces/:workspaceId/files/* - Create or update a file from
+// its raw bytes (streamed, any Content-Type but JSON and forms), or JSON
+// { content } with text or { content, encoding: 'base64' } for small files
+router.put('/:workspaceId/files/*', authenticateFirebase, [
+  body('content')
+    .if((value, { req }) => !fileTransfer.isRawBody(req))
+    .isString()
+    .withMessage('Content must be a string'),
+  body('encoding')
+    .optional()
+    .isIn(['utf8', 'base64'])
+    .withMessage('encoding must be utf8 or base64')
+], validateRequest, authorizeWorkspace('write'), resolveFilePath, async (req, res) => {
+  try {
+    const workspaceId = req.workspace._id.toString();
+    const { filePath } = req;
+    const raw = fileTransfer.isRawBody(req);
+
+    let content = null;
+    if (!raw && req.body.encoding === 'base64') {
+      content = Buffer.from(req.body.content, 'base64');
+      if (content.length > config.fileTransfer.jsonMaxBytes) {
+        return jsonTooLarge(res);
+      }
+    } else if (!raw) {
+      content = req.body.content;
+      const contentValidation = fileValidation.validateFileContent(content, filePath);
+      if (!contentValidation.isValid) {
+        return res.status(400).json({
+          success: false,
+          message: contentValidation.errors.join(', ')
+        });
+      }
+    }
+
+    // Optimistic concurrency: reject writes based on a stale version
+    const currentETag = await readCurrentETag(workspaceId, filePath);
+    if (ifMatchFails(req, currentETag) || (req.get('If-None-Match') === '*' && currentETag !== null)) {
+      if (currentETag) {
+        res.set('ETag', currentETag);
+      }
+      return res.status(412).json({
+        success: false,
+        message: 'File has been modified by someone else'
+      });
+    }
+
+    let size;
+    let etag;
+    let usage = null;
+    if (raw) {
+      // A declared length is checked before anything is read; chunked
+      // uploads once they're complete, before replacing the file
+      const declared = parseInt(req.get('Content-Length'), 10);
+      if (Number.isFinite(declared)) {
+        if (declared > fileSystem.maxFileSize) {
+          return res.status(413).json({
+            success: false,
+            message: `File size exceeds maximum allowed size (${fileSystem.maxFileSize} bytes)`,
+            code: 'FILE_TOO_LARGE'
+          });
+        }
+        usage = await workspaceQuota.checkWrite(workspaceId, filePath, declared);
+      }
+
+      ({ size, etag } = await fileSystem.writeFileStream(workspaceId, filePath, req, {
+        beforeCommit: async (written) => {
+          if (!usage) {
+            usage = await workspaceQuota.checkWrite(workspaceId, filePath, written.size);
+          }
+        }
+      }));
+    } else {
+      size = Buffer.byteLength(content, 'utf8');
+      usage = await workspaceQuota.checkWrite(workspaceId, filePath, size);
+      await fileSystem.writeFile(workspaceId, filePath, content);
+      etag = fileSystem.computeETag(content);
+    }
+
+    res.set('ETag', etag);
+
+    res.status(currentETag ? 200 : 201).json({
+      success: true,
+      message: currentETag ? 'File updated successfully' : 'File created successfully',
+      data: {
+        path: filePath,
+        size,
+        etag,
+        usage
+      }
+    });
+  } catch (error) {
+    if (error.code === 'QUOTA_EXCEEDED') {
+      return res.status(413).json({
+        success: false,
+        message: error.message,
+        code: error.code,
+        usage: error.usage
+      });
+    }
+
+    if (error.code === 'FILE_TOO_LARGE') {
+      return res.status(413).json({
+        success: false,
+        message: error.message,
+        code: error.code
+      });
+    }
+
+    if (error.code === 'SYMLINK_NOT_ALLOWED') {
+      return res.status(400).json({
+        success: false,
+        message: error.message,
+        code: error.code
+      });
+    }
+
+    if (error.code === 'ERR_STREAM_PREMATURE_CLOSE' || error.code === 'ECONNRESET') {
+      logger.warn(`Upload of ${req.filePath} aborted by the client`);
+      return res.status(400).json({
+        success: false,
+        message: 'Upload did not complete'
+      });
+    }
+
+    logger.error('Error writing workspace file:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to save file'
+    });
+  }
+});
+
+// GET /api/workspaces/:workspaceId/usage - Disk usage against the workspace quota
+router.get('/:workspaceId/usage', authenticateFirebase, [
+  query('fresh')
+    .optional()
+    .isBoolean()
+    .withMessage('fresh must be a boolean')
+], validateRequest, authorizeWorkspace('read'), async (req, res) => {
+  try {
+    const usage = await workspaceQuota.getUsage(req.workspace._id.toString(), {
+      fresh: req.query.fresh === 'true'
+    });
+
+    res.json({
+      success: true,
+      data: usage
+    });
+  } catch (error) {
+    logger.error('Error measuring workspace usage:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to measure workspace usage'
+    });
+  }
+});
+
+// DELETE /api/workspaces/:workspaceId/files/* - Delete a file
+router.delete('/:workspaceId/files/*', authenticateFirebase, authorizeWorkspace('write'), resolveFilePath, async (req, res) => {
+  try {
+    const workspaceId = req.workspace._id.toString();
+    const { filePath } = req;
+
+    const currentETag = await readCurrentETag(workspaceId, filePath);
+    if (currentETag === null) {
+      return res.status(404).json({
+        success: false,
+        message: 'File not found'
+      });
+    }
+
+    if (ifMatchFails(req, currentETag)) {
+      res.set('ETag', currentETag);
+      return res.status(412).json({
+        success: false,
+        message: 'File has been modified by someone else'
+      });
+    }
+
+    await fileSystem.deleteFile(workspaceId, filePath);
+
+    res.json({
+      success: true,
+      message: 'File deleted successfully'
+    });
+  } catch (error) {
+    logger.error('Error deleting workspace file:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to delete file'
+    });
+  }
+});
+
+// GET /api/workspaces/:workspaceId/archive - Download the workspace as tar.gz
+router.get('/:workspaceId/archive', authenticateFirebase, authorizeWorkspace('read'), async (req, res) => {
+  try {
+    const workspaceId = req.workspace._id.toString();
+    const { files, skipped } = await workspaceArchive.collectExportFiles(workspaceId);
+    const fileName = fileValidation.sanitizeFileName(req.workspace.name) || workspaceId;
+
+    res.set({
+      'Content-Type': 'application/gzip',
+      'Content-Disposition': `attachment; filename="${fileName}.tar.gz"`,
+      'X-Archive-Files': String(files.length),
+      'X-Archive-Skipped': String(skipped.length)
+    });
+
+    await workspaceArchive.exportTo(workspaceId, files, res);
+  } catch (error) {
+    logger.error('Error exporting workspace archive:', error);
+    if (res.headersSent) {
+      return res.destroy(error);
+    }
+    res.status(500).json({
+      success: false,
+      message: 'Failed to export workspace'
+    });
+  }
+});
+
+// POST /api/workspaces/:workspaceId/archive - Replace the workspace contents with an uploaded tarball
+router.post('/:workspaceId/archive', authenticateFirebase, authorizeWorkspace('write'), async (req, res) => {
+  try {
+    const workspaceId = req.workspace._id.toString();
+    const contentType = (req.get('Content-Type') || '').split(';')[0].trim();
+
+    if (!ARCHIVE_TYPES.has(contentType)) {
+      return res.status(415).json({
+        success: false,
+        message: `Upload must be one of: ${[...ARCHIVE_TYPES].join(', ')}`
+      });
+    }
+
+    const result = await workspaceArchive.restore(workspaceId, req, { gzip: contentType !== 'application/x-tar' });
+
+    logger.info(`Workspace ${workspaceId} restored from archive by user ${req.user.id}`);
+
+    res.json({
+      success: true,
+      message: 'Workspace restored from archive',
+      data: {
+        fileCount: result.fileCount,
+        totalSize: result.totalSize
+      }
+    });
+  } catch (error) {
+    if (error.code === 'INVALID_ARCHIVE') {
+      return res.status(400).json({
+        success: false,
+        message: error.message
+      });
+    }
+
+    if (error.code === 'QUOTA_EXCEEDED') {
+      return res.status(413).json({
+        success: false,
+        message: error.message
+      });
+    }
+
+    logger.error('Error restoring workspace archive:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to restore workspace'
+    });
+  }
+});
+
+const SECRET_ERROR_STATUS = { INVALID_SECRET: 400, SECRET_LIMIT: 409, SECRETS_DISABLED: 503 };
+
+const secretNameValidation = [
+  param('workspaceId')
+    .isMongoId()
+    .withMessage('Invalid workspace ID'),
+  param('name')
+    .isLength({ min: 1, max: 128 })
+    .withMessage('Secret name must be between 1 and 128 characters')
+];
+
+// GET /api/workspaces/:workspaceId/secrets - Names of the workspace's secrets; values are never returned
+router.get('/:workspaceId/secrets', authenticateFirebase, authorizeWorkspace('read'), async (req, res) => {
+  try {
+    const secrets = await workspaceSecrets.list(req.workspace._id.toString());
+
+    res.json({
+      success: true,
+      data: { secrets, enabled: workspaceSecrets.isEnabled() }
+    });
+  } catch (error) {
+    logger.error('Error listing workspace secrets:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to list secrets'
+    });
+  }
+});
+
+// PUT /api/workspaces/:workspaceId/secrets/:name - Store or replace a secret, encrypted
+router.put('/:workspaceId/secrets/:name', authenticateFirebase, [
+  ...secretNameValidation,
+  body('value')
+    .isString()
+    .withMessage('value must be a string')
+], validateRequest, authorizeWorkspace('write'), async (req, res) => {
+  try {
+    const result = await workspaceSecrets.set(req.workspace._id.toString(), req.params.name, req.body.value, req.user.id);
+
+    res.status(result.created ? 201 : 200).json({
+      success: true,
+      message: result.created ? 'Secret created' : 'Secret updated',
+      data: { name: result.name, updatedAt: result.updatedAt }
+    });
+  } catch (error) {
+    if (SECRET_ERROR_STATUS[error.code]) {
+      return res.status(SECRET_ERROR_STATUS[error.code]).json({
+        success: false,
+        message: error.message
+      });
+    }
+
+    logger.error('Error storing workspace secret:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to store secret'
+    });
+  }
+});
+
+// DELETE /api/workspaces/:workspaceId/secrets/:name - Delete a secret; executions starting from now won't get it
+router.delete('/:workspaceId/secrets/:name', authenticateFirebase, secretNameValidation, validateRequest, authorizeWorkspace('write'), async (req, res) => {
+  try {
+    const removed = await workspaceSecrets.remove(req.workspace._id.toString(), req.params.name, req.user.id);
+    if (!removed) {
+      return res.status(404).json({
+        success: false,
+        message: 'Secret not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      message: 'Secret deleted'
+    });
+  } catch (error) {
+    logger.error('Error deleting workspace secret:', error);
+    res.status(500).json({
+      success: false,
+      message: 'Failed to delete secret'
+    });
+  }
+});
+
+// POST /api/workspaces/:workspaceId/test - Run the runtime's test runner against the mounted workspace
+router.post('/:workspaceId/test', authenticateFirebase, rateLimit('execute'), [
+  body('containerId')
+    .isString()
+    .isLength({ min: 1 })
+    .withMessage('Container ID is required'),
+  body('compile_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('compile_timeout_ms must be a positive integer'),
+  body('run_timeout_ms')
+    .optional()
+    .isInt({ min: 1 })
+    .withMessage('run_timeout_ms must be a positive integer')
+], validateRequest, authorizeWorkspace('execute'), async (req, res) => {
+  // Clients asking for text/event-stream get each result as the runner reports it
+  const sse = req.accepts(['application/json', 'text/event-stream']) === 'text/event-stream';
+  const sendFrame = (frame) => res.write(`data: ${JSON.stringify(frame)}\n\n`);
+  let ticket = null;
+
+  try {
+    const workspaceId = req.workspace._id.toString();
+    const containerInfo = await dockerService.getContainerInfo(req.body.containerId);
+
+    if (!containerInfo || containerInfo.userId !== req.user.id) {
+      return res.status(403).json({
+        success: false,
+        message: 'Container not found or access denied'
+      });
+    }
+
+    // Test runs share execution slots with regular runs
+    try {
+      ticket = executionQueue.enqueue(req.user.id);
+    } catch (error) {
+      if (error.code === 'QUEUE_FULL' || error.code === 'SHUTTING_DOWN') {
+        res.set('Retry-After', String(error.retryAfter));
+        return res.status(error.code === 'QUEUE_FULL' ? 429 : 503).json({
+          success: false,
+          message: error.message,
+          retryAfter: error.retryAfter
+        });
+      }
+      throw error;
+    }
+
+    if (sse) {
+      res.writeHead(200, {
+        'Content-Type': 'text/event-stream',
+        'Cache-Control': 'no-cache',
+        'Connection': 'keep-alive'
+      });
+      res.on('close', () => ticket.cancel());
+    }
+
+    await ticket.ready;
+    if (ticket.state === 'cancelled') {
+      return;
+    }
+
+    const report = await testRunner.run(containerInfo, workspaceId, {
+      compileTimeoutMs: req.body.compile_timeout_ms !== undefined ? parseInt(req.body.compile_timeout_ms, 10) : undefined,
+      runTimeoutMs: req.body.run_timeout_ms !== undefined ? parseInt(req.body.run_timeout_ms, 10) : undefined,
+      onResult: (result) => {
+        if (sse && !res.writableEnded) {
+          sendFrame({ event: 'test', ...result });
+        }
+      }
+    });
+
+    // Test runners may leave reports and coverage in the workspace
+    workspaceWatcher.executionFinished(workspaceId).catch(error =>
+      logger.warn(`Failed to report file changes of the test run in ${workspaceId}:`, error.message)
+    );
+
+    if (sse) {
+      sendFrame({ event: 'report', ...report });
+      return res.end();
+    }
+
+    res.json({
+      success: true,
+      data: report
+    });
+  } catch (error) {
+    const status = { NO_TEST_RUNNER: 400, WORKSPACE_NOT_MOUNTED: 400 }[error.code] || 500;
+    if (status === 500) {
+      logger.error('Error running workspace tests:', error);
+    }
+
+    if (res.headersSent) {
+      sendFrame({ event: 'error', message: status === 500 ? 'Failed to run tests' : error.message });
+      return res.end();
+    }
+
+    res.status(status).json({
+      success: false,
+      message: status === 500 ? 'Failed to run tests' : error.message
+    });
+  } finally {
+    if (ticket) {
+      ticket.release();
+    }
+  }
+});
+
+module.exports = router;
\ No newline at end of file
@@ -32,6 +32,8 @@ const {
   validateContentType,
   generateCSRFToken
 } = require('./middleware/security');
+const { traceRequests } = require('./middleware/tracing');
+const tracing = require('./utils/tracing');
 
 const app = express();
 const server = createServer(app);
@@ -60,6 +62,9 @@ if (config.nodeEnv === 'development') {
 // Custom request logger
 app.use(requestLogger);
 
+// A trace span per request (after the logger so it carries the request ID)
+app.use(traceRequests);
+
 // Request size validation
 app.use(validateRequestSize(10 * 1024 * 1024)); // 10MB limit
 
@@ -112,6 +117,16 @@ app.use(generateCSRFToken);
 const healthRoutes = require('./routes/health');
 app.use('/health', healthRoutes);
 
+// Liveness and readiness probes for orchestrators (GET /healthz, GET /readyz)
+const probeRoutes = require('./routes/probes');
+app.use('/', probeRoutes);
+
+// Prometheus metrics (before rate limiting so scrapes are never throttled)
+if (config.metrics.enabled) {
+  const metricsRoutes = require('./routes/metrics');
+  app.use('/metrics', metricsRoutes);
+}
+
 // API routes with rate limiting
 app.use('/api', apiLimiter);
 
@@ -137,6 +152,26 @@ app.use('/api/terminal', terminalRoutes);
 const executionRoutes = require('./routes/execution');
 app.use('/api/execution', executionRoutes);
 
+// Execution lifecycle routes (cancellation by execution ID)
+const executionsRoutes = require('./routes/executions');
+app.use('/api/executions', executionsRoutes);
+
+// REPL session routes
+const replRoutes = require('./routes/repl');
+app.use('/api/repl', replRoutes);
+
+// Code formatting routes
+const formatRoutes = require('./routes/format');
+app.use('/api/format', formatRoutes);
+
+// Runtime registry routes
+const runtimeRoutes = require('./routes/runtimes');
+app.use('/api/runtimes', runtimeRoutes);
+
+// Starter project template routes
+const templateRoutes = require('./routes/templates');
+app.use('/api/templates', templateRoutes);
+
 // LSP routes
 const lspRoutes = require('./routes/lsp');
 app.use('/api/lsp', lspRoutes);
@@ -157,12 +192,19 @@ app.use('/api/workspaces', workspaceRoutes);
 const securityRoutes = require('./routes/security');
 app.use('/api/security', securityRoutes);
 
+// Admin routes
+const adminRoutes = require('./routes/admin');
+app.use('/api/admin', adminRoutes);
+
 // Placeholder for other API routes (will be implemented in future tasks)
 app.use('/api', (req, res) => {
   res.json({ 
     message: 'API endpoints available',
     availableEndpoints: [
       'GET /health - Health check',
+      'GET /healthz - Liveness probe',
+      'GET /readyz - Readiness probe (Docker, runtime images, execution queue)',
+      'GET /metrics - Prometheus metrics',
       'POST /api/auth/google - Google OAuth login',
       'GET /api/auth/google/callback - Google OAuth callback',
       'POST /api/auth/refresh - Refresh access token',
@@ -187,6 +229,30 @@ app.use('/api', (req, res) => {
       'POST /api/terminal/create - Create new terminal session',
       'PUT /api/terminal/:terminalId/resize - Resize terminal',
       'DELETE /api/terminal/:terminalId - Destroy terminal session',
+      'POST /api/execution/judge - Run code against input/output test cases (AC/WA/TLE/RE per case)',
+      'POST /api/execution/benchmark - Time repeated runs on pinned CPUs (per-trial wall/user/sys, min/median/stddev)',
+      'GET /api/executions - List your execution history (limit, cursor)',
+      'POST /api/executions?mode=async - Run code as a background job (callback_url optional)',
+      'POST /api/executions/batch - Run one program against up to 50 stdin/args/env variants',
+      'GET /api/executions/batch/:id - Get a batch and its per-variant results',
+      'DELETE /api/executions/batch/:id - Cancel a batch',
+      'GET /api/executions/:id - Get an execution with its code and output, or a job\'s state',
+      'GET /api/executions/:id/output?stream=stdout - Download a stream\'s full (spilled) output',
+      'GET /api/executions/:id/artifacts/:name - Download a file the execution collected through artifacts',
+      'GET /api/executions/:id/diff/:otherId - Compare the outcome and output of two executions (presets, normalize)',
+      'POST /api/executions/:id/rerun - Run a past execution again',
+      'DELETE /api/executions/:id - Cancel a running execution or queued background job',
+      'POST /api/repl - Start a REPL session (python, node)',
+      'GET /api/repl - List your REPL sessions',
+      'POST /api/repl/:sessionId/eval - Evaluate a snippet (stream: true also emits repl:output)',
+      'DELETE /api/repl/:sessionId - Close a REPL session',
+      'POST /api/format - Format source with the runtime\'s formatter (gofmt/goimports, black, prettier)',
+      'GET /api/runtimes - List available execution runtimes',
+      'GET /api/runtimes/:name - Get runtime details',
+      'GET /api/templates - List starter project templates',
+      'POST /api/admin/runtimes/:name/build - Rebuild a runtime image and switch to it (admin)',
+      'GET /api/admin/config - Get runtime timeouts, resource limits and pool sizes (admin)',
+      'PUT /api/admin/config - Change them without a restart, audited (admin)',
       'GET /api/lsp/languages - Get supported programming languages',
       'GET /api/lsp/servers - Get active LSP servers',
       'POST /api/lsp/servers - Start LSP server for language',
@@ -231,6 +297,24 @@ app.use('/api', (req, res) => {
       'GET /api/git/github/repositories - List user repositories',
       'POST /api/git/github/repositories - Create new repository',
       'GET /api/workspaces - Workspace management (coming soon)',
+      'POST /api/workspaces?template=:id - Create a workspace from a starter template',
+      'GET /api/workspaces/:workspaceId/files/*path - Read workspace file (ETag)',
+      'PUT /api/workspaces/:workspaceId/files/*path - Write workspace file (If-Match, quota)',
+      'DELETE /api/workspaces/:workspaceId/files/*path - Delete workspace file',
+      'GET /api/workspaces/:workspaceId/usage - Disk usage against the workspace quota',
+      'GET /api/workspaces/:workspaceId/archive - Export workspace as tar.gz',
+      'POST /api/workspaces/:workspaceId/archive - Restore workspace from tarball (atomic)',
+      'POST /api/workspaces/:workspaceId/test - Run the test runner (JSON or SSE per-test results)',
+      'GET /api/workspaces/:workspaceId/secrets - List secret names (values are never returned)',
+      'PUT /api/workspaces/:workspaceId/secrets/:name - Store a secret, encrypted; runs with use_secrets get it as env',
+      'DELETE /api/workspaces/:workspaceId/secrets/:name - Delete a secret',
+      'GET /api/workspaces/:workspaceId/members - List members and share links',
+      'POST /api/workspaces/:workspaceId/members - Grant a user the viewer or editor role',
+      'DELETE /api/workspaces/:workspaceId/members/:userId - Revoke a member',
+      'POST /api/workspaces/:workspaceId/invites - Create an expiring share link',
+      'DELETE /api/workspaces/:workspaceId/invites/:inviteId - Revoke a share link',
+      'POST /api/workspaces/invites/:token/accept - Join a workspace through a share link',
+      'gRPC studio.execution.v1.ExecutionService on GRPC_PORT (proto/execution.proto) - Execute, ListRuntimes, CancelExecution',
       'POST /api/execute - Code execution (coming soon)'
     ]
   });
@@ -245,6 +329,9 @@ app.use(globalErrorHandler);
 // Initialize databases and start server
 const startServer = async () => {
   try {
+    // OTLP trace export, when configured
+    tracing.initialize();
+
     // Initialize database connections
     if (config.nodeEnv !== 'test') {
       logger.info('Initializing database connections...');
@@ -272,6 +359,37 @@ const startServer = async () => {
     const gitManager = require('./utils/gitManager');
     await gitManager.initialize();
     logger.info('Git manager initialized successfully');
+
+    // Prune execution history past its retention window
+    const executionHistory = require('./services/executionHistory');
+    executionHistory.start();
+
+    // Announce this instance to clients reattaching to its executions
+    const executionSessions = require('./services/executionSessions');
+    executionSessions.start();
+
+    // Measure workspaces against their disk quota after writes
+    const workspaceQuota = require('./services/workspaceQuota');
+    workspaceQuota.start();
+
+    // Stop the containers of idle workspaces until they're used again
+    const workspaceHibernation = require('./services/workspaceHibernation');
+    workspaceHibernation.start();
+
+    // Reload the code screening rules whenever their file changes
+    const screening = require('./services/screening');
+    screening.start();
+
+    // Check the runtime images for their formatters and warm a container each
+    const dockerService = require('./services/dockerService');
+    if (dockerService.isAvailable) {
+      const formatService = require('./services/formatService');
+      formatService.verify().catch(error => logger.warn('Formatter check failed:', error.message));
+    }
+
+    // gRPC API for programmatic clients, on its own port
+    const grpcServer = require('./services/grpcServer');
+    grpcServer.start().catch(error => logger.error('Failed to start gRPC server:', error));
     
     // Start server with error handling
     server.listen(config.port, () => {
@@ -314,11 +432,42 @@ const startServer = async () => {
     });
     
     // Enhanced graceful shutdown
+    let shuttingDown = false;
     const enhancedGracefulShutdown = (signal) => {
       return async () => {
+        if (shuttingDown) {
+          return;
+        }
+        shuttingDown = true;
         logger.info(`Received ${signal}. Graceful shutdown initiated.`);
         
         try {
+          // Refuse new executions (503) and let running ones finish streaming
+          const benchmarkService = require('./services/benchmarkService');
+          benchmarkService.drain();
+          const executionService = require('./services/executionService');
+          await executionService.drain(config.shutdown.drainTimeoutMs);
+
+          // Running gRPC streams ended with the drain; stop taking new calls
+          const grpcServer = require('./services/grpcServer');
+          await grpcServer.shutdown(1000);
+
+          // No more hibernating while containers are being torn down
+          const workspaceHibernation = require('./services/workspaceHibernation');
+          workspaceHibernation.shutdown();
+
+          // Write open collaborative documents back to their files
+          const collaborationHub = require('./services/collaborationHub');
+          await collaborationHub.shutdown();
+
+          // Stop language servers running in workspace containers
+          const lspGateway = require('./services/lspGateway');
+          lspGateway.shutdown();
+
+          // Close workspace file watchers
+          const workspaceWatcher = require('./services/workspaceWatcher');
+          workspaceWatcher.shutdown();
+
           // Close WebSocket connections
           if (webSocketService.getIO()) {
             webSocketService.getIO().close();
@@ -335,14 +484,41 @@ const startServer = async () => {
           const { closeDatabases } = require('./utils/database');
           await closeDatabases();
           
-          // Shutdown container manager
+          // Kill and remove whatever outlived the drain period
           const containerManager = require('./utils/containerManager');
           await containerManager.shutdown();
           
           // Shutdown LSP service
           const lspService = require('./services/lspService');
           await lspService.shutdown();
-          
+
+          // Stop the sandbox egress proxy (no-op if never started)
+          const egressProxy = require('./services/egressProxy');
+          await egressProxy.stop();
+
+          // Stop the dependency cache prune job
+          const cacheVolumes = require('./services/cacheVolumes');
+          cacheVolumes.stop();
+
+          // Stop the leaked resource sweep
+          const resourceReaper = require('./services/resourceReaper');
+          resourceReaper.stop();
+
+          // Stop the execution history retention job
+          const executionHistory = require('./services/executionHistory');
+          executionHistory.stop();
+
+          // Stop the heartbeat: executions still listed under this instance are orphaned
+          const executionSessions = require('./services/executionSessions');
+          executionSessions.stop();
+
+          // Remove the warm formatter containers
+          const formatService = require('./services/formatService');
+          formatService.shutdown();
+
+          // Export spans still buffered
+          await tracing.shutdown();
+
           // Close HTTP server
           server.close(() => {
             logger.info('HTTP server closed.');
@@ -0,0 +1,110 @@
+const path = require('path');
+const fs = require('fs');
+const crypto = require('crypto');
+const config = require('../config');
+const logger = require('../utils/logger');
+const { detectContentType } = require('../utils/contentType');
+
+/**
+ * Files an execution declared as artifacts, copied out of its container once
+ * the program exited. Each execution gets a directory, <path>/<executionId>,
+ * holding one file per artifact named by the sha256 of its workspace path,
+ * so no user-chosen name ever reaches the host filesystem. Names, sizes and
+ * types live on the execution record; directories are removed by the
+ * execution history prune job along with the records.
+ */
+class ArtifactStore {
+  constructor() {
+    this.config = { ...config.artifacts };
+  }
+
+  isEnabled() {
+    return this.config.enabled;
+  }
+
+  getDirectory(executionId) {
+    if (!/^[\w-]+$/.test(executionId)) {
+      throw new Error('Invalid execution ID');
+    }
+    return path.join(path.resolve(this.config.path), executionId);
+  }
+
+  getFilePath(executionId, name) {
+    return path.join(this.getDirectory(executionId), crypto.createHash('sha256').update(name).digest('hex'));
+  }
+
+  /**
+   * Download URL of one artifact
+   */
+  urlFor(executionId, name) {
+    return `/api/executions/${executionId}/artifacts/${encodeURIComponent(name)}`;
+  }
+
+  /**
+   * Write an execution's collected files
+   * @param {Array} files - [{ path, content }] from sandbox.readFiles
+   * @returns {Array} [{ name, size, mimeType }]
+   */
+  async save(executionId, files) {
+    if (files.length === 0) {
+      return [];
+    }
+
+    await fs.promises.mkdir(this.getDirectory(executionId), { recursive: true });
+    const artifacts = [];
+    for (const { path: name, content } of files) {
+      await fs.promises.writeFile(this.getFilePath(executionId, name), content, { mode: 0o600 });
+      artifacts.push({ name, size: content.length, mimeType: detectContentType(content) });
+    }
+    return artifacts;
+  }
+
+  /**
+   * The stored file of an artifact, or null once it was removed
+   * @returns {Object|null} { path, size }
+   */
+  async find(executionId, name) {
+    try {
+      const filePath = this.getFilePath(executionId, name);
+      const stats = await fs.promises.stat(filePath);
+      return { path: filePath, size: stats.size };
+    } catch (error) {
+      return null;
+    }
+  }
+
+  async remove(executionId) {
+    await fs.promises.rm(this.getDirectory(executionId), { recursive: true, force: true });
+  }
+
+  /**
+   * Delete the artifacts of executions stored before `date`
+   * @returns {number} Executions whose artifacts were removed
+   */
+  async removeOlderThan(date) {
+    const dir = path.resolve(this.config.path);
+    let names;
+    try {
+      names = await fs.promises.readdir(dir);
+    } catch (error) {
+      return 0; // nothing stored yet
+    }
+
+    let removed = 0;
+    for (const name of names) {
+      const executionDir = path.join(dir, name);
+      try {
+        const stats = await fs.promises.stat(executionDir);
+        if (stats.isDirectory() && stats.mtime < date) {
+          await fs.promises.rm(executionDir, { recursive: true, force: true });
+          removed++;
+        }
+      } catch (error) {
+        logger.warn(`Failed to remove artifacts of execution ${name}:`, error.message);
+      }
+    }
+    return removed;
+  }
+}
+
+module.exports = new ArtifactStore();
\ No newline at end of file
@@ -0,0 +1,493 @@
+const crypto = require('crypto');
+const dns = require('dns');
+const http = require('http');
+const https = require('https');
+const net = require('net');
+const config = require('../config');
+const logger = require('../utils/logger');
+const requestContext = require('../utils/requestContext');
+const tracing = require('../utils/tracing');
+const { classify, outcome } = require('../utils/execErrors');
+const dockerService = require('./dockerService');
+const executionService = require('./executionService');
+const executionQueue = require('./executionQueue');
+const executionHistory = require('./executionHistory');
+const executionAudit = require('./executionAudit');
+const runtimeRegistry = require('./runtimeRegistry');
+const workspaceSecrets = require('./workspaceSecrets');
+
+const jobError = (code, message) => {
+  const error = new Error(message);
+  error.code = code;
+  return error;
+};
+
+// Callback hosts that would let a job poke at the backend's own network.
+// Names are checked again by the addresses they resolve to (lookupPublic).
+const isPrivateAddress = (host) => {
+  const address = host.replace(/^\[|\]$/g, '').toLowerCase();
+  if (net.isIPv4(address)) {
+    const [a, b] = address.split('.').map(Number);
+    return a === 10 || a === 127 || a === 0 || (a === 169 && b === 254) ||
+      (a === 172 && b >= 16 && b <= 31) || (a === 192 && b === 168) || (a === 100 && b >= 64 && b <= 127) ||
+      a >= 224; // multicast and reserved
+  }
+  if (net.isIPv6(address)) {
+    return address === '::1' || address === '::' || /^f[cd]/.test(address) || /^fe[89ab]/.test(address) ||
+      address.startsWith('::ffff:');
+  }
+  return address === 'localhost' || address.endsWith('.localhost') || address.endsWith('.internal');
+};
+
+/**
+ * Background executions for jobs too long to hold a connection open for.
+ * A job waits in the normal execution queue (under its own per-user key, so
+ * it never takes an interactive slot), runs in a container of its own with
+ * the longer config.asyncJobs timeouts and lands in the execution history
+ * like any other run. Jobs move queued -> running -> finished; users may
+ * have perUserLimit of them queued or running at once.
+ *
+ * A job submitted with a callback URL has its result POSTed there once it
+ * finishes, signed with HMAC-SHA256 over "<timestamp>.<body>":
+ *
+ *   X-Studio-Signature: sha256=<hex>
+ *   X-Studio-Timestamp: <unix seconds>
+ *   X-Studio-Delivery: <id, the same for every attempt>
+ *
+ * 5xx responses and network errors are retried with exponential backoff;
+ * other non-2xx responses fail the delivery at once. Every address the
+ * callback host resolves to must be public, checked at each attempt, and the
+ * request connects to the address that was checked.
+ */
+class AsyncJobService {
+  constructor() {
+    this.config = { ...config.asyncJobs };
+    this.jobs = new Map(); // executionId -> job, until jobRetentionMs after it finished
+  }
+
+  countActive(userId) {
+    let count = 0;
+    for (const job of this.jobs.values()) {
+      if (job.userId === userId && job.state !== 'finished') {
+        count++;
+      }
+    }
+    return count;
+  }
+
+  /**
+   * @returns {string} The normalized URL
+   */
+  validateCallbackUrl(callbackUrl) {
+    let url;
+    try {
+      url = new URL(callbackUrl);
+    } catch (error) {
+      throw jobError('INVALID_CALLBACK_URL', 'callback_url must be an absolute URL');
+    }
+
+    if (url.protocol !== 'https:' && url.protocol !== 'http:') {
+      throw jobError('INVALID_CALLBACK_URL', 'callback_url must use http or https');
+    }
+    if (url.username || url.password) {
+      throw jobError('INVALID_CALLBACK_URL', 'callback_url must not contain credentials');
+    }
+    if (!this.config.allowPrivateCallbackHosts && isPrivateAddress(url.hostname)) {
+      throw jobError('INVALID_CALLBACK_URL', 'callback_url must point at a public host');
+    }
+
+    return url.toString();
+  }
+
+  /**
+   * Queue a job
+   * @param {string} userId - Owner
+   * @param {Object} request - { language, code, filename, files, entrypoint, stdin,
+   *   args, env, secretsWorkspaceId, compileTimeoutMs, runTimeoutMs, callbackUrl }
+   * @returns {Object} The job, in state queued or running
+   */
+  submit(userId, request) {
+    if (!runtimeRegistry.has(request.language)) {
+      throw jobError('RUNTIME_NOT_FOUND', `Unsupported language: ${request.language}`);
+    }
+
+    let callback = null;
+    if (request.callbackUrl) {
+      if (!this.config.callbackSecret) {
+        throw jobError('CALLBACKS_DISABLED', 'Callbacks are not configured on this server');
+      }
+      callback = {
+        url: this.validateCallbackUrl(request.callbackUrl),
+        deliveryId: crypto.randomUUID(),
+        status: 'pending',
+        attempts: 0,
+        lastStatusCode: null,
+        lastError: null,
+        deliveredAt: null
+      };
+    }
+
+    if (this.countActive(userId) >= this.config.perUserLimit) {
+      const error = jobError('ASYNC_LIMIT', `At most ${this.config.perUserLimit} background jobs may be queued or running at once`);
+      error.retryAfter = config.executionQueue.retryAfterSeconds;
+      throw error;
+    }
+
+    // QUEUE_FULL and SHUTTING_DOWN go back to the caller. Jobs run on the
+    // longer tier, so their slot isn't stuck until both phases could have run.
+    const ticket = executionQueue.enqueue(`async:${userId}`, {
+      timeoutMs: this.config.compileTimeoutMs + this.config.runTimeoutMs + config.execution.cancelGraceMs + 60 * 1000
+    });
+
+    const job = {
+      id: crypto.randomUUID(),
+      requestId: requestContext.getRequestId() || crypto.randomUUID(),
+      userId,
+      language: request.language,
+      request,
+      state: 'queued',
+      queuedAt: new Date(),
+      startedAt: null,
+      finishedAt: null,
+      result: null,
+      callback,
+      ticket,
+      containerId: null,
+      traceContext: tracing.active() // the job's spans continue the submitting request's trace
+    };
+    this.jobs.set(job.id, job);
+
+    ticket.ready
+      .then(() => tracing.runInContext(job.traceContext, () =>
+        tracing.withSpan('async_job.run', { 'studio.execution_id': job.id, 'studio.runtime': job.language }, () => this.run(job))
+      ))
+      .catch(error => logger.error(`Background job ${job.id} failed:`, error));
+
+    logger.info(`Background job ${job.id} queued`, { userId, runtime: job.language, callback: Boolean(callback) });
+    return job;
+  }
+
+  async run(job) {
+    const { request, ticket } = job;
+    const executionData = {
+      id: job.id,
+      requestId: job.requestId,
+      userId: job.userId,
+      mode: 'async',
+      code: request.code || null,
+      filename: request.filename || 'main',
+      files: request.files || null,
+      entrypoint: request.entrypoint || null,
+      stdin: request.stdin || null,
+      args: request.args || [],
+      env: request.env || {},
+      secretsWorkspaceId: request.secretsWorkspaceId || null,
+      artifactPatterns: request.artifacts || [],
+      language: job.language,
+      startTime: new Date(),
+      status: 'running',
+      output: '',
+      stdout: '',
+      stderr: '',
+      exitCode: null,
+      killedReason: null,
+      error: null,
+      queueTicket: ticket,
+      ...executionAudit.measureCode(request.code, request.files)
+    };
+
+    if (ticket.state === 'cancelled') {
+      executionData.status = 'cancelled';
+      executionData.killedReason = job.cancelReason || 'shutdown';
+      return this.complete(job, executionData, { recorded: false });
+    }
+
+    job.state = 'running';
+    job.startedAt = executionData.startTime;
+
+    let secrets = null;
+    try {
+      // Read when the job starts, so secrets changed while it was queued apply
+      if (executionData.secretsWorkspaceId) {
+        secrets = await workspaceSecrets.forExecution(executionData.secretsWorkspaceId, job.userId);
+      }
+
+      const { containerId } = await dockerService.createContainer(job.language, 'async-job', job.userId);
+      job.containerId = containerId;
+      executionData.containerId = containerId;
+
+      executionData.execution = await dockerService.executeCode(containerId, executionData.code, executionData.filename, {
+        stdin: executionData.stdin,
+        files: executionData.files,
+        entrypoint: executionData.entrypoint,
+        args: executionData.args,
+        env: executionData.env,
+        secrets,
+        compileTimeoutMs: request.compileTimeoutMs,
+        runTimeoutMs: request.runTimeoutMs,
+        timeoutTier: this.config,
+        requestId: job.requestId
+      });
+    } catch (error) {
+      ticket.release();
+      logger.error(`Background job ${job.id} failed to start:`, error);
+      const classified = classify(error);
+      executionData.status = 'error';
+      executionData.error = classified.message;
+      executionData.errorCode = classified.code;
+      return this.complete(job, executionData, { recorded: false });
+    }
+
+    executionService.registerExecution(executionData, { secrets });
+    await new Promise((resolve) => {
+      executionService.streamExecution(executionData.execution, executionData, {
+        onFrame: () => {},
+        onExit: () => {
+          executionService.finishExecution(job.id);
+          resolve();
+        },
+        onError: (error) => {
+          executionService.finishExecution(job.id);
+          logger.error(`Background job ${job.id} stream error:`, error);
+          resolve();
+        },
+        onCancel: () => resolve()
+      });
+    });
+
+    return this.complete(job, executionData, { recorded: true });
+  }
+
+  /**
+   * Mark the job finished, remove its container and report the result
+   */
+  async complete(job, executionData, { recorded }) {
+    executionData.endTime = executionData.endTime || new Date();
+    executionData.duration = executionData.endTime - executionData.startTime;
+    if (!recorded) {
+      // Jobs that never ran still belong in the history
+      await executionHistory.record(executionData);
+    }
+
+    job.state = 'finished';
+    job.finishedAt = executionData.endTime;
+    // `status` is the lifecycle status, `outcome` how the program ended
+    job.result = {
+      status: executionData.status,
+      outcome: outcome(executionData),
+      exitCode: executionData.exitCode === undefined ? null : executionData.exitCode,
+      killedReason: executionData.killedReason || null,
+      timeoutPhase: executionData.timeoutPhase || null,
+      durationMs: executionData.duration,
+      compileDurationMs: executionData.compileDurationMs || null,
+      error: executionData.error ? String(executionData.error) : null,
+      errorCode: executionData.errorCode || null,
+      output: executionHistory.truncateOutput(executionData.output || ''),
+      stdoutTruncated: Boolean(executionData.outputStreams && executionData.outputStreams.stdout.truncated),
+      stderrTruncated: Boolean(executionData.outputStreams && executionData.outputStreams.stderr.truncated),
+      artifacts: executionService.describeArtifacts(executionData)
+    };
+
+    logger.info(`Background job ${job.id} finished: ${job.result.status}`, { userId: job.userId, exitCode: job.result.exitCode });
+
+    if (job.containerId) {
+      dockerService.stopContainer(job.containerId, { force: true }).catch(error =>
+        logger.warn(`Failed to remove container of background job ${job.id}:`, error.message)
+      );
+    }
+
+    setTimeout(() => this.jobs.delete(job.id), this.config.jobRetentionMs).unref();
+
+    if (job.callback) {
+      await this.deliver(job);
+    }
+  }
+
+  getPayload(job) {
+    return {
+      event: 'execution.finished',
+      executionId: job.id,
+      runtime: job.language,
+      queuedAt: job.queuedAt,
+      startedAt: job.startedAt,
+      finishedAt: job.finishedAt,
+      ...job.result
+    };
+  }
+
+  sign(timestamp, body) {
+    return `sha256=${crypto.createHmac('sha256', this.config.callbackSecret).update(`${timestamp}.${body}`).digest('hex')}`;
+  }
+
+  /**
+   * POST the result to the job's callback URL, retrying 5xx and network
+   * failures up to callbackMaxAttempts times
+   */
+  async deliver(job) {
+    const { callback } = job;
+    const body = JSON.stringify(this.getPayload(job));
+
+    while (callback.attempts < this.config.callbackMaxAttempts) {
+      callback.attempts++;
+      const timestamp = String(Math.floor(Date.now() / 1000));
+
+      try {
+        // The receiver can join its handling to the job's trace via traceparent
+        const response = await tracing.withSpan('async_job.callback', { 'studio.callback.attempt': callback.attempts }, async (span) => {
+          const result = await this.postCallback(callback.url, body, tracing.inject({
+            'Content-Type': 'application/json',
+            'User-Agent': 'Studio-Webhooks/1.0',
+            'X-Studio-Signature': this.sign(timestamp, body),
+            'X-Studio-Timestamp': timestamp,
+            'X-Studio-Delivery': callback.deliveryId
+          }));
+          span.setAttribute('http.response.status_code', result.status);
+          return result;
+        });
+        callback.lastStatusCode = response.status;
+        callback.lastError = null;
+
+        if (response.status >= 200 && response.status < 300) {
+          callback.status = 'delivered';
+          callback.deliveredAt = new Date();
+          logger.info(`Delivered callback for background job ${job.id}`, { attempts: callback.attempts });
+          return;
+        }
+        if (response.status < 500) {
+          break; // the receiver rejected it; retrying won't help
+        }
+        callback.lastError = `HTTP ${response.status}`;
+      } catch (error) {
+        callback.lastError = error.message;
+        if (error.code === 'INVALID_CALLBACK_URL') {
+          break; // resolves to a private address; that won't change by retrying soon
+        }
+      }
+
+      if (callback.attempts < this.config.callbackMaxAttempts) {
+        const delay = this.config.callbackBackoffMs * 2 ** (callback.attempts - 1);
+        await new Promise(resolve => setTimeout(resolve, delay).unref());
+      }
+    }
+
+    callback.status = 'failed';
+    logger.warn(`Giving up on callback for background job ${job.id}`, {
+      attempts: callback.attempts,
+      statusCode: callback.lastStatusCode,
+      error: callback.lastError
+    });
+  }
+
+  /**
+   * One POST, not following redirects
+   * @returns {Promise<Object>} { status }
+   */
+  postCallback(url, body, headers) {
+    const target = new URL(url);
+    // Literal addresses never go through lookup
+    if (!this.config.allowPrivateCallbackHosts && isPrivateAddress(target.hostname)) {
+      return Promise.reject(jobError('INVALID_CALLBACK_URL', `${target.hostname} is not a public host`));
+    }
+
+    return new Promise((resolve, reject) => {
+      const transport = target.protocol === 'https:' ? https : http;
+      const request = transport.request(target, {
+        method: 'POST',
+        headers: { ...headers, 'Content-Length': Buffer.byteLength(body) },
+        lookup: (hostname, options, callback) => this.lookupPublic(hostname, options, callback)
+      }, (response) => {
+        clearTimeout(timer);
+        response.resume();
+        resolve({ status: response.statusCode });
+      });
+
+      const timer = setTimeout(() => {
+        request.destroy(new Error(`Callback timed out after ${this.config.callbackTimeoutMs}ms`));
+      }, this.config.callbackTimeoutMs);
+      request.on('error', (error) => {
+        clearTimeout(timer);
+        reject(error);
+      });
+      request.end(body);
+    });
+  }
+
+  /**
+   * dns.lookup for callback requests that fails unless every address the
+   * name resolves to is public. The socket connects to the address returned
+   * here, so a record changed after the check can't point it inward.
+   */
+  lookupPublic(hostname, options, callback) {
+    dns.lookup(hostname, { all: true, family: options.family || 0 }, (error, addresses) => {
+      if (error) {
+        return callback(error);
+      }
+      if (addresses.length === 0) {
+        return callback(Object.assign(new Error(`${hostname} has no addresses`), { code: 'ENOTFOUND' }));
+      }
+
+      const blocked = addresses.find(entry => isPrivateAddress(entry.address));
+      if (blocked && !this.config.allowPrivateCallbackHosts) {
+        return callback(jobError('INVALID_CALLBACK_URL', `${hostname} resolves to a private address (${blocked.address})`));
+      }
+
+      if (options.all) {
+        return callback(null, addresses);
+      }
+      return callback(null, addresses[0].address, addresses[0].family);
+    });
+  }
+
+  /**
+   * A user's job, while it is still known in memory
+   */
+  get(userId, jobId) {
+    const job = this.jobs.get(jobId);
+    return job && job.userId === userId ? job : null;
+  }
+
+  /**
+   * Cancel a queued job; running ones are cancelled like any execution
+   * @returns {boolean} false if the job isn't queued
+   */
+  cancel(userId, jobId) {
+    const job = this.get(userId, jobId);
+    if (!job || job.state !== 'queued') {
+      return false;
+    }
+    job.cancelReason = 'user_cancelled';
+    job.ticket.cancel();
+    return true;
+  }
+
+  /**
+   * API view of a job: `state` is queued, running or finished, `status` how
+   * the execution ended once it has
+   */
+  toJSON(job) {
+    return {
+      executionId: job.id,
+      mode: 'async',
+      runtime: job.language,
+      state: job.state,
+      status: job.result ? job.result.status : job.state,
+      position: job.state === 'queued' ? job.ticket.position || null : null,
+      queuedAt: job.queuedAt,
+      startedAt: job.startedAt,
+      finishedAt: job.finishedAt,
+      result: job.result,
+      callback: job.callback
+        ? {
+          url: job.callback.url,
+          status: job.callback.status,
+          attempts: job.callback.attempts,
+          lastStatusCode: job.callback.lastStatusCode,
+          lastError: job.callback.lastError,
+          deliveredAt: job.callback.deliveredAt
+        }
+        : null
+    };
+  }
+}
+
+module.exports = new AsyncJobService();
\ No newline at end of file
@@ -0,0 +1,374 @@
+const crypto = require('crypto');
+const { EventEmitter } = require('events');
+const config = require('../config');
+const logger = require('../utils/logger');
+const requestContext = require('../utils/requestContext');
+const programInput = require('../utils/programInput');
+const { truncate } = require('../utils/judgeComparison');
+const dockerService = require('./dockerService');
+const executionQueue = require('./executionQueue');
+const runtimeRegistry = require('./runtimeRegistry');
+
+const batchError = (code, message) => {
+  const error = new Error(message);
+  error.code = code;
+  return error;
+};
+
+/**
+ * Batch executions: one program run against many variants, each with its own
+ * stdin, args and env. The batch fans out over a few containers (workers),
+ * each holding one of the user's execution queue slots for its lifetime, so
+ * a batch never runs more programs at once than the user could interactively.
+ *
+ * Runtimes whose build is a single binary (those with a buildCache artifact)
+ * compile once and copy the binary to the other workers; other compiled
+ * runtimes build once per worker. A variant that fails, times out or can't
+ * run doesn't affect the others. Every finished variant emits a progress
+ * event on `batch.events`:
+ *   progress { batchId, completed, total, index, status }
+ *   finished { ...toJSON(batch) }
+ */
+class BatchExecutionService {
+  constructor() {
+    this.config = { ...config.batchExecutions };
+    this.batches = new Map(); // batchId -> batch, until retentionMs after it finished
+  }
+
+  /**
+   * Validate a batch and take its queue slots
+   * @param {string} userId - Owner
+   * @param {Object} request - { language, code, filename, variants: [{ stdin, args, env }],
+   *   compileTimeoutMs, runTimeoutMs }
+   * @returns {Object} The batch, in state queued or running
+   */
+  submit(userId, request) {
+    const runtime = runtimeRegistry.get(request.language);
+    if (!runtime) {
+      throw batchError('RUNTIME_NOT_FOUND', `Unsupported language: ${request.language}`);
+    }
+
+    const { variants } = request;
+    if (!Array.isArray(variants) || variants.length === 0) {
+      throw batchError('INVALID_VARIANTS', 'variants must be a non-empty array');
+    }
+    if (variants.length > this.config.maxVariants) {
+      throw batchError('INVALID_VARIANTS', `Too many variants (max ${this.config.maxVariants})`);
+    }
+
+    const normalized = variants.map((variant, index) => {
+      if (!variant || typeof variant !== 'object' || Array.isArray(variant)) {
+        throw batchError('INVALID_VARIANTS', `variants[${index}] must be an object`);
+      }
+      if (variant.stdin !== undefined && variant.stdin !== null && typeof variant.stdin !== 'string') {
+        throw batchError('INVALID_VARIANTS', `variants[${index}].stdin must be a string`);
+      }
+
+      const input = programInput.validate(variant.args, variant.env, runtime);
+      if (!input.isValid) {
+        throw batchError('INVALID_VARIANTS', `variants[${index}]: ${input.errors.join('; ')}`);
+      }
+      return { stdin: variant.stdin || '', args: input.args, env: input.env };
+    });
+
+    const limits = runtimeRegistry.resolveTimeouts(request.language, {
+      compileTimeoutMs: request.compileTimeoutMs,
+      runTimeoutMs: request.runTimeoutMs
+    });
+
+    // QUEUE_FULL and SHUTTING_DOWN go back to the caller. A worker's slot is
+    // held for its share of the variants, so it counts as stuck only after those.
+    const workers = Math.min(normalized.length, this.config.maxParallel, config.executionQueue.perUserLimit);
+    const rounds = Math.ceil(normalized.length / workers);
+    const tickets = [];
+    try {
+      for (let i = 0; i < workers; i++) {
+        tickets.push(executionQueue.enqueue(userId, {
+          timeoutMs: limits.compileTimeoutMs + rounds * limits.runTimeoutMs + 60 * 1000
+        }));
+      }
+    } catch (error) {
+      tickets.forEach(ticket => ticket.cancel());
+      throw error;
+    }
+
+    const batch = {
+      id: crypto.randomUUID(),
+      requestId: requestContext.getRequestId() || crypto.randomUUID(),
+      userId,
+      language: request.language,
+      code: request.code,
+      filename: request.filename || 'main',
+      limits,
+      variants: normalized,
+      results: normalized.map((variant, index) => ({ index, status: 'queued' })),
+      state: 'queued',
+      status: null,
+      queuedAt: new Date(),
+      startedAt: null,
+      finishedAt: null,
+      completed: 0,
+      next: 0, // next variant a worker picks up
+      build: null, // shared build of single-binary runtimes
+      buildFailed: false,
+      compile: null, // report of the first build
+      cancelReason: null,
+      workers: [],
+      events: new EventEmitter()
+    };
+    this.batches.set(batch.id, batch);
+
+    Promise.all(tickets.map(ticket => this.work(batch, ticket)))
+      .then(() => this.finish(batch))
+      .catch(error => logger.error(`Batch ${batch.id} failed:`, error));
+
+    logger.info(`Batch ${batch.id} queued`, { userId, runtime: batch.language, variants: normalized.length, workers });
+    return batch;
+  }
+
+  /**
+   * One worker: a container that takes variants until none are left
+   */
+  async work(batch, ticket) {
+    const worker = { ticket, containerId: null };
+    batch.workers.push(worker);
+
+    await ticket.ready;
+    try {
+      if (ticket.state === 'cancelled' || batch.cancelReason) {
+        return;
+      }
+      if (!batch.startedAt) {
+        batch.state = 'running';
+        batch.startedAt = new Date();
+      }
+
+      const { containerId } = await dockerService.createContainer(batch.language, 'batch', batch.userId);
+      worker.containerId = containerId;
+
+      const run = batch.cancelReason ? null : await this.prepare(batch, containerId);
+      while (run && !batch.cancelReason && batch.next < batch.variants.length) {
+        await this.runVariant(batch, containerId, run, batch.next++);
+      }
+    } catch (error) {
+      // Its variants are left to the other workers, or marked by finish()
+      logger.error(`Batch ${batch.id} worker failed:`, error);
+      worker.error = error.message;
+    } finally {
+      ticket.release();
+      if (worker.containerId) {
+        dockerService.stopContainer(worker.containerId, { force: true }).catch(error =>
+          logger.warn(`Failed to remove container of batch ${batch.id}:`, error.message)
+        );
+      }
+    }
+  }
+
+  /**
+   * Put the program into a worker's container, building it if needed
+   * @returns {Array|null} The run argv, or null when the build failed
+   */
+  async prepare(batch, containerId) {
+    const runtime = runtimeRegistry.get(batch.language);
+    const { container } = dockerService.containers.get(containerId);
+    const codeFile = dockerService.getCodeFilename(batch.filename, batch.language);
+    await dockerService.writeFileToContainer(container, codeFile, batch.code);
+
+    const phases = runtimeRegistry.getPhases(batch.language, codeFile);
+    if (!phases.compile) {
+      return phases.run;
+    }
+
+    const artifact = runtime.buildCache ? runtime.buildCache.artifact : null;
+    if (artifact && batch.build) {
+      const build = await batch.build;
+      if (!build.ok) {
+        return null;
+      }
+      if (build.binary) {
+        await dockerService.copyFileToContainer(containerId, artifact, build.binary, { mode: '755' });
+        return phases.run;
+      }
+      // The binary couldn't be copied out; build here instead
+    }
+
+    // Set before anything is awaited, so the other workers wait for this build
+    const build = this.compile(batch, containerId, phases.compile, artifact);
+    if (artifact && !batch.build) {
+      batch.build = build;
+    }
+    return (await build).ok ? phases.run : null;
+  }
+
+  async compile(batch, containerId, argv, artifact) {
+    const result = await dockerService.runCompilePhase(containerId, argv, [], batch.limits.compileTimeoutMs);
+    const ok = !result.timedOut && result.exitCode === 0;
+
+    if (!batch.compile) {
+      const output = `${result.stdout}${result.stderr}`.trim();
+      batch.compile = {
+        exit_code: result.exitCode,
+        timed_out: result.timedOut,
+        duration_ms: result.durationMs,
+        output: output ? truncate(output, this.config.outputLimitBytes).text : null
+      };
+    }
+    if (!ok) {
+      batch.buildFailed = true;
+      return { ok, binary: null };
+    }
+
+    let binary = null;
+    if (artifact) {
+      binary = await dockerService.copyFileFromContainer(containerId, artifact).catch((error) => {
+        logger.warn(`Failed to copy the build of batch ${batch.id}:`, error.message);
+        return null;
+      });
+    }
+    return { ok, binary };
+  }
+
+  async runVariant(batch, containerId, argv, index) {
+    const variant = batch.variants[index];
+    const result = batch.results[index];
+    result.status = 'running';
+
+    try {
+      const run = await dockerService.runBufferedExec(containerId, [...argv, ...variant.args], {
+        env: programInput.toEnv(variant.env),
+        stdin: variant.stdin,
+        timeoutMs: batch.limits.runTimeoutMs,
+        phase: 'batch'
+      });
+
+      if (run.timedOut) {
+        // Only the program dies; the container stays for the next variant
+        await dockerService.signalProcesses(containerId, 'KILL').catch(error =>
+          logger.error(`Failed to kill timed out batch variant in container ${containerId}:`, error)
+        );
+      }
+
+      const stdout = truncate(run.stdout, this.config.outputLimitBytes);
+      const stderr = truncate(run.stderr, this.config.outputLimitBytes);
+      let status = 'completed';
+      if (batch.cancelReason) {
+        status = 'cancelled';
+      } else if (run.timedOut) {
+        status = 'timeout';
+      }
+
+      Object.assign(result, {
+        status,
+        exitCode: run.exitCode,
+        durationMs: run.durationMs,
+        stdout: stdout.text,
+        stderr: stderr.text,
+        stdoutTruncated: stdout.truncated,
+        stderrTruncated: stderr.truncated
+      });
+    } catch (error) {
+      logger.warn(`Batch ${batch.id} variant ${index} failed:`, error.message);
+      Object.assign(result, { status: 'error', error: error.message });
+    }
+
+    batch.completed++;
+    batch.events.emit('progress', {
+      batchId: batch.id,
+      completed: batch.completed,
+      total: batch.variants.length,
+      index,
+      status: result.status
+    });
+  }
+
+  /**
+   * Mark what never ran and report the batch
+   */
+  finish(batch) {
+    let error = null;
+    if (!batch.cancelReason && !batch.buildFailed) {
+      const failed = batch.workers.find(worker => worker.error);
+      error = failed ? failed.error : 'No worker could run this variant';
+    }
+
+    for (const result of batch.results) {
+      if (result.status === 'queued' || result.status === 'running') {
+        if (batch.cancelReason) {
+          result.status = 'cancelled';
+        } else if (batch.buildFailed) {
+          result.status = 'skipped';
+        } else {
+          Object.assign(result, { status: 'error', error });
+        }
+      }
+    }
+
+    batch.state = 'finished';
+    batch.finishedAt = new Date();
+    if (batch.cancelReason) {
+      batch.status = 'cancelled';
+    } else {
+      batch.status = batch.buildFailed ? 'compile_error' : 'completed';
+    }
+
+    logger.info(`Batch ${batch.id} finished: ${batch.status}`, { userId: batch.userId, completed: batch.completed });
+    batch.events.emit('finished', this.toJSON(batch));
+
+    setTimeout(() => this.batches.delete(batch.id), this.config.retentionMs).unref();
+  }
+
+  /**
+   * A user's batch, while it is still known in memory
+   */
+  get(userId, batchId) {
+    const batch = this.batches.get(batchId);
+    return batch && batch.userId === userId ? batch : null;
+  }
+
+  /**
+   * Cancel a batch: variants not started yet are dropped and running ones killed
+   * @returns {boolean} false if the batch is unknown or already finished
+   */
+  cancel(userId, batchId, reason = 'user_cancelled') {
+    const batch = this.get(userId, batchId);
+    if (!batch || batch.state === 'finished') {
+      return false;
+    }
+
+    batch.cancelReason = reason;
+    for (const worker of batch.workers) {
+      if (worker.ticket.state === 'waiting') {
+        worker.ticket.cancel();
+      } else if (worker.containerId) {
+        dockerService.signalProcesses(worker.containerId, 'KILL').catch(error =>
+          logger.warn(`Failed to kill batch ${batch.id} in container ${worker.containerId}:`, error.message)
+        );
+      }
+    }
+
+    logger.info(`Batch ${batch.id} cancelled`, { userId, reason });
+    return true;
+  }
+
+  /**
+   * API view of a batch, results in variant order
+   */
+  toJSON(batch) {
+    return {
+      batchId: batch.id,
+      runtime: batch.language,
+      state: batch.state,
+      status: batch.status || batch.state,
+      total: batch.variants.length,
+      completed: batch.completed,
+      queuedAt: batch.queuedAt,
+      startedAt: batch.startedAt,
+      finishedAt: batch.finishedAt,
+      compile: batch.compile,
+      cancelReason: batch.cancelReason,
+      results: batch.results
+    };
+  }
+}
+
+module.exports = new BatchExecutionService();
\ No newline at end of file
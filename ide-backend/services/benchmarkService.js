@@ -0,0 +1,322 @@
+const crypto = require('crypto');
+const config = require('../config');
+const logger = require('../utils/logger');
+const cpuset = require('../utils/cpuset');
+const { truncate } = require('../utils/judgeComparison');
+const { ExecError } = require('../utils/execErrors');
+const { ExecutionQueue } = require('./executionQueue');
+const dockerService = require('./dockerService');
+const judgeService = require('./judgeService');
+const resourceLimits = require('./resourceLimits');
+const runtimeRegistry = require('./runtimeRegistry');
+
+// `times` prints the shell's own user/sys time, then its children's: "0m1.250s 0m0.031s"
+const TIMES_PATTERN = /(\d+)m([\d.]+)s\s+(\d+)m([\d.]+)s/;
+
+const round = (value) => Math.round(value * 1000) / 1000;
+
+/**
+ * min, median, mean and sample standard deviation of `values`, null if empty
+ */
+const summarize = (values) => {
+  if (values.length === 0) {
+    return null;
+  }
+
+  const sorted = [...values].sort((a, b) => a - b);
+  const middle = Math.floor(sorted.length / 2);
+  const mean = sorted.reduce((sum, value) => sum + value, 0) / sorted.length;
+  const variance = sorted.length > 1
+    ? sorted.reduce((sum, value) => sum + (value - mean) ** 2, 0) / (sorted.length - 1)
+    : 0;
+
+  return {
+    min: round(sorted[0]),
+    median: round(sorted.length % 2 ? sorted[middle] : (sorted[middle - 1] + sorted[middle]) / 2),
+    mean: round(mean),
+    stddev: round(Math.sqrt(variance))
+  };
+};
+
+/**
+ * Benchmark mode: compile a program once, then run it `trials` times in a
+ * fresh container and report per-trial wall, user and sys times with their
+ * spread. Each benchmark takes a slot of config.benchmark.cpus and its
+ * container is pinned there (CpusetCpus), while every other container is
+ * kept off those CPUs (see sharedCpuset).
+ *
+ * Slots are scarce, so benchmarks wait in a queue of their own, for up to
+ * maxWaitMs. Where pinning isn't possible (no CPUs configured, a daemon
+ * without cpuset support, CPUs the host doesn't have) they still run, but the
+ * result says `pinning.pinned: false` and why.
+ */
+class BenchmarkService {
+  constructor() {
+    this.config = { ...config.benchmark };
+    this.pinning = { available: false, reason: 'Benchmark CPUs have not been checked against the Docker host' };
+    this.slots = []; // free CPU sets, one per benchmark that can run
+    this.shared = null; // cpuset of every other container while benchmark CPUs are reserved
+    this.queue = new ExecutionQueue(this.queueSettings(this.config.unpinnedConcurrency), { exportMetrics: false });
+  }
+
+  queueSettings(maxConcurrent) {
+    return {
+      enabled: true,
+      maxConcurrent,
+      perUserLimit: 1,
+      maxQueueDepth: this.config.maxQueueDepth,
+      retryAfterSeconds: this.config.retryAfterSeconds,
+      stuckAfterMs: config.executionQueue.stuckAfterMs
+    };
+  }
+
+  /**
+   * Work out the benchmark slots from config.benchmark.cpus and what the
+   * daemon reports. Runs before any container is created, so the pool's warm
+   * containers are already kept off the reserved CPUs.
+   * @param {Object} docker - dockerode client
+   */
+  async initialize(docker) {
+    const unavailable = (reason) => {
+      this.pinning = { available: false, reason };
+      this.slots = [];
+      this.shared = null;
+      this.queue.config.maxConcurrent = this.config.unpinnedConcurrency;
+      logger.warn(`Benchmarks will run without CPU pinning: ${reason}`);
+    };
+
+    let reserved;
+    try {
+      reserved = cpuset.parse(this.config.cpus);
+    } catch (error) {
+      return unavailable(`BENCHMARK_CPUS: ${error.message}`);
+    }
+    if (reserved.length === 0) {
+      return unavailable('No CPUs are reserved for benchmarks (BENCHMARK_CPUS)');
+    }
+
+    let info;
+    try {
+      info = await docker.info();
+    } catch (error) {
+      return unavailable(`Failed to read the Docker host's CPUs: ${error.message}`);
+    }
+    if (info.CpuSet === false) {
+      return unavailable('The Docker daemon does not support cpusets');
+    }
+
+    const hostCpus = Array.from({ length: info.NCPU || 0 }, (_, cpu) => cpu);
+    const usable = reserved.filter(cpu => cpu < hostCpus.length);
+    if (usable.length < reserved.length) {
+      logger.warn(`Benchmark CPUs ${cpuset.format(reserved.filter(cpu => cpu >= hostCpus.length))} don't exist on a ${hostCpus.length} CPU host`);
+    }
+    if (usable.length < this.config.cpusPerRun) {
+      return unavailable(`The host has fewer than ${this.config.cpusPerRun} of the reserved CPUs ${this.config.cpus}`);
+    }
+    if (usable.length >= hostCpus.length) {
+      return unavailable('Reserving every CPU for benchmarks would leave none for other containers');
+    }
+
+    this.slots = [];
+    for (let i = 0; i + this.config.cpusPerRun <= usable.length; i += this.config.cpusPerRun) {
+      this.slots.push(cpuset.format(usable.slice(i, i + this.config.cpusPerRun)));
+    }
+    this.shared = cpuset.format(hostCpus.filter(cpu => !usable.includes(cpu)));
+    this.pinning = { available: true, reason: null };
+    this.queue.config.maxConcurrent = this.slots.length;
+    logger.info(`Benchmark slots on CPUs ${this.slots.join(' ')}, other containers on ${this.shared}`);
+  }
+
+  /**
+   * CpusetCpus for a container that isn't a benchmark, null when nothing is reserved
+   */
+  sharedCpuset() {
+    return this.pinning.available ? this.shared : null;
+  }
+
+  /**
+   * Refuse new benchmarks and cancel the waiting ones (shutdown)
+   */
+  drain() {
+    this.queue.drain();
+  }
+
+  /**
+   * @param {Object} submission - { language, code, filename, stdin, trials }
+   * @param {Object} options - { compileTimeoutMs, runTimeoutMs, signal, onQueued(position), onTrial(trial) }
+   * @returns {Object|null} The report, or null if `signal` aborted it before it started
+   */
+  async run(userId, { language, code, filename = 'main', stdin = null, trials = this.config.defaultTrials }, options = {}) {
+    if (!runtimeRegistry.has(language)) {
+      throw new ExecError('invalid_request', 'RUNTIME_NOT_FOUND', `Unsupported language: ${language}`, { param: 'language' });
+    }
+    if (!Number.isInteger(trials) || trials < 1 || trials > this.config.maxTrials) {
+      throw new ExecError('invalid_request', 'INVALID_INPUT', `trials must be between 1 and ${this.config.maxTrials}`, { param: 'trials' });
+    }
+
+    const { signal = null, onQueued = () => {}, onTrial = () => {} } = options;
+    const limits = runtimeRegistry.resolveTimeouts(language, {
+      compileTimeoutMs: options.compileTimeoutMs,
+      runTimeoutMs: options.runTimeoutMs
+    });
+
+    // QUEUE_FULL (429) goes back to the caller
+    const ticket = this.queue.enqueue(userId, {
+      onPosition: onQueued,
+      timeoutMs: limits.compileTimeoutMs + trials * limits.runTimeoutMs + 60 * 1000
+    });
+    let waitedTooLong = false;
+    const waitTimer = setTimeout(() => {
+      if (ticket.state === 'waiting') {
+        waitedTooLong = true;
+        ticket.cancel();
+      }
+    }, this.config.maxWaitMs);
+    if (signal) {
+      signal.addEventListener('abort', () => {
+        if (ticket.state === 'waiting') {
+          ticket.cancel();
+        }
+      }, { once: true });
+    }
+
+    await ticket.ready;
+    clearTimeout(waitTimer);
+    if (ticket.state === 'cancelled') {
+      if (waitedTooLong) {
+        throw new ExecError('rate_limited', 'QUEUE_TIMEOUT', `No benchmark slot became free within ${Math.round(this.config.maxWaitMs / 1000)}s, try again later`, {
+          retryAfter: this.config.retryAfterSeconds
+        });
+      }
+      if (this.queue.draining) {
+        throw this.queue.shuttingDownError();
+      }
+      return null;
+    }
+
+    const slot = this.pinning.available ? this.slots.shift() : null;
+    let containerId = null;
+    try {
+      // A pinned run gets all of its CPUs rather than the default quota
+      const hostLimits = resourceLimits.resolve();
+      if (slot) {
+        hostLimits.cpuQuota = hostLimits.cpuPeriod * cpuset.parse(slot).length;
+      }
+      ({ containerId } = await dockerService.createContainer(language, 'benchmark', userId, { limits: hostLimits, cpusetCpus: slot, fresh: true }));
+
+      const report = await this.measure(containerId, { language, code, filename, stdin, trials }, limits, { signal, onTrial });
+      report.pinning = slot
+        ? { pinned: true, cpus: slot, reason: null }
+        : { pinned: false, cpus: null, reason: this.pinning.reason };
+      report.queue_wait_ms = ticket.startedAt - ticket.enqueuedAt;
+
+      logger.info(`Benchmarked ${report.trials.length} trials for user ${userId}: ${report.status}`, {
+        runtime: language,
+        pinned: Boolean(slot),
+        wallMedianMs: report.stats ? report.stats.wall_ms.median : null
+      });
+      return report;
+    } finally {
+      if (slot) {
+        this.slots.push(slot);
+      }
+      ticket.release();
+      if (containerId) {
+        dockerService.stopContainer(containerId, { force: true }).catch(error =>
+          logger.warn(`Failed to remove benchmark container ${containerId}:`, error.message)
+        );
+      }
+    }
+  }
+
+  /**
+   * Compile once, then run the trials one after another. A trial that times
+   * out or exits non-zero ends the benchmark; the stats cover the trials
+   * that completed.
+   */
+  async measure(containerId, { language, code, filename, stdin, trials }, limits, { signal, onTrial }) {
+    const containerInfo = dockerService.containers.get(containerId);
+    const codeFile = dockerService.getCodeFilename(filename, language);
+    await dockerService.writeFileToContainer(containerInfo.container, codeFile, code);
+
+    const phases = runtimeRegistry.getPhases(language, codeFile);
+    const compile = await judgeService.compile(containerId, language, codeFile, code, phases.compile, limits.compileTimeoutMs);
+    const report = {
+      status: 'completed',
+      trials_requested: trials,
+      trials: [],
+      stats: null,
+      compile: compile ? compile.report : null,
+      run_timeout_ms: limits.runTimeoutMs,
+      stdout: null,
+      stderr: null
+    };
+    if (compile && !compile.ok) {
+      report.status = 'compile_error';
+      return report;
+    }
+
+    for (let index = 0; index < trials && !(signal && signal.aborted); index++) {
+      const { trial, stdout, stderr } = await this.runTrial(containerId, phases.run, stdin, limits.runTimeoutMs);
+      trial.index = index;
+      report.trials.push(trial);
+      onTrial(trial);
+
+      if (index === 0 || trial.exit_code !== 0) {
+        report.stdout = truncate(stdout, this.config.outputLimitBytes).text;
+        report.stderr = truncate(stderr, this.config.outputLimitBytes).text;
+      }
+      if (trial.timed_out) {
+        report.status = 'timeout';
+        break;
+      }
+      if (trial.exit_code !== 0) {
+        report.status = 'runtime_error';
+        break;
+      }
+    }
+
+    const completed = report.trials.filter(trial => !trial.timed_out && trial.exit_code === 0);
+    if (completed.length > 0) {
+      const stat = (field) => summarize(completed.map(trial => trial[field]).filter(value => value !== null));
+      report.stats = { wall_ms: stat('wall_ms'), user_ms: stat('user_ms'), sys_ms: stat('sys_ms') };
+    }
+    return report;
+  }
+
+  /**
+   * One run of the program under a shell that reports its CPU time with
+   * `times` on stderr, after a marker the program can't predict
+   * @returns {Object} { trial: { wall_ms, user_ms, sys_ms, exit_code, timed_out }, stdout, stderr }
+   */
+  async runTrial(containerId, argv, stdin, timeoutMs) {
+    const marker = `__studio_times_${crypto.randomBytes(8).toString('hex')}__`;
+    const result = await dockerService.runBufferedExec(containerId, [
+      'sh', '-c', `"$@"; status=$?; echo ${marker} >&2; times >&2; exit $status`, 'sh', ...argv
+    ], { stdin: stdin || '', timeoutMs, phase: 'benchmark' });
+
+    const trial = { wall_ms: result.durationMs, user_ms: null, sys_ms: null, exit_code: result.exitCode, timed_out: result.timedOut };
+    if (result.timedOut) {
+      // Only the program dies; the container stays for cleanup
+      await dockerService.signalProcesses(containerId, 'KILL').catch(error =>
+        logger.error(`Failed to kill timed out benchmark trial in container ${containerId}:`, error)
+      );
+      return { trial, stdout: result.stdout, stderr: result.stderr };
+    }
+
+    const markerAt = result.stderr.lastIndexOf(marker);
+    if (markerAt === -1) {
+      return { trial, stdout: result.stdout, stderr: result.stderr };
+    }
+    const times = TIMES_PATTERN.exec(result.stderr.slice(markerAt).split('\n').slice(2).join('\n'));
+    if (times) {
+      trial.user_ms = round((parseInt(times[1], 10) * 60 + parseFloat(times[2])) * 1000);
+      trial.sys_ms = round((parseInt(times[3], 10) * 60 + parseFloat(times[4])) * 1000);
+    }
+    return { trial, stdout: result.stdout, stderr: result.stderr.slice(0, markerAt).replace(/\n$/, '') };
+  }
+}
+
+module.exports = new BenchmarkService();
+module.exports.BenchmarkService = BenchmarkService;
+module.exports.summarize = summarize;
\ No newline at end of file
@@ -0,0 +1,230 @@
+const crypto = require('crypto');
+const path = require('path');
+const fs = require('fs').promises;
+const config = require('../config');
+const logger = require('../utils/logger');
+
+/**
+ * Compiled binaries of single-file builds, so re-running identical code skips
+ * the compile phase. Entries live at <basePath>/<runtime>/<key> and are
+ * shared by every user, which is why they are only ever built in a container
+ * no program has run in (see dockerService.compileForCache). The key covers
+ * the source, the entry file name, the compile command and the image ID the
+ * container runs, so a different toolchain, even one pushed under the same
+ * tag, never matches an old binary. Least recently used entries are evicted
+ * once the cache grows past maxBytes.
+ */
+class BuildCache {
+  constructor() {
+    this.config = { ...config.buildCache };
+    this.index = null; // "runtime/key" -> { runtime, size }, least recently used first
+    this.loading = null;
+    this.totalBytes = 0;
+    this.stats = {
+      hits: 0,
+      misses: 0,
+      stores: 0,
+      evictions: 0
+    };
+  }
+
+  isEnabled(runtime) {
+    return this.config.enabled && Boolean(runtime && runtime.buildCache);
+  }
+
+  /**
+   * Line endings and trailing whitespace at the end of the file don't change
+   * what compiles (Go drops carriage returns even from raw strings)
+   */
+  normalizeSource(code) {
+    return code.replace(/\r\n/g, '\n').replace(/\s+$/, '');
+  }
+
+  /**
+   * @param {string} imageId ID (digest) of the image the build runs in
+   */
+  getKey(runtime, filename, code, imageId) {
+    return crypto.createHash('sha256')
+      .update([
+        runtime.name,
+        runtime.image,
+        imageId,
+        runtime.version,
+        JSON.stringify(runtime.compile),
+        filename,
+        this.normalizeSource(code)
+      ].join('\0'))
+      .digest('hex');
+  }
+
+  getEntryPath(runtimeName, key) {
+    return path.join(path.resolve(this.config.basePath), runtimeName, key);
+  }
+
+  /**
+   * Rebuild the index from disk once, oldest modification first (hits touch
+   * their file, so mtime is last use)
+   */
+  async load() {
+    if (this.index) {
+      return;
+    }
+    if (!this.loading) {
+      this.loading = this.scan().then(entries => {
+        this.index = new Map();
+        this.totalBytes = 0;
+        for (const entry of entries.sort((a, b) => a.lastUsed - b.lastUsed)) {
+          this.index.set(`${entry.runtime}/${entry.key}`, { runtime: entry.runtime, size: entry.size });
+          this.totalBytes += entry.size;
+        }
+      }).finally(() => {
+        this.loading = null;
+      });
+    }
+    await this.loading;
+  }
+
+  async scan() {
+    const root = path.resolve(this.config.basePath);
+    const entries = [];
+
+    let runtimes;
+    try {
+      runtimes = await fs.readdir(root, { withFileTypes: true });
+    } catch (error) {
+      if (error.code === 'ENOENT') {
+        return entries;
+      }
+      throw error;
+    }
+
+    for (const dirent of runtimes.filter(entry => entry.isDirectory())) {
+      for (const key of await fs.readdir(path.join(root, dirent.name))) {
+        if (!/^[0-9a-f]{64}$/.test(key)) {
+          continue; // half-written temp files
+        }
+        const stats = await fs.stat(path.join(root, dirent.name, key));
+        entries.push({ runtime: dirent.name, key, size: stats.size, lastUsed: stats.mtimeMs });
+      }
+    }
+
+    return entries;
+  }
+
+  /**
+   * @returns {Buffer|null} The cached artifact, or null on a miss
+   */
+  async get(runtimeName, key) {
+    await this.load();
+
+    const id = `${runtimeName}/${key}`;
+    const entry = this.index.get(id);
+    if (!entry) {
+      this.stats.misses++;
+      return null;
+    }
+
+    const file = this.getEntryPath(runtimeName, key);
+    let artifact;
+    try {
+      artifact = await fs.readFile(file);
+    } catch (error) {
+      // Removed behind our back (or by an eviction racing us)
+      this.forget(id);
+      this.stats.misses++;
+      return null;
+    }
+
+    // Most recently used moves to the end
+    this.index.delete(id);
+    this.index.set(id, entry);
+    const now = new Date();
+    fs.utimes(file, now, now).catch(() => {});
+
+    this.stats.hits++;
+    return artifact;
+  }
+
+  /**
+   * Save an artifact, then evict down to maxBytes
+   * @returns {boolean} false if the artifact was too large to cache
+   */
+  async set(runtimeName, key, artifact) {
+    if (artifact.length > this.config.maxArtifactBytes) {
+      return false;
+    }
+    await this.load();
+
+    const file = this.getEntryPath(runtimeName, key);
+    const temporary = `${file}.${process.pid}.${crypto.randomBytes(4).toString('hex')}.tmp`;
+    await fs.mkdir(path.dirname(file), { recursive: true });
+    await fs.writeFile(temporary, artifact);
+    await fs.rename(temporary, file);
+
+    const id = `${runtimeName}/${key}`;
+    this.forget(id);
+    this.index.set(id, { runtime: runtimeName, size: artifact.length });
+    this.totalBytes += artifact.length;
+    this.stats.stores++;
+
+    await this.evict();
+    return true;
+  }
+
+  forget(id) {
+    const entry = this.index.get(id);
+    if (entry) {
+      this.index.delete(id);
+      this.totalBytes -= entry.size;
+    }
+  }
+
+  async evict(maxBytes = this.config.maxBytes) {
+    for (const [id, entry] of this.index.entries()) {
+      if (this.totalBytes <= maxBytes) {
+        break;
+      }
+
+      this.forget(id);
+      this.stats.evictions++;
+      await fs.rm(path.join(path.resolve(this.config.basePath), id), { force: true }).catch(error =>
+        logger.warn(`Failed to evict build cache entry ${id}:`, error.message)
+      );
+      logger.debug(`Evicted build cache entry ${id} (${entry.size} bytes)`);
+    }
+  }
+
+  /**
+   * Drop every entry of a runtime, e.g. after it switched to a new image.
+   * Keys already cover the image; this frees the space straight away.
+   */
+  async invalidate(runtimeName) {
+    await this.load();
+
+    let removed = 0;
+    for (const [id, entry] of Array.from(this.index.entries())) {
+      if (entry.runtime === runtimeName) {
+        this.forget(id);
+        removed++;
+      }
+    }
+    await fs.rm(path.join(path.resolve(this.config.basePath), runtimeName), { recursive: true, force: true });
+
+    if (removed > 0) {
+      logger.info(`Invalidated ${removed} cached ${runtimeName} builds`);
+    }
+    return removed;
+  }
+
+  getStats() {
+    return {
+      enabled: this.config.enabled,
+      entries: this.index ? this.index.size : 0,
+      sizeBytes: this.totalBytes,
+      maxBytes: this.config.maxBytes,
+      ...this.stats
+    };
+  }
+}
+
+module.exports = new BuildCache();
\ No newline at end of file
@@ -0,0 +1,234 @@
+const path = require('path');
+const fs = require('fs').promises;
+const config = require('../config');
+const logger = require('../utils/logger');
+
+// Directories whose name contains "@" (Go's module@version and module/@v) are
+// pruned as a whole; deleting single files from them leaves broken modules
+const ATOMIC_DIR = /@/;
+
+/**
+ * Shared dependency caches keyed by runtime name. Read-only caches live in
+ * host directories (<basePath>/<runtime>/<cache>) bind mounted into every
+ * sandbox of that runtime; a maintenance job keeps each one under maxBytes
+ * by removing the least recently used entries.
+ */
+class CacheVolumeManager {
+  constructor() {
+    this.config = { ...config.cacheVolumes };
+    this.pruneInterval = null;
+    this.stats = {
+      prunes: 0,
+      removedEntries: 0,
+      removedBytes: 0,
+      lastPrune: null
+    };
+  }
+
+  getVolumePath(runtime, cacheName) {
+    return path.join(path.resolve(this.config.basePath), runtime, cacheName);
+  }
+
+  getHostVolumePath(runtime, cacheName) {
+    const hostBase = this.config.hostBasePath || path.resolve(this.config.basePath);
+    return path.join(hostBase, runtime, cacheName);
+  }
+
+  /**
+   * Mounts and environment for a runtime's caches, merged into the
+   * container config by the docker service
+   * @param {Object} runtime - Runtime definition from the registry
+   * @returns {Object} { binds, tmpfs, env }
+   */
+  async getContainerConfig(runtime) {
+    const result = { binds: [], tmpfs: {}, env: [] };
+    if (!this.config.enabled || !runtime || runtime.caches.length === 0) {
+      return result;
+    }
+
+    for (const cache of runtime.caches) {
+      if (cache.mode === 'ro') {
+        await fs.mkdir(this.getVolumePath(runtime.name, cache.name), { recursive: true });
+        result.binds.push(`${this.getHostVolumePath(runtime.name, cache.name)}:${cache.mountPath}:ro`);
+      } else {
+        result.tmpfs[cache.mountPath] = `rw,nosuid,nodev,size=${cache.size}`;
+      }
+      result.env.push(`${cache.env}=${cache.mountPath}`);
+    }
+
+    return result;
+  }
+
+  /**
+   * Collect prunable entries under a cache directory. Files are entries of
+   * their own, atomic directories count as one entry with their newest atime.
+   */
+  async collectEntries(root) {
+    const entries = [];
+
+    const walk = async (dir) => {
+      let dirents;
+      try {
+        dirents = await fs.readdir(dir, { withFileTypes: true });
+      } catch (error) {
+        if (error.code === 'ENOENT') {
+          return;
+        }
+        throw error;
+      }
+
+      for (const dirent of dirents) {
+        const fullPath = path.join(dir, dirent.name);
+
+        if (dirent.isDirectory()) {
+          if (ATOMIC_DIR.test(dirent.name)) {
+            entries.push({ path: fullPath, ...(await this.measure(fullPath)) });
+          } else {
+            await walk(fullPath);
+          }
+        } else if (dirent.isFile()) {
+          const stats = await fs.stat(fullPath);
+          entries.push({ path: fullPath, size: stats.size, lastUsed: Math.max(stats.atimeMs, stats.mtimeMs) });
+        }
+      }
+    };
+
+    await walk(root);
+    return entries;
+  }
+
+  /**
+   * Total size and newest access time of a directory tree
+   */
+  async measure(dir) {
+    let size = 0;
+    let lastUsed = 0;
+
+    for (const dirent of await fs.readdir(dir, { withFileTypes: true })) {
+      const fullPath = path.join(dir, dirent.name);
+      if (dirent.isDirectory()) {
+        const nested = await this.measure(fullPath);
+        size += nested.size;
+        lastUsed = Math.max(lastUsed, nested.lastUsed);
+      } else if (dirent.isFile()) {
+        const stats = await fs.stat(fullPath);
+        size += stats.size;
+        lastUsed = Math.max(lastUsed, stats.atimeMs, stats.mtimeMs);
+      }
+    }
+
+    return { size, lastUsed };
+  }
+
+  /**
+   * Remove least recently used entries until the cache fits in maxBytes
+   * @returns {Object} { sizeBytes, removedEntries, removedBytes }
+   */
+  async prune(runtime, cacheName, maxBytes = this.config.maxBytes) {
+    const root = this.getVolumePath(runtime, cacheName);
+    const entries = await this.collectEntries(root);
+
+    let sizeBytes = entries.reduce((total, entry) => total + entry.size, 0);
+    let removedEntries = 0;
+    let removedBytes = 0;
+
+    entries.sort((a, b) => a.lastUsed - b.lastUsed);
+
+    for (const entry of entries) {
+      if (sizeBytes <= maxBytes) {
+        break;
+      }
+
+      try {
+        await this.remove(entry.path);
+        sizeBytes -= entry.size;
+        removedBytes += entry.size;
+        removedEntries++;
+      } catch (error) {
+        logger.warn(`Failed to prune cache entry ${entry.path}:`, error.message);
+      }
+    }
+
+    if (removedEntries > 0) {
+      logger.info(`Pruned ${removedEntries} entries (${removedBytes} bytes) from ${runtime}/${cacheName} cache`);
+    }
+
+    return { sizeBytes, removedEntries, removedBytes };
+  }
+
+  /**
+   * Go marks module cache directories read-only, so make the tree writable first
+   */
+  async remove(target) {
+    const makeWritable = async (entry) => {
+      const stats = await fs.lstat(entry);
+      if (stats.isDirectory()) {
+        await fs.chmod(entry, 0o755);
+        for (const name of await fs.readdir(entry)) {
+          await makeWritable(path.join(entry, name));
+        }
+      }
+    };
+
+    await fs.chmod(path.dirname(target), 0o755).catch(() => {});
+    await makeWritable(target);
+    await fs.rm(target, { recursive: true, force: true });
+  }
+
+  /**
+   * Prune every read-only cache of the given runtimes
+   */
+  async pruneAll(runtimes) {
+    const results = {};
+
+    for (const runtime of runtimes) {
+      for (const cache of runtime.caches.filter(entry => entry.mode === 'ro')) {
+        try {
+          const result = await this.prune(runtime.name, cache.name);
+          results[`${runtime.name}/${cache.name}`] = result;
+          this.stats.removedEntries += result.removedEntries;
+          this.stats.removedBytes += result.removedBytes;
+        } catch (error) {
+          logger.error(`Cache prune failed for ${runtime.name}/${cache.name}:`, error);
+        }
+      }
+    }
+
+    this.stats.prunes++;
+    this.stats.lastPrune = new Date();
+    return results;
+  }
+
+  /**
+   * Start the periodic prune job
+   * @param {Function} getRuntimes - Returns the current runtime definitions
+   */
+  start(getRuntimes) {
+    if (!this.config.enabled) {
+      return;
+    }
+
+    this.stop();
+
+    this.pruneInterval = setInterval(() => {
+      this.pruneAll(getRuntimes()).catch(error => logger.error('Cache volume prune failed:', error));
+    }, this.config.pruneIntervalMs);
+
+    if (this.pruneInterval.unref) {
+      this.pruneInterval.unref();
+    }
+  }
+
+  stop() {
+    if (this.pruneInterval) {
+      clearInterval(this.pruneInterval);
+      this.pruneInterval = null;
+    }
+  }
+
+  getStats() {
+    return { enabled: this.config.enabled, maxBytes: this.config.maxBytes, ...this.stats };
+  }
+}
+
+module.exports = new CacheVolumeManager();
\ No newline at end of file
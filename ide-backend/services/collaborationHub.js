@@ -0,0 +1,438 @@
+const crypto = require('crypto');
+const mongoose = require('mongoose');
+const config = require('../config');
+const logger = require('../utils/logger');
+const fileSystem = require('../utils/fileSystem');
+const textOperations = require('../utils/textOperations');
+
+/**
+ * Operational-transform editing sessions over workspace files.
+ *
+ * One session per open file holds the canonical text and revision. Clients
+ * send operations (utils/textOperations) against the revision they last saw;
+ * the server transforms them past everything committed since, applies them
+ * in arrival order and broadcasts each with its new revision, so every
+ * participant applies the same sequence. A client transforms its own
+ * unacknowledged operations with `side: 'left'` against incoming ones to
+ * match the server's tie-breaking.
+ *
+ * Socket events (client -> server):
+ *   collab:join      { workspaceId, filePath, sessionId?, revision? }
+ *   collab:op        { documentId, revision, ops, opId? }
+ *   collab:presence  { documentId, revision?, cursor, selection }
+ *   collab:leave     { documentId }
+ *
+ * Server -> client:
+ *   collab:snapshot      full text; sent on join and whenever a client's revision can't be transformed
+ *   collab:joined        reconnect within the retained history: the operations missed since `revision`
+ *   collab:ack           { documentId, revision, opId } for the sender's own operation
+ *   collab:op            { documentId, revision, ops, userId, opId } for everyone else
+ *   collab:presence      { documentId, socketId, userId, cursor, selection }
+ *   collab:participants  { documentId, participants }
+ *   collab:error         { documentId, code, message, opId }
+ *
+ * The merged text is written to the workspace file every flushIntervalMs
+ * while it has unsaved changes, and when the last participant leaves.
+ */
+class CollaborationHub {
+  constructor() {
+    this.config = { ...config.collaboration };
+    this.io = null;
+    this.sessions = new Map(); // documentId -> session
+    this.opening = new Map(); // documentId -> Promise<session> while the file is read
+  }
+
+  initialize(io) {
+    this.io = io;
+  }
+
+  getDocumentId(workspaceId, filePath) {
+    return `${workspaceId}:${filePath}`;
+  }
+
+  getRoom(documentId) {
+    return `collab:${documentId}`;
+  }
+
+  /**
+   * Read and write access of a user to a workspace
+   * @returns {Object} { read, write }
+   */
+  async authorize(userId, workspaceId) {
+    if (!mongoose.Types.ObjectId.isValid(workspaceId)) {
+      return { read: false, write: false };
+    }
+
+    const Workspace = require('../models/Workspace');
+    const workspace = await Workspace.findById(workspaceId);
+    if (!workspace) {
+      return { read: false, write: false };
+    }
+
+    return {
+      read: workspace.hasPermission(userId, 'read'),
+      write: workspace.hasPermission(userId, 'write')
+    };
+  }
+
+  /**
+   * The live session for a file, loading it from the workspace on first use
+   */
+  async openSession(workspaceId, filePath) {
+    const documentId = this.getDocumentId(workspaceId, filePath);
+
+    if (this.sessions.has(documentId)) {
+      return this.sessions.get(documentId);
+    }
+    if (this.opening.has(documentId)) {
+      return this.opening.get(documentId);
+    }
+
+    const opening = (async () => {
+      let content = '';
+      try {
+        content = await fileSystem.readFile(workspaceId, filePath);
+      } catch (error) {
+        // A file that doesn't exist yet is created by the first flush
+        if (error.message !== 'File not found') {
+          throw error;
+        }
+      }
+
+      const session = {
+        id: crypto.randomUUID(), // revisions restart with every session
+        documentId,
+        workspaceId,
+        filePath,
+        content,
+        revision: 0,
+        history: [], // [{ revision, ops, userId, opId }] for the last historyLimit revisions
+        participants: new Map(), // socketId -> participant
+        dirty: false,
+        flushing: null,
+        flushTimer: null
+      };
+
+      session.flushTimer = setInterval(() => this.flush(session), this.config.flushIntervalMs);
+      session.flushTimer.unref();
+
+      this.sessions.set(documentId, session);
+      logger.info(`Opened collaboration session for ${documentId}`, { sessionId: session.id });
+      return session;
+    })();
+
+    this.opening.set(documentId, opening);
+    try {
+      return await opening;
+    } finally {
+      this.opening.delete(documentId);
+    }
+  }
+
+  // Oldest revision an incoming operation can still be transformed from
+  getFloor(session) {
+    return session.revision - session.history.length;
+  }
+
+  getParticipants(session) {
+    return Array.from(session.participants.values()).map(({ socketId, userId, name, canWrite, cursor, selection }) => ({
+      socketId, userId, name, canWrite, cursor, selection
+    }));
+  }
+
+  sendSnapshot(socket, session, reason) {
+    socket.emit('collab:snapshot', {
+      documentId: session.documentId,
+      sessionId: session.id,
+      revision: session.revision,
+      content: session.content,
+      participants: this.getParticipants(session),
+      canWrite: session.participants.get(socket.id).canWrite,
+      reason
+    });
+  }
+
+  sendError(socket, documentId, code, message, opId = null) {
+    socket.emit('collab:error', { documentId, code, message, opId });
+  }
+
+  /**
+   * Join a file's session. A client that was already in this session and
+   * still holds a revision inside the retained history gets just the
+   * operations it missed; anyone else gets a snapshot.
+   */
+  async handleJoin(socket, data = {}) {
+    const { workspaceId, filePath, sessionId, revision } = data;
+
+    if (!workspaceId || !filePath) {
+      this.sendError(socket, null, 'INVALID_REQUEST', 'workspaceId and filePath are required');
+      return;
+    }
+
+    let session;
+    try {
+      fileSystem.validateFilePath(filePath);
+
+      const access = await this.authorize(socket.userId, workspaceId);
+      if (!access.read) {
+        this.sendError(socket, null, 'ACCESS_DENIED', 'Access denied to this workspace');
+        return;
+      }
+
+      session = await this.openSession(workspaceId, filePath);
+      session.participants.set(socket.id, {
+        socketId: socket.id,
+        userId: socket.userId,
+        name: socket.user ? socket.user.name : null,
+        canWrite: access.write,
+        cursor: null,
+        selection: null
+      });
+    } catch (error) {
+      logger.error(`Failed to join collaboration session for ${workspaceId}:${filePath}:`, error);
+      this.sendError(socket, null, 'JOIN_FAILED', error.message);
+      return;
+    }
+
+    const room = this.getRoom(session.documentId);
+    socket.join(room);
+
+    const canCatchUp = sessionId === session.id && Number.isInteger(revision) &&
+      revision >= this.getFloor(session) && revision <= session.revision;
+
+    if (canCatchUp) {
+      socket.emit('collab:joined', {
+        documentId: session.documentId,
+        sessionId: session.id,
+        revision: session.revision,
+        missed: session.history.filter(entry => entry.revision > revision),
+        participants: this.getParticipants(session),
+        canWrite: session.participants.get(socket.id).canWrite
+      });
+    } else {
+      this.sendSnapshot(socket, session, sessionId ? 'resync' : 'join');
+    }
+
+    socket.to(room).emit('collab:participants', {
+      documentId: session.documentId,
+      participants: this.getParticipants(session)
+    });
+
+    logger.debug(`Socket ${socket.id} joined collaboration session ${session.documentId}`, {
+      userId: socket.userId,
+      revision: session.revision,
+      caughtUp: canCatchUp
+    });
+  }
+
+  /**
+   * Commit an operation made against `revision`. Revisions outside the
+   * retained history and operations that don't fit the text both mean the
+   * client has diverged: it is sent a snapshot instead of the op being applied.
+   */
+  handleOp(socket, data = {}) {
+    const { documentId, revision, ops, opId = null } = data;
+    const session = this.sessions.get(documentId);
+    const participant = session && session.participants.get(socket.id);
+
+    if (!participant) {
+      this.sendError(socket, documentId, 'NOT_JOINED', 'Join the document before editing it', opId);
+      return;
+    }
+    if (!participant.canWrite) {
+      this.sendError(socket, documentId, 'READ_ONLY', 'Write access is required to edit this document', opId);
+      return;
+    }
+
+    const floor = this.getFloor(session);
+    if (!Number.isInteger(revision) || revision < floor || revision > session.revision) {
+      this.sendError(socket, documentId, 'STALE_REVISION', `Revision ${revision} cannot be transformed (have ${floor}-${session.revision})`, opId);
+      this.sendSnapshot(socket, session, 'stale_revision');
+      return;
+    }
+
+    let transformed;
+    let content;
+    try {
+      transformed = session.history
+        .slice(revision - floor)
+        .reduce((current, entry) => textOperations.transform(current, entry.ops, 'right'),
+          textOperations.normalize(ops, this.config.maxOpComponents));
+      content = textOperations.apply(session.content, transformed);
+    } catch (error) {
+      if (error.code !== 'INVALID_OPERATION') {
+        throw error;
+      }
+      this.sendError(socket, documentId, 'INVALID_OPERATION', error.message, opId);
+      this.sendSnapshot(socket, session, 'invalid_operation');
+      return;
+    }
+
+    if (Buffer.byteLength(content, 'utf8') > fileSystem.maxFileSize) {
+      this.sendError(socket, documentId, 'DOCUMENT_TOO_LARGE', `Document would exceed ${fileSystem.maxFileSize} bytes`, opId);
+      this.sendSnapshot(socket, session, 'rejected');
+      return;
+    }
+
+    session.content = content;
+    session.revision += 1;
+    session.dirty = true;
+    session.history.push({ revision: session.revision, ops: transformed, userId: participant.userId, opId });
+    if (session.history.length > this.config.historyLimit) {
+      session.history.shift();
+    }
+
+    // Keep everyone's cursor on the same text it was next to
+    for (const other of session.participants.values()) {
+      if (typeof other.cursor === 'number') {
+        other.cursor = textOperations.transformPosition(other.cursor, transformed);
+      }
+      if (other.selection) {
+        other.selection = {
+          start: textOperations.transformPosition(other.selection.start, transformed),
+          end: textOperations.transformPosition(other.selection.end, transformed)
+        };
+      }
+    }
+
+    socket.emit('collab:ack', { documentId, revision: session.revision, opId });
+    socket.to(this.getRoom(documentId)).emit('collab:op', {
+      documentId,
+      revision: session.revision,
+      ops: transformed,
+      userId: participant.userId,
+      opId
+    });
+  }
+
+  /**
+   * Cursor and selection of a participant. Positions sent with an older
+   * revision are moved forward through the history first.
+   */
+  handlePresence(socket, data = {}) {
+    const { documentId, revision } = data;
+    const session = this.sessions.get(documentId);
+    const participant = session && session.participants.get(socket.id);
+
+    if (!participant) {
+      this.sendError(socket, documentId, 'NOT_JOINED', 'Join the document before sending presence');
+      return;
+    }
+
+    const floor = this.getFloor(session);
+    const missed = Number.isInteger(revision) && revision >= floor && revision < session.revision
+      ? session.history.slice(revision - floor)
+      : [];
+    const forward = (position) => missed.reduce(
+      (current, entry) => textOperations.transformPosition(current, entry.ops),
+      position
+    );
+    const isPosition = (value) => Number.isInteger(value) && value >= 0;
+
+    participant.cursor = isPosition(data.cursor) ? forward(data.cursor) : null;
+    participant.selection = data.selection && isPosition(data.selection.start) && isPosition(data.selection.end)
+      ? { start: forward(data.selection.start), end: forward(data.selection.end) }
+      : null;
+
+    socket.to(this.getRoom(documentId)).emit('collab:presence', {
+      documentId,
+      socketId: socket.id,
+      userId: participant.userId,
+      cursor: participant.cursor,
+      selection: participant.selection
+    });
+  }
+
+  async handleLeave(socket, data = {}) {
+    const session = this.sessions.get(data.documentId);
+    if (session && session.participants.has(socket.id)) {
+      await this.removeParticipant(socket, session);
+    }
+  }
+
+  async handleDisconnection(socket) {
+    const sessions = Array.from(this.sessions.values())
+      .filter(session => session.participants.has(socket.id));
+    await Promise.all(sessions.map(session => this.removeParticipant(socket, session)));
+  }
+
+  async removeParticipant(socket, session) {
+    const room = this.getRoom(session.documentId);
+    session.participants.delete(socket.id);
+    socket.leave(room);
+
+    if (session.participants.size > 0) {
+      socket.to(room).emit('collab:participants', {
+        documentId: session.documentId,
+        participants: this.getParticipants(session)
+      });
+      return;
+    }
+
+    await this.closeSession(session);
+  }
+
+  async closeSession(session) {
+    clearInterval(session.flushTimer);
+    this.sessions.delete(session.documentId);
+    await this.flush(session);
+    logger.info(`Closed collaboration session for ${session.documentId} at revision ${session.revision}`);
+  }
+
+  /**
+   * Write the merged text to the workspace file if it changed since the last flush
+   */
+  async flush(session) {
+    if (session.flushing) {
+      await session.flushing;
+    }
+    if (!session.dirty) {
+      return;
+    }
+
+    const { content, revision } = session;
+    session.dirty = false;
+    session.flushing = fileSystem.writeFile(session.workspaceId, session.filePath, content)
+      .then(() => {
+        logger.debug(`Flushed ${session.documentId} at revision ${revision}`);
+      })
+      .catch(error => {
+        // Keep the changes in memory and try again on the next tick
+        session.dirty = true;
+        logger.error(`Failed to flush collaboration session ${session.documentId}:`, error);
+        if (this.io) {
+          this.io.to(this.getRoom(session.documentId)).emit('collab:error', {
+            documentId: session.documentId,
+            code: 'FLUSH_FAILED',
+            message: error.message,
+            opId: null
+          });
+        }
+      })
+      .finally(() => {
+        session.flushing = null;
+      });
+
+    await session.flushing;
+  }
+
+  /**
+   * Flush the open documents of a workspace
+   * @returns {boolean} whether all of them are now saved
+   */
+  async flushWorkspace(workspaceId) {
+    const sessions = Array.from(this.sessions.values())
+      .filter(session => String(session.workspaceId) === String(workspaceId));
+    await Promise.all(sessions.map(session => this.flush(session)));
+    return sessions.every(session => !session.dirty);
+  }
+
+  /**
+   * Flush and close every session (server shutdown)
+   */
+  async shutdown() {
+    await Promise.all(Array.from(this.sessions.values()).map(session => this.closeSession(session)));
+  }
+}
+
+module.exports = new CollaborationHub();
\ No newline at end of file
@@ -0,0 +1,336 @@
+const os = require('os');
+const logger = require('../utils/logger');
+const auditService = require('./auditService');
+const dockerService = require('./dockerService');
+const containerPool = require('./containerPool');
+const resourceLimits = require('./resourceLimits');
+const runtimeRegistry = require('./runtimeRegistry');
+
+const { LIMIT_FIELDS } = resourceLimits;
+const TIMEOUT_FIELDS = ['compileTimeoutMs', 'runTimeoutMs'];
+const POOL_FIELDS = ['enabled', 'defaultSize', 'sizes', 'idleTtlMs'];
+
+// Docker rejects containers outside these
+const MIN_MEMORY_BYTES = 6 * 1024 * 1024;
+const MIN_CPU_QUOTA = 1000;
+const CPU_PERIOD_RANGE = [1000, 1000000];
+
+const configError = (errors) => {
+  const error = new Error(`Invalid configuration: ${errors.map(({ path, message }) => `${path} ${message}`).join('; ')}`);
+  error.code = 'INVALID_CONFIG';
+  error.errors = errors;
+  return error;
+};
+
+const isObject = (value) => value !== null && typeof value === 'object' && !Array.isArray(value);
+const isPositiveInteger = (value) => Number.isInteger(value) && value > 0;
+const has = (object, key) => Object.prototype.hasOwnProperty.call(object, key);
+
+const PLAN_PATTERN = /^[A-Za-z][A-Za-z0-9_-]{0,31}$/;
+
+const freeze = (value) => {
+  if (isObject(value)) {
+    Object.values(value).forEach(freeze);
+    Object.freeze(value);
+  }
+  return value;
+};
+
+/**
+ * Settings an admin can change while the backend runs: runtime timeouts,
+ * resource limits (defaults and plans) and warm pool sizes. They are held
+ * as one frozen snapshot that an update replaces whole, after validating
+ * every change against the others and the Docker host's capacity, so an
+ * invalid update changes nothing. Updates run one at a time.
+ *
+ * The runtime registry, resource limits and container pool pick up a new
+ * snapshot straight away. Executions resolve their limits and timeouts when
+ * they start, so only new ones see it. Changes last until the next restart.
+ */
+class ConfigManager {
+  constructor() {
+    this.current = null; // captured from the services on first use
+    this.pending = Promise.resolve();
+  }
+
+  /**
+   * The current settings:
+   * { runtimes: { <name>: { compileTimeoutMs, runTimeoutMs } },
+   *   resourceLimits: { defaults, plans }, containerPool: { enabled, defaultSize, sizes, idleTtlMs } }
+   */
+  get() {
+    if (!this.current) {
+      this.current = freeze(this.capture());
+    }
+    return this.current;
+  }
+
+  capture() {
+    const runtimes = {};
+    for (const name of runtimeRegistry.names()) {
+      const { compileTimeoutMs, runTimeoutMs } = runtimeRegistry.get(name);
+      runtimes[name] = { compileTimeoutMs, runTimeoutMs };
+    }
+
+    const { enabled, defaultSize, sizes, idleTtlMs } = containerPool.config;
+    return {
+      runtimes,
+      resourceLimits: {
+        defaults: { ...resourceLimits.defaults },
+        plans: JSON.parse(JSON.stringify(resourceLimits.plans))
+      },
+      containerPool: { enabled, defaultSize, sizes: { ...sizes }, idleTtlMs }
+    };
+  }
+
+  /**
+   * Validate and apply a partial update, e.g. { containerPool: { sizes: { python: 3 } } }.
+   * A plan or pool size set to null is removed.
+   * @param {Object} actor - { userId, ip, userAgent } for the audit log
+   * @returns {Object} { config, changes } where changes maps each changed
+   *   setting's path to { from, to }
+   */
+  update(changes, actor = {}) {
+    const run = this.pending.then(() => this.apply(changes, actor));
+    this.pending = run.catch(() => {});
+    return run;
+  }
+
+  async apply(changes, { userId, ip, userAgent } = {}) {
+    const previous = this.get();
+    const next = JSON.parse(JSON.stringify(previous));
+    const errors = [];
+
+    if (!isObject(changes)) {
+      throw configError([{ path: 'config', message: 'must be an object' }]);
+    }
+    for (const [section, value] of Object.entries(changes)) {
+      if (section === 'runtimes') {
+        this.mergeRuntimes(next.runtimes, value, errors);
+      } else if (section === 'resourceLimits') {
+        this.mergeResourceLimits(next.resourceLimits, value, errors);
+      } else if (section === 'containerPool') {
+        this.mergeContainerPool(next.containerPool, value, errors);
+      } else {
+        errors.push({ path: section, message: 'is not a configurable setting' });
+      }
+    }
+    if (errors.length === 0) {
+      await this.checkCapacity(next.resourceLimits, errors);
+    }
+    if (errors.length > 0) {
+      throw configError(errors);
+    }
+
+    const diff = this.diff(previous, next);
+    if (Object.keys(diff).length === 0) {
+      return { config: previous, changes: diff };
+    }
+
+    this.current = freeze(next);
+    await this.applyToServices(previous, next);
+
+    auditService.logConfigurationChange(userId, 'runtime', diff, { ip, userAgent });
+    logger.info('Runtime configuration changed', { userId, changes: Object.keys(diff) });
+
+    return { config: this.current, changes: diff };
+  }
+
+  mergeRuntimes(runtimes, value, errors) {
+    if (!isObject(value)) {
+      errors.push({ path: 'runtimes', message: 'must be an object' });
+      return;
+    }
+
+    for (const [name, timeouts] of Object.entries(value)) {
+      const path = `runtimes.${name}`;
+      if (!has(runtimes, name)) {
+        errors.push({ path, message: 'is not a registered runtime' });
+      } else if (!isObject(timeouts)) {
+        errors.push({ path, message: 'must be an object' });
+      } else {
+        for (const [field, timeout] of Object.entries(timeouts)) {
+          if (!TIMEOUT_FIELDS.includes(field)) {
+            errors.push({ path: `${path}.${field}`, message: 'is not a configurable setting' });
+          } else if (!isPositiveInteger(timeout)) {
+            errors.push({ path: `${path}.${field}`, message: 'must be a positive integer' });
+          } else {
+            runtimes[name][field] = timeout;
+          }
+        }
+      }
+    }
+  }
+
+  mergeLimits(limits, value, path, errors) {
+    if (!isObject(value)) {
+      errors.push({ path, message: 'must be an object' });
+      return;
+    }
+
+    for (const [field, limit] of Object.entries(value)) {
+      if (!LIMIT_FIELDS.includes(field)) {
+        errors.push({ path: `${path}.${field}`, message: 'is not a resource limit' });
+      } else if (!isPositiveInteger(limit)) {
+        errors.push({ path: `${path}.${field}`, message: 'must be a positive integer' });
+      } else {
+        limits[field] = limit;
+      }
+    }
+  }
+
+  mergeResourceLimits(current, value, errors) {
+    if (!isObject(value)) {
+      errors.push({ path: 'resourceLimits', message: 'must be an object' });
+      return;
+    }
+
+    for (const [key, entry] of Object.entries(value)) {
+      if (key === 'defaults') {
+        this.mergeLimits(current.defaults, entry, 'resourceLimits.defaults', errors);
+      } else if (key === 'plans' && isObject(entry)) {
+        for (const [plan, overrides] of Object.entries(entry)) {
+          if (!PLAN_PATTERN.test(plan)) {
+            errors.push({ path: `resourceLimits.plans.${plan}`, message: 'is not a valid plan name' });
+          } else if (overrides === null) {
+            delete current.plans[plan];
+          } else {
+            current.plans[plan] = has(current.plans, plan) ? current.plans[plan] : {};
+            this.mergeLimits(current.plans[plan], overrides, `resourceLimits.plans.${plan}`, errors);
+          }
+        }
+      } else if (key === 'plans') {
+        errors.push({ path: 'resourceLimits.plans', message: 'must be an object' });
+      } else {
+        errors.push({ path: `resourceLimits.${key}`, message: 'is not a configurable setting' });
+      }
+    }
+  }
+
+  mergeContainerPool(pool, value, errors) {
+    if (!isObject(value)) {
+      errors.push({ path: 'containerPool', message: 'must be an object' });
+      return;
+    }
+
+    for (const [field, setting] of Object.entries(value)) {
+      const path = `containerPool.${field}`;
+      if (!POOL_FIELDS.includes(field)) {
+        errors.push({ path, message: 'is not a configurable setting' });
+      } else if (field === 'enabled') {
+        if (typeof setting !== 'boolean') {
+          errors.push({ path, message: 'must be a boolean' });
+        } else {
+          pool.enabled = setting;
+        }
+      } else if (field === 'defaultSize') {
+        if (!Number.isInteger(setting) || setting < 0) {
+          errors.push({ path, message: 'must be an integer of 0 or more' });
+        } else {
+          pool.defaultSize = setting;
+        }
+      } else if (field === 'idleTtlMs') {
+        if (!isPositiveInteger(setting)) {
+          errors.push({ path, message: 'must be a positive integer' });
+        } else {
+          pool.idleTtlMs = setting;
+        }
+      } else if (!isObject(setting)) {
+        errors.push({ path, message: 'must be an object' });
+      } else {
+        for (const [runtime, size] of Object.entries(setting)) {
+          if (size === null) {
+            delete pool.sizes[runtime];
+          } else if (!runtimeRegistry.has(runtime)) {
+            errors.push({ path: `${path}.${runtime}`, message: 'is not a registered runtime' });
+          } else if (!Number.isInteger(size) || size < 0) {
+            errors.push({ path: `${path}.${runtime}`, message: 'must be an integer of 0 or more' });
+          } else {
+            pool.sizes[runtime] = size;
+          }
+        }
+      }
+    }
+  }
+
+  /**
+   * Memory and CPU of the machine containers run on: the Docker host when
+   * it answers, this one otherwise
+   */
+  async hostCapacity() {
+    if (dockerService.isAvailable) {
+      try {
+        const info = await dockerService.docker.info();
+        if (info.MemTotal > 0 && info.NCPU > 0) {
+          return { memoryBytes: info.MemTotal, cpus: info.NCPU };
+        }
+      } catch (error) {
+        logger.warn('Failed to read Docker host capacity, checking limits against this machine:', error.message);
+      }
+    }
+    return { memoryBytes: os.totalmem(), cpus: os.cpus().length };
+  }
+
+  /**
+   * Every plan's effective limits must fit one container on the host
+   */
+  async checkCapacity({ defaults, plans }, errors) {
+    const host = await this.hostCapacity();
+    const effective = [['resourceLimits.defaults', defaults]];
+    for (const [plan, overrides] of Object.entries(plans)) {
+      effective.push([`resourceLimits.plans.${plan}`, { ...defaults, ...overrides }]);
+    }
+
+    for (const [path, limits] of effective) {
+      if (limits.memoryBytes > host.memoryBytes) {
+        errors.push({ path: `${path}.memoryBytes`, message: `exceeds the host's ${host.memoryBytes} bytes of memory` });
+      } else if (limits.memoryBytes < MIN_MEMORY_BYTES) {
+        errors.push({ path: `${path}.memoryBytes`, message: `must be at least ${MIN_MEMORY_BYTES} bytes` });
+      }
+      if (limits.cpuPeriod < CPU_PERIOD_RANGE[0] || limits.cpuPeriod > CPU_PERIOD_RANGE[1]) {
+        errors.push({ path: `${path}.cpuPeriod`, message: `must be between ${CPU_PERIOD_RANGE[0]} and ${CPU_PERIOD_RANGE[1]}` });
+      } else if (limits.cpuQuota < MIN_CPU_QUOTA) {
+        errors.push({ path: `${path}.cpuQuota`, message: `must be at least ${MIN_CPU_QUOTA}` });
+      } else if (limits.cpuQuota / limits.cpuPeriod > host.cpus) {
+        errors.push({ path: `${path}.cpuQuota`, message: `allows more than the host's ${host.cpus} CPUs` });
+      }
+    }
+  }
+
+  /**
+   * Leaf settings that differ, by path
+   */
+  diff(before, after, path = '', changes = {}) {
+    const keys = new Set([...Object.keys(before || {}), ...Object.keys(after || {})]);
+    for (const key of keys) {
+      const from = before ? before[key] : undefined;
+      const to = after ? after[key] : undefined;
+      const keyPath = path ? `${path}.${key}` : key;
+      if (isObject(from) || isObject(to)) {
+        this.diff(isObject(from) ? from : null, isObject(to) ? to : null, keyPath, changes);
+      } else if (from !== to) {
+        changes[keyPath] = { from: from === undefined ? null : from, to: to === undefined ? null : to };
+      }
+    }
+    return changes;
+  }
+
+  async applyToServices(previous, next) {
+    for (const [name, timeouts] of Object.entries(next.runtimes)) {
+      if (TIMEOUT_FIELDS.some(field => timeouts[field] !== previous.runtimes[name][field])) {
+        runtimeRegistry.setTimeouts(name, timeouts);
+      }
+    }
+
+    resourceLimits.reconfigure(next.resourceLimits);
+    await containerPool.reconfigure({ ...next.containerPool, sizes: { ...next.containerPool.sizes } });
+
+    // Warm containers were created with the old default limits
+    if (LIMIT_FIELDS.some(field => next.resourceLimits.defaults[field] !== previous.resourceLimits.defaults[field])) {
+      await Promise.all(Array.from(containerPool.idle.keys()).map(runtime => containerPool.flush(runtime)));
+    }
+  }
+}
+
+module.exports = new ConfigManager();
+module.exports.ConfigManager = ConfigManager;
\ No newline at end of file
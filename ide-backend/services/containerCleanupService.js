@@ -42,6 +42,10 @@ class ContainerCleanupService {
       errors: 0
     };
     
+    // Set by dockerService, whose stopped-for-idleness workspace containers
+    // must survive until they're resumed or stopped for good
+    this.isHibernated = () => false;
+
     this.startCleanupScheduler();
   }
 
@@ -301,6 +305,11 @@ class ContainerCleanupService {
    * Clean up a specific container
    */
   async cleanupContainer(containerId, reason) {
+    if (reason !== 'forced' && this.isHibernated(containerId)) {
+      logger.debug(`Keeping hibernated container ${containerId} (${reason})`);
+      return;
+    }
+
     try {
       const container = this.docker.getContainer(containerId);
       const containerInfo = await container.inspect();
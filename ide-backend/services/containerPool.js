@@ -0,0 +1,372 @@
+const config = require('../config');
+const logger = require('../utils/logger');
+
+class ContainerPool {
+  constructor() {
+    this.config = { ...config.containerPool };
+    this.idle = new Map(); // runtime -> idle pool entries (oldest first)
+    this.leased = new Map(); // containerId -> entry handed out to an execution
+    this.warming = new Map(); // runtime -> number of containers currently being created
+    this.runtimes = [];
+    this.factory = null; // async (runtime, context) => { container, name }
+    this.destroyer = null; // async (container) => void
+    this.reapInterval = null;
+    this.isShuttingDown = false;
+
+    this.stats = {
+      hits: 0,
+      coldStarts: 0,
+      recycled: 0,
+      destroyed: 0,
+      reaped: 0,
+      warmFailures: 0,
+      hitLatencyMs: 0,
+      coldStartLatencyMs: 0
+    };
+  }
+
+  /**
+   * Initialize the pool with container factory/destroyer callbacks and pre-warm it
+   */
+  initialize({ create, destroy, runtimes = [] }) {
+    this.factory = create;
+    this.destroyer = destroy;
+    this.runtimes = runtimes;
+    this.isShuttingDown = false;
+
+    if (!this.config.enabled) {
+      logger.info('Container pool disabled, every execution will cold start a container');
+      return;
+    }
+
+    this.startReaper();
+
+    for (const runtime of this.runtimes) {
+      this.replenish(runtime);
+    }
+
+    logger.info('Container pool initialized', {
+      runtimes: this.runtimes.map(runtime => `${runtime}:${this.getTargetSize(runtime)}`)
+    });
+  }
+
+  /**
+   * Number of idle containers the pool keeps warm for a runtime
+   */
+  getTargetSize(runtime) {
+    if (!this.config.enabled) {
+      return 0;
+    }
+
+    if (Object.prototype.hasOwnProperty.call(this.config.sizes, runtime)) {
+      return this.config.sizes[runtime];
+    }
+
+    return this.config.defaultSize;
+  }
+
+  /**
+   * Acquire a container for an execution, preferring a warm one over a cold start.
+   * A container is removed from the idle list before it is returned, so it can
+   * never be handed to two executions at once.
+   */
+  async acquire(runtime, context = {}) {
+    if (!this.factory) {
+      throw new Error('Container pool is not initialized');
+    }
+
+    if (this.isShuttingDown) {
+      throw new Error('Container pool is shutting down');
+    }
+
+    const startedAt = Date.now();
+    const entry = this.takeIdle(runtime);
+
+    if (entry) {
+      entry.leasedAt = new Date();
+      this.leased.set(entry.id, entry);
+      this.stats.hits++;
+      this.stats.hitLatencyMs += Date.now() - startedAt;
+
+      logger.debug(`Container pool hit for ${runtime}: ${entry.id}`);
+      this.replenish(runtime);
+
+      return { container: entry.container, name: entry.name, pooled: true };
+    }
+
+    const { container, name } = await this.factory(runtime, context);
+    const now = new Date();
+
+    this.leased.set(container.id, {
+      id: container.id,
+      container,
+      name,
+      runtime,
+      createdAt: now,
+      leasedAt: now
+    });
+    this.stats.coldStarts++;
+    this.stats.coldStartLatencyMs += Date.now() - startedAt;
+
+    logger.debug(`Container pool miss for ${runtime}, cold started ${container.id}`);
+    this.replenish(runtime);
+
+    return { container, name, pooled: false };
+  }
+
+  /**
+   * Return a leased container. Dirty containers (user code ran in them) are
+   * destroyed; clean ones go back to the idle list if the pool has room.
+   */
+  async release(containerOrId, dirty = true) {
+    const containerId = typeof containerOrId === 'string' ? containerOrId : containerOrId && containerOrId.id;
+    const entry = this.leased.get(containerId);
+
+    if (!entry) {
+      logger.debug(`Ignoring release of untracked container ${containerId}`);
+      return false;
+    }
+
+    this.leased.delete(containerId);
+
+    const idle = this.idle.get(entry.runtime) || [];
+    const hasRoom = idle.length + this.getWarmingCount(entry.runtime) < this.getTargetSize(entry.runtime);
+
+    if (!dirty && hasRoom && !this.isShuttingDown) {
+      entry.idleSince = new Date();
+      delete entry.leasedAt;
+      idle.push(entry);
+      this.idle.set(entry.runtime, idle);
+      this.stats.recycled++;
+      return true;
+    }
+
+    await this.destroy(entry);
+    this.replenish(entry.runtime);
+    return true;
+  }
+
+  /**
+   * Whether the pool holds a container, idle or leased out
+   */
+  has(containerId) {
+    return this.leased.has(containerId)
+      || Array.from(this.idle.values()).some(idle => idle.some(entry => entry.id === containerId));
+  }
+
+  /**
+   * Whether a container is currently leased out by the pool
+   */
+  isLeased(containerId) {
+    return this.leased.has(containerId);
+  }
+
+  /**
+   * Create warm containers until the runtime reaches its target size
+   */
+  replenish(runtime) {
+    if (!this.factory || this.isShuttingDown) {
+      return;
+    }
+
+    const idleCount = (this.idle.get(runtime) || []).length;
+    const missing = this.getTargetSize(runtime) - idleCount - this.getWarmingCount(runtime);
+
+    for (let i = 0; i < missing; i++) {
+      this.warm(runtime);
+    }
+  }
+
+  /**
+   * Create a single warm container in the background
+   */
+  async warm(runtime) {
+    this.warming.set(runtime, this.getWarmingCount(runtime) + 1);
+
+    try {
+      const { container, name } = await this.factory(runtime, { workspaceId: 'pool', userId: 'pool' });
+      const now = new Date();
+      const entry = { id: container.id, container, name, runtime, createdAt: now, idleSince: now };
+
+      if (this.isShuttingDown) {
+        await this.destroy(entry);
+        return;
+      }
+
+      const idle = this.idle.get(runtime) || [];
+      idle.push(entry);
+      this.idle.set(runtime, idle);
+    } catch (error) {
+      this.stats.warmFailures++;
+      logger.warn(`Failed to warm ${runtime} container:`, error.message);
+    } finally {
+      this.warming.set(runtime, Math.max(0, this.getWarmingCount(runtime) - 1));
+    }
+  }
+
+  /**
+   * Take the most recently idled container for a runtime, skipping expired ones
+   */
+  takeIdle(runtime) {
+    const idle = this.idle.get(runtime);
+    if (!idle) {
+      return null;
+    }
+
+    while (idle.length > 0) {
+      const entry = idle.pop();
+      if (!this.isExpired(entry)) {
+        return entry;
+      }
+      this.stats.reaped++;
+      this.destroy(entry);
+    }
+
+    return null;
+  }
+
+  /**
+   * Replace a runtime's idle containers, e.g. after its image changed
+   */
+  async flush(runtime) {
+    const idle = this.idle.get(runtime) || [];
+    this.idle.set(runtime, []);
+
+    await Promise.allSettled(idle.map(entry => this.destroy(entry)));
+    if (idle.length > 0) {
+      logger.info(`Flushed ${idle.length} idle ${runtime} containers from the pool`);
+    }
+
+    this.replenish(runtime);
+    return idle.length;
+  }
+
+  /**
+   * Swap in new pool settings ({ enabled, defaultSize, sizes, idleTtlMs }).
+   * Runtimes over their new target size lose their oldest idle containers
+   * and the rest are topped up; leased containers are left alone.
+   * @returns {number} idle containers destroyed
+   */
+  async reconfigure(settings) {
+    this.config = { ...this.config, ...settings };
+    if (this.config.enabled && this.factory && !this.reapInterval && !this.isShuttingDown) {
+      this.startReaper();
+    }
+
+    const surplus = [];
+    for (const [runtime, idle] of this.idle.entries()) {
+      const excess = idle.length - this.getTargetSize(runtime);
+      if (excess > 0) {
+        surplus.push(...idle.splice(0, excess));
+      }
+    }
+    await Promise.allSettled(surplus.map(entry => this.destroy(entry)));
+
+    for (const runtime of this.runtimes) {
+      this.replenish(runtime);
+    }
+    return surplus.length;
+  }
+
+  /**
+   * Destroy idle containers that have outlived the idle TTL
+   */
+  async reapIdle() {
+    const expired = [];
+
+    for (const [runtime, idle] of this.idle.entries()) {
+      const fresh = idle.filter(entry => !this.isExpired(entry));
+      expired.push(...idle.filter(entry => this.isExpired(entry)));
+      this.idle.set(runtime, fresh);
+    }
+
+    if (expired.length === 0) {
+      return 0;
+    }
+
+    this.stats.reaped += expired.length;
+    await Promise.allSettled(expired.map(entry => this.destroy(entry)));
+    logger.info(`Reaped ${expired.length} idle pooled containers`);
+
+    return expired.length;
+  }
+
+  isExpired(entry) {
+    return Date.now() - entry.idleSince.getTime() > this.config.idleTtlMs;
+  }
+
+  getWarmingCount(runtime) {
+    return this.warming.get(runtime) || 0;
+  }
+
+  async destroy(entry) {
+    try {
+      await this.destroyer(entry.container);
+      this.stats.destroyed++;
+    } catch (error) {
+      logger.warn(`Failed to destroy pooled container ${entry.id}:`, error.message);
+    }
+  }
+
+  /**
+   * Start the idle TTL reaper
+   */
+  startReaper() {
+    if (this.reapInterval) {
+      clearInterval(this.reapInterval);
+    }
+
+    this.reapInterval = setInterval(() => {
+      this.reapIdle().catch(error => logger.error('Container pool reap failed:', error));
+    }, this.config.reapIntervalMs);
+  }
+
+  /**
+   * Stop the reaper and destroy all idle containers. Leased containers are
+   * left to their owners, who destroy them on release.
+   */
+  async shutdown() {
+    this.isShuttingDown = true;
+
+    if (this.reapInterval) {
+      clearInterval(this.reapInterval);
+      this.reapInterval = null;
+    }
+
+    const idle = Array.from(this.idle.values()).flat();
+    this.idle.clear();
+
+    await Promise.allSettled(idle.map(entry => this.destroy(entry)));
+    logger.info(`Container pool shut down, destroyed ${idle.length} idle containers`);
+  }
+
+  /**
+   * Get pool statistics, including hit rate and average acquire latency
+   */
+  getStats() {
+    const runtimes = {};
+    const names = new Set([...this.runtimes, ...this.idle.keys()]);
+
+    for (const runtime of names) {
+      runtimes[runtime] = {
+        target: this.getTargetSize(runtime),
+        idle: (this.idle.get(runtime) || []).length,
+        warming: this.getWarmingCount(runtime),
+        leased: Array.from(this.leased.values()).filter(entry => entry.runtime === runtime).length
+      };
+    }
+
+    const acquisitions = this.stats.hits + this.stats.coldStarts;
+
+    return {
+      enabled: this.config.enabled,
+      ...this.stats,
+      hitRate: acquisitions > 0 ? this.stats.hits / acquisitions : 0,
+      avgHitLatencyMs: this.stats.hits > 0 ? this.stats.hitLatencyMs / this.stats.hits : 0,
+      avgColdStartLatencyMs: this.stats.coldStarts > 0 ? this.stats.coldStartLatencyMs / this.stats.coldStarts : 0,
+      runtimes
+    };
+  }
+}
+
+module.exports = new ContainerPool();
\ No newline at end of file
@@ -1,21 +1,25 @@
 const logger = require('../utils/logger');
 const crypto = require('crypto');
+const config = require('../config');
+const resourceLimits = require('./resourceLimits');
 
 class ContainerSecurityService {
   constructor() {
+    const defaultLimits = resourceLimits.resolve();
+
     // Enhanced security configuration
     this.securityConfig = {
-      // Resource limits
+      // Resource limits (defaults; per-execution limits come from resourceLimits)
       resources: {
-        memory: 256 * 1024 * 1024, // 256MB (reduced from 512MB)
-        memorySwap: 256 * 1024 * 1024, // Same as memory (no additional swap)
-        cpuQuota: 25000, // 25% of CPU (reduced from 50%)
-        cpuPeriod: 100000,
+        memory: defaultLimits.memoryBytes, // 256MB
+        memorySwap: defaultLimits.memoryBytes, // Same as memory (no additional swap)
+        cpuQuota: defaultLimits.cpuQuota, // 0.5 CPU
+        cpuPeriod: defaultLimits.cpuPeriod,
         cpuShares: 512, // Lower priority
-        pidsLimit: 50, // Limit number of processes
+        pidsLimit: defaultLimits.pidsLimit, // Limit number of processes
         ulimits: [
           { Name: 'nofile', Soft: 1024, Hard: 1024 }, // File descriptors
-          { Name: 'nproc', Soft: 50, Hard: 50 }, // Process limit
+          { Name: 'nproc', Soft: defaultLimits.pidsLimit, Hard: defaultLimits.pidsLimit }, // Process limit
           { Name: 'fsize', Soft: 100 * 1024 * 1024, Hard: 100 * 1024 * 1024 } // File size 100MB
         ]
       },
@@ -43,10 +47,9 @@ class ContainerSecurityService {
         cgroupParent: ''
       },
       
-      // Filesystem restrictions
+      // Filesystem restrictions (/tmp and the build dir are sized per container, see getTmpfsMounts)
       filesystem: {
         tmpfs: {
-          '/tmp': 'rw,noexec,nosuid,nodev,size=50m',
           '/var/tmp': 'rw,noexec,nosuid,nodev,size=10m'
         },
         binds: [], // No host mounts
@@ -73,22 +76,34 @@ class ContainerSecurityService {
     this.startMonitoring();
   }
 
+  /**
+   * Scratch mounts for a read-only container: /tmp (noexec) and the build
+   * output directory, which has to allow exec for compiled programs. Sizes
+   * are a share of the memory limit because tmpfs usage is charged to it.
+   */
+  getTmpfsMounts(limits = resourceLimits.resolve()) {
+    const { buildDir, tmpPercent, buildPercent, minTmpfsBytes } = config.sandboxFilesystem;
+    const size = (percent) => Math.max(minTmpfsBytes, Math.floor(limits.memoryBytes * percent / 100));
+
+    return {
+      ...this.securityConfig.filesystem.tmpfs,
+      '/tmp': `rw,noexec,nosuid,nodev,size=${size(tmpPercent)}`,
+      [buildDir]: `rw,exec,nosuid,nodev,size=${size(buildPercent)}`
+    };
+  }
+
   /**
    * Get secure container configuration
    */
-  getSecureContainerConfig(language, workspaceId, userId) {
+  getSecureContainerConfig(language, workspaceId, userId, limits = resourceLimits.resolve()) {
     const containerName = this.generateSecureContainerName(language, workspaceId, userId);
     
     return {
       name: containerName,
       HostConfig: {
         // Resource limits
-        Memory: this.securityConfig.resources.memory,
-        MemorySwap: this.securityConfig.resources.memorySwap,
-        CpuQuota: this.securityConfig.resources.cpuQuota,
-        CpuPeriod: this.securityConfig.resources.cpuPeriod,
+        ...resourceLimits.toHostConfig(limits),
         CpuShares: this.securityConfig.resources.cpuShares,
-        PidsLimit: this.securityConfig.resources.pidsLimit,
         Ulimits: this.securityConfig.resources.ulimits,
         
         // Network isolation
@@ -105,7 +120,7 @@ class ContainerSecurityService {
         Privileged: this.securityConfig.security.privileged,
         
         // Filesystem
-        Tmpfs: this.securityConfig.filesystem.tmpfs,
+        Tmpfs: this.getTmpfsMounts(limits),
         Binds: this.securityConfig.filesystem.binds,
         VolumesFrom: this.securityConfig.filesystem.volumesFrom,
         
@@ -134,7 +149,8 @@ class ContainerSecurityService {
         'ide.language': language,
         'ide.created': new Date().toISOString(),
         'ide.security.level': 'high',
-        'ide.version': '1.0'
+        'ide.version': '1.0',
+        'studio.execution': 'true' // startup reconciliation removes these if no process owns them
       },
       
       // Working directory
@@ -0,0 +1,83 @@
+const Sandbox = require('./sandbox');
+
+// Required lazily: dockerService asks the sandbox registry for HostConfig
+// overrides while it creates containers
+const dockerService = () => require('./dockerService');
+
+/**
+ * Plain Docker containers on the daemon's default runtime (runc). Everything
+ * is delegated to dockerService, which also tracks the containers of every
+ * provider built on top of this one.
+ */
+class DockerSandbox extends Sandbox {
+  constructor(name = 'docker') {
+    super(name);
+  }
+
+  /**
+   * Provider-specific HostConfig fields merged into every container it creates
+   */
+  getHostConfig() {
+    return {};
+  }
+
+  isAvailable() {
+    return dockerService().isAvailable;
+  }
+
+  owns(containerId) {
+    const containerInfo = dockerService().containers.get(containerId);
+    return Boolean(containerInfo) && containerInfo.sandbox === this.name;
+  }
+
+  async create(language, workspaceId, userId, options = {}) {
+    return dockerService().createContainer(language, workspaceId, userId, options);
+  }
+
+  async inspect(containerId) {
+    return dockerService().getContainerInfo(containerId);
+  }
+
+  async copyFiles(containerId, files) {
+    const containerInfo = dockerService().containers.get(containerId);
+    if (!containerInfo) {
+      throw new Error('Container not found');
+    }
+    await dockerService().writeFilesToContainer(containerInfo.container, files);
+  }
+
+  async readFiles(containerId, matches, limits = {}) {
+    return dockerService().readWorkspaceFiles(containerId, matches, limits);
+  }
+
+  async exec(containerId, code, filename, options = {}) {
+    return dockerService().executeCode(containerId, code, filename, options);
+  }
+
+  streams(execution, stdout, stderr) {
+    dockerService().demuxStream(execution.stream, stdout, stderr);
+  }
+
+  async exitStatus(execution, stderr = '') {
+    const exitCode = execution.exec ? await dockerService().getExecExitCode(execution.exec) : null;
+    const killedReason = await dockerService().detectKillReason(execution.containerId, exitCode, stderr) || null;
+    return { exitCode, killedReason };
+  }
+
+  isDiskLimitError(stderr) {
+    return dockerService().isDiskLimitError(stderr);
+  }
+
+  async kill(target, graceMs = 0) {
+    if (typeof target === 'string') {
+      return dockerService().killContainer(target);
+    }
+    return dockerService().terminateExecution(target, graceMs);
+  }
+
+  async remove(containerId, options = {}) {
+    return dockerService().stopContainer(containerId, options);
+  }
+}
+
+module.exports = DockerSandbox;
\ No newline at end of file
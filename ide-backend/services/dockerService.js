@@ -1,23 +1,47 @@
 const Docker = require('dockerode');
+const crypto = require('crypto');
 const path = require('path');
+const { EventEmitter } = require('events');
 const fs = require('fs').promises;
+const { PassThrough } = require('stream');
 const logger = require('../utils/logger');
 const containerSecurityService = require('./containerSecurityService');
 const containerCleanupService = require('./containerCleanupService');
+const containerPool = require('./containerPool');
+const resourceLimits = require('./resourceLimits');
+const runtimeRegistry = require('./runtimeRegistry');
+const projectFiles = require('../utils/projectFiles');
+const programInput = require('../utils/programInput');
+const fileSystem = require('../utils/fileSystem');
+const egressProxy = require('./egressProxy');
+const cacheVolumes = require('./cacheVolumes');
+const buildCache = require('./buildCache');
+const resourceReaper = require('./resourceReaper');
+const executionSessions = require('./executionSessions');
+const sandboxes = require('./sandboxes');
+const workspaceQuota = require('./workspaceQuota');
+const executionMetrics = require('./metrics');
+const requestContext = require('../utils/requestContext');
+const tracing = require('../utils/tracing');
+const { ExecError, wrap } = require('../utils/execErrors');
+const resourceLabels = require('../utils/resourceLabels');
+const config = require('../config');
+
+// Required lazily: the benchmark service runs its trials through this one
+const benchmarkService = () => require('./benchmarkService');
+
+// Per-stream cap on buffered build and test runner output
+const EXEC_OUTPUT_LIMIT = 256 * 1024;
 
 class DockerService {
   constructor() {
     this.docker = new Docker();
     this.containers = new Map(); // Track active containers
     this.isAvailable = false; // Track if Docker is available
-    this.baseImages = {
-      'node': 'node:18-alpine',
-      'python': 'python:3.11-alpine',
-      'java': 'openjdk:17-alpine',
-      'cpp': 'alpine:latest',  // Use alpine for C++ with gcc installed
-      'go': 'golang:1.21-alpine',
-      'rust': 'rust:1.70-alpine'
-    };
+    this.egressNetwork = null; // { name, gateway } once the egress network exists
+    // 'hibernated', 'resuming', 'resumed' and 'resume_failed' { containerId,
+    // workspaceId } as workspace containers stop when idle and start again
+    this.hibernation = new EventEmitter();
 
     // Resource limits for containers
     this.resourceLimits = {
@@ -25,10 +49,7 @@ class DockerService {
       cpuQuota: 50000, // 50% of CPU
       cpuPeriod: 100000,
       networkMode: 'none', // No network access by default
-      readonlyRootfs: false, // Allow writes to /tmp
-      tmpfs: {
-        '/tmp': 'rw,noexec,nosuid,size=100m'
-      }
+      readonlyRootfs: true // Writable scratch comes from containerSecurityService.getTmpfsMounts
     };
   }
 
@@ -45,6 +66,49 @@ class DockerService {
       this.pullBaseImagesInBackground();
 
       this.isAvailable = true;
+
+      // Which sandbox providers (e.g. gVisor) this daemon supports, before any container is created
+      await sandboxes.initialize(this.docker);
+      // Likewise which CPUs are set aside for benchmark runs
+      await benchmarkService().initialize(this.docker);
+
+      // Sweep labelled containers and volumes nothing tracks any more (the first
+      // sweep is an interval away; reconciliation below shares its instance check)
+      resourceReaper.start({
+        docker: this.docker,
+        isTracked: (containerId) => this.containers.has(containerId) || containerPool.has(containerId),
+        instanceId: executionSessions.instanceId,
+        isInstanceAlive: (instanceId) => executionSessions.isInstanceAlive(instanceId)
+      });
+
+      // A crashed or killed predecessor may have left sandboxes running
+      if (config.shutdown.reconcileOnStartup) {
+        await this.reconcileContainers();
+      }
+
+      // Pre-warm idle containers so executions skip the cold start
+      containerPool.initialize({
+        create: (language, context) => this.spawnContainer(language, context.workspaceId, context.userId, context.limits),
+        destroy: (container) => this.destroyContainer(container),
+        runtimes: runtimeRegistry.names()
+      });
+
+      executionMetrics.setSource('runningContainers', () =>
+        Array.from(this.containers.values()).filter(info => info.state !== 'hibernated').length
+      );
+      executionMetrics.setSource('poolIdle', () => Object.fromEntries(
+        Object.entries(containerPool.getStats().runtimes).map(([runtime, stats]) => [runtime, stats.idle])
+      ));
+
+      // Keep shared dependency caches under their size cap
+      cacheVolumes.start(() => runtimeRegistry.names().map(name => runtimeRegistry.get(name)));
+
+      // Hibernated workspace containers are stopped on purpose, not exited leftovers
+      containerCleanupService.isHibernated = (containerId) => {
+        const containerInfo = this.containers.get(containerId);
+        return Boolean(containerInfo && containerInfo.state === 'hibernated');
+      };
+
       return true;
     } catch (error) {
       logger.warn('Docker is not available. Code execution features will be disabled:', error.message);
@@ -53,6 +117,43 @@ class DockerService {
     }
   }
 
+  /**
+   * Remove execution containers (label studio.execution=true) this process
+   * doesn't track. Runs before the pool warms up, so on startup that is
+   * everything a previous process left behind. Other instances sharing the
+   * Docker host keep theirs while they are alive (resourceReaper.isAbandoned).
+   * @returns {number} Containers removed
+   */
+  async reconcileContainers() {
+    const stragglers = [];
+    try {
+      const containers = await this.docker.listContainers({
+        all: true,
+        filters: { label: ['studio.execution=true'] }
+      });
+      const alive = new Map();
+      for (const info of containers) {
+        if (!this.containers.has(info.Id) && !containerPool.isLeased(info.Id) && await resourceReaper.isAbandoned(info.Labels, alive)) {
+          stragglers.push(info);
+        }
+      }
+    } catch (error) {
+      logger.warn('Failed to list execution containers for reconciliation:', error.message);
+      return 0;
+    }
+
+    const results = await Promise.allSettled(stragglers.map(info =>
+      this.docker.getContainer(info.Id).remove({ force: true, v: true })
+    ));
+
+    const removed = results.filter(result => result.status === 'fulfilled'
+      || (result.reason && result.reason.statusCode === 404)).length;
+    if (stragglers.length > 0) {
+      logger.info(`Reconciliation removed ${removed}/${stragglers.length} orphaned execution containers`);
+    }
+    return removed;
+  }
+
   /**
    * Pull base images in the background without blocking server startup
    */
@@ -106,7 +207,7 @@ class DockerService {
    * Pull all base images for supported languages
    */
   async pullBaseImages() {
-    const pullPromises = Object.entries(this.baseImages).map(async ([language, image]) => {
+    const pullPromises = runtimeRegistry.list().map(async ({ name: language, image }) => {
       try {
         logger.info(`Pulling base image for ${language}: ${image}`);
 
@@ -133,40 +234,50 @@ class DockerService {
   }
 
   /**
-   * Create and start a container for code execution
+   * Create and start a container for code execution.
+   * `options.limits` overrides the default ResourceLimits (see resourceLimits service).
+   * `options.mountWorkspaceId` bind mounts a persistent workspace read-write at /workspace.
+   * `options.image` runs a different image than the runtime's (image build smoke tests).
+   * `options.cpusetCpus` pins the container to those CPUs (benchmark runs).
+   * `options.fresh` always cold starts one rather than taking it from the pool.
+   * Networking follows the runtime's `allowNetwork` policy (see spawnContainer).
    */
-  async createContainer(language, workspaceId, userId) {
+  async createContainer(language, workspaceId, userId, options = {}) {
     if (!this.isAvailable) {
-      throw new Error('Docker is not available');
+      throw new ExecError('unavailable', 'DOCKER_UNAVAILABLE', 'Docker is not available');
     }
 
     try {
-      const baseImage = this.baseImages[language];
-      if (!baseImage) {
-        throw new Error(`Unsupported language: ${language}`);
+      if (!runtimeRegistry.has(language)) {
+        throw new ExecError('invalid_request', 'RUNTIME_NOT_FOUND', `Unsupported language: ${language}`, { param: 'language' });
       }
 
-      // Ensure base image is available locally
-      await this.ensureImageAvailable(baseImage);
+      const limits = options.limits || resourceLimits.resolve();
+      const networkEnabled = runtimeRegistry.get(language).allowNetwork;
+      const sandbox = sandboxes.forRuntime(language).name; // same provider spawnContainer uses
 
-      // Get secure container configuration
-      const secureConfig = containerSecurityService.getSecureContainerConfig(language, workspaceId, userId);
+      const mountWorkspaceId = options.mountWorkspaceId || null;
 
-      const containerConfig = {
-        Image: baseImage,
-        WorkingDir: '/workspace',
-        Cmd: this.getDefaultCommand(language),
-        Tty: true,
-        OpenStdin: true,
-        StdinOnce: false,
-        AttachStdin: true,
-        AttachStdout: true,
-        AttachStderr: true,
-        ...secureConfig
-      };
+      const acquireStart = Date.now();
 
-      const container = await this.docker.createContainer(containerConfig);
-      await container.start();
+      // Take a warm container from the pool, or cold start one. Containers with a
+      // workspace mount, another image or pinned CPUs are always cold started
+      // since the pool only holds plain containers of the runtime's current image.
+      const coldStart = mountWorkspaceId || options.image || options.cpusetCpus || options.fresh;
+      const { container, name, pooled } = await tracing.withSpan('container.acquire', { 'studio.runtime': language }, async (span) => {
+        const acquired = coldStart
+          ? { ...(await this.spawnContainer(language, workspaceId, userId, limits, { mountWorkspaceId, image: options.image, cpusetCpus: options.cpusetCpus })), pooled: false }
+          : await containerPool.acquire(language, { workspaceId, userId, limits });
+        span.setAttributes({ 'studio.container_id': acquired.container.id, 'studio.container.pooled': acquired.pooled });
+        return acquired;
+      });
+
+      executionMetrics.observeContainerStart(language, pooled, (Date.now() - acquireStart) / 1000);
+
+      // Warm containers are created with default limits; adjust them in place
+      if (pooled && !resourceLimits.isDefault(limits)) {
+        await container.update(resourceLimits.toHostConfig(limits));
+      }
 
       // Store container reference with security monitoring
       const containerInfo = {
@@ -175,9 +286,17 @@ class DockerService {
         workspaceId,
         userId,
         createdAt: new Date(),
-        name: secureConfig.name,
+        name,
         securityLevel: 'high',
-        lastActivity: new Date()
+        lastActivity: new Date(),
+        limits,
+        pooled,
+        mountWorkspaceId,
+        networkEnabled,
+        sandbox,
+        dirty: false,
+        state: 'running', // workspace containers: hibernated while stopped for idleness, resuming while restarting
+        resuming: null
       };
 
       this.containers.set(container.id, containerInfo);
@@ -185,95 +304,778 @@ class DockerService {
       // Start security monitoring for this container
       this.startContainerMonitoring(container.id, containerInfo);
 
-      logger.info(`Created secure container ${secureConfig.name} for ${language} execution`);
+      logger.info(`${pooled ? 'Assigned warm' : 'Created secure'} container ${name} for ${language} execution`);
 
       return {
         containerId: container.id,
-        name: secureConfig.name,
+        name,
         language,
         status: 'running',
-        securityLevel: 'high'
+        securityLevel: 'high',
+        limits,
+        pooled,
+        mountWorkspaceId,
+        networkEnabled,
+        sandbox
       };
     } catch (error) {
       logger.error('Failed to create container:', error);
-      throw new Error(`Container creation failed: ${error.message}`);
+      throw wrap(error, 'Container creation failed');
+    }
+  }
+
+  /**
+   * Create and start a new secured container (used by the container pool).
+   * Containers get no network at all unless the runtime sets allowNetwork; those
+   * join the internal egress network and can only reach their runtime's
+   * egressAllowlist through the egress proxy. The runtime's sandbox provider
+   * adds its HostConfig (e.g. Runtime "runsc" for gVisor).
+   */
+  async spawnContainer(language, workspaceId, userId, limits = resourceLimits.resolve(), options = {}) {
+    const runtime = runtimeRegistry.get(language);
+    if (!runtime) {
+      throw new Error(`Unsupported language: ${language}`);
+    }
+    const baseImage = options.image || runtime.image;
+
+    // Ensure base image is available locally
+    await this.ensureImageAvailable(baseImage);
+
+    // Get secure container configuration
+    const secureConfig = containerSecurityService.getSecureContainerConfig(language, workspaceId, userId, limits);
+    Object.assign(secureConfig.HostConfig, sandboxes.forRuntime(language).getHostConfig());
+    // Benchmarks get CPUs of their own; everything else stays off them
+    const cpusetCpus = options.cpusetCpus || benchmarkService().sharedCpuset();
+    if (cpusetCpus) {
+      secureConfig.HostConfig.CpusetCpus = cpusetCpus;
+    }
+
+    // Container and volume carry the same labels so the reaper can find leaks of either
+    const executionId = crypto.randomUUID();
+    const labels = resourceLabels.create({ owner: userId, executionId, instance: executionSessions.instanceId });
+    secureConfig.Labels = { ...secureConfig.Labels, ...labels };
+
+    // The root filesystem is read-only, so /workspace is either the user's
+    // workspace or an anonymous volume (removed with the container). Not a
+    // tmpfs: putArchive can't write into those. A mounted workspace gets a
+    // capped tmpfs over its artifact directory for build output, which then
+    // neither persists nor counts against the workspace quota.
+    if (options.mountWorkspaceId) {
+      await workspaceQuota.prepare(options.mountWorkspaceId);
+      // Kept when stopped so hibernation can start it again; stopContainer removes it
+      secureConfig.HostConfig.AutoRemove = false;
+      const { artifactDir, artifactBytes } = config.workspaceQuota;
+      secureConfig.HostConfig.Binds = [
+        ...(secureConfig.HostConfig.Binds || []),
+        `${fileSystem.getHostWorkspacePath(options.mountWorkspaceId)}:/workspace:rw`
+      ];
+      secureConfig.HostConfig.Tmpfs = {
+        ...secureConfig.HostConfig.Tmpfs,
+        [`/workspace/${artifactDir}`]: `rw,exec,nosuid,nodev,size=${artifactBytes}`
+      };
+      secureConfig.Env = [...secureConfig.Env, `PYTHONPYCACHEPREFIX=/workspace/${artifactDir}/pycache`];
+    } else {
+      secureConfig.HostConfig.Mounts = [
+        ...(secureConfig.HostConfig.Mounts || []),
+        { Type: 'volume', Target: '/workspace', VolumeOptions: { Labels: labels } }
+      ];
+    }
+
+    // Shared read-only dependency caches plus private writable build caches
+    const caches = await cacheVolumes.getContainerConfig(runtime);
+    if (caches.env.length > 0) {
+      secureConfig.HostConfig.Binds = [...(secureConfig.HostConfig.Binds || []), ...caches.binds];
+      secureConfig.HostConfig.Tmpfs = { ...secureConfig.HostConfig.Tmpfs, ...caches.tmpfs };
+    }
+
+    // Runtime tool settings, unless a cache mount takes the variable over
+    const cacheVars = new Set(caches.env.map(entry => entry.split('=')[0]));
+    secureConfig.Env = [
+      ...secureConfig.Env,
+      ...runtime.env.filter(entry => !cacheVars.has(entry.split('=')[0])),
+      ...caches.env
+    ];
+
+    if (runtime.allowNetwork) {
+      await this.applyEgressPolicy(secureConfig);
+    }
+
+    const containerConfig = {
+      Image: baseImage,
+      WorkingDir: '/workspace',
+      Cmd: this.getDefaultCommand(language),
+      Tty: true,
+      OpenStdin: true,
+      StdinOnce: false,
+      AttachStdin: true,
+      AttachStdout: true,
+      AttachStderr: true,
+      ...secureConfig
+    };
+
+    const container = await tracing.withSpan('container.create', { 'studio.runtime': language }, async (span) => {
+      const created = await this.docker.createContainer(containerConfig);
+      span.setAttribute('studio.container_id', created.id);
+      await created.start();
+      return created;
+    });
+    logger.debug(`Created container ${secureConfig.name}`, { executionId, owner: userId });
+
+    if (runtime.allowNetwork) {
+      await this.registerEgressClient(container, runtime);
+    }
+
+    return { container, name: secureConfig.name };
+  }
+
+  /**
+   * Switch a secure container config from NetworkMode "none" to the internal
+   * egress network with the proxy configured for HTTP(S) clients
+   */
+  async applyEgressPolicy(secureConfig) {
+    const network = await this.ensureEgressNetwork();
+    await egressProxy.start();
+
+    const proxyUrl = `http://${config.sandboxNetwork.proxyHost || network.gateway}:${config.sandboxNetwork.proxyPort}`;
+
+    secureConfig.HostConfig.NetworkMode = network.name;
+    secureConfig.NetworkDisabled = false;
+    secureConfig.Env = [
+      ...secureConfig.Env,
+      `HTTP_PROXY=${proxyUrl}`,
+      `HTTPS_PROXY=${proxyUrl}`,
+      `http_proxy=${proxyUrl}`,
+      `https_proxy=${proxyUrl}`
+    ];
+  }
+
+  /**
+   * Create the internal egress network on first use. Internal networks have
+   * no route off the host, so the proxy is the containers' only way out.
+   */
+  async ensureEgressNetwork() {
+    if (this.egressNetwork) {
+      return this.egressNetwork;
+    }
+
+    const name = config.sandboxNetwork.egressNetwork;
+    let [networkInfo] = await this.docker.listNetworks({ filters: { name: [name] } });
+
+    if (!networkInfo) {
+      const network = await this.docker.createNetwork({
+        Name: name,
+        Driver: 'bridge',
+        Internal: true,
+        Labels: { 'studio.network': 'egress' }
+      });
+      networkInfo = await network.inspect();
+      logger.info(`Created sandbox egress network ${name}`);
+    }
+
+    const ipamConfig = (networkInfo.IPAM && networkInfo.IPAM.Config) || [];
+    const gateway = ipamConfig.map(entry => entry.Gateway).find(Boolean);
+    if (!gateway && !config.sandboxNetwork.proxyHost) {
+      throw new Error(`Egress network ${name} has no gateway; set SANDBOX_EGRESS_PROXY_HOST`);
+    }
+
+    this.egressNetwork = { name, gateway };
+    return this.egressNetwork;
+  }
+
+  /**
+   * Tell the egress proxy which allowlist applies to the container's address
+   */
+  async registerEgressClient(container, runtime) {
+    const inspect = await container.inspect();
+    const networks = (inspect.NetworkSettings && inspect.NetworkSettings.Networks) || {};
+    const endpoint = networks[config.sandboxNetwork.egressNetwork];
+
+    if (!endpoint || !endpoint.IPAddress) {
+      logger.warn(`Container ${container.id} has no address on the egress network; egress will be denied`);
+      return;
     }
+
+    egressProxy.register(container.id, endpoint.IPAddress, runtime.egressAllowlist);
   }
 
   /**
-   * Execute code in a container
+   * Stop a container (containers are created with AutoRemove, so this also removes it)
    */
-  async executeCode(containerId, code, filename = 'main') {
+  async destroyContainer(container) {
+    egressProxy.unregister(container.id);
+
+    try {
+      await container.stop({ t: 5 }); // 5 second timeout
+    } catch (error) {
+      if (error.statusCode !== 304 && error.statusCode !== 404) { // already stopped / already removed
+        throw error;
+      }
+    }
+  }
+
+  /**
+   * Execute code in a container. `options.stdin` is piped into the program
+   * before it starts; `options.interactive` keeps stdin open for later writes.
+   * `options.files` + `options.entrypoint` run a multi-file project instead of `code`.
+   * `options.mountedFiles` + `options.entrypoint` run files already in a mounted workspace.
+   * `options.requestId` tags executor logs; defaults to the current request context.
+   * `options.compileTimeoutMs` / `options.runTimeoutMs` lower the runtime's phase limits.
+   *
+   * Runtimes with a build step compile in a separate exec first. If the build
+   * fails or times out the returned execution has no stream and carries the
+   * buffered build result in `compile`.
+   */
+  async executeCode(containerId, code, filename = 'main', options = {}) {
     if (!this.isAvailable) {
-      throw new Error('Docker is not available');
+      throw new ExecError('unavailable', 'DOCKER_UNAVAILABLE', 'Docker is not available');
     }
 
+    const requestId = options.requestId || requestContext.getRequestId();
+
     try {
       const containerInfo = this.containers.get(containerId);
       if (!containerInfo) {
-        throw new Error('Container not found');
+        throw new ExecError('not_found', 'CONTAINER_NOT_FOUND', 'Container not found');
       }
 
+      await this.wake(containerInfo);
       const { container, language } = containerInfo;
 
       // Update activity timestamp
       this.updateContainerActivity(containerId);
 
-      // Create the code file in the container
-      const codeFile = this.getCodeFilename(filename, language);
-      await this.writeFileToContainer(container, codeFile, code);
+      // User code has touched this container, so it must not be recycled
+      containerInfo.dirty = true;
+
+      const { stdin = null, interactive = false, files = null, entrypoint = null, mountedFiles = null } = options;
+      let phases;
+      let env = [];
+      let buildCacheKey = null;
+      let cacheBuild = null; // what compileForCache needs on a miss
+
+      if (mountedFiles) {
+        // Persistent workspace is bind mounted; nothing to copy
+        if (!containerInfo.mountWorkspaceId) {
+          throw new ExecError('invalid_request', 'NO_WORKSPACE_MOUNTED', 'Container has no workspace mounted', { param: 'workspace_id' });
+        }
+
+        phases = runtimeRegistry.getProjectPhases(language, entrypoint, mountedFiles);
+        env = projectFiles.getBuildEnv(language, Object.fromEntries(mountedFiles.map(file => [file, ''])), { networkEnabled: containerInfo.networkEnabled });
+      } else if (files) {
+        // Unpack the whole project into /workspace preserving its layout
+        const project = projectFiles.validate(files, entrypoint);
+        if (!project.isValid) {
+          throw new ExecError('invalid_request', 'INVALID_PROJECT', project.errors.join('; '), { param: 'files' });
+        }
+
+        const projectTree = projectFiles.withGoModule(language, project.files);
+        await this.writeFilesToContainer(container, projectTree);
+
+        phases = runtimeRegistry.getProjectPhases(language, project.entrypoint, Object.keys(projectTree));
+        env = projectFiles.getBuildEnv(language, projectTree, { networkEnabled: containerInfo.networkEnabled });
+      } else {
+        // Create the code file in the container
+        const codeFile = this.getCodeFilename(filename, language);
+        await this.writeFileToContainer(container, codeFile, code);
+
+        phases = runtimeRegistry.getPhases(language, codeFile);
+
+        // Only single files are cached: projects and workspaces have too many inputs to key on
+        const runtime = runtimeRegistry.get(language);
+        if (phases.compile && buildCache.isEnabled(runtime)) {
+          const imageId = await this.getImageId(containerId);
+          buildCacheKey = imageId ? buildCache.getKey(runtime, codeFile, code, imageId) : null;
+          cacheBuild = { codeFile, code, imageId };
+        }
+      }
+
+      // User arguments go on the run argv (no shell involved); user env
+      // reaches the program only, not the build
+      const input = programInput.validate(options.args, options.env, runtimeRegistry.get(language));
+      if (!input.isValid) {
+        throw new ExecError('invalid_request', 'INVALID_INPUT', input.errors.join('; '));
+      }
+      phases.run = [...phases.run, ...input.args];
+
+      // Workspace secrets, also for the program only. Names this runtime
+      // reserves are skipped, and the request's own env wins over a secret.
+      const secrets = {};
+      for (const [name, value] of Object.entries(options.secrets || {})) {
+        if (programInput.isReservedName(name, runtimeRegistry.get(language))) {
+          logger.warn(`Skipping secret ${name}: reserved by the ${language} runtime`);
+        } else if (!(name in input.env)) {
+          secrets[name] = value;
+        }
+      }
+      const runEnv = [...env, ...programInput.toEnv(secrets), ...programInput.toEnv(input.env)];
+
+      const limits = runtimeRegistry.resolveTimeouts(language, {
+        compileTimeoutMs: options.compileTimeoutMs,
+        runTimeoutMs: options.runTimeoutMs
+      }, options.timeoutTier || null);
 
-      // Get execution command
-      const execCommand = this.getExecutionCommand(language, codeFile);
+      const execution = {
+        stream: null,
+        exec: null,
+        containerId,
+        language,
+        stdinOpen: false,
+        networkEnabled: Boolean(containerInfo.networkEnabled),
+        requestId,
+        limits,
+        compile: null,
+        cache: null, // 'hit' or 'miss' for runtimes with a build cache
+        timedOut: false,
+        timeoutPhase: null
+      };
+
+      if (phases.compile && buildCacheKey && await this.restoreBuildArtifact(containerId, language, buildCacheKey)) {
+        execution.cache = 'hit';
+      } else if (phases.compile) {
+        execution.cache = buildCacheKey ? 'miss' : null;
+        execution.compile = buildCacheKey
+          ? await this.compileForCache(containerId, language, { ...cacheBuild, argv: phases.compile, env, timeoutMs: limits.compileTimeoutMs, key: buildCacheKey })
+          : await this.runCompilePhase(containerId, phases.compile, env, limits.compileTimeoutMs);
+        if (execution.compile.timedOut || execution.compile.exitCode !== 0) {
+          execution.timedOut = execution.compile.timedOut;
+          execution.timeoutPhase = execution.compile.timedOut ? 'compile' : null;
+          return execution;
+        }
+      }
+      if (execution.cache) {
+        executionMetrics.observeBuildCache(language, execution.cache);
+      }
+
+      const attachStdin = interactive || typeof stdin === 'string';
 
       // Create exec instance with timeout
-      const exec = await container.exec({
-        Cmd: execCommand,
+      const execOptions = {
+        Cmd: phases.run,
+        AttachStdin: attachStdin,
         AttachStdout: true,
         AttachStderr: true,
         Tty: false
-      });
+      };
+
+      if (runEnv.length > 0) {
+        execOptions.Env = runEnv;
+      }
+
+      // Ended by executionService once the exit status is known
+      execution.runSpan = tracing.startSpan('execution.run', { 'studio.runtime': language, 'studio.container_id': containerId });
+
+      let exec;
+      let stream;
+      try {
+        exec = await container.exec(execOptions);
+
+        // Start execution and return stream
+        stream = await exec.start({ hijack: true, stdin: attachStdin });
+      } catch (error) {
+        tracing.endSpan(execution.runSpan, {}, error);
+        throw error;
+      }
+
+      if (typeof stdin === 'string' && stdin.length > 0) {
+        stream.write(stdin);
+      }
+
+      // Without an interactive client, signal EOF right away so programs
+      // reading until end of input terminate
+      if (attachStdin && !interactive) {
+        stream.end();
+      }
 
-      // Start execution and return stream
-      const stream = await exec.start({ hijack: true, stdin: false });
+      execution.stream = stream;
+      execution.exec = exec;
+      execution.stdinOpen = attachStdin && interactive;
 
-      // Set execution timeout
-      const executionTimeout = setTimeout(() => {
-        logger.warn(`Execution timeout for container ${containerId}`);
+      // Run limit covers the program only; the build had its own budget
+      execution.timeout = setTimeout(() => {
+        logger.warn(`Execution timeout for container ${containerId}`, { requestId, phase: 'run' });
+        execution.timedOut = true;
+        execution.timeoutPhase = 'run';
         stream.destroy();
-      }, 30000); // 30 second timeout
+      }, limits.runTimeoutMs);
 
       // Clear timeout when stream ends
       stream.on('end', () => {
-        clearTimeout(executionTimeout);
+        clearTimeout(execution.timeout);
         this.updateContainerActivity(containerId);
       });
 
       stream.on('error', () => {
-        clearTimeout(executionTimeout);
+        clearTimeout(execution.timeout);
       });
 
-      return {
-        stream,
-        exec,
-        containerId,
-        language,
-        timeout: executionTimeout
+      return execution;
+    } catch (error) {
+      logger.error('Code execution failed:', { requestId, containerId, error: error.message });
+      throw wrap(error, 'Execution failed');
+    }
+  }
+
+  /**
+   * Run a build step as its own exec under the compile time limit. Output is
+   * buffered because nothing reads it until we know whether the program runs at all.
+   * @returns {Object} { exitCode, stdout, stderr, durationMs, timedOut }
+   */
+  async runCompilePhase(containerId, argv, env, timeoutMs) {
+    return this.runBufferedExec(containerId, argv, { env, timeoutMs, phase: 'compile' });
+  }
+
+  /**
+   * Run a non-interactive exec to completion under a time limit, buffering
+   * stdout/stderr (capped at `outputLimit` bytes per stream). `onStdout`
+   * additionally receives stdout chunks as they arrive; a `stdin` string is
+   * written to the process followed by EOF.
+   * @returns {Object} { exitCode, stdout, stderr, durationMs, timedOut, truncated }
+   */
+  async runBufferedExec(containerId, argv, { env = [], timeoutMs = 30000, onStdout = null, phase = 'exec', stdin = null, outputLimit = EXEC_OUTPUT_LIMIT } = {}) {
+    const containerInfo = this.containers.get(containerId);
+    if (!containerInfo) {
+      throw new ExecError('not_found', 'CONTAINER_NOT_FOUND', 'Container not found');
+    }
+    await this.wake(containerInfo);
+
+    // One span per phase: execution.compile, execution.judge, ...
+    return tracing.withSpan(`execution.${phase}`, { 'studio.container_id': containerId, 'studio.runtime': containerInfo.language }, async (span) => {
+      this.updateContainerActivity(containerId);
+      containerInfo.dirty = true;
+
+      const startedAt = Date.now();
+
+      const attachStdin = typeof stdin === 'string';
+      const execOptions = {
+        Cmd: argv,
+        AttachStdin: attachStdin,
+        AttachStdout: true,
+        AttachStderr: true,
+        Tty: false
+      };
+      if (env.length > 0) {
+        execOptions.Env = env;
+      }
+
+      const exec = await containerInfo.container.exec(execOptions);
+      const stream = await exec.start({ hijack: true, stdin: attachStdin });
+      if (attachStdin) {
+        stream.end(stdin);
+      }
+
+      const capture = (onChunk) => {
+        const chunks = [];
+        let size = 0;
+        return {
+          write: (chunk) => {
+            if (size < outputLimit) {
+              chunks.push(chunk.subarray(0, outputLimit - size));
+            }
+            size += chunk.length;
+            if (onChunk) {
+              onChunk(chunk);
+            }
+            return true;
+          },
+          text: () => Buffer.concat(chunks).toString('utf8'),
+          truncated: () => size > outputLimit
+        };
       };
+      const stdout = capture(onStdout);
+      const stderr = capture(null);
+      this.demuxStream(stream, stdout, stderr);
+
+      let timedOut = false;
+      let timer;
+      await new Promise((resolve) => {
+        stream.on('end', resolve);
+        stream.on('close', resolve);
+        stream.on('error', resolve);
+        timer = setTimeout(() => {
+          logger.warn(`Exec timeout for container ${containerId}`, { phase, timeoutMs });
+          timedOut = true;
+          stream.destroy();
+          resolve();
+        }, timeoutMs);
+      });
+      clearTimeout(timer);
+
+      this.updateContainerActivity(containerId);
+
+      const result = {
+        exitCode: timedOut ? null : await this.getExecExitCode(exec),
+        stdout: stdout.text(),
+        stderr: stderr.text(),
+        durationMs: Date.now() - startedAt,
+        timedOut,
+        truncated: stdout.truncated() || stderr.truncated()
+      };
+      tracing.setAttributes(span, { 'studio.exit_code': result.exitCode, 'studio.timed_out': timedOut });
+      return result;
+    });
+  }
+
+  /**
+   * Start an interactive shell with a TTY in a container, or `cmd` instead of
+   * the shell (REPL interpreters). The returned stream is raw terminal bytes
+   * in both directions (no multiplexing with Tty: true).
+   */
+  async createTtyExec(containerId, { cols = 80, rows = 24, cmd = null, env = [] } = {}) {
+    if (!this.isAvailable) {
+      throw new Error('Docker is not available');
+    }
+
+    const containerInfo = this.containers.get(containerId);
+    if (!containerInfo) {
+      throw new Error('Container not found');
+    }
+    await this.wake(containerInfo);
+
+    this.updateContainerActivity(containerId);
+    containerInfo.dirty = true;
+
+    const exec = await containerInfo.container.exec({
+      Cmd: cmd || ['sh', '-c', 'command -v bash >/dev/null 2>&1 && exec bash -l || exec sh -l'],
+      AttachStdin: true,
+      AttachStdout: true,
+      AttachStderr: true,
+      Tty: true,
+      Env: [...(env.some(entry => entry.startsWith('TERM=')) ? [] : ['TERM=xterm-256color']), ...env],
+      WorkingDir: '/workspace'
+    });
+
+    const stream = await exec.start({ hijack: true, stdin: true, Tty: true });
+    await this.resizeExec(exec, cols, rows);
+
+    return { exec, stream };
+  }
+
+  /**
+   * Start a long-lived process with piped stdio (no TTY) in a container, for
+   * protocols spoken over stdin/stdout such as LSP. Writes to `stream` go to
+   * the process's stdin; `stdout` and `stderr` are the demultiplexed output.
+   * @returns {Object} { exec, stream, stdout, stderr }
+   */
+  async createStdioExec(containerId, argv, { env = [] } = {}) {
+    if (!this.isAvailable) {
+      throw new Error('Docker is not available');
+    }
+
+    const containerInfo = this.containers.get(containerId);
+    if (!containerInfo) {
+      throw new Error('Container not found');
+    }
+    await this.wake(containerInfo);
+
+    this.updateContainerActivity(containerId);
+    containerInfo.dirty = true;
+
+    const execOptions = {
+      Cmd: argv,
+      AttachStdin: true,
+      AttachStdout: true,
+      AttachStderr: true,
+      Tty: false,
+      WorkingDir: '/workspace'
+    };
+    if (env.length > 0) {
+      execOptions.Env = env;
+    }
+
+    const exec = await containerInfo.container.exec(execOptions);
+    const stream = await exec.start({ hijack: true, stdin: true });
+
+    const stdout = new PassThrough();
+    const stderr = new PassThrough();
+    this.demuxStream(stream, stdout, stderr);
+    stream.on('end', () => {
+      stdout.end();
+      stderr.end();
+    });
+
+    return { exec, stream, stdout, stderr };
+  }
+
+  /**
+   * Resize the TTY of an exec instance (ContainerExecResize)
+   */
+  async resizeExec(exec, cols, rows) {
+    try {
+      await exec.resize({ w: cols, h: rows });
     } catch (error) {
-      logger.error('Code execution failed:', error);
-      throw new Error(`Execution failed: ${error.message}`);
+      // The exec may not have started yet or already exited
+      logger.warn('Failed to resize exec TTY:', error.message);
     }
   }
 
   /**
-   * Stop and remove a container
+   * Split a multiplexed (non-TTY) exec stream into separate stdout/stderr writers
+   */
+  demuxStream(stream, stdout, stderr) {
+    this.docker.modem.demuxStream(stream, stdout, stderr);
+  }
+
+  /**
+   * Get the exit code of a finished exec instance
    */
-  async stopContainer(containerId) {
+  async getExecExitCode(exec) {
+    try {
+      const info = await exec.inspect();
+      return info.Running ? null : info.ExitCode;
+    } catch (error) {
+      logger.warn('Failed to inspect exec instance:', error.message);
+      return null;
+    }
+  }
+
+  /**
+   * Whether stderr shows a write failing because a scratch tmpfs is full
+   */
+  isDiskLimitError(stderr = '') {
+    return /No space left on device|ENOSPC|Errno 28\]/i.test(stderr);
+  }
+
+  /**
+   * Explain why a process was killed, so users see "oom" rather than a bare 137.
+   * Returns 'oom', 'disk_limit', 'pids_limit', 'killed' or null.
+   */
+  async detectKillReason(containerId, exitCode, stderr = '') {
+    if (exitCode === 0 || exitCode === null || exitCode === undefined) {
+      return null;
+    }
+
+    const containerInfo = this.containers.get(containerId);
+    const forkFailed = /fork: (retry: )?Resource temporarily unavailable|can't fork|BlockingIOError: \[Errno 11\]|EAGAIN/i.test(stderr);
+    const diskFull = this.isDiskLimitError(stderr);
+
+    if (containerInfo) {
+      try {
+        const inspect = await containerInfo.container.inspect();
+        if (inspect.State && inspect.State.OOMKilled) {
+          return 'oom';
+        }
+
+        if (diskFull) {
+          return 'disk_limit';
+        }
+
+        if (exitCode === 137 || forkFailed) {
+          const stats = await containerInfo.container.stats({ stream: false });
+          const memory = stats.memory_stats || {};
+          const pids = stats.pids_stats || {};
+
+          const oomKills = memory.stats && memory.stats.oom_kill; // cgroup v2
+          if (exitCode === 137 && (oomKills > 0 || (memory.limit && (memory.failcnt > 0 || memory.max_usage >= memory.limit * 0.95)))) {
+            return 'oom';
+          }
+
+          if (pids.limit && pids.current >= pids.limit) {
+            return 'pids_limit';
+          }
+        }
+      } catch (error) {
+        logger.warn(`Failed to determine kill reason for container ${containerId}:`, error.message);
+      }
+    }
+
+    if (diskFull) {
+      return 'disk_limit';
+    }
+
+    if (forkFailed) {
+      return 'pids_limit';
+    }
+
+    return exitCode === 137 ? 'killed' : null;
+  }
+
+  /**
+   * Gracefully stop an execution: SIGTERM the user's processes, give them
+   * `graceMs` to exit, then SIGKILL and remove the container
+   */
+  async terminateExecution(execution, graceMs) {
+    const containerInfo = this.containers.get(execution.containerId);
+    if (!containerInfo) {
+      return;
+    }
+
+    try {
+      await this.signalProcesses(execution.containerId, 'TERM');
+
+      if (execution.exec) {
+        await this.waitForExec(execution.exec, graceMs);
+      }
+    } catch (error) {
+      logger.warn(`Failed to send SIGTERM in container ${containerInfo.name}:`, error.message);
+    }
+
+    await this.killContainer(execution.containerId);
+  }
+
+  /**
+   * Signal every process in a container except its idle shell (`kill -1`
+   * skips PID 1), leaving the container itself usable
+   */
+  async signalProcesses(containerId, signal = 'KILL') {
+    const containerInfo = this.containers.get(containerId);
+    if (!containerInfo) {
+      return;
+    }
+
+    const exec = await containerInfo.container.exec({
+      Cmd: ['kill', `-${signal}`, '-1'],
+      AttachStdout: false,
+      AttachStderr: false
+    });
+    await exec.start({ Detach: true });
+  }
+
+  /**
+   * Poll an exec instance until it exits or the timeout elapses
+   */
+  async waitForExec(exec, timeoutMs, intervalMs = 100) {
+    const deadline = Date.now() + timeoutMs;
+
+    while (Date.now() < deadline) {
+      if (await this.getExecExitCode(exec) !== null) {
+        return true;
+      }
+      await new Promise(resolve => setTimeout(resolve, intervalMs));
+    }
+
+    return false;
+  }
+
+  /**
+   * Kill a container immediately and stop tracking it
+   */
+  async killContainer(containerId) {
+    const containerInfo = this.containers.get(containerId);
+    if (!containerInfo) {
+      return;
+    }
+
+    try {
+      await containerInfo.container.kill();
+    } catch (error) {
+      if (error.statusCode !== 409 && error.statusCode !== 404) { // not running / already removed
+        logger.error(`Failed to kill container ${containerInfo.name}:`, error);
+      }
+    }
+
+    await this.stopContainer(containerId);
+  }
+
+  /**
+   * Stop and remove a container. `force` kills it outright instead of
+   * handing it back to the pool or waiting for it to stop.
+   */
+  async stopContainer(containerId, { force = false } = {}) {
     if (!this.isAvailable) {
       throw new Error('Docker is not available');
     }
 
+    let span = null;
     try {
       const containerInfo = this.containers.get(containerId);
       if (!containerInfo) {
@@ -281,26 +1083,61 @@ class DockerService {
         return;
       }
 
-      const { container, name, monitoringInterval } = containerInfo;
+      span = tracing.startSpan('container.cleanup', { 'studio.container_id': containerId, 'studio.container.force': force });
+
+      const { container, name, monitoringInterval, dirty } = containerInfo;
 
       // Stop monitoring
       if (monitoringInterval) {
         clearInterval(monitoringInterval);
       }
 
-      try {
-        await container.stop({ t: 5 }); // 5 second timeout
-        logger.info(`Stopped container ${name}`);
-      } catch (error) {
-        if (error.statusCode !== 304) { // 304 = already stopped
-          logger.error(`Failed to stop container ${name}:`, error);
+      if (force) {
+        // Shutdown after the drain period: whatever still runs is SIGKILLed with its container
+        egressProxy.unregister(containerId);
+
+        try {
+          await container.remove({ force: true, v: true });
+          logger.info(`Force removed container ${name}`);
+        } catch (error) {
+          if (error.statusCode !== 404) { // 404 = already removed
+            logger.error(`Failed to force remove container ${name}:`, error);
+          }
+        }
+      } else if (containerPool.isLeased(containerId)) {
+        // Hand the container back; the pool recycles it if no code ran in it
+        await containerPool.release(containerId, dirty);
+        logger.info(`Released container ${name} to pool`);
+      } else {
+        egressProxy.unregister(containerId);
+
+        try {
+          await container.stop({ t: 5 }); // 5 second timeout
+          logger.info(`Stopped container ${name}`);
+        } catch (error) {
+          if (error.statusCode !== 304) { // 304 = already stopped
+            logger.error(`Failed to stop container ${name}:`, error);
+          }
+        }
+
+        // Workspace containers don't AutoRemove (see spawnContainer)
+        if (containerInfo.mountWorkspaceId) {
+          try {
+            await container.remove({ v: true });
+          } catch (error) {
+            if (error.statusCode !== 404) {
+              logger.error(`Failed to remove container ${name}:`, error);
+            }
+          }
         }
       }
 
       // Remove from tracking
       this.containers.delete(containerId);
+      tracing.endSpan(span);
 
     } catch (error) {
+      tracing.endSpan(span, {}, error);
       logger.error('Failed to stop container:', error);
       throw new Error(`Container stop failed: ${error.message}`);
     }
@@ -334,7 +1171,11 @@ class DockerService {
         running: inspect.State.Running,
         startedAt: inspect.State.StartedAt,
         finishedAt: inspect.State.FinishedAt,
-        exitCode: inspect.State.ExitCode
+        exitCode: inspect.State.ExitCode,
+        mountWorkspaceId: containerInfo.mountWorkspaceId || null,
+        state: containerInfo.state,
+        networkEnabled: Boolean(containerInfo.networkEnabled),
+        sandbox: containerInfo.sandbox || null
       };
     } catch (error) {
       logger.error('Failed to get container info:', error);
@@ -388,6 +1229,91 @@ class DockerService {
     }
   }
 
+  /**
+   * Stop an idle workspace container without removing it, so its processes
+   * go away but the next exec can start it again with the workspace mounted
+   * (see wake). Callers close its terminals and language servers first.
+   * @returns {boolean} whether it was running and is now hibernated
+   */
+  async hibernateContainer(containerId) {
+    const containerInfo = this.containers.get(containerId);
+    if (!containerInfo || !containerInfo.mountWorkspaceId || containerInfo.state !== 'running') {
+      return false;
+    }
+
+    containerInfo.state = 'hibernated';
+    clearInterval(containerInfo.monitoringInterval);
+    containerInfo.monitoringInterval = null;
+    egressProxy.unregister(containerId);
+
+    try {
+      await containerInfo.container.stop({ t: 5 });
+    } catch (error) {
+      if (error.statusCode === 404) {
+        this.containers.delete(containerId);
+        return false;
+      }
+      if (error.statusCode !== 304) {
+        containerInfo.state = 'running';
+        this.startContainerMonitoring(containerId, containerInfo);
+        throw error;
+      }
+    }
+
+    logger.info(`Hibernated container ${containerInfo.name}`);
+    this.hibernation.emit('hibernated', { containerId, workspaceId: containerInfo.mountWorkspaceId });
+    return true;
+  }
+
+  /**
+   * Start a hibernated container again before using it. Concurrent callers
+   * share one restart; a container removed meanwhile is CONTAINER_NOT_FOUND.
+   */
+  async wake(containerInfo) {
+    if (containerInfo.state === 'running') {
+      return;
+    }
+    if (!containerInfo.resuming) {
+      containerInfo.resuming = this.resumeContainer(containerInfo).finally(() => {
+        containerInfo.resuming = null;
+      });
+    }
+    await containerInfo.resuming;
+  }
+
+  async resumeContainer(containerInfo) {
+    const { container } = containerInfo;
+    const event = { containerId: container.id, workspaceId: containerInfo.mountWorkspaceId };
+    const startedAt = Date.now();
+
+    containerInfo.state = 'resuming';
+    this.hibernation.emit('resuming', event);
+
+    try {
+      await container.start();
+      if (containerInfo.networkEnabled) {
+        await this.registerEgressClient(container, runtimeRegistry.get(containerInfo.language));
+      }
+    } catch (error) {
+      if (error.statusCode !== 304) { // 304 = already started
+        this.hibernation.emit('resume_failed', { ...event, error: error.message });
+        if (error.statusCode === 404) {
+          this.containers.delete(container.id);
+          throw new ExecError('not_found', 'CONTAINER_NOT_FOUND', 'Container was removed while it hibernated');
+        }
+        containerInfo.state = 'hibernated';
+        throw wrap(error, 'Failed to resume container');
+      }
+    }
+
+    containerInfo.state = 'running';
+    containerInfo.lastActivity = new Date();
+    this.startContainerMonitoring(container.id, containerInfo);
+    executionMetrics.observeWorkspaceResume((Date.now() - startedAt) / 1000);
+    logger.info(`Resumed container ${containerInfo.name} in ${Date.now() - startedAt}ms`);
+    this.hibernation.emit('resumed', { ...event, durationMs: Date.now() - startedAt });
+  }
+
   /**
    * Update container activity timestamp
    */
@@ -416,41 +1342,19 @@ class DockerService {
 
   // Helper methods
 
-  getDefaultCommand(language) {
-    const commands = {
-      'node': ['/bin/sh'],
-      'python': ['/bin/sh'],
-      'java': ['/bin/sh'],
-      'cpp': ['/bin/sh'],
-      'go': ['/bin/sh'],
-      'rust': ['/bin/sh']
-    };
-    return commands[language] || ['/bin/sh'];
+  getDefaultCommand() {
+    // Containers idle in a shell; code runs through exec instances
+    return ['/bin/sh'];
   }
 
   getCodeFilename(filename, language) {
-    const extensions = {
-      'node': 'js',
-      'python': 'py',
-      'java': 'java',
-      'cpp': 'cpp',
-      'go': 'go',
-      'rust': 'rs'
-    };
-    const ext = extensions[language] || 'txt';
+    const runtime = runtimeRegistry.get(language);
+    const ext = runtime ? runtime.extension : 'txt';
     return `${filename}.${ext}`;
   }
 
   getExecutionCommand(language, filename) {
-    const commands = {
-      'node': ['node', filename],
-      'python': ['python', filename],
-      'java': ['sh', '-c', `javac ${filename} && java ${filename.replace('.java', '')}`],
-      'cpp': ['sh', '-c', `g++ -o main ${filename} && ./main`],
-      'go': ['go', 'run', filename],
-      'rust': ['sh', '-c', `rustc ${filename} -o main && ./main`]
-    };
-    return commands[language] || ['cat', filename];
+    return runtimeRegistry.getExecutionCommand(language, filename);
   }
 
   async writeFileToContainer(container, filename, content) {
@@ -462,7 +1366,290 @@ class DockerService {
     pack.finalize();
 
     // Put the archive into the container
-    await container.putArchive(pack, { path: '/workspace' });
+    await tracing.withSpan('container.copy_files', { 'studio.container_id': container.id, 'studio.files': 1 }, () =>
+      container.putArchive(pack, { path: '/workspace' })
+    );
+  }
+
+  async writeFilesToContainer(container, files) {
+    const pack = projectFiles.createArchive(files);
+    await tracing.withSpan('container.copy_files', { 'studio.container_id': container.id, 'studio.files': Object.keys(files).length }, () =>
+      container.putArchive(pack, { path: '/workspace' })
+    );
+  }
+
+  /**
+   * Read a file out of a container. Goes through exec because the archive
+   * API can't see tmpfs mounts such as the build directory.
+   * @returns {Buffer}
+   */
+  async copyFileFromContainer(containerId, filePath, { maxBytes = Infinity } = {}) {
+    const proc = await this.createStdioExec(containerId, ['cat', filePath]);
+    proc.stream.end();
+
+    const chunks = [];
+    let size = 0;
+    proc.stdout.on('data', (chunk) => {
+      size += chunk.length;
+      if (size > maxBytes) {
+        proc.stream.destroy();
+      } else {
+        chunks.push(chunk);
+      }
+    });
+
+    await new Promise((resolve) => {
+      proc.stream.on('end', resolve);
+      proc.stream.on('close', resolve);
+      proc.stream.on('error', resolve);
+    });
+
+    if (size > maxBytes) {
+      throw new Error(`${filePath} is larger than ${maxBytes} bytes`);
+    }
+    const exitCode = await this.getExecExitCode(proc.exec);
+    if (exitCode !== 0) {
+      throw new Error(`Failed to read ${filePath} (exit code ${exitCode})`);
+    }
+    return Buffer.concat(chunks);
+  }
+
+  /**
+   * Write a file into a container through exec, for the same reason
+   */
+  async copyFileToContainer(containerId, filePath, content, { mode = '644' } = {}) {
+    const proc = await this.createStdioExec(containerId, ['sh', '-c', 'cat > "$1" && chmod "$2" "$1"', 'sh', filePath, mode]);
+    proc.stdout.resume();
+    proc.stderr.resume();
+
+    await new Promise((resolve) => {
+      proc.stream.on('end', resolve);
+      proc.stream.on('close', resolve);
+      proc.stream.on('error', resolve);
+      proc.stream.end(content);
+    });
+
+    const exitCode = await this.getExecExitCode(proc.exec);
+    if (exitCode !== 0) {
+      throw new Error(`Failed to write ${filePath} (exit code ${exitCode})`);
+    }
+  }
+
+  /**
+   * Copy the regular files under /workspace that `matches` accepts out of a
+   * container through the archive API. Symlinks are never followed; files
+   * past maxFiles, or that would take the total over maxBytes, are left out
+   * and reported as `truncated`.
+   * @param {Function} matches - Predicate over workspace-relative paths
+   * @returns {Object} { files: [{ path, content }], truncated }
+   */
+  async readWorkspaceFiles(containerId, matches, { maxFiles = Infinity, maxBytes = Infinity } = {}) {
+    const containerInfo = this.containers.get(containerId);
+    if (!containerInfo) {
+      throw new ExecError('not_found', 'CONTAINER_NOT_FOUND', 'Container not found');
+    }
+
+    const listing = await this.runBufferedExec(containerId, ['find', '/workspace', '-type', 'f', '-print0'], {
+      phase: 'artifacts',
+      timeoutMs: 10000,
+      outputLimit: 1024 * 1024
+    });
+    const paths = listing.stdout.split('\0')
+      .filter(filePath => filePath.startsWith('/workspace/'))
+      .map(filePath => filePath.slice('/workspace/'.length))
+      .filter(matches)
+      .sort();
+
+    const files = [];
+    let size = 0;
+    let truncated = listing.truncated;
+    for (const filePath of paths) {
+      if (files.length >= maxFiles) {
+        truncated = true;
+        break;
+      }
+      const file = await this.readArchiveFile(containerInfo.container, `/workspace/${filePath}`, maxBytes - size);
+      if (file && file.content) {
+        files.push({ path: filePath, content: file.content });
+        size += file.content.length;
+      } else if (file) {
+        truncated = true;
+      }
+    }
+    return { files, truncated };
+  }
+
+  /**
+   * The single regular file getArchive returns for `filePath`: null if it
+   * isn't one, and content null when it is larger than `maxBytes`
+   * @returns {Object|null} { size, content }
+   */
+  async readArchiveFile(container, filePath, maxBytes) {
+    const tar = require('tar-stream');
+    let archive;
+    try {
+      archive = await container.getArchive({ path: filePath });
+    } catch (error) {
+      logger.debug(`Failed to read ${filePath} from ${container.id}:`, error.message);
+      return null;
+    }
+
+    return new Promise((resolve, reject) => {
+      const extract = tar.extract();
+      let file = null;
+
+      extract.on('entry', (header, stream, next) => {
+        if (file || header.type !== 'file') {
+          stream.on('end', next);
+          stream.resume();
+          return;
+        }
+        if (header.size > maxBytes) {
+          file = { size: header.size, content: null };
+          archive.destroy();
+          resolve(file);
+          return;
+        }
+
+        const chunks = [];
+        stream.on('data', chunk => chunks.push(chunk));
+        stream.on('end', () => {
+          file = { size: header.size, content: Buffer.concat(chunks) };
+          next();
+        });
+      });
+      extract.on('finish', () => resolve(file));
+      extract.on('error', reject);
+      archive.on('error', reject);
+      archive.pipe(extract);
+    });
+  }
+
+  /**
+   * Put a cached build of this source in place of compiling it. Any failure
+   * just means compiling as usual.
+   * @returns {boolean} Whether the artifact was restored
+   */
+  async restoreBuildArtifact(containerId, language, key) {
+    const { buildCache: { artifact } } = runtimeRegistry.get(language);
+    try {
+      const cached = await buildCache.get(language, key);
+      if (!cached) {
+        return false;
+      }
+      await this.copyFileToContainer(containerId, artifact, cached, { mode: '755' });
+      return true;
+    } catch (error) {
+      logger.warn(`Failed to restore cached ${language} build into ${containerId}:`, error.message);
+      return false;
+    }
+  }
+
+  /**
+   * Compile a single file for the build cache in a container of its own, one
+   * no program has run in, and copy the binary from there into `containerId`.
+   * The user's container may still hold processes from earlier runs that could
+   * swap the binary between the compile and the copy-out, and cache entries
+   * are shared by every user. Compiles in `containerId` instead, caching
+   * nothing, when the builder can't be used.
+   * @param {Object} build { codeFile, code, imageId, argv, env, timeoutMs, key }
+   * @returns {Object} The compile phase's result (see runCompilePhase)
+   */
+  async compileForCache(containerId, language, { codeFile, code, imageId, argv, env, timeoutMs, key }) {
+    const { buildCache: { artifact } } = runtimeRegistry.get(language);
+    const { userId } = this.containers.get(containerId);
+
+    let builderId = null;
+    try {
+      ({ containerId: builderId } = await this.createContainer(language, 'build-cache', userId));
+      // A pooled container may predate an image rebuild
+      if (await this.getImageId(builderId) !== imageId) {
+        throw new Error('builder runs a different image');
+      }
+
+      await this.writeFileToContainer(this.containers.get(builderId).container, codeFile, code);
+      const result = await this.runCompilePhase(builderId, argv, env, timeoutMs);
+      if (result.timedOut || result.exitCode !== 0) {
+        return result;
+      }
+
+      const built = await this.copyFileFromContainer(builderId, artifact);
+      await this.copyFileToContainer(containerId, artifact, built, { mode: '755' });
+      await buildCache.set(language, key, built).catch(error =>
+        logger.warn(`Failed to cache ${language} build:`, error.message)
+      );
+      return result;
+    } catch (error) {
+      logger.warn(`Failed to build ${language} for the build cache, compiling in ${containerId}:`, error.message);
+      return this.runCompilePhase(containerId, argv, env, timeoutMs);
+    } finally {
+      if (builderId) {
+        await this.stopContainer(builderId, { force: true }).catch(() => {});
+      }
+    }
+  }
+
+  /**
+   * ID of the image a container was created from, looked up once. Tags can
+   * move; the ID can't.
+   * @returns {string|null} null when the container can't be inspected
+   */
+  async getImageId(containerId) {
+    const containerInfo = this.containers.get(containerId);
+    if (!containerInfo) {
+      return null;
+    }
+    if (!containerInfo.imageId) {
+      try {
+        containerInfo.imageId = (await containerInfo.container.inspect()).Image || null;
+      } catch (error) {
+        logger.warn(`Failed to inspect container ${containerId}:`, error.message);
+        return null;
+      }
+    }
+    return containerInfo.imageId;
+  }
+
+  /**
+   * Build an image from a tar of the build context, passing each line of
+   * build output to `onOutput`
+   * @returns {Object} { imageId }
+   */
+  async buildImage(context, { tag, dockerfile, labels = {}, onOutput = () => {} }) {
+    if (!this.isAvailable) {
+      throw new Error('Docker is not available');
+    }
+
+    const stream = await this.docker.buildImage(context, {
+      t: tag,
+      dockerfile,
+      labels,
+      rm: true,
+      forcerm: true
+    });
+
+    let imageId = null;
+    let buildError = null;
+    await new Promise((resolve, reject) => {
+      this.docker.modem.followProgress(stream, (err) => (err ? reject(err) : resolve()), (event) => {
+        if (event.stream) {
+          onOutput(event.stream);
+        }
+        if (event.aux && event.aux.ID) {
+          imageId = event.aux.ID;
+        }
+        // A failing RUN step is reported in the stream, not as a request error
+        if (event.error) {
+          buildError = event.error;
+          onOutput(`${event.error}\n`);
+        }
+      });
+    });
+
+    if (buildError) {
+      throw new Error(buildError);
+    }
+    return { imageId };
   }
 
   async followProgress(stream) {
@@ -493,7 +1680,9 @@ class DockerService {
       totalContainers: this.containers.size,
       containers: containerStats,
       securityService: containerSecurityService.getSecurityStats(),
-      cleanupService: containerCleanupService.getCleanupStats()
+      cleanupService: containerCleanupService.getCleanupStats(),
+      cacheVolumes: cacheVolumes.getStats(),
+      resourceReaper: resourceReaper.getStats()
     };
   }
 
@@ -0,0 +1,173 @@
+const http = require('http');
+const net = require('net');
+const config = require('../config');
+const logger = require('../utils/logger');
+
+/**
+ * Allowlisting HTTP(S) forward proxy for sandbox containers that run with
+ * networking enabled. Containers on the internal egress network have no route
+ * out, so every request goes through here: CONNECT tunnels for HTTPS and
+ * absolute-URI requests for plain HTTP. Clients are identified by source IP,
+ * and each container IP carries the allowlist of its runtime.
+ */
+class EgressProxy {
+  constructor() {
+    this.config = { ...config.sandboxNetwork };
+    this.clients = new Map(); // container IP -> { containerId, allowlist }
+    this.server = null;
+  }
+
+  /**
+   * Start listening (idempotent)
+   */
+  async start() {
+    if (this.server) {
+      return;
+    }
+
+    const server = http.createServer((req, res) => this.handleRequest(req, res));
+    server.on('connect', (req, socket, head) => this.handleConnect(req, socket, head));
+    server.on('clientError', (error, socket) => socket.destroy());
+
+    await new Promise((resolve, reject) => {
+      server.once('error', reject);
+      server.listen(this.config.proxyPort, () => {
+        server.removeListener('error', reject);
+        resolve();
+      });
+    });
+
+    this.server = server;
+    logger.info(`Sandbox egress proxy listening on port ${this.config.proxyPort}`);
+  }
+
+  async stop() {
+    if (!this.server) {
+      return;
+    }
+
+    const server = this.server;
+    this.server = null;
+    await new Promise(resolve => server.close(() => resolve()));
+  }
+
+  /**
+   * Allow a container (by its IP on the egress network) to reach `allowlist`
+   */
+  register(containerId, ip, allowlist = []) {
+    this.clients.set(ip, {
+      containerId,
+      allowlist: [...new Set([...this.config.allowlist, ...allowlist].map(host => host.toLowerCase()))]
+    });
+  }
+
+  unregister(containerId) {
+    for (const [ip, client] of this.clients) {
+      if (client.containerId === containerId) {
+        this.clients.delete(ip);
+      }
+    }
+  }
+
+  /**
+   * Match a hostname against allowlist entries; `*.example.com` matches subdomains only
+   */
+  isAllowed(hostname, allowlist) {
+    const host = String(hostname || '').toLowerCase().replace(/\.$/, '');
+    if (!host) {
+      return false;
+    }
+
+    return allowlist.some(entry => {
+      if (entry.startsWith('*.')) {
+        return host.endsWith(entry.slice(1));
+      }
+      return host === entry;
+    });
+  }
+
+  clientFor(socket) {
+    const ip = (socket.remoteAddress || '').replace(/^::ffff:/, '');
+    return this.clients.get(ip) || null;
+  }
+
+  /**
+   * HTTPS: CONNECT host:port
+   */
+  handleConnect(req, socket, head) {
+    const client = this.clientFor(socket);
+    const [hostname, port = '443'] = req.url.split(':');
+
+    if (!client || !this.isAllowed(hostname, client.allowlist)) {
+      this.deny(client, hostname);
+      socket.end('HTTP/1.1 403 Forbidden\r\nContent-Type: text/plain\r\n\r\nEgress to this host is not allowed\n');
+      return;
+    }
+
+    const upstream = net.connect(parseInt(port, 10), hostname, () => {
+      socket.write('HTTP/1.1 200 Connection Established\r\n\r\n');
+      if (head && head.length > 0) {
+        upstream.write(head);
+      }
+      upstream.pipe(socket);
+      socket.pipe(upstream);
+    });
+
+    upstream.on('error', (error) => {
+      logger.debug(`Egress tunnel to ${hostname} failed:`, error.message);
+      socket.end('HTTP/1.1 502 Bad Gateway\r\n\r\n');
+    });
+    socket.on('error', () => upstream.destroy());
+  }
+
+  /**
+   * Plain HTTP: absolute-URI requests (GET http://host/path)
+   */
+  handleRequest(req, res) {
+    const client = this.clientFor(req.socket);
+    let target;
+    try {
+      target = new URL(req.url);
+    } catch (error) {
+      res.writeHead(400, { 'Content-Type': 'text/plain' });
+      res.end('Proxy requests must use an absolute URL\n');
+      return;
+    }
+
+    if (!client || target.protocol !== 'http:' || !this.isAllowed(target.hostname, client.allowlist)) {
+      this.deny(client, target.hostname);
+      res.writeHead(403, { 'Content-Type': 'text/plain' });
+      res.end('Egress to this host is not allowed\n');
+      return;
+    }
+
+    const upstream = http.request({
+      hostname: target.hostname,
+      port: target.port || 80,
+      path: `${target.pathname}${target.search}`,
+      method: req.method,
+      headers: { ...req.headers, host: target.host }
+    }, (upstreamRes) => {
+      res.writeHead(upstreamRes.statusCode, upstreamRes.headers);
+      upstreamRes.pipe(res);
+    });
+
+    upstream.on('error', (error) => {
+      logger.debug(`Egress request to ${target.hostname} failed:`, error.message);
+      if (!res.headersSent) {
+        res.writeHead(502, { 'Content-Type': 'text/plain' });
+      }
+      res.end();
+    });
+    req.pipe(upstream);
+  }
+
+  deny(client, hostname) {
+    logger.warn('Sandbox egress denied', {
+      containerId: client ? client.containerId : null,
+      host: hostname
+    });
+  }
+}
+
+module.exports = new EgressProxy();
\ No newline at end of file
@@ -0,0 +1,75 @@
+const logger = require('../utils/logger');
+const requestContext = require('../utils/requestContext');
+
+/**
+ * Structured audit trail for executions: one entry when an execution starts
+ * and one when it finishes, keyed by execution and request ID. Entries record
+ * code sizes only; code contents are never logged.
+ */
+class ExecutionAudit {
+  /**
+   * Size of what the user submitted, for the audit entry
+   * @param {string} code - Single-file code
+   * @param {Object} files - Multi-file project (path -> contents)
+   */
+  measureCode(code, files) {
+    if (files && typeof files === 'object') {
+      const contents = Object.values(files);
+      return {
+        codeBytes: contents.reduce((total, content) => total + Buffer.byteLength(String(content)), 0),
+        fileCount: contents.length
+      };
+    }
+
+    return {
+      codeBytes: typeof code === 'string' ? Buffer.byteLength(code) : 0,
+      fileCount: typeof code === 'string' ? 1 : 0
+    };
+  }
+
+  logStart(executionData) {
+    logger.info('Execution started', {
+      event: 'execution.start',
+      ...this.identify(executionData),
+      codeBytes: executionData.codeBytes || 0,
+      fileCount: executionData.fileCount || 0,
+      queueWaitMs: this.queueWaitMs(executionData)
+    });
+  }
+
+  logFinish(executionData) {
+    const entry = {
+      event: 'execution.finish',
+      ...this.identify(executionData),
+      status: executionData.status,
+      exitCode: executionData.exitCode === undefined ? null : executionData.exitCode,
+      killedReason: executionData.killedReason || null,
+      durationMs: typeof executionData.duration === 'number' ? executionData.duration : null,
+      queueWaitMs: this.queueWaitMs(executionData),
+      stdoutBytes: Buffer.byteLength(executionData.stdout || ''),
+      stderrBytes: Buffer.byteLength(executionData.stderr || '')
+    };
+
+    if (executionData.error) {
+      entry.error = executionData.error;
+    }
+
+    logger[executionData.status === 'error' ? 'warn' : 'info']('Execution finished', entry);
+  }
+
+  identify(executionData) {
+    return {
+      executionId: executionData.id,
+      requestId: executionData.requestId || requestContext.getRequestId(),
+      userId: executionData.userId || null,
+      runtime: executionData.language || null,
+      containerId: executionData.containerId || null
+    };
+  }
+
+  queueWaitMs({ queueTicket }) {
+    return queueTicket && queueTicket.startedAt ? queueTicket.startedAt - queueTicket.enqueuedAt : null;
+  }
+}
+
+module.exports = new ExecutionAudit();
\ No newline at end of file
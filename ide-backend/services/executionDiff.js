@@ -0,0 +1,208 @@
+const path = require('path');
+const { Worker } = require('worker_threads');
+const config = require('../config');
+const executionHistory = require('./executionHistory');
+const { diffLines } = require('../utils/textDiff');
+const { ExecError } = require('../utils/execErrors');
+
+// Added by executionHistory.truncateOutput where a stored stream was cut
+const TRUNCATION_MARKER = /\n\[output truncated: \d+ more bytes\]$/;
+
+/**
+ * Volatile output normalized before comparing when asked for by name,
+ * replaced by the placeholder so both sides read the same
+ */
+const PRESETS = {
+  timestamps: {
+    pattern: /\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?|\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?\b/g,
+    placeholder: '<timestamp>'
+  },
+  addresses: { pattern: /\b0x[0-9a-fA-F]{4,}\b/g, placeholder: '<address>' },
+  uuids: { pattern: /\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b/gi, placeholder: '<uuid>' },
+  durations: { pattern: /\b\d+(?:\.\d+)?\s?(?:ns|us|µs|ms|s)\b/g, placeholder: '<duration>' }
+};
+
+const PATTERN_WORKER = path.join(__dirname, '..', 'utils', 'patternWorker.js');
+
+/**
+ * Compares two runs from the caller's execution history: outcome, timing and
+ * a line diff of each output stream as stored (so bounded by
+ * config.executionHistory.outputLimitBytes). Runs of different runtimes or
+ * code are still diffed but flagged as not comparable. Caller supplied
+ * normalize patterns run in a worker thread under patternTimeoutMs, since no
+ * check of the pattern text catches every one that backtracks exponentially.
+ */
+class ExecutionDiff {
+  constructor() {
+    this.config = { ...config.executionDiff };
+  }
+
+  /**
+   * Normalization rules for preset names and regex sources
+   * @returns {Array} [{ name, pattern, placeholder }]
+   */
+  compileRules({ presets = [], patterns = [] } = {}) {
+    const rules = presets.map(name => {
+      if (!PRESETS[name]) {
+        throw new ExecError('invalid_request', 'INVALID_PATTERN', `Unknown preset ${name}, expected one of ${Object.keys(PRESETS).join(', ')}`, { param: 'presets' });
+      }
+      return { name, ...PRESETS[name] };
+    });
+
+    if (patterns.length > this.config.maxPatterns) {
+      throw new ExecError('invalid_request', 'INVALID_PATTERN', `At most ${this.config.maxPatterns} normalize patterns are allowed`, { param: 'normalize' });
+    }
+
+    for (const source of patterns) {
+      if (typeof source !== 'string' || source.length === 0 || source.length > this.config.maxPatternLength) {
+        throw new ExecError('invalid_request', 'INVALID_PATTERN', `normalize patterns must be 1 to ${this.config.maxPatternLength} characters`, { param: 'normalize' });
+      }
+
+      let pattern;
+      try {
+        pattern = new RegExp(source, 'g');
+      } catch (error) {
+        throw new ExecError('invalid_request', 'INVALID_PATTERN', `Invalid pattern ${source}: ${error.message}`, { param: 'normalize' });
+      }
+      rules.push({ name: source, pattern, placeholder: '<normalized>', custom: true });
+    }
+
+    return rules;
+  }
+
+  /**
+   * Apply the rules to each text: presets here, caller patterns in a worker
+   * @returns {Promise<string[]>}
+   */
+  async normalize(texts, rules) {
+    const presets = rules.filter(rule => !rule.custom);
+    const custom = rules.filter(rule => rule.custom);
+
+    const normalized = texts.map(text => presets.reduce((result, rule) => result.replace(rule.pattern, rule.placeholder), text));
+    return custom.length > 0 ? this.applyPatterns(normalized, custom) : normalized;
+  }
+
+  applyPatterns(texts, rules) {
+    return new Promise((resolve, reject) => {
+      const worker = new Worker(PATTERN_WORKER, {
+        workerData: { texts, sources: rules.map(rule => rule.pattern.source), placeholder: rules[0].placeholder },
+        resourceLimits: { maxOldGenerationSizeMb: 64 }
+      });
+
+      let settled = false;
+      const settle = (error, result) => {
+        if (settled) {
+          return;
+        }
+        settled = true;
+        clearTimeout(timer);
+        worker.terminate().catch(() => {});
+        if (error) {
+          reject(error);
+        } else {
+          resolve(result);
+        }
+      };
+
+      const timer = setTimeout(() => settle(new ExecError('invalid_request', 'PATTERN_TIMEOUT',
+        `normalize patterns took longer than ${this.config.patternTimeoutMs}ms; simplify them`, { param: 'normalize' })), this.config.patternTimeoutMs);
+
+      worker.on('message', result => settle(null, result));
+      worker.on('error', error => settle(new ExecError('invalid_request', 'INVALID_PATTERN',
+        `normalize patterns failed: ${error.message}`, { param: 'normalize', cause: error })));
+      worker.on('exit', code => settle(new ExecError('infrastructure', 'PATTERN_WORKER_EXITED', `Pattern worker exited with code ${code}`)));
+    });
+  }
+
+  /**
+   * @param {Object} options - { presets, patterns } to normalize before comparing
+   * @returns {Object} { base, other, comparable, mismatches, status, exitCode,
+   *   durationMs, streams: { stdout, stderr } or { output }, normalized }
+   */
+  async diff(userId, baseId, otherId, options = {}) {
+    const rules = this.compileRules(options);
+
+    const [base, other] = await Promise.all([
+      executionHistory.get(userId, baseId),
+      executionHistory.get(userId, otherId)
+    ]);
+    if (!base || !other) {
+      const missing = base ? otherId : baseId;
+      throw new ExecError('not_found', 'EXECUTION_NOT_FOUND', `No execution ${missing} in your history`, { param: base ? 'otherId' : 'id' });
+    }
+
+    const mismatches = ['runtime', 'codeHash']
+      .filter(field => base[field] !== other[field])
+      .map(field => ({ field, base: base[field], other: other[field] }));
+
+    // Records from before streams were stored apart only have the combined output
+    const separate = [base, other].every(record => typeof record.output.stdout === 'string');
+    const names = separate ? ['stdout', 'stderr'] : ['output'];
+    const sides = names.flatMap(stream => [this.read(base, stream), this.read(other, stream)]);
+    const texts = await this.normalize(sides.map(side => side.text), rules);
+
+    const streams = {};
+    names.forEach((stream, index) => {
+      const [before, after] = [2 * index, 2 * index + 1].map(side => ({ ...sides[side], text: texts[side] }));
+      streams[stream] = this.diffStream(before, after);
+    });
+
+    return {
+      base: this.describe(base),
+      other: this.describe(other),
+      comparable: mismatches.length === 0,
+      mismatches,
+      status: this.compare(base.status, other.status),
+      exitCode: this.compare(base.exitCode, other.exitCode),
+      durationMs: {
+        base: base.timing.durationMs,
+        other: other.timing.durationMs,
+        delta: base.timing.durationMs !== null && other.timing.durationMs !== null
+          ? other.timing.durationMs - base.timing.durationMs
+          : null
+      },
+      streams,
+      normalized: rules.map(rule => rule.name)
+    };
+  }
+
+  // One stream as stored, without the truncation marker
+  read(record, stream) {
+    const text = stream === 'output' ? record.output.text : record.output[stream];
+    const stats = record.output.streams && record.output.streams[stream];
+    return {
+      text: text.replace(TRUNCATION_MARKER, ''),
+      truncated: TRUNCATION_MARKER.test(text) || Boolean(stats && stats.truncated)
+    };
+  }
+
+  diffStream(before, after) {
+    const diff = diffLines(before.text, after.text, {
+      context: this.config.contextLines,
+      maxEdits: this.config.maxEdits
+    });
+
+    // Differences past a cut are unknown, so identical only covers what was kept
+    return {
+      ...diff,
+      truncated: { base: before.truncated, other: after.truncated }
+    };
+  }
+
+  compare(base, other) {
+    return { base, other, equal: base === other };
+  }
+
+  describe(record) {
+    return {
+      executionId: record.executionId,
+      runtime: record.runtime,
+      codeHash: record.codeHash,
+      startedAt: record.timing.startedAt
+    };
+  }
+}
+
+module.exports = new ExecutionDiff();
+module.exports.ExecutionDiff = ExecutionDiff;
+module.exports.PRESETS = PRESETS;
\ No newline at end of file
@@ -0,0 +1,319 @@
+const crypto = require('crypto');
+const config = require('../config');
+const logger = require('../utils/logger');
+const outputSpill = require('./outputSpill');
+const artifactStore = require('./artifactStore');
+
+/**
+ * Execution history repositories. Both implement:
+ *
+ *   save(record)
+ *   findById(userId, executionId) -> record | null
+ *   list(userId, { limit, before: { startedAt, executionId } | null }) -> [record] newest first
+ *   deleteOlderThan(date) -> number of records removed
+ */
+class MongoExecutionRepository {
+  constructor() {
+    // Loaded lazily so the memory store works without a database
+    this.model = require('../models/ExecutionRecord');
+  }
+
+  async save(record) {
+    await this.model.create(record);
+  }
+
+  async findById(userId, executionId) {
+    return this.model.findOne({ userId, executionId }).lean();
+  }
+
+  async list(userId, { limit, before = null }) {
+    const filter = { userId };
+    if (before) {
+      filter.$or = [
+        { 'timing.startedAt': { $lt: before.startedAt } },
+        { 'timing.startedAt': before.startedAt, executionId: { $lt: before.executionId } }
+      ];
+    }
+
+    return this.model.find(filter)
+      .select('-source.code -source.files -source.stdin -source.env -output.text -output.stdout -output.stderr')
+      .sort({ 'timing.startedAt': -1, executionId: -1 })
+      .limit(limit)
+      .lean();
+  }
+
+  async deleteOlderThan(date) {
+    const result = await this.model.deleteMany({ 'timing.startedAt': { $lt: date } });
+    return result.deletedCount || 0;
+  }
+}
+
+// Keyed per user as well, so one user's record can't replace another's
+const recordKey = (userId, executionId) => `${userId}:${executionId}`;
+
+class MemoryExecutionRepository {
+  constructor() {
+    this.records = new Map(); // recordKey(userId, executionId) -> record
+  }
+
+  async save(record) {
+    this.records.set(recordKey(record.userId, record.executionId), { ...record });
+  }
+
+  async findById(userId, executionId) {
+    const record = this.records.get(recordKey(userId, executionId));
+    return record ? { ...record } : null;
+  }
+
+  async list(userId, { limit, before = null }) {
+    return Array.from(this.records.values())
+      .filter(record => record.userId === userId)
+      .filter(record => !before || compareNewestFirst(record, before) > 0)
+      .sort(compareNewestFirst)
+      .slice(0, limit)
+      .map(record => ({ ...record }));
+  }
+
+  async deleteOlderThan(date) {
+    let removed = 0;
+    for (const [key, record] of this.records.entries()) {
+      if (record.timing.startedAt < date) {
+        this.records.delete(key);
+        removed++;
+      }
+    }
+    return removed;
+  }
+}
+
+// Sort order of the history: newest start first, then executionId descending
+const compareNewestFirst = (a, b) => {
+  const aStarted = a.timing ? a.timing.startedAt : a.startedAt;
+  const bStarted = b.timing ? b.timing.startedAt : b.startedAt;
+  if (aStarted.getTime() !== bStarted.getTime()) {
+    return bStarted - aStarted;
+  }
+  const aId = a.executionId;
+  const bId = b.executionId;
+  return aId < bId ? 1 : (aId > bId ? -1 : 0);
+};
+
+/**
+ * Persists finished executions per user, pages through them with opaque
+ * cursors and prunes records past the retention window.
+ */
+class ExecutionHistory {
+  constructor() {
+    this.config = { ...config.executionHistory };
+    this.repository = null;
+    this.pruneInterval = null;
+  }
+
+  getRepository() {
+    if (!this.repository) {
+      this.repository = this.config.store === 'memory'
+        ? new MemoryExecutionRepository()
+        : new MongoExecutionRepository();
+    }
+    return this.repository;
+  }
+
+  setRepository(repository) {
+    this.repository = repository;
+  }
+
+  /**
+   * Persist a finished execution. Failures are logged, never thrown: history
+   * is a convenience and must not break the execution it describes.
+   * @param {Object} executionData - Execution record from executionService
+   */
+  async record(executionData) {
+    if (!executionData.userId) {
+      return;
+    }
+
+    try {
+      await this.getRepository().save(this.toRecord(executionData));
+    } catch (error) {
+      logger.error(`Failed to persist execution ${executionData.id} to history:`, error);
+    }
+  }
+
+  toRecord(executionData) {
+    const files = executionData.files && typeof executionData.files === 'object'
+      ? Object.entries(executionData.files).map(([path, content]) => ({ path, content: String(content) }))
+      : [];
+    const code = typeof executionData.code === 'string' ? executionData.code : null;
+    const { queueTicket } = executionData;
+
+    return {
+      executionId: executionData.id,
+      userId: executionData.userId,
+      runtime: executionData.language,
+      mode: executionData.mode || 'interactive',
+      requestId: executionData.requestId || null,
+      source: {
+        code,
+        filename: executionData.filename || 'main',
+        files,
+        entrypoint: executionData.entrypoint || null,
+        workspaceId: executionData.workspaceId || null,
+        stdin: typeof executionData.stdin === 'string' ? executionData.stdin : null,
+        args: Array.isArray(executionData.args) ? executionData.args : [],
+        env: executionData.env || {},
+        secretsWorkspaceId: executionData.secretsWorkspaceId || null,
+        artifacts: Array.isArray(executionData.artifactPatterns) ? executionData.artifactPatterns : []
+      },
+      codeHash: this.hashSource(code, files),
+      status: executionData.status,
+      exitCode: executionData.exitCode === undefined ? null : executionData.exitCode,
+      killedReason: executionData.killedReason || null,
+      timeoutPhase: executionData.timeoutPhase || null,
+      error: executionData.error ? String(executionData.error) : null,
+      errorCode: executionData.errorCode || null,
+      output: {
+        ...this.truncateOutput(executionData.output || ''),
+        stdout: typeof executionData.stdout === 'string' ? this.truncateOutput(executionData.stdout).text : null,
+        stderr: typeof executionData.stderr === 'string' ? this.truncateOutput(executionData.stderr).text : null,
+        streams: executionData.outputStreams || null
+      },
+      artifacts: Array.isArray(executionData.artifacts) ? executionData.artifacts : [],
+      artifactsTruncated: Boolean(executionData.artifactsTruncated),
+      timing: {
+        startedAt: executionData.startTime,
+        finishedAt: executionData.endTime || null,
+        durationMs: typeof executionData.duration === 'number' ? executionData.duration : null,
+        compileDurationMs: executionData.compileDurationMs || null,
+        buildCache: executionData.buildCache || null,
+        queueWaitMs: queueTicket && queueTicket.startedAt ? queueTicket.startedAt - queueTicket.enqueuedAt : null
+      },
+      rerunOf: executionData.rerunOf || null
+    };
+  }
+
+  /**
+   * sha256 over the code, or over every path and content of a project
+   */
+  hashSource(code, files = []) {
+    const hash = crypto.createHash('sha256');
+    if (files.length > 0) {
+      for (const file of [...files].sort((a, b) => a.path.localeCompare(b.path))) {
+        hash.update(`${file.path}\0${file.content}\0`);
+      }
+    } else {
+      hash.update(code || '');
+    }
+    return hash.digest('hex');
+  }
+
+  /**
+   * Keep the first outputLimitBytes of the output, marking where it was cut
+   */
+  truncateOutput(output) {
+    const buffer = Buffer.from(output, 'utf8');
+    const limit = this.config.outputLimitBytes;
+
+    if (buffer.length <= limit) {
+      return { text: output, bytes: buffer.length, truncated: false };
+    }
+
+    // Drop a trailing partial UTF-8 sequence rather than store a broken character
+    const text = buffer.subarray(0, limit).toString('utf8').replace(/\uFFFD$/, '');
+    return {
+      text: `${text}\n[output truncated: ${buffer.length - limit} more bytes]`,
+      bytes: buffer.length,
+      truncated: true
+    };
+  }
+
+  /**
+   * A page of the user's history, newest first
+   * @param {Object} options - { limit, cursor } where cursor is a previous page's nextCursor
+   * @returns {Object} { records, nextCursor } (nextCursor is null on the last page)
+   */
+  async list(userId, { limit = this.config.defaultPageSize, cursor = null } = {}) {
+    const pageSize = Math.min(Math.max(limit, 1), this.config.maxPageSize);
+    const before = cursor ? this.decodeCursor(cursor) : null;
+
+    // One extra record tells us whether another page exists
+    const records = await this.getRepository().list(userId, { limit: pageSize + 1, before });
+    const page = records.slice(0, pageSize);
+    const last = page[page.length - 1];
+
+    return {
+      records: page,
+      nextCursor: records.length > pageSize ? this.encodeCursor(last) : null
+    };
+  }
+
+  async get(userId, executionId) {
+    return this.getRepository().findById(userId, executionId);
+  }
+
+  encodeCursor(record) {
+    const payload = JSON.stringify({ t: new Date(record.timing.startedAt).toISOString(), id: record.executionId });
+    return Buffer.from(payload).toString('base64url');
+  }
+
+  decodeCursor(cursor) {
+    try {
+      const { t, id } = JSON.parse(Buffer.from(cursor, 'base64url').toString('utf8'));
+      const startedAt = new Date(t);
+      if (typeof id !== 'string' || Number.isNaN(startedAt.getTime())) {
+        throw new Error('malformed cursor');
+      }
+      return { startedAt, executionId: id };
+    } catch (error) {
+      const invalid = new Error('Invalid cursor');
+      invalid.code = 'INVALID_CURSOR';
+      throw invalid;
+    }
+  }
+
+  /**
+   * Delete records that started before the retention window with their
+   * artifacts, and spilled output files past theirs
+   */
+  async prune() {
+    const cutoff = new Date(Date.now() - this.config.retentionDays * 24 * 60 * 60 * 1000);
+    const removed = await this.getRepository().deleteOlderThan(cutoff);
+    if (removed > 0) {
+      logger.info(`Pruned ${removed} execution history records older than ${this.config.retentionDays} days`);
+    }
+
+    try {
+      await artifactStore.removeOlderThan(cutoff);
+    } catch (error) {
+      logger.error('Artifact prune failed:', error);
+    }
+
+    try {
+      await outputSpill.prune();
+    } catch (error) {
+      logger.error('Output spill prune failed:', error);
+    }
+    return removed;
+  }
+
+  /**
+   * Start the periodic retention job
+   */
+  start() {
+    this.stop();
+    this.pruneInterval = setInterval(() => {
+      this.prune().catch(error => logger.error('Execution history prune failed:', error));
+    }, this.config.pruneIntervalMs);
+    this.pruneInterval.unref();
+  }
+
+  stop() {
+    if (this.pruneInterval) {
+      clearInterval(this.pruneInterval);
+      this.pruneInterval = null;
+    }
+  }
+}
+
+module.exports = new ExecutionHistory();
+module.exports.MongoExecutionRepository = MongoExecutionRepository;
+module.exports.MemoryExecutionRepository = MemoryExecutionRepository;
\ No newline at end of file
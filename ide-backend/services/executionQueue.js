@@ -0,0 +1,294 @@
+const config = require('../config');
+const logger = require('../utils/logger');
+const tracing = require('../utils/tracing');
+const executionMetrics = require('./metrics');
+
+// Wait time histogram buckets in seconds (Prometheus style, cumulative "le")
+const WAIT_BUCKETS = [0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60];
+
+/**
+ * Bounded worker queue in front of the executor: a global concurrency limit,
+ * a per-user limit and a bounded FIFO wait queue. The shared instance takes
+ * config.executionQueue; benchmark runs have a queue of their own.
+ */
+class ExecutionQueue {
+  /**
+   * @param {Object} settings - { enabled, maxConcurrent, perUserLimit, maxQueueDepth, retryAfterSeconds, stuckAfterMs }
+   * @param {Object} options - { exportMetrics } to report wait times to Prometheus
+   */
+  constructor(settings = config.executionQueue, { exportMetrics = true } = {}) {
+    this.config = { ...settings };
+    this.exportMetrics = exportMetrics;
+    this.running = 0;
+    this.runningByUser = new Map(); // userId -> running count
+    this.active = new Set(); // running tickets
+    this.waiting = []; // FIFO of pending tickets
+    this.draining = false; // set on shutdown, new executions are refused
+
+    this.resetMetrics();
+  }
+
+  resetMetrics() {
+    this.metrics = {
+      enqueued: 0,
+      dispatched: 0,
+      rejected: 0,
+      cancelled: 0,
+      waitTime: {
+        buckets: WAIT_BUCKETS.map(le => ({ le, count: 0 })),
+        sum: 0,
+        count: 0
+      }
+    };
+  }
+
+  /**
+   * Request an execution slot. Returns a ticket whose `ready` promise resolves
+   * once the execution may start (cancelled tickets resolve too, check
+   * `ticket.state`); call `release()` when it finishes or `cancel()` if the
+   * client goes away while waiting. Throws a QUEUE_FULL
+   * error (with `retryAfter` seconds) when the wait queue is at capacity, or
+   * SHUTTING_DOWN once the backend has started draining.
+   * @param {string} userId - User ID
+   * @param {Object} options - { onPosition(position) } called while queued,
+   *   { timeoutMs } how long the slot may be held before it counts as stuck
+   */
+  enqueue(userId, { onPosition, timeoutMs = null } = {}) {
+    if (this.draining) {
+      throw this.shuttingDownError();
+    }
+
+    const ticket = {
+      userId,
+      enqueuedAt: Date.now(),
+      onPosition,
+      timeoutMs: timeoutMs || this.config.stuckAfterMs,
+      state: 'waiting',
+      release: () => this.release(ticket),
+      cancel: () => this.cancel(ticket)
+    };
+
+    ticket.ready = new Promise((resolve) => {
+      ticket.resolve = resolve;
+    });
+
+    if (!this.config.enabled) {
+      ticket.state = 'bypassed';
+      ticket.position = 0;
+      ticket.resolve();
+      return ticket;
+    }
+
+    this.metrics.enqueued++;
+    ticket.span = tracing.startSpan('execution.queue_wait', { 'studio.user_id': userId });
+
+    // Waiting tickets are only ever blocked by a limit, so a free slot can be taken directly
+    if (this.canRun(userId)) {
+      this.start(ticket);
+      return ticket;
+    }
+
+    if (this.waiting.length >= this.config.maxQueueDepth) {
+      this.metrics.rejected++;
+      const error = new Error('Execution queue is full, try again later');
+      error.code = 'QUEUE_FULL';
+      error.retryAfter = this.config.retryAfterSeconds;
+      tracing.endSpan(ticket.span, { 'studio.queue.outcome': 'rejected' }, error);
+      throw error;
+    }
+
+    this.waiting.push(ticket);
+    ticket.position = this.waiting.length;
+    this.notifyPosition(ticket);
+
+    logger.info(`Execution for user ${userId} queued at position ${ticket.position}`);
+    return ticket;
+  }
+
+  /**
+   * Stop accepting executions. Running ones keep their slots; waiting ones
+   * never got to start, so they are cancelled.
+   */
+  drain() {
+    this.draining = true;
+
+    const waiting = this.waiting.splice(0);
+    for (const ticket of waiting) {
+      ticket.state = 'cancelled';
+      this.metrics.cancelled++;
+      tracing.endSpan(ticket.span, { 'studio.queue.outcome': 'cancelled' });
+      ticket.resolve();
+    }
+
+    if (waiting.length > 0) {
+      logger.info(`Execution queue draining, cancelled ${waiting.length} waiting executions`);
+    }
+  }
+
+  shuttingDownError() {
+    const error = new Error('Server is shutting down, try again shortly');
+    error.code = 'SHUTTING_DOWN';
+    error.retryAfter = config.shutdown.retryAfterSeconds;
+    return error;
+  }
+
+  canRun(userId) {
+    return this.running < this.config.maxConcurrent &&
+      (this.runningByUser.get(userId) || 0) < this.config.perUserLimit;
+  }
+
+  start(ticket) {
+    ticket.state = 'running';
+    ticket.position = 0;
+    ticket.startedAt = Date.now();
+    this.running++;
+    this.active.add(ticket);
+    this.runningByUser.set(ticket.userId, (this.runningByUser.get(ticket.userId) || 0) + 1);
+
+    this.metrics.dispatched++;
+    this.observeWait((ticket.startedAt - ticket.enqueuedAt) / 1000);
+    tracing.endSpan(ticket.span, { 'studio.queue.outcome': 'started', 'studio.queue.wait_ms': ticket.startedAt - ticket.enqueuedAt });
+
+    ticket.resolve();
+  }
+
+  /**
+   * Free a running ticket's slot and dispatch waiting executions
+   */
+  release(ticket) {
+    if (ticket.state !== 'running') {
+      return;
+    }
+
+    ticket.state = 'done';
+    this.running--;
+    this.active.delete(ticket);
+
+    const userRunning = (this.runningByUser.get(ticket.userId) || 1) - 1;
+    if (userRunning > 0) {
+      this.runningByUser.set(ticket.userId, userRunning);
+    } else {
+      this.runningByUser.delete(ticket.userId);
+    }
+
+    this.dispatch();
+  }
+
+  /**
+   * Drop a ticket that is still waiting
+   */
+  cancel(ticket) {
+    if (ticket.state === 'running') {
+      this.release(ticket);
+      return;
+    }
+
+    const index = this.waiting.indexOf(ticket);
+    if (index !== -1) {
+      this.waiting.splice(index, 1);
+      ticket.state = 'cancelled';
+      this.metrics.cancelled++;
+      tracing.endSpan(ticket.span, { 'studio.queue.outcome': 'cancelled' });
+      ticket.resolve(); // waiters check ticket.state after `await ticket.ready`
+      this.updatePositions(index);
+    }
+  }
+
+  /**
+   * Start waiting tickets in FIFO order, skipping users at their own limit
+   */
+  dispatch() {
+    let firstChanged = -1;
+
+    for (let i = 0; i < this.waiting.length && this.running < this.config.maxConcurrent;) {
+      const ticket = this.waiting[i];
+      if (this.canRun(ticket.userId)) {
+        this.waiting.splice(i, 1);
+        this.start(ticket);
+        firstChanged = firstChanged === -1 ? i : Math.min(firstChanged, i);
+      } else {
+        i++;
+      }
+    }
+
+    if (firstChanged !== -1) {
+      this.updatePositions(firstChanged);
+    }
+  }
+
+  updatePositions(fromIndex) {
+    for (let i = fromIndex; i < this.waiting.length; i++) {
+      const ticket = this.waiting[i];
+      if (ticket.position !== i + 1) {
+        ticket.position = i + 1;
+        this.notifyPosition(ticket);
+      }
+    }
+  }
+
+  notifyPosition(ticket) {
+    if (!ticket.onPosition) {
+      return;
+    }
+
+    try {
+      ticket.onPosition(ticket.position);
+    } catch (error) {
+      logger.warn('Queue position callback failed:', error.message);
+    }
+  }
+
+  observeWait(seconds) {
+    if (this.exportMetrics) {
+      executionMetrics.observeQueueWait(seconds);
+    }
+
+    const { waitTime } = this.metrics;
+    waitTime.sum += seconds;
+    waitTime.count++;
+
+    for (const bucket of waitTime.buckets) {
+      if (seconds <= bucket.le) {
+        bucket.count++;
+      }
+    }
+  }
+
+  /**
+   * Running tickets held past their timeout: a release that never came
+   * means a slot is lost until restart
+   * @returns {Array} [{ userId, runningMs, timeoutMs }]
+   */
+  getStuck(now = Date.now()) {
+    return Array.from(this.active)
+      .filter(ticket => now - ticket.startedAt > ticket.timeoutMs)
+      .map(ticket => ({ userId: ticket.userId, runningMs: now - ticket.startedAt, timeoutMs: ticket.timeoutMs }));
+  }
+
+  /**
+   * Queue depth, concurrency and wait time histogram
+   */
+  getMetrics() {
+    return {
+      enabled: this.config.enabled,
+      draining: this.draining,
+      queueDepth: this.waiting.length,
+      running: this.running,
+      maxConcurrent: this.config.maxConcurrent,
+      perUserLimit: this.config.perUserLimit,
+      maxQueueDepth: this.config.maxQueueDepth,
+      enqueued: this.metrics.enqueued,
+      dispatched: this.metrics.dispatched,
+      rejected: this.metrics.rejected,
+      cancelled: this.metrics.cancelled,
+      waitTimeSeconds: {
+        buckets: this.metrics.waitTime.buckets.map(bucket => ({ ...bucket })),
+        sum: this.metrics.waitTime.sum,
+        count: this.metrics.waitTime.count
+      }
+    };
+  }
+}
+
+module.exports = new ExecutionQueue();
+module.exports.ExecutionQueue = ExecutionQueue;
\ No newline at end of file
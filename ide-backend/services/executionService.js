@@ -1,114 +1,279 @@
-const dockerService = require('./dockerService');
+const sandboxes = require('./sandboxes');
 const logger = require('../utils/logger');
 const crypto = require('crypto');
+const config = require('../config');
+const OutputFramer = require('../utils/outputFramer');
+const OutputLimiter = require('../utils/outputLimiter');
+const SecretScrubber = require('../utils/secretScrubber');
+const { ExecError, classify, outcome, validationFailed } = require('../utils/execErrors');
+const diagnosticsParser = require('../utils/diagnostics');
+const executionQueue = require('./executionQueue');
+const executionMetrics = require('./metrics');
+const executionAudit = require('./executionAudit');
+const executionHistory = require('./executionHistory');
+const outputSpill = require('./outputSpill');
+const artifactStore = require('./artifactStore');
+const artifactPatterns = require('../utils/artifactPatterns');
+const requestContext = require('../utils/requestContext');
+const tracing = require('../utils/tracing');
+const fileSystem = require('../utils/fileSystem');
+const workspaceWatcher = require('./workspaceWatcher');
+const workspaceQuota = require('./workspaceQuota');
+const workspaceSecrets = require('./workspaceSecrets');
+const executionSessions = require('./executionSessions');
+const screening = require('./screening');
+
+// Socket event for an output frame
+const outputEvent = (executionId, frame) => ({
+  executionId,
+  ...frame,
+  output: frame.data, // legacy field for clients that predate framing
+  timestamp: new Date()
+});
+
+// Socket event that carries each kind of final session event
+const FINAL_EVENTS = {
+  exit: 'execution:exit',
+  error: 'execution:error',
+  cancelled: 'execution:cancelled',
+  stopped: 'execution:stopped'
+};
 
 class ExecutionService {
   constructor() {
     this.activeExecutions = new Map(); // Track active executions
     this.executionHistory = new Map(); // Store execution history
+    this.queuedReruns = new Map(); // Re-runs waiting for a queue slot, by execution ID
+    this.executionSecrets = new Map(); // execution ID -> { values, release } while it runs with workspace secrets
+    this.recentFrames = new Map(); // execution ID -> latest output frames of socket executions, for reattaching here
   }
 
   /**
-   * Start code execution with WebSocket streaming
+   * Start code execution with WebSocket streaming. The execution ID is
+   * generated here unless a server-side caller (gRPC) already did; it never
+   * comes from the client. Such a caller may also pass the `ticket` it took
+   * after screening the code itself, so it creates the container only once
+   * the slot is free; screening and queueing are skipped then.
    */
-  async startExecution(socket, { containerId, code, filename = 'main', executionId = null }) {
+  async startExecution(socket, { containerId, code, filename = 'main', executionId = null, stdin = null, interactive = false, files = null, entrypoint = null, args = [], env = {}, useSecrets = false, requestId = null, compileTimeoutMs = null, runTimeoutMs = null, artifacts = [], ticket: admitted = null }) {
     const execId = executionId || crypto.randomUUID();
+    const reqId = requestId || requestContext.getRequestId() || crypto.randomUUID();
+    let ticket = admitted;
+    let aborted = false;
+
+    // One handler for the whole run: leave the queue while waiting; while
+    // the slot is held but the program isn't registered yet (sandbox.exec
+    // covers the compile phase), flag it so it is killed once exec returns;
+    // once it runs, give the client a chance to reattach, then cancel it
+    socket.on('disconnect', () => {
+      if (this.activeExecutions.has(execId)) {
+        this.detachSocket(execId, socket);
+      } else if (ticket && ticket.state === 'waiting') {
+        ticket.cancel();
+      } else {
+        aborted = true;
+      }
+    });
 
     try {
-      if (!dockerService.isAvailable) {
-        throw new Error('Code execution is not available: Docker is not running');
+      const sandbox = sandboxes.forContainer(containerId);
+      if (!sandbox.isAvailable()) {
+        throw new ExecError('unavailable', 'DOCKER_UNAVAILABLE', 'Code execution is not available: Docker is not running');
       }
 
       logger.info(`Starting execution ${execId} in container ${containerId}`);
 
       // Verify container exists and get info
-      const containerInfo = await dockerService.getContainerInfo(containerId);
+      const containerInfo = await sandbox.inspect(containerId);
       if (!containerInfo) {
-        throw new Error('Container not found');
+        throw new ExecError('not_found', 'CONTAINER_NOT_FOUND', 'Container not found');
+      }
+
+      // Secrets come from the workspace mounted in the container
+      const secretsWorkspaceId = useSecrets ? containerInfo.mountWorkspaceId : null;
+      if (useSecrets) {
+        if (!secretsWorkspaceId) {
+          throw new ExecError('invalid_request', 'NO_WORKSPACE_MOUNTED', 'use_secrets needs a container with a persistent workspace mounted', { param: 'use_secrets' });
+        }
+        await workspaceSecrets.authorize(secretsWorkspaceId, socket.userId);
+      }
+
+      const artifactsInput = artifactPatterns.validate(artifacts);
+      if (!artifactsInput.isValid) {
+        throw validationFailed(artifactsInput.errors.map(msg => ({ param: 'artifacts', msg })));
+      }
+
+      if (!ticket) {
+        await this.screen(socket.userId, { language: containerInfo.language, code, files });
+
+        // Wait for a slot in the execution queue, reporting our position meanwhile
+        ticket = executionQueue.enqueue(socket.userId, {
+          onPosition: (position) => {
+            socket.emit('execution:queued', { executionId: execId, event: 'queued', position });
+          }
+        });
+      }
+
+      if (aborted && ticket.state === 'waiting') {
+        ticket.cancel();
+      }
+
+      await ticket.ready;
+      if (ticket.state === 'cancelled') {
+        return execId;
       }
 
       // Start execution
-      const execution = await dockerService.executeCode(containerId, code, filename);
+      const execOptions = { stdin, interactive };
+      if (requestId) {
+        execOptions.requestId = requestId;
+      }
+      if (files) {
+        execOptions.files = files;
+        execOptions.entrypoint = entrypoint;
+      }
+      if (args && args.length > 0) {
+        execOptions.args = args;
+      }
+      if (env && Object.keys(env).length > 0) {
+        execOptions.env = env;
+      }
+      // Read now rather than before queueing, so changes made meanwhile apply
+      if (secretsWorkspaceId) {
+        execOptions.secrets = await workspaceSecrets.forExecution(secretsWorkspaceId, socket.userId);
+      }
+      // Per-call limits can only lower the runtime defaults; dockerService clamps them
+      if (compileTimeoutMs) {
+        execOptions.compileTimeoutMs = compileTimeoutMs;
+      }
+      if (runTimeoutMs) {
+        execOptions.runTimeoutMs = runTimeoutMs;
+      }
+
+      if (aborted) {
+        ticket.release();
+        return execId;
+      }
+      const execution = await sandbox.exec(containerId, code, filename, execOptions);
+      if (aborted) {
+        await this.abandonStart(containerId, execution, ticket);
+        return execId;
+      }
 
       // Track execution
       const executionData = {
         id: execId,
+        requestId: reqId,
         containerId,
+        userId: socket.userId || null,
         code,
         filename,
+        files,
+        entrypoint,
+        stdin,
+        args,
+        env,
+        secretsWorkspaceId,
+        artifactPatterns: artifactsInput.patterns,
         language: containerInfo.language,
         startTime: new Date(),
         status: 'running',
         output: '',
+        stdout: '',
+        stderr: '',
+        exitCode: null,
+        killedReason: null,
         error: null,
-        socket
+        execution,
+        socket,
+        queueTicket: ticket,
+        ...executionAudit.measureCode(code, files)
       };
 
-      this.activeExecutions.set(execId, executionData);
+      this.registerExecution(executionData, { secrets: execOptions.secrets });
+      this.recentFrames.set(execId, []);
+      executionSessions.track(executionData);
 
       // Emit execution started event
       socket.emit('execution:started', {
         executionId: execId,
+        requestId: reqId,
         containerId,
         language: containerInfo.language,
-        startTime: executionData.startTime
+        startTime: executionData.startTime,
+        network_enabled: execution.networkEnabled
       });
 
-      // Stream output to client
-      execution.stream.on('data', (chunk) => {
-        const output = chunk.toString();
-        executionData.output += output;
+      // Stream demultiplexed stdout/stderr frames to client. Events go to
+      // executionData.socket, which changes when the client reattaches.
+      this.streamExecution(execution, executionData, {
+        onFrame: (frame) => {
+          this.keepFrame(execId, frame);
+          executionSessions.frame(execId, frame);
+          executionData.socket.emit('execution:output', outputEvent(execId, frame));
+        },
+        onExit: ({ status, code, duration_ms, killed_reason, timeout_phase, diagnostics, cache, compile_ms, stdout_truncated, stderr_truncated, artifacts }) => {
+          this.finishExecution(execId);
 
-        socket.emit('execution:output', {
-          executionId: execId,
-          output,
-          timestamp: new Date()
-        });
-      });
-
-      execution.stream.on('end', () => {
-        executionData.status = 'completed';
-        executionData.endTime = new Date();
-        executionData.duration = executionData.endTime - executionData.startTime;
-
-        // Move to history
-        this.executionHistory.set(execId, { ...executionData });
-        this.activeExecutions.delete(execId);
-
-        socket.emit('execution:completed', {
-          executionId: execId,
-          status: 'completed',
-          endTime: executionData.endTime,
-          duration: executionData.duration,
-          output: executionData.output
-        });
+          const exit = {
+            executionId: execId,
+            event: 'exit',
+            status,
+            code,
+            duration_ms,
+            killed_reason,
+            timeout_phase,
+            diagnostics,
+            cache,
+            compile_ms,
+            stdout_truncated,
+            stderr_truncated,
+            artifacts
+          };
+          executionData.socket.emit('execution:exit', exit);
+          executionSessions.finish(execId, exit);
 
-        logger.info(`Execution ${execId} completed in ${executionData.duration}ms`);
-      });
-
-      execution.stream.on('error', (error) => {
-        executionData.status = 'error';
-        executionData.error = error.message;
-        executionData.endTime = new Date();
-        executionData.duration = executionData.endTime - executionData.startTime;
+          executionData.socket.emit('execution:completed', {
+            executionId: execId,
+            status: 'completed',
+            endTime: executionData.endTime,
+            duration: executionData.duration,
+            exitCode: code,
+            killed_reason,
+            timeout_phase,
+            output: executionData.output,
+            diagnostics,
+            cache
+          });
 
-        // Move to history
-        this.executionHistory.set(execId, { ...executionData });
-        this.activeExecutions.delete(execId);
-
-        socket.emit('execution:error', {
-          executionId: execId,
-          error: error.message,
-          endTime: executionData.endTime,
-          duration: executionData.duration
-        });
+          logger.info(`Execution ${execId} completed in ${executionData.duration}ms`);
+        },
+        onError: (error) => {
+          this.finishExecution(execId);
 
-        logger.error(`Execution ${execId} failed:`, error);
-      });
+          const failure = {
+            executionId: execId,
+            event: 'error',
+            requestId: reqId,
+            error: error.message,
+            endTime: executionData.endTime,
+            duration: executionData.duration
+          };
+          executionData.socket.emit('execution:error', failure);
+          executionSessions.finish(execId, failure);
 
-      // Handle socket disconnect
-      socket.on('disconnect', () => {
-        this.stopExecution(execId);
+          logger.error(`Execution ${execId} failed:`, error);
+        },
+        onCancel: ({ reason }) => {
+          const cancelled = {
+            executionId: execId,
+            event: 'cancelled',
+            reason,
+            duration: executionData.duration
+          };
+          executionData.socket.emit('execution:cancelled', cancelled);
+          executionSessions.finish(execId, cancelled);
+        }
       });
 
       return execId;
@@ -116,9 +281,18 @@ class ExecutionService {
     } catch (error) {
       logger.error('Failed to start execution:', error);
 
+      if (ticket) {
+        ticket.release();
+      }
+
+      const classified = classify(error);
       socket.emit('execution:error', {
         executionId: execId,
-        error: error.message,
+        requestId: reqId,
+        error: classified.message,
+        code: classified.code,
+        kind: classified.kind,
+        retryAfter: classified.retryAfter || undefined,
         timestamp: new Date()
       });
 
@@ -126,6 +300,590 @@ class ExecutionService {
     }
   }
 
+  /**
+   * Kill a program whose client went away while sandbox.exec was starting
+   * it, then free the slot it held
+   */
+  async abandonStart(containerId, execution, ticket) {
+    logger.info(`Client left while execution in ${containerId} was starting, killing it`);
+    try {
+      if (execution.stream) {
+        execution.stream.destroy();
+      }
+      await sandboxes.forContainer(containerId).kill(execution, 0);
+    } catch (error) {
+      logger.error(`Failed to kill execution in ${containerId} after disconnect:`, error);
+    } finally {
+      ticket.release();
+    }
+  }
+
+  /**
+   * Run a stored history record again in `containerInfo`, through the normal
+   * queue. Nothing is streamed; the new execution lands in the history like
+   * any other. Workspace runs use the workspace's current files.
+   * @param {Object} record - From executionHistory.get
+   * @param {Object} containerInfo - Container to run in, owned by `userId`
+   * @returns {Object} { executionId, status: 'queued' | 'running' }
+   */
+  async rerunExecution(record, containerInfo, userId) {
+    const execId = crypto.randomUUID();
+    const requestId = requestContext.getRequestId() || crypto.randomUUID();
+    const { source } = record;
+
+    // Records from before args/env were stored run without them
+    const execOptions = { stdin: source.stdin, args: source.args || [], env: source.env || {}, requestId };
+    if (source.workspaceId) {
+      execOptions.mountedFiles = await fileSystem.listFilesRecursive(source.workspaceId);
+      execOptions.entrypoint = source.entrypoint;
+    } else if (source.files && source.files.length > 0) {
+      execOptions.files = Object.fromEntries(source.files.map(file => [file.path, file.content]));
+      execOptions.entrypoint = source.entrypoint;
+    }
+
+    // Re-runs are screened against the rules as they are now
+    await this.screen(userId, {
+      language: containerInfo.language,
+      code: source.code,
+      files: execOptions.files,
+      workspaceId: source.workspaceId,
+      mountedFiles: execOptions.mountedFiles
+    });
+
+    // QUEUE_FULL and SHUTTING_DOWN go back to the caller
+    const ticket = executionQueue.enqueue(userId);
+    this.queuedReruns.set(execId, {
+      id: execId,
+      userId,
+      language: containerInfo.language,
+      status: 'queued',
+      queuedAt: new Date(),
+      rerunOf: record.executionId
+    });
+
+    let executionData = null;
+
+    // Nothing ran (or the run broke down); the history still shows the re-run and why
+    const fail = (error) => {
+      ticket.release();
+      executionData.status = 'error';
+      executionData.error = error.message;
+      executionData.errorCode = classify(error).code;
+      executionData.endTime = new Date();
+      executionData.duration = executionData.endTime - executionData.startTime;
+      executionHistory.record(executionData);
+    };
+
+    ticket.ready.then(async () => {
+      this.queuedReruns.delete(execId);
+      if (ticket.state === 'cancelled') {
+        return;
+      }
+
+      executionData = {
+        id: execId,
+        requestId,
+        containerId: containerInfo.id,
+        userId,
+        code: source.code,
+        filename: source.filename,
+        files: execOptions.files || null,
+        entrypoint: source.entrypoint,
+        stdin: source.stdin,
+        args: execOptions.args,
+        env: execOptions.env,
+        workspaceId: source.workspaceId,
+        secretsWorkspaceId: source.secretsWorkspaceId || null,
+        artifactPatterns: source.artifacts || [],
+        language: containerInfo.language,
+        startTime: new Date(),
+        status: 'running',
+        output: '',
+        stdout: '',
+        stderr: '',
+        exitCode: null,
+        killedReason: null,
+        error: null,
+        queueTicket: ticket,
+        rerunOf: record.executionId,
+        ...executionAudit.measureCode(source.code, execOptions.files)
+      };
+
+      // Workspace secrets as they are now, not as they were for the original run
+      if (source.secretsWorkspaceId) {
+        try {
+          execOptions.secrets = await workspaceSecrets.forExecution(source.secretsWorkspaceId, userId);
+        } catch (error) {
+          logger.warn(`Re-run ${execId} of ${record.executionId} can't use the workspace's secrets:`, error.message);
+          fail(error);
+          return;
+        }
+      }
+
+      try {
+        executionData.execution = await sandboxes.forContainer(containerInfo.id).exec(containerInfo.id, source.code, source.filename, execOptions);
+      } catch (error) {
+        logger.error(`Re-run ${execId} of ${record.executionId} failed to start:`, error);
+        fail(error);
+        return;
+      }
+
+      this.registerExecution(executionData, { secrets: execOptions.secrets });
+      this.streamExecution(executionData.execution, executionData, {
+        onFrame: () => {},
+        onExit: () => this.finishExecution(execId),
+        onError: (error) => {
+          this.finishExecution(execId);
+          logger.error(`Re-run ${execId} stream error:`, error);
+        }
+      });
+    }).catch((error) => {
+      this.queuedReruns.delete(execId);
+      logger.error(`Re-run ${execId} of ${record.executionId} failed:`, error);
+      if (this.activeExecutions.has(execId)) {
+        const active = this.activeExecutions.get(execId);
+        active.status = 'error';
+        active.error = error.message;
+        active.errorCode = classify(error).code;
+        active.endTime = new Date();
+        active.duration = active.endTime - active.startTime;
+        this.finishExecution(execId);
+      } else if (executionData) {
+        fail(error);
+      } else {
+        ticket.release();
+      }
+    });
+
+    logger.info(`Re-running execution ${record.executionId} as ${execId}`);
+    return { executionId: execId, status: ticket.state === 'waiting' ? 'queued' : 'running' };
+  }
+
+  /**
+   * Pre-execution screening of submitted code (see services/screening), run
+   * before the execution takes a queue slot. Blocked code throws
+   * SUBMISSION_REJECTED; flagged code is audited and may run.
+   * @param {Object} submission - { language, code, files, workspaceId, mountedFiles }
+   * @returns {Object} { verdict, matches, reference }
+   */
+  screen(userId, submission) {
+    return screening.screen(userId, submission);
+  }
+
+  /**
+   * Track a running execution under a server-generated ID so it can be
+   * looked up (and cancelled) while it runs. The values of `secrets`
+   * ({ NAME: value }, as injected) are masked in its output and in the
+   * logs until it finishes; they are kept here, never on executionData.
+   */
+  registerExecution(executionData, { secrets = null } = {}) {
+    if (!executionData.id) {
+      executionData.id = crypto.randomUUID();
+    }
+    if (!executionData.requestId) {
+      executionData.requestId = requestContext.getRequestId();
+    }
+
+    const values = Object.values(secrets || {});
+    if (values.length > 0) {
+      this.executionSecrets.set(executionData.id, { values, release: SecretScrubber.track(values) });
+    }
+
+    this.activeExecutions.set(executionData.id, executionData);
+    executionAudit.logStart(executionData);
+    return executionData.id;
+  }
+
+  /**
+   * Move a finished execution to history
+   */
+  finishExecution(executionId) {
+    const executionData = this.activeExecutions.get(executionId);
+    if (!executionData) {
+      return;
+    }
+
+    if (executionData.queueTicket) {
+      executionData.queueTicket.release();
+    }
+
+    executionMetrics.recordExecution(executionData);
+    executionAudit.logFinish(executionData);
+    executionHistory.record(executionData);
+    this.endRunSpan(executionData);
+    this.releaseSecrets(executionId);
+
+    this.executionHistory.set(executionId, { ...executionData });
+    this.activeExecutions.delete(executionId);
+    this.recentFrames.delete(executionId);
+    this.reportWorkspaceChanges(executionData);
+  }
+
+  releaseSecrets(executionId) {
+    const secrets = this.executionSecrets.get(executionId);
+    if (secrets) {
+      secrets.release();
+      this.executionSecrets.delete(executionId);
+    }
+  }
+
+  /**
+   * End the span dockerService opened when the program started
+   */
+  endRunSpan(executionData) {
+    const { execution } = executionData;
+    tracing.endSpan(execution && execution.runSpan, {
+      'studio.execution_id': executionData.id,
+      'studio.execution.status': executionData.status,
+      'studio.exit_code': executionData.exitCode,
+      'studio.killed_reason': executionData.killedReason
+    }, executionData.error ? String(executionData.error) : null);
+  }
+
+  /**
+   * Runs in a mounted workspace may have written files there
+   */
+  reportWorkspaceChanges(executionData) {
+    if (!executionData.workspaceId) {
+      return;
+    }
+    workspaceWatcher.executionFinished(executionData.workspaceId).catch(error =>
+      logger.warn(`Failed to report file changes of execution ${executionData.id}:`, error.message)
+    );
+    // The program wrote straight to the volume, past the file API's checks
+    workspaceQuota.scheduleRefresh(executionData.workspaceId);
+  }
+
+  /**
+   * Demultiplex an exec stream into sequenced stdout/stderr frames and report
+   * the exit code once the stream ends. Frames are flushed at least every
+   * 100ms or 4KB, whichever comes first. Each stream is capped at
+   * config.outputLimits.maxStreamBytes; the rest is drained, and only spilled
+   * to disk when spilling is enabled.
+   */
+  streamExecution(execution, executionData, { onFrame, onExit, onError, onCancel }) {
+    const sandbox = sandboxes.forContainer(execution.containerId);
+    const framer = new OutputFramer((frame) => {
+      executionData[frame.stream] += frame.data;
+      executionData.output += frame.data;
+      onFrame(frame);
+    });
+    const output = new OutputLimiter(framer, {
+      limitBytes: config.outputLimits.maxStreamBytes,
+      spill: this.openSpill(executionData)
+    });
+    // Secrets are masked before output is counted, framed or spilled
+    const secrets = this.executionSecrets.get(executionData.id);
+    const input = secrets ? new SecretScrubber(output, secrets.values) : output;
+
+    const closeOutput = () => {
+      input.close();
+      executionData.outputStreams = output.getStats();
+    };
+    // `status` says how the program ended (see execErrors.outcome)
+    const reportExit = (info) => onExit({
+      status: outcome(executionData),
+      ...info,
+      stdout_truncated: output.isTruncated('stdout'),
+      stderr_truncated: output.isTruncated('stderr')
+    });
+
+    // Invoked by cancelExecution: flush what we have, then report the cancellation
+    executionData.onCancelled = (reason) => {
+      closeOutput();
+      if (onCancel) {
+        onCancel({ reason });
+      }
+    };
+
+    const finish = () => {
+      executionData.endTime = new Date();
+      executionData.duration = executionData.endTime - executionData.startTime;
+    };
+
+    // 'hit' means a cached binary replaced the compile phase
+    executionData.buildCache = execution.cache || null;
+
+    if (execution.compile) {
+      // The build ran in its own exec; replay its buffered output ahead of the program's
+      executionData.compileDurationMs = execution.compile.durationMs;
+      input.write('stdout', execution.compile.stdout);
+      input.write('stderr', execution.compile.stderr);
+    }
+
+    if (!execution.stream) {
+      // Build failed or hit the compile limit, so there is nothing to run.
+      // Report asynchronously so callers can finish wiring up first.
+      setImmediate(() => {
+        closeOutput();
+        if (executionData.status !== 'running') {
+          return;
+        }
+
+        const { exitCode, stderr, timedOut } = execution.compile;
+        executionData.exitCode = exitCode;
+        executionData.killedReason = timedOut
+          ? 'timeout'
+          : (sandbox.isDiskLimitError(stderr) ? 'disk_limit' : null);
+        executionData.timeoutPhase = execution.timeoutPhase;
+        executionData.compileFailed = true;
+        executionData.diagnostics = timedOut ? [] : diagnosticsParser.parse(execution.language, stderr);
+        executionData.status = 'completed';
+        finish();
+
+        if (timedOut) {
+          // The build is still running inside the container
+          sandbox.kill(execution, 0).catch(error =>
+            logger.error(`Failed to kill timed out build ${executionData.id}:`, error)
+          );
+        }
+
+        reportExit({
+          code: executionData.exitCode,
+          duration_ms: executionData.duration,
+          killed_reason: executionData.killedReason,
+          timeout_phase: executionData.timeoutPhase,
+          diagnostics: executionData.diagnostics,
+          cache: executionData.buildCache,
+          compile_ms: executionData.compileDurationMs
+        });
+      });
+
+      return framer;
+    }
+
+    sandbox.streams(execution, input.writer('stdout'), input.writer('stderr'));
+
+    execution.stream.on('end', async () => {
+      // The process is gone; stop forwarding stdin immediately
+      this.closeStdinStream(execution);
+      closeOutput();
+      if (executionData.status !== 'running') {
+        return; // stopped or cancelled, already reported
+      }
+
+      const { exitCode, killedReason } = await sandbox.exitStatus(execution, executionData.stderr);
+      // Copied out while the container is still there
+      await this.collectArtifacts(execution, executionData);
+      if (executionData.status !== 'running') {
+        return;
+      }
+      executionData.exitCode = exitCode;
+      executionData.killedReason = killedReason;
+      // Structured compile/runtime errors for inline editor markers
+      executionData.diagnostics = executionData.exitCode === 0
+        ? []
+        : diagnosticsParser.parse(execution.language, executionData.stderr);
+      executionData.status = 'completed';
+      finish();
+
+      reportExit({
+        code: executionData.exitCode,
+        duration_ms: executionData.duration,
+        killed_reason: executionData.killedReason,
+        timeout_phase: null,
+        diagnostics: executionData.diagnostics,
+        cache: executionData.buildCache,
+        compile_ms: executionData.compileDurationMs || null,
+        artifacts: this.describeArtifacts(executionData)
+      });
+    });
+
+    // The runtime timeout destroys the stream, which closes without 'end'
+    execution.stream.on('close', () => {
+      if (!execution.timedOut || executionData.status !== 'running') {
+        return;
+      }
+
+      this.closeStdinStream(execution);
+      closeOutput();
+
+      executionData.exitCode = null;
+      executionData.killedReason = 'timeout';
+      executionData.timeoutPhase = 'run';
+      executionData.diagnostics = [];
+      executionData.status = 'completed';
+      finish();
+
+      // Destroying the stream doesn't stop the program; kill it with its container
+      sandbox.kill(execution, 0).catch(error =>
+        logger.error(`Failed to kill timed out execution ${executionData.id}:`, error)
+      );
+
+      reportExit({
+        code: null,
+        duration_ms: executionData.duration,
+        killed_reason: 'timeout',
+        timeout_phase: 'run',
+        diagnostics: [],
+        cache: executionData.buildCache,
+        compile_ms: executionData.compileDurationMs || null
+      });
+    });
+
+    execution.stream.on('error', (error) => {
+      this.closeStdinStream(execution);
+      closeOutput();
+      if (executionData.status !== 'running') {
+        return;
+      }
+
+      executionData.status = 'error';
+      executionData.error = error.message;
+      finish();
+
+      onError(error);
+    });
+
+    return framer;
+  }
+
+  /**
+   * Copy the files matching the execution's `artifactPatterns` out of its
+   * container into the artifact store, within config.artifacts.maxFiles and
+   * maxBytes. Matching nothing is fine, and a failure only loses the
+   * artifacts, never the execution.
+   */
+  async collectArtifacts(execution, executionData) {
+    const patterns = executionData.artifactPatterns;
+    if (!Array.isArray(patterns) || patterns.length === 0 || !artifactStore.isEnabled()) {
+      return;
+    }
+
+    try {
+      const { files, truncated } = await sandboxes.forContainer(execution.containerId).readFiles(
+        execution.containerId,
+        artifactPatterns.matcher(patterns),
+        { maxFiles: config.artifacts.maxFiles, maxBytes: config.artifacts.maxBytes }
+      );
+      executionData.artifacts = await artifactStore.save(executionData.id, files);
+      executionData.artifactsTruncated = truncated;
+    } catch (error) {
+      logger.error(`Failed to collect artifacts of execution ${executionData.id}:`, error);
+      executionData.artifacts = [];
+      executionData.artifactsTruncated = true;
+    }
+  }
+
+  /**
+   * Artifacts as the exit event lists them: { files: [{ name, size, mimeType,
+   * url }], truncated }, or null when the execution asked for none
+   */
+  describeArtifacts(executionData) {
+    if (!Array.isArray(executionData.artifacts)) {
+      return null;
+    }
+    return {
+      files: executionData.artifacts.map(artifact => ({ ...artifact, url: artifactStore.urlFor(executionData.id, artifact.name) })),
+      truncated: Boolean(executionData.artifactsTruncated)
+    };
+  }
+
+  /**
+   * Spill writers for an execution's full output, or null when spilling is
+   * off. Only executions that land in a user's history can be downloaded.
+   */
+  openSpill(executionData) {
+    if (!outputSpill.isEnabled() || !executionData.userId) {
+      return null;
+    }
+
+    try {
+      return outputSpill.open(executionData.id);
+    } catch (error) {
+      logger.warn(`Output spill unavailable for ${executionData.id}:`, error.message);
+      return null;
+    }
+  }
+
+  /**
+   * Forward client input to a running execution's stdin
+   */
+  writeStdin(executionId, data) {
+    const executionData = this.activeExecutions.get(executionId);
+    if (!executionData || !executionData.execution || !executionData.execution.stdinOpen) {
+      return false;
+    }
+
+    executionData.execution.stream.write(data);
+    return true;
+  }
+
+  /**
+   * Signal EOF on a running execution's stdin
+   */
+  closeStdin(executionId) {
+    const executionData = this.activeExecutions.get(executionId);
+    if (!executionData || !executionData.execution) {
+      return false;
+    }
+
+    return this.closeStdinStream(executionData.execution);
+  }
+
+  closeStdinStream(execution) {
+    if (!execution.stdinOpen) {
+      return false;
+    }
+
+    execution.stdinOpen = false;
+    if (typeof execution.stream.end === 'function') {
+      execution.stream.end();
+    }
+    return true;
+  }
+
+  /**
+   * Cancel an active execution: SIGTERM, wait the grace period, then SIGKILL
+   * and remove its container. Returns false if the execution already finished.
+   */
+  async cancelExecution(executionId, reason = 'cancelled', graceMs = config.execution.cancelGraceMs) {
+    const execution = this.activeExecutions.get(executionId);
+    if (!execution) {
+      return false;
+    }
+
+    execution.status = 'cancelled';
+    execution.killedReason = reason;
+    execution.endTime = new Date();
+    execution.duration = execution.endTime - execution.startTime;
+
+    this.executionHistory.set(executionId, { ...execution });
+    this.activeExecutions.delete(executionId);
+
+    if (execution.queueTicket) {
+      execution.queueTicket.release();
+    }
+
+    executionMetrics.recordExecution(execution);
+    executionAudit.logFinish(execution);
+    this.endRunSpan(execution);
+
+    logger.info(`Cancelling execution ${executionId}: ${reason}`);
+
+    if (execution.onCancelled) {
+      execution.onCancelled(reason);
+    }
+
+    // After onCancelled so the record includes the flushed output
+    executionHistory.record(execution);
+    this.releaseSecrets(executionId);
+
+    try {
+      if (execution.execution && execution.execution.stream) {
+        execution.execution.stream.destroy();
+      }
+
+      await sandboxes.forContainer(execution.containerId).kill(execution.execution || execution.containerId, graceMs);
+    } catch (error) {
+      logger.error(`Failed to kill container for execution ${executionId}:`, error);
+    }
+
+    // Once the program is dead, so nothing it writes later goes unreported
+    this.reportWorkspaceChanges(execution);
+    return true;
+  }
+
   /**
    * Stop an active execution
    */
@@ -141,14 +899,16 @@ class ExecutionService {
       execution.duration = execution.endTime - execution.startTime;
 
       // Move to history
-      this.executionHistory.set(executionId, { ...execution });
-      this.activeExecutions.delete(executionId);
+      this.finishExecution(executionId);
 
-      execution.socket.emit('execution:stopped', {
+      const stopped = {
         executionId,
+        event: 'stopped',
         endTime: execution.endTime,
         duration: execution.duration
-      });
+      };
+      execution.socket.emit('execution:stopped', stopped);
+      executionSessions.finish(executionId, stopped);
 
       logger.info(`Execution ${executionId} stopped`);
       return true;
@@ -159,6 +919,153 @@ class ExecutionService {
     }
   }
 
+  keepFrame(executionId, frame) {
+    const frames = this.recentFrames.get(executionId);
+    if (!frames) {
+      return;
+    }
+    frames.push(frame);
+    if (frames.length > executionSessions.config.ringFrames) {
+      frames.shift();
+    }
+  }
+
+  /**
+   * The socket streaming an execution went away. The run keeps going for
+   * reattachGraceMs so the client can come back, here or through another
+   * instance, and is cancelled if it doesn't.
+   */
+  detachSocket(executionId, socket) {
+    const executionData = this.activeExecutions.get(executionId);
+    if (!executionData || executionData.socket !== socket) {
+      return;
+    }
+
+    const detachedAt = Date.now();
+    const timer = setTimeout(async () => {
+      if (!this.activeExecutions.has(executionId) || executionData.socket !== socket) {
+        return; // finished, or reattached to this instance
+      }
+
+      const state = await executionSessions.get(executionId).catch(() => null);
+      if (state && state.attachedAt && Date.parse(state.attachedAt) >= detachedAt) {
+        return; // reattached through another instance
+      }
+
+      this.cancelExecution(executionId, 'client_disconnected').catch(error =>
+        logger.error(`Failed to cancel execution ${executionId} after disconnect:`, error)
+      );
+    }, executionSessions.config.reattachGraceMs);
+    timer.unref();
+  }
+
+  /**
+   * Resume an execution on `socket` after a reconnect. Frames after lastSeq
+   * are replayed first. A run owned by this instance moves to the new socket
+   * (stdin included); one owned by another live instance is relayed through
+   * the session store; one that finished, or whose instance is gone, gets
+   * its final event, or an EXECUTION_LOST error when there is none.
+   * @returns {Object} The execution:reattached event sent to the socket
+   */
+  async reattachExecution(socket, executionId, lastSeq = 0) {
+    // Subscribed before reading the ring so no live frame falls in between
+    const pending = [];
+    let deliver = (message) => pending.push(message);
+    const unsubscribe = executionSessions.subscribe(executionId, (message) => deliver(message));
+
+    let session;
+    try {
+      session = await executionSessions.reattach(executionId, socket.userId, lastSeq);
+    } catch (error) {
+      unsubscribe();
+      throw error;
+    }
+    if (!session) {
+      unsubscribe();
+      throw new ExecError('not_found', 'EXECUTION_NOT_FOUND', 'Execution not found');
+    }
+
+    const { state, owner, gap } = session;
+    const local = owner === 'local' ? this.activeExecutions.get(executionId) : null;
+    // The local ring is always current; the store's may lag behind by a frame in flight
+    const frames = local
+      ? this.recentFrames.get(executionId).filter(frame => frame.seq > lastSeq)
+      : session.frames;
+
+    const reattached = {
+      executionId,
+      event: 'reattached',
+      phase: local ? 'running' : state.phase,
+      owner,
+      instanceId: state.instanceId,
+      host: state.host,
+      lastSeq,
+      replayed: frames.length,
+      gap
+    };
+    socket.emit('execution:reattached', reattached);
+
+    let seq = lastSeq;
+    const sendFrame = (frame) => {
+      if (frame.seq > seq) {
+        seq = frame.seq;
+        socket.emit('execution:output', outputEvent(executionId, frame));
+      }
+    };
+    const sendFinal = (final) => {
+      socket.emit(FINAL_EVENTS[final.event] || 'execution:exit', final);
+    };
+
+    frames.forEach(sendFrame);
+
+    if (local) {
+      // Synchronous from reading the ring: nothing is emitted in between
+      unsubscribe();
+      local.socket = socket;
+      socket.on('disconnect', () => this.detachSocket(executionId, socket));
+      executionSessions.attached(executionId);
+      return reattached;
+    }
+
+    if (state.phase === 'finished' || owner === 'gone') {
+      unsubscribe();
+      if (state.final) {
+        sendFinal(state.final);
+      } else {
+        socket.emit('execution:error', {
+          executionId,
+          event: 'error',
+          code: 'EXECUTION_LOST',
+          kind: 'infrastructure',
+          error: 'The instance running this execution went away before it finished'
+        });
+      }
+      return reattached;
+    }
+
+    // Relay from the owning instance until the final event
+    let done = false;
+    deliver = (message) => {
+      if (done) {
+        return;
+      }
+      if (message.type === 'frame') {
+        sendFrame(message.frame);
+      } else if (message.type === 'final') {
+        done = true;
+        unsubscribe();
+        sendFinal(message.final);
+      }
+    };
+    pending.splice(0).forEach(deliver);
+    socket.on('disconnect', () => {
+      done = true;
+      unsubscribe();
+    });
+    executionSessions.attached(executionId);
+    return reattached;
+  }
+
   /**
    * Get execution status
    */
@@ -186,6 +1093,10 @@ class ExecutionService {
         language: historical.language,
         containerId: historical.containerId,
         output: historical.output,
+        exitCode: historical.exitCode,
+        killedReason: historical.killedReason || null,
+        timeoutPhase: historical.timeoutPhase || null,
+        diagnostics: historical.diagnostics || [],
         error: historical.error
       };
     }
@@ -201,7 +1112,7 @@ class ExecutionService {
 
     // Add active executions
     for (const execution of this.activeExecutions.values()) {
-      if (execution.socket.userId === userId) {
+      if (execution.userId === userId) {
         userExecutions.push({
           id: execution.id,
           status: execution.status,
@@ -214,7 +1125,7 @@ class ExecutionService {
 
     // Add historical executions
     for (const execution of this.executionHistory.values()) {
-      if (execution.socket.userId === userId) {
+      if (execution.userId === userId) {
         userExecutions.push({
           id: execution.id,
           status: execution.status,
@@ -231,6 +1142,33 @@ class ExecutionService {
     return userExecutions.sort((a, b) => b.startTime - a.startTime);
   }
 
+  /**
+   * Stop taking new executions and wait up to `timeoutMs` for the running
+   * ones to finish; they keep streaming output meanwhile. Test runs only hold
+   * queue slots, so those are waited for as well.
+   * @returns {number} Executions still running when the wait ended
+   */
+  async drain(timeoutMs = config.shutdown.drainTimeoutMs, pollMs = 250) {
+    executionQueue.drain();
+
+    const deadline = Date.now() + timeoutMs;
+    const busy = () => this.activeExecutions.size > 0 || executionQueue.running > 0;
+
+    if (busy()) {
+      logger.info(`Draining ${this.activeExecutions.size} running executions (up to ${timeoutMs}ms)`);
+    }
+
+    while (busy() && Date.now() < deadline) {
+      await new Promise(resolve => setTimeout(resolve, pollMs));
+    }
+
+    const remaining = Math.max(this.activeExecutions.size, executionQueue.running);
+    if (remaining > 0) {
+      logger.warn(`Drain period ended with ${remaining} executions still running`);
+    }
+    return remaining;
+  }
+
   /**
    * Clean up old execution history
    */
@@ -0,0 +1,352 @@
+const os = require('os');
+const { EventEmitter } = require('events');
+const config = require('../config');
+const logger = require('../utils/logger');
+
+/**
+ * Session stores. Both implement:
+ *
+ *   save(state, ttlMs), get(executionId) -> state or null
+ *   append(executionId, frame, { maxFrames, ttlMs }) -> keeps the last maxFrames
+ *   frames(executionId) -> [frame] oldest first
+ *   publish(executionId, message), subscribe(executionId, handler) -> unsubscribe()
+ *   heartbeat(instanceId, ttlMs), isAlive(instanceId)
+ *
+ * Messages are { type: 'frame', frame } or { type: 'final', final }.
+ */
+class MemorySessionStore {
+  constructor() {
+    this.states = new Map();
+    this.rings = new Map();
+    this.instances = new Map(); // instanceId -> expiry timestamp
+    this.events = new EventEmitter();
+    this.events.setMaxListeners(0);
+  }
+
+  async save(state) {
+    this.states.set(state.executionId, { ...state });
+  }
+
+  async get(executionId) {
+    const state = this.states.get(executionId);
+    return state ? { ...state } : null;
+  }
+
+  async append(executionId, frame, { maxFrames }) {
+    const ring = this.rings.get(executionId) || [];
+    ring.push(frame);
+    if (ring.length > maxFrames) {
+      ring.splice(0, ring.length - maxFrames);
+    }
+    this.rings.set(executionId, ring);
+    this.events.emit(executionId, { type: 'frame', frame });
+  }
+
+  async frames(executionId) {
+    return [...(this.rings.get(executionId) || [])];
+  }
+
+  async publish(executionId, message) {
+    this.events.emit(executionId, message);
+  }
+
+  subscribe(executionId, handler) {
+    this.events.on(executionId, handler);
+    return () => this.events.off(executionId, handler);
+  }
+
+  async remove(executionId) {
+    this.states.delete(executionId);
+    this.rings.delete(executionId);
+  }
+
+  async heartbeat(instanceId, ttlMs) {
+    this.instances.set(instanceId, Date.now() + ttlMs);
+  }
+
+  async isAlive(instanceId) {
+    return (this.instances.get(instanceId) || 0) > Date.now();
+  }
+}
+
+class RedisSessionStore {
+  /**
+   * @param {Object} client - ioredis connection (utils/database)
+   * @param {Object} subscriber - A second connection for SUBSCRIBE
+   * @param {string} keyPrefix - Namespace for session keys
+   */
+  constructor(client, subscriber, keyPrefix = config.executionSessions.keyPrefix) {
+    this.client = client;
+    this.subscriber = subscriber;
+    this.keyPrefix = keyPrefix;
+    this.handlers = new Map(); // channel -> Set of handlers
+
+    this.subscriber.on('message', (channel, payload) => {
+      const handlers = this.handlers.get(channel);
+      if (!handlers) {
+        return;
+      }
+      let message;
+      try {
+        message = JSON.parse(payload);
+      } catch (error) {
+        return;
+      }
+      handlers.forEach(handler => handler(message));
+    });
+  }
+
+  key(kind, id) {
+    return `${this.keyPrefix}${kind}:${id}`;
+  }
+
+  async save(state, ttlMs) {
+    await this.client.set(this.key('state', state.executionId), JSON.stringify(state), 'PX', ttlMs);
+  }
+
+  async get(executionId) {
+    const value = await this.client.get(this.key('state', executionId));
+    return value ? JSON.parse(value) : null;
+  }
+
+  async append(executionId, frame, { maxFrames, ttlMs }) {
+    const ring = this.key('frames', executionId);
+    await this.client.multi()
+      .rpush(ring, JSON.stringify(frame))
+      .ltrim(ring, -maxFrames, -1)
+      .pexpire(ring, ttlMs)
+      .publish(this.key('events', executionId), JSON.stringify({ type: 'frame', frame }))
+      .exec();
+  }
+
+  async frames(executionId) {
+    const values = await this.client.lrange(this.key('frames', executionId), 0, -1);
+    return values.map(value => JSON.parse(value));
+  }
+
+  async publish(executionId, message) {
+    await this.client.publish(this.key('events', executionId), JSON.stringify(message));
+  }
+
+  subscribe(executionId, handler) {
+    const channel = this.key('events', executionId);
+    let handlers = this.handlers.get(channel);
+    if (!handlers) {
+      handlers = new Set();
+      this.handlers.set(channel, handlers);
+      this.subscriber.subscribe(channel).catch(error =>
+        logger.warn(`Failed to subscribe to execution ${executionId}:`, error.message)
+      );
+    }
+    handlers.add(handler);
+
+    return () => {
+      handlers.delete(handler);
+      if (handlers.size === 0 && this.handlers.get(channel) === handlers) {
+        this.handlers.delete(channel);
+        this.subscriber.unsubscribe(channel).catch(() => {});
+      }
+    };
+  }
+
+  async remove(executionId) {
+    await this.client.del(this.key('state', executionId), this.key('frames', executionId));
+  }
+
+  async heartbeat(instanceId, ttlMs) {
+    await this.client.set(this.key('instance', instanceId), String(Date.now()), 'PX', ttlMs);
+  }
+
+  async isAlive(instanceId) {
+    return (await this.client.exists(this.key('instance', instanceId))) === 1;
+  }
+}
+
+/**
+ * Minimal state of streaming executions, shared between backend instances:
+ * which instance owns the container and stream, the phase, and a ring
+ * buffer of the latest output frames. A client that lost its socket sends
+ * execution:reattach with the last seq it saw and gets the frames after it,
+ * then either the live stream (relayed from the owning instance through the
+ * store) or, once the run is over or its owner is gone, the final status.
+ */
+class ExecutionSessions {
+  constructor() {
+    this.config = { ...config.executionSessions };
+    this.instanceId = this.config.instanceId || `${os.hostname()}-${process.pid}`;
+    this.host = os.hostname();
+    this.store = null;
+    this.fallbackStore = null;
+    this.heartbeatTimer = null;
+  }
+
+  /**
+   * The configured store. A Redis store whose connection isn't up yet falls
+   * back to a per-process memory store until it is.
+   */
+  getStore() {
+    if (this.store) {
+      return this.store;
+    }
+
+    if (this.config.store === 'redis') {
+      try {
+        const { getRedisConnection } = require('../utils/database');
+        const client = getRedisConnection();
+        this.store = new RedisSessionStore(client, client.duplicate(), this.config.keyPrefix);
+        return this.store;
+      } catch (error) {
+        if (!this.fallbackStore) {
+          logger.warn('Execution sessions are local to this instance until Redis is connected:', error.message);
+          this.fallbackStore = new MemorySessionStore();
+        }
+        return this.fallbackStore;
+      }
+    }
+
+    this.store = new MemorySessionStore();
+    return this.store;
+  }
+
+  setStore(store) {
+    this.store = store;
+  }
+
+  /**
+   * Whether another instance still sends heartbeats. Only a shared store
+   * sees other instances', so without one every instance counts as alive.
+   */
+  async isInstanceAlive(instanceId) {
+    const store = this.getStore();
+    return store instanceof RedisSessionStore ? store.isAlive(instanceId) : true;
+  }
+
+  /**
+   * Announce this instance as alive until stop(); reattaching clients treat
+   * executions of instances without a heartbeat as orphaned
+   */
+  start() {
+    if (this.heartbeatTimer) {
+      return;
+    }
+
+    const beat = () => this.getStore().heartbeat(this.instanceId, this.config.heartbeatTtlMs).catch(error =>
+      logger.warn('Execution session heartbeat failed:', error.message)
+    );
+    beat();
+    this.heartbeatTimer = setInterval(beat, this.config.heartbeatIntervalMs);
+    this.heartbeatTimer.unref();
+  }
+
+  stop() {
+    if (this.heartbeatTimer) {
+      clearInterval(this.heartbeatTimer);
+      this.heartbeatTimer = null;
+    }
+  }
+
+  // Session bookkeeping never fails an execution
+  quietly(promise, what) {
+    return promise.catch(error => logger.warn(`Execution session ${what} failed:`, error.message));
+  }
+
+  async update(executionId, changes) {
+    const store = this.getStore();
+    const state = await store.get(executionId);
+    if (state) {
+      await store.save({ ...state, ...changes, updatedAt: new Date().toISOString() }, this.config.ttlMs);
+    }
+  }
+
+  /**
+   * Record a streaming execution as owned by this instance
+   */
+  track(executionData, phase = 'running') {
+    this.start();
+    return this.quietly(this.getStore().save({
+      executionId: executionData.id,
+      containerId: executionData.containerId,
+      userId: executionData.userId,
+      language: executionData.language,
+      instanceId: this.instanceId,
+      host: this.host,
+      phase,
+      startedAt: new Date(executionData.startTime || Date.now()).toISOString(),
+      updatedAt: new Date().toISOString(),
+      attachedAt: null,
+      final: null
+    }, this.config.ttlMs), 'save');
+  }
+
+  /**
+   * Keep an output frame ({ stream, data, seq }) for replay and relay it to
+   * sockets reattached on other instances
+   */
+  frame(executionId, frame) {
+    return this.quietly(this.getStore().append(executionId, frame, {
+      maxFrames: this.config.ringFrames,
+      ttlMs: this.config.ttlMs
+    }), 'append');
+  }
+
+  /**
+   * Record how the execution ended: `final` is the exit, cancelled or error
+   * event as sent to the client ({ event: 'exit' | 'cancelled' | 'error', ... })
+   */
+  finish(executionId, final) {
+    return this.quietly((async () => {
+      await this.update(executionId, { phase: 'finished', final });
+      await this.getStore().publish(executionId, { type: 'final', final });
+    })(), 'finish');
+  }
+
+  /**
+   * Note that a client reattached, so the owner keeps the run going
+   */
+  attached(executionId) {
+    return this.quietly(this.update(executionId, { attachedAt: new Date().toISOString() }), 'attach');
+  }
+
+  async get(executionId) {
+    return this.getStore().get(executionId);
+  }
+
+  /**
+   * What a client reattaching to `executionId` needs to catch up.
+   * @param {number} lastSeq - Sequence number of the last frame the client has
+   * @returns {Object|null} { state, owner, frames, gap } where owner is
+   *   'local', 'remote' or 'gone', and gap tells that frames after lastSeq
+   *   already left the ring buffer. null for unknown executions and other users'.
+   */
+  async reattach(executionId, userId, lastSeq = 0) {
+    const store = this.getStore();
+    const state = await store.get(executionId);
+    if (!state || state.userId !== userId) {
+      return null;
+    }
+
+    let owner = 'local';
+    if (state.instanceId !== this.instanceId) {
+      owner = await store.isAlive(state.instanceId) ? 'remote' : 'gone';
+    }
+
+    const buffered = await store.frames(executionId);
+    const frames = buffered.filter(frame => frame.seq > lastSeq);
+    const gap = frames.length > 0 && frames[0].seq > lastSeq + 1;
+
+    return { state, owner, frames, gap };
+  }
+
+  /**
+   * Live frames and the final event of an execution, wherever it runs
+   * @returns {Function} Unsubscribe
+   */
+  subscribe(executionId, handler) {
+    return this.getStore().subscribe(executionId, handler);
+  }
+}
+
+module.exports = new ExecutionSessions();
+module.exports.ExecutionSessions = ExecutionSessions;
+module.exports.MemorySessionStore = MemorySessionStore;
+module.exports.RedisSessionStore = RedisSessionStore;
\ No newline at end of file
@@ -0,0 +1,167 @@
+const crypto = require('crypto');
+const { PassThrough } = require('stream');
+const Sandbox = require('./sandbox');
+
+/**
+ * In-memory sandbox for tests: no containers, and programs run until the
+ * test drives them with output() and exit(). Run timeouts are
+ * enforced like the Docker executor does it (the stream is destroyed and
+ * `timedOut` set), so queueing and timeout handling can be tested end to end.
+ *
+ *   sandboxes.register(new FakeSandbox());
+ *   sandboxes.config.defaultProvider = 'fake';
+ */
+class FakeSandbox extends Sandbox {
+  constructor(name = 'fake') {
+    super(name);
+    this.available = true;
+    this.containers = new Map(); // containerId -> info
+    this.executions = []; // every execution started, oldest first
+    this.killed = []; // { containerId, graceMs } per kill()
+  }
+
+  isAvailable() {
+    return this.available;
+  }
+
+  owns(containerId) {
+    return this.containers.has(containerId);
+  }
+
+  async create(language, workspaceId, userId, options = {}) {
+    const containerId = `fake-${crypto.randomUUID()}`;
+    const info = {
+      id: containerId,
+      name: containerId,
+      language,
+      workspaceId,
+      userId,
+      createdAt: new Date(),
+      status: 'running',
+      running: true,
+      mountWorkspaceId: options.mountWorkspaceId || null,
+      networkEnabled: false,
+      sandbox: this.name,
+      files: {}
+    };
+    this.containers.set(containerId, info);
+    return { containerId, name: containerId, language, status: 'running', sandbox: this.name };
+  }
+
+  async inspect(containerId) {
+    return this.containers.get(containerId) || null;
+  }
+
+  async copyFiles(containerId, files) {
+    const info = this.containers.get(containerId);
+    if (!info) {
+      throw new Error('Container not found');
+    }
+    Object.assign(info.files, files);
+  }
+
+  /**
+   * Files the program left behind are whatever copyFiles() or the test put
+   * in the container's `files`
+   */
+  async readFiles(containerId, matches, { maxFiles = Infinity, maxBytes = Infinity } = {}) {
+    const info = this.containers.get(containerId);
+    if (!info) {
+      throw new Error('Container not found');
+    }
+
+    const files = [];
+    let size = 0;
+    let truncated = false;
+    for (const path of Object.keys(info.files).filter(matches).sort()) {
+      const content = Buffer.from(info.files[path]);
+      if (files.length >= maxFiles || size + content.length > maxBytes) {
+        truncated = true;
+        continue;
+      }
+      files.push({ path, content });
+      size += content.length;
+    }
+    return { files, truncated };
+  }
+
+  async exec(containerId, code, filename = 'main', options = {}) {
+    const info = this.containers.get(containerId);
+    if (!info) {
+      throw new Error('Container not found');
+    }
+
+    const stream = new PassThrough();
+    const execution = {
+      containerId,
+      language: info.language,
+      code,
+      filename,
+      options,
+      stream,
+      exec: { id: crypto.randomUUID() },
+      stdinOpen: Boolean(options.interactive),
+      cache: null,
+      timedOut: false,
+      exitCode: null,
+      killedReason: null
+    };
+
+    if (options.runTimeoutMs) {
+      execution.timer = setTimeout(() => {
+        execution.timedOut = true;
+        stream.destroy();
+      }, options.runTimeoutMs);
+    }
+
+    this.executions.push(execution);
+    return execution;
+  }
+
+  streams(execution, stdout, stderr) {
+    execution.writers = { stdout, stderr };
+    execution.stream.resume(); // nothing is multiplexed; flowing lets 'end' fire
+  }
+
+  /**
+   * Test control: the program writes `data` to `stream`
+   */
+  output(execution, stream, data) {
+    execution.writers[stream].write(Buffer.from(data));
+  }
+
+  /**
+   * Test control: the program exits with `exitCode`
+   */
+  exit(execution, exitCode = 0, killedReason = null) {
+    clearTimeout(execution.timer);
+    execution.exitCode = exitCode;
+    execution.killedReason = killedReason;
+    execution.stream.end();
+  }
+
+  async exitStatus(execution) {
+    return { exitCode: execution.exitCode, killedReason: execution.killedReason };
+  }
+
+  isDiskLimitError(stderr = '') {
+    return /No space left on device/i.test(stderr);
+  }
+
+  async kill(target, graceMs = 0) {
+    const containerId = typeof target === 'string' ? target : target.containerId;
+    this.killed.push({ containerId, graceMs });
+
+    if (typeof target !== 'string') {
+      clearTimeout(target.timer);
+      target.stream.destroy();
+    }
+    this.containers.delete(containerId);
+  }
+
+  async remove(containerId) {
+    this.containers.delete(containerId);
+  }
+}
+
+module.exports = FakeSandbox;
\ No newline at end of file
@@ -0,0 +1,260 @@
+const config = require('../config');
+const logger = require('../utils/logger');
+const dockerService = require('./dockerService');
+const runtimeRegistry = require('./runtimeRegistry');
+const diagnosticsParser = require('../utils/diagnostics');
+const { ExecError } = require('../utils/execErrors');
+
+// How `sh` and Docker report a command that isn't on the PATH
+const isMissingCommand = (result) => result.exitCode === 127 || (result.exitCode !== 0 && /executable file not found/i.test(result.stderr));
+
+/**
+ * Code formatting with each runtime's native formatter (the registry's
+ * `format` entry). Formatting never waits in the execution queue: every
+ * runtime has up to config.format.workers warm containers that only run the
+ * formatter on stdin, so no user files are left in them between requests,
+ * and a wait list of config.format.maxQueued requests in front of them.
+ */
+class FormatService {
+  constructor() {
+    this.config = { ...config.format };
+    this.pools = new Map(); // runtime -> { active, waiting, idle }
+    this.available = new Map(); // runtime -> whether its image has the formatter, once known
+    this.reapInterval = null;
+  }
+
+  pool(name) {
+    if (!this.pools.has(name)) {
+      this.pools.set(name, { active: 0, waiting: [], idle: [] });
+    }
+    return this.pools.get(name);
+  }
+
+  /**
+   * Look for each runtime's formatter binary in its image, leaving the probe
+   * containers warm for the first requests. Runtimes whose image lacks it
+   * answer FORMATTER_UNAVAILABLE instead of failing every request.
+   * @returns {Object} runtime -> true, false, or null when the probe failed
+   */
+  async verify(names = runtimeRegistry.names()) {
+    this.startReaper();
+
+    const results = {};
+    for (const name of names) {
+      const runtime = runtimeRegistry.get(name);
+      if (!runtime || !runtime.format) {
+        continue;
+      }
+
+      const binary = runtime.format.command[0];
+      try {
+        const probe = await this.withWorker(name, worker => dockerService.runBufferedExec(
+          worker.containerId,
+          ['sh', '-c', 'command -v "$0"', binary],
+          { timeoutMs: this.config.timeoutMs, phase: 'format' }
+        ));
+        results[name] = probe.exitCode === 0;
+        this.available.set(name, results[name]);
+        if (!results[name]) {
+          logger.warn(`Formatting ${name} is disabled: ${binary} is missing from ${runtime.image}`);
+        }
+      } catch (error) {
+        results[name] = null;
+        logger.warn(`Could not check the ${name} formatter:`, error.message);
+      }
+    }
+
+    return results;
+  }
+
+  /**
+   * Format `source` as the runtime's code
+   * @param {Object} options - { filename } the source is formatted as; its
+   *   extension picks the language for multi-language formatters (prettier)
+   * @returns {Object} { status, formatted, changed, errors, durationMs } where
+   *   status is ok, syntax_error (errors lists where) or timeout
+   */
+  async format(name, source, { filename = null } = {}) {
+    const runtime = runtimeRegistry.get(name);
+    if (!runtime) {
+      throw new ExecError('invalid_request', 'RUNTIME_NOT_FOUND', `Unsupported runtime: ${name}`, { param: 'runtime' });
+    }
+    if (!runtime.format) {
+      throw new ExecError('invalid_request', 'FORMAT_NOT_SUPPORTED', `No formatter is configured for ${name}`, { param: 'runtime' });
+    }
+    if (this.available.get(name) === false) {
+      throw this.unavailable(name, runtime);
+    }
+
+    const maxBytes = this.config.maxSourceBytes;
+    if (Buffer.byteLength(source, 'utf8') > maxBytes) {
+      throw new ExecError('too_large', 'SOURCE_TOO_LARGE', `source exceeds the size limit of ${maxBytes} bytes`, { param: 'source' });
+    }
+
+    const { extensions } = runtime.format;
+    const file = filename || `main.${extensions[0]}`;
+    if (!extensions.includes(file.slice(file.lastIndexOf('.') + 1))) {
+      throw new ExecError('invalid_request', 'INVALID_FILENAME', `filename must end in .${extensions.join(', .')}`, { param: 'filename' });
+    }
+
+    const argv = runtimeRegistry.renderCommand(runtime.format.command, file);
+    const result = await this.withWorker(name, async (worker) => {
+      const run = await dockerService.runBufferedExec(worker.containerId, argv, {
+        stdin: source,
+        timeoutMs: this.config.timeoutMs,
+        phase: 'format',
+        outputLimit: maxBytes * 2
+      });
+      // A formatter that overran its time may still be running
+      worker.broken = run.timedOut;
+      return run;
+    });
+
+    const response = { status: 'ok', formatted: null, changed: false, errors: [], durationMs: result.durationMs };
+
+    if (result.timedOut) {
+      return { ...response, status: 'timeout' };
+    }
+    if (isMissingCommand(result)) {
+      this.available.set(name, false);
+      throw this.unavailable(name, runtime);
+    }
+    if (result.truncated) {
+      throw new ExecError('too_large', 'SOURCE_TOO_LARGE', 'The formatted source exceeds the size limit', { param: 'source' });
+    }
+    if (result.exitCode !== 0) {
+      const errors = diagnosticsParser.parseFormatter(runtime.format.errors, result.stderr, file);
+      const message = result.stderr.trim().slice(0, 1000) || `Formatter exited with code ${result.exitCode}`;
+      return {
+        ...response,
+        status: 'syntax_error',
+        errors: errors.length > 0 ? errors : [{ file, line: null, col: null, severity: 'error', message }]
+      };
+    }
+
+    return { ...response, formatted: result.stdout, changed: result.stdout !== source };
+  }
+
+  unavailable(name, runtime) {
+    return new ExecError('unavailable', 'FORMATTER_UNAVAILABLE', `The ${name} image has no ${runtime.format.command[0]}`);
+  }
+
+  /**
+   * Run `task(worker)` on a formatter container of the runtime, waiting for
+   * one of the runtime's workers to be free. A container that went away
+   * underneath us (reaped, Docker restarted) is replaced once.
+   */
+  async withWorker(name, task) {
+    const pool = this.pool(name);
+    await this.acquireSlot(pool);
+
+    let worker = null;
+    try {
+      for (let attempt = 0; ; attempt++) {
+        worker = pool.idle.pop() || await this.createWorker(name);
+        try {
+          return await task(worker);
+        } catch (error) {
+          worker.broken = true;
+          if (error.code !== 'CONTAINER_NOT_FOUND' || attempt > 0) {
+            throw error;
+          }
+          this.discard(worker);
+          worker = null;
+        }
+      }
+    } finally {
+      if (worker) {
+        this.release(name, worker);
+      }
+      this.releaseSlot(pool);
+    }
+  }
+
+  acquireSlot(pool) {
+    if (pool.active < this.config.workers) {
+      pool.active++;
+      return Promise.resolve();
+    }
+    if (pool.waiting.length >= this.config.maxQueued) {
+      throw new ExecError('rate_limited', 'FORMAT_BUSY', 'Too many formatting requests are waiting, try again shortly', { retryAfter: 1 });
+    }
+    return new Promise(resolve => pool.waiting.push(resolve));
+  }
+
+  // The slot passes straight to the next waiting request
+  releaseSlot(pool) {
+    const next = pool.waiting.shift();
+    if (next) {
+      next();
+    } else {
+      pool.active--;
+    }
+  }
+
+  async createWorker(name) {
+    const runtime = runtimeRegistry.get(name);
+    const { containerId } = await dockerService.createContainer(name, 'format', 'system');
+    return { containerId, image: runtime.image, lastUsed: Date.now(), broken: false };
+  }
+
+  // Workers go back to the idle list unless broken or built from a replaced image
+  release(name, worker) {
+    const runtime = runtimeRegistry.get(name);
+    if (worker.broken || !runtime || runtime.image !== worker.image) {
+      this.discard(worker);
+      return;
+    }
+    worker.lastUsed = Date.now();
+    this.pool(name).idle.push(worker);
+  }
+
+  discard(worker) {
+    dockerService.stopContainer(worker.containerId, { force: true }).catch(error =>
+      logger.warn(`Failed to remove formatter container ${worker.containerId}:`, error.message)
+    );
+  }
+
+  /**
+   * Drop a runtime's idle containers and what is known about its formatter,
+   * after its image was replaced (services/imageBuilder)
+   */
+  flush(name) {
+    const pool = this.pool(name);
+    pool.idle.splice(0).forEach(worker => this.discard(worker));
+    this.available.delete(name);
+  }
+
+  startReaper() {
+    if (this.reapInterval) {
+      return;
+    }
+
+    this.reapInterval = setInterval(() => this.reapIdle(), Math.min(this.config.idleTimeoutMs, 60 * 1000));
+    this.reapInterval.unref();
+  }
+
+  reapIdle(now = Date.now()) {
+    for (const pool of this.pools.values()) {
+      const expired = pool.idle.filter(worker => now - worker.lastUsed >= this.config.idleTimeoutMs);
+      pool.idle = pool.idle.filter(worker => !expired.includes(worker));
+      expired.forEach(worker => this.discard(worker));
+    }
+  }
+
+  /**
+   * Stop the reaper and remove every idle container (graceful shutdown)
+   */
+  shutdown() {
+    if (this.reapInterval) {
+      clearInterval(this.reapInterval);
+      this.reapInterval = null;
+    }
+    for (const pool of this.pools.values()) {
+      pool.idle.splice(0).forEach(worker => this.discard(worker));
+    }
+  }
+}
+
+module.exports = new FormatService();
+module.exports.FormatService = FormatService;
\ No newline at end of file
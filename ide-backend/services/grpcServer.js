@@ -0,0 +1,601 @@
+const crypto = require('crypto');
+const fs = require('fs');
+const path = require('path');
+const grpc = require('@grpc/grpc-js');
+const protoLoader = require('@grpc/proto-loader');
+const { ReflectionService } = require('@grpc/reflection');
+const config = require('../config');
+const logger = require('../utils/logger');
+const requestContext = require('../utils/requestContext');
+const projectFiles = require('../utils/projectFiles');
+const programInput = require('../utils/programInput');
+const execErrors = require('../utils/execErrors');
+const { ExecError, classify } = execErrors;
+const { verifyIdToken } = require('../config/firebase');
+const { consume } = require('../middleware/rateLimiter');
+const User = require('../models/User');
+const dockerService = require('./dockerService');
+const executionService = require('./executionService');
+const executionQueue = require('./executionQueue');
+const runtimeRegistry = require('./runtimeRegistry');
+
+const PROTO_PATH = path.join(__dirname, '..', 'proto', 'execution.proto');
+
+const LOADER_OPTIONS = {
+  keepCase: true,
+  longs: Number,
+  enums: String,
+  defaults: true,
+  oneofs: true
+};
+
+// gRPC status for each ExecError kind
+const STATUS_BY_KIND = {
+  invalid_request: grpc.status.INVALID_ARGUMENT,
+  forbidden: grpc.status.PERMISSION_DENIED,
+  not_found: grpc.status.NOT_FOUND,
+  too_large: grpc.status.RESOURCE_EXHAUSTED,
+  rejected: grpc.status.FAILED_PRECONDITION,
+  rate_limited: grpc.status.RESOURCE_EXHAUSTED,
+  unavailable: grpc.status.UNAVAILABLE,
+  infrastructure: grpc.status.INTERNAL
+};
+
+/**
+ * The status a failed call ends with. ExecError code, kind and Retry-After
+ * travel as trailing metadata, so clients can tell QUEUE_FULL from a rate
+ * limit without parsing the message.
+ */
+const toStatus = (error, requestId = null) => {
+  if (error && Number.isInteger(error.grpcCode)) {
+    return { code: error.grpcCode, details: error.message, metadata: new grpc.Metadata() };
+  }
+
+  const classified = classify(error);
+  const metadata = new grpc.Metadata();
+  metadata.set('x-error-code', classified.code);
+  metadata.set('x-error-kind', classified.kind);
+  if (classified.retryAfter) {
+    metadata.set('retry-after', String(classified.retryAfter));
+  }
+  if (requestId) {
+    metadata.set('x-request-id', requestId);
+  }
+
+  const details = classified.details
+    ? `${classified.message}: ${classified.details.map(({ param, msg }) => (param ? `${param}: ${msg}` : msg)).join('; ')}`
+    : classified.message;
+  return { code: STATUS_BY_KIND[classified.kind] || grpc.status.INTERNAL, details, metadata };
+};
+
+const unauthenticated = (message) => Object.assign(new Error(message), { grpcCode: grpc.status.UNAUTHENTICATED });
+
+/**
+ * One Execute stream. Stands in for the socket executionService.startExecution
+ * reports to, turning its events into ExecuteResponse frames, and feeds the
+ * client's StdinFrames to the running program. Each call gets a container of
+ * its own once it has a queue slot, removed once the program is done.
+ */
+class ExecuteCall {
+  constructor(call, userId) {
+    this.call = call;
+    this.userId = userId;
+    this.executionId = crypto.randomUUID();
+    this.requestId = null;
+    this.containerId = null;
+    this.interactive = false;
+    this.started = false;
+    this.finished = false;
+    this.pendingStdin = []; // StdinFrames that arrived before the program started
+    this.listeners = new Map(); // socket-style handlers startExecution registers
+  }
+
+  on(event, handler) {
+    if (!this.listeners.has(event)) {
+      this.listeners.set(event, []);
+    }
+    this.listeners.get(event).push(handler);
+  }
+
+  /**
+   * executionService's socket events, as frames
+   */
+  emit(event, payload) {
+    if (this.finished) {
+      return;
+    }
+
+    switch (event) {
+      case 'execution:queued':
+        this.write({ queued: { position: payload.position } });
+        break;
+      case 'execution:started':
+        this.started = true;
+        this.write({
+          started: {
+            request_id: payload.requestId,
+            runtime: payload.language,
+            network_enabled: Boolean(payload.network_enabled)
+          }
+        });
+        this.flushStdin();
+        break;
+      case 'execution:output':
+        this.write({
+          output: {
+            stream: payload.stream === 'stderr' ? 'STDERR' : 'STDOUT',
+            data: Buffer.from(payload.data, 'utf8'),
+            seq: payload.seq
+          }
+        });
+        break;
+      case 'execution:exit':
+        this.write({
+          exit: {
+            status: payload.status,
+            has_exit_code: Number.isInteger(payload.code),
+            exit_code: Number.isInteger(payload.code) ? payload.code : 0,
+            duration_ms: payload.duration_ms || 0,
+            killed_reason: payload.killed_reason || '',
+            timeout_phase: payload.timeout_phase || '',
+            compile_ms: payload.compile_ms || 0,
+            stdout_truncated: Boolean(payload.stdout_truncated),
+            stderr_truncated: Boolean(payload.stderr_truncated)
+          }
+        });
+        this.finish();
+        break;
+      case 'execution:error':
+        // Before the start, startExecution throws too and that ends the call with a status
+        if (this.started) {
+          this.write({
+            error: {
+              code: payload.code || 'INTERNAL',
+              kind: payload.kind || 'infrastructure',
+              message: payload.error || 'Execution failed',
+              request_id: this.requestId
+            }
+          });
+          this.finish();
+        }
+        break;
+      case 'execution:cancelled':
+      case 'execution:stopped':
+        this.write({ cancelled: { reason: payload.reason || 'stopped' } });
+        this.finish();
+        break;
+      default:
+        break; // execution:completed repeats the exit frame
+    }
+  }
+
+  write(event) {
+    this.call.write({ execution_id: this.executionId, ...event });
+  }
+
+  /**
+   * Handle one ExecuteRequest; the first has to be `start`
+   */
+  async receive(request) {
+    if (request.payload === 'start' && !this.requestId) {
+      return this.start(request.start);
+    }
+    if (request.payload === 'stdin' && this.requestId) {
+      if (!this.interactive) {
+        throw new ExecError('invalid_request', 'NOT_INTERACTIVE', 'stdin frames need a start with interactive set', { param: 'stdin' });
+      }
+      this.pendingStdin.push(request.stdin);
+      if (this.started) {
+        this.flushStdin();
+      }
+      return null;
+    }
+    throw new ExecError('invalid_request', 'VALIDATION_FAILED', this.requestId
+      ? 'Only stdin frames may follow start'
+      : 'The first message must be start', { param: 'payload' });
+  }
+
+  flushStdin() {
+    for (const { data, eof } of this.pendingStdin.splice(0)) {
+      if (data && data.length > 0) {
+        executionService.writeStdin(this.executionId, data);
+      }
+      if (eof) {
+        executionService.closeStdin(this.executionId);
+      }
+    }
+  }
+
+  /**
+   * The client closed its side: no more stdin is coming
+   */
+  endStdin() {
+    if (!this.interactive) {
+      return;
+    }
+    this.pendingStdin.push({ data: null, eof: true });
+    if (this.started) {
+      this.flushStdin();
+    }
+  }
+
+  async start(start) {
+    this.requestId = requestContext.resolveRequestId(start.request_id || null);
+    this.interactive = start.interactive === true;
+
+    const runtime = runtimeRegistry.get(start.runtime);
+    if (!runtime) {
+      throw execErrors.validationFailed([{ param: 'runtime', msg: `Unknown runtime: ${start.runtime}` }]);
+    }
+
+    const files = Object.keys(start.files || {}).length > 0 ? start.files : null;
+    if (!files && !start.code) {
+      throw execErrors.validationFailed([{ param: 'code', msg: 'Code is required' }]);
+    }
+    execErrors.checkCodeSize(start.code);
+    if (files) {
+      const project = projectFiles.validate(files, start.entrypoint || null);
+      if (!project.isValid) {
+        throw execErrors.validationFailed(project.errors.map(msg => ({ param: 'files', msg })));
+      }
+    }
+
+    const argsInput = programInput.validateArgs(start.args);
+    const envInput = programInput.validateEnv(start.env, runtime);
+    if (!argsInput.isValid || !envInput.isValid) {
+      throw execErrors.validationFailed([
+        ...argsInput.errors.map(msg => ({ param: 'args', msg })),
+        ...envInput.errors.map(msg => ({ param: 'env', msg }))
+      ]);
+    }
+
+    const limited = await consume('execute', { userId: this.userId });
+    if (limited && !limited.allowed) {
+      throw new ExecError('rate_limited', 'RATE_LIMITED', `Rate limit exceeded for execute requests, try again in ${limited.retryAfter} seconds`, {
+        retryAfter: limited.retryAfter
+      });
+    }
+
+    if (!dockerService.isAvailable) {
+      throw execErrors.dockerUnavailable();
+    }
+
+    return requestContext.run({ requestId: this.requestId }, async () => {
+      // Screened and queued like the HTTP handlers, before a container is
+      // taken, so queued and rejected calls don't hold one
+      await executionService.screen(this.userId, { language: runtime.name, code: start.code || null, files });
+      const ticket = executionQueue.enqueue(this.userId, {
+        onPosition: position => this.emit('execution:queued', { position })
+      });
+      this.on('disconnect', () => {
+        if (ticket.state === 'waiting') {
+          ticket.cancel();
+        }
+      });
+
+      await ticket.ready;
+      if (ticket.state === 'cancelled') {
+        return this.executionId;
+      }
+
+      let containerId;
+      try {
+        ({ containerId } = await dockerService.createContainer(runtime.name, 'grpc', this.userId));
+      } catch (error) {
+        ticket.release();
+        throw error;
+      }
+      this.containerId = containerId;
+      if (this.finished || this.call.cancelled) {
+        ticket.release();
+        if (this.finished) {
+          this.removeContainer(); // finish() ran before there was a container
+          return this.executionId;
+        }
+        return this.finish();
+      }
+
+      await executionService.startExecution(this, {
+        ticket,
+        containerId,
+        code: start.code || null,
+        filename: start.filename || 'main',
+        executionId: this.executionId,
+        stdin: start.stdin && start.stdin.length > 0 ? start.stdin.toString('utf8') : null,
+        interactive: this.interactive,
+        files,
+        entrypoint: start.entrypoint || null,
+        args: argsInput.args,
+        env: envInput.env,
+        compileTimeoutMs: start.compile_timeout_ms || null,
+        runTimeoutMs: start.run_timeout_ms || null,
+        requestId: this.requestId
+      });
+
+      // The client gave up while waiting in the queue
+      if (!this.started) {
+        this.finish();
+      }
+      return this.executionId;
+    });
+  }
+
+  /**
+   * The client went away. There is no reattaching to a gRPC stream, so a
+   * running execution is cancelled right away rather than after a grace period.
+   */
+  disconnect() {
+    for (const handler of this.listeners.get('disconnect') || []) {
+      handler();
+    }
+    this.finish({ end: false, cancelReason: 'client_disconnected' });
+  }
+
+  /**
+   * End the call, with `error`'s status when given, and remove the container.
+   * A program still running when the call ends early is cancelled.
+   */
+  finish({ end = true, error = null, cancelReason = error ? 'client_error' : null } = {}) {
+    if (this.finished) {
+      return;
+    }
+    this.finished = true;
+
+    if (cancelReason && executionService.activeExecutions.has(this.executionId)) {
+      executionService.cancelExecution(this.executionId, cancelReason).catch(cancelError =>
+        logger.error(`Failed to cancel gRPC execution ${this.executionId}:`, cancelError)
+      );
+    }
+
+    if (end && !this.call.cancelled) {
+      if (error) {
+        this.call.emit('error', toStatus(error, this.requestId));
+      } else {
+        this.call.end();
+      }
+    }
+
+    if (this.containerId) {
+      this.removeContainer();
+    }
+  }
+
+  removeContainer() {
+    dockerService.stopContainer(this.containerId, { force: true }).catch(error =>
+      logger.warn(`Failed to remove container of gRPC execution ${this.executionId}:`, error.message)
+    );
+  }
+}
+
+/**
+ * gRPC API (proto/execution.proto) next to REST, on config.grpc.port. It
+ * runs through the same executionService, queue, code screening and token
+ * buckets as the HTTP endpoints; callers authenticate with their Firebase ID
+ * token as "authorization: Bearer <token>" metadata.
+ */
+class GrpcServer {
+  constructor() {
+    this.config = { ...config.grpc };
+    this.server = null;
+    this.port = null;
+  }
+
+  loadDefinition() {
+    return protoLoader.loadSync(PROTO_PATH, LOADER_OPTIONS);
+  }
+
+  credentials() {
+    const { tlsCertFile, tlsKeyFile } = this.config;
+    if (!tlsCertFile || !tlsKeyFile) {
+      return grpc.ServerCredentials.createInsecure();
+    }
+    return grpc.ServerCredentials.createSsl(null, [{
+      cert_chain: fs.readFileSync(tlsCertFile),
+      private_key: fs.readFileSync(tlsKeyFile)
+    }], false);
+  }
+
+  /**
+   * Bind and start serving
+   * @returns {Promise<number>} The bound port (useful with port 0)
+   */
+  async start() {
+    if (this.server || !this.config.enabled) {
+      return this.port;
+    }
+
+    const definition = this.loadDefinition();
+    const { ExecutionService } = grpc.loadPackageDefinition(definition).studio.execution.v1;
+
+    const server = new grpc.Server({
+      'grpc.max_receive_message_length': this.config.maxMessageBytes,
+      'grpc.max_send_message_length': this.config.maxMessageBytes
+    });
+    server.addService(ExecutionService.service, {
+      Execute: (call) => this.execute(call),
+      ListRuntimes: (call, callback) => this.unary(call, callback, 'read', () => this.listRuntimes()),
+      CancelExecution: (call, callback) => this.unary(call, callback, 'read', (userId) => this.cancelExecution(userId, call.request))
+    });
+    if (this.config.reflection) {
+      new ReflectionService(definition).addToServer(server);
+    }
+
+    const address = `${this.config.host}:${this.config.port}`;
+    this.port = await new Promise((resolve, reject) => {
+      server.bindAsync(address, this.credentials(), (error, port) => (error ? reject(error) : resolve(port)));
+    });
+    this.server = server;
+
+    logger.info(`gRPC server listening on ${this.config.host}:${this.port}${this.config.reflection ? ' with reflection' : ''}`);
+    return this.port;
+  }
+
+  /**
+   * Stop accepting calls and give open ones `timeoutMs` to finish
+   */
+  async shutdown(timeoutMs = config.shutdown.drainTimeoutMs) {
+    if (!this.server) {
+      return;
+    }
+
+    const server = this.server;
+    this.server = null;
+    await new Promise((resolve) => {
+      const timer = setTimeout(() => {
+        server.forceShutdown();
+        resolve();
+      }, timeoutMs);
+      timer.unref();
+      server.tryShutdown(() => {
+        clearTimeout(timer);
+        resolve();
+      });
+    });
+    logger.info('gRPC server closed.');
+  }
+
+  /**
+   * The user behind a call's bearer token, checked as on the Socket.IO
+   * handshake. Throws an UNAUTHENTICATED or PERMISSION_DENIED error.
+   */
+  async authenticate(call) {
+    if (process.env.DISABLE_AUTH === 'true') {
+      const user = await User.findOne({ email: 'dev@localhost.com' });
+      if (!user) {
+        throw unauthenticated('Dev user not found');
+      }
+      return user;
+    }
+
+    const [header] = call.metadata.get('authorization');
+    const match = /^Bearer\s+(\S+)$/i.exec(String(header || ''));
+    if (!match) {
+      throw unauthenticated('Authentication token required');
+    }
+
+    let decoded;
+    try {
+      decoded = await verifyIdToken(match[1]);
+    } catch (error) {
+      logger.warn('gRPC call with an invalid token', { peer: call.getPeer(), error: error.message });
+      throw unauthenticated(error.message === 'Token has expired' ? 'Token has expired' : 'Invalid token');
+    }
+
+    const user = await User.findOne({ firebaseUid: decoded.uid }).select('-driveToken -driveRefreshToken');
+    if (!user) {
+      throw unauthenticated('User not found');
+    }
+    if (!user.isActive) {
+      throw new ExecError('forbidden', 'ACCOUNT_INACTIVE', 'Account is inactive');
+    }
+    return user;
+  }
+
+  /**
+   * Authenticate and rate limit a unary call, then answer it with `handler(userId)`
+   */
+  async unary(call, callback, bucketName, handler) {
+    try {
+      const user = await this.authenticate(call);
+      const userId = user._id.toString();
+
+      const limited = await consume(bucketName, { userId });
+      if (limited && !limited.allowed) {
+        throw new ExecError('rate_limited', 'RATE_LIMITED', `Rate limit exceeded for ${bucketName} requests, try again in ${limited.retryAfter} seconds`, {
+          retryAfter: limited.retryAfter
+        });
+      }
+
+      callback(null, await handler(userId));
+    } catch (error) {
+      callback(toStatus(error));
+    }
+  }
+
+  async execute(call) {
+    let session = null;
+    const pending = [];
+    let ended = false;
+
+    const fail = (error) => {
+      if (session) {
+        session.finish({ error });
+      } else if (!call.cancelled) {
+        call.emit('error', toStatus(error));
+      }
+    };
+
+    call.on('cancelled', () => {
+      if (session) {
+        session.disconnect();
+      }
+    });
+    call.on('error', (error) => logger.debug('gRPC Execute stream error:', error.message));
+
+    // Requests can come in while the token is still being checked
+    call.on('data', (request) => {
+      if (!session) {
+        pending.push(request);
+        return;
+      }
+      session.receive(request).catch(fail);
+    });
+    call.on('end', () => {
+      ended = true;
+      if (session) {
+        session.endStdin();
+      }
+    });
+
+    let user;
+    try {
+      user = await this.authenticate(call);
+    } catch (error) {
+      return fail(error);
+    }
+    if (call.cancelled) {
+      return;
+    }
+
+    session = new ExecuteCall(call, user._id.toString());
+    for (const request of pending.splice(0)) {
+      session.receive(request).catch(fail);
+    }
+    if (ended) {
+      session.endStdin();
+    }
+  }
+
+  listRuntimes() {
+    return {
+      runtimes: runtimeRegistry.list().map(runtime => ({
+        name: runtime.name,
+        display_name: runtime.displayName || runtime.name,
+        version: runtime.version || '',
+        extension: runtime.extension || '',
+        needs_build: Boolean(runtime.needsBuild),
+        compile_timeout_ms: runtime.compileTimeoutMs || 0,
+        run_timeout_ms: runtime.runTimeoutMs || 0,
+        allow_network: Boolean(runtime.allowNetwork)
+      }))
+    };
+  }
+
+  /**
+   * Same rules as DELETE /api/executions/:id: only the owner may cancel
+   */
+  async cancelExecution(userId, { execution_id: executionId }) {
+    const execution = executionService.activeExecutions.get(executionId);
+    if (!execution || execution.userId !== userId) {
+      throw new ExecError('not_found', 'EXECUTION_NOT_FOUND', 'Execution not found or already completed');
+    }
+
+    const cancelled = await executionService.cancelExecution(executionId, 'user_cancelled');
+    return { execution_id: executionId, cancelled };
+  }
+}
+
+module.exports = new GrpcServer();
+module.exports.GrpcServer = GrpcServer;
+module.exports.ExecuteCall = ExecuteCall;
+module.exports.toStatus = toStatus;
\ No newline at end of file
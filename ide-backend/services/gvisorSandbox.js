@@ -0,0 +1,39 @@
+const DockerSandbox = require('./dockerSandbox');
+const config = require('../config');
+const logger = require('../utils/logger');
+
+/**
+ * Docker containers on gVisor's runsc runtime: syscalls are served by a
+ * user-space kernel instead of the host's, at some cost in start-up time
+ * and I/O. Needs runsc registered as a runtime with the Docker daemon.
+ */
+class GvisorSandbox extends DockerSandbox {
+  constructor() {
+    super('gvisor');
+    this.supported = false; // until detect() finds runsc
+    this.runtime = config.sandbox.gvisorRuntime;
+  }
+
+  getHostConfig() {
+    return { Runtime: this.runtime };
+  }
+
+  /**
+   * The daemon lists its registered runtimes in `docker info`
+   */
+  async detect(docker) {
+    try {
+      const info = await docker.info();
+      return Boolean(info.Runtimes && info.Runtimes[this.runtime]);
+    } catch (error) {
+      logger.warn('Failed to query Docker runtimes for gVisor support:', error.message);
+      return false;
+    }
+  }
+
+  getCapabilities() {
+    return { ...super.getCapabilities(), runtime: this.runtime };
+  }
+}
+
+module.exports = GvisorSandbox;
\ No newline at end of file
@@ -0,0 +1,53 @@
+const config = require('../config');
+const Screener = require('./screener');
+
+// Headers of native executables: ELF, PE (MZ) and Mach-O
+const EXECUTABLE_MAGIC = [
+  Buffer.from([0x7f, 0x45, 0x4c, 0x46]),
+  Buffer.from('MZ'),
+  Buffer.from([0xcf, 0xfa, 0xed, 0xfe]),
+  Buffer.from([0xfe, 0xed, 0xfa, 0xcf])
+];
+
+/**
+ * Heuristics that need no rules: source far larger than programs written in
+ * the editor, and long base64 blobs, the usual way to smuggle a miner binary
+ * into a script. A blob that decodes to a native executable is blocked.
+ */
+class HeuristicScreener extends Screener {
+  constructor() {
+    super('heuristics');
+    this.config = { ...config.screening };
+  }
+
+  check(sources) {
+    const found = [];
+    const totalBytes = sources.reduce((total, { content }) => total + Buffer.byteLength(content), 0);
+    if (totalBytes > this.config.largeSourceBytes) {
+      found.push({ rule: 'large-source', action: 'flag', path: null });
+    }
+
+    const blob = new RegExp(`[A-Za-z0-9+/]{${this.config.base64BlobBytes},}={0,2}`, 'g');
+    for (const { path, content } of sources) {
+      let executable = false;
+      let blobs = 0;
+      for (const [match] of content.matchAll(blob)) {
+        blobs++;
+        const head = Buffer.from(match.slice(0, 8), 'base64');
+        if (EXECUTABLE_MAGIC.some(magic => head.subarray(0, magic.length).equals(magic))) {
+          executable = true;
+          break;
+        }
+      }
+
+      if (executable) {
+        found.push({ rule: 'embedded-executable', action: 'block', path });
+      } else if (blobs > 0) {
+        found.push({ rule: 'base64-blob', action: 'flag', path });
+      }
+    }
+    return found;
+  }
+}
+
+module.exports = HeuristicScreener;
\ No newline at end of file
@@ -0,0 +1,221 @@
+const crypto = require('crypto');
+const fs = require('fs');
+const path = require('path');
+const tar = require('tar-stream');
+const config = require('../config');
+const logger = require('../utils/logger');
+const dockerService = require('./dockerService');
+const containerPool = require('./containerPool');
+const runtimeRegistry = require('./runtimeRegistry');
+const buildCache = require('./buildCache');
+const formatService = require('./formatService');
+
+const buildError = (code, message) => {
+  const error = new Error(message);
+  error.code = code;
+  return error;
+};
+
+/**
+ * Builds a runtime's image from docker/Dockerfile.<runtime>, tags it with a
+ * digest of the build context, smoke tests it and only then switches the
+ * runtime registry over. Until that switch nothing changes, so a failed
+ * build or smoke test leaves the previous image in use. One build per
+ * runtime at a time.
+ */
+class ImageBuilder {
+  constructor() {
+    this.config = { ...config.imageBuilds };
+    this.building = new Map(); // runtime -> { startedAt, userId }
+  }
+
+  getDockerfile(name) {
+    return `Dockerfile.${name}`;
+  }
+
+  /**
+   * @param {string} name - Runtime to rebuild
+   * @param {Object} options - { userId, onEvent } where onEvent receives
+   *   { event: 'started' | 'output' | 'built' | 'smoke', ... } frames as the build progresses
+   * @returns {Object} { runtime, image, previousImage, digest, imageId, smoke }
+   */
+  async build(name, { userId = null, onEvent = () => {} } = {}) {
+    const runtime = runtimeRegistry.get(name);
+    if (!runtime) {
+      throw buildError('RUNTIME_NOT_FOUND', `Unknown runtime: ${name}`);
+    }
+    if (!runtime.smoke) {
+      throw buildError('NO_SMOKE_TEST', `Runtime ${name} has no smoke test, so a new image could not be verified`);
+    }
+
+    const dockerfile = this.getDockerfile(name);
+    if (!fs.existsSync(path.join(this.config.contextDir, dockerfile))) {
+      throw buildError('NO_DOCKERFILE', `No ${dockerfile} in the build context`);
+    }
+
+    // Claimed before the first await so a concurrent request can't slip in
+    if (this.building.has(name)) {
+      throw buildError('BUILD_IN_PROGRESS', `An image build for ${name} is already running`);
+    }
+    this.building.set(name, { startedAt: new Date(), userId });
+
+    try {
+      const files = await this.listContext();
+      const digest = await this.digestContext(files);
+      const image = `${this.config.repository}/${name}:${digest.slice(0, 12)}`;
+
+      onEvent({ event: 'started', runtime: name, dockerfile, image, previousImage: runtime.image });
+      logger.info(`Building ${image} from ${dockerfile}`, { userId });
+
+      let imageId;
+      try {
+        ({ imageId } = await dockerService.buildImage(this.packContext(files), {
+          tag: image,
+          dockerfile,
+          labels: { 'studio.runtime': name, 'studio.context-digest': digest },
+          onOutput: text => onEvent({ event: 'output', text })
+        }));
+      } catch (error) {
+        throw buildError('BUILD_FAILED', `Image build failed: ${error.message}`);
+      }
+      onEvent({ event: 'built', image, imageId, digest });
+
+      const smoke = await this.smokeTest(name, image, userId);
+      onEvent({ event: 'smoke', ...smoke });
+      if (!smoke.passed) {
+        const failure = buildError('SMOKE_FAILED', `Smoke test failed for ${image}, keeping ${runtime.image}`);
+        failure.smoke = smoke;
+        throw failure;
+      }
+
+      const previousImage = runtimeRegistry.pinImage(name, image, {
+        digest,
+        imageId,
+        builtAt: new Date().toISOString(),
+        builtBy: userId
+      });
+
+      // Warm containers still run the old image, and cached builds came from its toolchain
+      await containerPool.flush(name);
+      formatService.flush(name);
+      await buildCache.invalidate(name).catch(error =>
+        logger.warn(`Failed to invalidate cached ${name} builds:`, error.message)
+      );
+
+      return { runtime: name, image, previousImage, digest, imageId, smoke };
+    } finally {
+      this.building.delete(name);
+    }
+  }
+
+  /**
+   * Every file of the build context, relative to contextDir and sorted
+   */
+  async listContext(dir = this.config.contextDir, prefix = '') {
+    const entries = await fs.promises.readdir(dir, { withFileTypes: true });
+    const files = [];
+
+    for (const entry of entries.sort((a, b) => (a.name < b.name ? -1 : Number(a.name > b.name)))) {
+      const relative = prefix ? `${prefix}/${entry.name}` : entry.name;
+      if (entry.isDirectory()) {
+        files.push(...await this.listContext(path.join(dir, entry.name), relative));
+      } else if (entry.isFile()) {
+        files.push(relative);
+      }
+    }
+
+    return files;
+  }
+
+  /**
+   * sha256 over every path and content of the context: the same checked-in
+   * files always produce the same tag
+   */
+  async digestContext(files) {
+    const hash = crypto.createHash('sha256');
+    for (const file of files) {
+      hash.update(`${file}\0`);
+      hash.update(await fs.promises.readFile(path.join(this.config.contextDir, file)));
+      hash.update('\0');
+    }
+    return hash.digest('hex');
+  }
+
+  packContext(files) {
+    const pack = tar.pack();
+
+    (async () => {
+      for (const file of files) {
+        const content = await fs.promises.readFile(path.join(this.config.contextDir, file));
+        pack.entry({ name: file }, content);
+      }
+      pack.finalize();
+    })().catch(error => pack.destroy(error));
+
+    return pack;
+  }
+
+  /**
+   * Compile and run the runtime's smoke program in a throwaway container of
+   * the new image, then pipe it through the runtime's formatter if it has one
+   * @returns {Object} { passed, exitCode, output, phase, durationMs }
+   */
+  async smokeTest(name, image, userId) {
+    const { smoke, format } = runtimeRegistry.get(name);
+    const startedAt = Date.now();
+    const { containerId } = await dockerService.createContainer(name, 'image-build', userId || 'admin', { image });
+
+    try {
+      const containerInfo = dockerService.containers.get(containerId);
+      const codeFile = dockerService.getCodeFilename(smoke.filename, name);
+      await dockerService.writeFileToContainer(containerInfo.container, codeFile, smoke.code);
+
+      const phases = runtimeRegistry.getPhases(name, codeFile);
+      const run = async (phase, argv) => {
+        const result = await dockerService.runBufferedExec(containerId, argv, { timeoutMs: this.config.smokeTimeoutMs, phase });
+        return { ...result, phase };
+      };
+
+      const succeeded = (result) => result.exitCode === 0 && !result.timedOut;
+
+      let result = phases.compile ? await run('compile', phases.compile) : null;
+      if (!result || succeeded(result)) {
+        result = await run('run', phases.run);
+      }
+
+      let passed = result.phase === 'run' && succeeded(result) && result.stdout.trim() === smoke.expectedOutput;
+      if (passed && format) {
+        const formatFile = `${smoke.filename}.${format.extensions[0]}`;
+        const formatted = await dockerService.runBufferedExec(containerId, runtimeRegistry.renderCommand(format.command, formatFile), {
+          timeoutMs: this.config.smokeTimeoutMs,
+          phase: 'format',
+          stdin: smoke.code
+        });
+        result = { ...formatted, phase: 'format' };
+        passed = succeeded(result);
+      }
+
+      return {
+        passed,
+        phase: result.phase,
+        exitCode: result.exitCode,
+        timedOut: result.timedOut,
+        output: `${result.stdout}${result.stderr}`.slice(0, 4096),
+        durationMs: Date.now() - startedAt
+      };
+    } catch (error) {
+      logger.error(`Smoke test of ${image} failed to run:`, error);
+      return { passed: false, phase: 'setup', exitCode: null, timedOut: false, output: error.message, durationMs: Date.now() - startedAt };
+    } finally {
+      await dockerService.stopContainer(containerId, { force: true }).catch(error =>
+        logger.warn(`Failed to remove smoke test container ${containerId}:`, error.message)
+      );
+    }
+  }
+
+  getBuilds() {
+    return Array.from(this.building.entries()).map(([runtime, build]) => ({ runtime, ...build }));
+  }
+}
+
+module.exports = new ImageBuilder();
\ No newline at end of file
@@ -0,0 +1,182 @@
+const config = require('../config');
+const dockerService = require('./dockerService');
+const runtimeRegistry = require('./runtimeRegistry');
+const buildCache = require('./buildCache');
+const { compare, diff, truncate } = require('../utils/judgeComparison');
+const logger = require('../utils/logger');
+const { ExecError } = require('../utils/execErrors');
+
+// Overall verdict when nothing ran because the build failed
+const COMPILE_ERROR = 'CE';
+
+/**
+ * Judge mode: compile a submission once, then run the binary against each
+ * test case in turn with that case's stdin, in the same container.
+ *
+ * Per-case verdicts are AC (accepted), WA (wrong answer), TLE (over the case
+ * time limit) and RE (non-zero exit). Cases after the failure limit are
+ * reported as skipped.
+ */
+class JudgeService {
+  constructor() {
+    this.config = { ...config.judge };
+  }
+
+  /**
+   * @param {string} containerId - Sandbox container the caller owns
+   * @param {Object} submission - { code, filename, cases: [{ stdin, expected_stdout, comparison, tolerance }] }
+   * @param {Object} options - { comparison, tolerance, maxFailures, caseTimeoutMs, compileTimeoutMs, onCase }
+   * @returns {Object} { verdict, summary, cases, compile, case_timeout_ms }
+   */
+  async run(containerId, { code, filename = 'main', cases }, options = {}) {
+    const containerInfo = dockerService.containers.get(containerId);
+    if (!containerInfo) {
+      throw new ExecError('not_found', 'CONTAINER_NOT_FOUND', 'Container not found');
+    }
+
+    const { language } = containerInfo;
+    const {
+      comparison = 'exact',
+      tolerance = this.config.floatTolerance,
+      maxFailures = this.config.maxFailures,
+      onCase = () => {}
+    } = options;
+
+    // The case limit can only tighten the runtime's run timeout
+    const limits = runtimeRegistry.resolveTimeouts(language, {
+      compileTimeoutMs: options.compileTimeoutMs,
+      runTimeoutMs: options.caseTimeoutMs || this.config.caseTimeoutMs
+    });
+
+    containerInfo.dirty = true;
+    const codeFile = dockerService.getCodeFilename(filename, language);
+    await dockerService.writeFileToContainer(containerInfo.container, codeFile, code);
+
+    const phases = runtimeRegistry.getPhases(language, codeFile);
+    const compile = await this.compile(containerId, language, codeFile, code, phases.compile, limits.compileTimeoutMs);
+
+    if (compile && !compile.ok) {
+      return {
+        verdict: COMPILE_ERROR,
+        summary: { total: cases.length, passed: 0, failed: 0, skipped: cases.length },
+        cases: cases.map((testCase, index) => ({ index, verdict: 'skipped' })),
+        compile: compile.report,
+        case_timeout_ms: limits.runTimeoutMs
+      };
+    }
+
+    const results = [];
+    let failures = 0;
+
+    for (const [index, testCase] of cases.entries()) {
+      if (maxFailures && failures >= maxFailures) {
+        results.push({ index, verdict: 'skipped' });
+        continue;
+      }
+
+      const result = await this.runCase(containerId, phases.run, testCase, {
+        comparison: testCase.comparison || comparison,
+        tolerance: testCase.tolerance !== undefined ? testCase.tolerance : tolerance,
+        timeoutMs: limits.runTimeoutMs
+      });
+      result.index = index;
+
+      if (result.verdict !== 'AC') {
+        failures++;
+      }
+      results.push(result);
+      onCase(result);
+    }
+
+    const passed = results.filter(result => result.verdict === 'AC').length;
+    const skipped = results.filter(result => result.verdict === 'skipped').length;
+    const firstFailure = results.find(result => result.verdict !== 'AC' && result.verdict !== 'skipped');
+
+    logger.info(`Judged ${cases.length} cases in container ${containerId}: ${passed} passed`, {
+      runtime: language,
+      failed: failures,
+      skipped
+    });
+
+    return {
+      verdict: firstFailure ? firstFailure.verdict : 'AC',
+      summary: { total: cases.length, passed, failed: failures, skipped },
+      cases: results,
+      compile: compile ? compile.report : null,
+      case_timeout_ms: limits.runTimeoutMs
+    };
+  }
+
+  /**
+   * Build once for every case, reusing a cached binary when the runtime has one
+   * @returns {Object|null} { ok, report }, or null for interpreted runtimes
+   */
+  async compile(containerId, language, codeFile, code, argv, timeoutMs) {
+    if (!argv) {
+      return null;
+    }
+
+    const runtime = runtimeRegistry.get(language);
+    const imageId = buildCache.isEnabled(runtime) ? await dockerService.getImageId(containerId) : null;
+    const cacheKey = imageId ? buildCache.getKey(runtime, codeFile, code, imageId) : null;
+    if (cacheKey && await dockerService.restoreBuildArtifact(containerId, language, cacheKey)) {
+      return { ok: true, report: { cache: 'hit', duration_ms: 0, output: null } };
+    }
+
+    const result = cacheKey
+      ? await dockerService.compileForCache(containerId, language, { codeFile, code, imageId, argv, env: [], timeoutMs, key: cacheKey })
+      : await dockerService.runCompilePhase(containerId, argv, [], timeoutMs);
+    const ok = !result.timedOut && result.exitCode === 0;
+
+    const output = `${result.stdout}${result.stderr}`.trim();
+    return {
+      ok,
+      report: {
+        cache: cacheKey ? 'miss' : null,
+        exit_code: result.exitCode,
+        timed_out: result.timedOut,
+        duration_ms: result.durationMs,
+        output: output ? truncate(output, this.config.diffLimitBytes).text : null
+      }
+    };
+  }
+
+  async runCase(containerId, argv, testCase, { comparison, tolerance, timeoutMs }) {
+    const result = await dockerService.runBufferedExec(containerId, argv, {
+      stdin: testCase.stdin || '',
+      timeoutMs,
+      phase: 'judge'
+    });
+
+    const report = {
+      verdict: 'AC',
+      duration_ms: result.durationMs,
+      exit_code: result.exitCode
+    };
+
+    if (result.timedOut) {
+      // Only the program dies; the container and the binary stay for the next case
+      await dockerService.signalProcesses(containerId, 'KILL').catch(error =>
+        logger.error(`Failed to kill timed out judge case in container ${containerId}:`, error)
+      );
+      report.verdict = 'TLE';
+      return report;
+    }
+
+    if (result.exitCode !== 0) {
+      report.verdict = 'RE';
+      report.stderr = truncate(result.stderr, this.config.diffLimitBytes).text;
+      return report;
+    }
+
+    const expected = testCase.expected_stdout || '';
+    if (!compare(result.stdout, expected, { mode: comparison, tolerance })) {
+      report.verdict = 'WA';
+      report.diff = diff(result.stdout, expected, this.config.diffLimitBytes);
+    }
+
+    return report;
+  }
+}
+
+module.exports = new JudgeService();
\ No newline at end of file
@@ -0,0 +1,390 @@
+const config = require('../config');
+const logger = require('../utils/logger');
+const dockerService = require('./dockerService');
+const runtimeRegistry = require('./runtimeRegistry');
+const { encodeMessage, MessageReader } = require('../utils/lspFraming');
+
+// Tail of a language server's stderr kept for crash notifications
+const STDERR_TAIL_BYTES = 4096;
+
+/**
+ * Runs a runtime's language server (the registry's `lsp` entry) inside the
+ * user's workspace container and bridges its stdio JSON-RPC to a socket.
+ *
+ * There is one server per workspace and runtime, shared across reconnects:
+ * a socket opening a running session takes it over, and a repeated
+ * `initialize` is answered from the first one's result because the server
+ * only accepts it once. Servers stop after idleTimeoutMs without editor
+ * traffic and are restarted when they crash (up to maxRestarts per
+ * restartWindowMs); the client is sent `lsp:restarted` and must initialize again.
+ *
+ * Socket events (client -> server):
+ *   lsp:open     { containerId, workspaceId, language? }
+ *   lsp:message  { sessionId, message } with message a bare JSON-RPC object
+ *   lsp:close    { sessionId, shutdown? } detaches, and stops the server if `shutdown`
+ *
+ * Server -> client:
+ *   lsp:opened, lsp:message, lsp:restarted, lsp:detached, lsp:closed, lsp:error
+ */
+class LspGateway {
+  constructor() {
+    this.config = { ...config.lspGateway };
+    this.sessions = new Map(); // "workspaceId:runtime" -> session
+  }
+
+  sendError(socket, sessionId, code, message) {
+    socket.emit('lsp:error', { sessionId, code, message });
+  }
+
+  /**
+   * Start or take over the language server for a workspace
+   */
+  async handleOpen(socket, data = {}) {
+    const { containerId, workspaceId, language } = data;
+
+    if (!containerId || !workspaceId) {
+      this.sendError(socket, null, 'INVALID_REQUEST', 'containerId and workspaceId are required');
+      return;
+    }
+
+    const containerInfo = await dockerService.getContainerInfo(containerId);
+    if (!containerInfo || String(containerInfo.userId) !== String(socket.userId)) {
+      this.sendError(socket, null, 'CONTAINER_NOT_FOUND', 'Container not found');
+      return;
+    }
+    if (containerInfo.mountWorkspaceId !== workspaceId) {
+      this.sendError(socket, null, 'WORKSPACE_NOT_MOUNTED', 'Container was not created with this workspace mounted');
+      return;
+    }
+
+    const runtime = runtimeRegistry.get(containerInfo.language);
+    if (!runtime || !runtime.lsp || (language && !runtime.lsp.languages.includes(language))) {
+      this.sendError(socket, null, 'NO_LANGUAGE_SERVER',
+        `No language server is configured for ${language || containerInfo.language} in ${containerInfo.language} containers`);
+      return;
+    }
+
+    const sessionId = `${workspaceId}:${runtime.name}`;
+    let session = this.sessions.get(sessionId);
+
+    // One server per workspace: a different container replaces it
+    if (session && session.containerId !== containerId) {
+      this.stopSession(session, 'replaced');
+      session = null;
+    }
+
+    const reused = Boolean(session);
+    if (!session) {
+      session = {
+        id: sessionId,
+        workspaceId,
+        containerId,
+        runtime,
+        socket: null,
+        process: null,
+        reader: null,
+        stderrTail: '',
+        initializeResult: null,
+        pendingInitializeId: null,
+        initialized: false,
+        restarts: [], // timestamps of crash restarts inside restartWindowMs
+        idleTimer: null,
+        stopping: false
+      };
+      this.sessions.set(sessionId, session);
+
+      try {
+        await this.startServer(session);
+      } catch (error) {
+        this.sessions.delete(sessionId);
+        logger.error(`Failed to start ${runtime.lsp.command[0]} in container ${containerId}:`, error);
+        this.sendError(socket, sessionId, 'START_FAILED', error.message);
+        return;
+      }
+    }
+
+    if (session.socket && session.socket !== socket) {
+      session.socket.emit('lsp:detached', { sessionId, reason: 'taken_over' });
+    }
+    session.socket = socket;
+    this.touch(session);
+
+    socket.emit('lsp:opened', {
+      sessionId,
+      workspaceId,
+      runtime: runtime.name,
+      server: runtime.lsp.command[0],
+      languages: runtime.lsp.languages,
+      reused,
+      initialized: Boolean(session.initializeResult)
+    });
+
+    logger.info(`LSP session ${sessionId} ${reused ? 'attached' : 'started'}`, {
+      socketId: socket.id,
+      userId: socket.userId,
+      containerId
+    });
+  }
+
+  /**
+   * Exec the language server and wire its stdout through the framing decoder
+   */
+  async startServer(session) {
+    const { lsp, env } = session.runtime;
+    const proc = await dockerService.createStdioExec(session.containerId, lsp.command, {
+      // The root filesystem is read-only; servers keep their caches under HOME
+      env: [...env, 'HOME=/tmp']
+    });
+
+    session.process = proc;
+    session.stderrTail = '';
+    session.initializeResult = null;
+    session.pendingInitializeId = null;
+    session.initialized = false;
+    session.reader = new MessageReader({
+      onMessage: (message) => this.handleServerMessage(session, message),
+      onError: (error) => logger.warn(`LSP session ${session.id}: ${error.message}`)
+    }, this.config.maxMessageBytes);
+
+    const reader = session.reader;
+    proc.stdout.on('data', chunk => reader.write(chunk));
+    proc.stderr.on('data', chunk => {
+      session.stderrTail = (session.stderrTail + chunk.toString('utf8')).slice(-STDERR_TAIL_BYTES);
+    });
+
+    let exited = false;
+    const onExit = () => {
+      if (!exited) {
+        exited = true;
+        this.handleExit(session, proc);
+      }
+    };
+    proc.stream.on('end', onExit);
+    proc.stream.on('close', onExit);
+    proc.stream.on('error', onExit);
+  }
+
+  handleServerMessage(session, message) {
+    const isResponse = message.id !== undefined && !message.method;
+
+    if (isResponse && session.pendingInitializeId !== null && message.id === session.pendingInitializeId) {
+      session.initializeResult = message.result || null;
+      session.pendingInitializeId = null;
+    }
+
+    if (session.socket) {
+      session.socket.emit('lsp:message', { sessionId: session.id, message });
+      return;
+    }
+
+    // Nobody can answer server requests (workspace/configuration, ...) while detached
+    if (message.id !== undefined && message.method) {
+      this.writeToServer(session, {
+        jsonrpc: '2.0',
+        id: message.id,
+        error: { code: -32603, message: 'No editor attached' }
+      });
+    }
+  }
+
+  /**
+   * Forward an editor message to the server
+   */
+  handleMessage(socket, data = {}) {
+    const { sessionId } = data;
+    const session = this.sessions.get(sessionId);
+
+    if (!session || session.socket !== socket) {
+      this.sendError(socket, sessionId, 'NOT_ATTACHED', 'Open the language server session first');
+      return;
+    }
+
+    let message = data.message;
+    if (typeof message === 'string') {
+      try {
+        message = JSON.parse(message);
+      } catch (error) {
+        this.sendError(socket, sessionId, 'INVALID_MESSAGE', `Message is not JSON: ${error.message}`);
+        return;
+      }
+    }
+    if (!message || typeof message !== 'object' || Array.isArray(message)) {
+      this.sendError(socket, sessionId, 'INVALID_MESSAGE', 'Message must be a JSON-RPC object');
+      return;
+    }
+
+    if (!session.process) {
+      this.sendError(socket, sessionId, 'NOT_RUNNING', 'Language server is restarting');
+      return;
+    }
+
+    this.touch(session);
+
+    if (message.method === 'initialize') {
+      if (session.initializeResult) {
+        socket.emit('lsp:message', {
+          sessionId,
+          message: { jsonrpc: '2.0', id: message.id, result: session.initializeResult }
+        });
+        return;
+      }
+      session.pendingInitializeId = message.id;
+    }
+
+    if (message.method === 'initialized') {
+      if (session.initialized) {
+        return;
+      }
+      session.initialized = true;
+    }
+
+    if (message.method === 'exit') {
+      this.stopSession(session, 'exit');
+      return;
+    }
+
+    this.writeToServer(session, message);
+    dockerService.updateContainerActivity(session.containerId);
+  }
+
+  writeToServer(session, message) {
+    if (session.process) {
+      session.process.stream.write(encodeMessage(message));
+    }
+  }
+
+  /**
+   * Detach the socket; the server keeps running until idle unless `shutdown`
+   */
+  handleClose(socket, data = {}) {
+    const session = this.sessions.get(data.sessionId);
+    if (!session || session.socket !== socket) {
+      return;
+    }
+
+    if (data.shutdown) {
+      this.stopSession(session, 'closed');
+      return;
+    }
+
+    session.socket = null;
+    socket.emit('lsp:detached', { sessionId: session.id, reason: 'closed' });
+  }
+
+  handleDisconnection(socket) {
+    for (const session of this.sessions.values()) {
+      if (session.socket === socket) {
+        session.socket = null;
+      }
+    }
+  }
+
+  /**
+   * Restart a server that exited on its own, or give up if it keeps crashing
+   */
+  async handleExit(session, proc) {
+    if (session.process !== proc) {
+      return;
+    }
+    session.process = null;
+
+    if (session.stopping) {
+      return;
+    }
+
+    const now = Date.now();
+    session.restarts = session.restarts.filter(time => now - time < this.config.restartWindowMs);
+    const stderr = session.stderrTail.trim() || null;
+
+    if (session.restarts.length >= this.config.maxRestarts) {
+      logger.error(`LSP session ${session.id} crashed ${session.restarts.length + 1} times, giving up`, { stderr });
+      this.stopSession(session, 'crashed', { stderr });
+      return;
+    }
+
+    session.restarts.push(now);
+    logger.warn(`Language server for ${session.id} exited, restarting (${session.restarts.length}/${this.config.maxRestarts})`, { stderr });
+
+    try {
+      await this.startServer(session);
+    } catch (error) {
+      logger.error(`Failed to restart language server for ${session.id}:`, error);
+      this.stopSession(session, 'crashed', { stderr: error.message });
+      return;
+    }
+
+    if (session.socket) {
+      session.socket.emit('lsp:restarted', {
+        sessionId: session.id,
+        restarts: session.restarts.length,
+        stderr
+      });
+    }
+  }
+
+  touch(session) {
+    clearTimeout(session.idleTimer);
+    session.idleTimer = setTimeout(() => this.stopSession(session, 'idle'), this.config.idleTimeoutMs);
+    session.idleTimer.unref();
+  }
+
+  /**
+   * Stop a server and forget the session. Closing stdin makes the servers
+   * we run exit; anything that ignores it goes away with its container.
+   */
+  stopSession(session, reason, details = {}) {
+    session.stopping = true;
+    clearTimeout(session.idleTimer);
+    if (this.sessions.get(session.id) === session) {
+      this.sessions.delete(session.id);
+    }
+
+    const proc = session.process;
+    session.process = null;
+    if (proc) {
+      try {
+        proc.stream.end(encodeMessage({ jsonrpc: '2.0', method: 'exit' }));
+      } catch (error) {
+        logger.debug(`LSP session ${session.id}: failed to send exit: ${error.message}`);
+      }
+    }
+
+    if (session.socket) {
+      session.socket.emit('lsp:closed', { sessionId: session.id, reason, ...details });
+      session.socket = null;
+    }
+
+    logger.info(`LSP session ${session.id} stopped: ${reason}`);
+  }
+
+  /**
+   * Stop the servers running in a container, e.g. before it hibernates
+   */
+  stopContainerSessions(containerId, reason) {
+    for (const session of Array.from(this.sessions.values())) {
+      if (session.containerId === containerId) {
+        this.stopSession(session, reason);
+      }
+    }
+  }
+
+  getSessions() {
+    return Array.from(this.sessions.values()).map(session => ({
+      sessionId: session.id,
+      workspaceId: session.workspaceId,
+      containerId: session.containerId,
+      runtime: session.runtime.name,
+      attached: Boolean(session.socket),
+      running: Boolean(session.process),
+      restarts: session.restarts.length
+    }));
+  }
+
+  shutdown() {
+    for (const session of Array.from(this.sessions.values())) {
+      this.stopSession(session, 'shutdown');
+    }
+  }
+}
+
+module.exports = new LspGateway();
\ No newline at end of file
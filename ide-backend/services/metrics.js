@@ -0,0 +1,243 @@
+const client = require('prom-client');
+
+// Seconds; executions are short, container cold starts and builds run longer
+const LATENCY_BUCKETS = [0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60];
+
+/**
+ * Prometheus instrumentation for the executor. Metric names are part of the
+ * operator-facing contract; don't rename them:
+ *
+ *   studio_executions_total{runtime,outcome}        counter, outcome: success|compile_error|runtime_error|timeout|oom|disk_limit|cancelled
+ *   studio_execution_queue_wait_seconds             histogram, time waiting for a queue slot
+ *   studio_container_start_seconds{runtime,pooled}  histogram, container acquire/cold start
+ *   studio_execution_compile_seconds{runtime}       histogram, build step (runtimes with a separate compile phase)
+ *   studio_execution_run_seconds{runtime}           histogram, program run time
+ *   studio_build_cache_lookups_total{runtime,result} counter, result: hit|miss (runtimes with a build cache)
+ *   studio_reaped_resources_total{resource,dry_run} counter, resource: container|volume, leaks the reaper removed
+ *   studio_workspace_resume_seconds                 histogram, starting a hibernated workspace container again
+ *   studio_containers_running                       gauge, containers tracked by the docker service, less hibernated ones
+ *   studio_workspaces{state}                        gauge, state: active|hibernating|hibernated|resuming, workspaces with a container
+ *   studio_pool_idle_containers{runtime}            gauge, warm containers waiting in the pool
+ *   studio_websocket_sessions                       gauge, connected WebSocket clients
+ *
+ * Gauges are sampled at scrape time from sources registered with setSource().
+ */
+class ExecutionMetrics {
+  constructor() {
+    this.sources = {};
+    this.setRegistry(new client.Registry(), { defaultMetrics: process.env.NODE_ENV !== 'test' });
+  }
+
+  /**
+   * Swap the registry (tests inject a fresh one) and recreate every metric on it
+   */
+  setRegistry(registry, { defaultMetrics = false } = {}) {
+    this.registry = registry;
+    const registers = [registry];
+    const source = (name, fallback) => (this.sources[name] ? this.sources[name]() : fallback);
+
+    if (defaultMetrics) {
+      client.collectDefaultMetrics({ register: registry });
+    }
+
+    this.executions = new client.Counter({
+      name: 'studio_executions_total',
+      help: 'Executions by runtime and outcome',
+      labelNames: ['runtime', 'outcome'],
+      registers
+    });
+
+    this.queueWait = new client.Histogram({
+      name: 'studio_execution_queue_wait_seconds',
+      help: 'Time executions spend waiting for a queue slot',
+      buckets: LATENCY_BUCKETS,
+      registers
+    });
+
+    this.containerStart = new client.Histogram({
+      name: 'studio_container_start_seconds',
+      help: 'Time to acquire a warm container or cold start a new one',
+      labelNames: ['runtime', 'pooled'],
+      buckets: LATENCY_BUCKETS,
+      registers
+    });
+
+    this.compileTime = new client.Histogram({
+      name: 'studio_execution_compile_seconds',
+      help: 'Duration of the compile phase',
+      labelNames: ['runtime'],
+      buckets: LATENCY_BUCKETS,
+      registers
+    });
+
+    this.runTime = new client.Histogram({
+      name: 'studio_execution_run_seconds',
+      help: 'Duration of the run phase',
+      labelNames: ['runtime'],
+      buckets: LATENCY_BUCKETS,
+      registers
+    });
+
+    this.buildCacheLookups = new client.Counter({
+      name: 'studio_build_cache_lookups_total',
+      help: 'Build artifact cache lookups by runtime and result',
+      labelNames: ['runtime', 'result'],
+      registers
+    });
+
+    this.reapedResources = new client.Counter({
+      name: 'studio_reaped_resources_total',
+      help: 'Leaked containers and volumes found by the resource reaper',
+      labelNames: ['resource', 'dry_run'],
+      registers
+    });
+
+    this.workspaceResume = new client.Histogram({
+      name: 'studio_workspace_resume_seconds',
+      help: 'Time to start a hibernated workspace container again',
+      buckets: LATENCY_BUCKETS,
+      registers
+    });
+
+    new client.Gauge({
+      name: 'studio_containers_running',
+      help: 'Execution containers currently tracked',
+      registers,
+      collect() {
+        this.set(source('runningContainers', 0));
+      }
+    });
+
+    new client.Gauge({
+      name: 'studio_pool_idle_containers',
+      help: 'Idle warm containers in the pool',
+      labelNames: ['runtime'],
+      registers,
+      collect() {
+        this.reset();
+        const idle = source('poolIdle', {});
+        for (const [runtime, count] of Object.entries(idle)) {
+          this.set({ runtime }, count);
+        }
+      }
+    });
+
+    new client.Gauge({
+      name: 'studio_workspaces',
+      help: 'Workspaces with a container, by hibernation state',
+      labelNames: ['state'],
+      registers,
+      collect() {
+        this.reset();
+        const states = source('workspaceStates', {});
+        for (const [state, count] of Object.entries(states)) {
+          this.set({ state }, count);
+        }
+      }
+    });
+
+    new client.Gauge({
+      name: 'studio_websocket_sessions',
+      help: 'Connected WebSocket sessions',
+      registers,
+      collect() {
+        this.set(source('websocketSessions', 0));
+      }
+    });
+  }
+
+  /**
+   * Register a gauge source: runningContainers, poolIdle ({ runtime: count }) or websocketSessions
+   */
+  setSource(name, fn) {
+    this.sources[name] = fn;
+  }
+
+  /**
+   * Map a finished execution record to its outcome label
+   */
+  classifyOutcome(executionData) {
+    if (executionData.status === 'cancelled' || executionData.status === 'stopped') {
+      return 'cancelled';
+    }
+    if (executionData.killedReason === 'timeout') {
+      return 'timeout';
+    }
+    if (executionData.killedReason === 'oom') {
+      return 'oom';
+    }
+    if (executionData.killedReason === 'disk_limit') {
+      return 'disk_limit';
+    }
+    if (executionData.exitCode === 0 && executionData.status === 'completed') {
+      return 'success';
+    }
+    if (executionData.compileFailed || this.isCompileDiagnostic(executionData)) {
+      return 'compile_error';
+    }
+    return 'runtime_error';
+  }
+
+  isCompileDiagnostic({ language, diagnostics = [] }) {
+    return diagnostics.some(({ message }) => {
+      if (/^(?:SyntaxError|IndentationError|TabError)\b/.test(message)) {
+        return true;
+      }
+      // Go reports build errors as file:line diagnostics and runtime panics with a "panic:" message
+      return language === 'go' && !message.startsWith('panic:');
+    });
+  }
+
+  /**
+   * Count a finished execution and record its phase durations
+   */
+  recordExecution(executionData) {
+    const runtime = executionData.language || 'unknown';
+    const outcome = this.classifyOutcome(executionData);
+
+    this.executions.inc({ runtime, outcome });
+
+    if (typeof executionData.compileDurationMs === 'number') {
+      this.compileTime.observe({ runtime }, executionData.compileDurationMs / 1000);
+    }
+    if (typeof executionData.duration === 'number') {
+      const runMs = executionData.duration - (executionData.compileDurationMs || 0);
+      this.runTime.observe({ runtime }, Math.max(runMs, 0) / 1000);
+    }
+
+    return outcome;
+  }
+
+  observeQueueWait(seconds) {
+    this.queueWait.observe(seconds);
+  }
+
+  observeBuildCache(runtime, result) {
+    this.buildCacheLookups.inc({ runtime, result });
+  }
+
+  observeReaped(resource, dryRun) {
+    this.reapedResources.inc({ resource, dry_run: String(Boolean(dryRun)) });
+  }
+
+  observeContainerStart(runtime, pooled, seconds) {
+    this.containerStart.observe({ runtime, pooled: String(Boolean(pooled)) }, seconds);
+  }
+
+  observeWorkspaceResume(seconds) {
+    this.workspaceResume.observe(seconds);
+  }
+
+  /**
+   * Prometheus text exposition of the current registry
+   */
+  async metrics() {
+    return this.registry.metrics();
+  }
+
+  get contentType() {
+    return this.registry.contentType;
+  }
+}
+
+module.exports = new ExecutionMetrics();
\ No newline at end of file
@@ -0,0 +1,138 @@
+const path = require('path');
+const fs = require('fs');
+const config = require('../config');
+const logger = require('../utils/logger');
+
+const STREAMS = ['stdout', 'stderr'];
+
+/**
+ * Full execution output on disk, one file per stream at
+ * <spillPath>/<executionId>.<stream>, for outputs too large to keep in
+ * memory or in the history record. Each file stops growing at spillMaxBytes.
+ * Files are removed by the execution history prune job once they are older
+ * than spillRetentionMs.
+ */
+class OutputSpill {
+  constructor() {
+    this.config = { ...config.outputLimits };
+  }
+
+  isEnabled() {
+    return this.config.spillEnabled;
+  }
+
+  getFilePath(executionId, stream) {
+    if (!/^[\w-]+$/.test(executionId) || !STREAMS.includes(stream)) {
+      throw new Error('Invalid spill file name');
+    }
+    return path.join(path.resolve(this.config.spillPath), `${executionId}.${stream}`);
+  }
+
+  /**
+   * Writers for both streams of an execution: { stdout, stderr }, each with
+   * write(buffer), close() (a promise) and bytes/truncated/failed
+   */
+  open(executionId) {
+    fs.mkdirSync(path.resolve(this.config.spillPath), { recursive: true });
+    return Object.fromEntries(STREAMS.map(stream => [stream, this.createWriter(this.getFilePath(executionId, stream))]));
+  }
+
+  createWriter(filePath) {
+    const maxBytes = this.config.spillMaxBytes;
+    let file = null;
+
+    const writer = {
+      bytes: 0,
+      truncated: false,
+      failed: false,
+      write: (buffer) => {
+        if (writer.failed || writer.truncated) {
+          return;
+        }
+
+        // Created on the first write, so silent streams leave no file behind
+        if (!file) {
+          file = fs.createWriteStream(filePath, { mode: 0o600 });
+          file.on('error', (error) => {
+            writer.failed = true;
+            logger.warn(`Output spill to ${filePath} failed:`, error.message);
+          });
+        }
+
+        const room = maxBytes - writer.bytes;
+        if (buffer.length > room) {
+          buffer = buffer.subarray(0, room);
+          writer.truncated = true;
+        }
+        writer.bytes += buffer.length;
+        file.write(buffer);
+      },
+      // Resolves once the file is flushed (or failed)
+      close: () => new Promise((resolve) => {
+        if (!file || file.closed) {
+          return resolve();
+        }
+        file.once('close', resolve);
+        file.end();
+      })
+    };
+    return writer;
+  }
+
+  /**
+   * The spill file of a stream, or null if there is none (never spilled or
+   * already removed)
+   * @returns {Object|null} { path, size }
+   */
+  async find(executionId, stream) {
+    try {
+      const filePath = this.getFilePath(executionId, stream);
+      const stats = await fs.promises.stat(filePath);
+      return { path: filePath, size: stats.size };
+    } catch (error) {
+      return null;
+    }
+  }
+
+  /**
+   * Delete spill files last written before `date`
+   * @returns {number} Files removed
+   */
+  async removeOlderThan(date) {
+    const dir = path.resolve(this.config.spillPath);
+    let names;
+    try {
+      names = await fs.promises.readdir(dir);
+    } catch (error) {
+      return 0; // nothing spilled yet
+    }
+
+    let removed = 0;
+    for (const name of names) {
+      const filePath = path.join(dir, name);
+      try {
+        const stats = await fs.promises.stat(filePath);
+        if (stats.isFile() && stats.mtime < date) {
+          await fs.promises.unlink(filePath);
+          removed++;
+        }
+      } catch (error) {
+        logger.warn(`Failed to remove output spill ${name}:`, error.message);
+      }
+    }
+    return removed;
+  }
+
+  /**
+   * Remove files past the spill retention window
+   */
+  async prune() {
+    const removed = await this.removeOlderThan(new Date(Date.now() - this.config.spillRetentionMs));
+    if (removed > 0) {
+      logger.info(`Removed ${removed} expired output spill files`);
+    }
+    return removed;
+  }
+}
+
+module.exports = new OutputSpill();
\ No newline at end of file
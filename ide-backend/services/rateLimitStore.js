@@ -0,0 +1,149 @@
+const config = require('../config');
+const logger = require('../utils/logger');
+
+/**
+ * Token bucket stores. Both implement:
+ *
+ *   take(key, { capacity, refillPerSecond, cost }) ->
+ *     { allowed, remaining, resetMs, retryAfterMs }
+ *
+ * A missing bucket starts full. `take` refills the bucket for the time since
+ * it was last touched, then removes `cost` tokens if that many are there;
+ * the whole read-modify-write is atomic per key.
+ */
+
+// Result of a take given the tokens left afterwards
+const describe = (allowed, tokens, { capacity, refillPerSecond, cost }) => {
+  const msFor = (missing) => (refillPerSecond > 0 ? Math.ceil((missing / refillPerSecond) * 1000) : Infinity);
+  return {
+    allowed,
+    remaining: Math.max(0, Math.floor(tokens)),
+    resetMs: msFor(Math.max(0, capacity - tokens)),
+    retryAfterMs: allowed ? 0 : msFor(cost - tokens)
+  };
+};
+
+class MemoryRateLimitStore {
+  constructor() {
+    this.buckets = new Map(); // key -> { tokens, updatedAt, fullAt }
+    this.takes = 0;
+  }
+
+  async take(key, { capacity, refillPerSecond, cost = 1 }, now = Date.now()) {
+    const bucket = this.buckets.get(key);
+    let tokens = capacity;
+    if (bucket) {
+      tokens = Math.min(capacity, bucket.tokens + ((now - bucket.updatedAt) / 1000) * refillPerSecond);
+    }
+
+    const allowed = tokens >= cost;
+    if (allowed) {
+      tokens -= cost;
+    }
+
+    const result = describe(allowed, tokens, { capacity, refillPerSecond, cost });
+    this.buckets.set(key, { tokens, updatedAt: now, fullAt: now + result.resetMs });
+
+    if (++this.takes % 1000 === 0) {
+      this.sweep(now);
+    }
+    return result;
+  }
+
+  // Full buckets are the same as missing ones
+  sweep(now = Date.now()) {
+    for (const [key, bucket] of this.buckets.entries()) {
+      if (bucket.fullAt <= now) {
+        this.buckets.delete(key);
+      }
+    }
+  }
+}
+
+// Refill and take in one script so concurrent requests from every node see
+// a consistent bucket. Time comes from the Redis server, not the callers'
+// clocks (calling TIME before writing needs Redis 5+). Token counts are
+// returned as strings: Lua numbers become integers.
+const TAKE_SCRIPT = `
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+  tokens = capacity
+  ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+if tokens >= cost then
+  tokens = tokens - cost
+  allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return { allowed, tostring(tokens) }
+`;
+
+class RedisRateLimitStore {
+  /**
+   * @param {Object} client - ioredis connection (utils/database)
+   * @param {string} keyPrefix - Namespace for bucket keys
+   */
+  constructor(client, keyPrefix = config.tokenBuckets.keyPrefix) {
+    this.client = client;
+    this.keyPrefix = keyPrefix;
+  }
+
+  async take(key, { capacity, refillPerSecond, cost = 1 }) {
+    // Once a bucket has had time to refill completely it can expire
+    const ttlMs = refillPerSecond > 0 ? Math.ceil((capacity / refillPerSecond) * 1000) + 1000 : 24 * 60 * 60 * 1000;
+    const [allowed, tokens] = await this.client.eval(
+      TAKE_SCRIPT, 1, `${this.keyPrefix}${key}`,
+      capacity, refillPerSecond, cost, ttlMs
+    );
+    return describe(Number(allowed) === 1, parseFloat(tokens), { capacity, refillPerSecond, cost });
+  }
+}
+
+let store = null;
+let fallbackStore = null;
+
+/**
+ * The configured store. A Redis store whose connection isn't up yet falls
+ * back to a per-process memory store until it is.
+ */
+const getStore = () => {
+  if (store) {
+    return store;
+  }
+
+  if (config.tokenBuckets.store === 'redis') {
+    try {
+      const { getRedisConnection } = require('../utils/database');
+      store = new RedisRateLimitStore(getRedisConnection());
+      return store;
+    } catch (error) {
+      if (!fallbackStore) {
+        logger.warn('Rate limiting with the memory store until Redis is connected:', error.message);
+        fallbackStore = new MemoryRateLimitStore();
+      }
+      return fallbackStore;
+    }
+  }
+
+  store = new MemoryRateLimitStore();
+  return store;
+};
+
+const setStore = (replacement) => {
+  store = replacement;
+};
+
+module.exports = { MemoryRateLimitStore, RedisRateLimitStore, TAKE_SCRIPT, getStore, setStore };
\ No newline at end of file
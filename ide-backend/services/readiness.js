@@ -0,0 +1,134 @@
+const config = require('../config');
+const logger = require('../utils/logger');
+const dockerService = require('./dockerService');
+const executionQueue = require('./executionQueue');
+const runtimeRegistry = require('./runtimeRegistry');
+
+// Rejects after `ms` so a hung Docker socket fails the probe instead of stalling it
+const withDeadline = (promise, ms, what) => {
+  let timer;
+  const deadline = new Promise((resolve, reject) => {
+    timer = setTimeout(() => reject(new Error(`${what} timed out after ${ms}ms`)), ms);
+  });
+  return Promise.race([promise, deadline]).finally(() => clearTimeout(timer));
+};
+
+// Docker reports untagged references as name:latest
+const normalizeImage = (image) => {
+  const lastSegment = image.slice(image.lastIndexOf('/') + 1);
+  return image.includes('@') || lastSegment.includes(':') ? image : `${image}:latest`;
+};
+
+/**
+ * Readiness checks behind GET /readyz: the Docker daemon answers, the
+ * runtime images are present locally (a missing image would be pulled on the
+ * first execution, or fail offline) and the execution queue isn't wedged.
+ * Results are cached for cacheMs and concurrent probes share one run.
+ */
+class Readiness {
+  constructor() {
+    this.config = { ...config.readiness };
+    this.cached = null; // { result, expiresAt }
+    this.running = null;
+  }
+
+  /**
+   * @returns {Object} { status: 'ready'|'not_ready', checkedAt, cached, checks: { docker, images, queue } }
+   */
+  async check() {
+    if (this.cached && this.cached.expiresAt > Date.now()) {
+      return { ...this.cached.result, cached: true };
+    }
+
+    if (!this.running) {
+      this.running = this.runChecks()
+        .then((result) => {
+          this.cached = { result, expiresAt: Date.now() + this.config.cacheMs };
+          return result;
+        })
+        .finally(() => {
+          this.running = null;
+        });
+    }
+    return { ...(await this.running), cached: false };
+  }
+
+  async runChecks() {
+    const docker = await this.checkDocker();
+    const images = docker.status === 'ok'
+      ? await this.checkImages()
+      : { status: 'skipped', message: 'Docker is unavailable' };
+    const queue = this.checkQueue();
+
+    const ready = [docker, images, queue].every(check => check.status === 'ok');
+    if (!ready) {
+      logger.warn('Readiness check failed', { docker: docker.status, images: images.status, queue: queue.status });
+    }
+
+    return {
+      status: ready ? 'ready' : 'not_ready',
+      checkedAt: new Date().toISOString(),
+      checks: { docker, images, queue }
+    };
+  }
+
+  async checkDocker() {
+    const startTime = Date.now();
+    try {
+      await withDeadline(dockerService.docker.ping(), this.config.dockerTimeoutMs, 'Docker ping');
+      return { status: 'ok', latencyMs: Date.now() - startTime };
+    } catch (error) {
+      return { status: 'fail', message: error.message, latencyMs: Date.now() - startTime };
+    }
+  }
+
+  /**
+   * Required runtimes: config.readiness.requiredRuntimes, or every registered runtime
+   */
+  getRequiredRuntimes() {
+    const runtimes = runtimeRegistry.list();
+    if (!this.config.requiredRuntimes) {
+      return runtimes;
+    }
+    return this.config.requiredRuntimes.map(name =>
+      runtimes.find(runtime => runtime.name === name) || { name, image: null }
+    );
+  }
+
+  async checkImages() {
+    let local;
+    try {
+      local = await withDeadline(dockerService.docker.listImages(), this.config.dockerTimeoutMs, 'Image listing');
+    } catch (error) {
+      return { status: 'fail', message: error.message };
+    }
+
+    const present = new Set(local.flatMap(image => [...(image.RepoTags || []), ...(image.RepoDigests || [])]));
+    const required = this.getRequiredRuntimes();
+    const missing = required
+      .filter(runtime => !runtime.image || !present.has(normalizeImage(runtime.image)))
+      .map(runtime => ({ runtime: runtime.name, image: runtime.image }));
+
+    return missing.length === 0
+      ? { status: 'ok', required: required.length }
+      : { status: 'fail', message: `${missing.length} runtime image(s) missing`, required: required.length, missing };
+  }
+
+  checkQueue() {
+    if (executionQueue.draining) {
+      return { status: 'fail', message: 'Shutting down' };
+    }
+
+    const stuck = executionQueue.getStuck();
+    const state = { running: executionQueue.running, waiting: executionQueue.waiting.length };
+    return stuck.length === 0
+      ? { status: 'ok', ...state }
+      : { status: 'fail', message: `${stuck.length} execution slot(s) held past their timeout`, ...state, stuck: stuck.length };
+  }
+
+  clearCache() {
+    this.cached = null;
+  }
+}
+
+module.exports = new Readiness();
\ No newline at end of file
@@ -0,0 +1,412 @@
+const crypto = require('crypto');
+const config = require('../config');
+const logger = require('../utils/logger');
+const dockerService = require('./dockerService');
+const runtimeRegistry = require('./runtimeRegistry');
+const { ReplTranscript, prepareLines } = require('../utils/replTranscript');
+
+// How long an interrupted snippet gets to give the prompt back
+const INTERRUPT_GRACE_MS = 2000;
+
+const replError = (message, code) => {
+  const error = new Error(message);
+  error.code = code;
+  return error;
+};
+
+/**
+ * REPL sessions: a runtime's interpreter (the registry's `repl` entry) runs
+ * attached to a PTY in a dedicated container, so variables survive between
+ * evaluations. Snippets are typed in line by line and each evaluation's
+ * output is everything up to the next primary prompt.
+ */
+class ReplSessionService {
+  constructor() {
+    this.config = { ...config.repl };
+    this.sessions = new Map(); // sessionId -> session
+    this.userSessions = new Map(); // userId -> Set of sessionIds
+    this.starting = new Map(); // userId -> sessions being created, not yet in userSessions
+  }
+
+  /**
+   * Start an interpreter. At the per-user cap the least recently used idle
+   * session is evicted to make room.
+   * @param {string} userId - User ID
+   * @param {Object} options - { language, limits }
+   * @param {Object} handlers - { onExit({ sessionId, reason }) }
+   * @returns {Object} Session info
+   */
+  async createSession(userId, { language, limits } = {}, { onExit } = {}) {
+    const runtime = runtimeRegistry.get(language);
+    if (!runtime || !runtime.repl) {
+      throw replError(`No REPL is configured for ${language}`, 'REPL_NOT_SUPPORTED');
+    }
+
+    const release = await this.makeRoom(userId);
+
+    const { repl } = runtime;
+    let containerId;
+    let exec;
+    let stream;
+    try {
+      ({ containerId } = await dockerService.createContainer(language, `repl-${userId}`, userId, { limits }));
+    } catch (error) {
+      release();
+      throw error;
+    }
+
+    try {
+      // A dumb terminal keeps line editors from redrawing the input line
+      ({ exec, stream } = await dockerService.createTtyExec(containerId, {
+        cmd: repl.command,
+        env: ['TERM=dumb', ...repl.env]
+      }));
+    } catch (error) {
+      release();
+      await dockerService.stopContainer(containerId).catch(() => {});
+      throw error;
+    }
+
+    const session = {
+      id: 'repl_' + crypto.randomBytes(12).toString('hex'),
+      userId,
+      language,
+      containerId,
+      repl,
+      exec,
+      stream,
+      createdAt: new Date(),
+      lastActivity: new Date(),
+      evaluations: 0,
+      idleTimer: null,
+      pending: null, // prompt wait in progress, fed by the stream
+      busy: false,
+      closed: false,
+      onExit
+    };
+
+    session.handleData = (chunk) => {
+      // Output between evaluations (background threads, timers) has no reader
+      if (session.pending) {
+        session.pending.push(chunk);
+      }
+    };
+    session.handleEnd = () => this.destroySession(session.id, 'exited');
+    session.handleError = (error) => {
+      logger.warn(`REPL ${session.id} stream error:`, error.message);
+      this.destroySession(session.id, 'error');
+    };
+
+    stream.on('data', session.handleData);
+    stream.on('end', session.handleEnd);
+    stream.on('close', session.handleEnd);
+    stream.on('error', session.handleError);
+
+    this.sessions.set(session.id, session);
+    if (!this.userSessions.has(userId)) {
+      this.userSessions.set(userId, new Set());
+    }
+    this.userSessions.get(userId).add(session.id);
+    release(); // counted in userSessions from here on
+    this.touch(session);
+
+    // Skip the banner; the session is usable once the first prompt shows
+    const started = await this.waitForPrompt(session, this.createTranscript(repl), this.config.startTimeoutMs);
+    if (started.done !== 'prompt') {
+      await this.destroySession(session.id, 'start_failed');
+      throw replError(`The ${language} interpreter did not start`, 'REPL_START_FAILED');
+    }
+
+    logger.info('REPL session created', { sessionId: session.id, userId, language, containerId });
+    return this.getSessionInfo(session.id);
+  }
+
+  /**
+   * Take a slot for a session about to start, evicting the least recently
+   * used idle session at the cap. Sessions still starting hold their slot
+   * too, and it is taken before anything is awaited, so concurrent creates
+   * can't all find the same free slot.
+   * @returns {Function} Gives the slot back once the session is registered or failed to start
+   */
+  async makeRoom(userId) {
+    const ids = Array.from(this.userSessions.get(userId) || []);
+    const starting = this.starting.get(userId) || 0;
+
+    let evict = null;
+    if (ids.length + starting >= this.config.maxPerUser) {
+      const idle = ids.map(id => this.sessions.get(id)).filter(session => session && !session.busy);
+      if (idle.length === 0) {
+        throw replError(`REPL session limit reached (max ${this.config.maxPerUser} per user)`, 'REPL_LIMIT');
+      }
+      evict = idle.reduce((oldest, session) => (session.lastActivity < oldest.lastActivity ? session : oldest));
+    }
+
+    this.starting.set(userId, starting + 1);
+    let released = false;
+    const release = () => {
+      if (released) {
+        return;
+      }
+      released = true;
+      const left = this.starting.get(userId) - 1;
+      if (left > 0) {
+        this.starting.set(userId, left);
+      } else {
+        this.starting.delete(userId);
+      }
+    };
+
+    if (evict) {
+      // Leaves userSessions before destroySession first awaits
+      logger.info(`Evicting REPL session ${evict.id} of user ${userId}`);
+      await this.destroySession(evict.id, 'evicted');
+    }
+    return release;
+  }
+
+  /**
+   * Type a snippet into the interpreter and collect its output up to the
+   * next primary prompt. A statement left unfinished gets one empty line to
+   * close it; one that still doesn't finish, or runs past the time limit, is
+   * interrupted with Ctrl-C.
+   * @param {Object} options - { timeoutMs, onOutput(text) for streaming }
+   * @returns {Object} { output, truncated, timedOut, incomplete, exited, durationMs }
+   */
+  async evaluate(sessionId, userId, code, { timeoutMs, onOutput = null } = {}) {
+    const session = this.getUserSession(sessionId, userId);
+    if (!session) {
+      return null;
+    }
+    if (session.busy) {
+      throw replError('The session is still evaluating a previous snippet', 'REPL_BUSY');
+    }
+
+    session.busy = true;
+    session.evaluations++;
+    this.touch(session);
+
+    const startedAt = Date.now();
+    const deadline = startedAt + Math.min(timeoutMs || this.config.evalTimeoutMs, this.config.evalTimeoutMs);
+    const result = { output: '', truncated: false, timedOut: false, incomplete: false, exited: false };
+
+    const append = (text) => {
+      const room = this.config.maxOutputBytes - Buffer.byteLength(result.output);
+      if (Buffer.byteLength(text) > room) {
+        text = Buffer.from(text).subarray(0, Math.max(room, 0)).toString('utf8').replace(/\uFFFD+$/, '');
+        result.truncated = true;
+      }
+      result.output += text;
+      if (onOutput && text) {
+        onOutput(text);
+      }
+    };
+
+    try {
+      const lines = prepareLines(code, session.repl);
+      let done = 'prompt';
+
+      for (const line of [...lines, null]) {
+        if (line === null && done === 'prompt') {
+          break;
+        }
+
+        // After the last line: an empty one closes a pending block
+        const input = line === null ? '' : line;
+        const reply = await this.sendLine(session, input, deadline - Date.now(), append);
+        if (reply.reason === 'closed') {
+          result.exited = true;
+          return this.finish(session, result, startedAt);
+        }
+        if (reply.reason === 'timeout') {
+          result.timedOut = true;
+          await this.interrupt(session);
+          return this.finish(session, result, startedAt);
+        }
+
+        done = reply.done;
+        if (line === null && done === 'continuation') {
+          result.incomplete = true;
+          await this.interrupt(session);
+          break;
+        }
+      }
+    } finally {
+      session.busy = false;
+      if (!session.closed) {
+        this.touch(session);
+      }
+    }
+
+    return this.finish(session, result, startedAt);
+  }
+
+  finish(session, result, startedAt) {
+    result.exited = result.exited || session.closed;
+    result.durationMs = Date.now() - startedAt;
+    return result;
+  }
+
+  createTranscript({ prompt, continuationPrompt }, echo = null) {
+    return new ReplTranscript({ prompt, continuationPrompt, echo });
+  }
+
+  sendLine(session, line, timeoutMs, onText) {
+    const transcript = this.createTranscript(session.repl, line);
+    const reply = this.waitForPrompt(session, transcript, Math.max(timeoutMs, 0), onText);
+    session.stream.write(`${line}\r`);
+    return reply;
+  }
+
+  /**
+   * Resolve once the transcript reaches a prompt
+   * @returns {Object} { done: 'prompt'|'continuation'|null, reason: 'timeout'|'closed'|null }
+   */
+  waitForPrompt(session, transcript, timeoutMs, onText = null) {
+    return new Promise((resolve) => {
+      const finish = (done, reason = null) => {
+        clearTimeout(timer);
+        if (session.pending === pending) {
+          session.pending = null;
+        }
+        resolve({ done, reason });
+      };
+
+      const pending = {
+        push: (chunk) => {
+          const { text, done } = transcript.push(chunk);
+          if (text && onText) {
+            onText(text);
+          }
+          if (done) {
+            finish(done);
+          }
+        },
+        abort: () => finish(null, 'closed')
+      };
+      const timer = setTimeout(() => finish(null, 'timeout'), timeoutMs);
+
+      session.pending = pending;
+    });
+  }
+
+  /**
+   * Ctrl-C back to the primary prompt, dropping the session if the
+   * interpreter doesn't come back
+   */
+  async interrupt(session) {
+    if (session.closed) {
+      return false;
+    }
+
+    const back = this.waitForPrompt(session, this.createTranscript(session.repl), INTERRUPT_GRACE_MS);
+    session.stream.write('\x03');
+    const { done } = await back;
+
+    if (done !== 'prompt') {
+      await this.destroySession(session.id, 'unresponsive');
+      return false;
+    }
+    return true;
+  }
+
+  /**
+   * Record activity and restart the idle timer
+   */
+  touch(session) {
+    session.lastActivity = new Date();
+
+    if (session.idleTimer) {
+      clearTimeout(session.idleTimer);
+    }
+
+    session.idleTimer = setTimeout(() => {
+      logger.info(`REPL ${session.id} idle for ${this.config.idleTimeoutMs}ms, closing`);
+      this.destroySession(session.id, 'idle_timeout');
+    }, this.config.idleTimeoutMs);
+
+    if (session.idleTimer.unref) {
+      session.idleTimer.unref();
+    }
+  }
+
+  /**
+   * Stop the interpreter and remove its container
+   */
+  async destroySession(sessionId, reason = 'closed') {
+    const session = this.sessions.get(sessionId);
+    if (!session || session.closed) {
+      return false;
+    }
+
+    session.closed = true;
+    clearTimeout(session.idleTimer);
+    if (session.pending) {
+      session.pending.abort();
+    }
+
+    this.sessions.delete(sessionId);
+    const userSet = this.userSessions.get(session.userId);
+    if (userSet) {
+      userSet.delete(sessionId);
+      if (userSet.size === 0) {
+        this.userSessions.delete(session.userId);
+      }
+    }
+
+    const { stream } = session;
+    stream.removeListener('data', session.handleData);
+    stream.removeListener('end', session.handleEnd);
+    stream.removeListener('close', session.handleEnd);
+    stream.removeListener('error', session.handleError);
+    stream.on('error', () => {}); // late socket errors after teardown
+
+    try {
+      stream.end();
+      stream.destroy();
+    } catch (error) {
+      logger.warn(`Failed to close REPL stream ${sessionId}:`, error.message);
+    }
+
+    try {
+      await dockerService.stopContainer(session.containerId);
+    } catch (error) {
+      logger.error(`Failed to remove REPL container for ${sessionId}:`, error);
+    }
+
+    if (session.onExit) {
+      session.onExit({ sessionId, reason });
+    }
+
+    logger.info('REPL session closed', { sessionId, userId: session.userId, reason });
+    return true;
+  }
+
+  getUserSession(sessionId, userId) {
+    const session = this.sessions.get(sessionId);
+    return session && session.userId === userId && !session.closed ? session : null;
+  }
+
+  getSessionInfo(sessionId) {
+    const session = this.sessions.get(sessionId);
+    if (!session) {
+      return null;
+    }
+
+    return {
+      sessionId: session.id,
+      language: session.language,
+      containerId: session.containerId,
+      evaluations: session.evaluations,
+      busy: session.busy,
+      createdAt: session.createdAt,
+      lastActivity: session.lastActivity,
+      expiresAt: new Date(session.lastActivity.getTime() + this.config.idleTimeoutMs)
+    };
+  }
+
+  getUserSessions(userId) {
+    return Array.from(this.userSessions.get(userId) || []).map(id => this.getSessionInfo(id));
+  }
+}
+
+module.exports = new ReplSessionService();
\ No newline at end of file
@@ -0,0 +1,124 @@
+const fs = require('fs');
+const config = require('../config');
+const logger = require('../utils/logger');
+
+const LIMIT_FIELDS = ['cpuQuota', 'cpuPeriod', 'memoryBytes', 'pidsLimit', 'diskWriteBps'];
+
+class ResourceLimitService {
+  constructor() {
+    this.defaults = { ...config.resourceLimits.defaults };
+    this.defaultPlan = config.resourceLimits.defaultPlan;
+    this.diskDevice = config.resourceLimits.diskDevice;
+    this.plans = this.loadPlans(config.resourceLimits.plansFile);
+  }
+
+  /**
+   * Load per-plan limit overrides from the plans file
+   */
+  loadPlans(plansFile) {
+    try {
+      if (plansFile && fs.existsSync(plansFile)) {
+        const { plans = {} } = JSON.parse(fs.readFileSync(plansFile, 'utf8'));
+        const loaded = {};
+
+        for (const [name, overrides] of Object.entries(plans)) {
+          loaded[name] = this.pickLimits(overrides);
+        }
+
+        return loaded;
+      }
+    } catch (error) {
+      logger.warn('Failed to load resource limit plans:', error.message);
+    }
+
+    return {};
+  }
+
+  /**
+   * Keep only known, positive integer limit fields
+   */
+  pickLimits(values = {}) {
+    const limits = {};
+
+    for (const field of LIMIT_FIELDS) {
+      const value = values[field];
+      if (Number.isInteger(value) && value > 0) {
+        limits[field] = value;
+      }
+    }
+
+    return limits;
+  }
+
+  /**
+   * Swap in new defaults and plan overrides. resolve() hands out copies, so
+   * executions already running keep the limits they started with.
+   */
+  reconfigure({ defaults, plans }) {
+    this.defaults = { ...this.defaults, ...this.pickLimits(defaults) };
+    if (plans) {
+      this.plans = Object.keys(plans).reduce((loaded, name) => {
+        loaded[name] = this.pickLimits(plans[name]);
+        return loaded;
+      }, {});
+    }
+  }
+
+  /**
+   * Resolve the ResourceLimits for a plan: { cpuQuota, cpuPeriod, memoryBytes, pidsLimit, diskWriteBps }
+   */
+  resolve(plan = this.defaultPlan) {
+    const overrides = this.plans[plan] || this.plans[this.defaultPlan] || {};
+    return { ...this.defaults, ...overrides };
+  }
+
+  /**
+   * Resolve limits for an authenticated user based on their plan
+   */
+  resolveForUser(user) {
+    return this.resolve(user && user.plan ? user.plan : this.defaultPlan);
+  }
+
+  /**
+   * Whether limits differ from the defaults warm pool containers are created with
+   */
+  isDefault(limits) {
+    return LIMIT_FIELDS.every(field => limits[field] === this.defaults[field]);
+  }
+
+  /**
+   * Translate ResourceLimits into Docker HostConfig fields
+   */
+  toHostConfig(limits) {
+    const hostConfig = {
+      CpuQuota: limits.cpuQuota,
+      CpuPeriod: limits.cpuPeriod,
+      Memory: limits.memoryBytes,
+      MemorySwap: limits.memoryBytes, // No additional swap
+      PidsLimit: limits.pidsLimit
+    };
+
+    if (limits.diskWriteBps && this.diskDevice) {
+      hostConfig.BlkioDeviceWriteBps = [{ Path: this.diskDevice, Rate: limits.diskWriteBps }];
+    }
+
+    return hostConfig;
+  }
+
+  /**
+   * Get configured defaults and plans
+   */
+  getConfig() {
+    return {
+      defaults: { ...this.defaults },
+      defaultPlan: this.defaultPlan,
+      plans: Object.keys(this.plans).reduce((plans, name) => {
+        plans[name] = this.resolve(name);
+        return plans;
+      }, {})
+    };
+  }
+}
+
+module.exports = new ResourceLimitService();
+module.exports.LIMIT_FIELDS = LIMIT_FIELDS;
\ No newline at end of file
@@ -0,0 +1,218 @@
+const config = require('../config');
+const resourceLabels = require('../utils/resourceLabels');
+const executionMetrics = require('./metrics');
+const logger = require('../utils/logger');
+
+/**
+ * Periodically removes containers and volumes carrying the backend's
+ * studio.owner label that nothing in this process tracks any more: leaks
+ * left by crashes, failed removals or Docker API hiccups. Anything younger
+ * than the grace period is left alone since it may still be starting.
+ *
+ * Several instances may share a Docker host, and this one only knows what it
+ * tracks itself. Resources labelled with another studio.instance are only
+ * reaped once that instance's heartbeat has expired (see
+ * executionSessions.isInstanceAlive). Unlabelled ones predate the label and
+ * are treated as this instance's.
+ *
+ * Exec instances can't be listed or labelled on their own; they go away
+ * with the container they run in.
+ */
+class ResourceReaper {
+  constructor() {
+    this.config = { ...config.resourceReaper };
+    this.docker = null;
+    this.isTracked = () => true;
+    this.instanceId = null;
+    this.isInstanceAlive = async () => true;
+    this.timer = null;
+    this.running = null;
+    this.stats = {
+      runs: 0,
+      reapedContainers: 0,
+      reapedVolumes: 0,
+      errors: 0,
+      lastRun: null
+    };
+  }
+
+  /**
+   * @param {Object} options - { docker: dockerode client, isTracked: containerId => boolean,
+   *   instanceId: this instance's studio.instance label, isInstanceAlive: instanceId => Promise<boolean> }
+   */
+  start({ docker, isTracked, instanceId = null, isInstanceAlive = async () => true }) {
+    this.docker = docker;
+    this.isTracked = isTracked;
+    this.instanceId = instanceId;
+    this.isInstanceAlive = isInstanceAlive;
+
+    if (!this.config.enabled) {
+      return;
+    }
+
+    this.stop();
+    this.scheduleNext();
+    logger.info(`Resource reaper started${this.config.dryRun ? ' in dry-run mode' : ''}`);
+  }
+
+  stop() {
+    if (this.timer) {
+      clearTimeout(this.timer);
+      this.timer = null;
+    }
+  }
+
+  /**
+   * Jittered so several backend processes sharing a Docker host don't sweep in lockstep
+   */
+  getNextDelay() {
+    const { intervalMs, jitter } = this.config;
+    return Math.round(intervalMs * (1 + (Math.random() * 2 - 1) * jitter));
+  }
+
+  scheduleNext() {
+    this.timer = setTimeout(() => {
+      this.reap()
+        .catch(error => logger.error('Resource reaper run failed:', error))
+        .finally(() => {
+          if (this.timer) {
+            this.scheduleNext();
+          }
+        });
+    }, this.getNextDelay());
+
+    if (this.timer.unref) {
+      this.timer.unref();
+    }
+  }
+
+  isExpired(labels, fallbackMs) {
+    return Date.now() - resourceLabels.getCreatedAt(labels, fallbackMs) > this.config.gracePeriodMs;
+  }
+
+  /**
+   * One sweep. Overlapping calls share the run in progress.
+   * @returns {Object} { containers, volumes } - Resources removed (or that would be, in dry-run mode)
+   */
+  async reap() {
+    if (!this.running) {
+      this.running = this.sweep().finally(() => {
+        this.running = null;
+      });
+    }
+    return this.running;
+  }
+
+  /**
+   * Whether the instance that created a resource is gone or is this one,
+   * asking about each other instance once per sweep
+   * @param {Map} alive - instanceId -> Promise<boolean>, shared by one sweep
+   */
+  async isAbandoned(labels, alive) {
+    const instanceId = labels && labels[resourceLabels.INSTANCE];
+    if (!instanceId || instanceId === this.instanceId) {
+      return true;
+    }
+
+    if (!alive.has(instanceId)) {
+      // Unknown counts as alive: better a leak than removing a running sandbox
+      alive.set(instanceId, Promise.resolve(this.isInstanceAlive(instanceId)).catch(error => {
+        logger.warn(`Resource reaper could not check instance ${instanceId}:`, error.message);
+        return true;
+      }));
+    }
+    return !(await alive.get(instanceId));
+  }
+
+  async sweep() {
+    const alive = new Map();
+    const containers = await this.docker.listContainers({
+      all: true,
+      filters: { label: [resourceLabels.OWNER] }
+    });
+
+    const leaked = [];
+    for (const info of containers) {
+      if (!this.isTracked(info.Id) && this.isExpired(info.Labels, info.Created * 1000) && await this.isAbandoned(info.Labels, alive)) {
+        leaked.push(info);
+      }
+    }
+    const removed = [];
+    for (const info of leaked) {
+      if (await this.remove('container', info.Id, info.Labels, () =>
+        this.docker.getContainer(info.Id).remove({ force: true, v: true })
+      )) {
+        removed.push(info.Id);
+      }
+    }
+
+    // Volumes of the containers listed above are either in use or went with
+    // their container (removed with v: true), so only unattached ones count
+    const attached = new Set(containers.flatMap(info =>
+      (info.Mounts || []).map(mount => mount.Name).filter(Boolean)
+    ));
+
+    const { Volumes: volumes } = await this.docker.listVolumes({
+      filters: { label: [resourceLabels.OWNER] }
+    });
+
+    let reapedVolumes = 0;
+    for (const volume of volumes || []) {
+      if (attached.has(volume.Name) || !this.isExpired(volume.Labels, Date.parse(volume.CreatedAt) || Date.now())
+        || !(await this.isAbandoned(volume.Labels, alive))) {
+        continue;
+      }
+      if (await this.remove('volume', volume.Name, volume.Labels, () => this.docker.getVolume(volume.Name).remove())) {
+        reapedVolumes++;
+      }
+    }
+
+    this.stats.runs++;
+    this.stats.lastRun = new Date();
+    if (removed.length > 0 || reapedVolumes > 0) {
+      logger.info(`Resource reaper ${this.config.dryRun ? 'found' : 'removed'} ${removed.length} leaked containers and ${reapedVolumes} leaked volumes`);
+    }
+
+    return { containers: removed.length, volumes: reapedVolumes };
+  }
+
+  /**
+   * @returns {boolean} Whether the resource is gone (or would be, in dry-run mode)
+   */
+  async remove(resource, id, labels, removeFn) {
+    labels = labels || {}; // Docker reports unlabelled volumes with null
+    const context = {
+      owner: labels[resourceLabels.OWNER],
+      instance: labels[resourceLabels.INSTANCE],
+      executionId: labels[resourceLabels.EXECUTION_ID],
+      createdAt: labels[resourceLabels.CREATED_AT]
+    };
+
+    if (this.config.dryRun) {
+      logger.info(`Resource reaper would remove leaked ${resource} ${id}`, context);
+      executionMetrics.observeReaped(resource, true);
+      return true;
+    }
+
+    try {
+      await removeFn();
+    } catch (error) {
+      if (error.statusCode !== 404) { // 404 = removed in the meantime
+        this.stats.errors++;
+        logger.warn(`Resource reaper failed to remove ${resource} ${id}:`, error.message);
+        return false;
+      }
+    }
+
+    this.stats[resource === 'container' ? 'reapedContainers' : 'reapedVolumes']++;
+    executionMetrics.observeReaped(resource, false);
+    logger.warn(`Resource reaper removed leaked ${resource} ${id}`, context);
+    return true;
+  }
+
+  getStats() {
+    return { enabled: this.config.enabled, dryRun: this.config.dryRun, ...this.stats };
+  }
+}
+
+module.exports = new ResourceReaper();
\ No newline at end of file
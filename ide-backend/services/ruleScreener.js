@@ -0,0 +1,69 @@
+const crypto = require('crypto');
+const logger = require('../utils/logger');
+const Screener = require('./screener');
+
+const { parseAction, compilePattern } = Screener;
+
+/**
+ * Signature rules from the `rules` list of the rules file. Each has an id,
+ * an action and one of:
+ *   pattern - regular expression (with `flags`) matched against every file
+ *   contains - literal string, case sensitive
+ *   sha256 - hex digest of a known file, matched against whole files
+ */
+class RuleScreener extends Screener {
+  constructor() {
+    super('rules');
+    this.rules = [];
+  }
+
+  load({ rules = [] } = {}) {
+    const loaded = [];
+    for (const definition of Array.isArray(rules) ? rules : []) {
+      try {
+        loaded.push(this.compile(definition));
+      } catch (error) {
+        logger.warn(`Skipping invalid screening rule ${definition && definition.id}: ${error.message}`);
+      }
+    }
+    this.rules = loaded;
+  }
+
+  compile(definition = {}) {
+    if (typeof definition.id !== 'string' || definition.id.length === 0) {
+      throw new Error('id is required');
+    }
+    const action = parseAction(definition.action);
+    if (!action) {
+      throw new Error('action must be flag or block');
+    }
+
+    let matches;
+    if (definition.pattern !== undefined) {
+      const pattern = compilePattern(definition.pattern, definition.flags);
+      matches = (content) => pattern.test(content);
+    } else if (typeof definition.contains === 'string' && definition.contains.length > 0) {
+      matches = (content) => content.includes(definition.contains);
+    } else if (typeof definition.sha256 === 'string' && /^[0-9a-f]{64}$/i.test(definition.sha256)) {
+      const digest = definition.sha256.toLowerCase();
+      matches = (content) => crypto.createHash('sha256').update(content).digest('hex') === digest;
+    } else {
+      throw new Error('one of pattern, contains or sha256 is required');
+    }
+
+    return { id: definition.id, action, matches };
+  }
+
+  check(sources) {
+    const found = [];
+    for (const rule of this.rules) {
+      const source = sources.find(({ content }) => rule.matches(content));
+      if (source) {
+        found.push({ rule: rule.id, action: rule.action, path: source.path });
+      }
+    }
+    return found;
+  }
+}
+
+module.exports = RuleScreener;
\ No newline at end of file
@@ -0,0 +1,557 @@
+const fs = require('fs');
+const path = require('path');
+const config = require('../config');
+const logger = require('../utils/logger');
+
+const NAME_PATTERN = /^[a-z][a-z0-9_-]{0,31}$/;
+
+// Output formats utils/testResults knows how to parse
+const TEST_FORMATS = ['go-test-json', 'pytest-json', 'jest-json'];
+
+// Formatter stderr styles utils/diagnostics turns into syntax errors
+const FORMAT_ERRORS = ['gofmt', 'black', 'prettier'];
+
+// Sandbox providers a runtime can choose (see services/sandboxes)
+const SANDBOX_PROVIDERS = ['docker', 'gvisor'];
+
+class RuntimeRegistry {
+  constructor() {
+    this.runtimes = new Map();
+    this.load();
+  }
+
+  /**
+   * Load the bundled runtimes plus any operator-provided runtime file
+   */
+  load() {
+    this.runtimes.clear();
+    this.loadFile(config.runtimes.file);
+
+    if (config.runtimes.extraFile) {
+      this.loadFile(config.runtimes.extraFile);
+    }
+
+    this.applyPinnedImages();
+
+    logger.info(`Runtime registry loaded: ${this.names().join(', ')}`);
+  }
+
+  loadFile(filePath) {
+    try {
+      if (!fs.existsSync(filePath)) {
+        logger.warn(`Runtime file not found: ${filePath}`);
+        return;
+      }
+
+      const { runtimes = {} } = JSON.parse(fs.readFileSync(filePath, 'utf8'));
+
+      for (const [name, definition] of Object.entries(runtimes)) {
+        try {
+          this.register(name, definition);
+        } catch (error) {
+          logger.warn(`Skipping invalid runtime ${name} in ${filePath}: ${error.message}`);
+        }
+      }
+    } catch (error) {
+      logger.error(`Failed to load runtime file ${filePath}:`, error);
+    }
+  }
+
+  /**
+   * Images built by services/imageBuilder replace the ones in the runtime files
+   */
+  applyPinnedImages() {
+    const pinned = this.readPinnedImages();
+    for (const [name, entry] of Object.entries(pinned)) {
+      const runtime = this.runtimes.get(name);
+      if (runtime && entry && typeof entry.image === 'string') {
+        this.runtimes.set(name, { ...runtime, image: entry.image });
+      }
+    }
+  }
+
+  readPinnedImages() {
+    try {
+      if (!fs.existsSync(config.imageBuilds.imagesFile)) {
+        return {};
+      }
+      return JSON.parse(fs.readFileSync(config.imageBuilds.imagesFile, 'utf8')).runtimes || {};
+    } catch (error) {
+      logger.error(`Failed to read pinned runtime images from ${config.imageBuilds.imagesFile}:`, error);
+      return {};
+    }
+  }
+
+  /**
+   * Switch a runtime to a new image and persist the choice across restarts.
+   * The file is replaced by rename, so it never holds a half-written entry.
+   * @param {Object} metadata - Recorded next to the image (digest, imageId, builtAt, ...)
+   * @returns {string} The image the runtime used before
+   */
+  pinImage(name, image, metadata = {}) {
+    const runtime = this.runtimes.get(name);
+    if (!runtime) {
+      throw new Error(`Unknown runtime: ${name}`);
+    }
+
+    const pinned = { ...this.readPinnedImages(), [name]: { image, ...metadata } };
+    const file = config.imageBuilds.imagesFile;
+    const temporary = `${file}.${process.pid}.tmp`;
+    fs.mkdirSync(path.dirname(file), { recursive: true });
+    fs.writeFileSync(temporary, JSON.stringify({ runtimes: pinned }, null, 2));
+    fs.renameSync(temporary, file);
+
+    this.runtimes.set(name, { ...runtime, image });
+    logger.info(`Runtime ${name} switched from ${runtime.image} to ${image}`);
+    return runtime.image;
+  }
+
+  /**
+   * Change a runtime's default timeouts. The entry is replaced rather than
+   * edited, so executions that already resolved their limits keep them.
+   */
+  setTimeouts(name, { compileTimeoutMs, runTimeoutMs }) {
+    const runtime = this.runtimes.get(name);
+    if (!runtime) {
+      throw new Error(`Unknown runtime: ${name}`);
+    }
+
+    this.runtimes.set(name, {
+      ...runtime,
+      compileTimeoutMs: compileTimeoutMs || runtime.compileTimeoutMs,
+      runTimeoutMs: runTimeoutMs || runtime.runTimeoutMs,
+      timeoutMs: runTimeoutMs || runtime.runTimeoutMs
+    });
+  }
+
+  /**
+   * Register (or replace) a runtime definition
+   */
+  register(name, definition) {
+    const runtime = this.normalize(name, definition);
+    this.runtimes.set(name, runtime);
+    return runtime;
+  }
+
+  /**
+   * Validate a definition and fill in defaults
+   */
+  normalize(name, definition = {}) {
+    if (!NAME_PATTERN.test(name)) {
+      throw new Error('Runtime name must be lowercase alphanumeric');
+    }
+
+    if (typeof definition.image !== 'string' || definition.image.length === 0) {
+      throw new Error('image is required');
+    }
+
+    if (typeof definition.extension !== 'string' || !/^[A-Za-z0-9]+$/.test(definition.extension)) {
+      throw new Error('extension is required');
+    }
+
+    const isCommand = (value) => Array.isArray(value) && value.length > 0 && value.every(part => typeof part === 'string');
+
+    if (!isCommand(definition.run)) {
+      throw new Error('run must be a non-empty array of strings');
+    }
+
+    for (const field of ['compile', 'projectCompile', 'projectRun']) {
+      if (definition[field] !== null && definition[field] !== undefined && !isCommand(definition[field])) {
+        throw new Error(`${field} must be null or a non-empty array of strings`);
+      }
+    }
+
+    if (definition.sandbox !== undefined && definition.sandbox !== null && !SANDBOX_PROVIDERS.includes(definition.sandbox)) {
+      throw new Error(`sandbox must be one of ${SANDBOX_PROVIDERS.join(', ')}`);
+    }
+
+    const egressAllowlist = definition.egressAllowlist || [];
+    if (!Array.isArray(egressAllowlist) || !egressAllowlist.every(host => typeof host === 'string' && host.length > 0)) {
+      throw new Error('egressAllowlist must be an array of hostnames');
+    }
+
+    const caches = this.normalizeCaches(definition.caches);
+    const env = this.normalizeEnv(definition.env);
+    const test = this.normalizeTest(definition.test, isCommand);
+    const lsp = this.normalizeLsp(name, definition.lsp, isCommand);
+    const smoke = this.normalizeSmoke(definition.smoke);
+    const repl = this.normalizeRepl(definition.repl, isCommand);
+    const format = this.normalizeFormat(definition.format, definition.extension, isCommand);
+
+    // Separate limits for the build step and the program itself; `timeoutMs` is the old single limit
+    const isTimeout = (value) => Number.isInteger(value) && value > 0;
+    const runTimeoutMs = [definition.runTimeoutMs, definition.timeoutMs].find(isTimeout) || 30000;
+
+    const needsBuild = definition.needsBuild !== undefined ? definition.needsBuild === true : Boolean(definition.compile);
+    if (needsBuild && !definition.compile) {
+      throw new Error('runtimes that need a build step must define compile');
+    }
+    const buildCache = this.normalizeBuildCache(definition.buildCache, needsBuild);
+
+    return {
+      name,
+      displayName: definition.displayName || name,
+      image: definition.image,
+      version: definition.version || this.versionFromImage(definition.image),
+      extension: definition.extension,
+      compile: definition.compile || null,
+      run: definition.run,
+      projectCompile: definition.projectCompile || null, // multi-file variants, fall back to compile/run
+      projectRun: definition.projectRun || null,
+      compileTimeoutMs: isTimeout(definition.compileTimeoutMs) ? definition.compileTimeoutMs : 60000,
+      runTimeoutMs,
+      timeoutMs: runTimeoutMs, // legacy name for the run limit
+      needsBuild,
+      allowNetwork: definition.allowNetwork === true, // operator opt-in, egress limited to egressAllowlist
+      screening: definition.screening !== false, // false skips services/screening, for trusted internal runtimes
+      sandbox: definition.sandbox || null, // provider, config.sandbox.defaultProvider when null
+      egressAllowlist: egressAllowlist.map(host => host.toLowerCase()),
+      caches,
+      env,
+      test,
+      lsp,
+      smoke,
+      buildCache,
+      repl,
+      format
+    };
+  }
+
+  /**
+   * Container environment for the runtime's tools, e.g. pointing Go's caches
+   * at /tmp because the root filesystem is read-only. `{out}` expands to the
+   * build output directory.
+   */
+  normalizeEnv(env = {}) {
+    if (!env || typeof env !== 'object' || Array.isArray(env)) {
+      throw new Error('env must be an object of strings');
+    }
+
+    return Object.entries(env).map(([key, value]) => {
+      if (!/^[A-Za-z_][A-Za-z0-9_]*$/.test(key) || typeof value !== 'string') {
+        throw new Error(`env ${key}: must map a variable name to a string`);
+      }
+      return `${key}=${value.replace(/\{out\}/g, config.sandboxFilesystem.buildDir)}`;
+    });
+  }
+
+  /**
+   * Native test runner: `command` runs from /workspace and must write its
+   * machine-readable report (in `format`) to stdout
+   */
+  normalizeTest(test, isCommand) {
+    if (test === null || test === undefined) {
+      return null;
+    }
+    if (!isCommand(test.command)) {
+      throw new Error('test.command must be a non-empty array of strings');
+    }
+    if (!TEST_FORMATS.includes(test.format)) {
+      throw new Error(`test.format must be one of ${TEST_FORMATS.join(', ')}`);
+    }
+
+    return { command: test.command, format: test.format };
+  }
+
+  /**
+   * Smoke test for freshly built images: `code` saved as `filename` (default
+   * main) must build, run and print exactly `expectedOutput`
+   */
+  normalizeSmoke(smoke) {
+    if (smoke === null || smoke === undefined) {
+      return null;
+    }
+    if (typeof smoke.code !== 'string' || typeof smoke.expectedOutput !== 'string') {
+      throw new Error('smoke must have code and expectedOutput strings');
+    }
+    const filename = smoke.filename || 'main';
+    if (!/^[A-Za-z_][A-Za-z0-9_]*$/.test(filename)) {
+      throw new Error('smoke.filename must be a bare file name without extension');
+    }
+
+    return { code: smoke.code, expectedOutput: smoke.expectedOutput, filename };
+  }
+
+  /**
+   * Build artifact caching for single-file builds: `artifact` is the file the
+   * compile phase produces (usually under {out}) and all the run phase needs
+   */
+  normalizeBuildCache(buildCache, needsBuild) {
+    if (buildCache === null || buildCache === undefined) {
+      return null;
+    }
+    if (!needsBuild) {
+      throw new Error('buildCache needs a runtime with a build step');
+    }
+    if (typeof buildCache.artifact !== 'string' || !buildCache.artifact.startsWith('{out}/')) {
+      throw new Error('buildCache.artifact must be a path under {out}');
+    }
+
+    return { artifact: buildCache.artifact.replace(/\{out\}/g, config.sandboxFilesystem.buildDir) };
+  }
+
+  /**
+   * Interactive interpreter for REPL sessions. `prompt` is printed when it
+   * waits for a new statement, `continuationPrompt` inside an unfinished one.
+   * `blankLineEndsBlock` runtimes (Python) close an indented block only on an
+   * empty line, so snippets get one wherever the indentation drops back.
+   */
+  normalizeRepl(repl, isCommand) {
+    if (repl === null || repl === undefined) {
+      return null;
+    }
+    if (!isCommand(repl.command)) {
+      throw new Error('repl.command must be a non-empty array of strings');
+    }
+    for (const field of ['prompt', 'continuationPrompt']) {
+      if (typeof repl[field] !== 'string' || repl[field].trim().length === 0 || repl[field].includes('\n')) {
+        throw new Error(`repl.${field} must be a single-line string`);
+      }
+    }
+    if (repl.prompt === repl.continuationPrompt) {
+      throw new Error('repl.prompt and repl.continuationPrompt must differ');
+    }
+
+    return {
+      command: repl.command,
+      prompt: repl.prompt,
+      continuationPrompt: repl.continuationPrompt,
+      blankLineEndsBlock: repl.blankLineEndsBlock === true,
+      env: this.normalizeEnv(repl.env)
+    };
+  }
+
+  /**
+   * Code formatter: `command` reads the source on stdin and prints it
+   * formatted, or exits non-zero with `errors`-style messages on stderr when
+   * it can't parse it. `{file}` is the name the source is formatted as, with
+   * one of `extensions` (default the runtime's; prettier picks its parser
+   * from it).
+   */
+  normalizeFormat(format, extension, isCommand) {
+    if (format === null || format === undefined) {
+      return null;
+    }
+    if (!isCommand(format.command)) {
+      throw new Error('format.command must be a non-empty array of strings');
+    }
+    if (!FORMAT_ERRORS.includes(format.errors)) {
+      throw new Error(`format.errors must be one of ${FORMAT_ERRORS.join(', ')}`);
+    }
+
+    const extensions = format.extensions || [extension];
+    if (!Array.isArray(extensions) || extensions.length === 0 || !extensions.every(ext => typeof ext === 'string' && /^[A-Za-z0-9]+$/.test(ext))) {
+      throw new Error('format.extensions must be a non-empty array of file extensions');
+    }
+
+    return { command: format.command, errors: format.errors, extensions };
+  }
+
+  /**
+   * Language server: `command` speaks LSP over stdio from /workspace and
+   * serves the editor's `languages` (LSP language ids, default the runtime name)
+   */
+  normalizeLsp(name, lsp, isCommand) {
+    if (lsp === null || lsp === undefined) {
+      return null;
+    }
+    if (!isCommand(lsp.command)) {
+      throw new Error('lsp.command must be a non-empty array of strings');
+    }
+
+    const languages = lsp.languages || [name];
+    if (!Array.isArray(languages) || languages.length === 0 || !languages.every(id => typeof id === 'string' && /^[a-z][a-z0-9+-]*$/.test(id))) {
+      throw new Error('lsp.languages must be a non-empty array of language ids');
+    }
+
+    return { command: lsp.command, languages };
+  }
+
+  /**
+   * Dependency caches: `ro` entries mount a shared per-runtime cache volume
+   * read-only, `tmpfs` entries give each container a private size-capped
+   * writable directory. `env` is pointed at `mountPath` inside the container.
+   */
+  normalizeCaches(caches = []) {
+    if (!Array.isArray(caches)) {
+      throw new Error('caches must be an array');
+    }
+
+    return caches.map(cache => {
+      if (!cache || !NAME_PATTERN.test(cache.name)) {
+        throw new Error('cache name must be lowercase alphanumeric');
+      }
+      if (typeof cache.env !== 'string' || !/^[A-Za-z_][A-Za-z0-9_]*$/.test(cache.env)) {
+        throw new Error(`cache ${cache.name}: env must be an environment variable name`);
+      }
+      if (typeof cache.mountPath !== 'string' || !/^\/[\w./-]+$/.test(cache.mountPath) || cache.mountPath.includes('..')) {
+        throw new Error(`cache ${cache.name}: mountPath must be an absolute path`);
+      }
+      if (!['ro', 'tmpfs'].includes(cache.mode)) {
+        throw new Error(`cache ${cache.name}: mode must be ro or tmpfs`);
+      }
+
+      return {
+        name: cache.name,
+        env: cache.env,
+        mountPath: cache.mountPath,
+        mode: cache.mode,
+        size: cache.mode === 'tmpfs' ? (/^\d+[kmg]?$/.test(cache.size || '') ? cache.size : '256m') : null
+      };
+    });
+  }
+
+  versionFromImage(image) {
+    const tag = image.split(':')[1] || 'latest';
+    return tag.split('-')[0];
+  }
+
+  get(name) {
+    return this.runtimes.get(name) || null;
+  }
+
+  has(name) {
+    return this.runtimes.has(name);
+  }
+
+  names() {
+    return Array.from(this.runtimes.keys());
+  }
+
+  /**
+   * Public listing for the frontend language picker
+   */
+  list() {
+    return Array.from(this.runtimes.values()).map(runtime => ({
+      name: runtime.name,
+      displayName: runtime.displayName,
+      version: runtime.version,
+      image: runtime.image,
+      extension: runtime.extension,
+      needsBuild: runtime.needsBuild,
+      timeoutMs: runtime.timeoutMs,
+      compileTimeoutMs: runtime.compileTimeoutMs,
+      runTimeoutMs: runtime.runTimeoutMs,
+      testRunner: runtime.test ? runtime.test.format : null,
+      languageServer: runtime.lsp ? { command: runtime.lsp.command[0], languages: runtime.lsp.languages } : null,
+      repl: Boolean(runtime.repl),
+      formatter: runtime.format ? { command: runtime.format.command[0], extensions: runtime.format.extensions } : null,
+      allowNetwork: runtime.allowNetwork
+    }));
+  }
+
+  /**
+   * Expand placeholders in a command template:
+   * {file} entry file, {name} entry file without extension, {dir} entry directory
+   * as a relative package path, {class} dotted class name, {sources} every source file,
+   * {out} the build output directory (a tmpfs, since /workspace may be the user's files)
+   */
+  renderCommand(template, filename, sources = [filename]) {
+    const name = filename.replace(/\.[^./]+$/, '');
+    const dir = filename.includes('/') ? `./${filename.slice(0, filename.lastIndexOf('/'))}` : '.';
+    const className = name.replace(/\//g, '.');
+
+    return template.flatMap(part => {
+      if (part === '{sources}') {
+        return sources;
+      }
+
+      return [part
+        .replace(/\{file\}/g, filename)
+        .replace(/\{name\}/g, name)
+        .replace(/\{dir\}/g, dir)
+        .replace(/\{class\}/g, className)
+        .replace(/\{out\}/g, config.sandboxFilesystem.buildDir)];
+    });
+  }
+
+  /**
+   * Build the exec argv for a runtime. Runtimes with a build step are run
+   * through `sh -c "<compile> && <run>"`; others are exec'd directly.
+   */
+  getExecutionCommand(name, filename) {
+    const runtime = this.get(name);
+    if (!runtime) {
+      return ['cat', filename];
+    }
+
+    return this.joinPhases(this.getPhases(name, filename));
+  }
+
+  /**
+   * Build the exec argv for a multi-file project with the given entrypoint
+   */
+  getProjectCommand(name, entrypoint, files = []) {
+    const runtime = this.get(name);
+    if (!runtime) {
+      return ['cat', entrypoint];
+    }
+
+    return this.joinPhases(this.getProjectPhases(name, entrypoint, files));
+  }
+
+  /**
+   * Compile and run argv as separate phases, so each can get its own exec
+   * and time limit. `compile` is null for runtimes without a build step.
+   */
+  getPhases(name, filename) {
+    const runtime = this.get(name);
+    if (!runtime) {
+      return { compile: null, run: ['cat', filename] };
+    }
+
+    return {
+      compile: runtime.needsBuild ? this.renderCommand(runtime.compile, filename) : null,
+      run: this.renderCommand(runtime.run, filename)
+    };
+  }
+
+  getProjectPhases(name, entrypoint, files = []) {
+    const runtime = this.get(name);
+    if (!runtime) {
+      return { compile: null, run: ['cat', entrypoint] };
+    }
+
+    const sources = files.filter(file => file.endsWith(`.${runtime.extension}`));
+    return {
+      compile: runtime.needsBuild ? this.renderCommand(runtime.projectCompile || runtime.compile, entrypoint, sources) : null,
+      run: this.renderCommand(runtime.projectRun || runtime.run, entrypoint, sources)
+    };
+  }
+
+  joinPhases({ compile, run }) {
+    return compile ? ['sh', '-c', `${this.toShell(compile)} && ${this.toShell(run)}`] : run;
+  }
+
+  /**
+   * Effective limits for one execution: callers may lower the runtime's
+   * defaults but never raise them
+   * @param {string} name - Runtime name
+   * @param {Object} requested - { compileTimeoutMs, runTimeoutMs }
+   * @param {Object} tier - Optional longer limits for a class of execution
+   *   (config.asyncJobs); they raise the runtime's defaults, never lower them
+   */
+  resolveTimeouts(name, { compileTimeoutMs, runTimeoutMs } = {}, tier = null) {
+    const runtime = this.get(name);
+    const defaults = runtime
+      ? { compileTimeoutMs: runtime.compileTimeoutMs, runTimeoutMs: runtime.runTimeoutMs }
+      : { compileTimeoutMs: 60000, runTimeoutMs: 30000 };
+    if (tier) {
+      defaults.compileTimeoutMs = Math.max(defaults.compileTimeoutMs, tier.compileTimeoutMs || 0);
+      defaults.runTimeoutMs = Math.max(defaults.runTimeoutMs, tier.runTimeoutMs || 0);
+    }
+
+    const lower = (value, limit) => (Number.isInteger(value) && value > 0 ? Math.min(value, limit) : limit);
+
+    return {
+      compileTimeoutMs: lower(compileTimeoutMs, defaults.compileTimeoutMs),
+      runTimeoutMs: lower(runTimeoutMs, defaults.runTimeoutMs)
+    };
+  }
+
+  toShell(argv) {
+    return argv.map(arg => (/^[\w@%+=:,./-]+$/.test(arg) ? arg : `'${arg.replace(/'/g, `'\\''`)}'`)).join(' ');
+  }
+}
+
+module.exports = new RuntimeRegistry();
\ No newline at end of file
@@ -0,0 +1,132 @@
+/**
+ * Interface of a sandbox provider: creates isolated containers for a runtime
+ * and runs code in them. The execution service only talks to providers
+ * through these methods (see services/sandboxes for the registry), so the
+ * isolation technology can change per runtime and tests can swap in
+ * FakeSandbox. Subclasses implement every method that throws here.
+ */
+class Sandbox {
+  constructor(name) {
+    this.name = name;
+    this.supported = true; // set by detect() during initialization
+  }
+
+  notImplemented(method) {
+    return new Error(`${this.name} sandbox does not implement ${method}`);
+  }
+
+  /**
+   * Probe whether the provider can run on this host. Unsupported providers
+   * are skipped in favour of the default one.
+   * @param {Object} docker - dockerode client
+   * @returns {boolean}
+   */
+  async detect() {
+    return true;
+  }
+
+  /**
+   * Whether code can run at all right now (e.g. the Docker daemon is up)
+   */
+  isAvailable() {
+    throw this.notImplemented('isAvailable');
+  }
+
+  /**
+   * Whether the provider tracks `containerId`
+   */
+  owns() {
+    return false;
+  }
+
+  /**
+   * Reported per runtime in GET /api/runtimes
+   */
+  getCapabilities() {
+    return { provider: this.name, supported: this.supported };
+  }
+
+  /**
+   * Create and start a container for `language`
+   * @returns {Object} { containerId, name, language, status, ... }
+   */
+  async create() {
+    throw this.notImplemented('create');
+  }
+
+  /**
+   * Container info (see dockerService.getContainerInfo), null if unknown
+   */
+  async inspect() {
+    throw this.notImplemented('inspect');
+  }
+
+  /**
+   * Write files into the container's /workspace
+   * @param {string} containerId
+   * @param {Object} files - Map of relative path -> content
+   */
+  async copyFiles() {
+    throw this.notImplemented('copyFiles');
+  }
+
+  /**
+   * Copy the regular files under /workspace whose relative path `matches`
+   * accepts out of the container, stopping at maxFiles or maxBytes
+   * @param {Function} matches - Predicate over workspace-relative paths
+   * @param {Object} limits - { maxFiles, maxBytes }
+   * @returns {Object} { files: [{ path, content }], truncated }
+   */
+  async readFiles() {
+    throw this.notImplemented('readFiles');
+  }
+
+  /**
+   * Run code in a container (see dockerService.executeCode for options)
+   * @returns {Object} Execution: { containerId, language, stream, exec, stdinOpen, timedOut, compile, ... }
+   */
+  async exec() {
+    throw this.notImplemented('exec');
+  }
+
+  /**
+   * Route the execution's output to separate stdout/stderr writers
+   */
+  streams() {
+    throw this.notImplemented('streams');
+  }
+
+  /**
+   * Exit code and kill reason ('oom', 'disk_limit', ...) once the stream ended
+   * @returns {Object} { exitCode, killedReason }
+   */
+  async exitStatus() {
+    throw this.notImplemented('exitStatus');
+  }
+
+  /**
+   * Whether stderr shows a write failing on a full scratch filesystem
+   */
+  isDiskLimitError() {
+    throw this.notImplemented('isDiskLimitError');
+  }
+
+  /**
+   * Stop an execution: SIGTERM, `graceMs` to exit, then SIGKILL with its
+   * container. Given a container ID instead, kill the container right away.
+   * @param {Object|string} target - Execution or container ID
+   */
+  async kill() {
+    throw this.notImplemented('kill');
+  }
+
+  /**
+   * Stop and remove a container (pooled containers go back to the pool
+   * unless `force` is set)
+   */
+  async remove() {
+    throw this.notImplemented('remove');
+  }
+}
+
+module.exports = Sandbox;
\ No newline at end of file
@@ -0,0 +1,306 @@
+const crypto = require('crypto');
+const config = require('../config');
+const logger = require('../utils/logger');
+const dockerService = require('./dockerService');
+
+const MAX_COLS = 500;
+const MAX_ROWS = 200;
+
+/**
+ * Interactive PTY sessions inside sandbox containers. Each session is a
+ * `docker exec` with Tty: true whose hijacked stream is bridged to a client.
+ */
+class SandboxTerminalService {
+  constructor() {
+    this.sessions = new Map(); // sessionId -> session
+    this.userSessions = new Map(); // userId -> Set of sessionIds
+    this.starting = new Map(); // userId -> sessions being created, not yet in userSessions
+    this.maxPerUser = config.sandboxTerminal.maxPerUser;
+    this.idleTimeoutMs = config.sandboxTerminal.idleTimeoutMs;
+  }
+
+  /**
+   * Open a terminal. Execs into `options.containerId` if given (it must belong
+   * to the user), otherwise creates a dedicated container for the session.
+   * @param {string} userId - User ID
+   * @param {Object} options - { containerId, language, workspaceId, cols, rows }
+   * @param {Object} handlers - { onData(Buffer, sessionId), onExit({ sessionId, reason }) }
+   * @returns {Object} Session info
+   */
+  async createSession(userId, options = {}, { onData, onExit } = {}) {
+    const release = this.reserve(userId);
+
+    const { cols, rows } = this.clampSize(options.cols, options.rows);
+    let containerId = options.containerId;
+    let ownsContainer = false;
+
+    let exec;
+    let stream;
+    try {
+      if (containerId) {
+        const containerInfo = await dockerService.getContainerInfo(containerId);
+        if (!containerInfo || containerInfo.userId !== userId) {
+          throw new Error('Container not found or access denied');
+        }
+      } else {
+        const container = await dockerService.createContainer(
+          options.language || config.sandboxTerminal.defaultLanguage,
+          options.workspaceId || `terminal-${userId}`,
+          userId
+        );
+        containerId = container.containerId;
+        ownsContainer = true;
+      }
+
+      ({ exec, stream } = await dockerService.createTtyExec(containerId, { cols, rows }));
+    } catch (error) {
+      release();
+      if (ownsContainer) {
+        await dockerService.stopContainer(containerId).catch(() => {});
+      }
+      throw error;
+    }
+
+    const session = {
+      id: 'pty_' + crypto.randomBytes(12).toString('hex'),
+      userId,
+      containerId,
+      ownsContainer,
+      exec,
+      stream,
+      cols,
+      rows,
+      createdAt: new Date(),
+      lastActivity: new Date(),
+      idleTimer: null,
+      closed: false,
+      onExit
+    };
+
+    session.handleData = (chunk) => {
+      this.touch(session);
+      if (onData) {
+        onData(chunk, session.id);
+      }
+    };
+    session.handleEnd = () => this.destroySession(session.id, 'exited');
+    session.handleError = (error) => {
+      logger.warn(`Terminal ${session.id} stream error:`, error.message);
+      this.destroySession(session.id, 'error');
+    };
+
+    stream.on('data', session.handleData);
+    stream.on('end', session.handleEnd);
+    stream.on('close', session.handleEnd);
+    stream.on('error', session.handleError);
+
+    this.sessions.set(session.id, session);
+    if (!this.userSessions.has(userId)) {
+      this.userSessions.set(userId, new Set());
+    }
+    this.userSessions.get(userId).add(session.id);
+    release(); // counted in userSessions from here on
+    this.touch(session);
+
+    logger.info('Sandbox terminal created', { sessionId: session.id, userId, containerId, ownsContainer });
+
+    return this.getSessionInfo(session.id);
+  }
+
+  /**
+   * Take one of the user's terminal slots before anything is awaited, so
+   * concurrent creates can't all pass the limit. Terminals still starting
+   * hold their slot too.
+   * @returns {Function} Gives the slot back once the session is registered or failed to start
+   */
+  reserve(userId) {
+    const active = this.userSessions.get(userId);
+    const starting = this.starting.get(userId) || 0;
+    if ((active ? active.size : 0) + starting >= this.maxPerUser) {
+      const error = new Error(`Terminal limit reached (max ${this.maxPerUser} per user)`);
+      error.code = 'TERMINAL_LIMIT';
+      throw error;
+    }
+
+    this.starting.set(userId, starting + 1);
+    let released = false;
+    return () => {
+      if (released) {
+        return;
+      }
+      released = true;
+      const left = this.starting.get(userId) - 1;
+      if (left > 0) {
+        this.starting.set(userId, left);
+      } else {
+        this.starting.delete(userId);
+      }
+    };
+  }
+
+  /**
+   * Forward client keystrokes (binary frame) to the PTY
+   */
+  write(sessionId, data) {
+    const session = this.sessions.get(sessionId);
+    if (!session || session.closed) {
+      return false;
+    }
+
+    session.stream.write(Buffer.isBuffer(data) ? data : Buffer.from(data));
+    this.touch(session);
+    return true;
+  }
+
+  /**
+   * Handle a JSON control frame, e.g. {"type":"resize","cols":120,"rows":40}
+   */
+  async handleControl(sessionId, frame) {
+    const message = typeof frame === 'string' ? JSON.parse(frame) : frame;
+
+    if (message && message.type === 'resize') {
+      return this.resize(sessionId, message.cols, message.rows);
+    }
+
+    throw new Error(`Unknown control frame type: ${message && message.type}`);
+  }
+
+  async resize(sessionId, cols, rows) {
+    const session = this.sessions.get(sessionId);
+    if (!session || session.closed) {
+      return false;
+    }
+
+    const size = this.clampSize(cols, rows);
+    session.cols = size.cols;
+    session.rows = size.rows;
+    this.touch(session);
+
+    await dockerService.resizeExec(session.exec, size.cols, size.rows);
+    return true;
+  }
+
+  clampSize(cols, rows) {
+    const clamp = (value, fallback, max) => {
+      const number = parseInt(value, 10);
+      return Number.isInteger(number) && number > 0 ? Math.min(number, max) : fallback;
+    };
+
+    return {
+      cols: clamp(cols, 80, MAX_COLS),
+      rows: clamp(rows, 24, MAX_ROWS)
+    };
+  }
+
+  /**
+   * Record activity and restart the idle timer
+   */
+  touch(session) {
+    session.lastActivity = new Date();
+    // Terminal traffic keeps the container from hibernating too
+    dockerService.updateContainerActivity(session.containerId);
+
+    if (session.idleTimer) {
+      clearTimeout(session.idleTimer);
+    }
+
+    session.idleTimer = setTimeout(() => {
+      logger.info(`Terminal ${session.id} idle for ${this.idleTimeoutMs}ms, closing`);
+      this.destroySession(session.id, 'idle_timeout');
+    }, this.idleTimeoutMs);
+
+    if (session.idleTimer.unref) {
+      session.idleTimer.unref();
+    }
+  }
+
+  /**
+   * Tear down a session from either side: detach listeners, close the
+   * hijacked stream (EOF ends the shell) and remove a dedicated container
+   */
+  async destroySession(sessionId, reason = 'closed') {
+    const session = this.sessions.get(sessionId);
+    if (!session || session.closed) {
+      return false;
+    }
+
+    session.closed = true;
+    clearTimeout(session.idleTimer);
+
+    this.sessions.delete(sessionId);
+    const userSet = this.userSessions.get(session.userId);
+    if (userSet) {
+      userSet.delete(sessionId);
+      if (userSet.size === 0) {
+        this.userSessions.delete(session.userId);
+      }
+    }
+
+    const { stream } = session;
+    stream.removeListener('data', session.handleData);
+    stream.removeListener('end', session.handleEnd);
+    stream.removeListener('close', session.handleEnd);
+    stream.removeListener('error', session.handleError);
+    stream.on('error', () => {}); // late socket errors after teardown
+
+    try {
+      stream.end();
+      stream.destroy();
+    } catch (error) {
+      logger.warn(`Failed to close terminal stream ${sessionId}:`, error.message);
+    }
+
+    if (session.ownsContainer) {
+      try {
+        await dockerService.stopContainer(session.containerId);
+      } catch (error) {
+        logger.error(`Failed to remove terminal container for ${sessionId}:`, error);
+      }
+    }
+
+    if (session.onExit) {
+      session.onExit({ sessionId, reason });
+    }
+
+    logger.info('Sandbox terminal closed', { sessionId, userId: session.userId, reason });
+    return true;
+  }
+
+  destroyUserSessions(userId) {
+    const sessionIds = Array.from(this.userSessions.get(userId) || []);
+    return Promise.all(sessionIds.map(id => this.destroySession(id, 'user_disconnected')));
+  }
+
+  /**
+   * Close every terminal running in a container, e.g. before it hibernates
+   */
+  destroyContainerSessions(containerId, reason) {
+    const sessionIds = Array.from(this.sessions.values())
+      .filter(session => session.containerId === containerId)
+      .map(session => session.id);
+    return Promise.all(sessionIds.map(id => this.destroySession(id, reason)));
+  }
+
+  getSessionInfo(sessionId) {
+    const session = this.sessions.get(sessionId);
+    if (!session) {
+      return null;
+    }
+
+    return {
+      sessionId: session.id,
+      userId: session.userId,
+      containerId: session.containerId,
+      cols: session.cols,
+      rows: session.rows,
+      createdAt: session.createdAt,
+      lastActivity: session.lastActivity
+    };
+  }
+
+  getUserSessions(userId) {
+    return Array.from(this.userSessions.get(userId) || []).map(id => this.getSessionInfo(id));
+  }
+}
+
+module.exports = new SandboxTerminalService();
\ No newline at end of file
@@ -0,0 +1,120 @@
+const config = require('../config');
+const logger = require('../utils/logger');
+const runtimeRegistry = require('./runtimeRegistry');
+const DockerSandbox = require('./dockerSandbox');
+const GvisorSandbox = require('./gvisorSandbox');
+
+/**
+ * Sandbox providers by name. A runtime picks one with `sandbox`, otherwise
+ * config.sandbox.defaultProvider applies. Providers the host doesn't support
+ * fall back to docker, so a missing runsc degrades isolation instead of
+ * breaking execution; GET /api/runtimes shows which provider is in effect.
+ */
+class SandboxRegistry {
+  constructor() {
+    this.config = { ...config.sandbox };
+    this.providers = new Map();
+    this.warned = new Set(); // providers whose fallback was already logged
+
+    this.register(new DockerSandbox());
+    this.register(new GvisorSandbox());
+  }
+
+  register(provider) {
+    this.providers.set(provider.name, provider);
+    return provider;
+  }
+
+  /**
+   * Detect which providers this host supports. Runs once Docker is reachable,
+   * before any container is created.
+   * @param {Object} docker - dockerode client
+   */
+  async initialize(docker) {
+    this.warned.clear();
+    for (const provider of this.providers.values()) {
+      provider.supported = await provider.detect(docker);
+    }
+
+    const names = runtimeRegistry.names();
+    for (const provider of this.providers.values()) {
+      const runtimes = names.filter(name => this.getRequestedName(name) === provider.name);
+      if (!provider.supported && runtimes.length > 0) {
+        this.warnFallback(provider, runtimes);
+      } else if (runtimes.length > 0) {
+        logger.info(`Sandbox provider ${provider.name} for ${runtimes.join(', ')}`);
+      }
+    }
+  }
+
+  warnFallback(provider, runtimes = []) {
+    if (this.warned.has(provider.name)) {
+      return;
+    }
+    this.warned.add(provider.name);
+    logger.warn(`Sandbox provider ${provider.name} is not supported on this host; falling back to docker`
+      + (runtimes.length > 0 ? ` for ${runtimes.join(', ')}` : ''));
+  }
+
+  /**
+   * The provider called `name` (the default provider without one), or docker
+   * when that provider isn't supported here
+   */
+  get(name = null) {
+    const requested = name || this.config.defaultProvider;
+    const provider = this.providers.get(requested);
+    if (!provider) {
+      throw new Error(`Unknown sandbox provider: ${requested}`);
+    }
+
+    if (provider.supported) {
+      return provider;
+    }
+    this.warnFallback(provider);
+    return this.providers.get('docker');
+  }
+
+  getRequestedName(language) {
+    const runtime = runtimeRegistry.get(language);
+    return (runtime && runtime.sandbox) || this.config.defaultProvider;
+  }
+
+  /**
+   * Provider new containers of a runtime are created with
+   */
+  forRuntime(language) {
+    return this.get(this.getRequestedName(language));
+  }
+
+  /**
+   * Provider that created a container, the default provider if none claims it
+   */
+  forContainer(containerId) {
+    for (const provider of this.providers.values()) {
+      if (provider.owns(containerId)) {
+        return provider;
+      }
+    }
+    return this.get();
+  }
+
+  /**
+   * Sandbox capability flags of a runtime for GET /api/runtimes
+   * @returns {Object} { requested, provider, fallback, ...capabilities }
+   */
+  describe(language) {
+    const requested = this.getRequestedName(language);
+    const provider = this.forRuntime(language);
+    return {
+      requested,
+      ...provider.getCapabilities(),
+      fallback: provider.name !== requested
+    };
+  }
+
+  getCapabilities() {
+    return Object.fromEntries(Array.from(this.providers.values()).map(provider => [provider.name, provider.getCapabilities()]));
+  }
+}
+
+module.exports = new SandboxRegistry();
\ No newline at end of file
@@ -0,0 +1,57 @@
+// What a screener can decide about a submission, mildest first
+const ACTIONS = ['allow', 'flag', 'block'];
+
+/**
+ * Interface of a screener: one check services/screening runs against
+ * submitted source before it executes. A screener reports the rules the
+ * source matched, each with its action; screening combines them into one
+ * verdict. Subclasses implement check() and, when they have rules, load().
+ */
+class Screener {
+  constructor(name) {
+    this.name = name;
+  }
+
+  notImplemented(method) {
+    return new Error(`${this.name} screener does not implement ${method}`);
+  }
+
+  /**
+   * Replace the screener's rules with those in the parsed rules file. Called
+   * whenever the file changes; invalid rules should be skipped, not thrown.
+   * @param {Object} rules - Contents of config.screening.rulesFile
+   */
+  load() {}
+
+  /**
+   * @param {Array} sources - [{ path, content }] of the submission
+   * @returns {Array} Matches: [{ rule, action: 'flag' | 'block', path }]
+   */
+  check() {
+    throw this.notImplemented('check');
+  }
+}
+
+/**
+ * The action of a rule definition, or null when it has none we know
+ */
+const parseAction = (action) => (action === 'flag' || action === 'block' ? action : null);
+
+/**
+ * A rule's regular expression. No g or y flag, so test() keeps no state
+ * between submissions.
+ */
+const compilePattern = (pattern, flags = '') => {
+  if (typeof pattern !== 'string' || pattern.length === 0) {
+    throw new Error('pattern must be a non-empty string');
+  }
+  if (typeof flags !== 'string' || !/^[imsu]*$/.test(flags)) {
+    throw new Error('flags may only use i, m, s and u');
+  }
+  return new RegExp(pattern, flags);
+};
+
+module.exports = Screener;
+module.exports.ACTIONS = ACTIONS;
+module.exports.parseAction = parseAction;
+module.exports.compilePattern = compilePattern;
\ No newline at end of file
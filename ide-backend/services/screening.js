@@ -0,0 +1,239 @@
+const fs = require('fs');
+const config = require('../config');
+const logger = require('../utils/logger');
+const fileSystem = require('../utils/fileSystem');
+const { ExecError } = require('../utils/execErrors');
+const auditService = require('./auditService');
+const runtimeRegistry = require('./runtimeRegistry');
+const RuleScreener = require('./ruleScreener');
+const HeuristicScreener = require('./heuristicScreener');
+const YaraScreener = require('./yaraScreener');
+const { ACTIONS } = require('./screener');
+
+/**
+ * Screens submitted source before it runs, for cryptominers, scanners and
+ * other abuse. The screeners named in config.screening.screeners each check
+ * the source; the strictest action any of them reports is the verdict:
+ *
+ *   allow - runs as usual
+ *   flag  - runs, but is audited and adds to the user's abuse score
+ *   block - refused with a 422 that doesn't say which rule matched
+ *
+ * The abuse score decays with config.screening.abuse.halfLifeMs and makes
+ * the penalized rate limit buckets cost more (see costMultiplier). Rules come
+ * from config.screening.rulesFile and are reloaded when it changes; a file
+ * that fails to parse keeps the rules already loaded. Runtimes with
+ * "screening": false are not screened. Terminals and REPL sessions are
+ * interactive and never pass through here.
+ */
+class ScreeningService {
+  constructor() {
+    this.config = { ...config.screening };
+    this.screeners = new Map();
+    this.scores = new Map(); // userId -> { points, updatedAt }
+    this.loadedAt = null;
+    this.watching = false;
+
+    this.register(new RuleScreener());
+    this.register(new HeuristicScreener());
+    this.register(new YaraScreener());
+    this.reload();
+  }
+
+  register(screener) {
+    this.screeners.set(screener.name, screener);
+    return screener;
+  }
+
+  /**
+   * Screeners that config.screening.screeners turns on, in order
+   */
+  active() {
+    return this.config.screeners.map(name => this.screeners.get(name)).filter(Boolean);
+  }
+
+  /**
+   * Watch the rules file for changes
+   */
+  start() {
+    if (this.watching || !this.config.enabled) {
+      return;
+    }
+    this.watching = true;
+
+    fs.watchFile(this.config.rulesFile, { interval: this.config.reloadIntervalMs, persistent: false }, (current, previous) => {
+      if (current.mtimeMs !== previous.mtimeMs) {
+        this.reload();
+      }
+    });
+  }
+
+  shutdown() {
+    if (this.watching) {
+      fs.unwatchFile(this.config.rulesFile);
+      this.watching = false;
+    }
+  }
+
+  /**
+   * Load the rules file into every screener
+   * @returns {boolean} false when the file couldn't be read and the old rules stay
+   */
+  reload() {
+    let rules;
+    try {
+      rules = JSON.parse(fs.readFileSync(this.config.rulesFile, 'utf8'));
+    } catch (error) {
+      logger.error(`Failed to load screening rules from ${this.config.rulesFile}, keeping the current ones:`, error.message);
+      return false;
+    }
+
+    for (const screener of this.screeners.values()) {
+      screener.load(rules);
+    }
+    this.loadedAt = new Date();
+    logger.info(`Screening rules loaded from ${this.config.rulesFile}`);
+    return true;
+  }
+
+  appliesTo(language) {
+    const runtime = runtimeRegistry.get(language);
+    return !runtime || runtime.screening !== false;
+  }
+
+  /**
+   * Files of a submission as [{ path, content }]. Workspace runs are read
+   * from disk up to config.screening.maxScanBytes, skipping binary files.
+   * @param {Object} submission - { code, files, workspaceId, mountedFiles }
+   */
+  async sourcesOf({ code, files = null, workspaceId = null, mountedFiles = null }) {
+    if (files && typeof files === 'object') {
+      return Object.entries(files).map(([path, content]) => ({ path, content: String(content) }));
+    }
+
+    if (workspaceId && Array.isArray(mountedFiles)) {
+      const sources = [];
+      let scanned = 0;
+      for (const path of mountedFiles) {
+        try {
+          const { size } = await fileSystem.getItemStats(workspaceId, path);
+          const { isBinary } = await fileSystem.detectFileType(workspaceId, path);
+          if (isBinary || scanned + size > this.config.maxScanBytes) {
+            continue;
+          }
+          sources.push({ path, content: await fileSystem.readFile(workspaceId, path) });
+          scanned += size;
+        } catch (error) {
+          logger.debug(`Not screening ${path} of workspace ${workspaceId}: ${error.message}`);
+        }
+      }
+      return sources;
+    }
+
+    return typeof code === 'string' ? [{ path: null, content: code }] : [];
+  }
+
+  /**
+   * Run the active screeners over `sources`
+   * @returns {Object} { verdict, matches: [{ screener, rule, action, path }] }
+   */
+  check(sources) {
+    const matches = [];
+    for (const screener of this.active()) {
+      try {
+        for (const match of screener.check(sources)) {
+          matches.push({ screener: screener.name, ...match });
+        }
+      } catch (error) {
+        logger.error(`Screener ${screener.name} failed:`, error);
+      }
+    }
+
+    const verdict = matches.reduce(
+      (strictest, { action }) => (ACTIONS.indexOf(action) > ACTIONS.indexOf(strictest) ? action : strictest),
+      'allow'
+    );
+    return { verdict, matches };
+  }
+
+  /**
+   * Screen a submission before it is queued. A blocked one throws
+   * SUBMISSION_REJECTED (422) carrying only the audit entry's ID as a reference.
+   * @param {Object} submission - { language, code, files, workspaceId, mountedFiles }
+   * @returns {Object} { verdict, matches, reference }
+   */
+  async screen(userId, submission) {
+    if (!this.config.enabled || !this.appliesTo(submission.language)) {
+      return { verdict: 'allow', matches: [], reference: null };
+    }
+
+    const result = this.check(await this.sourcesOf(submission));
+    if (result.verdict === 'allow') {
+      return { ...result, reference: null };
+    }
+
+    const blocked = result.verdict === 'block';
+    const rules = result.matches.map(({ screener, rule }) => `${screener}:${rule}`);
+    this.addPoints(userId, blocked ? this.config.abuse.blockPoints : this.config.abuse.flagPoints);
+
+    const reference = auditService.logSecurityViolation('code_screening', {
+      userId,
+      resource: submission.language,
+      action: 'execute',
+      severity: blocked ? 'high' : 'medium',
+      blocked,
+      reason: rules.join(', ')
+    }) || null;
+    logger.warn(`Screening verdict ${result.verdict} for user ${userId}`, {
+      runtime: submission.language,
+      rules,
+      abuseScore: this.getScore(userId),
+      reference
+    });
+
+    if (blocked) {
+      throw new ExecError('rejected', 'SUBMISSION_REJECTED', 'This submission was rejected by the abuse policy', {
+        detail: reference ? `reference ${reference}` : null
+      });
+    }
+    return { ...result, reference };
+  }
+
+  /**
+   * The user's abuse score after decay
+   */
+  getScore(userId) {
+    const entry = this.scores.get(String(userId));
+    if (!entry) {
+      return 0;
+    }
+
+    const points = entry.points * Math.pow(0.5, (Date.now() - entry.updatedAt) / this.config.abuse.halfLifeMs);
+    if (points < 0.01) {
+      this.scores.delete(String(userId));
+      return 0;
+    }
+    return points;
+  }
+
+  addPoints(userId, points) {
+    if (!userId) {
+      return;
+    }
+    this.scores.set(String(userId), { points: this.getScore(userId) + points, updatedAt: Date.now() });
+  }
+
+  /**
+   * Factor middleware/rateLimiter multiplies a request's token cost by:
+   * 1 plus costPerPoint for every point of abuse score, in penalized buckets
+   */
+  costMultiplier(userId, bucketName) {
+    if (!userId || !this.config.abuse.buckets.includes(bucketName)) {
+      return 1;
+    }
+    return 1 + this.getScore(userId) * this.config.abuse.costPerPoint;
+  }
+}
+
+module.exports = new ScreeningService();
+module.exports.ScreeningService = ScreeningService;
\ No newline at end of file
@@ -0,0 +1,268 @@
+const fs = require('fs');
+const path = require('path');
+const config = require('../config');
+const logger = require('../utils/logger');
+const fileSystem = require('../utils/fileSystem');
+const runtimeRegistry = require('./runtimeRegistry');
+const workspaceQuota = require('./workspaceQuota');
+
+const ID_PATTERN = /^[a-z][a-z0-9-]{0,63}$/;
+const VARIABLE_PATTERN = /^[a-zA-Z][a-zA-Z0-9]{0,31}$/;
+
+// Set from the workspace being created rather than by the caller
+const BUILT_IN_VARIABLES = ['projectName', 'projectSlug'];
+
+// {{ name }} in file contents and paths
+const PLACEHOLDER = /\{\{\s*([a-zA-Z][a-zA-Z0-9]*)\s*\}\}/g;
+
+// Values are substituted into source files and paths, so no quotes, spaces or braces
+const VALUE_PATTERN = /^[A-Za-z0-9._/-]{1,200}$/;
+
+const templateError = (code, message, param = null) => {
+  const error = new Error(message);
+  error.code = code;
+  error.param = param;
+  return error;
+};
+
+// Lowercase, dash separated form of a workspace name, e.g. "My API" -> "my-api"
+const slugify = (name) => String(name).toLowerCase().replace(/[^a-z0-9]+/g, '-').replace(/^-+|-+$/g, '') || 'project';
+
+/**
+ * Starter projects for new workspaces. Each template is a directory holding a
+ * template.json manifest and a files/ tree copied into the workspace:
+ *
+ *   { "name": "Go HTTP server", "runtime": "go", "description": "...",
+ *     "entrypoint": "main.go",
+ *     "variables": { "modulePath": { "default": "example.com/{{ projectSlug }}" } } }
+ *
+ * {{ name }} placeholders in file contents and paths are replaced with the
+ * built-in variables (projectName, projectSlug) or the template's own, whose
+ * defaults may use the built-in ones. Templates in config.templates.extraDir
+ * are loaded after the bundled ones and replace those with the same id.
+ */
+class TemplateCatalog {
+  constructor() {
+    this.templates = new Map();
+    this.load();
+  }
+
+  load() {
+    this.templates.clear();
+    this.loadDir(config.templates.dir);
+
+    if (config.templates.extraDir) {
+      this.loadDir(config.templates.extraDir);
+    }
+
+    logger.info(`Template catalog loaded: ${this.ids().join(', ') || 'none'}`);
+  }
+
+  loadDir(dirPath) {
+    if (!fs.existsSync(dirPath)) {
+      logger.warn(`Template directory not found: ${dirPath}`);
+      return;
+    }
+
+    for (const entry of fs.readdirSync(dirPath, { withFileTypes: true })) {
+      if (!entry.isDirectory()) {
+        continue;
+      }
+      try {
+        this.register(entry.name, path.join(dirPath, entry.name));
+      } catch (error) {
+        logger.warn(`Skipping invalid template ${entry.name} in ${dirPath}: ${error.message}`);
+      }
+    }
+  }
+
+  /**
+   * Validate a template directory and add it to the catalog
+   */
+  register(id, templateDir) {
+    if (!ID_PATTERN.test(id)) {
+      throw new Error('template directory names must be lowercase letters, digits and dashes');
+    }
+
+    const manifest = JSON.parse(fs.readFileSync(path.join(templateDir, 'template.json'), 'utf8'));
+    for (const field of ['name', 'runtime', 'description', 'entrypoint']) {
+      if (typeof manifest[field] !== 'string' || manifest[field].length === 0) {
+        throw new Error(`${field} is required`);
+      }
+    }
+    if (!runtimeRegistry.has(manifest.runtime)) {
+      throw new Error(`unknown runtime ${manifest.runtime}`);
+    }
+
+    const variables = Object.fromEntries(BUILT_IN_VARIABLES.map(name => [name, { default: null }]));
+    for (const [name, definition] of Object.entries(manifest.variables || {})) {
+      if (!VARIABLE_PATTERN.test(name) || variables[name]) {
+        throw new Error(`invalid variable name ${name}`);
+      }
+      if (!definition || typeof definition.default !== 'string') {
+        throw new Error(`variable ${name} needs a string default`);
+      }
+      for (const [, reference] of definition.default.matchAll(PLACEHOLDER)) {
+        if (!BUILT_IN_VARIABLES.includes(reference)) {
+          throw new Error(`the default of ${name} may only use ${BUILT_IN_VARIABLES.join(', ')}`);
+        }
+      }
+      variables[name] = { default: definition.default, description: definition.description || '' };
+    }
+
+    const files = this.readFiles(path.join(templateDir, 'files'));
+    for (const file of files) {
+      for (const [, name] of `${file.path}\n${file.content}`.matchAll(PLACEHOLDER)) {
+        if (!variables[name]) {
+          throw new Error(`${file.path} uses undefined variable ${name}`);
+        }
+      }
+      fileSystem.validateFilePath(file.path);
+    }
+    if (!files.some(file => file.path === manifest.entrypoint)) {
+      throw new Error(`entrypoint ${manifest.entrypoint} is not one of its files`);
+    }
+
+    const totalSize = files.reduce((sum, file) => sum + Buffer.byteLength(file.content, 'utf8'), 0);
+    const { quotaBytes, maxFiles } = workspaceQuota.limits();
+    if (totalSize > quotaBytes || files.length > maxFiles) {
+      throw new Error(`${files.length} files of ${totalSize} bytes exceed the workspace quota`);
+    }
+
+    this.templates.set(id, {
+      id,
+      name: manifest.name,
+      runtime: manifest.runtime,
+      description: manifest.description,
+      entrypoint: manifest.entrypoint,
+      variables,
+      files,
+      totalSize,
+      source: templateDir
+    });
+  }
+
+  readFiles(filesDir) {
+    const files = [];
+    const walk = (dirPath, prefix) => {
+      for (const item of fs.readdirSync(dirPath, { withFileTypes: true })) {
+        const relativePath = prefix ? `${prefix}/${item.name}` : item.name;
+        if (item.isDirectory()) {
+          walk(path.join(dirPath, item.name), relativePath);
+        } else if (item.isFile()) {
+          files.push({ path: relativePath, content: fs.readFileSync(path.join(dirPath, item.name), 'utf8') });
+        }
+      }
+    };
+
+    walk(filesDir, '');
+    if (files.length === 0) {
+      throw new Error('files/ is empty');
+    }
+    return files.sort((a, b) => a.path.localeCompare(b.path));
+  }
+
+  ids() {
+    return Array.from(this.templates.keys()).sort();
+  }
+
+  get(id) {
+    return this.templates.get(id) || null;
+  }
+
+  /**
+   * Catalog entries without file contents, for GET /api/templates
+   */
+  list() {
+    return this.ids().map(id => {
+      const template = this.templates.get(id);
+      return {
+        id,
+        name: template.name,
+        runtime: template.runtime,
+        description: template.description,
+        entrypoint: template.entrypoint,
+        variables: Object.entries(template.variables)
+          .filter(([, definition]) => definition.default !== null)
+          .map(([name, definition]) => ({ name, default: definition.default, description: definition.description })),
+        files: template.files.map(file => file.path),
+        totalSize: template.totalSize
+      };
+    });
+  }
+
+  substitute(text, values) {
+    return text.replace(PLACEHOLDER, (match, name) => values[name]);
+  }
+
+  /**
+   * The template's files with variables substituted
+   * @param {string} projectName - name of the workspace being created
+   * @param {Object} overrides - values for the template's variables
+   * @returns {Object} { template, files: [{ path, content }], totalSize }
+   */
+  render(id, projectName, overrides = {}) {
+    const template = this.get(id);
+    if (!template) {
+      throw templateError('TEMPLATE_NOT_FOUND', `Unknown template ${id}`, 'template');
+    }
+
+    const values = { projectName, projectSlug: slugify(projectName) };
+    for (const [name, value] of Object.entries(overrides)) {
+      if (!template.variables[name] || template.variables[name].default === null) {
+        throw templateError('INVALID_TEMPLATE_VARIABLE', `Template ${id} has no variable ${name}`, `variables.${name}`);
+      }
+      if (typeof value !== 'string' || !VALUE_PATTERN.test(value)) {
+        throw templateError('INVALID_TEMPLATE_VARIABLE', `${name} may only contain letters, digits and . _ / -`, `variables.${name}`);
+      }
+    }
+    for (const [name, definition] of Object.entries(template.variables)) {
+      if (definition.default !== null) {
+        values[name] = overrides[name] !== undefined ? overrides[name] : this.substitute(definition.default, values);
+      }
+    }
+
+    const files = template.files.map(file => ({
+      path: this.substitute(file.path, values),
+      content: this.substitute(file.content, values)
+    }));
+    // A value can still make a path invalid (a `..` segment, a disallowed
+    // extension), which is the caller's doing: name the variable behind it
+    files.forEach((file, index) => {
+      try {
+        fileSystem.validateFilePath(file.path);
+      } catch (error) {
+        const used = [...template.files[index].path.matchAll(PLACEHOLDER)].map(([, name]) => name);
+        const name = used.find(variable => overrides[variable] !== undefined) || used[0];
+        if (!name) {
+          throw error;
+        }
+        throw templateError('INVALID_TEMPLATE_VARIABLE', `${name} makes the path ${file.path} invalid: ${error.message}`, `variables.${name}`);
+      }
+    });
+
+    return {
+      template,
+      files,
+      totalSize: files.reduce((sum, file) => sum + Buffer.byteLength(file.content, 'utf8'), 0)
+    };
+  }
+
+  /**
+   * Write a rendered template into a new workspace, within its quota
+   * @throws QUOTA_EXCEEDED before writing anything
+   */
+  async instantiate(workspaceId, rendered) {
+    await workspaceQuota.checkGrowth(workspaceId, rendered.totalSize, rendered.files.length);
+
+    await fs.promises.mkdir(fileSystem.getWorkspacePath(workspaceId), { recursive: true });
+    for (const file of rendered.files) {
+      await fileSystem.writeFile(workspaceId, file.path, file.content);
+    }
+
+    logger.info(`Instantiated template ${rendered.template.id} in workspace ${workspaceId}`);
+  }
+}
+
+module.exports = new TemplateCatalog();
+module.exports.TemplateCatalog = TemplateCatalog;
\ No newline at end of file
@@ -0,0 +1,77 @@
+const dockerService = require('./dockerService');
+const runtimeRegistry = require('./runtimeRegistry');
+const fileSystem = require('../utils/fileSystem');
+const projectFiles = require('../utils/projectFiles');
+const { createParser } = require('../utils/testResults');
+const logger = require('../utils/logger');
+
+/**
+ * Runs a runtime's native test runner (the registry's `test` entry) against
+ * a workspace mounted in a sandbox container and normalizes its results.
+ */
+class TestRunner {
+  /**
+   * @param {Object} containerInfo - From dockerService.getContainerInfo; must have the workspace mounted
+   * @param {string} workspaceId - Workspace whose tests to run
+   * @param {Object} options - { onResult, compileTimeoutMs, runTimeoutMs }
+   * @returns {Object} Report from utils/testResults (status 'timeout' if the run was killed) plus runtime, exit_code, duration_ms, timed_out
+   */
+  async run(containerInfo, workspaceId, { onResult = () => {}, compileTimeoutMs, runTimeoutMs } = {}) {
+    const { id: containerId, language } = containerInfo;
+    const runtime = runtimeRegistry.get(language);
+
+    if (!runtime || !runtime.test) {
+      const error = new Error(`No test runner is configured for ${language}`);
+      error.code = 'NO_TEST_RUNNER';
+      throw error;
+    }
+
+    if (containerInfo.mountWorkspaceId !== workspaceId) {
+      const error = new Error('Container was not created with this workspace mounted');
+      error.code = 'WORKSPACE_NOT_MOUNTED';
+      throw error;
+    }
+
+    const files = await fileSystem.listFilesRecursive(workspaceId);
+    const env = projectFiles.getBuildEnv(language, Object.fromEntries(files.map(file => [file, ''])), {
+      networkEnabled: containerInfo.networkEnabled
+    });
+
+    // Test runs build and execute in one go, so they get both budgets
+    const limits = runtimeRegistry.resolveTimeouts(language, { compileTimeoutMs, runTimeoutMs });
+    const parser = createParser(runtime.test.format, onResult);
+
+    const result = await dockerService.runBufferedExec(containerId, runtime.test.command, {
+      env,
+      timeoutMs: limits.compileTimeoutMs + limits.runTimeoutMs,
+      onStdout: chunk => parser.write(chunk),
+      phase: 'test'
+    });
+
+    const report = parser.finish({ stderr: result.stderr, exitCode: result.exitCode });
+
+    if (result.timedOut) {
+      // The runner is still going inside the container
+      dockerService.terminateExecution({ containerId, exec: null }, 0).catch(error =>
+        logger.error(`Failed to kill timed out test run in container ${containerId}:`, error)
+      );
+    }
+
+    logger.info(`Test run in container ${containerId} finished: ${result.timedOut ? 'timeout' : report.status}`, {
+      workspaceId,
+      runtime: language,
+      ...report.summary
+    });
+
+    return {
+      ...report,
+      status: result.timedOut ? 'timeout' : report.status,
+      runtime: language,
+      exit_code: result.exitCode,
+      duration_ms: result.durationMs,
+      timed_out: result.timedOut
+    };
+  }
+}
+
+module.exports = new TestRunner();
\ No newline at end of file
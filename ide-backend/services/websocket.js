@@ -4,7 +4,14 @@ const User = require('../models/User');
 const logger = require('../utils/logger');
 const config = require('../config');
 const terminalService = require('./terminal');
+const sandboxTerminal = require('./sandboxTerminal');
 const collaborationService = require('./collaborationService');
+const collaborationHub = require('./collaborationHub');
+const lspGateway = require('./lspGateway');
+const workspaceWatcher = require('./workspaceWatcher');
+const executionMetrics = require('./metrics');
+const requestContext = require('../utils/requestContext');
+const { classify } = require('../utils/execErrors');
 
 /**
  * WebSocket service for handling Socket.IO connections and events
@@ -34,6 +41,7 @@ class WebSocketService {
 
     // Initialize collaboration service
     collaborationService.initialize(this.io);
+    collaborationHub.initialize(this.io);
 
     // Authentication middleware
     this.io.use(this.authenticateSocket.bind(this));
@@ -41,6 +49,8 @@ class WebSocketService {
     // Connection handling
     this.io.on('connection', this.handleConnection.bind(this));
 
+    executionMetrics.setSource('websocketSessions', () => this.userSessions.size);
+
     logger.info('Socket.IO server initialized');
   }
 
@@ -162,7 +172,8 @@ class WebSocketService {
       connectedAt: new Date(),
       lastActivity: new Date(),
       workspaceId: null,
-      terminalSessions: new Map()
+      terminalSessions: new Map(),
+      ptySessions: new Set()
     });
 
     // Join user to their personal room
@@ -233,6 +244,23 @@ class WebSocketService {
       this.handleTerminalHistory(socket, data);
     });
 
+    // Sandbox PTY events: binary 'pty:data' frames both ways, JSON 'pty:control' frames
+    socket.on('pty:create', (data) => {
+      this.handlePtyCreate(socket, data);
+    });
+
+    socket.on('pty:data', (sessionId, data) => {
+      this.handlePtyData(socket, sessionId, data);
+    });
+
+    socket.on('pty:control', (sessionId, frame) => {
+      this.handlePtyControl(socket, sessionId, frame);
+    });
+
+    socket.on('pty:close', (data) => {
+      this.handlePtyClose(socket, data);
+    });
+
     // Collaboration events
     socket.on('collaboration:document-join', (data) => {
       collaborationService.handleDocumentJoin(socket, data);
@@ -250,7 +278,26 @@ class WebSocketService {
       collaborationService.handleAwarenessUpdate(socket, data);
     });
 
-    // File events (placeholder for future implementation)
+    // Operational-transform editing of workspace files (see collaborationHub)
+    socket.on('collab:join', (data) => {
+      collaborationHub.handleJoin(socket, data);
+    });
+
+    socket.on('collab:op', (data) => {
+      collaborationHub.handleOp(socket, data);
+    });
+
+    socket.on('collab:presence', (data) => {
+      collaborationHub.handlePresence(socket, data);
+    });
+
+    socket.on('collab:leave', (data) => {
+      collaborationHub.handleLeave(socket, data).catch(error =>
+        logger.error('Error leaving collaboration session', { socketId: socket.id, error: error.message })
+      );
+    });
+
+    // Server-side file changes in a workspace (see workspaceWatcher)
     socket.on('file:watch', (data) => {
       this.handleFileWatch(socket, data);
     });
@@ -268,6 +315,14 @@ class WebSocketService {
       this.handleExecutionStop(socket, data);
     });
 
+    socket.on('execution:stdin', (data) => {
+      this.handleExecutionStdin(socket, data);
+    });
+
+    socket.on('execution:reattach', (data) => {
+      this.handleExecutionReattach(socket, data);
+    });
+
     // LSP events
     socket.on('lsp:start', (data) => {
       this.handleLSPStart(socket, data);
@@ -285,6 +340,22 @@ class WebSocketService {
       this.handleLSPDisconnect(socket, data);
     });
 
+    // Language servers inside the user's workspace container (see lspGateway)
+    socket.on('lsp:open', (data) => {
+      lspGateway.handleOpen(socket, data).catch(error => {
+        logger.error('Error opening LSP session', { socketId: socket.id, error: error.message });
+        socket.emit('lsp:error', { sessionId: null, code: 'START_FAILED', message: error.message });
+      });
+    });
+
+    socket.on('lsp:message', (data) => {
+      lspGateway.handleMessage(socket, data);
+    });
+
+    socket.on('lsp:close', (data) => {
+      lspGateway.handleClose(socket, data);
+    });
+
     // Error handling
     socket.on('error', (error) => {
       logger.error('Socket error:', {
@@ -644,29 +715,51 @@ class WebSocketService {
   }
 
   /**
-   * Handle file watch (placeholder)
+   * Handle file watch: subscribe to file:changes for a workspace the user can read
    * @param {Object} socket - Socket.IO socket instance
    * @param {Object} data - Event data
    */
-  handleFileWatch(socket, data) {
-    // Placeholder for future file watching implementation
-    logger.debug('File watch received (placeholder)', {
-      socketId: socket.id,
-      data: data
-    });
+  async handleFileWatch(socket, data = {}) {
+    const { workspaceId } = data;
+
+    if (!workspaceId) {
+      socket.emit('file:error', { workspaceId: null, code: 'INVALID_REQUEST', message: 'Workspace ID is required' });
+      return;
+    }
+
+    if (!workspaceWatcher.isEnabled()) {
+      socket.emit('file:error', { workspaceId, code: 'WATCH_DISABLED', message: 'File watching is disabled' });
+      return;
+    }
+
+    try {
+      const access = await collaborationHub.authorize(socket.userId, workspaceId);
+      if (!access.read) {
+        socket.emit('file:error', { workspaceId, code: 'ACCESS_DENIED', message: 'Access denied to this workspace' });
+        return;
+      }
+
+      const { mode } = await workspaceWatcher.subscribe(workspaceId, socket);
+      socket.emit('file:watching', { workspaceId, mode });
+    } catch (error) {
+      logger.error('Failed to watch workspace files', {
+        socketId: socket.id,
+        workspaceId,
+        error: error.message
+      });
+      socket.emit('file:error', { workspaceId, code: 'WATCH_FAILED', message: error.message });
+    }
   }
 
   /**
-   * Handle file unwatch (placeholder)
+   * Handle file unwatch
    * @param {Object} socket - Socket.IO socket instance
    * @param {Object} data - Event data
    */
-  handleFileUnwatch(socket, data) {
-    // Placeholder for future file watching implementation
-    logger.debug('File unwatch received (placeholder)', {
-      socketId: socket.id,
-      data: data
-    });
+  handleFileUnwatch(socket, data = {}) {
+    if (data.workspaceId) {
+      workspaceWatcher.unsubscribe(data.workspaceId, socket);
+    }
   }
 
   /**
@@ -681,51 +774,71 @@ class WebSocketService {
       return;
     }
 
-    const { containerId, code, filename, executionId } = data;
+    const { containerId, code, filename, stdin, interactive, files, entrypoint, args, env, useSecrets, compileTimeoutMs, runTimeoutMs, artifacts } = data;
     
     if (!containerId) {
       socket.emit('execution:error', { message: 'Container ID is required' });
       return;
     }
 
-    if (!code) {
+    if (!code && !files) {
       socket.emit('execution:error', { message: 'Code is required' });
       return;
     }
 
-    try {
-      const executionService = require('./executionService');
+    // Each execution gets its own request ID (client-supplied or generated) for log correlation
+    const requestId = requestContext.resolveRequestId(data.requestId);
+
+    await requestContext.run({ requestId }, async () => {
+      try {
+        const executionService = require('./executionService');
       
-      // Add user ID to socket for execution service
-      socket.userId = session.userId;
+        // Add user ID to socket for execution service
+        socket.userId = session.userId;
       
-      const execId = await executionService.startExecution(socket, {
-        containerId,
-        code,
-        filename,
-        executionId
-      });
+        const execId = await executionService.startExecution(socket, {
+          containerId,
+          code,
+          filename,
+          stdin: typeof stdin === 'string' ? stdin : null,
+          interactive: interactive === true,
+          files: files && typeof files === 'object' ? files : null,
+          entrypoint: typeof entrypoint === 'string' ? entrypoint : null,
+          // Checked against the container's runtime before anything runs
+          args: args === undefined ? [] : args,
+          env: env === undefined ? {} : env,
+          useSecrets: useSecrets === true,
+          compileTimeoutMs: Number.isInteger(compileTimeoutMs) && compileTimeoutMs > 0 ? compileTimeoutMs : null,
+          runTimeoutMs: Number.isInteger(runTimeoutMs) && runTimeoutMs > 0 ? runTimeoutMs : null,
+          artifacts: artifacts === undefined ? [] : artifacts,
+          requestId
+        });
 
-      logger.info('Code execution started via WebSocket', {
-        socketId: socket.id,
-        userId: session.userId,
-        executionId: execId,
-        containerId: containerId
-      });
+        logger.info('Code execution started via WebSocket', {
+          socketId: socket.id,
+          userId: session.userId,
+          executionId: execId,
+          containerId: containerId
+        });
 
-    } catch (error) {
-      logger.error('Failed to start execution via WebSocket', {
-        socketId: socket.id,
-        userId: session.userId,
-        containerId: containerId,
-        error: error.message
-      });
+      } catch (error) {
+        logger.error('Failed to start execution via WebSocket', {
+          socketId: socket.id,
+          userId: session.userId,
+          containerId: containerId,
+          error: error.message
+        });
 
-      socket.emit('execution:error', {
-        message: 'Failed to start execution',
-        error: error.message
-      });
-    }
+        const { code, kind } = classify(error);
+        socket.emit('execution:error', {
+          message: 'Failed to start execution',
+          error: error.message,
+          code,
+          kind,
+          requestId
+        });
+      }
+    });
   }
 
   /**
@@ -780,6 +893,204 @@ class WebSocketService {
     }
   }
 
+  /**
+   * Handle stdin frames for an interactive execution
+   * @param {Object} socket - Socket.IO socket instance
+   * @param {Object} data - Event data ({ executionId, stream: 'stdin', data } or { executionId, eof: true })
+   */
+  handleExecutionStdin(socket, data) {
+    const session = this.userSessions.get(socket.id);
+    if (!session) {
+      socket.emit('execution:error', { message: 'Session not found' });
+      return;
+    }
+
+    const { executionId, eof } = data || {};
+
+    if (!executionId) {
+      socket.emit('execution:error', { message: 'Execution ID is required' });
+      return;
+    }
+
+    const executionService = require('./executionService');
+    const execution = executionService.activeExecutions.get(executionId);
+
+    // Only the socket that started the execution may feed its stdin
+    if (!execution || execution.socket !== socket) {
+      socket.emit('execution:error', {
+        executionId,
+        message: 'Execution not found or already completed'
+      });
+      return;
+    }
+
+    if (typeof data.data === 'string' && data.data.length > 0) {
+      executionService.writeStdin(executionId, data.data);
+    }
+
+    if (eof === true) {
+      executionService.closeStdin(executionId);
+    }
+  }
+
+  /**
+   * Resume an execution after a reconnect, on this instance or another one
+   * @param {Object} socket - Socket.IO socket instance
+   * @param {Object} data - Event data ({ executionId, lastSeq }): lastSeq is
+   *   the seq of the last execution:output frame the client received
+   */
+  async handleExecutionReattach(socket, data) {
+    const session = this.userSessions.get(socket.id);
+    if (!session) {
+      socket.emit('execution:error', { message: 'Session not found' });
+      return;
+    }
+
+    const { executionId, lastSeq } = data || {};
+
+    if (!executionId || typeof executionId !== 'string') {
+      socket.emit('execution:error', { message: 'Execution ID is required' });
+      return;
+    }
+
+    try {
+      const executionService = require('./executionService');
+      socket.userId = session.userId;
+
+      const reattached = await executionService.reattachExecution(
+        socket,
+        executionId,
+        Number.isInteger(lastSeq) && lastSeq > 0 ? lastSeq : 0
+      );
+
+      logger.info('Execution reattached via WebSocket', {
+        socketId: socket.id,
+        userId: session.userId,
+        executionId,
+        owner: reattached.owner,
+        replayed: reattached.replayed
+      });
+    } catch (error) {
+      const { code, kind } = classify(error);
+      if (kind === 'infrastructure') {
+        logger.error('Failed to reattach execution via WebSocket', {
+          socketId: socket.id,
+          userId: session.userId,
+          executionId,
+          error: error.message
+        });
+      }
+
+      socket.emit('execution:error', {
+        executionId,
+        message: 'Failed to reattach execution',
+        error: error.message,
+        code,
+        kind
+      });
+    }
+  }
+
+  /**
+   * Open a PTY session inside a sandbox container
+   * @param {Object} socket - Socket.IO socket instance
+   * @param {Object} data - Event data ({ containerId, language, workspaceId, cols, rows })
+   */
+  async handlePtyCreate(socket, data = {}) {
+    const session = this.userSessions.get(socket.id);
+    if (!session) {
+      socket.emit('pty:error', { message: 'Session not found' });
+      return;
+    }
+
+    try {
+      const info = await sandboxTerminal.createSession(session.userId, data, {
+        onData: (chunk, sessionId) => socket.emit('pty:data', sessionId, chunk),
+        onExit: ({ sessionId, reason }) => {
+          session.ptySessions.delete(sessionId);
+          socket.emit('pty:exit', { sessionId, reason });
+        }
+      });
+
+      // The socket may have gone while the container started; its disconnect
+      // cleanup ran before this session existed
+      if (!socket.connected || this.userSessions.get(socket.id) !== session) {
+        await sandboxTerminal.destroySession(info.sessionId, 'client_disconnected');
+        return;
+      }
+
+      session.ptySessions.add(info.sessionId);
+      socket.emit('pty:created', info);
+    } catch (error) {
+      logger.error('Failed to create sandbox terminal', {
+        socketId: socket.id,
+        userId: session.userId,
+        error: error.message
+      });
+
+      socket.emit('pty:error', {
+        message: 'Failed to create terminal',
+        code: error.code,
+        error: error.message
+      });
+    }
+  }
+
+  /**
+   * Handle a binary input frame for a PTY session
+   * @param {Object} socket - Socket.IO socket instance
+   * @param {string} sessionId - PTY session ID
+   * @param {Buffer|string} data - Terminal bytes
+   */
+  handlePtyData(socket, sessionId, data) {
+    const session = this.userSessions.get(socket.id);
+    if (!session || !session.ptySessions.has(sessionId)) {
+      socket.emit('pty:error', { sessionId, message: 'Terminal not found in session' });
+      return;
+    }
+
+    if (data === undefined || data === null) {
+      return;
+    }
+
+    sandboxTerminal.write(sessionId, data);
+  }
+
+  /**
+   * Handle a JSON control frame ({"type":"resize","cols":120,"rows":40})
+   * @param {Object} socket - Socket.IO socket instance
+   * @param {string} sessionId - PTY session ID
+   * @param {Object|string} frame - Control frame
+   */
+  async handlePtyControl(socket, sessionId, frame) {
+    const session = this.userSessions.get(socket.id);
+    if (!session || !session.ptySessions.has(sessionId)) {
+      socket.emit('pty:error', { sessionId, message: 'Terminal not found in session' });
+      return;
+    }
+
+    try {
+      await sandboxTerminal.handleControl(sessionId, frame);
+    } catch (error) {
+      socket.emit('pty:error', { sessionId, message: error.message });
+    }
+  }
+
+  /**
+   * Close a PTY session
+   * @param {Object} socket - Socket.IO socket instance
+   * @param {Object} data - Event data ({ sessionId })
+   */
+  async handlePtyClose(socket, data = {}) {
+    const session = this.userSessions.get(socket.id);
+    if (!session || !session.ptySessions.has(data.sessionId)) {
+      socket.emit('pty:error', { sessionId: data.sessionId, message: 'Terminal not found in session' });
+      return;
+    }
+
+    await sandboxTerminal.destroySession(data.sessionId, 'closed');
+  }
+
   /**
    * Handle terminal autocomplete request
    * @param {Object} socket - Socket.IO socket instance
@@ -933,8 +1244,33 @@ class WebSocketService {
         session.terminalSessions.clear();
       }
 
+      // Clean up sandbox PTY sessions (exec streams and dedicated containers)
+      if (session.ptySessions) {
+        for (const sessionId of session.ptySessions) {
+          sandboxTerminal.destroySession(sessionId, 'client_disconnected').catch(error =>
+            logger.error('Error cleaning up sandbox terminal on disconnect', {
+              sessionId,
+              error: error.message
+            })
+          );
+        }
+        session.ptySessions.clear();
+      }
+
+      // Language servers keep running detached until their idle timeout
+      lspGateway.handleDisconnection(socket);
+
+      // The last subscriber leaving closes the workspace's watch
+      workspaceWatcher.unsubscribeAll(socket);
+
       // Clean up collaboration sessions
       collaborationService.handleDisconnection(socket);
+      collaborationHub.handleDisconnection(socket).catch(error =>
+        logger.error('Error leaving collaboration sessions on disconnect', {
+          socketId: socket.id,
+          error: error.message
+        })
+      );
 
       // Remove session data
       this.userSessions.delete(socket.id);
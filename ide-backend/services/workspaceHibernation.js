@@ -0,0 +1,228 @@
+const config = require('../config');
+const logger = require('../utils/logger');
+const fileSystem = require('../utils/fileSystem');
+const dockerService = require('./dockerService');
+const collaborationHub = require('./collaborationHub');
+const lspGateway = require('./lspGateway');
+const sandboxTerminal = require('./sandboxTerminal');
+const executionMetrics = require('./metrics');
+
+/**
+ * Stops the containers of workspaces nobody has used for
+ * config.workspaceHibernation.idleTimeoutMs and starts them again on next
+ * use. Activity is a file API request or write, terminal traffic or an
+ * execution in one of the workspace's containers. Before hibernating, open
+ * collaborative documents are flushed to disk (a failed flush keeps the
+ * workspace running) and its terminals and language servers are closed.
+ *
+ * The next file API request resumes the containers in the background, and
+ * an exec into one resumes it first (dockerService.wake). Sockets in the
+ * workspace get workspace:state { workspaceId, state } as it changes, state
+ * being active, hibernating, hibernated or resuming.
+ */
+class WorkspaceHibernation {
+  constructor() {
+    this.config = { ...config.workspaceHibernation };
+    this.activity = new Map(); // workspaceId -> last file API activity (ms)
+    this.states = new Map(); // workspaceId -> state other than active
+    this.timer = null;
+    this.listening = false;
+  }
+
+  start() {
+    if (this.listening) {
+      return;
+    }
+    this.listening = true;
+
+    fileSystem.changes.on('write', ({ workspaceId }) => this.touch(workspaceId));
+    dockerService.hibernation.on('resuming', ({ workspaceId }) => this.setState(workspaceId, 'resuming'));
+    dockerService.hibernation.on('resumed', ({ workspaceId }) => this.setState(workspaceId, 'active'));
+    dockerService.hibernation.on('resume_failed', ({ workspaceId }) => {
+      this.setState(workspaceId, this.containersOf(workspaceId).length > 0 ? 'hibernated' : 'active');
+    });
+    executionMetrics.setSource('workspaceStates', () => this.counts());
+
+    if (!this.config.enabled) {
+      return;
+    }
+    this.timer = setInterval(() => {
+      this.sweep().catch(error => logger.error('Workspace hibernation sweep failed:', error));
+    }, this.config.checkIntervalMs);
+    this.timer.unref();
+    logger.info(`Workspace hibernation after ${this.config.idleTimeoutMs}ms idle`);
+  }
+
+  shutdown() {
+    clearInterval(this.timer);
+    this.timer = null;
+  }
+
+  /**
+   * Record activity, resuming the workspace if it hibernated
+   */
+  touch(workspaceId) {
+    workspaceId = String(workspaceId);
+    this.activity.set(workspaceId, Date.now());
+
+    if (this.states.get(workspaceId) === 'hibernated') {
+      this.resume(workspaceId).catch(error =>
+        logger.warn(`Failed to resume workspace ${workspaceId}:`, error.message)
+      );
+    }
+  }
+
+  getState(workspaceId) {
+    return this.states.get(String(workspaceId)) || 'active';
+  }
+
+  setState(workspaceId, state) {
+    workspaceId = String(workspaceId);
+    if (this.getState(workspaceId) === state) {
+      return;
+    }
+
+    if (state === 'active') {
+      this.states.delete(workspaceId);
+    } else {
+      this.states.set(workspaceId, state);
+    }
+    logger.info(`Workspace ${workspaceId} is ${state}`);
+
+    // Required here so the websocket service can load this module itself
+    const webSocketService = require('./websocket');
+    webSocketService.sendToWorkspace(workspaceId, 'workspace:state', { workspaceId, state });
+  }
+
+  /**
+   * Tracked containers with the workspace mounted
+   * @returns {Array} [[containerId, containerInfo]]
+   */
+  containersOf(workspaceId) {
+    return Array.from(dockerService.containers.entries())
+      .filter(([, info]) => info.mountWorkspaceId && String(info.mountWorkspaceId) === String(workspaceId));
+  }
+
+  /**
+   * Workspaces with a container, by state, for the studio_workspaces gauge
+   */
+  counts() {
+    const counts = { active: 0, hibernating: 0, hibernated: 0, resuming: 0 };
+    const workspaceIds = new Set();
+    for (const info of dockerService.containers.values()) {
+      if (info.mountWorkspaceId) {
+        workspaceIds.add(String(info.mountWorkspaceId));
+      }
+    }
+    for (const workspaceId of workspaceIds) {
+      counts[this.getState(workspaceId)]++;
+    }
+    return counts;
+  }
+
+  lastActivity(workspaceId, containers) {
+    return Math.max(
+      this.activity.get(workspaceId) || 0,
+      ...containers.map(([, info]) => info.lastActivity.getTime())
+    );
+  }
+
+  isExecuting(containers) {
+    // Required here: the execution service loads far more than activity tracking needs
+    const executionService = require('./executionService');
+    const containerIds = new Set(containers.map(([containerId]) => containerId));
+    return Array.from(executionService.activeExecutions.values())
+      .some(execution => containerIds.has(execution.containerId));
+  }
+
+  /**
+   * Hibernate every workspace idle past config.workspaceHibernation.idleTimeoutMs
+   * @returns {Array} ids of the workspaces hibernated
+   */
+  async sweep() {
+    const now = Date.now();
+    const byWorkspace = new Map();
+    for (const entry of dockerService.containers.entries()) {
+      const workspaceId = entry[1].mountWorkspaceId && String(entry[1].mountWorkspaceId);
+      if (workspaceId) {
+        byWorkspace.set(workspaceId, [...(byWorkspace.get(workspaceId) || []), entry]);
+      }
+    }
+
+    // Workspaces whose containers were stopped for good
+    for (const workspaceId of this.states.keys()) {
+      if (!byWorkspace.has(workspaceId)) {
+        this.states.delete(workspaceId);
+      }
+    }
+    for (const [workspaceId, lastActive] of this.activity) {
+      if (!byWorkspace.has(workspaceId) && now - lastActive >= this.config.idleTimeoutMs) {
+        this.activity.delete(workspaceId);
+      }
+    }
+
+    const hibernated = [];
+    for (const [workspaceId, containers] of byWorkspace) {
+      const running = containers.filter(([, info]) => info.state === 'running');
+      if (this.states.has(workspaceId) || running.length === 0) {
+        continue;
+      }
+      if (now - this.lastActivity(workspaceId, running) < this.config.idleTimeoutMs || this.isExecuting(running)) {
+        continue;
+      }
+
+      try {
+        if (await this.hibernate(workspaceId)) {
+          hibernated.push(workspaceId);
+        }
+      } catch (error) {
+        logger.error(`Failed to hibernate workspace ${workspaceId}:`, error);
+      }
+    }
+    return hibernated;
+  }
+
+  /**
+   * Flush the workspace's documents, close its sessions and stop its containers
+   * @returns {boolean} false when unsaved documents kept it running
+   */
+  async hibernate(workspaceId) {
+    workspaceId = String(workspaceId);
+    const running = this.containersOf(workspaceId).filter(([, info]) => info.state === 'running');
+    if (running.length === 0) {
+      return false;
+    }
+
+    this.setState(workspaceId, 'hibernating');
+    try {
+      if (!(await collaborationHub.flushWorkspace(workspaceId))) {
+        logger.warn(`Not hibernating workspace ${workspaceId}: its open documents could not be saved`);
+        this.setState(workspaceId, 'active');
+        return false;
+      }
+
+      for (const [containerId] of running) {
+        lspGateway.stopContainerSessions(containerId, 'hibernated');
+        await sandboxTerminal.destroyContainerSessions(containerId, 'hibernated');
+        await dockerService.hibernateContainer(containerId);
+      }
+    } catch (error) {
+      this.setState(workspaceId, 'active');
+      throw error;
+    }
+
+    this.setState(workspaceId, 'hibernated');
+    return true;
+  }
+
+  /**
+   * Start the workspace's hibernated containers again
+   */
+  async resume(workspaceId) {
+    const hibernated = this.containersOf(workspaceId).filter(([, info]) => info.state !== 'running');
+    await Promise.all(hibernated.map(([, info]) => dockerService.wake(info)));
+  }
+}
+
+module.exports = new WorkspaceHibernation();
+module.exports.WorkspaceHibernation = WorkspaceHibernation;
\ No newline at end of file
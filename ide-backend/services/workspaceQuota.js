@@ -0,0 +1,283 @@
+const crypto = require('crypto');
+const path = require('path');
+const { execFile } = require('child_process');
+const { promisify } = require('util');
+const config = require('../config');
+const fileSystem = require('../utils/fileSystem');
+const logger = require('../utils/logger');
+
+const execFileAsync = promisify(execFile);
+
+const quotaError = (message, usage) => {
+  const error = new Error(message);
+  error.code = 'QUOTA_EXCEEDED';
+  error.usage = usage;
+  return error;
+};
+
+/**
+ * Usage providers. Both implement:
+ *
+ *   measure(workspaceId) -> { bytesUsed, fileCount }
+ *   apply(workspaceId, limits) -> whether the kernel now enforces the limits
+ */
+class WalkUsageProvider {
+  constructor() {
+    this.name = 'walk';
+  }
+
+  async measure(workspaceId) {
+    const stats = await fileSystem.getWorkspaceStats(workspaceId);
+    return { bytesUsed: stats.totalSize, fileCount: stats.fileCount };
+  }
+
+  async apply() {
+    return false;
+  }
+}
+
+class XfsQuotaProvider {
+  constructor({ xfsMountPoint, xfsProjectBase }, run = execFileAsync) {
+    this.name = 'xfs';
+    this.mountPoint = xfsMountPoint;
+    this.projectBase = xfsProjectBase;
+    this.run = run;
+  }
+
+  // Stable per workspace, so restarts keep the project the directory is tagged with
+  projectId(workspaceId) {
+    const hash = crypto.createHash('sha1').update(String(workspaceId)).digest('hex');
+    return this.projectBase + parseInt(hash.slice(0, 6), 16);
+  }
+
+  xfsQuota(command) {
+    return this.run('xfs_quota', ['-x', '-c', command, this.mountPoint], { timeout: 10 * 1000 });
+  }
+
+  async apply(workspaceId, { quotaBytes, maxFiles }) {
+    const id = this.projectId(workspaceId);
+    const directory = path.resolve(fileSystem.getWorkspacePath(workspaceId));
+    await this.xfsQuota(`project -s -p ${directory} ${id}`);
+    await this.xfsQuota(`limit -p bhard=${quotaBytes} ihard=${maxFiles} ${id}`);
+    return true;
+  }
+
+  /**
+   * Reads `quota -p -N -b -i`, e.g.
+   *   /dev/sdb 1024 0 51200 00 [--------] 3 0 500 00 [--------] /workspaces
+   * with blocks in KiB
+   */
+  async measure(workspaceId) {
+    const { stdout } = await this.xfsQuota(`quota -p -N -b -i ${this.projectId(workspaceId)}`);
+    const fields = stdout.replace(/\[[^\]]*\]/g, ' ').trim().split(/\s+/);
+    const blocks = parseInt(fields[1], 10);
+    const files = parseInt(fields[5], 10);
+    if (!Number.isFinite(blocks) || !Number.isFinite(files)) {
+      throw new Error(`Unexpected xfs_quota output: ${stdout.trim().slice(0, 200)}`);
+    }
+    return { bytesUsed: blocks * 1024, fileCount: files };
+  }
+}
+
+/**
+ * Disk usage of each workspace against its quota (fileSystem.maxWorkspaceSize
+ * bytes, fileSystem.maxWorkspaceFiles files). File API writes are checked
+ * against the last measurement before they happen, and the workspace is
+ * measured again shortly after, so writes the API can't see (executions
+ * with the workspace mounted) are counted too. Crossing
+ * config.workspaceQuota.warnPercent warns the workspace's sockets with a
+ * workspace:quota-warning event.
+ */
+class WorkspaceQuota {
+  constructor() {
+    this.config = { ...config.workspaceQuota };
+    this.walk = new WalkUsageProvider();
+    this.provider = this.config.provider === 'xfs' ? new XfsQuotaProvider(this.config) : this.walk;
+    this.usage = new Map(); // workspaceId -> last measurement
+    this.levels = new Map(); // workspaceId -> warning level last announced
+    this.pending = new Map(); // workspaceId -> scheduled refresh timer
+    this.applied = new Set(); // workspaces whose kernel limit is set
+    this.listening = false;
+  }
+
+  limits() {
+    return { quotaBytes: fileSystem.maxWorkspaceSize, maxFiles: fileSystem.maxWorkspaceFiles };
+  }
+
+  /**
+   * Refresh usage after every write through the file API
+   */
+  start() {
+    if (this.listening) {
+      return;
+    }
+    this.listening = true;
+    fileSystem.changes.on('write', ({ workspaceId }) => this.scheduleRefresh(workspaceId));
+  }
+
+  describe(workspaceId, { bytesUsed, fileCount }, measuredAt) {
+    const { quotaBytes, maxFiles } = this.limits();
+    return {
+      workspaceId,
+      bytesUsed,
+      fileCount,
+      quotaBytes,
+      maxFiles,
+      percent: Math.round(Math.max(bytesUsed / quotaBytes, fileCount / maxFiles) * 1000) / 10,
+      provider: this.provider.name,
+      enforced: this.applied.has(workspaceId),
+      measuredAt
+    };
+  }
+
+  /**
+   * Put the kernel limit on the workspace once, for providers that have one
+   */
+  async prepare(workspaceId) {
+    workspaceId = String(workspaceId);
+    if (this.applied.has(workspaceId) || this.provider === this.walk) {
+      return;
+    }
+    try {
+      if (await this.provider.apply(workspaceId, this.limits())) {
+        this.applied.add(workspaceId);
+      }
+    } catch (error) {
+      logger.warn(`Failed to set the disk quota of workspace ${workspaceId}:`, error.message);
+    }
+  }
+
+  async measure(workspaceId) {
+    await this.prepare(workspaceId);
+    try {
+      return await this.provider.measure(workspaceId);
+    } catch (error) {
+      if (this.provider === this.walk) {
+        throw error;
+      }
+      logger.warn(`Falling back to walking workspace ${workspaceId}:`, error.message);
+      return this.walk.measure(workspaceId);
+    }
+  }
+
+  /**
+   * Measure the workspace now and announce a crossed warning threshold
+   */
+  async refresh(workspaceId) {
+    workspaceId = String(workspaceId);
+    const usage = this.describe(workspaceId, await this.measure(workspaceId), new Date().toISOString());
+    this.usage.set(workspaceId, usage);
+    this.announce(usage);
+    return usage;
+  }
+
+  scheduleRefresh(workspaceId) {
+    workspaceId = String(workspaceId);
+    if (this.pending.has(workspaceId)) {
+      return;
+    }
+
+    const timer = setTimeout(() => {
+      this.pending.delete(workspaceId);
+      this.refresh(workspaceId).catch(error =>
+        logger.warn(`Failed to measure workspace ${workspaceId}:`, error.message)
+      );
+    }, this.config.refreshDelayMs);
+    timer.unref();
+    this.pending.set(workspaceId, timer);
+  }
+
+  /**
+   * @param {Object} options - { fresh } to measure instead of reusing a
+   *   measurement up to config.workspaceQuota.cacheTtlMs old
+   * @returns {Object} { workspaceId, bytesUsed, fileCount, quotaBytes,
+   *   maxFiles, percent, provider, enforced, measuredAt }
+   */
+  async getUsage(workspaceId, { fresh = false } = {}) {
+    workspaceId = String(workspaceId);
+    const cached = this.usage.get(workspaceId);
+    if (!fresh && cached && Date.now() - Date.parse(cached.measuredAt) < this.config.cacheTtlMs) {
+      // Limits are read live, so a changed quota shows without a new walk
+      return this.describe(workspaceId, cached, cached.measuredAt);
+    }
+    return this.refresh(workspaceId);
+  }
+
+  /**
+   * Ensure writing `size` bytes to `filePath` (replacing what is there) keeps
+   * the workspace within its quota
+   * @returns {Object} usage as it will be after the write
+   * @throws QUOTA_EXCEEDED with `usage` as it is now
+   */
+  async checkWrite(workspaceId, filePath, size) {
+    let existingSize = 0;
+    let isNewFile = true;
+    if (await fileSystem.exists(workspaceId, filePath)) {
+      existingSize = (await fileSystem.getItemStats(workspaceId, filePath)).size;
+      isNewFile = false;
+    }
+    return this.checkGrowth(workspaceId, size - existingSize, isNewFile ? 1 : 0);
+  }
+
+  /**
+   * Ensure adding `bytes` in `files` new files keeps the workspace within its quota
+   */
+  async checkGrowth(workspaceId, bytes, files) {
+    workspaceId = String(workspaceId);
+    const usage = await this.getUsage(workspaceId);
+
+    if (usage.fileCount + files > usage.maxFiles) {
+      throw quotaError(`Workspace file limit exceeded (max ${usage.maxFiles} files)`, usage);
+    }
+    if (usage.bytesUsed + bytes > usage.quotaBytes) {
+      throw quotaError(`Workspace size limit exceeded (max ${usage.quotaBytes} bytes)`, usage);
+    }
+
+    // Counted now so back-to-back writes can't each pass against the old total
+    const projected = this.describe(workspaceId, {
+      bytesUsed: usage.bytesUsed + bytes,
+      fileCount: usage.fileCount + files
+    }, usage.measuredAt);
+    this.usage.set(workspaceId, projected);
+    return projected;
+  }
+
+  /**
+   * Tell the workspace's sockets when usage goes past the warning threshold
+   * or the quota itself, once per crossing
+   */
+  announce(usage) {
+    const level = usage.percent >= 100 ? 'exceeded' : usage.percent >= this.config.warnPercent ? 'warning' : null;
+    const previous = this.levels.get(usage.workspaceId) || null;
+    if (level === previous) {
+      return;
+    }
+
+    if (level) {
+      this.levels.set(usage.workspaceId, level);
+    } else {
+      this.levels.delete(usage.workspaceId);
+    }
+    if (!level || (level === 'warning' && previous === 'exceeded')) {
+      return;
+    }
+
+    // Required here so the websocket service can load this module itself
+    const webSocketService = require('./websocket');
+    webSocketService.sendToWorkspace(usage.workspaceId, 'workspace:quota-warning', { level, usage });
+  }
+
+  forget(workspaceId) {
+    workspaceId = String(workspaceId);
+    clearTimeout(this.pending.get(workspaceId));
+    this.pending.delete(workspaceId);
+    this.usage.delete(workspaceId);
+    this.levels.delete(workspaceId);
+    this.applied.delete(workspaceId);
+  }
+}
+
+module.exports = new WorkspaceQuota();
+module.exports.WorkspaceQuota = WorkspaceQuota;
+module.exports.WalkUsageProvider = WalkUsageProvider;
+module.exports.XfsQuotaProvider = XfsQuotaProvider;
\ No newline at end of file
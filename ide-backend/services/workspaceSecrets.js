@@ -0,0 +1,249 @@
+const crypto = require('crypto');
+const config = require('../config');
+const logger = require('../utils/logger');
+const programInput = require('../utils/programInput');
+
+const secretError = (code, message) => {
+  const error = new Error(message);
+  error.code = code;
+  return error;
+};
+
+/**
+ * Secret repositories. Both store encrypted entries only and implement:
+ *
+ *   upsert(entry) -> true if it replaced an existing secret
+ *   list(workspaceId) -> [entry] by name
+ *   remove(workspaceId, name) -> boolean
+ */
+class MongoSecretRepository {
+  constructor() {
+    // Loaded lazily so the memory store works without a database
+    this.model = require('../models/WorkspaceSecret');
+  }
+
+  async upsert(entry) {
+    const { workspaceId, name, ...fields } = entry;
+    const result = await this.model.updateOne({ workspaceId, name }, { $set: fields }, { upsert: true });
+    return result.upsertedCount === 0;
+  }
+
+  async list(workspaceId) {
+    return this.model.find({ workspaceId }).sort({ name: 1 }).lean();
+  }
+
+  async remove(workspaceId, name) {
+    const result = await this.model.deleteOne({ workspaceId, name });
+    return result.deletedCount > 0;
+  }
+}
+
+class MemorySecretRepository {
+  constructor() {
+    this.entries = new Map(); // `${workspaceId}/${name}` -> entry
+  }
+
+  async upsert(entry) {
+    const key = `${entry.workspaceId}/${entry.name}`;
+    const existing = this.entries.get(key);
+    const now = new Date();
+    this.entries.set(key, { ...entry, createdAt: existing ? existing.createdAt : now, updatedAt: now });
+    return Boolean(existing);
+  }
+
+  async list(workspaceId) {
+    return [...this.entries.values()]
+      .filter(entry => entry.workspaceId === workspaceId)
+      .sort((a, b) => a.name.localeCompare(b.name))
+      .map(entry => ({ ...entry }));
+  }
+
+  async remove(workspaceId, name) {
+    return this.entries.delete(`${workspaceId}/${name}`);
+  }
+}
+
+/**
+ * Workspace secrets: values encrypted with AES-256-GCM under the server's
+ * key, bound to their workspace and name so a ciphertext can't be moved to
+ * another slot. Values only leave this service decrypted for an execution
+ * (forExecution), which reads the store every time, so a deleted or
+ * changed secret applies to the next run without any cache to expire.
+ */
+class WorkspaceSecrets {
+  constructor() {
+    this.config = { ...config.workspaceSecrets };
+    this.repository = null;
+    this.key = null;
+  }
+
+  getRepository() {
+    if (!this.repository) {
+      this.repository = this.config.store === 'memory'
+        ? new MemorySecretRepository()
+        : new MongoSecretRepository();
+    }
+    return this.repository;
+  }
+
+  setRepository(repository) {
+    this.repository = repository;
+  }
+
+  isEnabled() {
+    return Boolean(this.config.key);
+  }
+
+  getKey() {
+    if (!this.isEnabled()) {
+      throw secretError('SECRETS_DISABLED', 'Workspace secrets are not configured on this server');
+    }
+    if (!this.key || this.key.source !== this.config.key) {
+      const encoding = /^[0-9a-f]{64}$/i.test(this.config.key) ? 'hex' : 'base64';
+      const key = Buffer.from(this.config.key, encoding);
+      if (key.length !== 32) {
+        throw secretError('SECRETS_DISABLED', 'WORKSPACE_SECRETS_KEY must be 32 bytes (hex or base64)');
+      }
+      this.key = { source: this.config.key, value: key };
+    }
+    return this.key.value;
+  }
+
+  encrypt(workspaceId, name, value) {
+    const iv = crypto.randomBytes(12);
+    const cipher = crypto.createCipheriv('aes-256-gcm', this.getKey(), iv);
+    cipher.setAAD(Buffer.from(`${workspaceId}/${name}`));
+    const ciphertext = Buffer.concat([cipher.update(value, 'utf8'), cipher.final()]);
+
+    return {
+      iv: iv.toString('base64'),
+      ciphertext: ciphertext.toString('base64'),
+      tag: cipher.getAuthTag().toString('base64')
+    };
+  }
+
+  decrypt(entry) {
+    const decipher = crypto.createDecipheriv('aes-256-gcm', this.getKey(), Buffer.from(entry.iv, 'base64'));
+    decipher.setAAD(Buffer.from(`${entry.workspaceId}/${entry.name}`));
+    decipher.setAuthTag(Buffer.from(entry.tag, 'base64'));
+    return Buffer.concat([decipher.update(Buffer.from(entry.ciphertext, 'base64')), decipher.final()]).toString('utf8');
+  }
+
+  /**
+   * Problems with a secret name and value, checked before anything is stored
+   * @returns {Array<string>} Error messages, empty when valid
+   */
+  validate(name, value) {
+    const errors = [];
+    if (!programInput.isValidName(name)) {
+      errors.push(`Invalid secret name "${name}": use letters, digits and underscores, not starting with a digit`);
+    } else if (programInput.isReservedName(name)) {
+      errors.push(`${name} is reserved by the sandbox and can't be used as a secret name`);
+    }
+
+    if (typeof value !== 'string' || value.length === 0) {
+      errors.push('value must be a non-empty string');
+    } else if (value.includes('\0')) {
+      errors.push('value must not contain NUL bytes');
+    } else if (Buffer.byteLength(value, 'utf8') > this.config.maxValueBytes) {
+      errors.push(`value exceeds the size limit of ${this.config.maxValueBytes} bytes`);
+    }
+    return errors;
+  }
+
+  /**
+   * Store or replace a secret
+   * @returns {Object} { name, created, updatedAt }
+   */
+  async set(workspaceId, name, value, userId) {
+    const errors = this.validate(name, value);
+    if (errors.length > 0) {
+      throw secretError('INVALID_SECRET', errors.join('; '));
+    }
+
+    const repository = this.getRepository();
+    const entries = await repository.list(workspaceId);
+    if (!entries.some(entry => entry.name === name) && entries.length >= this.config.maxPerWorkspace) {
+      throw secretError('SECRET_LIMIT', `A workspace can have at most ${this.config.maxPerWorkspace} secrets`);
+    }
+
+    const replaced = await repository.upsert({
+      workspaceId,
+      name,
+      ...this.encrypt(workspaceId, name, value),
+      updatedBy: userId
+    });
+
+    // Never the value
+    logger.info(`Secret ${name} ${replaced ? 'updated' : 'created'} in workspace ${workspaceId}`, { userId });
+    return { name, created: !replaced, updatedAt: new Date() };
+  }
+
+  /**
+   * Names and timestamps of a workspace's secrets, never their values
+   */
+  async list(workspaceId) {
+    const entries = await this.getRepository().list(workspaceId);
+    return entries.map(entry => ({
+      name: entry.name,
+      createdAt: entry.createdAt || null,
+      updatedAt: entry.updatedAt || null,
+      updatedBy: entry.updatedBy || null
+    }));
+  }
+
+  /**
+   * @returns {boolean} false if there was no such secret
+   */
+  async remove(workspaceId, name, userId) {
+    const removed = await this.getRepository().remove(workspaceId, name);
+    if (removed) {
+      logger.info(`Secret ${name} deleted from workspace ${workspaceId}`, { userId });
+    }
+    return removed;
+  }
+
+  /**
+   * Check that `userId` may run code with the workspace's secrets, which
+   * takes execute permission (editors and owners)
+   */
+  async authorize(workspaceId, userId) {
+    if (!this.isEnabled()) {
+      throw secretError('SECRETS_DISABLED', 'Workspace secrets are not configured on this server');
+    }
+
+    // Loaded lazily so the memory store works without a database
+    const Workspace = require('../models/Workspace');
+    const workspace = workspaceId ? await Workspace.findById(workspaceId) : null;
+    if (!workspace || !workspace.hasPermission(userId, 'execute')) {
+      throw secretError('ACCESS_DENIED', 'Workspace not found or access denied');
+    }
+  }
+
+  /**
+   * Decrypted secrets to inject into one execution, as { NAME: value }.
+   * Called right before the program starts, so queued runs see changes
+   * made while they waited. Entries that fail to decrypt (a rotated key)
+   * are skipped and logged.
+   */
+  async forExecution(workspaceId, userId) {
+    await this.authorize(workspaceId, userId);
+
+    const secrets = {};
+    for (const entry of await this.getRepository().list(workspaceId)) {
+      try {
+        secrets[entry.name] = this.decrypt(entry);
+      } catch (error) {
+        if (error.code === 'SECRETS_DISABLED') {
+          throw error;
+        }
+        logger.warn(`Failed to decrypt secret ${entry.name} of workspace ${workspaceId}:`, error.message);
+      }
+    }
+    return secrets;
+  }
+}
+
+module.exports = new WorkspaceSecrets();
+module.exports.MongoSecretRepository = MongoSecretRepository;
+module.exports.MemorySecretRepository = MemorySecretRepository;
\ No newline at end of file
@@ -0,0 +1,351 @@
+const fs = require('fs');
+const path = require('path');
+const config = require('../config');
+const logger = require('../utils/logger');
+const fileSystem = require('../utils/fileSystem');
+
+const toRelative = (name) => name.split(path.sep).join('/');
+const isWithin = (itemPath, root) => itemPath === root || itemPath.startsWith(`${root}/`);
+
+/**
+ * Tells sockets subscribed to a workspace which of its files changed on the
+ * server, e.g. output an execution wrote into a mounted workspace. Changes
+ * are collected for batchWindowMs and delivered as one file:changes event:
+ *   { workspaceId, changes: [{ event: 'created'|'modified'|'deleted', path, requestId? }] }
+ * `requestId` is set when the change came through the file API within a
+ * request, so clients can skip the echo of their own writes.
+ *
+ * One watch per workspace, started by the first subscriber and closed when
+ * the last one leaves. Changes are found by comparing against a snapshot
+ * (mtime and size per path), so repeated events for a file collapse into one.
+ */
+class WorkspaceWatcher {
+  constructor() {
+    this.config = { ...config.workspaceWatcher };
+    this.watches = new Map(); // workspaceId -> watch
+    fileSystem.changes.on('write', (change) => this.expectChange(change));
+  }
+
+  isEnabled() {
+    return this.config.enabled;
+  }
+
+  /**
+   * @returns {Object} { mode } - 'fsnotify', or 'diff' when the directory can't be watched
+   */
+  async subscribe(workspaceId, socket) {
+    const watch = this.watches.get(workspaceId) || this.startWatch(workspaceId);
+    watch.subscribers.add(socket);
+    await watch.ready;
+    return { mode: watch.mode };
+  }
+
+  unsubscribe(workspaceId, socket) {
+    const watch = this.watches.get(workspaceId);
+    if (!watch) {
+      return;
+    }
+
+    watch.subscribers.delete(socket);
+    if (watch.subscribers.size === 0) {
+      this.stopWatch(watch);
+    }
+  }
+
+  /**
+   * Drop a disconnected socket from every watch
+   */
+  unsubscribeAll(socket) {
+    for (const watch of Array.from(this.watches.values())) {
+      if (watch.subscribers.has(socket)) {
+        this.unsubscribe(watch.workspaceId, socket);
+      }
+    }
+  }
+
+  startWatch(workspaceId) {
+    const watch = {
+      workspaceId,
+      mode: this.config.mode,
+      subscribers: new Set(),
+      snapshot: new Map(), // relative path -> { mtimeMs, size, directory }
+      dirty: new Set(), // paths with events in the current batch window
+      fullScan: false,
+      expected: [], // { path, requestId, expiresAt } from file API writes
+      watcher: null,
+      timer: null,
+      stopped: false
+    };
+    this.watches.set(workspaceId, watch);
+
+    watch.ready = this.scan(workspaceId).then((snapshot) => {
+      watch.snapshot = snapshot;
+      if (watch.mode === 'fsnotify' && !watch.stopped) {
+        this.startNotify(watch);
+      }
+    });
+    return watch;
+  }
+
+  startNotify(watch) {
+    try {
+      watch.watcher = fs.watch(fileSystem.getWorkspacePath(watch.workspaceId), { recursive: true }, (eventType, filename) => {
+        this.queue(watch, filename ? toRelative(filename.toString()) : null);
+      });
+      watch.watcher.on('error', (error) => this.fallBackToDiff(watch, error));
+    } catch (error) {
+      this.fallBackToDiff(watch, error);
+    }
+  }
+
+  fallBackToDiff(watch, error) {
+    logger.warn(`Cannot watch workspace ${watch.workspaceId}, rescanning after executions instead:`, error.message);
+    if (watch.watcher) {
+      watch.watcher.close();
+      watch.watcher = null;
+    }
+    watch.mode = 'diff';
+  }
+
+  stopWatch(watch) {
+    watch.stopped = true;
+    clearTimeout(watch.timer);
+    if (watch.watcher) {
+      watch.watcher.close();
+    }
+    this.watches.delete(watch.workspaceId);
+  }
+
+  /**
+   * Add a path to the batch window, opening one if none is pending.
+   * A null path (the OS didn't say which) rescans the whole workspace.
+   */
+  queue(watch, itemPath) {
+    if (itemPath === null) {
+      watch.fullScan = true;
+    } else {
+      watch.dirty.add(itemPath);
+    }
+
+    if (!watch.timer) {
+      watch.timer = setTimeout(() => {
+        watch.timer = null;
+        this.flush(watch).catch(error =>
+          logger.error(`Failed to report changes in workspace ${watch.workspaceId}:`, error)
+        );
+      }, this.config.batchWindowMs);
+    }
+  }
+
+  async flush(watch) {
+    let changes;
+    if (watch.fullScan) {
+      watch.fullScan = false;
+      watch.dirty.clear();
+      changes = await this.rescan(watch);
+    } else {
+      const paths = Array.from(watch.dirty).sort();
+      watch.dirty.clear();
+      changes = await this.diffPaths(watch, paths);
+    }
+
+    if (!watch.stopped) {
+      this.deliver(watch, changes);
+    }
+  }
+
+  /**
+   * In diff mode, report what an execution that mounted the workspace changed
+   */
+  async executionFinished(workspaceId) {
+    const watch = this.watches.get(workspaceId);
+    if (!watch) {
+      return;
+    }
+
+    await watch.ready;
+    if (watch.mode === 'diff' && !watch.stopped) {
+      this.deliver(watch, await this.rescan(watch));
+    }
+  }
+
+  async rescan(watch) {
+    const next = await this.scan(watch.workspaceId);
+    const changes = this.diffSnapshots(watch.snapshot, next);
+    watch.snapshot = next;
+    return changes;
+  }
+
+  /**
+   * Compare the snapshot with the current state of a few paths (parents first)
+   */
+  async diffPaths(watch, paths) {
+    const changes = [];
+
+    for (const itemPath of paths) {
+      const stats = await this.statEntry(watch.workspaceId, itemPath);
+      const previous = watch.snapshot.get(itemPath);
+
+      if (!stats) {
+        if (previous) {
+          // A deleted directory takes its contents along; one event covers them
+          for (const entry of Array.from(watch.snapshot.keys())) {
+            if (isWithin(entry, itemPath)) {
+              watch.snapshot.delete(entry);
+            }
+          }
+          changes.push({ event: 'deleted', path: itemPath });
+        }
+      } else if (!previous) {
+        watch.snapshot.set(itemPath, stats);
+        changes.push({ event: 'created', path: itemPath });
+
+        // Files created before the new directory was watched produce no events
+        if (stats.directory) {
+          const contents = await this.scan(watch.workspaceId, itemPath);
+          for (const [entry, entryStats] of contents) {
+            if (!watch.snapshot.has(entry)) {
+              watch.snapshot.set(entry, entryStats);
+              changes.push({ event: 'created', path: entry });
+            }
+          }
+        }
+      } else if (!stats.directory && (stats.mtimeMs !== previous.mtimeMs || stats.size !== previous.size)) {
+        watch.snapshot.set(itemPath, stats);
+        changes.push({ event: 'modified', path: itemPath });
+      }
+    }
+
+    return changes;
+  }
+
+  diffSnapshots(previous, next) {
+    const changes = [];
+    const deleted = [];
+
+    for (const [itemPath, stats] of next) {
+      const before = previous.get(itemPath);
+      if (!before) {
+        changes.push({ event: 'created', path: itemPath });
+      } else if (!stats.directory && (stats.mtimeMs !== before.mtimeMs || stats.size !== before.size)) {
+        changes.push({ event: 'modified', path: itemPath });
+      }
+    }
+
+    for (const itemPath of Array.from(previous.keys()).sort()) {
+      if (!next.has(itemPath) && !deleted.some(root => isWithin(itemPath, root))) {
+        deleted.push(itemPath);
+        changes.push({ event: 'deleted', path: itemPath });
+      }
+    }
+
+    return changes.sort((a, b) => a.path.localeCompare(b.path));
+  }
+
+  async statEntry(workspaceId, itemPath) {
+    try {
+      const stats = await fs.promises.lstat(fileSystem.getFilePath(workspaceId, itemPath));
+      return { mtimeMs: stats.mtimeMs, size: stats.size, directory: stats.isDirectory() };
+    } catch (error) {
+      return null;
+    }
+  }
+
+  /**
+   * Snapshot of everything under `root` (the whole workspace by default),
+   * capped at maxEntries
+   */
+  async scan(workspaceId, root = '') {
+    const snapshot = new Map();
+    const workspacePath = fileSystem.getWorkspacePath(workspaceId);
+
+    const walk = async (relativeDir) => {
+      let items;
+      try {
+        items = await fs.promises.readdir(path.join(workspacePath, relativeDir), { withFileTypes: true });
+      } catch (error) {
+        return; // gone, or not created yet
+      }
+
+      for (const item of items) {
+        if (snapshot.size >= this.config.maxEntries) {
+          return;
+        }
+
+        const itemPath = relativeDir ? `${relativeDir}/${item.name}` : item.name;
+        const stats = await this.statEntry(workspaceId, itemPath);
+        if (!stats) {
+          continue;
+        }
+
+        snapshot.set(itemPath, stats);
+        if (stats.directory) {
+          await walk(itemPath);
+        }
+      }
+    };
+
+    await walk(root);
+    if (snapshot.size >= this.config.maxEntries) {
+      logger.warn(`Workspace ${workspaceId} has more than ${this.config.maxEntries} entries; changes past them are not reported`);
+    }
+    return snapshot;
+  }
+
+  /**
+   * Remember that a request is about to change `paths`, so the events it
+   * causes carry its ID
+   */
+  expectChange({ workspaceId, paths, requestId }) {
+    const watch = this.watches.get(workspaceId);
+    if (!watch || !requestId) {
+      return;
+    }
+
+    const now = Date.now();
+    watch.expected = watch.expected.filter(entry => entry.expiresAt > now);
+    for (const itemPath of paths) {
+      watch.expected.push({ path: itemPath, requestId, expiresAt: now + this.config.attributionMs });
+    }
+  }
+
+  /**
+   * The latest request that claimed `itemPath`, its contents (directory
+   * operations) or a parent it had to create
+   */
+  attribute(watch, itemPath) {
+    const now = Date.now();
+    for (let i = watch.expected.length - 1; i >= 0; i--) {
+      const entry = watch.expected[i];
+      if (entry.expiresAt > now && (isWithin(itemPath, entry.path) || isWithin(entry.path, itemPath))) {
+        return entry.requestId;
+      }
+    }
+    return null;
+  }
+
+  deliver(watch, changes) {
+    if (changes.length === 0) {
+      return;
+    }
+
+    const payload = {
+      workspaceId: watch.workspaceId,
+      changes: changes.map((change) => {
+        const requestId = this.attribute(watch, change.path);
+        return requestId ? { ...change, requestId } : change;
+      })
+    };
+    for (const socket of watch.subscribers) {
+      socket.emit('file:changes', payload);
+    }
+  }
+
+  shutdown() {
+    for (const watch of Array.from(this.watches.values())) {
+      this.stopWatch(watch);
+    }
+  }
+}
+
+module.exports = new WorkspaceWatcher();
\ No newline at end of file
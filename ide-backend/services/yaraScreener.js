@@ -0,0 +1,193 @@
+const logger = require('../utils/logger');
+const Screener = require('./screener');
+
+const { parseAction, compilePattern } = Screener;
+
+const tokenize = (condition) => {
+  const token = /\s*(\$\w+|\(|\)|,|\w+)/y;
+  const text = condition.trim();
+  const tokens = [];
+  while (token.lastIndex < text.length) {
+    const start = token.lastIndex;
+    const match = token.exec(text);
+    if (!match) {
+      throw new Error(`unexpected "${text.slice(start).trimStart()[0]}" in condition`);
+    }
+    tokens.push(match[1]);
+  }
+  return tokens;
+};
+
+/**
+ * Compile a condition to a function of the set of matched string names.
+ * Supports the boolean core of YARA conditions:
+ *   $name, not, and, or, parentheses, and "any | all | N of them | ($a, $b)"
+ */
+const compileCondition = (condition, names) => {
+  const tokens = tokenize(condition);
+  let position = 0;
+
+  const peek = () => tokens[position];
+  const next = () => tokens[position++];
+  const expect = (token) => {
+    if (next() !== token) {
+      throw new Error(`expected "${token}" in condition`);
+    }
+  };
+  const variable = (token) => {
+    if (!names.includes(token)) {
+      throw new Error(`condition uses undefined string ${token}`);
+    }
+    return token;
+  };
+
+  const set = () => {
+    if (peek() === 'them') {
+      next();
+      return names;
+    }
+    expect('(');
+    const members = [variable(next())];
+    while (peek() === ',') {
+      next();
+      members.push(variable(next()));
+    }
+    expect(')');
+    return members;
+  };
+
+  const primary = () => {
+    const token = next();
+    if (token === '(') {
+      const inner = or();
+      expect(')');
+      return inner;
+    }
+    if (token === 'any' || token === 'all' || /^\d+$/.test(token || '')) {
+      expect('of');
+      const members = set();
+      const needed = token === 'any' ? 1 : token === 'all' ? members.length : parseInt(token, 10);
+      return (matched) => members.filter(name => matched.has(name)).length >= needed;
+    }
+    if (token && token.startsWith('$')) {
+      const name = variable(token);
+      return (matched) => matched.has(name);
+    }
+    throw new Error(token ? `unexpected "${token}" in condition` : 'condition ends early');
+  };
+
+  const not = () => {
+    if (peek() === 'not') {
+      next();
+      const operand = not();
+      return (matched) => !operand(matched);
+    }
+    return primary();
+  };
+
+  const and = () => {
+    let left = not();
+    while (peek() === 'and') {
+      next();
+      const a = left;
+      const b = not();
+      left = (matched) => a(matched) && b(matched);
+    }
+    return left;
+  };
+
+  const or = () => {
+    let left = and();
+    while (peek() === 'or') {
+      next();
+      const a = left;
+      const b = and();
+      left = (matched) => a(matched) || b(matched);
+    }
+    return left;
+  };
+
+  const evaluate = or();
+  if (position < tokens.length) {
+    throw new Error(`unexpected "${peek()}" in condition`);
+  }
+  return evaluate;
+};
+
+/**
+ * YARA-style rules from the `yara` list of the rules file: named strings,
+ * each a literal or a /regex/flags, and a condition over which of them the
+ * source contains, e.g. "$wallet and ($pool or $algo)". Strings match
+ * anywhere in the submission, so a rule can tie together several files.
+ */
+class YaraScreener extends Screener {
+  constructor() {
+    super('yara');
+    this.rules = [];
+  }
+
+  load({ yara = [] } = {}) {
+    const loaded = [];
+    for (const definition of Array.isArray(yara) ? yara : []) {
+      try {
+        loaded.push(this.compile(definition));
+      } catch (error) {
+        logger.warn(`Skipping invalid yara screening rule ${definition && definition.id}: ${error.message}`);
+      }
+    }
+    this.rules = loaded;
+  }
+
+  compile(definition = {}) {
+    if (typeof definition.id !== 'string' || definition.id.length === 0) {
+      throw new Error('id is required');
+    }
+    const action = parseAction(definition.action);
+    if (!action) {
+      throw new Error('action must be flag or block');
+    }
+    if (!definition.strings || typeof definition.strings !== 'object' || Object.keys(definition.strings).length === 0) {
+      throw new Error('strings is required');
+    }
+    if (typeof definition.condition !== 'string') {
+      throw new Error('condition is required');
+    }
+
+    const strings = Object.entries(definition.strings).map(([name, value]) => {
+      if (!/^\$\w+$/.test(name) || typeof value !== 'string' || value.length === 0) {
+        throw new Error(`string ${name} must be named $name and be non-empty`);
+      }
+      const regex = /^\/(.+)\/([a-z]*)$/s.exec(value);
+      if (regex) {
+        const pattern = compilePattern(regex[1], regex[2]);
+        return { name, matches: (content) => pattern.test(content) };
+      }
+      return { name, matches: (content) => content.includes(value) };
+    });
+
+    const condition = compileCondition(definition.condition, strings.map(({ name }) => name));
+    return { id: definition.id, action, strings, condition };
+  }
+
+  check(sources) {
+    const found = [];
+    for (const rule of this.rules) {
+      const matched = new Set();
+      let path = null;
+      for (const { name, matches } of rule.strings) {
+        const source = sources.find(({ content }) => matches(content));
+        if (source) {
+          matched.add(name);
+          path = path || source.path;
+        }
+      }
+      if (rule.condition(matched)) {
+        found.push({ rule: rule.id, action: rule.action, path });
+      }
+    }
+    return found;
+  }
+}
+
+module.exports = YaraScreener;
+module.exports.compileCondition = compileCondition;
\ No newline at end of file
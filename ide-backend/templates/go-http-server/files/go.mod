@@ -0,0 +1,3 @@
+module {{ modulePath }}
+
+go 1.21
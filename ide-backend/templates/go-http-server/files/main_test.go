@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHelloHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/hello?name=gopher", nil)
+	rec := httptest.NewRecorder()
+
+	helloHandler(rec, req)
+
+	if got, want := rec.Body.String(), "Hello, gopher!\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,10 @@
+#!/usr/bin/env node
+const { parseArgs } = require('util');
+
+const { values } = parseArgs({
+  options: {
+    name: { type: 'string', short: 'n', default: 'world' }
+  }
+});
+
+console.log(`Hello, ${values.name}!`);
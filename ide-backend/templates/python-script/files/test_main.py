@@ -0,0 +1,5 @@
+from main import greet
+
+
+def test_greet():
+    assert greet("python") == "Hello, python!"
@@ -0,0 +1,138 @@
+const path = require('path');
+const grpc = require('@grpc/grpc-js');
+const protoLoader = require('@grpc/proto-loader');
+const User = require('../models/User');
+const dockerService = require('../services/dockerService');
+const { GrpcServer } = require('../services/grpcServer');
+
+// Needs a real Docker daemon with the Go image: DOCKER_INTEGRATION=true npm test
+const describeDocker = process.env.DOCKER_INTEGRATION === 'true' ? describe : describe.skip;
+
+const HELLO_GO = 'package main\n\nimport "fmt"\n\nfunc main() {\n\tfmt.Println("hello from go")\n}\n';
+
+describeDocker('gRPC execution API (Docker)', () => {
+  let server;
+  let client;
+
+  const withToken = (token = 'firebase-test-token-grpc-user') => {
+    const metadata = new grpc.Metadata();
+    metadata.set('authorization', `Bearer ${token}`);
+    return metadata;
+  };
+
+  // Every response of one Execute call, and the status it ended with
+  const execute = (start, metadata = withToken()) => new Promise((resolve) => {
+    const frames = [];
+    const call = client.Execute(metadata);
+    call.on('data', frame => frames.push(frame));
+    call.on('error', error => resolve({ frames, error }));
+    call.on('end', () => resolve({ frames, error: null }));
+    call.write({ start });
+    call.end();
+  });
+
+  beforeAll(async () => {
+    await dockerService.initialize();
+
+    server = new GrpcServer();
+    server.config = { ...server.config, enabled: true, host: '127.0.0.1', port: 0 };
+    const port = await server.start();
+
+    const definition = protoLoader.loadSync(path.join(__dirname, '..', 'proto', 'execution.proto'), {
+      keepCase: true, longs: Number, enums: String, defaults: true, oneofs: true
+    });
+    const { ExecutionService } = grpc.loadPackageDefinition(definition).studio.execution.v1;
+    client = new ExecutionService(`127.0.0.1:${port}`, grpc.credentials.createInsecure());
+  }, 120000);
+
+  beforeEach(async () => {
+    await User.create({ firebaseUid: 'grpc-user', email: 'grpc@example.com', name: 'gRPC User' });
+  });
+
+  afterAll(async () => {
+    if (client) {
+      client.close();
+    }
+    if (server) {
+      await server.shutdown(1000);
+    }
+  });
+
+  it('should run a Go hello world and stream started, output and exit in order', async () => {
+    const { frames, error } = await execute({ runtime: 'go', code: HELLO_GO, filename: 'main' });
+
+    expect(error).toBeNull();
+    const events = frames.map(frame => frame.event).filter(event => event !== 'queued');
+    expect(events[0]).toBe('started');
+    expect(events[events.length - 1]).toBe('exit');
+    expect(events.slice(1, -1).every(event => event === 'output')).toBe(true);
+
+    // One execution ID throughout, and seq increasing across the output frames
+    expect(new Set(frames.map(frame => frame.execution_id)).size).toBe(1);
+    const outputs = frames.filter(frame => frame.event === 'output').map(frame => frame.output);
+    const seqs = outputs.map(output => output.seq);
+    expect(seqs).toEqual([...seqs].sort((a, b) => a - b));
+    expect(new Set(seqs).size).toBe(seqs.length);
+
+    const stdout = outputs.filter(output => output.stream === 'STDOUT').map(output => output.data.toString()).join('');
+    expect(stdout).toBe('hello from go\n');
+
+    const { exit } = frames[frames.length - 1];
+    expect(exit.status).toBe('ok');
+    expect(exit.has_exit_code).toBe(true);
+    expect(exit.exit_code).toBe(0);
+  }, 180000);
+
+  it('should feed stdin frames to an interactive run', async () => {
+    const code = 'package main\n\nimport (\n\t"bufio"\n\t"fmt"\n\t"os"\n)\n\nfunc main() {\n\tline, _ := bufio.NewReader(os.Stdin).ReadString(\'\\n\')\n\tfmt.Print("got " + line)\n}\n';
+    const frames = await new Promise((resolve, reject) => {
+      const received = [];
+      const call = client.Execute(withToken());
+      call.on('data', (frame) => {
+        received.push(frame);
+        if (frame.event === 'started') {
+          call.write({ stdin: { data: Buffer.from('ping\n'), eof: true } });
+          call.end();
+        }
+      });
+      call.on('error', reject);
+      call.on('end', () => resolve(received));
+      call.write({ start: { runtime: 'go', code, interactive: true } });
+    });
+
+    const stdout = frames.filter(frame => frame.event === 'output' && frame.output.stream === 'STDOUT')
+      .map(frame => frame.output.data.toString()).join('');
+    expect(stdout).toBe('got ping\n');
+    expect(frames[frames.length - 1].event).toBe('exit');
+  }, 180000);
+
+  it('should refuse calls without a valid token', async () => {
+    const { frames, error } = await execute({ runtime: 'go', code: HELLO_GO }, new grpc.Metadata());
+
+    expect(frames).toEqual([]);
+    expect(error.code).toBe(grpc.status.UNAUTHENTICATED);
+  });
+
+  it('should reject an unknown runtime with INVALID_ARGUMENT', async () => {
+    const { error } = await execute({ runtime: 'cobol', code: 'DISPLAY "hi"' });
+
+    expect(error.code).toBe(grpc.status.INVALID_ARGUMENT);
+    expect(error.metadata.get('x-error-code')).toEqual(['VALIDATION_FAILED']);
+  });
+
+  it('should list the runtimes', async () => {
+    const response = await new Promise((resolve, reject) => {
+      client.ListRuntimes({}, withToken(), (error, result) => (error ? reject(error) : resolve(result)));
+    });
+
+    expect(response.runtimes.map(runtime => runtime.name)).toContain('go');
+  });
+
+  it('should answer CancelExecution for an unknown execution with NOT_FOUND', async () => {
+    const error = await new Promise((resolve) => {
+      client.CancelExecution({ execution_id: 'missing' }, withToken(), error => resolve(error));
+    });
+
+    expect(error.code).toBe(grpc.status.NOT_FOUND);
+  });
+});
\ No newline at end of file
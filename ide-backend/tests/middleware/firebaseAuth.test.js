@@ -0,0 +1,49 @@
+const { requireAdmin, isAdmin } = require('../../middleware/firebaseAuth');
+const config = require('../../config');
+
+describe('requireAdmin', () => {
+  let originalUids;
+
+  const run = (user) => {
+    const res = {};
+    res.status = jest.fn(() => res);
+    res.json = jest.fn(() => res);
+    const next = jest.fn();
+    requireAdmin({ user }, res, next);
+    return { res, next };
+  };
+
+  beforeEach(() => {
+    originalUids = config.admin.uids;
+    config.admin.uids = ['operator-uid'];
+  });
+
+  afterEach(() => {
+    config.admin.uids = originalUids;
+  });
+
+  it('should refuse users whose email only looks like an admin\'s', () => {
+    for (const email of ['notadmin@example.com', 'admin@yourdomain.com', 'someone@yourdomain.com']) {
+      const { res, next } = run({ firebaseUid: 'user-uid', email, role: 'user' });
+
+      expect(next).not.toHaveBeenCalled();
+      expect(res.status).toHaveBeenCalledWith(403);
+    }
+  });
+
+  it('should refuse a self-declared isAdmin flag', () => {
+    expect(isAdmin({ firebaseUid: 'user-uid', email: 'user@example.com', isAdmin: true })).toBe(false);
+  });
+
+  it('should let in configured UIDs and users with the admin role', () => {
+    expect(run({ firebaseUid: 'operator-uid', email: 'ops@example.com', role: 'user' }).next).toHaveBeenCalled();
+    expect(run({ firebaseUid: 'other-uid', email: 'other@example.com', role: 'admin' }).next).toHaveBeenCalled();
+  });
+
+  it('should answer 401 without a user', () => {
+    const { res, next } = run(undefined);
+
+    expect(next).not.toHaveBeenCalled();
+    expect(res.status).toHaveBeenCalledWith(401);
+  });
+});
\ No newline at end of file
@@ -0,0 +1,94 @@
+const { rateLimit } = require('../../middleware/rateLimiter');
+const rateLimitStore = require('../../services/rateLimitStore');
+const config = require('../../config');
+const screening = require('../../services/screening');
+
+describe('rateLimit middleware', () => {
+  const createRes = () => {
+    const res = { headers: {} };
+    res.set = jest.fn((name, value) => { res.headers[name] = value; return res; });
+    res.status = jest.fn(() => res);
+    res.json = jest.fn(() => res);
+    return res;
+  };
+
+  const run = async (middleware, req) => {
+    const res = createRes();
+    const next = jest.fn();
+    await middleware(req, res, next);
+    return { res, next };
+  };
+
+  beforeEach(() => {
+    rateLimitStore.setStore(new rateLimitStore.MemoryRateLimitStore());
+  });
+
+  it('should limit authenticated users by user ID and set the rate limit headers', async () => {
+    const limiter = rateLimit('execute');
+    const { capacity } = config.tokenBuckets.buckets.execute.user;
+
+    // Same user from two addresses shares one bucket
+    for (let i = 0; i < capacity; i++) {
+      const { next } = await run(limiter, { user: { id: 'user-1' }, ip: i % 2 ? '10.0.0.1' : '10.0.0.2' });
+      expect(next).toHaveBeenCalled();
+    }
+
+    const { res, next } = await run(limiter, { user: { id: 'user-1' }, ip: '10.0.0.3', requestId: 'req-1' });
+
+    expect(next).not.toHaveBeenCalled();
+    expect(res.status).toHaveBeenCalledWith(429);
+    expect(res.headers['X-RateLimit-Limit']).toBe(String(capacity));
+    expect(res.headers['X-RateLimit-Remaining']).toBe('0');
+    expect(Number(res.headers['X-RateLimit-Reset'])).toBeGreaterThan(Date.now() / 1000);
+    expect(Number(res.headers['Retry-After'])).toBeGreaterThan(0);
+    expect(res.json).toHaveBeenCalledWith(expect.objectContaining({ error: 'Too many requests', requestId: 'req-1' }));
+  });
+
+  it('should give unauthenticated clients the smaller per-IP bucket', async () => {
+    const limiter = rateLimit('execute');
+    const { capacity } = config.tokenBuckets.buckets.execute.anonymous;
+
+    for (let i = 0; i < capacity; i++) {
+      await run(limiter, { ip: '10.0.0.1' });
+    }
+
+    expect((await run(limiter, { ip: '10.0.0.1' })).res.status).toHaveBeenCalledWith(429);
+    expect((await run(limiter, { ip: '10.0.0.2' })).next).toHaveBeenCalled();
+    expect((await run(limiter, { user: { id: 'user-1' }, ip: '10.0.0.1' })).next).toHaveBeenCalled();
+  });
+
+  it('should keep cheap and expensive endpoints in separate buckets', async () => {
+    const execute = rateLimit('execute');
+    const read = rateLimit('read');
+    const { capacity } = config.tokenBuckets.buckets.execute.anonymous;
+
+    for (let i = 0; i <= capacity; i++) {
+      await run(execute, { ip: '10.0.0.1' });
+    }
+
+    expect((await run(read, { ip: '10.0.0.1' })).next).toHaveBeenCalled();
+  });
+
+  it('should charge users with an abuse score more per request', async () => {
+    const limiter = rateLimit('execute');
+    const { capacity } = config.tokenBuckets.buckets.execute.user;
+    jest.spyOn(screening, 'costMultiplier').mockReturnValue(capacity / 2);
+
+    expect((await run(limiter, { user: { id: 'user-1' }, ip: '10.0.0.1' })).next).toHaveBeenCalled();
+    expect((await run(limiter, { user: { id: 'user-1' }, ip: '10.0.0.1' })).next).toHaveBeenCalled();
+    expect((await run(limiter, { user: { id: 'user-1' }, ip: '10.0.0.1' })).res.status).toHaveBeenCalledWith(429);
+    expect(screening.costMultiplier).toHaveBeenCalledWith('user-1', 'execute');
+
+    screening.costMultiplier.mockRestore();
+  });
+
+  it('should let requests through when the store fails', async () => {
+    rateLimitStore.setStore({ take: jest.fn().mockRejectedValue(new Error('ECONNREFUSED')) });
+
+    expect((await run(rateLimit('read'), { ip: '10.0.0.1' })).next).toHaveBeenCalled();
+  });
+
+  it('should reject unknown buckets when the route is defined', () => {
+    expect(() => rateLimit('nope')).toThrow('Unknown rate limit bucket: nope');
+  });
+});
\ No newline at end of file
@@ -1,6 +1,7 @@
 const request = require('supertest');
 const app = require('../../server');
 const dockerService = require('../../services/dockerService');
+const executionService = require('../../services/executionService');
 const admin = require('firebase-admin');
 
 // Mock dependencies
@@ -50,7 +51,13 @@ describe('Execution Routes', () => {
       expect(response.status).toBe(201);
       expect(response.body.success).toBe(true);
       expect(response.body.container).toEqual(mockContainer);
-      expect(dockerService.createContainer).toHaveBeenCalledWith('node', 'workspace-123', 'test-user-id');
+      expect(dockerService.createContainer).toHaveBeenCalledWith('node', 'workspace-123', 'test-user-id', {
+        limits: expect.objectContaining({
+          cpuQuota: 50000,
+          memoryBytes: 256 * 1024 * 1024,
+          pidsLimit: 64
+        })
+      });
     });
 
     it('should return 400 for invalid language', async () => {
@@ -270,6 +277,108 @@ describe('Execution Routes', () => {
     });
   });
 
+  describe('POST /api/execution/execute', () => {
+    const FakeSandbox = require('../../services/fakeSandbox');
+    const sandboxes = require('../../services/sandboxes');
+    let fake;
+
+    beforeEach(() => {
+      dockerService.isAvailable = true;
+      fake = sandboxes.register(new FakeSandbox());
+    });
+
+    afterEach(() => {
+      sandboxes.providers.delete('fake');
+    });
+
+    it('should run the code with the provider that created the container', async () => {
+      const { containerId } = await fake.create('python', 'workspace-123', 'test-user-id');
+
+      const pending = request(app)
+        .post('/api/execution/execute')
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ containerId, code: 'print(1)' })
+        .then(response => response);
+
+      while (fake.executions.length === 0) {
+        await new Promise(resolve => setTimeout(resolve, 10));
+      }
+      const [execution] = fake.executions;
+      fake.output(execution, 'stdout', '1\n');
+      fake.exit(execution, 0);
+
+      const response = await pending;
+      expect(response.status).toBe(200);
+      expect(response.text).toContain('1\n');
+      expect(execution).toMatchObject({ containerId, code: 'print(1)', filename: 'main' });
+      expect(dockerService.getContainerInfo).not.toHaveBeenCalled();
+      expect(dockerService.executeCode).not.toHaveBeenCalled();
+    });
+
+    it('should check /judge ownership with the provider that created the container', async () => {
+      const { containerId } = await fake.create('python', 'workspace-123', 'other-user');
+
+      const response = await request(app)
+        .post('/api/execution/judge')
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ containerId, code: 'print(input())', cases: [{ stdin: '1\n', expected_stdout: '1\n' }] });
+
+      expect(response.status).toBe(403);
+      expect(response.body.code).toBe('ACCESS_DENIED');
+      expect(dockerService.getContainerInfo).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('DELETE /api/executions/:id', () => {
+    beforeEach(() => {
+      executionService.activeExecutions.clear();
+      executionService.executionHistory.clear();
+    });
+
+    it('should cancel a running execution', async () => {
+      const execution = { stream: { destroy: jest.fn() }, exec: {}, containerId: 'container-123' };
+      dockerService.terminateExecution.mockResolvedValue();
+      executionService.registerExecution({
+        id: 'exec-1',
+        userId: 'test-user-id',
+        containerId: 'container-123',
+        startTime: new Date(),
+        status: 'running',
+        execution
+      });
+
+      const response = await request(app)
+        .delete('/api/executions/exec-1')
+        .set('Authorization', `Bearer ${authToken}`);
+
+      expect(response.status).toBe(200);
+      expect(response.body).toMatchObject({ success: true, executionId: 'exec-1', event: 'cancelled' });
+      expect(dockerService.terminateExecution).toHaveBeenCalledWith(execution, 2000);
+    });
+
+    it('should return 404 for finished executions', async () => {
+      executionService.executionHistory.set('exec-2', { id: 'exec-2', userId: 'test-user-id', status: 'completed' });
+
+      const response = await request(app)
+        .delete('/api/executions/exec-2')
+        .set('Authorization', `Bearer ${authToken}`);
+
+      expect(response.status).toBe(404);
+      expect(dockerService.terminateExecution).not.toHaveBeenCalled();
+    });
+
+    it('should return 404 for executions owned by other users', async () => {
+      executionService.registerExecution({ id: 'exec-3', userId: 'other-user', status: 'running' });
+
+      const response = await request(app)
+        .delete('/api/executions/exec-3')
+        .set('Authorization', `Bearer ${authToken}`);
+
+      expect(response.status).toBe(404);
+      expect(executionService.activeExecutions.has('exec-3')).toBe(true);
+    });
+  });
+
   describe('Authentication', () => {
     it('should return 401 without auth token', async () => {
       const response = await request(app)
@@ -0,0 +1,59 @@
+const http = require('http');
+const dockerService = require('../services/dockerService');
+
+// Needs a real Docker daemon: DOCKER_INTEGRATION=true npm test
+const describeDocker = process.env.DOCKER_INTEGRATION === 'true' ? describe : describe.skip;
+
+describeDocker('Sandbox network isolation (Docker)', () => {
+  let api;
+  let apiPort;
+  let containerId;
+
+  const run = (code) => new Promise(async (resolve, reject) => {
+    try {
+      const { stream } = await dockerService.executeCode(containerId, code, 'main');
+      let output = '';
+      stream.on('data', chunk => { output += chunk.toString(); });
+      stream.on('end', () => resolve(output));
+      stream.on('error', reject);
+    } catch (error) {
+      reject(error);
+    }
+  });
+
+  beforeAll(async () => {
+    // Stand-in for the backend API, listening on every host interface
+    api = http.createServer((req, res) => res.end('reachable'));
+    await new Promise(resolve => api.listen(0, '0.0.0.0', resolve));
+    apiPort = api.address().port;
+
+    await dockerService.initialize();
+    const container = await dockerService.createContainer('node', 'network-test', 'network-test-user');
+    containerId = container.containerId;
+  }, 120000);
+
+  afterAll(async () => {
+    if (containerId) {
+      await dockerService.stopContainer(containerId);
+    }
+    await new Promise(resolve => api.close(resolve));
+  });
+
+  it('should not reach the backend API from a default-policy container', async () => {
+    const output = await run(`
+      const http = require('http');
+      const targets = ['host.docker.internal', '172.17.0.1'];
+      let pending = targets.length;
+      for (const host of targets) {
+        const req = http.get({ host, port: ${apiPort}, timeout: 2000 }, () => console.log('REACHED ' + host));
+        req.on('timeout', () => req.destroy(new Error('timeout')));
+        req.on('error', () => console.log('BLOCKED ' + host));
+        req.on('close', () => { if (--pending === 0) process.exit(0); });
+      }
+    `);
+
+    expect(output).not.toContain('REACHED');
+    expect(output).toContain('BLOCKED host.docker.internal');
+    expect(output).toContain('BLOCKED 172.17.0.1');
+  }, 30000);
+});
\ No newline at end of file
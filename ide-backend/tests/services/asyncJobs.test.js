@@ -0,0 +1,198 @@
+const crypto = require('crypto');
+const dns = require('dns');
+const http = require('http');
+const { EventEmitter } = require('events');
+const asyncJobs = require('../../services/asyncJobs');
+const dockerService = require('../../services/dockerService');
+const executionHistory = require('../../services/executionHistory');
+
+jest.mock('../../services/dockerService');
+
+const flush = () => new Promise(resolve => setImmediate(resolve));
+
+describe('AsyncJobService', () => {
+  let streams;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    asyncJobs.jobs.clear();
+    asyncJobs.config = {
+      ...asyncJobs.config,
+      perUserLimit: 2,
+      callbackSecret: 'shh',
+      callbackBackoffMs: 1,
+      callbackMaxAttempts: 3,
+      allowPrivateCallbackHosts: false
+    };
+    executionHistory.setRepository(new executionHistory.MemoryExecutionRepository());
+
+    streams = [];
+    dockerService.createContainer.mockResolvedValue({ containerId: 'job-container' });
+    dockerService.executeCode.mockImplementation(async (containerId) => {
+      const stream = new EventEmitter();
+      streams.push(stream);
+      return { stream, exec: {}, containerId, language: 'python' };
+    });
+    dockerService.getExecExitCode.mockResolvedValue(0);
+    dockerService.detectKillReason.mockResolvedValue(null);
+    dockerService.stopContainer.mockResolvedValue();
+  });
+
+  const submit = (request = {}) => asyncJobs.submit('user-1', { language: 'python', code: 'print(1)', ...request });
+
+  it('should run a job in its own container with the async timeout tier', async () => {
+    const job = submit({ runTimeoutMs: 600000 });
+    await flush();
+
+    expect(asyncJobs.toJSON(job)).toMatchObject({ state: 'running', mode: 'async', runtime: 'python' });
+    expect(dockerService.createContainer).toHaveBeenCalledWith('python', 'async-job', 'user-1');
+    expect(dockerService.executeCode).toHaveBeenCalledWith('job-container', 'print(1)', 'main', expect.objectContaining({
+      runTimeoutMs: 600000,
+      timeoutTier: asyncJobs.config
+    }));
+
+    streams[0].emit('end');
+    while (job.state !== 'finished') {
+      await flush();
+    }
+
+    expect(job.result).toMatchObject({ status: 'completed', exitCode: 0 });
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('job-container', { force: true });
+    expect(await executionHistory.get('user-1', job.id)).toMatchObject({ mode: 'async', status: 'completed' });
+  });
+
+  it('should cap the jobs a user has queued or running', async () => {
+    submit();
+    submit();
+
+    expect(() => submit()).toThrow('At most 2 background jobs');
+    expect(() => asyncJobs.submit('user-2', { language: 'python', code: 'print(1)' })).not.toThrow();
+  });
+
+  it('should record a cancelled queued job without running it', async () => {
+    const job = submit();
+    job.ticket.state = 'cancelled'; // as if cancelled while waiting for a slot
+    job.cancelReason = 'user_cancelled';
+    await flush();
+    await flush();
+
+    expect(job.state).toBe('finished');
+    expect(dockerService.createContainer).not.toHaveBeenCalled();
+    expect(await executionHistory.get('user-1', job.id)).toMatchObject({ status: 'cancelled', killedReason: 'user_cancelled' });
+  });
+
+  describe('callbacks', () => {
+    const finish = async (job) => {
+      await flush();
+      streams[0].emit('end');
+      while (!job.callback || job.callback.status === 'pending') {
+        await flush();
+      }
+    };
+
+    it('should POST the signed result and retry 5xx responses', async () => {
+      const postCallback = jest.spyOn(asyncJobs, 'postCallback')
+        .mockResolvedValueOnce({ status: 503 })
+        .mockResolvedValueOnce({ status: 204 });
+
+      const job = submit({ callbackUrl: 'https://hooks.example.com/studio' });
+      await finish(job);
+
+      expect(postCallback).toHaveBeenCalledTimes(2);
+      expect(job.callback).toMatchObject({ status: 'delivered', attempts: 2, lastStatusCode: 204 });
+
+      const [url, body, headers] = postCallback.mock.calls[1];
+      expect(url).toBe('https://hooks.example.com/studio');
+      expect(JSON.parse(body)).toMatchObject({ event: 'execution.finished', executionId: job.id, status: 'completed' });
+      const expected = crypto.createHmac('sha256', 'shh').update(`${headers['X-Studio-Timestamp']}.${body}`).digest('hex');
+      expect(headers['X-Studio-Signature']).toBe(`sha256=${expected}`);
+      expect(headers['X-Studio-Delivery']).toBe(postCallback.mock.calls[0][2]['X-Studio-Delivery']);
+      postCallback.mockRestore();
+    });
+
+    it('should not retry a callback the receiver rejected', async () => {
+      const postCallback = jest.spyOn(asyncJobs, 'postCallback').mockResolvedValue({ status: 410 });
+
+      const job = submit({ callbackUrl: 'https://hooks.example.com/studio' });
+      await finish(job);
+
+      expect(postCallback).toHaveBeenCalledTimes(1);
+      expect(job.callback).toMatchObject({ status: 'failed', attempts: 1, lastStatusCode: 410 });
+      postCallback.mockRestore();
+    });
+
+    it('should give up after callbackMaxAttempts', async () => {
+      const postCallback = jest.spyOn(asyncJobs, 'postCallback').mockRejectedValue(new Error('ECONNREFUSED'));
+
+      const job = submit({ callbackUrl: 'https://hooks.example.com/studio' });
+      await finish(job);
+
+      expect(postCallback).toHaveBeenCalledTimes(3);
+      expect(job.callback).toMatchObject({ status: 'failed', attempts: 3, lastError: 'ECONNREFUSED' });
+      postCallback.mockRestore();
+    });
+
+    it('should refuse private and non-http callback URLs', () => {
+      for (const url of ['http://localhost:3000/hook', 'http://10.0.0.5/hook', 'http://[::1]/hook', 'ftp://example.com/hook', 'not a url']) {
+        expect(() => submit({ callbackUrl: url })).toThrow('callback_url');
+      }
+      expect(asyncJobs.jobs.size).toBe(0);
+    });
+
+    describe('delivery to a name that resolves to a private address', () => {
+      let server;
+      let received;
+      let port;
+
+      beforeEach(async () => {
+        received = 0;
+        server = http.createServer((req, res) => {
+          received++;
+          req.resume();
+          res.writeHead(204).end();
+        });
+        await new Promise(resolve => server.listen(0, '127.0.0.1', resolve));
+        port = server.address().port;
+
+        // A public looking name whose record points at loopback
+        const lookup = dns.lookup;
+        jest.spyOn(dns, 'lookup').mockImplementation((hostname, options, callback) => (hostname === 'rebind.example.com'
+          ? callback(null, [{ address: '127.0.0.1', family: 4 }])
+          : lookup(hostname, options, callback)));
+      });
+
+      afterEach(async () => {
+        dns.lookup.mockRestore();
+        await new Promise(resolve => server.close(resolve));
+      });
+
+      it('should refuse to connect', async () => {
+        await expect(asyncJobs.postCallback(`http://rebind.example.com:${port}/hook`, '{}', {}))
+          .rejects.toMatchObject({ code: 'INVALID_CALLBACK_URL' });
+        expect(received).toBe(0);
+      });
+
+      it('should fail the delivery without retrying', async () => {
+        const job = submit({ callbackUrl: `http://rebind.example.com:${port}/hook` });
+        await finish(job);
+
+        expect(job.callback).toMatchObject({ status: 'failed', attempts: 1 });
+        expect(job.callback.lastError).toMatch('private address');
+        expect(received).toBe(0);
+      });
+
+      it('should connect to the address it checked when private hosts are allowed', async () => {
+        asyncJobs.config.allowPrivateCallbackHosts = true;
+
+        await expect(asyncJobs.postCallback(`http://rebind.example.com:${port}/hook`, '{}', {})).resolves.toEqual({ status: 204 });
+        expect(received).toBe(1);
+      });
+    });
+
+    it('should refuse callbacks when no signing secret is configured', () => {
+      asyncJobs.config.callbackSecret = null;
+
+      expect(() => submit({ callbackUrl: 'https://hooks.example.com/studio' })).toThrow('Callbacks are not configured');
+    });
+  });
+});
\ No newline at end of file
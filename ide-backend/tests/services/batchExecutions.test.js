@@ -0,0 +1,125 @@
+const batchExecutions = require('../../services/batchExecutions');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const dockerService = require('../../services/dockerService');
+const logger = require('../../utils/logger');
+
+jest.mock('../../services/dockerService');
+
+describe('BatchExecutionService', () => {
+  const ok = (stdout, exitCode = 0) => ({ exitCode, timedOut: false, stdout, stderr: '', durationMs: 5 });
+  const finished = (batch) => new Promise(resolve => batch.events.once('finished', resolve));
+  const runs = () => dockerService.runBufferedExec.mock.calls.filter(([, , options]) => options.phase === 'batch');
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    jest.spyOn(logger, 'info').mockImplementation(() => {});
+    jest.spyOn(logger, 'warn').mockImplementation(() => {});
+    runtimeRegistry.load();
+    batchExecutions.config = { maxVariants: 50, maxParallel: 4, outputLimitBytes: 1024, retentionMs: 1000 };
+
+    let containers = 0;
+    dockerService.containers = new Map();
+    dockerService.createContainer.mockImplementation(async (language) => {
+      const containerId = `batch-${++containers}`;
+      dockerService.containers.set(containerId, { container: {}, language });
+      return { containerId };
+    });
+    dockerService.stopContainer.mockResolvedValue();
+    dockerService.getCodeFilename.mockImplementation((filename, language) => `${filename}.${runtimeRegistry.get(language).extension}`);
+    dockerService.writeFileToContainer.mockResolvedValue();
+    dockerService.runCompilePhase.mockResolvedValue(ok(''));
+    dockerService.copyFileFromContainer.mockResolvedValue(Buffer.from('binary'));
+    dockerService.copyFileToContainer.mockResolvedValue();
+    dockerService.signalProcesses.mockResolvedValue();
+    // Echo the program's arguments, like a parameter sweep would
+    dockerService.runBufferedExec.mockImplementation(async (containerId, argv) => ok(`${argv.slice(1).join(' ')}\n`));
+  });
+
+  afterEach(() => {
+    logger.info.mockRestore();
+    logger.warn.mockRestore();
+  });
+
+  it('should compile once and return results in variant order', async () => {
+    const batch = batchExecutions.submit('user-1', {
+      language: 'go',
+      code: 'package main',
+      variants: [
+        { args: ['-n', '1'] },
+        { args: ['-n', '2'], env: { MODE: 'fast' } },
+        { args: ['-n', '3'], stdin: 'input' }
+      ]
+    });
+    const result = await finished(batch);
+
+    expect(result.status).toBe('completed');
+    expect(result.results.map(variant => variant.stdout)).toEqual(['-n 1\n', '-n 2\n', '-n 3\n']);
+    expect(dockerService.runCompilePhase).toHaveBeenCalledTimes(1);
+    expect(dockerService.copyFileToContainer).toHaveBeenCalledWith('batch-2', '/build/main', Buffer.from('binary'), { mode: '755' });
+    expect(runs().find(([, argv]) => argv.includes('2'))[2]).toMatchObject({ env: ['MODE=fast'] });
+    expect(runs().find(([, argv]) => argv.includes('3'))[2]).toMatchObject({ stdin: 'input' });
+    expect(dockerService.stopContainer).toHaveBeenCalledTimes(2);
+  });
+
+  it('should keep going when variants fail and report progress for each', async () => {
+    dockerService.runBufferedExec.mockImplementation(async (containerId, argv) => {
+      if (argv.includes('bad')) {
+        return ok('', 1);
+      }
+      if (argv.includes('broken')) {
+        throw new Error('exec failed');
+      }
+      return ok('fine\n');
+    });
+
+    const batch = batchExecutions.submit('user-1', {
+      language: 'python',
+      code: 'print(1)',
+      variants: [{ args: ['bad'] }, { args: ['broken'] }, { args: ['good'] }]
+    });
+    const progress = [];
+    batch.events.on('progress', event => progress.push(event));
+    const result = await finished(batch);
+
+    expect(result.results.map(variant => [variant.status, variant.exitCode])).toEqual([
+      ['completed', 1],
+      ['error', undefined],
+      ['completed', 0]
+    ]);
+    expect(progress.map(event => `${event.completed}/${event.total}`)).toEqual(['1/3', '2/3', '3/3']);
+  });
+
+  it('should skip every variant when the build fails', async () => {
+    dockerService.runCompilePhase.mockResolvedValue({ exitCode: 1, timedOut: false, stdout: '', stderr: 'syntax error', durationMs: 3 });
+
+    const batch = batchExecutions.submit('user-1', { language: 'go', code: 'package', variants: [{}, {}, {}] });
+    const result = await finished(batch);
+
+    expect(result.status).toBe('compile_error');
+    expect(result.compile).toMatchObject({ exit_code: 1, output: 'syntax error' });
+    expect(result.results.every(variant => variant.status === 'skipped')).toBe(true);
+    expect(runs()).toHaveLength(0);
+  });
+
+  it('should cancel the rest of a batch by its ID', async () => {
+    let batch;
+    dockerService.runBufferedExec.mockImplementation(async () => {
+      batchExecutions.cancel('user-1', batch.id);
+      return { exitCode: 137, timedOut: false, stdout: '', stderr: '', durationMs: 5 };
+    });
+
+    batch = batchExecutions.submit('user-1', { language: 'python', code: 'print(1)', variants: [{}, {}, {}, {}, {}] });
+    expect(batchExecutions.cancel('user-2', batch.id)).toBe(false);
+    const result = await finished(batch);
+
+    expect(result.status).toBe('cancelled');
+    expect(result.results.every(variant => variant.status === 'cancelled')).toBe(true);
+    expect(runs().length).toBeLessThan(5);
+    expect(dockerService.signalProcesses).toHaveBeenCalled();
+  });
+
+  it('should reject variants that override sandbox variables', () => {
+    expect(() => batchExecutions.submit('user-1', { language: 'python', code: 'x', variants: [{}, { env: { HOME: '/' } }] }))
+      .toThrow("variants[1]: env HOME is reserved by the sandbox and can't be overridden");
+  });
+});
\ No newline at end of file
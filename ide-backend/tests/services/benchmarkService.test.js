@@ -0,0 +1,113 @@
+const benchmarkService = require('../../services/benchmarkService');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const dockerService = require('../../services/dockerService');
+
+jest.mock('../../services/dockerService');
+
+describe('BenchmarkService', () => {
+  const { BenchmarkService, summarize } = benchmarkService;
+  let service;
+
+  // A trial whose children used `userMs` of user and 10ms of sys time
+  const trial = (argv, { userMs = 120, exitCode = 0, durationMs = 150 } = {}) => {
+    const marker = /echo (\S+) >&2/.exec(argv[2])[1];
+    return {
+      exitCode,
+      timedOut: false,
+      stdout: 'done\n',
+      stderr: `${marker}\n0m0.00s 0m0.00s\n0m${(userMs / 1000).toFixed(3)}s 0m0.010s\n`,
+      durationMs
+    };
+  };
+
+  beforeEach(async () => {
+    jest.clearAllMocks();
+    runtimeRegistry.load();
+    service = new BenchmarkService();
+    service.config = { ...service.config, cpus: '6-7', cpusPerRun: 1, maxWaitMs: 50 };
+
+    dockerService.containers = new Map([['bench-1', { container: {}, language: 'python' }]]);
+    dockerService.createContainer.mockResolvedValue({ containerId: 'bench-1' });
+    dockerService.stopContainer.mockResolvedValue();
+    dockerService.getCodeFilename.mockImplementation((filename, language) => `${filename}.${runtimeRegistry.get(language).extension}`);
+    dockerService.writeFileToContainer.mockResolvedValue();
+    dockerService.signalProcesses.mockResolvedValue();
+  });
+
+  describe('initialize', () => {
+    it('should split the reserved CPUs into slots and keep other containers off them', async () => {
+      await service.initialize({ info: async () => ({ NCPU: 8, CpuSet: true }) });
+
+      expect(service.pinning).toEqual({ available: true, reason: null });
+      expect(service.slots).toEqual(['6', '7']);
+      expect(service.sharedCpuset()).toBe('0-5');
+      expect(service.queue.config.maxConcurrent).toBe(2);
+    });
+
+    it('should fall back to unpinned runs when the daemon has no cpuset support', async () => {
+      await service.initialize({ info: async () => ({ NCPU: 8, CpuSet: false }) });
+
+      expect(service.pinning.available).toBe(false);
+      expect(service.pinning.reason).toBe('The Docker daemon does not support cpusets');
+      expect(service.sharedCpuset()).toBeNull();
+      expect(service.queue.config.maxConcurrent).toBe(service.config.unpinnedConcurrency);
+    });
+  });
+
+  it('should run every trial in a fresh pinned container and summarize the times', async () => {
+    await service.initialize({ info: async () => ({ NCPU: 8, CpuSet: true }) });
+    const userTimes = [120, 100, 140];
+    dockerService.runBufferedExec.mockImplementation(async (containerId, argv) => trial(argv, { userMs: userTimes.shift() }));
+
+    const report = await service.run('user-1', { language: 'python', code: 'print(1)', trials: 3 });
+
+    expect(dockerService.createContainer).toHaveBeenCalledWith('python', 'benchmark', 'user-1', expect.objectContaining({ cpusetCpus: '6', fresh: true }));
+    expect(report.status).toBe('completed');
+    expect(report.trials.map(({ user_ms: userMs }) => userMs)).toEqual([120, 100, 140]);
+    expect(report.trials[0]).toEqual({ index: 0, wall_ms: 150, user_ms: 120, sys_ms: 10, exit_code: 0, timed_out: false });
+    expect(report.stats.user_ms).toEqual({ min: 100, median: 120, mean: 120, stddev: 20 });
+    expect(report.pinning).toEqual({ pinned: true, cpus: '6', reason: null });
+    expect(report.stderr).toBe('');
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('bench-1', { force: true });
+    expect(service.slots).toEqual(['7', '6']);
+  });
+
+  it('should stop at a failing trial and say why it ran unpinned', async () => {
+    await service.initialize({ info: async () => ({ NCPU: 8, CpuSet: false }) });
+    dockerService.runBufferedExec
+      .mockImplementationOnce(async (containerId, argv) => trial(argv))
+      .mockImplementationOnce(async (containerId, argv) => trial(argv, { exitCode: 1 }));
+
+    const report = await service.run('user-1', { language: 'python', code: 'print(1)', trials: 5 });
+
+    expect(report.status).toBe('runtime_error');
+    expect(report.trials).toHaveLength(2);
+    expect(report.stats.wall_ms).toEqual({ min: 150, median: 150, mean: 150, stddev: 0 });
+    expect(report.pinning).toEqual({ pinned: false, cpus: null, reason: 'The Docker daemon does not support cpusets' });
+  });
+
+  it('should give up with 429 when no slot frees up in time', async () => {
+    await service.initialize({ info: async () => ({ NCPU: 8, CpuSet: false }) });
+    let finish;
+    dockerService.runBufferedExec.mockImplementationOnce((containerId, argv) => new Promise((resolve) => {
+      finish = () => resolve(trial(argv));
+    }));
+
+    const first = service.run('user-1', { language: 'python', code: 'print(1)', trials: 1 });
+    await expect(service.run('user-2', { language: 'python', code: 'print(2)', trials: 1 }))
+      .rejects.toMatchObject({ code: 'QUEUE_TIMEOUT', kind: 'rate_limited' });
+
+    finish();
+    await first;
+  });
+
+  it('should refuse more trials than allowed', async () => {
+    await expect(service.run('user-1', { language: 'python', code: 'print(1)', trials: 11 }))
+      .rejects.toMatchObject({ code: 'INVALID_INPUT', param: 'trials' });
+  });
+
+  it('should summarize an even number of values with the middle two', () => {
+    expect(summarize([4, 1, 3, 2])).toEqual({ min: 1, median: 2.5, mean: 2.5, stddev: 1.291 });
+    expect(summarize([])).toBeNull();
+  });
+});
\ No newline at end of file
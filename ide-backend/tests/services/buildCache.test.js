@@ -0,0 +1,103 @@
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const buildCache = require('../../services/buildCache');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+
+describe('BuildCache', () => {
+  let basePath;
+  let go;
+
+  beforeEach(() => {
+    runtimeRegistry.load();
+    go = runtimeRegistry.get('go');
+    basePath = fs.mkdtempSync(path.join(os.tmpdir(), 'build-cache-'));
+    buildCache.config = { ...buildCache.config, enabled: true, basePath, maxBytes: 1024, maxArtifactBytes: 512 };
+    buildCache.index = null;
+    buildCache.totalBytes = 0;
+  });
+
+  afterEach(() => {
+    fs.rmSync(basePath, { recursive: true, force: true });
+  });
+
+  describe('getKey', () => {
+    const source = 'package main\n\nfunc main() {}\n';
+
+    it('should ignore line endings and trailing whitespace', () => {
+      expect(buildCache.getKey(go, 'main.go', source.replace(/\n/g, '\r\n')))
+        .toBe(buildCache.getKey(go, 'main.go', `${source}\n\n  `));
+    });
+
+    it('should change with the source, the file name and the runtime image', () => {
+      const key = buildCache.getKey(go, 'main.go', source);
+
+      expect(buildCache.getKey(go, 'main.go', source.replace('{}', '{ println() }'))).not.toBe(key);
+      expect(buildCache.getKey(go, 'app.go', source)).not.toBe(key);
+      expect(buildCache.getKey({ ...go, image: 'studio-runtime/go:0123456789ab' }, 'main.go', source)).not.toBe(key);
+    });
+
+    it('should change with the image ID even when the tag stays the same', () => {
+      expect(buildCache.getKey(go, 'main.go', source, 'sha256:1111')).not.toBe(buildCache.getKey(go, 'main.go', source, 'sha256:2222'));
+    });
+  });
+
+  it('should only be enabled for runtimes with a build cache', () => {
+    expect(buildCache.isEnabled(go)).toBe(true);
+    expect(buildCache.isEnabled(runtimeRegistry.get('cpp'))).toBe(false);
+  });
+
+  it('should return stored artifacts and count hits and misses', async () => {
+    const key = 'a'.repeat(64);
+    const before = { ...buildCache.stats };
+
+    expect(await buildCache.get('go', key)).toBeNull();
+    expect(await buildCache.set('go', key, Buffer.from('binary'))).toBe(true);
+    expect((await buildCache.get('go', key)).toString()).toBe('binary');
+
+    expect(buildCache.stats.misses - before.misses).toBe(1);
+    expect(buildCache.stats.hits - before.hits).toBe(1);
+    expect(fs.existsSync(path.join(basePath, 'go', key))).toBe(true);
+  });
+
+  it('should evict the least recently used artifacts above maxBytes', async () => {
+    const [first, second, third] = ['1', '2', '3'].map(digit => digit.repeat(64));
+    await buildCache.set('go', first, Buffer.alloc(400));
+    await buildCache.set('go', second, Buffer.alloc(400));
+    await buildCache.get('go', first); // second is now the oldest
+    await buildCache.set('go', third, Buffer.alloc(400));
+
+    expect(buildCache.totalBytes).toBe(800);
+    expect(await buildCache.get('go', second)).toBeNull();
+    expect(await buildCache.get('go', first)).not.toBeNull();
+    expect(fs.existsSync(path.join(basePath, 'go', second))).toBe(false);
+  });
+
+  it('should not cache artifacts above maxArtifactBytes', async () => {
+    expect(await buildCache.set('go', 'b'.repeat(64), Buffer.alloc(513))).toBe(false);
+    expect(buildCache.totalBytes).toBe(0);
+  });
+
+  it('should rebuild its index from disk', async () => {
+    await buildCache.set('go', 'c'.repeat(64), Buffer.from('binary'));
+    fs.writeFileSync(path.join(basePath, 'go', `${'d'.repeat(64)}.123.tmp`), 'partial');
+
+    buildCache.index = null;
+    buildCache.totalBytes = 0;
+    await buildCache.load();
+
+    expect(buildCache.index.size).toBe(1);
+    expect(buildCache.totalBytes).toBe(6);
+  });
+
+  it('should drop every entry of a runtime when invalidated', async () => {
+    await buildCache.set('go', 'e'.repeat(64), Buffer.from('one'));
+    await buildCache.set('rust', 'f'.repeat(64), Buffer.from('two'));
+
+    expect(await buildCache.invalidate('go')).toBe(1);
+
+    expect(await buildCache.get('go', 'e'.repeat(64))).toBeNull();
+    expect(await buildCache.get('rust', 'f'.repeat(64))).not.toBeNull();
+    expect(fs.existsSync(path.join(basePath, 'go'))).toBe(false);
+  });
+});
\ No newline at end of file
@@ -0,0 +1,91 @@
+const os = require('os');
+const path = require('path');
+const fs = require('fs').promises;
+const cacheVolumes = require('../../services/cacheVolumes');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+
+describe('CacheVolumeManager', () => {
+  let basePath;
+
+  const writeEntry = async (relativePath, size, ageSeconds) => {
+    const fullPath = path.join(basePath, 'go', 'gomod', relativePath);
+    await fs.mkdir(path.dirname(fullPath), { recursive: true });
+    await fs.writeFile(fullPath, Buffer.alloc(size));
+    const time = Date.now() / 1000 - ageSeconds;
+    await fs.utimes(fullPath, time, time);
+  };
+
+  const exists = (relativePath) => fs.access(path.join(basePath, 'go', 'gomod', relativePath)).then(() => true, () => false);
+
+  beforeEach(async () => {
+    basePath = await fs.mkdtemp(path.join(os.tmpdir(), 'cache-volumes-'));
+    cacheVolumes.config = {
+      enabled: true,
+      basePath,
+      hostBasePath: '/srv/studio/cache',
+      maxBytes: 1000,
+      pruneIntervalMs: 60000
+    };
+  });
+
+  afterEach(async () => {
+    await fs.rm(basePath, { recursive: true, force: true });
+  });
+
+  describe('getContainerConfig', () => {
+    it('should mount shared caches read-only and give build caches a capped tmpfs', async () => {
+      const result = await cacheVolumes.getContainerConfig(runtimeRegistry.get('go'));
+
+      expect(result.binds).toEqual(['/srv/studio/cache/go/gomod:/cache/gomod:ro']);
+      expect(result.tmpfs).toEqual({ '/cache/go-build': 'rw,nosuid,nodev,size=256m' });
+      expect(result.env).toEqual(['GOMODCACHE=/cache/gomod', 'GOCACHE=/cache/go-build']);
+    });
+
+    it('should mount nothing when disabled', async () => {
+      cacheVolumes.config.enabled = false;
+
+      const result = await cacheVolumes.getContainerConfig(runtimeRegistry.get('go'));
+      expect(result).toEqual({ binds: [], tmpfs: {}, env: [] });
+    });
+  });
+
+  describe('prune', () => {
+    it('should remove least recently used entries until under the cap', async () => {
+      await writeEntry('github.com/old/lib@v1.0.0/lib.go', 600, 3000);
+      await writeEntry('github.com/mid/lib@v1.0.0/lib.go', 300, 2000);
+      await writeEntry('github.com/new/lib@v1.0.0/lib.go', 400, 10);
+
+      const result = await cacheVolumes.prune('go', 'gomod');
+
+      expect(result).toMatchObject({ removedEntries: 1, removedBytes: 600, sizeBytes: 700 });
+      expect(await exists('github.com/old/lib@v1.0.0')).toBe(false);
+      expect(await exists('github.com/new/lib@v1.0.0/lib.go')).toBe(true);
+    });
+
+    it('should remove module directories as a whole, including read-only ones', async () => {
+      await writeEntry('example.com/mod@v1.2.3/a.go', 700, 3000);
+      await writeEntry('example.com/mod@v1.2.3/sub/b.go', 100, 10);
+      await writeEntry('cache/download/example.com/other/@v/v1.0.0.zip', 500, 100);
+      await fs.chmod(path.join(basePath, 'go', 'gomod', 'example.com/mod@v1.2.3/sub'), 0o555);
+      await fs.chmod(path.join(basePath, 'go', 'gomod', 'example.com/mod@v1.2.3'), 0o555);
+
+      const result = await cacheVolumes.prune('go', 'gomod');
+
+      // mod@v1.2.3 was used 10s ago (newest file), so the older @v directory goes first
+      expect(result.removedEntries).toBe(1);
+      expect(await exists('cache/download/example.com/other/@v')).toBe(false);
+      expect(await exists('example.com/mod@v1.2.3/a.go')).toBe(true);
+
+      cacheVolumes.config.maxBytes = 0;
+      await cacheVolumes.prune('go', 'gomod');
+      expect(await exists('example.com/mod@v1.2.3')).toBe(false);
+    });
+
+    it('should leave caches under the cap untouched', async () => {
+      await writeEntry('pkg/file.whl', 100, 3000);
+
+      const result = await cacheVolumes.prune('go', 'gomod');
+      expect(result).toMatchObject({ removedEntries: 0, sizeBytes: 100 });
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,162 @@
+const collaborationHub = require('../../services/collaborationHub');
+const fileSystem = require('../../utils/fileSystem');
+
+jest.mock('../../utils/fileSystem');
+
+// Sockets that deliver room broadcasts to each other
+const createNetwork = () => {
+  const sockets = [];
+
+  const connect = (id, userId) => {
+    const socket = {
+      id,
+      userId,
+      user: { name: userId },
+      rooms: new Set(),
+      received: [],
+      emit: jest.fn((event, data) => socket.received.push({ event, data })),
+      join: jest.fn(room => socket.rooms.add(room)),
+      leave: jest.fn(room => socket.rooms.delete(room)),
+      to: jest.fn(room => ({
+        emit: (event, data) => sockets
+          .filter(other => other !== socket && other.rooms.has(room))
+          .forEach(other => other.received.push({ event, data }))
+      }))
+    };
+    sockets.push(socket);
+    return socket;
+  };
+
+  return { connect };
+};
+
+const last = (socket, event) => socket.received.filter(message => message.event === event).pop();
+
+describe('CollaborationHub', () => {
+  let network;
+  let alice;
+  let bob;
+  let documentId;
+
+  beforeEach(async () => {
+    jest.clearAllMocks();
+    collaborationHub.sessions.clear();
+    collaborationHub.config = { ...collaborationHub.config, historyLimit: 500, maxOpComponents: 200 };
+    collaborationHub.authorize = jest.fn().mockResolvedValue({ read: true, write: true });
+
+    fileSystem.readFile.mockResolvedValue('hello world');
+    fileSystem.writeFile.mockResolvedValue(11);
+
+    network = createNetwork();
+    alice = network.connect('socket-a', 'alice');
+    bob = network.connect('socket-b', 'bob');
+
+    await collaborationHub.handleJoin(alice, { workspaceId: 'ws-1', filePath: 'main.js' });
+    await collaborationHub.handleJoin(bob, { workspaceId: 'ws-1', filePath: 'main.js' });
+    documentId = last(alice, 'collab:snapshot').data.documentId;
+  });
+
+  afterEach(async () => {
+    await collaborationHub.shutdown();
+  });
+
+  it('should share one session and send each participant a snapshot', () => {
+    expect(fileSystem.readFile).toHaveBeenCalledTimes(1);
+    expect(last(bob, 'collab:snapshot').data).toMatchObject({
+      documentId: 'ws-1:main.js',
+      revision: 0,
+      content: 'hello world',
+      canWrite: true
+    });
+    expect(last(alice, 'collab:participants').data.participants.map(p => p.userId)).toEqual(['alice', 'bob']);
+  });
+
+  it('should transform concurrent operations and broadcast the canonical sequence', () => {
+    // Both edit revision 0 without seeing each other's change
+    collaborationHub.handleOp(alice, { documentId, revision: 0, ops: [{ type: 'insert', position: 5, text: ',' }], opId: 'a1' });
+    collaborationHub.handleOp(bob, { documentId, revision: 0, ops: [{ type: 'delete', position: 6, length: 5 }], opId: 'b1' });
+
+    const session = collaborationHub.sessions.get(documentId);
+    expect(session.content).toBe('hello, ');
+    expect(session.revision).toBe(2);
+
+    expect(last(alice, 'collab:ack').data).toEqual({ documentId, revision: 1, opId: 'a1' });
+    expect(last(bob, 'collab:ack').data).toEqual({ documentId, revision: 2, opId: 'b1' });
+
+    // Alice receives Bob's delete shifted past her comma
+    expect(last(alice, 'collab:op').data).toMatchObject({
+      revision: 2,
+      userId: 'bob',
+      ops: [{ type: 'delete', position: 7, length: 5 }]
+    });
+    expect(last(bob, 'collab:op').data).toMatchObject({ revision: 1, userId: 'alice' });
+  });
+
+  it('should resync a client whose revision is outside the retained history', () => {
+    collaborationHub.config.historyLimit = 1;
+    collaborationHub.handleOp(alice, { documentId, revision: 0, ops: [{ type: 'insert', position: 0, text: 'a' }] });
+    collaborationHub.handleOp(alice, { documentId, revision: 1, ops: [{ type: 'insert', position: 0, text: 'b' }] });
+    bob.received = [];
+
+    collaborationHub.handleOp(bob, { documentId, revision: 0, ops: [{ type: 'insert', position: 0, text: 'c' }], opId: 'b1' });
+
+    expect(last(bob, 'collab:error').data).toMatchObject({ code: 'STALE_REVISION', opId: 'b1' });
+    expect(last(bob, 'collab:snapshot').data).toMatchObject({ revision: 2, content: 'bahello world', reason: 'stale_revision' });
+    expect(collaborationHub.sessions.get(documentId).content).toBe('bahello world');
+  });
+
+  it('should resync instead of applying an operation that does not fit the text', () => {
+    collaborationHub.handleOp(bob, { documentId, revision: 0, ops: [{ type: 'delete', position: 5, length: 100 }] });
+
+    expect(last(bob, 'collab:error').data.code).toBe('INVALID_OPERATION');
+    expect(last(bob, 'collab:snapshot').data.reason).toBe('invalid_operation');
+    expect(collaborationHub.sessions.get(documentId).revision).toBe(0);
+  });
+
+  it('should send a reconnecting client only the operations it missed', async () => {
+    const { sessionId } = last(bob, 'collab:snapshot').data;
+    collaborationHub.handleOp(alice, { documentId, revision: 0, ops: [{ type: 'insert', position: 0, text: '> ' }] });
+
+    const rejoined = network.connect('socket-b2', 'bob');
+    await collaborationHub.handleJoin(rejoined, { workspaceId: 'ws-1', filePath: 'main.js', sessionId, revision: 0 });
+
+    expect(last(rejoined, 'collab:snapshot')).toBeUndefined();
+    expect(last(rejoined, 'collab:joined').data).toMatchObject({
+      revision: 1,
+      missed: [{ revision: 1, userId: 'alice', ops: [{ type: 'insert', position: 0, text: '> ' }] }]
+    });
+  });
+
+  it('should reject edits from read-only participants', async () => {
+    collaborationHub.authorize.mockResolvedValueOnce({ read: true, write: false });
+    const viewer = network.connect('socket-c', 'carol');
+    await collaborationHub.handleJoin(viewer, { workspaceId: 'ws-1', filePath: 'main.js' });
+
+    collaborationHub.handleOp(viewer, { documentId, revision: 0, ops: [{ type: 'insert', position: 0, text: 'x' }] });
+
+    expect(last(viewer, 'collab:error').data.code).toBe('READ_ONLY');
+    expect(collaborationHub.sessions.get(documentId).revision).toBe(0);
+  });
+
+  it('should move other participants\' cursors with committed edits', () => {
+    collaborationHub.handlePresence(bob, { documentId, revision: 0, cursor: 6, selection: null });
+    expect(last(alice, 'collab:presence').data).toMatchObject({ userId: 'bob', cursor: 6 });
+
+    collaborationHub.handleOp(alice, { documentId, revision: 0, ops: [{ type: 'insert', position: 0, text: '>> ' }] });
+
+    const bobParticipant = collaborationHub.sessions.get(documentId).participants.get('socket-b');
+    expect(bobParticipant.cursor).toBe(9);
+  });
+
+  it('should flush the merged text and close the session when the last participant leaves', async () => {
+    collaborationHub.handleOp(alice, { documentId, revision: 0, ops: [{ type: 'insert', position: 11, text: '!' }] });
+
+    await collaborationHub.handleLeave(alice, { documentId });
+    expect(fileSystem.writeFile).not.toHaveBeenCalled();
+    expect(last(bob, 'collab:participants').data.participants.map(p => p.userId)).toEqual(['bob']);
+
+    await collaborationHub.handleDisconnection(bob);
+    expect(fileSystem.writeFile).toHaveBeenCalledWith('ws-1', 'main.js', 'hello world!');
+    expect(collaborationHub.sessions.has(documentId)).toBe(false);
+  });
+});
\ No newline at end of file
@@ -0,0 +1,103 @@
+jest.mock('../../services/dockerService', () => ({ isAvailable: false }));
+
+const os = require('os');
+const auditService = require('../../services/auditService');
+const containerPool = require('../../services/containerPool');
+const resourceLimits = require('../../services/resourceLimits');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const { ConfigManager } = require('../../services/configManager');
+
+describe('ConfigManager', () => {
+  const actor = { userId: 'admin-1', ip: '127.0.0.1' };
+  let manager;
+  let originalDefaults;
+  let originalPlans;
+
+  beforeAll(() => {
+    originalDefaults = { ...resourceLimits.defaults };
+    originalPlans = resourceLimits.plans;
+  });
+
+  beforeEach(() => {
+    runtimeRegistry.load();
+    resourceLimits.defaults = { ...originalDefaults };
+    resourceLimits.plans = { pro: { memoryBytes: 512 * 1024 * 1024 } };
+    containerPool.config = { enabled: true, defaultSize: 1, sizes: {}, idleTtlMs: 60000, reapIntervalMs: 60000 };
+    jest.spyOn(containerPool, 'reconfigure').mockResolvedValue(0);
+    jest.spyOn(containerPool, 'flush').mockResolvedValue(0);
+    jest.spyOn(auditService, 'logConfigurationChange').mockReturnValue('audit-1');
+    manager = new ConfigManager();
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  afterAll(() => {
+    runtimeRegistry.load();
+    resourceLimits.defaults = originalDefaults;
+    resourceLimits.plans = originalPlans;
+  });
+
+  it('should apply timeouts, limits and pool sizes to new executions only', async () => {
+    const running = runtimeRegistry.resolveTimeouts('python');
+    const runningLimits = resourceLimits.resolve('pro');
+
+    const { changes } = await manager.update({
+      runtimes: { python: { runTimeoutMs: 5000 } },
+      resourceLimits: { plans: { pro: { pidsLimit: 128 } } },
+      containerPool: { sizes: { python: 3 } }
+    }, actor);
+
+    expect(changes).toEqual({
+      'runtimes.python.runTimeoutMs': { from: running.runTimeoutMs, to: 5000 },
+      'resourceLimits.plans.pro.pidsLimit': { from: null, to: 128 },
+      'containerPool.sizes.python': { from: null, to: 3 }
+    });
+    expect(runtimeRegistry.resolveTimeouts('python').runTimeoutMs).toBe(5000);
+    expect(resourceLimits.resolve('pro').pidsLimit).toBe(128);
+    expect(containerPool.reconfigure).toHaveBeenCalledWith(expect.objectContaining({ sizes: { python: 3 } }));
+    expect(containerPool.flush).not.toHaveBeenCalled();
+    expect(auditService.logConfigurationChange).toHaveBeenCalledWith('admin-1', 'runtime', changes, { ip: '127.0.0.1', userAgent: undefined });
+
+    // What executions already resolved is theirs
+    expect(running.runTimeoutMs).not.toBe(5000);
+    expect(runningLimits.pidsLimit).toBe(originalDefaults.pidsLimit);
+    expect(manager.get().containerPool.sizes).toEqual({ python: 3 });
+  });
+
+  it('should reject an update wholesale when any setting is invalid', async () => {
+    const before = manager.get();
+
+    await expect(manager.update({
+      runtimes: { python: { runTimeoutMs: 5000 } },
+      containerPool: { defaultSize: -1 },
+      resourceLimits: { defaults: { memoryBytes: os.totalmem() * 2 } },
+      scheduler: {}
+    }, actor)).rejects.toMatchObject({
+      code: 'INVALID_CONFIG',
+      errors: [
+        { path: 'containerPool.defaultSize', message: 'must be an integer of 0 or more' },
+        { path: 'scheduler', message: 'is not a configurable setting' }
+      ]
+    });
+
+    await expect(manager.update({ resourceLimits: { defaults: { memoryBytes: os.totalmem() * 2 } } }, actor))
+      .rejects.toMatchObject({ errors: [expect.objectContaining({ path: 'resourceLimits.defaults.memoryBytes' })] });
+
+    expect(manager.get()).toBe(before);
+    expect(runtimeRegistry.resolveTimeouts('python').runTimeoutMs).not.toBe(5000);
+    expect(containerPool.reconfigure).not.toHaveBeenCalled();
+    expect(auditService.logConfigurationChange).not.toHaveBeenCalled();
+  });
+
+  it('should replace warm containers when the default limits change', async () => {
+    containerPool.idle.set('python', []);
+
+    await manager.update({ resourceLimits: { defaults: { pidsLimit: 32 } } }, actor);
+
+    expect(resourceLimits.defaults.pidsLimit).toBe(32);
+    expect(containerPool.flush).toHaveBeenCalledWith('python');
+    containerPool.idle.clear();
+  });
+});
\ No newline at end of file
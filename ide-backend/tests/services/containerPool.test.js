@@ -0,0 +1,167 @@
+const containerPool = require('../../services/containerPool');
+
+describe('ContainerPool', () => {
+  let created;
+  let create;
+  let destroy;
+
+  beforeEach(() => {
+    created = 0;
+    create = jest.fn(async (runtime) => {
+      created++;
+      return { container: { id: `${runtime}-${created}` }, name: `ide-${runtime}-${created}` };
+    });
+    destroy = jest.fn().mockResolvedValue();
+
+    containerPool.idle.clear();
+    containerPool.leased.clear();
+    containerPool.warming.clear();
+    containerPool.isShuttingDown = false;
+    containerPool.config = {
+      enabled: true,
+      defaultSize: 1,
+      sizes: { go: 2 },
+      idleTtlMs: 60000,
+      reapIntervalMs: 60000
+    };
+    Object.keys(containerPool.stats).forEach(key => {
+      containerPool.stats[key] = 0;
+    });
+  });
+
+  afterEach(async () => {
+    await containerPool.shutdown();
+  });
+
+  const flush = () => new Promise(resolve => setImmediate(resolve));
+
+  describe('initialize', () => {
+    it('should pre-warm containers up to the per-runtime size', async () => {
+      containerPool.initialize({ create, destroy, runtimes: ['go', 'python'] });
+      await flush();
+
+      const stats = containerPool.getStats();
+      expect(stats.runtimes.go.idle).toBe(2);
+      expect(stats.runtimes.python.idle).toBe(1);
+      expect(create).toHaveBeenCalledTimes(3);
+    });
+
+    it('should not warm containers when the pool is disabled', async () => {
+      containerPool.config.enabled = false;
+      containerPool.initialize({ create, destroy, runtimes: ['go'] });
+      await flush();
+
+      expect(create).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('acquire', () => {
+    it('should hand out a warm container and count a hit', async () => {
+      containerPool.initialize({ create, destroy, runtimes: ['python'] });
+      await flush();
+
+      const result = await containerPool.acquire('python');
+
+      expect(result.pooled).toBe(true);
+      expect(containerPool.isLeased(result.container.id)).toBe(true);
+      expect(containerPool.getStats().hits).toBe(1);
+    });
+
+    it('should cold start when no idle container is available', async () => {
+      containerPool.config.enabled = false;
+      containerPool.initialize({ create, destroy, runtimes: ['node'] });
+
+      const result = await containerPool.acquire('node', { workspaceId: 'ws-1', userId: 'user-1' });
+
+      expect(result.pooled).toBe(false);
+      expect(create).toHaveBeenCalledWith('node', { workspaceId: 'ws-1', userId: 'user-1' });
+      expect(containerPool.getStats().coldStarts).toBe(1);
+    });
+
+    it('should never hand the same container to concurrent acquisitions', async () => {
+      containerPool.initialize({ create, destroy, runtimes: ['go'] });
+      await flush();
+
+      const results = await Promise.all([
+        containerPool.acquire('go'),
+        containerPool.acquire('go'),
+        containerPool.acquire('go')
+      ]);
+
+      const ids = results.map(result => result.container.id);
+      expect(new Set(ids).size).toBe(3);
+    });
+
+    it('should throw when not initialized', async () => {
+      containerPool.factory = null;
+      await expect(containerPool.acquire('go')).rejects.toThrow('Container pool is not initialized');
+    });
+  });
+
+  describe('release', () => {
+    it('should destroy dirty containers', async () => {
+      containerPool.initialize({ create, destroy, runtimes: ['python'] });
+      await flush();
+
+      const { container } = await containerPool.acquire('python');
+      await containerPool.release(container, true);
+
+      expect(destroy).toHaveBeenCalledWith(container);
+      expect(containerPool.isLeased(container.id)).toBe(false);
+    });
+
+    it('should recycle clean containers when the pool has room', async () => {
+      containerPool.config.enabled = false;
+      containerPool.initialize({ create, destroy, runtimes: ['python'] });
+      const { container } = await containerPool.acquire('python');
+      containerPool.config.enabled = true;
+
+      await containerPool.release(container.id, false);
+
+      expect(destroy).not.toHaveBeenCalled();
+      expect(containerPool.getStats().recycled).toBe(1);
+      expect(containerPool.getStats().runtimes.python.idle).toBe(1);
+    });
+
+    it('should ignore releases of untracked containers', async () => {
+      containerPool.initialize({ create, destroy, runtimes: [] });
+
+      const result = await containerPool.release('unknown', true);
+
+      expect(result).toBe(false);
+      expect(destroy).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('reapIdle', () => {
+    it('should destroy containers idle past the TTL', async () => {
+      containerPool.initialize({ create, destroy, runtimes: ['python'] });
+      await flush();
+
+      const [entry] = containerPool.idle.get('python');
+      entry.idleSince = new Date(Date.now() - 120000);
+
+      const reaped = await containerPool.reapIdle();
+
+      expect(reaped).toBe(1);
+      expect(destroy).toHaveBeenCalledWith(entry.container);
+      expect(containerPool.getStats().runtimes.python.idle).toBe(0);
+    });
+  });
+
+  describe('reconfigure', () => {
+    it('should shrink and grow runtimes to their new sizes', async () => {
+      containerPool.initialize({ create, destroy, runtimes: ['go', 'python'] });
+      await flush();
+      const [oldest] = containerPool.idle.get('go');
+
+      const destroyed = await containerPool.reconfigure({ sizes: { go: 1 }, defaultSize: 2 });
+      await flush();
+
+      expect(destroyed).toBe(1);
+      expect(destroy).toHaveBeenCalledWith(oldest.container);
+      expect(containerPool.getStats().runtimes.go.idle).toBe(1);
+      expect(containerPool.getStats().runtimes.python.idle).toBe(2);
+    });
+  });
+});
\ No newline at end of file
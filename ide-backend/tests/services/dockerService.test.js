@@ -1,4 +1,12 @@
 const dockerService = require('../../services/dockerService');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const egressProxy = require('../../services/egressProxy');
+const cacheVolumes = require('../../services/cacheVolumes');
+const buildCache = require('../../services/buildCache');
+const executionQueue = require('../../services/executionQueue');
+const executionSessions = require('../../services/executionSessions');
+const tracing = require('../../utils/tracing');
+const { RecordingTracerProvider } = require('../utils/recordingTracer');
 
 // Mock dockerode
 jest.mock('dockerode');
@@ -83,6 +91,46 @@ describe('DockerService', () => {
       expect(mockDocker.ping).toHaveBeenCalled();
     });
 
+    it('should remove orphaned execution containers on startup', async () => {
+      const orphan = { remove: jest.fn().mockResolvedValue({}) };
+      mockDocker.listContainers.mockResolvedValueOnce([{ Id: 'orphan-1' }]);
+      mockDocker.getContainer.mockReturnValueOnce(orphan);
+
+      await dockerService.initialize();
+
+      expect(mockDocker.listContainers).toHaveBeenCalledWith({
+        all: true,
+        filters: { label: ['studio.execution=true'] }
+      });
+      expect(mockDocker.getContainer).toHaveBeenCalledWith('orphan-1');
+      expect(orphan.remove).toHaveBeenCalledWith({ force: true, v: true });
+    });
+
+    it('should leave the containers of live instances sharing the host on startup', async () => {
+      const isInstanceAlive = jest.spyOn(executionSessions, 'isInstanceAlive').mockImplementation(async id => id === 'replica-live');
+      const removed = { remove: jest.fn().mockResolvedValue({}) };
+      mockDocker.listContainers.mockResolvedValueOnce([
+        { Id: 'own-1', Labels: { 'studio.instance': executionSessions.instanceId } },
+        { Id: 'live-1', Labels: { 'studio.instance': 'replica-live' } },
+        { Id: 'live-2', Labels: { 'studio.instance': 'replica-live' } },
+        { Id: 'dead-1', Labels: { 'studio.instance': 'replica-dead' } }
+      ]);
+      mockDocker.getContainer.mockReturnValue(removed);
+
+      try {
+        await dockerService.initialize();
+
+        const ids = mockDocker.getContainer.mock.calls.map(([id]) => id);
+        expect(ids).toEqual(expect.arrayContaining(['own-1', 'dead-1']));
+        expect(ids).not.toContain('live-1');
+        expect(ids).not.toContain('live-2');
+        expect(isInstanceAlive.mock.calls.filter(([id]) => id === 'replica-live')).toHaveLength(1);
+      } finally {
+        isInstanceAlive.mockRestore();
+        mockDocker.getContainer.mockReturnValue(mockContainer);
+      }
+    });
+
     it('should return false when Docker is not available', async () => {
       mockDocker.ping.mockRejectedValue(new Error('Docker not available'));
       
@@ -123,12 +171,198 @@ describe('DockerService', () => {
       expect(createCall.HostConfig.NetworkMode).toBe('none');
     });
 
+    it('should run on a read-only root filesystem with scratch sized by the memory limit', async () => {
+      const limits = { cpuQuota: 50000, cpuPeriod: 100000, memoryBytes: 512 * 1024 * 1024, pidsLimit: 64, diskWriteBps: 0 };
+      await dockerService.createContainer('go', 'workspace-1', 'user-1', { limits });
+
+      const createCall = mockDocker.createContainer.mock.calls[0][0];
+      expect(createCall.HostConfig.ReadonlyRootfs).toBe(true);
+      expect(createCall.HostConfig.Tmpfs['/tmp']).toBe(`rw,noexec,nosuid,nodev,size=${256 * 1024 * 1024}`);
+      expect(createCall.HostConfig.Tmpfs['/build']).toBe(`rw,exec,nosuid,nodev,size=${128 * 1024 * 1024}`);
+      expect(createCall.HostConfig.Mounts).toEqual([expect.objectContaining({ Type: 'volume', Target: '/workspace' })]);
+      expect(createCall.Env).toEqual(expect.arrayContaining(['GOCACHE=/tmp/.cache/go-build', 'GOMODCACHE=/tmp/pkg/mod', 'GOTMPDIR=/build']));
+    });
+
+    it('should label the container and its workspace volume for the reaper', async () => {
+      await dockerService.createContainer('node', 'workspace-1', 'user-1');
+
+      const createCall = mockDocker.createContainer.mock.calls[0][0];
+      expect(createCall.Labels).toMatchObject({
+        'studio.owner': 'user-1',
+        'studio.execution_id': expect.stringMatching(/^[0-9a-f-]{36}$/),
+        'studio.created_at': expect.any(String),
+        'studio.instance': executionSessions.instanceId
+      });
+      expect(createCall.HostConfig.Mounts[0].VolumeOptions.Labels).toEqual({
+        'studio.owner': 'user-1',
+        'studio.execution_id': createCall.Labels['studio.execution_id'],
+        'studio.created_at': createCall.Labels['studio.created_at'],
+        'studio.instance': executionSessions.instanceId
+      });
+    });
+
+    it('should give default-policy containers no network, so the backend API is unreachable', async () => {
+      const result = await dockerService.createContainer('node', 'workspace-1', 'user-1');
+
+      const createCall = mockDocker.createContainer.mock.calls[0][0];
+      expect(createCall.HostConfig.NetworkMode).toBe('none');
+      expect(createCall.NetworkDisabled).toBe(true);
+      expect(createCall.HostConfig.Dns).toEqual([]);
+      expect(createCall.HostConfig.ExtraHosts).toBeUndefined();
+      expect(createCall.Env.some(entry => /^https?_proxy=/i.test(entry))).toBe(false);
+      expect(mockDocker.listNetworks).not.toHaveBeenCalled();
+      expect(result.networkEnabled).toBe(false);
+    });
+
+    it('should mount the runtime dependency caches', async () => {
+      const cacheConfig = cacheVolumes.config;
+      cacheVolumes.config = { ...cacheConfig, enabled: true, basePath: require('os').tmpdir(), hostBasePath: '/srv/cache' };
+
+      try {
+        await dockerService.createContainer('go', 'workspace-1', 'user-1');
+      } finally {
+        cacheVolumes.config = cacheConfig;
+      }
+
+      const createCall = mockDocker.createContainer.mock.calls[0][0];
+      expect(createCall.HostConfig.Binds).toContain('/srv/cache/go/gomod:/cache/gomod:ro');
+      expect(createCall.HostConfig.Tmpfs['/cache/go-build']).toMatch(/size=256m/);
+      expect(createCall.HostConfig.Tmpfs['/tmp']).toBeDefined();
+      expect(createCall.Env).toEqual(expect.arrayContaining(['GOMODCACHE=/cache/gomod', 'GOCACHE=/cache/go-build']));
+      expect(createCall.Env.filter(entry => entry.startsWith('GOCACHE='))).toHaveLength(1);
+    });
+
+    describe('with allowNetwork', () => {
+      beforeEach(() => {
+        runtimeRegistry.register('netnode', {
+          image: 'node:18-alpine',
+          extension: 'js',
+          run: ['node', '{file}'],
+          allowNetwork: true,
+          egressAllowlist: ['registry.npmjs.org']
+        });
+
+        mockDocker.createNetwork = jest.fn().mockResolvedValue({
+          inspect: jest.fn().mockResolvedValue({ IPAM: { Config: [{ Subnet: '172.30.0.0/16', Gateway: '172.30.0.1' }] } })
+        });
+        mockContainer.inspect.mockResolvedValue({
+          State: { Status: 'running', Running: true },
+          NetworkSettings: { Networks: { 'studio-egress': { IPAddress: '172.30.0.2' } } }
+        });
+        jest.spyOn(egressProxy, 'start').mockResolvedValue();
+        dockerService.egressNetwork = null;
+      });
+
+      afterEach(() => {
+        runtimeRegistry.load();
+        egressProxy.clients.clear();
+        egressProxy.start.mockRestore();
+      });
+
+      it('should attach the container to the internal egress network behind the proxy', async () => {
+        const result = await dockerService.createContainer('netnode', 'workspace-1', 'user-1');
+
+        expect(mockDocker.createNetwork).toHaveBeenCalledWith(expect.objectContaining({
+          Name: 'studio-egress',
+          Internal: true
+        }));
+
+        const createCall = mockDocker.createContainer.mock.calls[0][0];
+        expect(createCall.HostConfig.NetworkMode).toBe('studio-egress');
+        expect(createCall.NetworkDisabled).toBe(false);
+        expect(createCall.Env).toContain('HTTPS_PROXY=http://172.30.0.1:3128');
+        expect(result.networkEnabled).toBe(true);
+      });
+
+      it('should register the container address with its runtime allowlist', async () => {
+        await dockerService.createContainer('netnode', 'workspace-1', 'user-1');
+
+        expect(egressProxy.clients.get('172.30.0.2')).toMatchObject({
+          containerId: 'test-container-id',
+          allowlist: expect.arrayContaining(['registry.npmjs.org'])
+        });
+
+        await dockerService.stopContainer('test-container-id');
+        expect(egressProxy.clients.has('172.30.0.2')).toBe(false);
+      });
+    });
+
+    it('should bind mount a persistent workspace and bypass the pool', async () => {
+      const result = await dockerService.createContainer('node', 'workspace-1', 'user-1', {
+        mountWorkspaceId: '507f1f77bcf86cd799439011'
+      });
+
+      const createCall = mockDocker.createContainer.mock.calls[mockDocker.createContainer.mock.calls.length - 1][0];
+      expect(createCall.HostConfig.Binds).toEqual(expect.arrayContaining([
+        expect.stringMatching(/507f1f77bcf86cd799439011:\/workspace:rw$/)
+      ]));
+      expect(createCall.HostConfig.Tmpfs['/workspace/.build']).toBe(`rw,exec,nosuid,nodev,size=${256 * 1024 * 1024}`);
+      expect(result).toMatchObject({ pooled: false, mountWorkspaceId: '507f1f77bcf86cd799439011' });
+    });
+
     it('should apply resource limits', async () => {
       await dockerService.createContainer('node', 'workspace-1', 'user-1');
       
       const createCall = mockDocker.createContainer.mock.calls[0][0];
       expect(createCall.HostConfig.Memory).toBe(256 * 1024 * 1024); // 256MB
-      expect(createCall.HostConfig.CpuQuota).toBe(25000); // 25% CPU
+      expect(createCall.HostConfig.MemorySwap).toBe(256 * 1024 * 1024); // no swap
+      expect(createCall.HostConfig.CpuQuota).toBe(50000); // 0.5 CPU
+      expect(createCall.HostConfig.PidsLimit).toBe(64);
+    });
+
+    it('should apply per-plan resource limit overrides', async () => {
+      const limits = {
+        cpuQuota: 100000,
+        cpuPeriod: 100000,
+        memoryBytes: 512 * 1024 * 1024,
+        pidsLimit: 128,
+        diskWriteBps: 20 * 1024 * 1024
+      };
+
+      await dockerService.createContainer('node', 'workspace-1', 'user-1', { limits });
+
+      const createCall = mockDocker.createContainer.mock.calls[0][0];
+      expect(createCall.HostConfig.Memory).toBe(512 * 1024 * 1024);
+      expect(createCall.HostConfig.CpuQuota).toBe(100000);
+      expect(createCall.HostConfig.PidsLimit).toBe(128);
+      expect(createCall.HostConfig.BlkioDeviceWriteBps[0].Rate).toBe(20 * 1024 * 1024);
+    });
+  });
+
+  describe('detectKillReason', () => {
+    beforeEach(async () => {
+      await dockerService.initialize();
+      await dockerService.createContainer('node', 'workspace-1', 'user-1');
+    });
+
+    it('should report oom when the container was OOM killed', async () => {
+      mockContainer.inspect.mockResolvedValueOnce({ State: { OOMKilled: true } });
+
+      const reason = await dockerService.detectKillReason('test-container-id', 137);
+      expect(reason).toBe('oom');
+    });
+
+    it('should report pids_limit when forking failed', async () => {
+      mockContainer.inspect.mockResolvedValueOnce({ State: { OOMKilled: false } });
+      mockContainer.stats.mockResolvedValueOnce({
+        memory_stats: { usage: 1024, limit: 268435456 },
+        pids_stats: { current: 64, limit: 64 }
+      });
+
+      const reason = await dockerService.detectKillReason('test-container-id', 1, 'sh: fork: Resource temporarily unavailable');
+      expect(reason).toBe('pids_limit');
+    });
+
+    it('should report disk_limit when a scratch tmpfs filled up', async () => {
+      mockContainer.inspect.mockResolvedValueOnce({ State: { OOMKilled: false } });
+
+      const reason = await dockerService.detectKillReason('test-container-id', 1, "OSError: [Errno 28] No space left on device: '/tmp/out'");
+      expect(reason).toBe('disk_limit');
+    });
+
+    it('should return null for successful executions', async () => {
+      const reason = await dockerService.detectKillReason('test-container-id', 0);
+      expect(reason).toBeNull();
     });
   });
 
@@ -153,6 +387,281 @@ describe('DockerService', () => {
       await expect(dockerService.executeCode('non-existent', 'code'))
         .rejects.toThrow('Container not found');
     });
+
+    it('should execute a multi-file project from its entrypoint', async () => {
+      await dockerService.executeCode('test-container-id', null, 'main', {
+        files: { 'main.js': 'require("./lib/util")', 'lib/util.js': 'module.exports = 1;' },
+        entrypoint: 'main.js'
+      });
+
+      expect(mockContainer.putArchive).toHaveBeenCalledWith(expect.anything(), { path: '/workspace' });
+      expect(mockContainer.exec).toHaveBeenCalledWith(expect.objectContaining({
+        Cmd: ['node', 'main.js']
+      }));
+    });
+
+    it('should pass args as argv and env to the program only', async () => {
+      dockerService.containers.get('test-container-id').language = 'cpp';
+      mockDocker.modem.demuxStream = jest.fn();
+      mockContainer.exec.mockResolvedValueOnce({
+        start: jest.fn().mockResolvedValue({
+          on: jest.fn((event, handler) => event === 'end' && handler()),
+          destroy: jest.fn()
+        }),
+        inspect: jest.fn().mockResolvedValue({ Running: false, ExitCode: 0 })
+      });
+
+      const result = await dockerService.executeCode('test-container-id', 'int main() {}', 'main', {
+        args: ['--name', 'a b; rm -rf /'],
+        env: { APP_MODE: 'test' }
+      });
+
+      expect(mockContainer.exec.mock.calls[0][0].Env).toBeUndefined();
+      expect(mockContainer.exec).toHaveBeenNthCalledWith(2, expect.objectContaining({
+        Cmd: ['/build/main', '--name', 'a b; rm -rf /'],
+        Env: ['APP_MODE=test']
+      }));
+      clearTimeout(result.timeout);
+    });
+
+    it('should give workspace secrets to the program, with request env taking precedence', async () => {
+      dockerService.containers.get('test-container-id').language = 'cpp';
+      mockDocker.modem.demuxStream = jest.fn();
+      mockContainer.exec.mockResolvedValueOnce({
+        start: jest.fn().mockResolvedValue({
+          on: jest.fn((event, handler) => event === 'end' && handler()),
+          destroy: jest.fn()
+        }),
+        inspect: jest.fn().mockResolvedValue({ Running: false, ExitCode: 0 })
+      });
+
+      const result = await dockerService.executeCode('test-container-id', 'int main() {}', 'main', {
+        env: { API_URL: 'http://localhost' },
+        secrets: { API_TOKEN: 'tok-123', API_URL: 'https://prod', PATH: '/tmp' }
+      });
+
+      expect(mockContainer.exec.mock.calls[0][0].Env).toBeUndefined();
+      expect(mockContainer.exec.mock.calls[1][0].Env).toEqual(['API_TOKEN=tok-123', 'API_URL=http://localhost']);
+      clearTimeout(result.timeout);
+    });
+
+    it('should reject env that overrides sandbox variables', async () => {
+      await expect(dockerService.executeCode('test-container-id', 'console.log(1)', 'main', { env: { PATH: '/tmp' } }))
+        .rejects.toThrow('env PATH is reserved');
+      expect(mockContainer.exec).not.toHaveBeenCalled();
+    });
+
+    it('should compile and run build runtimes as separate execs', async () => {
+      dockerService.containers.get('test-container-id').language = 'cpp';
+      mockDocker.modem.demuxStream = jest.fn();
+      mockContainer.exec.mockResolvedValueOnce({
+        start: jest.fn().mockResolvedValue({
+          on: jest.fn((event, handler) => event === 'end' && handler()),
+          destroy: jest.fn()
+        }),
+        inspect: jest.fn().mockResolvedValue({ Running: false, ExitCode: 0 })
+      });
+
+      const result = await dockerService.executeCode('test-container-id', 'int main() {}', 'main', { runTimeoutMs: 5000 });
+
+      expect(mockContainer.exec).toHaveBeenNthCalledWith(1, expect.objectContaining({ Cmd: ['g++', '-o', '/build/main', 'main.cpp'] }));
+      expect(mockContainer.exec).toHaveBeenNthCalledWith(2, expect.objectContaining({ Cmd: ['/build/main'] }));
+      expect(result.compile).toMatchObject({ exitCode: 0, timedOut: false });
+      expect(result.limits).toEqual({ compileTimeoutMs: 60000, runTimeoutMs: 5000 });
+      clearTimeout(result.timeout);
+    });
+
+    it('should trace the queue wait, container and exec calls under the request span', async () => {
+      const recorder = new RecordingTracerProvider();
+      const originalQueueConfig = executionQueue.config;
+      tracing.setTracerProvider(recorder);
+      executionQueue.config = { ...originalQueueConfig, enabled: true };
+      dockerService.containers.clear();
+      mockDocker.modem.demuxStream = jest.fn();
+      mockContainer.exec.mockResolvedValueOnce({
+        start: jest.fn().mockResolvedValue({
+          on: jest.fn((event, handler) => event === 'end' && handler()),
+          destroy: jest.fn()
+        }),
+        inspect: jest.fn().mockResolvedValue({ Running: false, ExitCode: 0 })
+      });
+
+      try {
+        await tracing.withSpan('request', {}, async () => {
+          const ticket = executionQueue.enqueue('user-1');
+          await ticket.ready;
+          const { containerId } = await dockerService.createContainer('cpp', 'workspace-1', 'user-1');
+          const result = await dockerService.executeCode(containerId, 'int main() {}', 'main');
+          clearTimeout(result.timeout);
+          tracing.endSpan(result.runSpan, { 'studio.exit_code': 0 });
+          await dockerService.stopContainer(containerId);
+          ticket.release();
+        });
+      } finally {
+        tracing.setTracerProvider(null);
+        executionQueue.config = originalQueueConfig;
+      }
+
+      expect(recorder.childrenOf(recorder.find('request'))).toEqual(expect.arrayContaining([
+        'execution.queue_wait',
+        'container.acquire',
+        'container.copy_files',
+        'execution.compile',
+        'execution.run',
+        'container.cleanup'
+      ]));
+      expect(recorder.find('container.acquire').attributes).toMatchObject({
+        'studio.runtime': 'cpp',
+        'studio.container_id': 'test-container-id'
+      });
+      expect(recorder.find('execution.compile').attributes).toMatchObject({ 'studio.exit_code': 0 });
+      expect(recorder.spans.every(span => span.ended)).toBe(true);
+    });
+
+    it('should report a compile timeout without starting the program', async () => {
+      dockerService.containers.get('test-container-id').language = 'cpp';
+      mockDocker.modem.demuxStream = jest.fn();
+
+      const result = await dockerService.executeCode('test-container-id', 'int main() {}', 'main', { compileTimeoutMs: 10 });
+
+      expect(mockContainer.exec).toHaveBeenCalledTimes(1);
+      expect(result).toMatchObject({ stream: null, timedOut: true, timeoutPhase: 'compile' });
+      expect(result.compile).toMatchObject({ exitCode: null, timedOut: true });
+    });
+
+    describe('with a build cache', () => {
+      let originalConfig;
+
+      beforeEach(() => {
+        originalConfig = buildCache.config;
+        buildCache.config = { ...originalConfig, enabled: true };
+        dockerService.containers.get('test-container-id').language = 'go';
+        mockDocker.modem.demuxStream = jest.fn();
+        mockContainer.inspect.mockResolvedValue({ Image: 'sha256:go-image', State: { Running: true } });
+        jest.spyOn(dockerService, 'copyFileToContainer').mockResolvedValue();
+      });
+
+      afterEach(() => {
+        buildCache.config = originalConfig;
+        jest.restoreAllMocks();
+      });
+
+      it('should skip the compile phase when the binary is cached', async () => {
+        jest.spyOn(buildCache, 'get').mockResolvedValue(Buffer.from('binary'));
+
+        const result = await dockerService.executeCode('test-container-id', 'package main\n\nfunc main() {}', 'main');
+
+        expect(mockContainer.exec).toHaveBeenCalledTimes(1);
+        expect(mockContainer.exec).toHaveBeenCalledWith(expect.objectContaining({ Cmd: ['/build/main'] }));
+        expect(dockerService.copyFileToContainer).toHaveBeenCalledWith('test-container-id', '/build/main', Buffer.from('binary'), { mode: '755' });
+        expect(result).toMatchObject({ cache: 'hit', compile: null });
+        clearTimeout(result.timeout);
+      });
+
+      it('should compile in a builder container on a miss', async () => {
+        jest.spyOn(buildCache, 'get').mockResolvedValue(null);
+        jest.spyOn(dockerService, 'compileForCache').mockResolvedValue({ exitCode: 0, timedOut: false, stdout: '', stderr: '', durationMs: 5 });
+
+        const result = await dockerService.executeCode('test-container-id', 'package main\n\nfunc main() {}', 'main');
+
+        expect(dockerService.compileForCache).toHaveBeenCalledWith('test-container-id', 'go', expect.objectContaining({
+          codeFile: 'main.go',
+          imageId: 'sha256:go-image',
+          argv: ['go', 'build', '-o', '/build/main', 'main.go'],
+          key: expect.stringMatching(/^[0-9a-f]{64}$/)
+        }));
+        expect(mockContainer.exec).toHaveBeenCalledTimes(1);
+        expect(mockContainer.exec).toHaveBeenCalledWith(expect.objectContaining({ Cmd: ['/build/main'] }));
+        expect(result).toMatchObject({ cache: 'miss', compile: { exitCode: 0 } });
+        clearTimeout(result.timeout);
+      });
+
+      it('should not cache anything when the image ID is unknown', async () => {
+        mockContainer.inspect.mockRejectedValue(new Error('inspect failed'));
+        jest.spyOn(buildCache, 'get');
+        jest.spyOn(dockerService, 'compileForCache');
+        jest.spyOn(dockerService, 'runCompilePhase').mockResolvedValue({ exitCode: 0, timedOut: false, stdout: '', stderr: '', durationMs: 5 });
+
+        const result = await dockerService.executeCode('test-container-id', 'package main\n\nfunc main() {}', 'main');
+
+        expect(buildCache.get).not.toHaveBeenCalled();
+        expect(dockerService.compileForCache).not.toHaveBeenCalled();
+        expect(result).toMatchObject({ cache: null, compile: { exitCode: 0 } });
+        clearTimeout(result.timeout);
+      });
+
+      describe('compileForCache', () => {
+        const build = {
+          codeFile: 'main.go',
+          code: 'package main\n\nfunc main() {}',
+          imageId: 'sha256:go-image',
+          argv: ['go', 'build', '-o', '/build/main', 'main.go'],
+          env: [],
+          timeoutMs: 1000,
+          key: 'b'.repeat(64)
+        };
+        const compiled = { exitCode: 0, timedOut: false, stdout: '', stderr: '', durationMs: 5 };
+        let builder;
+
+        beforeEach(() => {
+          builder = { container: { id: 'builder-id' }, userId: 'user-1' };
+          jest.spyOn(dockerService, 'createContainer').mockImplementation(async () => {
+            dockerService.containers.set('builder-id', builder);
+            return { containerId: 'builder-id' };
+          });
+          jest.spyOn(dockerService, 'getImageId').mockImplementation(async id => (id === 'builder-id' ? builder.imageId : 'sha256:go-image'));
+          jest.spyOn(dockerService, 'writeFileToContainer').mockResolvedValue();
+          jest.spyOn(dockerService, 'runCompilePhase').mockResolvedValue(compiled);
+          jest.spyOn(dockerService, 'copyFileFromContainer').mockResolvedValue(Buffer.from('binary'));
+          jest.spyOn(dockerService, 'stopContainer').mockResolvedValue();
+          jest.spyOn(buildCache, 'set').mockResolvedValue(true);
+        });
+
+        it('should compile where no program has run and copy only that binary out', async () => {
+          builder.imageId = 'sha256:go-image';
+
+          await expect(dockerService.compileForCache('test-container-id', 'go', build)).resolves.toBe(compiled);
+
+          expect(dockerService.createContainer).toHaveBeenCalledWith('go', 'build-cache', 'user-1');
+          expect(dockerService.writeFileToContainer).toHaveBeenCalledWith(builder.container, 'main.go', build.code);
+          expect(dockerService.runCompilePhase).toHaveBeenCalledTimes(1);
+          expect(dockerService.runCompilePhase).toHaveBeenCalledWith('builder-id', build.argv, [], 1000);
+          expect(dockerService.copyFileFromContainer).toHaveBeenCalledWith('builder-id', '/build/main');
+          expect(dockerService.copyFileToContainer).toHaveBeenCalledWith('test-container-id', '/build/main', Buffer.from('binary'), { mode: '755' });
+          expect(buildCache.set).toHaveBeenCalledWith('go', build.key, Buffer.from('binary'));
+          expect(dockerService.stopContainer).toHaveBeenCalledWith('builder-id', { force: true });
+        });
+
+        it('should compile in place and cache nothing when the builder runs another image', async () => {
+          builder.imageId = 'sha256:older-go-image';
+
+          await expect(dockerService.compileForCache('test-container-id', 'go', build)).resolves.toBe(compiled);
+
+          expect(dockerService.runCompilePhase).toHaveBeenCalledTimes(1);
+          expect(dockerService.runCompilePhase).toHaveBeenCalledWith('test-container-id', build.argv, [], 1000);
+          expect(buildCache.set).not.toHaveBeenCalled();
+          expect(dockerService.stopContainer).toHaveBeenCalledWith('builder-id', { force: true });
+        });
+
+        it('should return a failed compile without caching it', async () => {
+          builder.imageId = 'sha256:go-image';
+          const failed = { ...compiled, exitCode: 1, stderr: 'syntax error' };
+          dockerService.runCompilePhase.mockResolvedValue(failed);
+
+          await expect(dockerService.compileForCache('test-container-id', 'go', build)).resolves.toBe(failed);
+
+          expect(dockerService.copyFileToContainer).not.toHaveBeenCalled();
+          expect(buildCache.set).not.toHaveBeenCalled();
+        });
+      });
+    });
+
+    it('should reject project paths that escape the workspace', async () => {
+      await expect(dockerService.executeCode('test-container-id', null, 'main', {
+        files: { '../etc/passwd': 'x', 'main.js': '' },
+        entrypoint: 'main.js'
+      })).rejects.toThrow('path traversal not allowed');
+    });
   });
 
   describe('stopContainer', () => {
@@ -177,6 +686,58 @@ describe('DockerService', () => {
     });
   });
 
+  describe('hibernation', () => {
+    const workspaceId = '507f1f77bcf86cd799439011';
+
+    beforeEach(async () => {
+      mockContainer.remove = jest.fn().mockResolvedValue({});
+      await dockerService.initialize();
+      await dockerService.createContainer('node', 'workspace-1', 'user-1', { mountWorkspaceId: workspaceId });
+    });
+
+    it('should keep stopped workspace containers so they can start again', async () => {
+      const createCall = mockDocker.createContainer.mock.calls[mockDocker.createContainer.mock.calls.length - 1][0];
+      expect(createCall.HostConfig.AutoRemove).toBe(false);
+
+      await expect(dockerService.hibernateContainer('test-container-id')).resolves.toBe(true);
+
+      expect(mockContainer.stop).toHaveBeenCalledWith({ t: 5 });
+      expect(mockContainer.remove).not.toHaveBeenCalled();
+      expect(dockerService.containers.get('test-container-id').state).toBe('hibernated');
+    });
+
+    it('should resume a hibernated container before executing in it', async () => {
+      const events = [];
+      for (const name of ['resuming', 'resumed']) {
+        dockerService.hibernation.once(name, event => events.push([name, event.workspaceId]));
+      }
+      await dockerService.hibernateContainer('test-container-id');
+      mockContainer.start.mockClear();
+
+      await dockerService.executeCode('test-container-id', 'console.log("hello");');
+
+      expect(mockContainer.start).toHaveBeenCalledTimes(1);
+      expect(events).toEqual([['resuming', workspaceId], ['resumed', workspaceId]]);
+      expect(dockerService.containers.get('test-container-id').state).toBe('running');
+    });
+
+    it('should forget a container removed while it hibernated', async () => {
+      await dockerService.hibernateContainer('test-container-id');
+      const error = new Error('no such container');
+      error.statusCode = 404;
+      mockContainer.start.mockRejectedValue(error);
+
+      await expect(dockerService.executeCode('test-container-id', 'code')).rejects.toMatchObject({ code: 'CONTAINER_NOT_FOUND' });
+      expect(dockerService.containers.has('test-container-id')).toBe(false);
+    });
+
+    it('should remove workspace containers when they are stopped for good', async () => {
+      await dockerService.stopContainer('test-container-id');
+
+      expect(mockContainer.remove).toHaveBeenCalledWith({ v: true });
+    });
+  });
+
   describe('getContainerInfo', () => {
     beforeEach(async () => {
       await dockerService.initialize();
@@ -238,7 +799,7 @@ describe('DockerService', () => {
     it('should return correct execution commands', () => {
       expect(dockerService.getExecutionCommand('node', 'main.js')).toEqual(['node', 'main.js']);
       expect(dockerService.getExecutionCommand('python', 'main.py')).toEqual(['python', 'main.py']);
-      expect(dockerService.getExecutionCommand('java', 'Main.java')).toEqual(['sh', '-c', 'javac Main.java && java Main']);
+      expect(dockerService.getExecutionCommand('java', 'Main.java')).toEqual(['sh', '-c', 'javac -d /build Main.java && java -cp /build Main']);
     });
 
     it('should return correct file extensions', () => {
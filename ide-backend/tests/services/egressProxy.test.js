@@ -0,0 +1,69 @@
+const net = require('net');
+const egressProxy = require('../../services/egressProxy');
+
+describe('EgressProxy', () => {
+  describe('isAllowed', () => {
+    it('should match exact hosts case-insensitively', () => {
+      expect(egressProxy.isAllowed('Proxy.Golang.org', ['proxy.golang.org'])).toBe(true);
+      expect(egressProxy.isAllowed('evil.proxy.golang.org', ['proxy.golang.org'])).toBe(false);
+    });
+
+    it('should match wildcard entries against subdomains only', () => {
+      expect(egressProxy.isAllowed('files.pythonhosted.org', ['*.pythonhosted.org'])).toBe(true);
+      expect(egressProxy.isAllowed('pythonhosted.org', ['*.pythonhosted.org'])).toBe(false);
+      expect(egressProxy.isAllowed('notpythonhosted.org', ['*.pythonhosted.org'])).toBe(false);
+    });
+  });
+
+  describe('CONNECT tunnels', () => {
+    let upstream;
+    let upstreamPort;
+
+    const connect = (target) => new Promise((resolve, reject) => {
+      const socket = net.connect(egressProxy.server.address().port, '127.0.0.1', () => {
+        socket.write(`CONNECT ${target} HTTP/1.1\r\nHost: ${target}\r\n\r\n`);
+      });
+      socket.once('data', (data) => {
+        socket.destroy();
+        resolve(data.toString().split('\r\n')[0]);
+      });
+      socket.on('error', reject);
+    });
+
+    beforeEach(async () => {
+      upstream = net.createServer(socket => socket.end());
+      await new Promise(resolve => upstream.listen(0, '127.0.0.1', resolve));
+      upstreamPort = upstream.address().port;
+
+      egressProxy.config.proxyPort = 0;
+      egressProxy.config.allowlist = [];
+      egressProxy.clients.clear();
+      await egressProxy.start();
+    });
+
+    afterEach(async () => {
+      await egressProxy.stop();
+      egressProxy.clients.clear();
+      await new Promise(resolve => upstream.close(resolve));
+    });
+
+    it('should refuse clients that are not registered containers', async () => {
+      const status = await connect(`localhost:${upstreamPort}`);
+      expect(status).toBe('HTTP/1.1 403 Forbidden');
+    });
+
+    it('should refuse hosts outside the container allowlist', async () => {
+      egressProxy.register('container-1', '127.0.0.1', ['proxy.golang.org']);
+
+      const status = await connect(`localhost:${upstreamPort}`);
+      expect(status).toBe('HTTP/1.1 403 Forbidden');
+    });
+
+    it('should tunnel to allowlisted hosts', async () => {
+      egressProxy.register('container-1', '127.0.0.1', ['localhost']);
+
+      const status = await connect(`localhost:${upstreamPort}`);
+      expect(status).toBe('HTTP/1.1 200 Connection Established');
+    });
+  });
+});
\ No newline at end of file
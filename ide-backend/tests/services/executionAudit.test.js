@@ -0,0 +1,94 @@
+const logger = require('../../utils/logger');
+const requestContext = require('../../utils/requestContext');
+const executionAudit = require('../../services/executionAudit');
+const executionService = require('../../services/executionService');
+
+jest.mock('../../services/dockerService');
+
+describe('ExecutionAudit', () => {
+  const code = 'const secret = "hunter2"; console.log(secret);';
+
+  beforeEach(() => {
+    jest.spyOn(logger, 'info').mockImplementation(() => {});
+    jest.spyOn(logger, 'warn').mockImplementation(() => {});
+    executionService.activeExecutions.clear();
+    executionService.executionHistory.clear();
+  });
+
+  afterEach(() => {
+    logger.info.mockRestore();
+    logger.warn.mockRestore();
+  });
+
+  const entries = (event) => logger.info.mock.calls
+    .filter(([, data]) => data && data.event === event)
+    .map(([, data]) => data);
+
+  describe('measureCode', () => {
+    it('should measure single files and projects', () => {
+      expect(executionAudit.measureCode(code)).toEqual({ codeBytes: Buffer.byteLength(code), fileCount: 1 });
+      expect(executionAudit.measureCode(null, { 'main.go': 'package main', 'lib/a.go': 'ü' }))
+        .toEqual({ codeBytes: 14, fileCount: 2 });
+    });
+  });
+
+  describe('execution lifecycle', () => {
+    it('should log start and finish with the request ID and never the code', () => {
+      requestContext.run({ requestId: 'req-42' }, () => {
+        const executionId = executionService.registerExecution({
+          userId: 'user-1',
+          language: 'node',
+          containerId: 'container-1',
+          code,
+          startTime: new Date(),
+          status: 'running',
+          stdout: 'hunter2\n',
+          stderr: '',
+          ...executionAudit.measureCode(code)
+        });
+
+        const executionData = executionService.activeExecutions.get(executionId);
+        Object.assign(executionData, { status: 'completed', exitCode: 0, duration: 120, killedReason: null });
+        executionService.finishExecution(executionId);
+      });
+
+      const [start] = entries('execution.start');
+      const [finish] = entries('execution.finish');
+
+      expect(start).toMatchObject({
+        requestId: 'req-42',
+        userId: 'user-1',
+        runtime: 'node',
+        containerId: 'container-1',
+        codeBytes: Buffer.byteLength(code)
+      });
+      expect(finish).toMatchObject({
+        requestId: 'req-42',
+        exitCode: 0,
+        durationMs: 120,
+        killedReason: null,
+        stdoutBytes: 8
+      });
+
+      const logged = JSON.stringify(logger.info.mock.calls);
+      expect(logged).not.toContain('hunter2');
+    });
+
+    it('should record the kill reason of cancelled executions', async () => {
+      const executionId = executionService.registerExecution({
+        language: 'python',
+        containerId: 'container-1',
+        startTime: new Date(),
+        status: 'running'
+      });
+
+      await executionService.cancelExecution(executionId, 'user_requested');
+
+      expect(entries('execution.finish')[0]).toMatchObject({
+        executionId,
+        status: 'cancelled',
+        killedReason: 'user_requested'
+      });
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,135 @@
+const executionHistory = require('../../services/executionHistory');
+const { MemoryExecutionRepository } = require('../../services/executionHistory');
+const executionDiff = require('../../services/executionDiff');
+
+describe('ExecutionDiff', () => {
+  const execution = (id, overrides = {}) => ({
+    id,
+    userId: 'user-1',
+    language: 'python',
+    code: 'import time\nprint(time.time())',
+    filename: 'main',
+    status: 'completed',
+    exitCode: 0,
+    stdout: 'start\nok\n',
+    stderr: '',
+    output: 'start\nok\n',
+    startTime: new Date(),
+    duration: 100,
+    ...overrides
+  });
+
+  beforeEach(() => {
+    executionHistory.setRepository(new MemoryExecutionRepository());
+    executionHistory.config = { ...executionHistory.config, outputLimitBytes: 64 * 1024 };
+  });
+
+  it('should compare outcome, timing and each stream', async () => {
+    await executionHistory.record(execution('exec-1'));
+    await executionHistory.record(execution('exec-2', {
+      exitCode: 1,
+      duration: 250,
+      stdout: 'start\n',
+      stderr: 'Traceback\n',
+      output: 'start\nTraceback\n'
+    }));
+
+    const diff = await executionDiff.diff('user-1', 'exec-1', 'exec-2');
+
+    expect(diff.comparable).toBe(true);
+    expect(diff.exitCode).toEqual({ base: 0, other: 1, equal: false });
+    expect(diff.durationMs).toEqual({ base: 100, other: 250, delta: 150 });
+    expect(diff.streams.stdout.hunks[0].lines).toEqual([{ op: ' ', text: 'start' }, { op: '-', text: 'ok' }]);
+    expect(diff.streams.stderr).toMatchObject({ identical: false, added: 1, removed: 0 });
+  });
+
+  it('should normalize volatile output before comparing', async () => {
+    await executionHistory.record(execution('exec-1', { stdout: '2024-05-01T10:00:00Z object at 0x7f3a2c1d\n' }));
+    await executionHistory.record(execution('exec-2', { stdout: '2024-05-02T11:30:12Z object at 0x7f99ffee\n' }));
+
+    const raw = await executionDiff.diff('user-1', 'exec-1', 'exec-2');
+    const normalized = await executionDiff.diff('user-1', 'exec-1', 'exec-2', { presets: ['timestamps', 'addresses'] });
+    const custom = await executionDiff.diff('user-1', 'exec-1', 'exec-2', { patterns: ['\\d{4}-[\\d:TZ-]+', '0x[0-9a-f]+'] });
+
+    expect(raw.streams.stdout.identical).toBe(false);
+    expect(normalized.streams.stdout.identical).toBe(true);
+    expect(normalized.normalized).toEqual(['timestamps', 'addresses']);
+    expect(custom.streams.stdout.identical).toBe(true);
+  });
+
+  it('should flag runs of different code or runtimes', async () => {
+    await executionHistory.record(execution('exec-1'));
+    await executionHistory.record(execution('exec-2', { language: 'node', code: 'console.log("ok")' }));
+
+    const diff = await executionDiff.diff('user-1', 'exec-1', 'exec-2');
+
+    expect(diff.comparable).toBe(false);
+    expect(diff.mismatches.map(mismatch => mismatch.field)).toEqual(['runtime', 'codeHash']);
+    expect(diff.streams.stdout.identical).toBe(true);
+  });
+
+  it('should leave the truncation marker out of the diff and report the cut', async () => {
+    executionHistory.config.outputLimitBytes = 6;
+    await executionHistory.record(execution('exec-1', { stdout: 'line1\nline2\n' }));
+    await executionHistory.record(execution('exec-2', { stdout: 'line1\nother\n' }));
+
+    const { stdout } = (await executionDiff.diff('user-1', 'exec-1', 'exec-2')).streams;
+
+    expect(stdout.identical).toBe(true);
+    expect(stdout.truncated).toEqual({ base: true, other: true });
+  });
+
+  it('should fall back to the combined output of older records', async () => {
+    await executionHistory.record(execution('exec-1'));
+    await executionHistory.record(execution('exec-2', { output: 'start\nfail\n' }));
+    const record = await executionHistory.get('user-1', 'exec-2');
+    await executionHistory.getRepository().save({ ...record, output: { ...record.output, stdout: null, stderr: null } });
+
+    const diff = await executionDiff.diff('user-1', 'exec-1', 'exec-2');
+
+    expect(Object.keys(diff.streams)).toEqual(['output']);
+    expect(diff.streams.output.added).toBe(1);
+  });
+
+  it('should not diff other users\' executions', async () => {
+    await executionHistory.record(execution('exec-1'));
+    await executionHistory.record(execution('exec-2', { userId: 'user-2' }));
+
+    await expect(executionDiff.diff('user-1', 'exec-1', 'exec-2')).rejects.toMatchObject({ code: 'EXECUTION_NOT_FOUND', kind: 'not_found', param: 'otherId' });
+  });
+
+  it('should reject unknown presets and invalid patterns', () => {
+    expect(() => executionDiff.compileRules({ presets: ['pids'] })).toThrow('Unknown preset pids');
+    expect(() => executionDiff.compileRules({ patterns: ['[unclosed'] })).toThrow('Invalid pattern');
+  });
+
+  describe('with patterns that backtrack exponentially', () => {
+    let original;
+
+    beforeEach(async () => {
+      original = executionDiff.config;
+      executionDiff.config = { ...original, patternTimeoutMs: 300 };
+      await executionHistory.record(execution('exec-1', { stdout: `${'a'.repeat(40)}\n` }));
+      await executionHistory.record(execution('exec-2', { stdout: `${'a'.repeat(41)}\n` }));
+    });
+
+    afterEach(() => {
+      executionDiff.config = original;
+    });
+
+    // (a|a)* has no nested quantifier, so a check of the pattern text would pass it
+    it.each([['(a+)+b'], ['(a|a)*b'], ['(a|aa)+$']])('should stop %s at the time limit', async (source) => {
+      const startedAt = Date.now();
+
+      await expect(executionDiff.diff('user-1', 'exec-1', 'exec-2', { patterns: [source] }))
+        .rejects.toMatchObject({ code: 'PATTERN_TIMEOUT', kind: 'invalid_request', param: 'normalize' });
+      expect(Date.now() - startedAt).toBeLessThan(5000);
+    });
+
+    it('should still apply patterns that finish in time', async () => {
+      const diff = await executionDiff.diff('user-1', 'exec-1', 'exec-2', { patterns: ['a+'] });
+
+      expect(diff.streams.stdout.identical).toBe(true);
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,106 @@
+const executionHistory = require('../../services/executionHistory');
+const { MemoryExecutionRepository } = require('../../services/executionHistory');
+
+describe('ExecutionHistory', () => {
+  const execution = (id, startTime, overrides = {}) => ({
+    id,
+    userId: 'user-1',
+    language: 'python',
+    code: 'print("hi")',
+    filename: 'main',
+    status: 'completed',
+    exitCode: 0,
+    output: 'hi\n',
+    startTime,
+    endTime: new Date(startTime.getTime() + 100),
+    duration: 100,
+    ...overrides
+  });
+
+  beforeEach(() => {
+    executionHistory.setRepository(new MemoryExecutionRepository());
+    executionHistory.config = { ...executionHistory.config, outputLimitBytes: 64 * 1024, retentionDays: 30 };
+  });
+
+  describe('record', () => {
+    it('should persist the source, outcome and a hash of the code', async () => {
+      await executionHistory.record(execution('exec-1', new Date()));
+
+      const record = await executionHistory.get('user-1', 'exec-1');
+      expect(record).toMatchObject({
+        executionId: 'exec-1',
+        runtime: 'python',
+        status: 'completed',
+        exitCode: 0,
+        source: { code: 'print("hi")', files: [] },
+        output: { text: 'hi\n', bytes: 3, truncated: false }
+      });
+      expect(record.codeHash).toMatch(/^[a-f0-9]{64}$/);
+    });
+
+    it('should not show records to other users', async () => {
+      await executionHistory.record(execution('exec-1', new Date()));
+
+      expect(await executionHistory.get('user-2', 'exec-1')).toBeNull();
+    });
+
+    it('should keep records of different users with the same execution ID apart', async () => {
+      await executionHistory.record(execution('exec-1', new Date()));
+      await executionHistory.record(execution('exec-1', new Date(), { userId: 'user-2', output: 'other\n' }));
+
+      expect((await executionHistory.get('user-1', 'exec-1')).output.text).toBe('hi\n');
+      expect((await executionHistory.get('user-2', 'exec-1')).output.text).toBe('other\n');
+    });
+
+    it('should cap stored output and mark the truncation', async () => {
+      executionHistory.config.outputLimitBytes = 10;
+
+      await executionHistory.record(execution('exec-1', new Date(), { output: 'x'.repeat(25) }));
+
+      const { output } = await executionHistory.get('user-1', 'exec-1');
+      expect(output.truncated).toBe(true);
+      expect(output.bytes).toBe(25);
+      expect(output.text).toBe(`${'x'.repeat(10)}\n[output truncated: 15 more bytes]`);
+    });
+  });
+
+  describe('list', () => {
+    beforeEach(async () => {
+      const base = Date.UTC(2024, 0, 1);
+      for (let i = 0; i < 5; i++) {
+        await executionHistory.record(execution(`exec-${i}`, new Date(base + i * 1000)));
+      }
+      // Same start time as exec-4: executionId breaks the tie
+      await executionHistory.record(execution('exec-5', new Date(base + 4000)));
+    });
+
+    it('should page through the history newest first', async () => {
+      const first = await executionHistory.list('user-1', { limit: 4 });
+      expect(first.records.map(record => record.executionId)).toEqual(['exec-5', 'exec-4', 'exec-3', 'exec-2']);
+      expect(first.nextCursor).toEqual(expect.any(String));
+
+      const second = await executionHistory.list('user-1', { limit: 4, cursor: first.nextCursor });
+      expect(second.records.map(record => record.executionId)).toEqual(['exec-1', 'exec-0']);
+      expect(second.nextCursor).toBeNull();
+    });
+
+    it('should reject cursors it did not issue', async () => {
+      await expect(executionHistory.list('user-1', { cursor: 'not-a-cursor' }))
+        .rejects.toMatchObject({ code: 'INVALID_CURSOR' });
+    });
+  });
+
+  describe('prune', () => {
+    it('should delete records older than the retention window', async () => {
+      const old = new Date(Date.now() - 31 * 24 * 60 * 60 * 1000);
+      await executionHistory.record(execution('old', old));
+      await executionHistory.record(execution('recent', new Date()));
+
+      const removed = await executionHistory.prune();
+
+      expect(removed).toBe(1);
+      expect(await executionHistory.get('user-1', 'old')).toBeNull();
+      expect(await executionHistory.get('user-1', 'recent')).not.toBeNull();
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,173 @@
+const executionQueue = require('../../services/executionQueue');
+
+describe('ExecutionQueue', () => {
+  beforeEach(() => {
+    executionQueue.running = 0;
+    executionQueue.runningByUser.clear();
+    executionQueue.active.clear();
+    executionQueue.waiting = [];
+    executionQueue.draining = false;
+    executionQueue.config = {
+      enabled: true,
+      maxConcurrent: 3,
+      perUserLimit: 2,
+      maxQueueDepth: 2,
+      retryAfterSeconds: 5,
+      stuckAfterMs: 60000
+    };
+    executionQueue.resetMetrics();
+  });
+
+  describe('enqueue', () => {
+    it('should start immediately while under the limits', async () => {
+      const ticket = executionQueue.enqueue('user-1');
+
+      await ticket.ready;
+      expect(ticket.state).toBe('running');
+      expect(executionQueue.running).toBe(1);
+    });
+
+    it('should queue a user past their per-user limit and report the position', () => {
+      const onPosition = jest.fn();
+      executionQueue.enqueue('user-1');
+      executionQueue.enqueue('user-1');
+
+      const third = executionQueue.enqueue('user-1', { onPosition });
+
+      expect(third.state).toBe('waiting');
+      expect(third.position).toBe(1);
+      expect(onPosition).toHaveBeenCalledWith(1);
+    });
+
+    it('should reject with QUEUE_FULL once the wait queue is at capacity', () => {
+      executionQueue.enqueue('user-1');
+      executionQueue.enqueue('user-1');
+      executionQueue.enqueue('user-1');
+      executionQueue.enqueue('user-1');
+
+      let error;
+      try {
+        executionQueue.enqueue('user-1');
+      } catch (err) {
+        error = err;
+      }
+
+      expect(error.code).toBe('QUEUE_FULL');
+      expect(error.retryAfter).toBe(5);
+      expect(executionQueue.getMetrics().rejected).toBe(1);
+    });
+
+    it('should bypass accounting when disabled', async () => {
+      executionQueue.config.enabled = false;
+
+      const ticket = executionQueue.enqueue('user-1');
+
+      await ticket.ready;
+      expect(ticket.state).toBe('bypassed');
+      expect(executionQueue.running).toBe(0);
+    });
+  });
+
+  describe('release', () => {
+    it('should dispatch waiting tickets in FIFO order and update positions', async () => {
+      const first = executionQueue.enqueue('user-1');
+      executionQueue.enqueue('user-1');
+      const waitingA = executionQueue.enqueue('user-1');
+      const onPosition = jest.fn();
+      const waitingB = executionQueue.enqueue('user-1', { onPosition });
+
+      first.release();
+
+      await waitingA.ready;
+      expect(waitingA.state).toBe('running');
+      expect(waitingB.state).toBe('waiting');
+      expect(waitingB.position).toBe(1);
+      expect(onPosition).toHaveBeenLastCalledWith(1);
+    });
+
+    it('should skip users at their own limit when a global slot frees up', async () => {
+      const a1 = executionQueue.enqueue('user-a');
+      executionQueue.enqueue('user-a');
+      const b1 = executionQueue.enqueue('user-b');
+      const a3 = executionQueue.enqueue('user-a');
+      const b2 = executionQueue.enqueue('user-b');
+
+      // user-a is still at its own limit, so b2 overtakes a3
+      b1.release();
+
+      await b2.ready;
+      expect(b2.state).toBe('running');
+      expect(a3.state).toBe('waiting');
+      expect(a3.position).toBe(1);
+
+      a1.release();
+      await a3.ready;
+      expect(a3.state).toBe('running');
+    });
+  });
+
+  describe('cancel', () => {
+    it('should remove a waiting ticket from the queue', async () => {
+      executionQueue.enqueue('user-1');
+      executionQueue.enqueue('user-1');
+      const waiting = executionQueue.enqueue('user-1');
+
+      waiting.cancel();
+
+      await waiting.ready;
+      expect(waiting.state).toBe('cancelled');
+      expect(executionQueue.getMetrics()).toMatchObject({ queueDepth: 0, cancelled: 1 });
+    });
+  });
+
+  describe('drain', () => {
+    it('should cancel waiting tickets and refuse new ones with SHUTTING_DOWN', async () => {
+      const running = executionQueue.enqueue('user-1');
+      executionQueue.enqueue('user-1');
+      const waiting = executionQueue.enqueue('user-1');
+
+      executionQueue.drain();
+
+      await waiting.ready;
+      expect(waiting.state).toBe('cancelled');
+      expect(running.state).toBe('running');
+
+      let error;
+      try {
+        executionQueue.enqueue('user-2');
+      } catch (e) {
+        error = e;
+      }
+      expect(error.code).toBe('SHUTTING_DOWN');
+      expect(error.retryAfter).toBeGreaterThan(0);
+    });
+  });
+
+  describe('getStuck', () => {
+    it('should report running tickets held past their timeout until released', async () => {
+      const ticket = executionQueue.enqueue('user-1');
+      const long = executionQueue.enqueue('user-2', { timeoutMs: 120000 });
+      await ticket.ready;
+
+      const later = ticket.startedAt + 90000;
+      expect(executionQueue.getStuck(later)).toEqual([{ userId: 'user-1', runningMs: 90000, timeoutMs: 60000 }]);
+      expect(executionQueue.getStuck(long.startedAt + 1000)).toEqual([]);
+
+      executionQueue.release(ticket);
+      expect(executionQueue.getStuck(later)).toEqual([]);
+    });
+  });
+
+  describe('getMetrics', () => {
+    it('should record wait times in the histogram', () => {
+      executionQueue.enqueue('user-1');
+      executionQueue.enqueue('user-2');
+
+      const { waitTimeSeconds, dispatched } = executionQueue.getMetrics();
+
+      expect(dispatched).toBe(2);
+      expect(waitTimeSeconds.count).toBe(2);
+      expect(waitTimeSeconds.buckets[waitTimeSeconds.buckets.length - 1].count).toBe(2);
+    });
+  });
+});
\ No newline at end of file
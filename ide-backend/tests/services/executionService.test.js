@@ -1,5 +1,6 @@
 const executionService = require('../../services/executionService');
 const dockerService = require('../../services/dockerService');
+const config = require('../../config');
 
 // Mock the docker service
 jest.mock('../../services/dockerService');
@@ -48,7 +49,10 @@ describe('ExecutionService', () => {
 
       expect(executionId).toBeDefined();
       expect(dockerService.getContainerInfo).toHaveBeenCalledWith('container-1');
-      expect(dockerService.executeCode).toHaveBeenCalledWith('container-1', 'console.log("hello");', 'test.js');
+      expect(dockerService.executeCode).toHaveBeenCalledWith('container-1', 'console.log("hello");', 'test.js', {
+        stdin: null,
+        interactive: false
+      });
       expect(mockSocket.emit).toHaveBeenCalledWith('execution:started', expect.objectContaining({
         executionId,
         containerId: 'container-1',
@@ -72,14 +76,14 @@ describe('ExecutionService', () => {
 
     it('should handle stream data events', async () => {
       const mockStream = {
-        on: jest.fn((event, callback) => {
-          if (event === 'data') {
-            // Simulate data event
-            setTimeout(() => callback(Buffer.from('output data')), 10);
-          }
-        })
+        on: jest.fn()
       };
 
+      // Simulate demultiplexed stdout data
+      dockerService.demuxStream.mockImplementation((stream, stdout) => {
+        setTimeout(() => stdout.write(Buffer.from('output data')), 10);
+      });
+
       dockerService.getContainerInfo.mockResolvedValue({
         id: 'container-1',
         userId: 'test-user-id',
@@ -97,15 +101,105 @@ describe('ExecutionService', () => {
         code: 'console.log("hello");'
       });
 
-      // Wait for async stream events
-      await new Promise(resolve => setTimeout(resolve, 20));
+      // Wait for async stream events and the 100ms frame flush
+      await new Promise(resolve => setTimeout(resolve, 150));
 
       expect(mockSocket.emit).toHaveBeenCalledWith('execution:output', expect.objectContaining({
         executionId,
+        stream: 'stdout',
+        data: 'output data',
+        seq: 1,
         output: 'output data'
       }));
     });
 
+    it('should keep stdout and stderr frames separate', async () => {
+      const mockStream = {
+        on: jest.fn()
+      };
+
+      dockerService.demuxStream.mockImplementation((stream, stdout, stderr) => {
+        stdout.write(Buffer.from('out'));
+        stderr.write(Buffer.from('err'));
+      });
+
+      dockerService.getContainerInfo.mockResolvedValue({
+        id: 'container-1',
+        userId: 'test-user-id',
+        language: 'node'
+      });
+
+      dockerService.executeCode.mockResolvedValue({
+        stream: mockStream,
+        containerId: 'container-1',
+        language: 'node'
+      });
+
+      const executionId = await executionService.startExecution(mockSocket, {
+        containerId: 'container-1',
+        code: 'console.log("hello");'
+      });
+
+      await new Promise(resolve => setTimeout(resolve, 150));
+
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:output', expect.objectContaining({
+        executionId,
+        stream: 'stdout',
+        data: 'out'
+      }));
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:output', expect.objectContaining({
+        executionId,
+        stream: 'stderr',
+        data: 'err'
+      }));
+    });
+
+    it('should stop buffering a stream past the output cap but keep draining it', async () => {
+      const maxStreamBytes = config.outputLimits.maxStreamBytes;
+      config.outputLimits.maxStreamBytes = 8;
+      let stdoutWriter;
+      let endCallback;
+
+      const mockStream = {
+        on: jest.fn((event, callback) => {
+          if (event === 'end') {
+            endCallback = callback;
+          }
+        })
+      };
+      dockerService.demuxStream.mockImplementation((stream, stdout) => {
+        stdoutWriter = stdout;
+      });
+      dockerService.getContainerInfo.mockResolvedValue({ id: 'container-1', userId: 'test-user-id', language: 'node' });
+      dockerService.executeCode.mockResolvedValue({ stream: mockStream, containerId: 'container-1', language: 'node' });
+      dockerService.getExecExitCode.mockResolvedValue(0);
+      dockerService.detectKillReason.mockResolvedValue(null);
+
+      try {
+        const executionId = await executionService.startExecution(mockSocket, {
+          containerId: 'container-1',
+          code: 'while (true) console.log("spam")'
+        });
+
+        // Every write is accepted, so the container stream is never paused
+        for (let i = 0; i < 100; i++) {
+          expect(stdoutWriter.write(Buffer.from('spam\n'))).toBe(true);
+        }
+        await endCallback();
+
+        const record = executionService.executionHistory.get(executionId);
+        expect(record.stdout).toBe('spam\nspa\n[stdout truncated after 8 bytes]\n');
+        expect(record.outputStreams.stdout).toMatchObject({ bytes: 500, truncated: true, spilled: false });
+        expect(mockSocket.emit).toHaveBeenCalledWith('execution:exit', expect.objectContaining({
+          executionId,
+          stdout_truncated: true,
+          stderr_truncated: false
+        }));
+      } finally {
+        config.outputLimits.maxStreamBytes = maxStreamBytes;
+      }
+    });
+
     it('should handle stream end events', async () => {
       const mockStream = {
         on: jest.fn((event, callback) => {
@@ -135,6 +229,10 @@ describe('ExecutionService', () => {
       // Wait for async stream events
       await new Promise(resolve => setTimeout(resolve, 20));
 
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:exit', expect.objectContaining({
+        executionId,
+        event: 'exit'
+      }));
       expect(mockSocket.emit).toHaveBeenCalledWith('execution:completed', expect.objectContaining({
         executionId,
         status: 'completed'
@@ -181,6 +279,84 @@ describe('ExecutionService', () => {
     });
   });
 
+  describe('compile phase', () => {
+    beforeEach(() => {
+      dockerService.getContainerInfo.mockResolvedValue({
+        id: 'container-1',
+        userId: 'test-user-id',
+        language: 'go'
+      });
+      dockerService.terminateExecution.mockResolvedValue();
+    });
+
+    it('should report a compile timeout without running the program', async () => {
+      dockerService.executeCode.mockResolvedValue({
+        stream: null,
+        containerId: 'container-1',
+        language: 'go',
+        timedOut: true,
+        timeoutPhase: 'compile',
+        compile: { exitCode: null, stdout: '', stderr: '', durationMs: 10000, timedOut: true }
+      });
+
+      const executionId = await executionService.startExecution(mockSocket, {
+        containerId: 'container-1',
+        code: 'package main',
+        compileTimeoutMs: 10000
+      });
+
+      await new Promise(resolve => setTimeout(resolve, 20));
+
+      expect(dockerService.executeCode).toHaveBeenCalledWith('container-1', 'package main', 'main', expect.objectContaining({
+        compileTimeoutMs: 10000
+      }));
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:exit', expect.objectContaining({
+        executionId,
+        status: 'timeout',
+        code: null,
+        killed_reason: 'timeout',
+        timeout_phase: 'compile'
+      }));
+      expect(dockerService.terminateExecution).toHaveBeenCalled();
+      expect(executionService.getExecutionStatus(executionId)).toMatchObject({ timeoutPhase: 'compile' });
+    });
+
+    it('should forward build errors as output and diagnostics', async () => {
+      dockerService.executeCode.mockResolvedValue({
+        stream: null,
+        containerId: 'container-1',
+        language: 'go',
+        timedOut: false,
+        timeoutPhase: null,
+        compile: { exitCode: 1, stdout: '', stderr: './main.go:3:2: undefined: foo\n', durationMs: 800, timedOut: false }
+      });
+
+      const executionId = await executionService.startExecution(mockSocket, {
+        containerId: 'container-1',
+        code: 'package main'
+      });
+
+      await new Promise(resolve => setTimeout(resolve, 20));
+
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:output', expect.objectContaining({
+        executionId,
+        stream: 'stderr',
+        data: './main.go:3:2: undefined: foo\n'
+      }));
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:exit', expect.objectContaining({
+        status: 'compile_error',
+        code: 1,
+        killed_reason: null,
+        timeout_phase: null
+      }));
+      expect(executionService.executionHistory.get(executionId)).toMatchObject({
+        compileFailed: true,
+        compileDurationMs: 800
+      });
+      expect(dockerService.terminateExecution).not.toHaveBeenCalled();
+    });
+  });
+
   describe('stopExecution', () => {
     it('should stop active execution', async () => {
       // First start an execution
@@ -218,6 +394,66 @@ describe('ExecutionService', () => {
     });
   });
 
+  describe('stdin', () => {
+    let mockStream;
+    let endCallback;
+
+    beforeEach(async () => {
+      endCallback = null;
+      mockStream = {
+        on: jest.fn((event, callback) => {
+          if (event === 'end') {
+            endCallback = callback;
+          }
+        }),
+        write: jest.fn(),
+        end: jest.fn()
+      };
+
+      dockerService.getContainerInfo.mockResolvedValue({
+        id: 'container-1',
+        userId: 'test-user-id',
+        language: 'python'
+      });
+      dockerService.executeCode.mockResolvedValue({
+        stream: mockStream,
+        containerId: 'container-1',
+        language: 'python',
+        stdinOpen: true
+      });
+    });
+
+    it('should forward stdin frames and signal EOF', async () => {
+      const executionId = await executionService.startExecution(mockSocket, {
+        containerId: 'container-1',
+        code: 'input()',
+        interactive: true
+      });
+
+      expect(executionService.writeStdin(executionId, 'hello\n')).toBe(true);
+      expect(mockStream.write).toHaveBeenCalledWith('hello\n');
+
+      expect(executionService.closeStdin(executionId)).toBe(true);
+      expect(mockStream.end).toHaveBeenCalledTimes(1);
+
+      // Once EOF is sent, further input is dropped
+      expect(executionService.writeStdin(executionId, 'late')).toBe(false);
+    });
+
+    it('should stop forwarding stdin once the process exits', async () => {
+      const executionId = await executionService.startExecution(mockSocket, {
+        containerId: 'container-1',
+        code: 'input()',
+        interactive: true
+      });
+
+      await endCallback();
+
+      expect(executionService.writeStdin(executionId, 'late')).toBe(false);
+      expect(mockStream.write).not.toHaveBeenCalled();
+    });
+  });
+
   describe('getExecutionStatus', () => {
     it('should return status for active execution', async () => {
       const mockStream = { on: jest.fn() };
@@ -308,6 +544,14 @@ describe('ExecutionService', () => {
       });
     });
 
+    it('should include re-runs, which have no socket', () => {
+      executionService.registerExecution({ id: 'rerun-1', userId: 'test-user-id', language: 'python', status: 'running', startTime: new Date() });
+
+      expect(executionService.getUserExecutions('test-user-id')).toEqual([
+        expect.objectContaining({ id: 'rerun-1', status: 'running', language: 'python' })
+      ]);
+    });
+
     it('should return empty array for user with no executions', () => {
       const executions = executionService.getUserExecutions('other-user');
       expect(executions).toEqual([]);
@@ -333,6 +577,467 @@ describe('ExecutionService', () => {
     });
   });
 
+  describe('cancelExecution', () => {
+    let executionId;
+    let execution;
+
+    beforeEach(async () => {
+      execution = {
+        stream: { on: jest.fn(), destroy: jest.fn() },
+        exec: {},
+        containerId: 'container-1',
+        language: 'node'
+      };
+
+      dockerService.getContainerInfo.mockResolvedValue({
+        id: 'container-1',
+        userId: 'test-user-id',
+        language: 'node'
+      });
+      dockerService.executeCode.mockResolvedValue(execution);
+      dockerService.terminateExecution.mockResolvedValue();
+
+      executionId = await executionService.startExecution(mockSocket, {
+        containerId: 'container-1',
+        code: 'while (true) {}'
+      });
+    });
+
+    it('should terminate the container with the grace period and report the cancellation', async () => {
+      const cancelled = await executionService.cancelExecution(executionId, 'user_cancelled', 2000);
+
+      expect(cancelled).toBe(true);
+      expect(execution.stream.destroy).toHaveBeenCalled();
+      expect(dockerService.terminateExecution).toHaveBeenCalledWith(execution, 2000);
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:cancelled', expect.objectContaining({
+        executionId,
+        event: 'cancelled',
+        reason: 'user_cancelled'
+      }));
+      expect(executionService.activeExecutions.has(executionId)).toBe(false);
+      expect(executionService.executionHistory.get(executionId).status).toBe('cancelled');
+    });
+
+    it('should return false for executions that already finished', async () => {
+      await executionService.cancelExecution(executionId);
+      dockerService.terminateExecution.mockClear();
+
+      expect(await executionService.cancelExecution(executionId)).toBe(false);
+      expect(dockerService.terminateExecution).not.toHaveBeenCalled();
+    });
+
+    it('should track the owning user', () => {
+      expect(executionService.activeExecutions.get(executionId).userId).toBe('test-user-id');
+    });
+  });
+
+  describe('rerunExecution', () => {
+    const executionHistory = require('../../services/executionHistory');
+
+    it('should run the stored source again and record it as a re-run', async () => {
+      executionHistory.setRepository(new executionHistory.MemoryExecutionRepository());
+      const handlers = {};
+      const mockStream = {
+        on: jest.fn((event, handler) => { handlers[event] = handler; })
+      };
+      dockerService.executeCode.mockResolvedValue({ stream: mockStream, containerId: 'container-1', language: 'python', exec: null });
+      dockerService.detectKillReason.mockResolvedValue(null);
+
+      const record = {
+        executionId: 'exec-old',
+        runtime: 'python',
+        source: { code: 'print(input())', filename: 'main', files: [], entrypoint: null, workspaceId: null, stdin: 'hi\n' }
+      };
+
+      const { executionId, status } = await executionService.rerunExecution(
+        record,
+        { id: 'container-1', language: 'python', userId: 'test-user-id' },
+        'test-user-id'
+      );
+      expect(status).toBe('running');
+
+      // Let the queue ticket resolve and the run start
+      await new Promise(resolve => setImmediate(resolve));
+      expect(dockerService.executeCode).toHaveBeenCalledWith('container-1', 'print(input())', 'main', expect.objectContaining({ stdin: 'hi\n' }));
+
+      await handlers.end();
+      await new Promise(resolve => setImmediate(resolve));
+
+      const stored = await executionHistory.get('test-user-id', executionId);
+      expect(stored).toMatchObject({ rerunOf: 'exec-old', status: 'completed' });
+    });
+
+    it.each([
+      ['ACCESS_DENIED', 'No access to workspace secrets'],
+      ['SECRETS_DISABLED', 'Workspace secrets are not configured on this server']
+    ])('should record an error entry when the secrets are unavailable (%s)', async (code, message) => {
+      const workspaceSecrets = require('../../services/workspaceSecrets');
+      const executionQueue = require('../../services/executionQueue');
+      executionHistory.setRepository(new executionHistory.MemoryExecutionRepository());
+      const forExecution = jest.spyOn(workspaceSecrets, 'forExecution').mockRejectedValue(Object.assign(new Error(message), { code }));
+      const release = jest.spyOn(executionQueue, 'release');
+
+      const record = {
+        executionId: 'exec-old',
+        runtime: 'python',
+        source: { code: 'print(1)', filename: 'main', files: [], entrypoint: null, workspaceId: null, stdin: null, secretsWorkspaceId: 'ws-1' }
+      };
+      const { executionId } = await executionService.rerunExecution(record, { id: 'container-1', language: 'python', userId: 'test-user-id' }, 'test-user-id');
+      await new Promise(resolve => setImmediate(resolve));
+
+      expect(dockerService.executeCode).not.toHaveBeenCalled();
+      const stored = await executionHistory.get('test-user-id', executionId);
+      expect(stored).toMatchObject({ rerunOf: 'exec-old', status: 'error', error: message, errorCode: code });
+      expect(release).toHaveBeenCalledWith(expect.objectContaining({ userId: 'test-user-id' }));
+
+      forExecution.mockRestore();
+      release.mockRestore();
+    });
+
+    it('should record an error entry and give the slot back when a started re-run breaks down', async () => {
+      const executionQueue = require('../../services/executionQueue');
+      executionHistory.setRepository(new executionHistory.MemoryExecutionRepository());
+      dockerService.executeCode.mockResolvedValue({ stream: { on: jest.fn() }, containerId: 'container-1', language: 'python', exec: null });
+      const stream = jest.spyOn(executionService, 'streamExecution').mockImplementation(() => {
+        throw new Error('stream setup failed');
+      });
+      const release = jest.spyOn(executionQueue, 'release');
+
+      const record = {
+        executionId: 'exec-old',
+        runtime: 'python',
+        source: { code: 'print(1)', filename: 'main', files: [], entrypoint: null, workspaceId: null, stdin: null }
+      };
+      const { executionId } = await executionService.rerunExecution(record, { id: 'container-1', language: 'python', userId: 'test-user-id' }, 'test-user-id');
+      await new Promise(resolve => setImmediate(resolve));
+
+      expect(executionService.activeExecutions.has(executionId)).toBe(false);
+      expect(executionService.queuedReruns.has(executionId)).toBe(false);
+      const stored = await executionHistory.get('test-user-id', executionId);
+      expect(stored).toMatchObject({ rerunOf: 'exec-old', status: 'error', error: 'stream setup failed' });
+      expect(release).toHaveBeenCalledWith(expect.objectContaining({ userId: 'test-user-id' }));
+
+      stream.mockRestore();
+      release.mockRestore();
+    });
+  });
+
+  describe('drain', () => {
+    const executionQueue = require('../../services/executionQueue');
+
+    afterEach(() => {
+      executionQueue.draining = false;
+    });
+
+    it('should wait for running executions to finish', async () => {
+      executionService.registerExecution({ id: 'exec-1', userId: 'test-user-id', status: 'running', startTime: new Date() });
+      setTimeout(() => executionService.finishExecution('exec-1'), 20);
+
+      const remaining = await executionService.drain(1000, 5);
+
+      expect(remaining).toBe(0);
+      expect(executionQueue.draining).toBe(true);
+      expect(executionService.executionHistory.has('exec-1')).toBe(true);
+    });
+
+    it('should give up after the drain period', async () => {
+      executionService.registerExecution({ id: 'exec-1', userId: 'test-user-id', status: 'running', startTime: new Date() });
+
+      const remaining = await executionService.drain(20, 5);
+
+      expect(remaining).toBe(1);
+    });
+  });
+
+  describe('with a fake sandbox', () => {
+    const FakeSandbox = require('../../services/fakeSandbox');
+    const sandboxes = require('../../services/sandboxes');
+    const executionQueue = require('../../services/executionQueue');
+    let fake;
+    let queueConfig;
+
+    beforeEach(() => {
+      fake = sandboxes.register(new FakeSandbox());
+      sandboxes.config.defaultProvider = 'fake';
+      queueConfig = executionQueue.config;
+      executionQueue.config = { ...queueConfig, enabled: true, maxConcurrent: 1, perUserLimit: 1, maxQueueDepth: 5 };
+    });
+
+    afterEach(() => {
+      sandboxes.providers.delete('fake');
+      sandboxes.config.defaultProvider = 'docker';
+      executionQueue.config = queueConfig;
+    });
+
+    const exitEvent = (socket) => socket.emit.mock.calls.find(([event]) => event === 'execution:exit');
+
+    it('should stream output and report the exit code', async () => {
+      const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id');
+
+      await executionService.startExecution(mockSocket, { containerId, code: 'print(1)', filename: 'main' });
+      const [execution] = fake.executions;
+      fake.output(execution, 'stdout', '1\n');
+      fake.exit(execution, 3);
+      await new Promise(resolve => setTimeout(resolve, 150));
+
+      expect(exitEvent(mockSocket)[1]).toEqual(expect.objectContaining({ status: 'runtime_error', code: 3, killed_reason: null }));
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:completed', expect.objectContaining({ output: '1\n' }));
+    });
+
+    it('should kill a program that runs past its run timeout', async () => {
+      const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id');
+
+      await executionService.startExecution(mockSocket, { containerId, code: 'while True: pass', runTimeoutMs: 20 });
+      await new Promise(resolve => setTimeout(resolve, 60));
+
+      expect(exitEvent(mockSocket)[1]).toEqual(expect.objectContaining({ status: 'timeout', code: null, killed_reason: 'timeout', timeout_phase: 'run' }));
+      expect(fake.killed).toEqual([{ containerId, graceMs: 0 }]);
+      expect(executionQueue.running).toBe(0);
+    });
+
+    it('should report an OOM kill as a result rather than an error', async () => {
+      const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id');
+
+      await executionService.startExecution(mockSocket, { containerId, code: 'x = [0] * 10**10' });
+      fake.exit(fake.executions[0], 137, 'oom');
+      await new Promise(resolve => setTimeout(resolve, 150));
+
+      expect(exitEvent(mockSocket)[1]).toEqual(expect.objectContaining({ status: 'oom', code: 137, killed_reason: 'oom' }));
+      expect(mockSocket.emit).not.toHaveBeenCalledWith('execution:error', expect.anything());
+    });
+
+    it('should collect the files matching its artifact patterns within the caps', async () => {
+      const os = require('os');
+      const path = require('path');
+      const fs = require('fs');
+      const artifactStore = require('../../services/artifactStore');
+      const storeConfig = artifactStore.config;
+      const artifactsConfig = config.artifacts;
+      artifactStore.config = { ...storeConfig, path: fs.mkdtempSync(path.join(os.tmpdir(), 'artifacts-')) };
+      config.artifacts = { ...artifactsConfig, maxBytes: 10 };
+      const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id');
+
+      try {
+        const executionId = await executionService.startExecution(mockSocket, { containerId, code: 'plot()', artifacts: ['out/*.csv', 'missing/**'] });
+        const [execution] = fake.executions;
+        fake.containers.get(containerId).files = {
+          'main.py': 'plot()',
+          'out/a.csv': '1,2\n',
+          'out/b.csv': 'x'.repeat(10),
+          'out/nested/c.csv': '3\n'
+        };
+        fake.exit(execution, 0);
+        await new Promise(resolve => setTimeout(resolve, 150));
+
+        const { artifacts } = exitEvent(mockSocket)[1];
+        expect(artifacts).toEqual({
+          files: [{ name: 'out/a.csv', size: 4, mimeType: 'text/plain; charset=utf-8', url: `/api/executions/${executionId}/artifacts/out%2Fa.csv` }],
+          truncated: true
+        });
+        const file = await artifactStore.find(executionId, 'out/a.csv');
+        expect(fs.readFileSync(file.path, 'utf8')).toBe('1,2\n');
+      } finally {
+        fs.rmSync(artifactStore.config.path, { recursive: true, force: true });
+        artifactStore.config = storeConfig;
+        config.artifacts = artifactsConfig;
+      }
+    });
+
+    it('should reject artifact patterns that leave the workspace', async () => {
+      const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id');
+
+      await expect(executionService.startExecution(mockSocket, { containerId, code: 'print(1)', artifacts: ['../etc/passwd'] }))
+        .rejects.toMatchObject({ code: 'VALIDATION_FAILED' });
+
+      expect(fake.executions).toHaveLength(0);
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:error', expect.objectContaining({ code: 'VALIDATION_FAILED', kind: 'invalid_request' }));
+    });
+
+    it('should inject workspace secrets, mask them in the output and drop deleted ones', async () => {
+      const workspaceSecrets = require('../../services/workspaceSecrets');
+      const secretsConfig = workspaceSecrets.config;
+      workspaceSecrets.config = { ...secretsConfig, key: require('crypto').randomBytes(32).toString('base64') };
+      workspaceSecrets.setRepository(new workspaceSecrets.MemorySecretRepository());
+      jest.spyOn(workspaceSecrets, 'authorize').mockResolvedValue();
+      await workspaceSecrets.set('workspace-1', 'API_TOKEN', 'tok-123456', 'test-user-id');
+      const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id', { mountWorkspaceId: 'workspace-1' });
+
+      try {
+        await executionService.startExecution(mockSocket, { containerId, code: 'print(token)', useSecrets: true });
+        const [execution] = fake.executions;
+        expect(execution.options.secrets).toEqual({ API_TOKEN: 'tok-123456' });
+
+        // Split across writes, as a program's output can be
+        fake.output(execution, 'stdout', 'token=tok-12');
+        fake.output(execution, 'stdout', '3456\n');
+        fake.exit(execution, 0);
+        await new Promise(resolve => setTimeout(resolve, 150));
+
+        const output = mockSocket.emit.mock.calls
+          .filter(([event]) => event === 'execution:output')
+          .map(([, frame]) => frame.data)
+          .join('');
+        expect(output).toBe('token=*****\n');
+        expect([...executionService.executionHistory.values()][0].output).toBe('token=*****\n');
+        expect(executionService.executionSecrets.size).toBe(0);
+
+        await workspaceSecrets.remove('workspace-1', 'API_TOKEN', 'test-user-id');
+        await executionService.startExecution(mockSocket, { containerId, code: 'print(token)', useSecrets: true });
+        expect(fake.executions[1].options.secrets).toEqual({});
+        fake.exit(fake.executions[1], 0);
+        await new Promise(resolve => setTimeout(resolve, 150));
+      } finally {
+        workspaceSecrets.authorize.mockRestore();
+        workspaceSecrets.config = secretsConfig;
+      }
+    });
+
+    describe('reattaching', () => {
+      const executionSessions = require('../../services/executionSessions');
+      let sessionsConfig;
+
+      const newSocket = () => ({ emit: jest.fn(), on: jest.fn(), userId: 'test-user-id' });
+      const disconnect = (socket) => socket.on.mock.calls
+        .filter(([event]) => event === 'disconnect')
+        .forEach(([, handler]) => handler());
+      const outputOf = (socket) => socket.emit.mock.calls
+        .filter(([event]) => event === 'execution:output')
+        .map(([, frame]) => frame.data)
+        .join('');
+      const tick = (ms) => new Promise(resolve => setTimeout(resolve, ms));
+
+      beforeEach(() => {
+        sessionsConfig = executionSessions.config;
+        executionSessions.config = { ...sessionsConfig, reattachGraceMs: 50 };
+        executionSessions.setStore(new executionSessions.MemorySessionStore());
+      });
+
+      afterEach(() => {
+        executionSessions.config = sessionsConfig;
+      });
+
+      it('should replay frames after lastSeq and keep the run going on the new socket', async () => {
+        const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id');
+        const executionId = await executionService.startExecution(mockSocket, { containerId, code: 'print(1)' });
+        const [execution] = fake.executions;
+        fake.output(execution, 'stdout', 'a\n');
+        await tick(150);
+        fake.output(execution, 'stdout', 'b\n');
+        await tick(150);
+
+        disconnect(mockSocket);
+        const socket = newSocket();
+        const reattached = await executionService.reattachExecution(socket, executionId, 1);
+        await tick(80); // past the grace period
+
+        expect(reattached).toMatchObject({ owner: 'local', phase: 'running', replayed: 1, gap: false });
+        expect(fake.killed).toEqual([]);
+
+        fake.output(execution, 'stdout', 'c\n');
+        fake.exit(execution, 0);
+        await tick(150);
+
+        expect(outputOf(socket)).toBe('b\nc\n');
+        expect(outputOf(mockSocket)).toBe('a\nb\n');
+        expect(socket.emit).toHaveBeenCalledWith('execution:exit', expect.objectContaining({ executionId, status: 'ok' }));
+      });
+
+      it('should cancel a disconnected run nobody reattaches to', async () => {
+        const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id');
+        const executionId = await executionService.startExecution(mockSocket, { containerId, code: 'input()' });
+
+        disconnect(mockSocket);
+        await tick(20);
+        expect(executionService.activeExecutions.has(executionId)).toBe(true);
+        await tick(60);
+
+        expect(fake.killed.map(kill => kill.containerId)).toEqual([containerId]);
+      });
+
+      it('should relay a run owned by another instance until it ends', async () => {
+        const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id');
+        const executionId = await executionService.startExecution(mockSocket, { containerId, code: 'print(1)' });
+        const [execution] = fake.executions;
+        fake.output(execution, 'stdout', 'a\n');
+        await tick(150);
+
+        // As seen from an instance that doesn't run it
+        const store = executionSessions.getStore();
+        await store.save({ ...(await store.get(executionId)), instanceId: 'replica-b' });
+        await store.heartbeat('replica-b', 1000);
+
+        const socket = newSocket();
+        const reattached = await executionService.reattachExecution(socket, executionId, 0);
+        fake.output(execution, 'stdout', 'b\n');
+        fake.exit(execution, 4);
+        await tick(150);
+
+        expect(reattached).toMatchObject({ owner: 'remote', instanceId: 'replica-b', replayed: 1 });
+        expect(outputOf(socket)).toBe('a\nb\n');
+        expect(socket.emit).toHaveBeenCalledWith('execution:exit', expect.objectContaining({ status: 'runtime_error', code: 4 }));
+        expect((await store.get(executionId)).attachedAt).toEqual(expect.any(String));
+      });
+
+      it('should send the buffered tail and a lost error when the owning instance is gone', async () => {
+        const store = executionSessions.getStore();
+        await store.save({ executionId: 'exec-gone', userId: 'test-user-id', instanceId: 'replica-gone', phase: 'running', final: null });
+        for (const seq of [1, 2, 3]) {
+          await store.append('exec-gone', { stream: 'stdout', data: `${seq}\n`, seq }, { maxFrames: 2 });
+        }
+
+        const socket = newSocket();
+        const reattached = await executionService.reattachExecution(socket, 'exec-gone', 0);
+
+        expect(reattached).toMatchObject({ owner: 'gone', replayed: 2, gap: true });
+        expect(outputOf(socket)).toBe('2\n3\n');
+        expect(socket.emit).toHaveBeenCalledWith('execution:error', expect.objectContaining({ code: 'EXECUTION_LOST' }));
+        await expect(executionService.reattachExecution(newSocket(), 'exec-unknown', 0)).rejects.toMatchObject({ code: 'EXECUTION_NOT_FOUND' });
+      });
+    });
+
+    it('should keep the slot of a program whose client left during exec until it is killed', async () => {
+      const { containerId } = await fake.create('python', 'workspace-1', 'test-user-id');
+      let started;
+      const exec = fake.exec.bind(fake);
+      jest.spyOn(fake, 'exec').mockImplementation((...args) => new Promise((resolve) => {
+        started = () => resolve(exec(...args));
+      }));
+
+      const starting = executionService.startExecution(mockSocket, { containerId, code: 'print(1)' });
+      await new Promise(resolve => setTimeout(resolve, 20));
+      mockSocket.on.mock.calls.filter(([event]) => event === 'disconnect').forEach(([, handler]) => handler());
+      expect(executionQueue.running).toBe(1);
+
+      started();
+      const executionId = await starting;
+
+      expect(fake.killed).toEqual([{ containerId, graceMs: 0 }]);
+      expect(executionService.activeExecutions.has(executionId)).toBe(false);
+      expect(executionQueue.running).toBe(0);
+    });
+
+    it('should hold a second execution in the queue until the first releases its slot', async () => {
+      const first = await fake.create('python', 'workspace-1', 'test-user-id');
+      const second = await fake.create('python', 'workspace-1', 'test-user-id');
+
+      await executionService.startExecution(mockSocket, { containerId: first.containerId, code: 'input()' });
+      const queued = executionService.startExecution(mockSocket, { containerId: second.containerId, code: 'print(2)' });
+      await new Promise(resolve => setImmediate(resolve));
+
+      expect(mockSocket.emit).toHaveBeenCalledWith('execution:queued', expect.objectContaining({ position: 1 }));
+      expect(fake.executions).toHaveLength(1);
+
+      fake.exit(fake.executions[0], 0);
+      await queued;
+
+      expect(fake.executions).toHaveLength(2);
+      expect(fake.executions[1].containerId).toBe(second.containerId);
+      fake.exit(fake.executions[1], 0);
+      await new Promise(resolve => setTimeout(resolve, 150));
+      expect(executionQueue.running).toBe(0);
+    });
+  });
+
   describe('getStats', () => {
     it('should return execution statistics', async () => {
       // Add some executions
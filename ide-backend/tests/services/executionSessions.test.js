@@ -0,0 +1,79 @@
+const { ExecutionSessions, MemorySessionStore } = require('../../services/executionSessions');
+
+describe('ExecutionSessions', () => {
+  let store;
+  let replicaA;
+  let replicaB;
+
+  const sessions = (instanceId) => {
+    const service = new ExecutionSessions();
+    service.config = { ...service.config, instanceId, ringFrames: 3 };
+    service.instanceId = instanceId;
+    service.setStore(store);
+    return service;
+  };
+
+  const frame = (seq) => ({ stream: 'stdout', data: `${seq}\n`, seq });
+
+  beforeEach(async () => {
+    store = new MemorySessionStore();
+    replicaA = sessions('replica-a');
+    replicaB = sessions('replica-b');
+    await replicaA.track({ id: 'exec-1', containerId: 'container-1', userId: 'user-1', language: 'python', startTime: new Date() });
+  });
+
+  afterEach(() => {
+    replicaA.stop();
+    replicaB.stop();
+  });
+
+  it('should record which instance owns an execution', async () => {
+    expect(await replicaB.get('exec-1')).toMatchObject({
+      executionId: 'exec-1',
+      containerId: 'container-1',
+      instanceId: 'replica-a',
+      phase: 'running',
+      final: null
+    });
+  });
+
+  it('should keep the latest frames and report a gap after lastSeq', async () => {
+    for (const seq of [1, 2, 3, 4, 5]) {
+      await replicaA.frame('exec-1', frame(seq));
+    }
+
+    const caughtUp = await replicaB.reattach('exec-1', 'user-1', 3);
+    expect(caughtUp.frames.map(f => f.seq)).toEqual([4, 5]);
+    expect(caughtUp.gap).toBe(false);
+
+    const behind = await replicaB.reattach('exec-1', 'user-1', 1);
+    expect(behind.frames.map(f => f.seq)).toEqual([3, 4, 5]);
+    expect(behind.gap).toBe(true);
+  });
+
+  it('should tell local, remote and vanished owners apart', async () => {
+    expect((await replicaA.reattach('exec-1', 'user-1')).owner).toBe('local');
+    expect((await replicaB.reattach('exec-1', 'user-1')).owner).toBe('remote');
+
+    replicaA.stop();
+    await store.heartbeat('replica-a', -1);
+    expect((await replicaB.reattach('exec-1', 'user-1')).owner).toBe('gone');
+  });
+
+  it('should only reattach the execution\'s own user', async () => {
+    expect(await replicaB.reattach('exec-1', 'user-2')).toBeNull();
+    expect(await replicaB.reattach('exec-unknown', 'user-1')).toBeNull();
+  });
+
+  it('should store and publish the final event', async () => {
+    const messages = [];
+    const unsubscribe = replicaB.subscribe('exec-1', message => messages.push(message));
+
+    await replicaA.frame('exec-1', frame(1));
+    await replicaA.finish('exec-1', { executionId: 'exec-1', event: 'exit', status: 'ok', code: 0 });
+    unsubscribe();
+
+    expect(messages.map(message => message.type)).toEqual(['frame', 'final']);
+    expect(await replicaB.get('exec-1')).toMatchObject({ phase: 'finished', final: { event: 'exit', status: 'ok' } });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,120 @@
+jest.mock('../../services/dockerService');
+
+const dockerService = require('../../services/dockerService');
+const { FormatService } = require('../../services/formatService');
+
+describe('FormatService', () => {
+  let formatService;
+  let containers;
+
+  const ok = (stdout) => ({ exitCode: 0, stdout, stderr: '', durationMs: 40, timedOut: false, truncated: false });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    formatService = new FormatService();
+    formatService.config = { workers: 1, maxQueued: 1, timeoutMs: 5000, maxSourceBytes: 64, idleTimeoutMs: 1000 };
+
+    containers = 0;
+    dockerService.createContainer.mockImplementation(async () => ({ containerId: `format-${++containers}` }));
+    dockerService.stopContainer.mockResolvedValue();
+  });
+
+  afterEach(() => {
+    formatService.shutdown();
+  });
+
+  it('should pipe the source through the formatter and reuse the container', async () => {
+    dockerService.runBufferedExec.mockResolvedValue(ok('x = 1\n'));
+
+    const first = await formatService.format('python', 'x=1');
+    const second = await formatService.format('python', 'x = 1\n');
+
+    expect(first).toEqual({ status: 'ok', formatted: 'x = 1\n', changed: true, errors: [], durationMs: 40 });
+    expect(second.changed).toBe(false);
+    expect(dockerService.runBufferedExec).toHaveBeenCalledWith('format-1', ['black', '--quiet', '-'], expect.objectContaining({
+      stdin: 'x=1',
+      timeoutMs: 5000,
+      phase: 'format'
+    }));
+    expect(dockerService.createContainer).toHaveBeenCalledTimes(1);
+  });
+
+  it('should name the stdin file after the requested extension', async () => {
+    dockerService.runBufferedExec.mockResolvedValue(ok('let x: number = 1;\n'));
+
+    await formatService.format('node', 'let x:number=1', { filename: 'util.ts' });
+
+    expect(dockerService.runBufferedExec).toHaveBeenCalledWith('format-1', ['prettier', '--stdin-filepath', 'util.ts'], expect.anything());
+    await expect(formatService.format('node', 'x', { filename: 'main.py' })).rejects.toMatchObject({ code: 'INVALID_FILENAME', kind: 'invalid_request' });
+  });
+
+  it('should report syntax errors as a result', async () => {
+    dockerService.runBufferedExec.mockResolvedValue({
+      exitCode: 2,
+      stdout: '',
+      stderr: '<standard input>:3:1: expected declaration, found fmt\n',
+      durationMs: 30,
+      timedOut: false,
+      truncated: false
+    });
+
+    const result = await formatService.format('go', 'package main\n\nfmt.Println()');
+
+    expect(result.status).toBe('syntax_error');
+    expect(result.formatted).toBeNull();
+    expect(result.errors).toEqual([{ file: 'main.go', line: 3, col: 1, severity: 'error', message: 'expected declaration, found fmt' }]);
+  });
+
+  it('should replace a container that overran the timeout', async () => {
+    dockerService.runBufferedExec.mockResolvedValueOnce({ exitCode: null, stdout: '', stderr: '', durationMs: 5000, timedOut: true, truncated: false });
+    dockerService.runBufferedExec.mockResolvedValueOnce(ok('x = 1\n'));
+
+    expect((await formatService.format('python', 'x=1')).status).toBe('timeout');
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('format-1', { force: true });
+
+    await formatService.format('python', 'x=1');
+    expect(dockerService.runBufferedExec).toHaveBeenLastCalledWith('format-2', expect.anything(), expect.anything());
+  });
+
+  it('should reject oversized source and runtimes without a formatter', async () => {
+    await expect(formatService.format('python', 'x'.repeat(65))).rejects.toMatchObject({ code: 'SOURCE_TOO_LARGE', kind: 'too_large' });
+    await expect(formatService.format('java', 'class Main {}')).rejects.toMatchObject({ code: 'FORMAT_NOT_SUPPORTED', param: 'runtime' });
+    expect(dockerService.createContainer).not.toHaveBeenCalled();
+  });
+
+  it('should queue requests behind busy workers and turn away the overflow', async () => {
+    let finish;
+    dockerService.runBufferedExec.mockImplementationOnce(() => new Promise(resolve => {
+      finish = () => resolve(ok('a = 1\n'));
+    }));
+    dockerService.runBufferedExec.mockResolvedValue(ok('b = 1\n'));
+
+    const running = formatService.format('python', 'a=1');
+    while (!finish) {
+      await new Promise(resolve => setImmediate(resolve));
+    }
+    const queued = formatService.format('python', 'b=1');
+
+    await expect(formatService.format('python', 'c=1')).rejects.toMatchObject({ code: 'FORMAT_BUSY', kind: 'rate_limited' });
+
+    finish();
+    expect((await running).formatted).toBe('a = 1\n');
+    expect((await queued).formatted).toBe('b = 1\n');
+    expect(dockerService.createContainer).toHaveBeenCalledTimes(1);
+  });
+
+  it('should disable runtimes whose image lacks the formatter', async () => {
+    dockerService.runBufferedExec.mockImplementation(async (containerId, argv) => (
+      argv[argv.length - 1] === 'goimports' ? { ...ok(''), exitCode: 1 } : ok('/usr/local/bin/formatter\n')
+    ));
+
+    const results = await formatService.verify(['python', 'go', 'java']);
+
+    expect(results).toEqual({ python: true, go: false });
+    await expect(formatService.format('go', 'package main')).rejects.toMatchObject({ code: 'FORMATTER_UNAVAILABLE', kind: 'unavailable' });
+
+    formatService.flush('go');
+    dockerService.runBufferedExec.mockResolvedValue(ok('package main\n'));
+    expect((await formatService.format('go', 'package main')).status).toBe('ok');
+  });
+});
\ No newline at end of file
@@ -0,0 +1,215 @@
+const { EventEmitter } = require('events');
+const grpc = require('@grpc/grpc-js');
+const { ExecuteCall, toStatus } = require('../../services/grpcServer');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const dockerService = require('../../services/dockerService');
+const executionService = require('../../services/executionService');
+const executionQueue = require('../../services/executionQueue');
+const { consume } = require('../../middleware/rateLimiter');
+const { ExecError } = require('../../utils/execErrors');
+
+jest.mock('../../services/dockerService');
+jest.mock('../../services/executionService', () => ({
+  screen: jest.fn(),
+  startExecution: jest.fn(),
+  writeStdin: jest.fn(),
+  closeStdin: jest.fn(),
+  cancelExecution: jest.fn(),
+  activeExecutions: new Map()
+}));
+jest.mock('../../middleware/rateLimiter', () => ({
+  consume: jest.fn()
+}));
+
+describe('gRPC ExecuteCall', () => {
+  let call;
+  let session;
+
+  const frames = () => call.write.mock.calls.map(([frame]) => frame);
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    runtimeRegistry.load();
+    executionService.activeExecutions.clear();
+
+    call = new EventEmitter();
+    call.write = jest.fn();
+    call.end = jest.fn();
+    call.cancelled = false;
+
+    dockerService.isAvailable = true;
+    dockerService.createContainer.mockResolvedValue({ containerId: 'grpc-1' });
+    dockerService.stopContainer.mockResolvedValue();
+    consume.mockResolvedValue(null);
+    executionService.cancelExecution.mockResolvedValue(true);
+    executionService.screen.mockResolvedValue({ verdict: 'allow', matches: [] });
+
+    session = new ExecuteCall(call, 'user-1');
+  });
+
+  it('should stream started, output and exit frames in order, then remove the container', async () => {
+    executionService.startExecution.mockImplementation(async (socket, { executionId }) => {
+      socket.emit('execution:started', { executionId, requestId: 'req-1', language: 'go', network_enabled: false });
+      socket.emit('execution:output', { executionId, stream: 'stdout', data: 'hello\n', seq: 1 });
+      socket.emit('execution:output', { executionId, stream: 'stderr', data: 'warn\n', seq: 2 });
+      socket.emit('execution:exit', { executionId, status: 'ok', code: 0, duration_ms: 12, compile_ms: 300 });
+      socket.emit('execution:completed', { executionId });
+      return executionId;
+    });
+
+    await session.receive({ payload: 'start', start: { runtime: 'go', code: 'package main', request_id: 'req-1' } });
+
+    expect(dockerService.createContainer).toHaveBeenCalledWith('go', 'grpc', 'user-1');
+    expect(executionService.startExecution.mock.calls[0][1]).toMatchObject({
+      containerId: 'grpc-1',
+      executionId: session.executionId,
+      filename: 'main',
+      interactive: false,
+      requestId: 'req-1'
+    });
+    expect(consume).toHaveBeenCalledWith('execute', { userId: 'user-1' });
+
+    expect(frames().map(frame => Object.keys(frame)[1])).toEqual(['started', 'output', 'output', 'exit']);
+    expect(frames().every(frame => frame.execution_id === session.executionId)).toBe(true);
+    expect(frames()[1].output).toEqual({ stream: 'STDOUT', data: Buffer.from('hello\n'), seq: 1 });
+    expect(frames()[2].output.stream).toBe('STDERR');
+    expect(frames()[3].exit).toMatchObject({ status: 'ok', has_exit_code: true, exit_code: 0, duration_ms: 12, compile_ms: 300 });
+
+    expect(call.end).toHaveBeenCalled();
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('grpc-1', { force: true });
+  });
+
+  it('should hold stdin frames until the program starts and close stdin when the client ends', async () => {
+    let started;
+    executionService.startExecution.mockImplementation((socket, { executionId }) => new Promise((resolve) => {
+      started = () => {
+        socket.emit('execution:started', { executionId, language: 'go' });
+        resolve(executionId);
+      };
+    }));
+
+    const starting = session.receive({ payload: 'start', start: { runtime: 'go', code: 'package main', interactive: true } });
+    await session.receive({ payload: 'stdin', stdin: { data: Buffer.from('ping\n'), eof: false } });
+    await new Promise(setImmediate);
+    expect(executionService.writeStdin).not.toHaveBeenCalled();
+
+    started();
+    await starting;
+    expect(executionService.writeStdin).toHaveBeenCalledWith(session.executionId, Buffer.from('ping\n'));
+    expect(executionService.closeStdin).not.toHaveBeenCalled();
+
+    session.endStdin();
+    expect(executionService.closeStdin).toHaveBeenCalledWith(session.executionId);
+  });
+
+  it('should refuse stdin frames for a run that is not interactive', async () => {
+    executionService.startExecution.mockResolvedValue('exec');
+    await session.receive({ payload: 'start', start: { runtime: 'go', code: 'package main' } });
+
+    await expect(session.receive({ payload: 'stdin', stdin: { data: Buffer.from('x') } }))
+      .rejects.toMatchObject({ code: 'NOT_INTERACTIVE' });
+  });
+
+  it('should refuse an unknown runtime before creating a container', async () => {
+    await expect(session.receive({ payload: 'start', start: { runtime: 'cobol', code: 'x' } }))
+      .rejects.toMatchObject({ code: 'VALIDATION_FAILED' });
+    expect(dockerService.createContainer).not.toHaveBeenCalled();
+  });
+
+  it('should refuse the run when the execute bucket is empty', async () => {
+    consume.mockResolvedValue({ allowed: false, retryAfter: 7 });
+
+    const error = await session.receive({ payload: 'start', start: { runtime: 'go', code: 'package main' } }).catch(e => e);
+    expect(error.kind).toBe('rate_limited');
+    expect(dockerService.createContainer).not.toHaveBeenCalled();
+
+    const status = toStatus(error);
+    expect(status.code).toBe(grpc.status.RESOURCE_EXHAUSTED);
+    expect(status.metadata.get('retry-after')).toEqual(['7']);
+  });
+
+  describe('admission', () => {
+    let queueConfig;
+
+    beforeEach(() => {
+      queueConfig = executionQueue.config;
+      executionQueue.config = { ...queueConfig, enabled: true, maxConcurrent: 1, perUserLimit: 1, maxQueueDepth: 2 };
+    });
+
+    afterEach(() => {
+      executionQueue.config = queueConfig;
+    });
+
+    it('should screen the code and take a slot before creating the container', async () => {
+      executionService.startExecution.mockResolvedValue('exec');
+
+      await session.receive({ payload: 'start', start: { runtime: 'go', code: 'package main' } });
+
+      expect(executionService.screen).toHaveBeenCalledWith('user-1', { language: 'go', code: 'package main', files: null });
+      expect(executionService.startExecution.mock.calls[0][1].ticket).toMatchObject({ userId: 'user-1', state: 'running' });
+      executionService.startExecution.mock.calls[0][1].ticket.release();
+    });
+
+    it('should not create a container for rejected code', async () => {
+      executionService.screen.mockRejectedValue(new ExecError('rejected', 'SUBMISSION_REJECTED', 'This submission was rejected by the abuse policy'));
+
+      await expect(session.receive({ payload: 'start', start: { runtime: 'go', code: 'package main' } }))
+        .rejects.toMatchObject({ code: 'SUBMISSION_REJECTED' });
+      expect(dockerService.createContainer).not.toHaveBeenCalled();
+    });
+
+    it('should hold queued calls without a container and refuse them once the queue is full', async () => {
+      const running = executionQueue.enqueue('user-1');
+      const other = executionQueue.enqueue('user-2');
+      try {
+        const queued = session.receive({ payload: 'start', start: { runtime: 'go', code: 'package main' } });
+        await new Promise(setImmediate);
+        expect(frames().map(frame => Object.keys(frame)[1])).toEqual(['queued']);
+        expect(dockerService.createContainer).not.toHaveBeenCalled();
+
+        const full = new ExecuteCall(call, 'user-3');
+        await expect(full.receive({ payload: 'start', start: { runtime: 'go', code: 'package main' } }))
+          .rejects.toMatchObject({ code: 'QUEUE_FULL' });
+        expect(dockerService.createContainer).not.toHaveBeenCalled();
+
+        session.disconnect();
+        await queued;
+        expect(dockerService.createContainer).not.toHaveBeenCalled();
+      } finally {
+        running.release();
+        other.cancel();
+      }
+    });
+  });
+
+  it('should cancel a running execution when the client goes away', async () => {
+    executionService.startExecution.mockImplementation(async (socket, { executionId }) => {
+      executionService.activeExecutions.set(executionId, { userId: 'user-1' });
+      socket.emit('execution:started', { executionId, language: 'go' });
+      return executionId;
+    });
+    await session.receive({ payload: 'start', start: { runtime: 'go', code: 'package main' } });
+
+    call.cancelled = true;
+    session.disconnect();
+
+    expect(executionService.cancelExecution).toHaveBeenCalledWith(session.executionId, 'client_disconnected');
+    expect(call.end).not.toHaveBeenCalled();
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('grpc-1', { force: true });
+  });
+});
+
+describe('gRPC toStatus', () => {
+  it('should map ExecError kinds to gRPC status codes with the error code as metadata', () => {
+    const status = toStatus(new ExecError('rejected', 'SUBMISSION_REJECTED', 'This submission was rejected by the abuse policy'), 'req-9');
+
+    expect(status.code).toBe(grpc.status.FAILED_PRECONDITION);
+    expect(status.details).toBe('This submission was rejected by the abuse policy');
+    expect(status.metadata.get('x-error-code')).toEqual(['SUBMISSION_REJECTED']);
+    expect(status.metadata.get('x-request-id')).toEqual(['req-9']);
+  });
+
+  it('should treat unknown errors as INTERNAL', () => {
+    expect(toStatus(new Error('boom')).code).toBe(grpc.status.INTERNAL);
+  });
+});
\ No newline at end of file
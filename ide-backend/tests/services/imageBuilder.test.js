@@ -0,0 +1,140 @@
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const config = require('../../config');
+const imageBuilder = require('../../services/imageBuilder');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const dockerService = require('../../services/dockerService');
+const containerPool = require('../../services/containerPool');
+const buildCache = require('../../services/buildCache');
+
+jest.mock('../../services/dockerService');
+jest.mock('../../services/containerPool');
+jest.mock('../../services/buildCache');
+
+describe('ImageBuilder', () => {
+  let tmpDir;
+  let originalImagesFile;
+
+  beforeAll(() => {
+    originalImagesFile = config.imageBuilds.imagesFile;
+  });
+
+  afterAll(() => {
+    config.imageBuilds.imagesFile = originalImagesFile;
+    runtimeRegistry.load();
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'image-builder-'));
+    config.imageBuilds.imagesFile = path.join(tmpDir, 'runtime-images.json');
+    runtimeRegistry.load();
+
+    dockerService.containers = new Map([['smoke-1', { container: {} }]]);
+    dockerService.getCodeFilename.mockImplementation((filename, language) => `${filename}.${runtimeRegistry.get(language).extension}`);
+    dockerService.buildImage.mockImplementation(async (context, { onOutput }) => {
+      context.resume();
+      onOutput('Step 1/3 : FROM python:3.11-alpine\n');
+      return { imageId: 'sha256:abc' };
+    });
+    dockerService.createContainer.mockResolvedValue({ containerId: 'smoke-1' });
+    dockerService.writeFileToContainer.mockResolvedValue();
+    dockerService.runBufferedExec.mockResolvedValue({ exitCode: 0, timedOut: false, stdout: 'ok\n', stderr: '' });
+    dockerService.stopContainer.mockResolvedValue();
+    containerPool.flush.mockResolvedValue();
+    buildCache.invalidate.mockResolvedValue(0);
+  });
+
+  afterEach(() => {
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('should tag the image with the context digest and switch to it after the smoke test', async () => {
+    const events = [];
+    const result = await imageBuilder.build('python', { userId: 'admin-1', onEvent: frame => events.push(frame) });
+
+    expect(result.image).toMatch(/^studio-runtime\/python:[0-9a-f]{12}$/);
+    expect(result.previousImage).toBe('python:3.11-alpine');
+    expect(result.digest.startsWith(result.image.split(':')[1])).toBe(true);
+    expect(dockerService.buildImage).toHaveBeenCalledWith(expect.anything(), expect.objectContaining({
+      tag: result.image,
+      dockerfile: 'Dockerfile.python'
+    }));
+    expect(dockerService.createContainer).toHaveBeenCalledWith('python', 'image-build', 'admin-1', { image: result.image });
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('smoke-1', { force: true });
+    expect(events.map(frame => frame.event)).toEqual(['started', 'output', 'built', 'smoke']);
+
+    expect(runtimeRegistry.get('python').image).toBe(result.image);
+    expect(containerPool.flush).toHaveBeenCalledWith('python');
+    expect(buildCache.invalidate).toHaveBeenCalledWith('python');
+
+    // The switch survives a reload
+    runtimeRegistry.load();
+    expect(runtimeRegistry.get('python').image).toBe(result.image);
+  });
+
+  it('should produce the same tag for an unchanged build context', async () => {
+    const first = await imageBuilder.build('python');
+    const second = await imageBuilder.build('python');
+
+    expect(second.image).toBe(first.image);
+    expect(second.previousImage).toBe(first.image);
+  });
+
+  it('should keep the previous image when the smoke test fails', async () => {
+    dockerService.runBufferedExec.mockResolvedValue({ exitCode: 1, timedOut: false, stdout: '', stderr: 'ImportError\n' });
+
+    await expect(imageBuilder.build('python')).rejects.toMatchObject({ code: 'SMOKE_FAILED' });
+
+    expect(runtimeRegistry.get('python').image).toBe('python:3.11-alpine');
+    expect(containerPool.flush).not.toHaveBeenCalled();
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('smoke-1', { force: true });
+    expect(fs.existsSync(config.imageBuilds.imagesFile)).toBe(false);
+  });
+
+  it('should fail the smoke test of an image without the runtime\'s formatter', async () => {
+    dockerService.runBufferedExec
+      .mockResolvedValueOnce({ exitCode: 0, timedOut: false, stdout: 'ok\n', stderr: '' })
+      .mockResolvedValueOnce({ exitCode: 127, timedOut: false, stdout: '', stderr: 'exec: "black": executable file not found in $PATH' });
+
+    const failure = await imageBuilder.build('python').catch(error => error);
+
+    expect(failure.code).toBe('SMOKE_FAILED');
+    expect(failure.smoke).toMatchObject({ passed: false, phase: 'format', exitCode: 127 });
+    expect(dockerService.runBufferedExec).toHaveBeenLastCalledWith('smoke-1', ['black', '--quiet', '-'], expect.objectContaining({ stdin: "print('ok')" }));
+    expect(runtimeRegistry.get('python').image).toBe('python:3.11-alpine');
+  });
+
+  it('should keep the previous image when the build fails', async () => {
+    dockerService.buildImage.mockRejectedValue(new Error('The command \'/bin/sh -c pip install\' returned a non-zero code: 1'));
+
+    await expect(imageBuilder.build('python')).rejects.toMatchObject({ code: 'BUILD_FAILED' });
+
+    expect(dockerService.createContainer).not.toHaveBeenCalled();
+    expect(runtimeRegistry.get('python').image).toBe('python:3.11-alpine');
+  });
+
+  it('should reject a second build of the same runtime while one is running', async () => {
+    let finishBuild;
+    dockerService.buildImage.mockImplementationOnce(() => new Promise(resolve => {
+      finishBuild = () => resolve({ imageId: 'sha256:abc' });
+    }));
+
+    const first = imageBuilder.build('python');
+    await expect(imageBuilder.build('python')).rejects.toMatchObject({ code: 'BUILD_IN_PROGRESS' });
+
+    while (!finishBuild) {
+      await new Promise(resolve => setTimeout(resolve, 5));
+    }
+    finishBuild();
+    await first;
+
+    // Released once the first build finished
+    await expect(imageBuilder.build('python')).resolves.toMatchObject({ runtime: 'python' });
+  });
+
+  it('should reject unknown runtimes', async () => {
+    await expect(imageBuilder.build('cobol')).rejects.toMatchObject({ code: 'RUNTIME_NOT_FOUND' });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,113 @@
+const judgeService = require('../../services/judgeService');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const dockerService = require('../../services/dockerService');
+
+jest.mock('../../services/dockerService');
+
+describe('JudgeService', () => {
+  const ok = (stdout) => ({ exitCode: 0, timedOut: false, stdout, stderr: '', durationMs: 5 });
+
+  const reply = (outputs) => {
+    // Echo a fixed output per stdin, like a program under test would
+    dockerService.runBufferedExec.mockImplementation(async (containerId, argv, { stdin, phase }) => {
+      if (phase === 'compile') {
+        return ok('');
+      }
+      return outputs[stdin];
+    });
+  };
+
+  const cases = [
+    { stdin: '1 2', expected_stdout: '3\n' },
+    { stdin: '2 2', expected_stdout: '4\n' },
+    { stdin: '5 5', expected_stdout: '10\n' }
+  ];
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    runtimeRegistry.load();
+    judgeService.config = { ...judgeService.config, maxFailures: null, caseTimeoutMs: 2000, diffLimitBytes: 1024 };
+
+    dockerService.containers = new Map([
+      ['judge-cpp', { container: {}, language: 'cpp' }],
+      ['judge-python', { container: {}, language: 'python' }]
+    ]);
+    dockerService.getCodeFilename.mockImplementation((filename, language) => `${filename}.${runtimeRegistry.get(language).extension}`);
+    dockerService.writeFileToContainer.mockResolvedValue();
+    dockerService.runCompilePhase.mockImplementation((containerId, argv, env, timeoutMs) =>
+      dockerService.runBufferedExec(containerId, argv, { env, timeoutMs, phase: 'compile' })
+    );
+    dockerService.signalProcesses.mockResolvedValue();
+  });
+
+  it('should compile once and run every case with its own stdin', async () => {
+    reply({ '1 2': ok('3\n'), '2 2': ok('4\r\n'), '5 5': ok('10\n') });
+
+    const report = await judgeService.run('judge-cpp', { code: 'int main() {}', cases });
+
+    expect(report.verdict).toBe('AC');
+    expect(report.summary).toEqual({ total: 3, passed: 3, failed: 0, skipped: 0 });
+    expect(dockerService.runCompilePhase).toHaveBeenCalledTimes(1);
+    const runs = dockerService.runBufferedExec.mock.calls.filter(([, , options]) => options.phase === 'judge');
+    expect(runs.map(([, , options]) => options.stdin)).toEqual(['1 2', '2 2', '5 5']);
+    expect(runs.every(([, , options]) => options.timeoutMs === 2000)).toBe(true);
+  });
+
+  it('should report WA with a diff, RE and TLE per case', async () => {
+    reply({
+      '1 2': ok('4\n'),
+      '2 2': { exitCode: 139, timedOut: false, stdout: '', stderr: 'Segmentation fault\n', durationMs: 3 },
+      '5 5': { exitCode: null, timedOut: true, stdout: '', stderr: '', durationMs: 2000 }
+    });
+
+    const report = await judgeService.run('judge-cpp', { code: 'int main() {}', cases });
+
+    expect(report.cases.map(result => result.verdict)).toEqual(['WA', 'RE', 'TLE']);
+    expect(report.verdict).toBe('WA');
+    expect(report.cases[0].diff).toMatchObject({ first_difference: { line: 1, expected: '3', actual: '4' } });
+    expect(report.cases[1].stderr).toBe('Segmentation fault\n');
+    // The timed out program is killed, not the container
+    expect(dockerService.signalProcesses).toHaveBeenCalledWith('judge-cpp', 'KILL');
+    expect(dockerService.stopContainer).not.toHaveBeenCalled();
+  });
+
+  it('should skip the remaining cases after maxFailures', async () => {
+    reply({ '1 2': ok('0\n'), '2 2': ok('0\n'), '5 5': ok('10\n') });
+
+    const report = await judgeService.run('judge-cpp', { code: 'int main() {}', cases }, { maxFailures: 1 });
+
+    expect(report.cases.map(result => result.verdict)).toEqual(['WA', 'skipped', 'skipped']);
+    expect(report.summary).toEqual({ total: 3, passed: 0, failed: 1, skipped: 2 });
+  });
+
+  it('should apply the comparison mode, letting a case override it', async () => {
+    reply({ '1 2': ok('3  \n'), '2 2': ok('4.0000001\n') });
+
+    const report = await judgeService.run('judge-python', {
+      code: 'print(sum(map(int, input().split())))',
+      cases: [cases[0], { ...cases[1], comparison: 'float' }]
+    }, { comparison: 'trimmed' });
+
+    expect(report.verdict).toBe('AC');
+    expect(dockerService.runCompilePhase).not.toHaveBeenCalled();
+  });
+
+  it('should not run any case when the build fails', async () => {
+    dockerService.runBufferedExec.mockResolvedValue({ exitCode: 1, timedOut: false, stdout: '', stderr: 'main.cpp:1: error: expected \';\'\n', durationMs: 40 });
+
+    const report = await judgeService.run('judge-cpp', { code: 'int main() {', cases });
+
+    expect(report.verdict).toBe('CE');
+    expect(report.compile).toMatchObject({ exit_code: 1, output: 'main.cpp:1: error: expected \';\'' });
+    expect(report.summary.skipped).toBe(3);
+    expect(dockerService.runBufferedExec).toHaveBeenCalledTimes(1);
+  });
+
+  it('should keep the per-case limit under the runtime run timeout', async () => {
+    reply({ '1 2': ok('3\n') });
+
+    const report = await judgeService.run('judge-cpp', { code: 'int main() {}', cases: [cases[0]] }, { caseTimeoutMs: 24 * 60 * 60 * 1000 });
+
+    expect(report.case_timeout_ms).toBe(runtimeRegistry.resolveTimeouts('cpp', {}).runTimeoutMs);
+  });
+});
\ No newline at end of file
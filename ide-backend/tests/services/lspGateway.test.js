@@ -0,0 +1,142 @@
+const { EventEmitter } = require('events');
+const { PassThrough } = require('stream');
+const lspGateway = require('../../services/lspGateway');
+const dockerService = require('../../services/dockerService');
+const { encodeMessage } = require('../../utils/lspFraming');
+
+jest.mock('../../services/dockerService');
+
+const createProcess = () => {
+  const stream = new EventEmitter();
+  stream.write = jest.fn();
+  stream.end = jest.fn();
+  return { exec: {}, stream, stdout: new PassThrough(), stderr: new PassThrough() };
+};
+
+const createSocket = (id, userId = 'user-1') => ({ id, userId, emit: jest.fn() });
+
+const emitted = (socket, event) => socket.emit.mock.calls.filter(([name]) => name === event).map(([, data]) => data);
+
+// JSON-RPC messages written to a fake server's stdin
+const written = (proc) => proc.stream.write.mock.calls.map(([frame]) => JSON.parse(frame.toString('utf8').split('\r\n\r\n')[1]));
+
+const flush = () => new Promise(resolve => setImmediate(resolve));
+
+describe('LspGateway', () => {
+  let processes;
+  let socket;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    lspGateway.shutdown();
+    lspGateway.config = { ...lspGateway.config, idleTimeoutMs: 60000, maxRestarts: 2, restartWindowMs: 60000 };
+
+    processes = [];
+    dockerService.getContainerInfo.mockResolvedValue({
+      id: 'container-1',
+      userId: 'user-1',
+      language: 'go',
+      mountWorkspaceId: 'ws-1'
+    });
+    dockerService.createStdioExec.mockImplementation(async () => {
+      const proc = createProcess();
+      processes.push(proc);
+      return proc;
+    });
+
+    socket = createSocket('socket-1');
+  });
+
+  afterEach(() => {
+    lspGateway.shutdown();
+  });
+
+  it('should start the runtime\'s language server in the workspace container', async () => {
+    await lspGateway.handleOpen(socket, { containerId: 'container-1', workspaceId: 'ws-1', language: 'go' });
+
+    expect(dockerService.createStdioExec).toHaveBeenCalledWith('container-1', ['gopls', 'serve'], {
+      env: expect.arrayContaining(['HOME=/tmp', 'GOCACHE=/tmp/.cache/go-build'])
+    });
+    expect(emitted(socket, 'lsp:opened')[0]).toMatchObject({ sessionId: 'ws-1:go', server: 'gopls', reused: false });
+  });
+
+  it('should refuse containers of other users and unmounted workspaces', async () => {
+    await lspGateway.handleOpen(createSocket('socket-2', 'user-2'), { containerId: 'container-1', workspaceId: 'ws-1' });
+    await lspGateway.handleOpen(socket, { containerId: 'container-1', workspaceId: 'ws-2' });
+    await lspGateway.handleOpen(socket, { containerId: 'container-1', workspaceId: 'ws-1', language: 'python' });
+
+    expect(emitted(socket, 'lsp:error').map(error => error.code)).toEqual(['WORKSPACE_NOT_MOUNTED', 'NO_LANGUAGE_SERVER']);
+    expect(dockerService.createStdioExec).not.toHaveBeenCalled();
+  });
+
+  it('should frame editor messages for the server and decode its replies', async () => {
+    await lspGateway.handleOpen(socket, { containerId: 'container-1', workspaceId: 'ws-1' });
+
+    lspGateway.handleMessage(socket, { sessionId: 'ws-1:go', message: { jsonrpc: '2.0', id: 1, method: 'initialize', params: {} } });
+    expect(written(processes[0])).toEqual([{ jsonrpc: '2.0', id: 1, method: 'initialize', params: {} }]);
+
+    processes[0].stdout.write(encodeMessage({ jsonrpc: '2.0', id: 1, result: { capabilities: { hoverProvider: true } } }));
+    await flush();
+
+    expect(emitted(socket, 'lsp:message')).toEqual([{
+      sessionId: 'ws-1:go',
+      message: { jsonrpc: '2.0', id: 1, result: { capabilities: { hoverProvider: true } } }
+    }]);
+  });
+
+  it('should share one server per workspace and answer a repeated initialize itself', async () => {
+    await lspGateway.handleOpen(socket, { containerId: 'container-1', workspaceId: 'ws-1' });
+    lspGateway.handleMessage(socket, { sessionId: 'ws-1:go', message: { jsonrpc: '2.0', id: 1, method: 'initialize', params: {} } });
+    processes[0].stdout.write(encodeMessage({ jsonrpc: '2.0', id: 1, result: { capabilities: {} } }));
+    await flush();
+
+    const reconnected = createSocket('socket-2');
+    await lspGateway.handleOpen(reconnected, { containerId: 'container-1', workspaceId: 'ws-1' });
+    lspGateway.handleMessage(reconnected, { sessionId: 'ws-1:go', message: { jsonrpc: '2.0', id: 7, method: 'initialize', params: {} } });
+
+    expect(dockerService.createStdioExec).toHaveBeenCalledTimes(1);
+    expect(emitted(socket, 'lsp:detached')).toEqual([{ sessionId: 'ws-1:go', reason: 'taken_over' }]);
+    expect(emitted(reconnected, 'lsp:opened')[0]).toMatchObject({ reused: true, initialized: true });
+    expect(emitted(reconnected, 'lsp:message')).toEqual([{
+      sessionId: 'ws-1:go',
+      message: { jsonrpc: '2.0', id: 7, result: { capabilities: {} } }
+    }]);
+    expect(written(processes[0])).toHaveLength(1);
+  });
+
+  it('should restart a crashed server and tell the client to re-initialize', async () => {
+    await lspGateway.handleOpen(socket, { containerId: 'container-1', workspaceId: 'ws-1' });
+    processes[0].stderr.write('panic: boom\n');
+    await flush();
+
+    processes[0].stream.emit('end');
+    await flush();
+
+    expect(processes).toHaveLength(2);
+    expect(emitted(socket, 'lsp:restarted')).toEqual([{ sessionId: 'ws-1:go', restarts: 1, stderr: 'panic: boom' }]);
+  });
+
+  it('should give up on a server that keeps crashing', async () => {
+    await lspGateway.handleOpen(socket, { containerId: 'container-1', workspaceId: 'ws-1' });
+
+    for (let i = 0; i < 3; i++) {
+      processes[i].stream.emit('end');
+      await flush();
+    }
+
+    expect(processes).toHaveLength(3);
+    expect(emitted(socket, 'lsp:closed')).toEqual([{ sessionId: 'ws-1:go', reason: 'crashed', stderr: null }]);
+    expect(lspGateway.sessions.size).toBe(0);
+  });
+
+  it('should stop servers without editor traffic', async () => {
+    lspGateway.config.idleTimeoutMs = 10;
+    await lspGateway.handleOpen(socket, { containerId: 'container-1', workspaceId: 'ws-1' });
+
+    await new Promise(resolve => setTimeout(resolve, 30));
+
+    expect(processes[0].stream.end).toHaveBeenCalled();
+    expect(emitted(socket, 'lsp:closed')).toEqual([{ sessionId: 'ws-1:go', reason: 'idle' }]);
+    expect(lspGateway.sessions.size).toBe(0);
+  });
+});
\ No newline at end of file
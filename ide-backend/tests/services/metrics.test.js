@@ -0,0 +1,111 @@
+const { EventEmitter } = require('events');
+const client = require('prom-client');
+const executionMetrics = require('../../services/metrics');
+const executionService = require('../../services/executionService');
+const dockerService = require('../../services/dockerService');
+
+jest.mock('../../services/dockerService');
+
+describe('ExecutionMetrics', () => {
+  let registry;
+
+  const valueOf = async (name, labels = {}) => {
+    const { values } = await registry.getSingleMetric(name).get();
+    const match = values.find(value =>
+      Object.entries(labels).every(([key, expected]) => value.labels[key] === expected)
+    );
+    return match ? match.value : 0;
+  };
+
+  beforeEach(() => {
+    registry = new client.Registry();
+    executionMetrics.setRegistry(registry);
+    executionMetrics.sources = {};
+
+    executionService.activeExecutions.clear();
+    executionService.executionHistory.clear();
+    jest.clearAllMocks();
+  });
+
+  describe('executions counter', () => {
+    it('should count a timed out execution under outcome=timeout', async () => {
+      dockerService.terminateExecution.mockResolvedValue();
+      const stream = new EventEmitter();
+      const execution = { stream, containerId: 'container-1', language: 'node', timedOut: false };
+      const executionData = {
+        containerId: 'container-1',
+        language: 'node',
+        startTime: new Date(),
+        status: 'running',
+        output: '',
+        stdout: '',
+        stderr: ''
+      };
+      const executionId = executionService.registerExecution(executionData);
+      const onExit = jest.fn(() => executionService.finishExecution(executionId));
+
+      executionService.streamExecution(execution, executionData, { onFrame: jest.fn(), onExit, onError: jest.fn() });
+
+      // What the runtime timeout in dockerService.executeCode does
+      execution.timedOut = true;
+      stream.emit('close');
+
+      expect(onExit).toHaveBeenCalledWith(expect.objectContaining({ killed_reason: 'timeout' }));
+      expect(dockerService.terminateExecution).toHaveBeenCalledWith(execution, 0);
+      expect(await valueOf('studio_executions_total', { runtime: 'node', outcome: 'timeout' })).toBe(1);
+      expect(await valueOf('studio_executions_total', { runtime: 'node', outcome: 'runtime_error' })).toBe(0);
+    });
+
+    it('should count cancelled executions once', async () => {
+      dockerService.killContainer.mockResolvedValue();
+      const executionId = executionService.registerExecution({
+        containerId: 'container-1',
+        language: 'python',
+        startTime: new Date(),
+        status: 'running'
+      });
+
+      await executionService.cancelExecution(executionId, 'user_requested');
+      executionService.finishExecution(executionId);
+
+      expect(await valueOf('studio_executions_total', { runtime: 'python', outcome: 'cancelled' })).toBe(1);
+    });
+  });
+
+  describe('classifyOutcome', () => {
+    it('should map execution records to outcome labels', () => {
+      const classify = record => executionMetrics.classifyOutcome({ status: 'completed', ...record });
+
+      expect(classify({ exitCode: 0 })).toBe('success');
+      expect(classify({ exitCode: 137, killedReason: 'oom' })).toBe('oom');
+      expect(classify({ exitCode: null, killedReason: 'timeout' })).toBe('timeout');
+      expect(classify({ exitCode: 1, language: 'go', diagnostics: [{ message: 'undefined: foo' }] })).toBe('compile_error');
+      expect(classify({ exitCode: 1, language: 'python', diagnostics: [{ message: 'SyntaxError: invalid syntax' }] })).toBe('compile_error');
+      expect(classify({ exitCode: 2, language: 'go', diagnostics: [{ message: 'panic: boom' }] })).toBe('runtime_error');
+      expect(classify({ status: 'error', exitCode: null })).toBe('runtime_error');
+    });
+  });
+
+  describe('scrape', () => {
+    it('should sample gauges from registered sources', async () => {
+      executionMetrics.setSource('runningContainers', () => 4);
+      executionMetrics.setSource('poolIdle', () => ({ go: 2, node: 1 }));
+      executionMetrics.setSource('websocketSessions', () => 3);
+
+      const text = await executionMetrics.metrics();
+
+      expect(text).toContain('studio_containers_running 4');
+      expect(text).toContain('studio_pool_idle_containers{runtime="go"} 2');
+      expect(text).toContain('studio_websocket_sessions 3');
+    });
+
+    it('should record run time and container start latency histograms', async () => {
+      executionMetrics.recordExecution({ status: 'completed', exitCode: 0, language: 'node', duration: 1500 });
+      executionMetrics.observeContainerStart('node', true, 0.2);
+
+      const text = await executionMetrics.metrics();
+      expect(text).toContain('studio_execution_run_seconds_sum{runtime="node"} 1.5');
+      expect(text).toContain('studio_container_start_seconds_count{runtime="node",pooled="true"} 1');
+    });
+  });
+});
\ No newline at end of file
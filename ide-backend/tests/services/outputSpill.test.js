@@ -0,0 +1,51 @@
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const outputSpill = require('../../services/outputSpill');
+
+describe('OutputSpill', () => {
+  let dir;
+
+  const finish = (writers) => Promise.all(Object.values(writers).map(writer => writer.close()));
+
+  beforeEach(() => {
+    dir = fs.mkdtempSync(path.join(os.tmpdir(), 'spill-test-'));
+    outputSpill.config = { ...outputSpill.config, spillEnabled: true, spillPath: dir, spillMaxBytes: 8, spillRetentionMs: 60 * 1000 };
+  });
+
+  afterEach(() => {
+    fs.rmSync(dir, { recursive: true, force: true });
+  });
+
+  it('should write each stream to its own file up to the disk cap', async () => {
+    const writers = outputSpill.open('exec-1');
+
+    writers.stdout.write(Buffer.from('12345'));
+    writers.stdout.write(Buffer.from('67890'));
+    await finish(writers);
+
+    const file = await outputSpill.find('exec-1', 'stdout');
+    expect(fs.readFileSync(file.path, 'utf8')).toBe('12345678');
+    expect(writers.stdout.truncated).toBe(true);
+    expect(await outputSpill.find('exec-1', 'stderr')).toBeNull();
+  });
+
+  it('should reject unsafe execution IDs', () => {
+    expect(() => outputSpill.getFilePath('../etc/passwd', 'stdout')).toThrow('Invalid spill file name');
+    expect(() => outputSpill.getFilePath('exec-1', 'stdin')).toThrow('Invalid spill file name');
+  });
+
+  it('should remove files past the retention window', async () => {
+    const writers = outputSpill.open('exec-old');
+    writers.stdout.write(Buffer.from('old'));
+    await finish(writers);
+
+    const past = new Date(Date.now() - 2 * 60 * 1000);
+    fs.utimesSync(path.join(dir, 'exec-old.stdout'), past, past);
+    fs.writeFileSync(path.join(dir, 'exec-new.stdout'), 'new');
+
+    expect(await outputSpill.prune()).toBe(1);
+    expect(await outputSpill.find('exec-old', 'stdout')).toBeNull();
+    expect(await outputSpill.find('exec-new', 'stdout')).not.toBeNull();
+  });
+});
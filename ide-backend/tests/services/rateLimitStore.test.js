@@ -0,0 +1,82 @@
+const { MemoryRateLimitStore, RedisRateLimitStore, TAKE_SCRIPT } = require('../../services/rateLimitStore');
+
+describe('rateLimitStore', () => {
+  const limits = { capacity: 5, refillPerSecond: 2, cost: 1 };
+
+  describe('MemoryRateLimitStore', () => {
+    let store;
+
+    beforeEach(() => {
+      store = new MemoryRateLimitStore();
+    });
+
+    it('should start full and refuse once the bucket is empty', async () => {
+      const now = 1000000;
+      const results = [];
+      for (let i = 0; i < 6; i++) {
+        results.push(await store.take('user:1', limits, now));
+      }
+
+      expect(results.map(result => result.allowed)).toEqual([true, true, true, true, true, false]);
+      expect(results[4]).toMatchObject({ remaining: 0, resetMs: 2500 });
+      expect(results[5]).toMatchObject({ allowed: false, retryAfterMs: 500 });
+    });
+
+    it('should refill continuously up to capacity', async () => {
+      const now = 1000000;
+      for (let i = 0; i < 5; i++) {
+        await store.take('user:1', limits, now);
+      }
+
+      // 1.5s at 2 tokens/s: three tokens back
+      expect(await store.take('user:1', limits, now + 1500)).toMatchObject({ allowed: true, remaining: 2 });
+
+      // Never more than capacity, however long it sat idle
+      expect(await store.take('user:1', limits, now + 60000)).toMatchObject({ allowed: true, remaining: 4 });
+    });
+
+    it('should keep buckets separate per key', async () => {
+      for (let i = 0; i < 5; i++) {
+        await store.take('user:1', limits);
+      }
+
+      expect((await store.take('user:1', limits)).allowed).toBe(false);
+      expect((await store.take('ip:10.0.0.1', limits)).allowed).toBe(true);
+    });
+
+    it('should never admit more than capacity under concurrent requests', async () => {
+      const results = await Promise.all(
+        Array.from({ length: 50 }, () => store.take('user:1', { ...limits, refillPerSecond: 0.001 }))
+      );
+
+      expect(results.filter(result => result.allowed)).toHaveLength(5);
+    });
+
+    it('should drop buckets that have refilled completely', async () => {
+      await store.take('user:1', limits, 0);
+      await store.take('user:2', limits, 1900);
+      store.sweep(2000);
+
+      expect(Array.from(store.buckets.keys())).toEqual(['user:2']);
+    });
+  });
+
+  describe('RedisRateLimitStore', () => {
+    it('should run the take atomically in one script and read back the tokens left', async () => {
+      const client = { eval: jest.fn().mockResolvedValue([1, '3.5']) };
+      const store = new RedisRateLimitStore(client, 'rl:');
+
+      const result = await store.take('execute:user:1', limits);
+
+      expect(client.eval).toHaveBeenCalledWith(TAKE_SCRIPT, 1, 'rl:execute:user:1', 5, 2, 1, 3500);
+      expect(result).toEqual({ allowed: true, remaining: 3, resetMs: 750, retryAfterMs: 0 });
+    });
+
+    it('should report how long until a refused request fits', async () => {
+      const client = { eval: jest.fn().mockResolvedValue([0, '0.25']) };
+      const store = new RedisRateLimitStore(client, 'rl:');
+
+      expect(await store.take('execute:user:1', limits)).toMatchObject({ allowed: false, remaining: 0, retryAfterMs: 375 });
+    });
+  });
+});
\ No newline at end of file
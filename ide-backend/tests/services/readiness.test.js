@@ -0,0 +1,98 @@
+const logger = require('../../utils/logger');
+const dockerService = require('../../services/dockerService');
+const executionQueue = require('../../services/executionQueue');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const readiness = require('../../services/readiness');
+
+jest.mock('../../services/dockerService');
+
+describe('Readiness', () => {
+  let docker;
+
+  beforeEach(() => {
+    jest.spyOn(logger, 'warn').mockImplementation(() => {});
+    jest.spyOn(runtimeRegistry, 'list').mockReturnValue([
+      { name: 'python', image: 'python:3.11-alpine' },
+      { name: 'node', image: 'node' }
+    ]);
+    docker = {
+      ping: jest.fn().mockResolvedValue('OK'),
+      listImages: jest.fn().mockResolvedValue([
+        { RepoTags: ['python:3.11-alpine'], RepoDigests: [] },
+        { RepoTags: ['node:latest'] }
+      ])
+    };
+    dockerService.docker = docker;
+    executionQueue.draining = false;
+    executionQueue.active.clear();
+    readiness.config = { cacheMs: 5000, dockerTimeoutMs: 50, requiredRuntimes: null };
+    readiness.clearCache();
+  });
+
+  afterEach(() => {
+    logger.warn.mockRestore();
+    runtimeRegistry.list.mockRestore();
+  });
+
+  it('should be ready when every check passes', async () => {
+    const result = await readiness.check();
+
+    expect(result.status).toBe('ready');
+    expect(result.cached).toBe(false);
+    expect(result.checks.docker.status).toBe('ok');
+    expect(result.checks.images).toEqual({ status: 'ok', required: 2 });
+    expect(result.checks.queue.status).toBe('ok');
+  });
+
+  it('should fail the Docker check when ping misses its deadline and skip images', async () => {
+    docker.ping.mockReturnValue(new Promise(() => {}));
+
+    const result = await readiness.check();
+
+    expect(result.status).toBe('not_ready');
+    expect(result.checks.docker.status).toBe('fail');
+    expect(result.checks.docker.message).toContain('timed out');
+    expect(result.checks.images.status).toBe('skipped');
+    expect(docker.listImages).not.toHaveBeenCalled();
+  });
+
+  it('should list missing runtime images', async () => {
+    docker.listImages.mockResolvedValue([{ RepoTags: ['node:latest'] }]);
+
+    const result = await readiness.check();
+
+    expect(result.status).toBe('not_ready');
+    expect(result.checks.images.missing).toEqual([{ runtime: 'python', image: 'python:3.11-alpine' }]);
+  });
+
+  it('should only require the configured runtimes', async () => {
+    readiness.config.requiredRuntimes = ['node', 'cobol'];
+    docker.listImages.mockResolvedValue([{ RepoTags: ['node:latest'] }]);
+
+    const result = await readiness.check();
+
+    expect(result.checks.images.missing).toEqual([{ runtime: 'cobol', image: null }]);
+  });
+
+  it('should fail the queue check on a slot held past its timeout', async () => {
+    executionQueue.active.add({ userId: 'user-1', startedAt: Date.now() - 10000, timeoutMs: 1000 });
+
+    const result = await readiness.check();
+
+    expect(result.status).toBe('not_ready');
+    expect(result.checks.queue.stuck).toBe(1);
+  });
+
+  it('should cache results and share a run between concurrent probes', async () => {
+    const [first, second] = await Promise.all([readiness.check(), readiness.check()]);
+    const third = await readiness.check();
+
+    expect(docker.ping).toHaveBeenCalledTimes(1);
+    expect(first.checkedAt).toBe(second.checkedAt);
+    expect(third.cached).toBe(true);
+
+    readiness.clearCache();
+    await readiness.check();
+    expect(docker.ping).toHaveBeenCalledTimes(2);
+  });
+});
\ No newline at end of file
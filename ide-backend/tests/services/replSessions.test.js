@@ -0,0 +1,188 @@
+jest.mock('../../services/dockerService');
+
+const { EventEmitter } = require('events');
+const dockerService = require('../../services/dockerService');
+const replSessions = require('../../services/replSessions');
+
+describe('ReplSessionService', () => {
+  let streams;
+
+  // A python-like interpreter: echoes each line, then prints a reply and a prompt
+  const createInterpreter = (respond) => {
+    const stream = new EventEmitter();
+    const emit = (text) => setImmediate(() => stream.emit('data', Buffer.from(text)));
+    stream.write = jest.fn((input) => {
+      if (input === '\x03') {
+        return emit('\r\nKeyboardInterrupt\r\n>>> ');
+      }
+      const line = input.replace(/\r$/, '');
+      const reply = respond(line);
+      if (reply !== null) {
+        emit(`${line}\r\n${reply}`);
+      }
+    });
+    stream.end = jest.fn();
+    stream.destroy = jest.fn();
+    stream.start = () => emit('Python 3.11.4\r\n>>> ');
+    return stream;
+  };
+
+  const echoInterpreter = () => createInterpreter((line) => {
+    if (line.endsWith(':') || line.startsWith('    ')) {
+      return '... ';
+    }
+    return line === '' ? 'block done\r\n>>> ' : `out:${line}\r\n>>> `;
+  });
+
+  const useInterpreter = (factory) => {
+    dockerService.createTtyExec.mockImplementation(async () => {
+      const stream = factory();
+      streams.push(stream);
+      stream.start();
+      return { exec: {}, stream };
+    });
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    streams = [];
+    replSessions.sessions.clear();
+    replSessions.userSessions.clear();
+    replSessions.starting.clear();
+    replSessions.config = { ...replSessions.config, maxPerUser: 2, startTimeoutMs: 500, evalTimeoutMs: 500, maxOutputBytes: 1024 };
+
+    let counter = 0;
+    dockerService.createContainer.mockImplementation(async () => ({ containerId: `container-${++counter}` }));
+    dockerService.stopContainer.mockResolvedValue();
+    useInterpreter(echoInterpreter);
+  });
+
+  afterEach(async () => {
+    for (const sessionId of Array.from(replSessions.sessions.keys())) {
+      await replSessions.destroySession(sessionId);
+    }
+  });
+
+  it('should start the interpreter once the first prompt appears', async () => {
+    const session = await replSessions.createSession('user-1', { language: 'python' });
+
+    expect(session.sessionId).toMatch(/^repl_[0-9a-f]{24}$/);
+    expect(dockerService.createTtyExec).toHaveBeenCalledWith('container-1', {
+      cmd: ['python', '-q', '-i'],
+      env: expect.arrayContaining(['TERM=dumb'])
+    });
+    expect(replSessions.getUserSessions('user-1')).toHaveLength(1);
+  });
+
+  it('should reject languages without a REPL', async () => {
+    await expect(replSessions.createSession('user-1', { language: 'go' })).rejects.toMatchObject({ code: 'REPL_NOT_SUPPORTED' });
+    expect(dockerService.createContainer).not.toHaveBeenCalled();
+  });
+
+  it('should clean up when the interpreter never shows a prompt', async () => {
+    useInterpreter(() => Object.assign(echoInterpreter(), { start: () => {} }));
+    replSessions.config.startTimeoutMs = 20;
+
+    await expect(replSessions.createSession('user-1', { language: 'python' })).rejects.toMatchObject({ code: 'REPL_START_FAILED' });
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('container-1');
+    expect(replSessions.getUserSessions('user-1')).toEqual([]);
+  });
+
+  it('should return each line\'s output without echo or prompts', async () => {
+    const { sessionId } = await replSessions.createSession('user-1', { language: 'python' });
+    const onOutput = jest.fn();
+
+    const result = await replSessions.evaluate(sessionId, 'user-1', 'x = 1\nx', { onOutput });
+
+    expect(result).toMatchObject({ output: 'out:x = 1\nout:x\n', timedOut: false, incomplete: false, exited: false });
+    expect(onOutput.mock.calls.map(([text]) => text).join('')).toBe(result.output);
+    expect(streams[0].write.mock.calls.map(([input]) => input)).toEqual(['x = 1\r', 'x\r']);
+  });
+
+  it('should close a trailing block with an empty line', async () => {
+    const { sessionId } = await replSessions.createSession('user-1', { language: 'python' });
+
+    const result = await replSessions.evaluate(sessionId, 'user-1', 'for i in range(2):\n    print(i)');
+
+    expect(result.output).toBe('block done\n');
+    expect(streams[0].write.mock.calls.map(([input]) => input)).toEqual(['for i in range(2):\r', '    print(i)\r', '\r']);
+  });
+
+  it('should interrupt a snippet that runs past the timeout and keep the session', async () => {
+    useInterpreter(() => createInterpreter(line => (line === 'loop()' ? null : `ok\r\n>>> `)));
+    const { sessionId } = await replSessions.createSession('user-1', { language: 'python' });
+
+    const result = await replSessions.evaluate(sessionId, 'user-1', 'loop()', { timeoutMs: 20 });
+
+    expect(result).toMatchObject({ timedOut: true, exited: false });
+    expect(streams[0].write).toHaveBeenCalledWith('\x03');
+    expect(replSessions.getUserSession(sessionId, 'user-1')).not.toBeNull();
+
+    const next = await replSessions.evaluate(sessionId, 'user-1', 'x');
+    expect(next.output).toBe('ok\n');
+  });
+
+  it('should reject a second evaluation while one is running', async () => {
+    useInterpreter(() => createInterpreter(line => (line === 'slow()' ? null : `ok\r\n>>> `)));
+    const { sessionId } = await replSessions.createSession('user-1', { language: 'python' });
+
+    const first = replSessions.evaluate(sessionId, 'user-1', 'slow()', { timeoutMs: 20 });
+
+    await expect(replSessions.evaluate(sessionId, 'user-1', 'x')).rejects.toMatchObject({ code: 'REPL_BUSY' });
+    await first;
+  });
+
+  it('should evict the least recently used session at the per-user cap', async () => {
+    const onExit = jest.fn();
+    const first = await replSessions.createSession('user-1', { language: 'python' }, { onExit });
+    const second = await replSessions.createSession('user-1', { language: 'python' });
+    replSessions.sessions.get(first.sessionId).lastActivity = new Date(Date.now() - 1000);
+    replSessions.sessions.get(second.sessionId).lastActivity = new Date(Date.now() - 2000);
+
+    await replSessions.createSession('user-1', { language: 'python' });
+
+    expect(onExit).not.toHaveBeenCalled();
+    expect(replSessions.getUserSession(second.sessionId, 'user-1')).toBeNull();
+    expect(replSessions.getUserSession(first.sessionId, 'user-1')).not.toBeNull();
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('container-2');
+  });
+
+  it('should not let concurrent creates go past the per-user cap', async () => {
+    const results = await Promise.allSettled([1, 2, 3].map(() => replSessions.createSession('user-1', { language: 'python' })));
+
+    expect(results.map(result => result.status)).toEqual(['fulfilled', 'fulfilled', 'rejected']);
+    expect(results[2].reason).toMatchObject({ code: 'REPL_LIMIT' });
+    expect(dockerService.createContainer).toHaveBeenCalledTimes(2);
+    expect(replSessions.getUserSessions('user-1')).toHaveLength(2);
+  });
+
+  it('should give the slot back when a create fails before the session exists', async () => {
+    dockerService.createContainer.mockRejectedValueOnce(new Error('Docker is not available'));
+    dockerService.createContainer.mockRejectedValueOnce(new Error('Docker is not available'));
+
+    await expect(replSessions.createSession('user-1', { language: 'python' })).rejects.toThrow('Docker is not available');
+    await expect(replSessions.createSession('user-1', { language: 'python' })).rejects.toThrow('Docker is not available');
+    expect(replSessions.starting.size).toBe(0);
+
+    await replSessions.createSession('user-1', { language: 'python' });
+    await replSessions.createSession('user-1', { language: 'python' });
+    expect(replSessions.getUserSessions('user-1')).toHaveLength(2);
+  });
+
+  it('should not evaluate in another user\'s session', async () => {
+    const { sessionId } = await replSessions.createSession('user-1', { language: 'python' });
+
+    expect(await replSessions.evaluate(sessionId, 'user-2', 'x')).toBeNull();
+  });
+
+  it('should report the exit when the interpreter quits', async () => {
+    const onExit = jest.fn();
+    const { sessionId } = await replSessions.createSession('user-1', { language: 'python' }, { onExit });
+
+    streams[0].emit('end');
+    await new Promise(resolve => setImmediate(resolve));
+
+    expect(onExit).toHaveBeenCalledWith({ sessionId, reason: 'exited' });
+    expect(replSessions.getUserSessions('user-1')).toEqual([]);
+  });
+});
\ No newline at end of file
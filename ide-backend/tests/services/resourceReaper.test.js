@@ -0,0 +1,146 @@
+const resourceReaper = require('../../services/resourceReaper');
+const executionMetrics = require('../../services/metrics');
+
+describe('ResourceReaper', () => {
+  const minutesAgo = (minutes) => new Date(Date.now() - minutes * 60 * 1000);
+  const labels = (createdAt, owner = 'user-1') => ({
+    'studio.owner': owner,
+    'studio.execution_id': `exec-${owner}`,
+    'studio.created_at': createdAt.toISOString()
+  });
+
+  let docker;
+  let removed;
+
+  beforeEach(() => {
+    removed = { containers: [], volumes: [] };
+    docker = {
+      listContainers: jest.fn().mockResolvedValue([]),
+      listVolumes: jest.fn().mockResolvedValue({ Volumes: [] }),
+      getContainer: jest.fn(id => ({ remove: jest.fn(async () => removed.containers.push(id)) })),
+      getVolume: jest.fn(name => ({ remove: jest.fn(async () => removed.volumes.push(name)) }))
+    };
+    resourceReaper.config = { ...resourceReaper.config, enabled: false, gracePeriodMs: 10 * 60 * 1000, dryRun: false, jitter: 0.2 };
+    resourceReaper.start({ docker, isTracked: id => id === 'tracked' });
+  });
+
+  it('should remove untracked containers older than the grace period', async () => {
+    docker.listContainers.mockResolvedValue([
+      { Id: 'leaked', Labels: labels(minutesAgo(30)), Created: 0 },
+      { Id: 'tracked', Labels: labels(minutesAgo(30)), Created: 0 },
+      { Id: 'starting', Labels: labels(minutesAgo(1)), Created: 0 }
+    ]);
+
+    const result = await resourceReaper.reap();
+
+    expect(result).toEqual({ containers: 1, volumes: 0 });
+    expect(removed.containers).toEqual(['leaked']);
+    expect(docker.listContainers).toHaveBeenCalledWith({ all: true, filters: { label: ['studio.owner'] } });
+  });
+
+  it('should remove expired volumes no listed container mounts', async () => {
+    docker.listContainers.mockResolvedValue([
+      { Id: 'tracked', Labels: labels(minutesAgo(30)), Created: 0, Mounts: [{ Type: 'volume', Name: 'in-use' }] }
+    ]);
+    docker.listVolumes.mockResolvedValue({
+      Volumes: [
+        { Name: 'in-use', Labels: labels(minutesAgo(30)) },
+        { Name: 'orphan', Labels: labels(minutesAgo(30)) },
+        { Name: 'fresh', Labels: labels(minutesAgo(2)) }
+      ]
+    });
+
+    const result = await resourceReaper.reap();
+
+    expect(result).toEqual({ containers: 0, volumes: 1 });
+    expect(removed.volumes).toEqual(['orphan']);
+  });
+
+  it('should only log in dry-run mode', async () => {
+    resourceReaper.config.dryRun = true;
+    const observeReaped = jest.spyOn(executionMetrics, 'observeReaped');
+    docker.listContainers.mockResolvedValue([{ Id: 'leaked', Labels: labels(minutesAgo(30)), Created: 0 }]);
+
+    const result = await resourceReaper.reap();
+
+    expect(result.containers).toBe(1);
+    expect(removed.containers).toEqual([]);
+    expect(observeReaped).toHaveBeenCalledWith('container', true);
+    observeReaped.mockRestore();
+  });
+
+  it('should fall back to Docker\'s creation time without a created_at label', async () => {
+    docker.listContainers.mockResolvedValue([
+      { Id: 'old', Labels: { 'studio.owner': 'pool' }, Created: minutesAgo(60).getTime() / 1000 },
+      { Id: 'new', Labels: { 'studio.owner': 'pool' }, Created: Date.now() / 1000 }
+    ]);
+
+    await resourceReaper.reap();
+
+    expect(removed.containers).toEqual(['old']);
+  });
+
+  it('should count failed removals as errors and keep going', async () => {
+    const before = resourceReaper.stats.errors;
+    docker.getContainer.mockReturnValueOnce({ remove: jest.fn().mockRejectedValue(Object.assign(new Error('conflict'), { statusCode: 409 })) });
+    docker.listContainers.mockResolvedValue([
+      { Id: 'stuck', Labels: labels(minutesAgo(30)), Created: 0 },
+      { Id: 'leaked', Labels: labels(minutesAgo(30)), Created: 0 }
+    ]);
+
+    const result = await resourceReaper.reap();
+
+    expect(result.containers).toBe(1);
+    expect(removed.containers).toEqual(['leaked']);
+    expect(resourceReaper.stats.errors - before).toBe(1);
+  });
+
+  describe('with several instances on one Docker host', () => {
+    const from = (instance, createdAt = minutesAgo(30)) => ({ ...labels(createdAt), 'studio.instance': instance });
+    let isInstanceAlive;
+
+    beforeEach(() => {
+      isInstanceAlive = jest.fn(async instanceId => instanceId === 'instance-b');
+      resourceReaper.start({ docker, isTracked: id => id === 'tracked', instanceId: 'instance-a', isInstanceAlive });
+    });
+
+    it('should leave a live instance\'s containers and volumes alone', async () => {
+      docker.listContainers.mockResolvedValue([
+        { Id: 'mine', Labels: from('instance-a'), Created: 0 },
+        { Id: 'running-elsewhere', Labels: from('instance-b'), Created: 0 },
+        { Id: 'also-elsewhere', Labels: from('instance-b'), Created: 0 },
+        { Id: 'abandoned', Labels: from('instance-c'), Created: 0 }
+      ]);
+      docker.listVolumes.mockResolvedValue({
+        Volumes: [
+          { Name: 'volume-b', Labels: from('instance-b') },
+          { Name: 'volume-c', Labels: from('instance-c') }
+        ]
+      });
+
+      const result = await resourceReaper.reap();
+
+      expect(result).toEqual({ containers: 2, volumes: 1 });
+      expect(removed.containers).toEqual(['mine', 'abandoned']);
+      expect(removed.volumes).toEqual(['volume-c']);
+      // Once per instance and sweep, never for this one
+      expect(isInstanceAlive.mock.calls.map(([instanceId]) => instanceId).sort()).toEqual(['instance-b', 'instance-c']);
+    });
+
+    it('should keep another instance\'s resources when its heartbeat can\'t be checked', async () => {
+      isInstanceAlive.mockRejectedValue(new Error('redis down'));
+      docker.listContainers.mockResolvedValue([{ Id: 'elsewhere', Labels: from('instance-c'), Created: 0 }]);
+
+      expect(await resourceReaper.reap()).toEqual({ containers: 0, volumes: 0 });
+    });
+  });
+
+  it('should jitter the interval within the configured bounds', () => {
+    resourceReaper.config.intervalMs = 1000;
+    const delays = Array.from({ length: 50 }, () => resourceReaper.getNextDelay());
+
+    expect(Math.min(...delays)).toBeGreaterThanOrEqual(800);
+    expect(Math.max(...delays)).toBeLessThanOrEqual(1200);
+    expect(new Set(delays).size).toBeGreaterThan(1);
+  });
+});
\ No newline at end of file
@@ -0,0 +1,200 @@
+const runtimeRegistry = require('../../services/runtimeRegistry');
+
+describe('RuntimeRegistry', () => {
+  beforeEach(() => {
+    runtimeRegistry.load();
+  });
+
+  describe('load', () => {
+    it('should load the bundled runtimes', () => {
+      expect(runtimeRegistry.names()).toEqual(
+        expect.arrayContaining(['node', 'python', 'java', 'cpp', 'go', 'rust'])
+      );
+      expect(runtimeRegistry.get('go')).toMatchObject({
+        image: 'golang:1.21-alpine',
+        version: '1.21',
+        extension: 'go',
+        needsBuild: true,
+        compileTimeoutMs: 60000,
+        runTimeoutMs: 30000
+      });
+    });
+  });
+
+  describe('register', () => {
+    it('should register a new runtime without code changes', () => {
+      runtimeRegistry.register('kotlin', {
+        image: 'zenika/kotlin:1.9-jdk17',
+        extension: 'kt',
+        compile: ['kotlinc', '{file}', '-include-runtime', '-d', 'main.jar'],
+        run: ['java', '-jar', 'main.jar'],
+        timeoutMs: 60000
+      });
+
+      expect(runtimeRegistry.get('kotlin')).toMatchObject({
+        version: '1.9',
+        needsBuild: true,
+        timeoutMs: 60000
+      });
+      expect(runtimeRegistry.list().map(runtime => runtime.name)).toContain('kotlin');
+    });
+
+    it('should reject definitions without an image', () => {
+      expect(() => runtimeRegistry.register('broken', { extension: 'x', run: ['x'] }))
+        .toThrow('image is required');
+    });
+
+    it('should reject build runtimes without a compile command', () => {
+      expect(() => runtimeRegistry.register('broken', {
+        image: 'alpine:latest',
+        extension: 'c',
+        run: ['./main'],
+        needsBuild: true
+      })).toThrow('must define compile');
+    });
+
+    it('should reject unknown test report formats', () => {
+      expect(() => runtimeRegistry.register('broken', {
+        image: 'alpine:latest',
+        extension: 'c',
+        run: ['./main'],
+        test: { command: ['make', 'test'], format: 'tap' }
+      })).toThrow('test.format must be one of');
+    });
+
+    it('should default a language server to serving the runtime\'s own language', () => {
+      const runtime = runtimeRegistry.register('zig', {
+        image: 'alpine:latest',
+        extension: 'zig',
+        run: ['zig', 'run', '{file}'],
+        lsp: { command: ['zls'] }
+      });
+
+      expect(runtime.lsp).toEqual({ command: ['zls'], languages: ['zig'] });
+      expect(runtimeRegistry.get('go').lsp.languages).toEqual(['go']);
+    });
+
+    it('should default a formatter to the runtime\'s own extension', () => {
+      const runtime = runtimeRegistry.register('zig', {
+        image: 'alpine:latest',
+        extension: 'zig',
+        run: ['zig', 'run', '{file}'],
+        format: { command: ['zig', 'fmt', '--stdin'], errors: 'gofmt' }
+      });
+
+      expect(runtime.format).toEqual({ command: ['zig', 'fmt', '--stdin'], errors: 'gofmt', extensions: ['zig'] });
+      expect(runtimeRegistry.get('node').format.extensions).toContain('ts');
+    });
+
+    it('should reject formatters with an unknown error style', () => {
+      expect(() => runtimeRegistry.register('broken', {
+        image: 'alpine:latest',
+        extension: 'c',
+        run: ['./main'],
+        format: { command: ['clang-format'], errors: 'clang' }
+      })).toThrow('format.errors must be one of gofmt, black, prettier');
+    });
+
+    it('should reject unknown sandbox providers', () => {
+      expect(() => runtimeRegistry.register('broken', {
+        image: 'alpine:latest',
+        extension: 'c',
+        run: ['./main'],
+        sandbox: 'kata'
+      })).toThrow('sandbox must be one of docker, gvisor');
+    });
+
+    it('should reject invalid runtime names', () => {
+      expect(() => runtimeRegistry.register('Bad Name', {
+        image: 'alpine:latest',
+        extension: 'c',
+        run: ['./main']
+      })).toThrow('Runtime name must be lowercase alphanumeric');
+    });
+  });
+
+  describe('getExecutionCommand', () => {
+    it('should exec interpreted runtimes directly', () => {
+      expect(runtimeRegistry.getExecutionCommand('python', 'main.py')).toEqual(['python', 'main.py']);
+    });
+
+    it('should chain compile and run for build runtimes', () => {
+      expect(runtimeRegistry.getExecutionCommand('cpp', 'main.cpp'))
+        .toEqual(['sh', '-c', 'g++ -o /build/main main.cpp && /build/main']);
+    });
+
+    it('should quote filenames that need shell escaping', () => {
+      expect(runtimeRegistry.getExecutionCommand('java', "My App.java"))
+        .toEqual(['sh', '-c', "javac -d /build 'My App.java' && java -cp /build 'My App'"]);
+    });
+
+    it('should fall back to cat for unknown runtimes', () => {
+      expect(runtimeRegistry.getExecutionCommand('unknown', 'main.txt')).toEqual(['cat', 'main.txt']);
+    });
+  });
+
+  describe('getPhases', () => {
+    it('should split build runtimes into compile and run argv', () => {
+      expect(runtimeRegistry.getPhases('cpp', 'main.cpp')).toEqual({
+        compile: ['g++', '-o', '/build/main', 'main.cpp'],
+        run: ['/build/main']
+      });
+    });
+
+    it('should have no compile phase for interpreted runtimes', () => {
+      expect(runtimeRegistry.getProjectPhases('python', 'app/main.py', ['app/main.py'])).toEqual({
+        compile: null,
+        run: ['python', 'app/main.py']
+      });
+    });
+  });
+
+  describe('resolveTimeouts', () => {
+    it('should use the runtime defaults', () => {
+      expect(runtimeRegistry.resolveTimeouts('go')).toEqual({ compileTimeoutMs: 60000, runTimeoutMs: 30000 });
+    });
+
+    it('should let requests lower but never raise the limits', () => {
+      expect(runtimeRegistry.resolveTimeouts('go', { compileTimeoutMs: 5000, runTimeoutMs: 120000 }))
+        .toEqual({ compileTimeoutMs: 5000, runTimeoutMs: 30000 });
+    });
+
+    it('should raise the ceiling for a longer timeout tier', () => {
+      const tier = { compileTimeoutMs: 300000, runTimeoutMs: 1800000 };
+
+      expect(runtimeRegistry.resolveTimeouts('go', {}, tier)).toEqual(tier);
+      expect(runtimeRegistry.resolveTimeouts('go', { runTimeoutMs: 600000 }, tier))
+        .toEqual({ compileTimeoutMs: 300000, runTimeoutMs: 600000 });
+    });
+
+    it('should treat the legacy timeoutMs as the run limit', () => {
+      runtimeRegistry.register('kotlin', {
+        image: 'zenika/kotlin:1.9-jdk17',
+        extension: 'kt',
+        compile: ['kotlinc', '{file}', '-include-runtime', '-d', 'main.jar'],
+        run: ['java', '-jar', 'main.jar'],
+        timeoutMs: 45000,
+        compileTimeoutMs: 90000
+      });
+
+      expect(runtimeRegistry.resolveTimeouts('kotlin')).toEqual({ compileTimeoutMs: 90000, runTimeoutMs: 45000 });
+    });
+  });
+
+  describe('getProjectCommand', () => {
+    it('should build a Go package from the entrypoint directory', () => {
+      expect(runtimeRegistry.getProjectCommand('go', 'cmd/app/main.go', ['go.mod', 'cmd/app/main.go', 'pkg/util.go']))
+        .toEqual(['sh', '-c', 'go build -o /build/main ./cmd/app && /build/main']);
+    });
+
+    it('should compile every Java source and run the entry class', () => {
+      expect(runtimeRegistry.getProjectCommand('java', 'com/example/Main.java', ['com/example/Main.java', 'com/example/Util.java', 'README.md']))
+        .toEqual(['sh', '-c', 'javac -d /build com/example/Main.java com/example/Util.java && java -cp /build com.example.Main']);
+    });
+
+    it('should fall back to the single-file run command', () => {
+      expect(runtimeRegistry.getProjectCommand('python', 'app/main.py', ['app/main.py', 'app/util.py']))
+        .toEqual(['python', 'app/main.py']);
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,128 @@
+const { EventEmitter } = require('events');
+const sandboxTerminal = require('../../services/sandboxTerminal');
+const dockerService = require('../../services/dockerService');
+
+// Mock the docker service
+jest.mock('../../services/dockerService');
+
+const createMockStream = () => {
+  const stream = new EventEmitter();
+  stream.write = jest.fn();
+  stream.end = jest.fn();
+  stream.destroy = jest.fn();
+  return stream;
+};
+
+describe('SandboxTerminalService', () => {
+  let stream;
+  let exec;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    sandboxTerminal.sessions.clear();
+    sandboxTerminal.userSessions.clear();
+    sandboxTerminal.starting.clear();
+
+    stream = createMockStream();
+    exec = { id: 'exec-1' };
+
+    dockerService.createContainer.mockResolvedValue({ containerId: 'container-1' });
+    dockerService.getContainerInfo.mockResolvedValue({ id: 'container-2', userId: 'user-1' });
+    dockerService.createTtyExec.mockImplementation(async () => ({ exec, stream }));
+    dockerService.resizeExec.mockResolvedValue();
+    dockerService.stopContainer.mockResolvedValue();
+  });
+
+  it('should create a dedicated container and bridge output', async () => {
+    const onData = jest.fn();
+    const info = await sandboxTerminal.createSession('user-1', { cols: 100, rows: 30 }, { onData });
+
+    expect(dockerService.createContainer).toHaveBeenCalled();
+    expect(dockerService.createTtyExec).toHaveBeenCalledWith('container-1', { cols: 100, rows: 30 });
+
+    stream.emit('data', Buffer.from('$ '));
+    expect(onData).toHaveBeenCalledWith(Buffer.from('$ '), info.sessionId);
+
+    sandboxTerminal.write(info.sessionId, Buffer.from('ls\r'));
+    expect(stream.write).toHaveBeenCalledWith(Buffer.from('ls\r'));
+  });
+
+  it('should exec into an existing container owned by the user', async () => {
+    await sandboxTerminal.createSession('user-1', { containerId: 'container-2' });
+
+    expect(dockerService.createContainer).not.toHaveBeenCalled();
+    expect(dockerService.createTtyExec).toHaveBeenCalledWith('container-2', { cols: 80, rows: 24 });
+  });
+
+  it('should reject containers owned by another user', async () => {
+    await expect(sandboxTerminal.createSession('user-2', { containerId: 'container-2' }))
+      .rejects.toThrow('Container not found or access denied');
+  });
+
+  it('should resize the exec on resize control frames', async () => {
+    const info = await sandboxTerminal.createSession('user-1');
+
+    await sandboxTerminal.handleControl(info.sessionId, '{"type":"resize","cols":120,"rows":40}');
+
+    expect(dockerService.resizeExec).toHaveBeenLastCalledWith(exec, 120, 40);
+    expect(sandboxTerminal.getSessionInfo(info.sessionId)).toMatchObject({ cols: 120, rows: 40 });
+  });
+
+  it('should cap concurrent terminals per user', async () => {
+    for (let i = 0; i < sandboxTerminal.maxPerUser; i++) {
+      stream = createMockStream();
+      await sandboxTerminal.createSession('user-1');
+    }
+
+    await expect(sandboxTerminal.createSession('user-1')).rejects.toThrow('Terminal limit reached');
+  });
+
+  it('should cap terminals created concurrently', async () => {
+    dockerService.createTtyExec.mockImplementation(async () => ({ exec, stream: createMockStream() }));
+
+    const results = await Promise.allSettled(
+      Array.from({ length: sandboxTerminal.maxPerUser + 2 }, () => sandboxTerminal.createSession('user-1'))
+    );
+
+    expect(results.filter(result => result.status === 'fulfilled')).toHaveLength(sandboxTerminal.maxPerUser);
+    expect(results.filter(result => result.status === 'rejected').every(result => result.reason.code === 'TERMINAL_LIMIT')).toBe(true);
+    expect(dockerService.createContainer).toHaveBeenCalledTimes(sandboxTerminal.maxPerUser);
+  });
+
+  it('should give the slot back when a terminal fails to start', async () => {
+    dockerService.createTtyExec.mockRejectedValueOnce(new Error('exec failed'));
+
+    await expect(sandboxTerminal.createSession('user-1')).rejects.toThrow('exec failed');
+    await expect(sandboxTerminal.createSession('user-2', { containerId: 'container-2' })).rejects.toThrow('access denied');
+
+    expect(sandboxTerminal.starting.size).toBe(0);
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('container-1');
+  });
+
+  it('should clean up when the container side exits', async () => {
+    const onExit = jest.fn();
+    const info = await sandboxTerminal.createSession('user-1', {}, { onExit });
+
+    stream.emit('end');
+    await new Promise(resolve => setImmediate(resolve));
+
+    expect(sandboxTerminal.getSessionInfo(info.sessionId)).toBeNull();
+    expect(dockerService.stopContainer).toHaveBeenCalledWith('container-1');
+    expect(onExit).toHaveBeenCalledWith({ sessionId: info.sessionId, reason: 'exited' });
+    expect(stream.listenerCount('data')).toBe(0);
+  });
+
+  it('should close idle sessions', async () => {
+    jest.useFakeTimers();
+    try {
+      const info = await sandboxTerminal.createSession('user-1');
+
+      jest.advanceTimersByTime(sandboxTerminal.idleTimeoutMs + 1);
+
+      expect(sandboxTerminal.getSessionInfo(info.sessionId)).toBeNull();
+      expect(stream.end).toHaveBeenCalled();
+    } finally {
+      jest.useRealTimers();
+    }
+  });
+});
\ No newline at end of file
@@ -0,0 +1,64 @@
+const logger = require('../../utils/logger');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const sandboxes = require('../../services/sandboxes');
+const FakeSandbox = require('../../services/fakeSandbox');
+
+describe('SandboxRegistry', () => {
+  const docker = (runtimes) => ({ info: jest.fn().mockResolvedValue({ Runtimes: runtimes }) });
+
+  beforeEach(() => {
+    jest.spyOn(logger, 'info').mockImplementation(() => {});
+    jest.spyOn(logger, 'warn').mockImplementation(() => {});
+    runtimeRegistry.register('isolated', {
+      image: 'python:3.11-alpine',
+      extension: 'py',
+      run: ['python', '{file}'],
+      sandbox: 'gvisor'
+    });
+    sandboxes.config = { defaultProvider: 'docker', gvisorRuntime: 'runsc' };
+  });
+
+  afterEach(() => {
+    runtimeRegistry.runtimes.delete('isolated');
+    sandboxes.providers.delete('fake');
+    logger.info.mockRestore();
+    logger.warn.mockRestore();
+  });
+
+  it('should use gVisor for runtimes that ask for it when runsc is registered', async () => {
+    await sandboxes.initialize(docker({ runc: {}, runsc: { path: '/usr/local/bin/runsc' } }));
+
+    const provider = sandboxes.forRuntime('isolated');
+    expect(provider.name).toBe('gvisor');
+    expect(provider.getHostConfig()).toEqual({ Runtime: 'runsc' });
+    expect(sandboxes.forRuntime('python').getHostConfig()).toEqual({});
+    expect(sandboxes.describe('isolated')).toEqual({ requested: 'gvisor', provider: 'gvisor', supported: true, runtime: 'runsc', fallback: false });
+  });
+
+  it('should fall back to docker with a warning when runsc is missing', async () => {
+    await sandboxes.initialize(docker({ runc: {} }));
+
+    expect(sandboxes.forRuntime('isolated').name).toBe('docker');
+    expect(sandboxes.describe('isolated')).toEqual(expect.objectContaining({ requested: 'gvisor', provider: 'docker', fallback: true }));
+    expect(sandboxes.getCapabilities().gvisor.supported).toBe(false);
+    expect(logger.warn).toHaveBeenCalledWith(expect.stringContaining('falling back to docker for isolated'));
+  });
+
+  it('should treat a failing runtime query as unsupported', async () => {
+    await sandboxes.initialize({ info: jest.fn().mockRejectedValue(new Error('socket hang up')) });
+
+    expect(sandboxes.forRuntime('isolated').name).toBe('docker');
+  });
+
+  it('should resolve containers to the provider that created them', async () => {
+    const fake = sandboxes.register(new FakeSandbox());
+    const { containerId } = await fake.create('python', 'workspace-1', 'user-1');
+
+    expect(sandboxes.forContainer(containerId)).toBe(fake);
+    expect(sandboxes.forContainer('unknown').name).toBe('docker');
+  });
+
+  it('should reject unknown providers', () => {
+    expect(() => sandboxes.get('firecracker')).toThrow('Unknown sandbox provider: firecracker');
+  });
+});
\ No newline at end of file
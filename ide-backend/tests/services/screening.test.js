@@ -0,0 +1,129 @@
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const config = require('../../config');
+const auditService = require('../../services/auditService');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+const { ScreeningService } = require('../../services/screening');
+const { compileCondition } = require('../../services/yaraScreener');
+
+describe('ScreeningService', () => {
+  let tmpDir;
+  let screening;
+
+  const writeRules = (rules) => {
+    fs.writeFileSync(screening.config.rulesFile, JSON.stringify(rules));
+  };
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'screening-'));
+    jest.spyOn(auditService, 'logSecurityViolation').mockReturnValue('audit-1');
+
+    screening = new ScreeningService();
+    screening.config = {
+      ...config.screening,
+      enabled: true,
+      screeners: ['rules', 'heuristics', 'yara'],
+      rulesFile: path.join(tmpDir, 'rules.json')
+    };
+    writeRules({
+      rules: [
+        { id: 'stratum', pattern: 'stratum\\+tcp://', flags: 'i', action: 'block' },
+        { id: 'scanner', contains: 'masscan', action: 'flag' }
+      ],
+      yara: [
+        {
+          id: 'miner-config',
+          strings: { $wallet: '/4[0-9A-Za-z]{10}/', $algo: '"algo"', $donate: 'donate-level' },
+          condition: '$wallet and any of ($algo, $donate)',
+          action: 'block'
+        }
+      ]
+    });
+    screening.reload();
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('should allow ordinary code', async () => {
+    await expect(screening.screen('user-1', { language: 'python', code: 'print("hello")' }))
+      .resolves.toEqual({ verdict: 'allow', matches: [], reference: null });
+    expect(auditService.logSecurityViolation).not.toHaveBeenCalled();
+  });
+
+  it('should reject blocked code with a reason code that names no rule', async () => {
+    const error = await screening.screen('user-1', {
+      language: 'python',
+      code: 'pool = "stratum+tcp://pool.example:3333"'
+    }).catch(caught => caught);
+
+    expect(error).toMatchObject({ statusCode: 422, code: 'SUBMISSION_REJECTED', detail: 'reference audit-1' });
+    expect(error.message).not.toMatch(/stratum/);
+    expect(auditService.logSecurityViolation).toHaveBeenCalledWith('code_screening', expect.objectContaining({
+      userId: 'user-1',
+      blocked: true,
+      reason: 'rules:stratum'
+    }));
+  });
+
+  it('should let flagged code run, audit it and raise their rate limit cost', async () => {
+    const result = await screening.screen('user-1', {
+      language: 'python',
+      files: { 'main.py': 'import os', 'scan.sh': 'masscan 10.0.0.0/8' }
+    });
+
+    expect(result).toMatchObject({
+      verdict: 'flag',
+      matches: [{ screener: 'rules', rule: 'scanner', action: 'flag', path: 'scan.sh' }],
+      reference: 'audit-1'
+    });
+    expect(auditService.logSecurityViolation).toHaveBeenCalledWith('code_screening', expect.objectContaining({ blocked: false }));
+    expect(screening.getScore('user-1')).toBeCloseTo(config.screening.abuse.flagPoints);
+    expect(screening.costMultiplier('user-1', 'execute')).toBeGreaterThan(1);
+    expect(screening.costMultiplier('user-1', 'read')).toBe(1);
+    expect(screening.costMultiplier('user-2', 'execute')).toBe(1);
+  });
+
+  it('should evaluate yara-style conditions across files', () => {
+    const wallet = { path: 'a.py', content: 'WALLET = "4AbCdEfGhIjK"' };
+
+    expect(screening.check([wallet]).verdict).toBe('allow');
+    expect(screening.check([wallet, { path: 'config.json', content: '{"algo": "rx/0"}' }]).matches)
+      .toEqual([{ screener: 'yara', rule: 'miner-config', action: 'block', path: 'a.py' }]);
+
+    const condition = compileCondition('not $a and (2 of them or $c)', ['$a', '$b', '$c']);
+    expect(condition(new Set(['$c']))).toBe(true);
+    expect(condition(new Set(['$a', '$c']))).toBe(false);
+    expect(() => compileCondition('$a and', ['$a'])).toThrow('condition ends early');
+    expect(() => compileCondition('$x', ['$a'])).toThrow('undefined string $x');
+  });
+
+  it('should block base64 blobs that decode to an executable', () => {
+    screening.config.screeners = ['heuristics'];
+    const blob = (head) => Buffer.concat([head, Buffer.alloc(config.screening.base64BlobBytes)]).toString('base64');
+
+    expect(screening.check([{ path: 'run.py', content: `payload = "${blob(Buffer.from([0x7f, 0x45, 0x4c, 0x46]))}"` }]).verdict).toBe('block');
+    expect(screening.check([{ path: 'run.py', content: `image = "${blob(Buffer.from('GIF89a'))}"` }]).matches)
+      .toEqual([{ screener: 'heuristics', rule: 'base64-blob', action: 'flag', path: 'run.py' }]);
+  });
+
+  it('should reload rules and keep the old ones when the file is broken', async () => {
+    writeRules({ rules: [{ id: 'hello', contains: 'hello', action: 'block' }] });
+    expect(screening.reload()).toBe(true);
+    expect(screening.check([{ path: null, content: 'hello' }]).verdict).toBe('block');
+
+    fs.writeFileSync(screening.config.rulesFile, '{ not json');
+    expect(screening.reload()).toBe(false);
+    expect(screening.check([{ path: null, content: 'hello' }]).verdict).toBe('block');
+  });
+
+  it('should skip runtimes that opt out of screening', async () => {
+    jest.spyOn(runtimeRegistry, 'get').mockReturnValue({ name: 'internal', screening: false });
+
+    await expect(screening.screen('user-1', { language: 'internal', code: 'stratum+tcp://pool' }))
+      .resolves.toMatchObject({ verdict: 'allow' });
+  });
+});
\ No newline at end of file
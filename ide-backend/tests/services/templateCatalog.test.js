@@ -0,0 +1,123 @@
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const config = require('../../config');
+const logger = require('../../utils/logger');
+const fileSystem = require('../../utils/fileSystem');
+const templateCatalog = require('../../services/templateCatalog');
+const { TemplateCatalog } = require('../../services/templateCatalog');
+
+describe('TemplateCatalog', () => {
+  let extraDir;
+  let basePath;
+  let originalBasePath;
+
+  const writeTemplate = (id, manifest, files) => {
+    const dir = path.join(extraDir, id);
+    for (const [name, content] of Object.entries(files)) {
+      fs.mkdirSync(path.dirname(path.join(dir, 'files', name)), { recursive: true });
+      fs.writeFileSync(path.join(dir, 'files', name), content);
+    }
+    fs.writeFileSync(path.join(dir, 'template.json'), JSON.stringify(manifest));
+  };
+
+  beforeEach(() => {
+    jest.spyOn(logger, 'warn').mockImplementation(() => {});
+    extraDir = fs.mkdtempSync(path.join(os.tmpdir(), 'templates-'));
+    basePath = fs.mkdtempSync(path.join(os.tmpdir(), 'template-workspaces-'));
+    originalBasePath = fileSystem.workspaceBasePath;
+    fileSystem.workspaceBasePath = basePath;
+  });
+
+  afterEach(() => {
+    config.templates.extraDir = null;
+    fileSystem.workspaceBasePath = originalBasePath;
+    fs.rmSync(extraDir, { recursive: true, force: true });
+    fs.rmSync(basePath, { recursive: true, force: true });
+    logger.warn.mockRestore();
+  });
+
+  it('should load the bundled templates', () => {
+    expect(templateCatalog.ids()).toEqual(expect.arrayContaining(['go-http-server', 'node-cli', 'python-script']));
+
+    const go = templateCatalog.list().find(template => template.id === 'go-http-server');
+    expect(go).toMatchObject({
+      runtime: 'go',
+      entrypoint: 'main.go',
+      variables: [{ name: 'modulePath', default: 'example.com/{{ projectSlug }}', description: 'Go module path in go.mod' }]
+    });
+    expect(go.files).toContain('go.mod');
+  });
+
+  it('should substitute variables into contents and paths', () => {
+    const rendered = templateCatalog.render('go-http-server', 'My API');
+    const goMod = rendered.files.find(file => file.path === 'go.mod');
+    expect(goMod.content).toContain('module example.com/my-api');
+
+    const custom = templateCatalog.render('go-http-server', 'My API', { modulePath: 'github.com/me/api' });
+    expect(custom.files.find(file => file.path === 'go.mod').content).toContain('module github.com/me/api');
+    expect(custom.files.find(file => file.path === 'README.md').content).toContain('# My API');
+  });
+
+  it('should reject unknown templates and variables', () => {
+    expect(() => templateCatalog.render('missing', 'x')).toThrow('Unknown template missing');
+    expect(() => templateCatalog.render('go-http-server', 'x', { projectSlug: 'y' })).toThrow('has no variable projectSlug');
+    expect(() => templateCatalog.render('go-http-server', 'x', { modulePath: 'a"; rm -rf /' })).toThrow('may only contain');
+  });
+
+  it('should reject a variable whose value makes a file path invalid', () => {
+    writeTemplate('packaged', {
+      name: 'Packaged', runtime: 'node', description: 'x', entrypoint: 'index.js',
+      variables: { packageDir: { default: 'app', description: 'Directory of the package' } }
+    }, {
+      'index.js': 'require("./{{ packageDir }}");\n',
+      '{{ packageDir }}/index.js': 'module.exports = {};\n'
+    });
+    config.templates.extraDir = extraDir;
+    const catalog = new TemplateCatalog();
+
+    expect(catalog.render('packaged', 'x').files.map(file => file.path)).toContain('app/index.js');
+    let error;
+    try {
+      catalog.render('packaged', 'x', { packageDir: '../../outside' });
+    } catch (e) {
+      error = e;
+    }
+    expect(error).toMatchObject({ code: 'INVALID_TEMPLATE_VARIABLE', param: 'variables.packageDir' });
+    expect(error.message).toContain('packageDir');
+  });
+
+  it('should add and override templates from the operator directory', () => {
+    writeTemplate('node-cli', { name: 'House CLI', runtime: 'node', description: 'Ours', entrypoint: 'cli.js' }, {
+      'cli.js': 'console.log("{{ projectName }}");\n',
+      'lib/{{ projectSlug }}.js': 'module.exports = {};\n'
+    });
+    writeTemplate('broken', { name: 'Broken', runtime: 'node', description: 'x', entrypoint: 'a.js' }, {
+      'a.js': '{{ nope }}'
+    });
+    config.templates.extraDir = extraDir;
+
+    const catalog = new TemplateCatalog();
+
+    expect(catalog.get('node-cli').name).toBe('House CLI');
+    expect(catalog.get('broken')).toBeNull();
+    expect(logger.warn).toHaveBeenCalledWith(expect.stringContaining('a.js uses undefined variable nope'));
+    expect(catalog.render('node-cli', 'Tool Box').files.map(file => file.path)).toEqual(['cli.js', 'lib/tool-box.js']);
+  });
+
+  it('should write the files into the workspace within its quota', async () => {
+    const rendered = templateCatalog.render('python-script', 'Script');
+    await templateCatalog.instantiate('workspace-1', rendered);
+
+    expect(fs.readFileSync(path.join(basePath, 'workspace-1', 'main.py'), 'utf8')).toContain('def greet');
+
+    const maxSize = fileSystem.maxWorkspaceSize;
+    fileSystem.maxWorkspaceSize = 10;
+    try {
+      await expect(templateCatalog.instantiate('workspace-2', rendered)).rejects.toMatchObject({ code: 'QUOTA_EXCEEDED' });
+      expect(fs.existsSync(path.join(basePath, 'workspace-2'))).toBe(false);
+    } finally {
+      fileSystem.maxWorkspaceSize = maxSize;
+    }
+  });
+});
\ No newline at end of file
@@ -0,0 +1,97 @@
+jest.mock('../../services/websocket', () => ({ sendToWorkspace: jest.fn() }));
+jest.mock('../../services/executionService', () => ({ activeExecutions: new Map() }));
+
+const config = require('../../config');
+const dockerService = require('../../services/dockerService');
+const collaborationHub = require('../../services/collaborationHub');
+const lspGateway = require('../../services/lspGateway');
+const sandboxTerminal = require('../../services/sandboxTerminal');
+const executionService = require('../../services/executionService');
+const webSocketService = require('../../services/websocket');
+const { WorkspaceHibernation } = require('../../services/workspaceHibernation');
+
+describe('WorkspaceHibernation', () => {
+  const workspaceId = '507f1f77bcf86cd799439011';
+  const idleTimeoutMs = 30 * 60 * 1000;
+  let hibernation;
+
+  const track = (containerId, idleForMs, mountWorkspaceId = workspaceId) => {
+    dockerService.containers.set(containerId, {
+      mountWorkspaceId,
+      state: 'running',
+      lastActivity: new Date(Date.now() - idleForMs)
+    });
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    dockerService.containers.clear();
+    executionService.activeExecutions.clear();
+    jest.spyOn(dockerService, 'hibernateContainer').mockImplementation(async (containerId) => {
+      dockerService.containers.get(containerId).state = 'hibernated';
+      return true;
+    });
+    jest.spyOn(dockerService, 'wake').mockImplementation(async (info) => {
+      info.state = 'running';
+    });
+    jest.spyOn(collaborationHub, 'flushWorkspace').mockResolvedValue(true);
+    jest.spyOn(lspGateway, 'stopContainerSessions').mockImplementation(() => {});
+    jest.spyOn(sandboxTerminal, 'destroyContainerSessions').mockResolvedValue([]);
+
+    hibernation = new WorkspaceHibernation();
+    hibernation.config = { ...config.workspaceHibernation, idleTimeoutMs };
+  });
+
+  afterEach(() => {
+    dockerService.containers.clear();
+  });
+
+  it('should hibernate workspaces idle past the timeout only', async () => {
+    track('idle-container', idleTimeoutMs + 1000);
+    track('busy-container', 1000, 'other-workspace');
+
+    await expect(hibernation.sweep()).resolves.toEqual([workspaceId]);
+
+    expect(collaborationHub.flushWorkspace).toHaveBeenCalledWith(workspaceId);
+    expect(lspGateway.stopContainerSessions).toHaveBeenCalledWith('idle-container', 'hibernated');
+    expect(sandboxTerminal.destroyContainerSessions).toHaveBeenCalledWith('idle-container', 'hibernated');
+    expect(dockerService.hibernateContainer).toHaveBeenCalledTimes(1);
+    expect(hibernation.getState(workspaceId)).toBe('hibernated');
+    expect(webSocketService.sendToWorkspace).toHaveBeenCalledWith(workspaceId, 'workspace:state', { workspaceId, state: 'hibernated' });
+    expect(hibernation.counts()).toEqual({ active: 1, hibernating: 0, hibernated: 1, resuming: 0 });
+  });
+
+  it('should count file API activity and running executions', async () => {
+    track('idle-container', idleTimeoutMs + 1000);
+    hibernation.touch(workspaceId);
+
+    await expect(hibernation.sweep()).resolves.toEqual([]);
+
+    hibernation.activity.clear();
+    executionService.activeExecutions.set('execution-1', { containerId: 'idle-container' });
+
+    await expect(hibernation.sweep()).resolves.toEqual([]);
+    expect(dockerService.hibernateContainer).not.toHaveBeenCalled();
+  });
+
+  it('should stay running when open documents cannot be saved', async () => {
+    track('idle-container', idleTimeoutMs + 1000);
+    collaborationHub.flushWorkspace.mockResolvedValue(false);
+
+    await expect(hibernation.hibernate(workspaceId)).resolves.toBe(false);
+
+    expect(dockerService.hibernateContainer).not.toHaveBeenCalled();
+    expect(hibernation.getState(workspaceId)).toBe('active');
+  });
+
+  it('should resume a hibernated workspace on its next request', async () => {
+    track('idle-container', idleTimeoutMs + 1000);
+    await hibernation.hibernate(workspaceId);
+
+    hibernation.touch(workspaceId);
+    await new Promise(resolve => setImmediate(resolve));
+
+    expect(dockerService.wake).toHaveBeenCalledWith(dockerService.containers.get('idle-container'));
+    expect(dockerService.containers.get('idle-container').state).toBe('running');
+  });
+});
\ No newline at end of file
@@ -0,0 +1,113 @@
+jest.mock('../../services/websocket', () => ({ sendToWorkspace: jest.fn() }));
+
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const fileSystem = require('../../utils/fileSystem');
+const webSocketService = require('../../services/websocket');
+const { WorkspaceQuota, XfsQuotaProvider } = require('../../services/workspaceQuota');
+
+describe('WorkspaceQuota', () => {
+  const workspaceId = 'workspace-1';
+  let basePath;
+  let originalBasePath;
+  let originalLimits;
+  let workspaceQuota;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    basePath = fs.mkdtempSync(path.join(os.tmpdir(), 'quota-'));
+    fs.mkdirSync(path.join(basePath, workspaceId, 'src'), { recursive: true });
+    fs.writeFileSync(path.join(basePath, workspaceId, 'main.py'), 'x'.repeat(40));
+    fs.writeFileSync(path.join(basePath, workspaceId, 'src', 'util.py'), 'y'.repeat(20));
+
+    originalBasePath = fileSystem.workspaceBasePath;
+    originalLimits = [fileSystem.maxWorkspaceSize, fileSystem.maxWorkspaceFiles];
+    fileSystem.workspaceBasePath = basePath;
+    fileSystem.maxWorkspaceSize = 100;
+    fileSystem.maxWorkspaceFiles = 10;
+
+    workspaceQuota = new WorkspaceQuota();
+    workspaceQuota.config = { ...workspaceQuota.config, warnPercent: 90, refreshDelayMs: 10, cacheTtlMs: 60 * 1000 };
+  });
+
+  afterEach(() => {
+    workspaceQuota.forget(workspaceId);
+    fileSystem.workspaceBasePath = originalBasePath;
+    [fileSystem.maxWorkspaceSize, fileSystem.maxWorkspaceFiles] = originalLimits;
+    fs.rmSync(basePath, { recursive: true, force: true });
+  });
+
+  it('should report bytes and files used against the quota', async () => {
+    const usage = await workspaceQuota.getUsage(workspaceId);
+
+    expect(usage).toMatchObject({
+      workspaceId,
+      bytesUsed: 60,
+      fileCount: 2,
+      quotaBytes: 100,
+      maxFiles: 10,
+      percent: 60,
+      provider: 'walk',
+      enforced: false
+    });
+  });
+
+  it('should reject writes past the quota with the current usage', async () => {
+    await expect(workspaceQuota.checkWrite(workspaceId, 'big.py', 41)).rejects.toMatchObject({
+      code: 'QUOTA_EXCEEDED',
+      usage: expect.objectContaining({ bytesUsed: 60, quotaBytes: 100 })
+    });
+
+    // Replacing a file only counts the difference
+    const usage = await workspaceQuota.checkWrite(workspaceId, 'main.py', 80);
+    expect(usage).toMatchObject({ bytesUsed: 100, fileCount: 2 });
+  });
+
+  it('should count accepted writes before the next measurement', async () => {
+    await workspaceQuota.checkWrite(workspaceId, 'a.py', 30);
+
+    await expect(workspaceQuota.checkWrite(workspaceId, 'b.py', 30)).rejects.toMatchObject({ code: 'QUOTA_EXCEEDED' });
+  });
+
+  it('should enforce the file limit', async () => {
+    fileSystem.maxWorkspaceFiles = 2;
+
+    await expect(workspaceQuota.checkGrowth(workspaceId, 1, 1)).rejects.toThrow('Workspace file limit exceeded (max 2 files)');
+  });
+
+  it('should measure a copied subtree', async () => {
+    const stats = await fileSystem.getWorkspaceStats(workspaceId, 'src');
+
+    expect(stats).toEqual({ totalSize: 20, fileCount: 1, directoryCount: 0 });
+  });
+
+  it('should warn the workspace once when usage crosses the threshold', async () => {
+    workspaceQuota.start();
+    fs.writeFileSync(path.join(basePath, workspaceId, 'data.txt'), 'z'.repeat(35));
+
+    await fileSystem.writeFile(workspaceId, 'notes.md', 'hi');
+    await new Promise(resolve => setTimeout(resolve, 50));
+    await workspaceQuota.refresh(workspaceId);
+
+    expect(webSocketService.sendToWorkspace).toHaveBeenCalledTimes(1);
+    expect(webSocketService.sendToWorkspace).toHaveBeenCalledWith(workspaceId, 'workspace:quota-warning', {
+      level: 'warning',
+      usage: expect.objectContaining({ bytesUsed: 97, percent: 97 })
+    });
+  });
+
+  it('should read usage from an XFS project quota', async () => {
+    const run = jest.fn().mockResolvedValue({
+      stdout: '/dev/sdb 2048 0 51200 00 [--------] 7 0 500 00 [--------] /workspaces\n'
+    });
+    const provider = new XfsQuotaProvider({ xfsMountPoint: '/workspaces', xfsProjectBase: 100000 }, run);
+
+    await provider.apply(workspaceId, { quotaBytes: 100, maxFiles: 10 });
+    const usage = await provider.measure(workspaceId);
+
+    const id = provider.projectId(workspaceId);
+    expect(run).toHaveBeenCalledWith('xfs_quota', ['-x', '-c', `limit -p bhard=100 ihard=10 ${id}`, '/workspaces'], expect.anything());
+    expect(usage).toEqual({ bytesUsed: 2048 * 1024, fileCount: 7 });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,74 @@
+const crypto = require('crypto');
+const workspaceSecrets = require('../../services/workspaceSecrets');
+const { MemorySecretRepository } = require('../../services/workspaceSecrets');
+const Workspace = require('../../models/Workspace');
+
+jest.mock('../../models/Workspace', () => ({ findById: jest.fn() }));
+
+describe('WorkspaceSecrets', () => {
+  let repository;
+
+  beforeEach(() => {
+    repository = new MemorySecretRepository();
+    workspaceSecrets.setRepository(repository);
+    workspaceSecrets.config = {
+      ...workspaceSecrets.config,
+      key: crypto.randomBytes(32).toString('base64'),
+      maxPerWorkspace: 2,
+      maxValueBytes: 64
+    };
+    Workspace.findById.mockResolvedValue({ hasPermission: (userId, permission) => userId === 'user-1' && permission === 'execute' });
+  });
+
+  it('should store values encrypted and list names only', async () => {
+    const result = await workspaceSecrets.set('ws-1', 'API_TOKEN', 'tok-123', 'user-1');
+
+    expect(result).toMatchObject({ name: 'API_TOKEN', created: true });
+    const [stored] = await repository.list('ws-1');
+    expect(JSON.stringify(stored)).not.toContain('tok-123');
+    expect(await workspaceSecrets.list('ws-1')).toEqual([
+      expect.objectContaining({ name: 'API_TOKEN', updatedBy: 'user-1' })
+    ]);
+    expect(JSON.stringify(await workspaceSecrets.list('ws-1'))).not.toContain('tok-123');
+  });
+
+  it('should decrypt for executions and apply updates and deletes right away', async () => {
+    await workspaceSecrets.set('ws-1', 'API_TOKEN', 'first', 'user-1');
+    await workspaceSecrets.set('ws-1', 'DB_URL', 'postgres://db', 'user-1');
+    expect(await workspaceSecrets.forExecution('ws-1', 'user-1')).toEqual({ API_TOKEN: 'first', DB_URL: 'postgres://db' });
+
+    expect((await workspaceSecrets.set('ws-1', 'API_TOKEN', 'second', 'user-1')).created).toBe(false);
+    await workspaceSecrets.remove('ws-1', 'DB_URL', 'user-1');
+
+    expect(await workspaceSecrets.forExecution('ws-1', 'user-1')).toEqual({ API_TOKEN: 'second' });
+  });
+
+  it('should not decrypt a value moved to another workspace', async () => {
+    await workspaceSecrets.set('ws-1', 'API_TOKEN', 'tok-123', 'user-1');
+    const [entry] = await repository.list('ws-1');
+    await repository.upsert({ ...entry, workspaceId: 'ws-2' });
+
+    expect(await workspaceSecrets.forExecution('ws-2', 'user-1')).toEqual({});
+  });
+
+  it('should require execute permission on the workspace', async () => {
+    await expect(workspaceSecrets.forExecution('ws-1', 'viewer-1')).rejects.toMatchObject({ code: 'ACCESS_DENIED' });
+  });
+
+  it('should reject invalid and reserved names, oversized values and too many secrets', async () => {
+    await expect(workspaceSecrets.set('ws-1', '1TOKEN', 'x', 'user-1')).rejects.toMatchObject({ code: 'INVALID_SECRET' });
+    await expect(workspaceSecrets.set('ws-1', 'LD_PRELOAD', 'x', 'user-1')).rejects.toThrow('reserved by the sandbox');
+    await expect(workspaceSecrets.set('ws-1', 'BIG', 'x'.repeat(65), 'user-1')).rejects.toThrow('size limit of 64 bytes');
+
+    await workspaceSecrets.set('ws-1', 'A', 'x', 'user-1');
+    await workspaceSecrets.set('ws-1', 'B', 'x', 'user-1');
+    await expect(workspaceSecrets.set('ws-1', 'C', 'x', 'user-1')).rejects.toMatchObject({ code: 'SECRET_LIMIT' });
+  });
+
+  it('should refuse to work without a key', async () => {
+    workspaceSecrets.config = { ...workspaceSecrets.config, key: null };
+
+    await expect(workspaceSecrets.set('ws-1', 'API_TOKEN', 'x', 'user-1')).rejects.toMatchObject({ code: 'SECRETS_DISABLED' });
+    await expect(workspaceSecrets.forExecution('ws-1', 'user-1')).rejects.toMatchObject({ code: 'SECRETS_DISABLED' });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,119 @@
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const logger = require('../../utils/logger');
+const fileSystem = require('../../utils/fileSystem');
+const requestContext = require('../../utils/requestContext');
+const workspaceWatcher = require('../../services/workspaceWatcher');
+
+describe('WorkspaceWatcher', () => {
+  const workspaceId = 'workspace-1';
+  let basePath;
+  let originalBasePath;
+  let socket;
+
+  const workspaceFile = (name) => path.join(basePath, workspaceId, name);
+  const batches = () => socket.emit.mock.calls.filter(([event]) => event === 'file:changes').map(([, payload]) => payload);
+  const waitForBatch = (count = 1) => new Promise((resolve, reject) => {
+    const deadline = Date.now() + 2000;
+    const check = () => {
+      if (batches().length >= count) {
+        return resolve(batches()[count - 1]);
+      }
+      if (Date.now() > deadline) {
+        return reject(new Error('no file:changes event'));
+      }
+      setTimeout(check, 10);
+    };
+    check();
+  });
+
+  beforeEach(() => {
+    jest.spyOn(logger, 'info').mockImplementation(() => {});
+    jest.spyOn(logger, 'warn').mockImplementation(() => {});
+    basePath = fs.mkdtempSync(path.join(os.tmpdir(), 'watcher-'));
+    fs.mkdirSync(path.join(basePath, workspaceId));
+    fs.writeFileSync(workspaceFile('main.py'), 'print(1)');
+    originalBasePath = fileSystem.workspaceBasePath;
+    fileSystem.workspaceBasePath = basePath;
+    workspaceWatcher.config = { enabled: true, mode: 'fsnotify', batchWindowMs: 50, attributionMs: 2000, maxEntries: 100 };
+    socket = { id: 'socket-1', emit: jest.fn() };
+  });
+
+  afterEach(() => {
+    workspaceWatcher.shutdown();
+    fileSystem.workspaceBasePath = originalBasePath;
+    fs.rmSync(basePath, { recursive: true, force: true });
+    logger.info.mockRestore();
+    logger.warn.mockRestore();
+  });
+
+  it('should batch created, modified and deleted files into one event', async () => {
+    await workspaceWatcher.subscribe(workspaceId, socket);
+
+    fs.writeFileSync(workspaceFile('out.txt'), 'result');
+    fs.writeFileSync(workspaceFile('main.py'), 'print(42)');
+    fs.mkdirSync(workspaceFile('build'));
+    fs.writeFileSync(workspaceFile('build/report.json'), '{}');
+    const batch = await waitForBatch();
+
+    expect(batch.workspaceId).toBe(workspaceId);
+    expect(batch.changes).toEqual(expect.arrayContaining([
+      { event: 'created', path: 'out.txt' },
+      { event: 'modified', path: 'main.py' },
+      { event: 'created', path: 'build' },
+      { event: 'created', path: 'build/report.json' }
+    ]));
+    expect(batches()).toHaveLength(1);
+
+    fs.rmSync(workspaceFile('build'), { recursive: true });
+    const deleted = await waitForBatch(2);
+    expect(deleted.changes).toEqual(expect.arrayContaining([{ event: 'deleted', path: 'build' }]));
+    expect(deleted.changes.some(change => change.path === 'build/report.json')).toBe(false);
+  });
+
+  it('should tag changes made through the file API with the request ID', async () => {
+    await workspaceWatcher.subscribe(workspaceId, socket);
+
+    await requestContext.run({ requestId: 'req-42' }, () => fileSystem.writeFile(workspaceId, 'src/app.py', 'x = 1'));
+    const batch = await waitForBatch();
+
+    expect(batch.changes).toEqual(expect.arrayContaining([
+      { event: 'created', path: 'src', requestId: 'req-42' },
+      { event: 'created', path: 'src/app.py', requestId: 'req-42' }
+    ]));
+  });
+
+  it('should rescan after an execution in diff mode', async () => {
+    workspaceWatcher.config.mode = 'diff';
+    const { mode } = await workspaceWatcher.subscribe(workspaceId, socket);
+    expect(mode).toBe('diff');
+
+    fs.writeFileSync(workspaceFile('generated.py'), 'pass');
+    fs.unlinkSync(workspaceFile('main.py'));
+    await workspaceWatcher.executionFinished(workspaceId);
+
+    expect(batches()).toEqual([{
+      workspaceId,
+      changes: [
+        { event: 'created', path: 'generated.py' },
+        { event: 'deleted', path: 'main.py' }
+      ]
+    }]);
+  });
+
+  it('should close the watch when the last subscriber leaves', async () => {
+    const other = { id: 'socket-2', emit: jest.fn() };
+    await workspaceWatcher.subscribe(workspaceId, socket);
+    await workspaceWatcher.subscribe(workspaceId, other);
+    const { watcher } = workspaceWatcher.watches.get(workspaceId);
+    jest.spyOn(watcher, 'close');
+
+    workspaceWatcher.unsubscribe(workspaceId, socket);
+    expect(watcher.close).not.toHaveBeenCalled();
+
+    workspaceWatcher.unsubscribeAll(other);
+    expect(watcher.close).toHaveBeenCalled();
+    expect(workspaceWatcher.watches.size).toBe(0);
+  });
+});
\ No newline at end of file
@@ -0,0 +1,57 @@
+const artifactPatterns = require('../../utils/artifactPatterns');
+const config = require('../../config');
+
+describe('artifactPatterns', () => {
+  describe('validate', () => {
+    it('should accept relative globs and drop duplicates', () => {
+      const result = artifactPatterns.validate(['out/*.png', 'report.csv', 'out/*.png']);
+
+      expect(result.isValid).toBe(true);
+      expect(result.patterns).toEqual(['out/*.png', 'report.csv']);
+    });
+
+    it('should treat no patterns as none', () => {
+      expect(artifactPatterns.validate(undefined)).toEqual({ isValid: true, errors: [], patterns: [] });
+    });
+
+    it('should reject patterns that could leave the workspace', () => {
+      const result = artifactPatterns.validate(['/etc/passwd', '../secret', 'out/../../x', 'a\\b', 'out//x']);
+
+      expect(result.isValid).toBe(false);
+      expect(result.errors).toEqual([
+        'artifacts[0] must be a path relative to the workspace',
+        'artifacts[1] must not contain "..", "." or empty path segments',
+        'artifacts[2] must not contain "..", "." or empty path segments',
+        'artifacts[3] must be a path relative to the workspace',
+        'artifacts[4] must not contain "..", "." or empty path segments'
+      ]);
+    });
+
+    it('should enforce the pattern count limit', () => {
+      const result = artifactPatterns.validate(Array.from({ length: config.artifacts.maxPatterns + 1 }, (_, i) => `f${i}`));
+
+      expect(result.errors).toContain(`Too many artifact patterns (max ${config.artifacts.maxPatterns})`);
+    });
+  });
+
+  describe('matcher', () => {
+    it('should keep * and ? within one path segment', () => {
+      const matches = artifactPatterns.matcher(['out/*.png', 'data?.csv']);
+
+      expect(matches('out/plot.png')).toBe(true);
+      expect(matches('out/sub/plot.png')).toBe(false);
+      expect(matches('data1.csv')).toBe(true);
+      expect(matches('data10.csv')).toBe(false);
+      expect(matches('outXplot.png')).toBe(false);
+    });
+
+    it('should let ** span any number of directories', () => {
+      const matches = artifactPatterns.matcher(['**/report.csv', 'logs/**']);
+
+      expect(matches('report.csv')).toBe(true);
+      expect(matches('a/b/report.csv')).toBe(true);
+      expect(matches('logs/run/1.log')).toBe(true);
+      expect(matches('other/1.log')).toBe(false);
+    });
+  });
+});
\ No newline at end of file
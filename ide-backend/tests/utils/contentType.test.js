@@ -0,0 +1,39 @@
+const { detectContentType, isBinaryContentType } = require('../../utils/contentType');
+
+describe('contentType', () => {
+  const hex = (value) => Buffer.from(value, 'hex');
+
+  it('should recognize common binary formats by signature', () => {
+    expect(detectContentType(hex('89504e470d0a1a0a0000000d49484452'))).toBe('image/png');
+    expect(detectContentType(hex('ffd8ffe000104a464946'))).toBe('image/jpeg');
+    expect(detectContentType(Buffer.from('GIF89a\x01\x00', 'latin1'))).toBe('image/gif');
+    expect(detectContentType(Buffer.from('%PDF-1.7\n', 'latin1'))).toBe('application/pdf');
+    expect(detectContentType(hex('504b0304140000000800'))).toBe('application/zip');
+    expect(detectContentType(hex('0061736d01000000'))).toBe('application/wasm');
+    expect(detectContentType(Buffer.from('RIFF\x24\x00\x00\x00WEBPVP8 ', 'latin1'))).toBe('image/webp');
+    expect(detectContentType(hex('000000186674797069736f6d0000020069736f6d6d703431'))).toBe('video/mp4');
+  });
+
+  it('should match HTML and XML after leading whitespace, ignoring case', () => {
+    expect(detectContentType(Buffer.from('  \n<!doctype html>\n<html>'))).toBe('text/html; charset=utf-8');
+    expect(detectContentType(Buffer.from('<p>hi</p>'))).toBe('text/html; charset=utf-8');
+    expect(detectContentType(Buffer.from('<pre>'))).toBe('text/plain; charset=utf-8');
+    expect(detectContentType(Buffer.from('\t<?xml version="1.0"?>'))).toBe('text/xml; charset=utf-8');
+  });
+
+  it('should tell text from other binary data', () => {
+    expect(detectContentType(Buffer.from('print("hello")\n'))).toBe('text/plain; charset=utf-8');
+    expect(detectContentType(Buffer.from('﻿café', 'utf8'))).toBe('text/plain; charset=utf-8');
+    expect(detectContentType(Buffer.from('SQLite format 3\x00\x10\x00', 'latin1'))).toBe('application/octet-stream');
+    expect(detectContentType(Buffer.alloc(0))).toBe('text/plain; charset=utf-8');
+
+    expect(isBinaryContentType('image/png')).toBe(true);
+    expect(isBinaryContentType('text/xml; charset=utf-8')).toBe(false);
+  });
+
+  it('should only look at the first 512 bytes', () => {
+    const data = Buffer.concat([Buffer.alloc(512, 'a'), Buffer.from([0, 1, 2])]);
+
+    expect(detectContentType(data)).toBe('text/plain; charset=utf-8');
+  });
+});
\ No newline at end of file
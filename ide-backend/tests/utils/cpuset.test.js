@@ -0,0 +1,18 @@
+const cpuset = require('../../utils/cpuset');
+
+describe('cpuset', () => {
+  it('should parse CPU numbers and ranges in order without duplicates', () => {
+    expect(cpuset.parse('6-7, 2,3,2')).toEqual([2, 3, 6, 7]);
+    expect(cpuset.parse('')).toEqual([]);
+  });
+
+  it('should reject anything that is not a CPU list', () => {
+    expect(() => cpuset.parse('a-b')).toThrow('Invalid CPU list "a-b"');
+    expect(() => cpuset.parse('7-6')).toThrow('Invalid CPU range "7-6"');
+  });
+
+  it('should format consecutive CPUs as ranges', () => {
+    expect(cpuset.format([8, 0, 1, 2, 5, 7])).toBe('0-2,5,7-8');
+    expect(cpuset.format([3])).toBe('3');
+  });
+});
\ No newline at end of file
@@ -0,0 +1,147 @@
+const diagnosticsParser = require('../../utils/diagnostics');
+
+describe('diagnosticsParser', () => {
+  it('should parse Go compiler errors', () => {
+    const stderr = [
+      '# command-line-arguments',
+      './main.go:12:5: undefined: foo',
+      './pkg/util.go:3:2: "os" imported and not used'
+    ].join('\n');
+
+    expect(diagnosticsParser.parse('go', stderr)).toEqual([
+      { file: 'main.go', line: 12, col: 5, severity: 'error', message: 'undefined: foo' },
+      { file: 'pkg/util.go', line: 3, col: 2, severity: 'error', message: '"os" imported and not used' }
+    ]);
+  });
+
+  it('should point Go panics at the first workspace frame', () => {
+    const stderr = [
+      'panic: runtime error: index out of range [3] with length 1',
+      '',
+      'goroutine 1 [running]:',
+      'main.main()',
+      '\t/workspace/main.go:8 +0x1d',
+      'exit status 2'
+    ].join('\n');
+
+    expect(diagnosticsParser.parse('go', stderr)).toEqual([{
+      file: 'main.go',
+      line: 8,
+      col: null,
+      severity: 'error',
+      message: 'panic: runtime error: index out of range [3] with length 1'
+    }]);
+  });
+
+  it('should report the failing line of a Python traceback', () => {
+    const stderr = [
+      'Traceback (most recent call last):',
+      '  File "/workspace/main.py", line 5, in <module>',
+      '    run()',
+      '  File "/workspace/main.py", line 2, in run',
+      '    print(value)',
+      "NameError: name 'value' is not defined"
+    ].join('\n');
+
+    expect(diagnosticsParser.parse('python', stderr)).toEqual([{
+      file: 'main.py',
+      line: 2,
+      col: null,
+      severity: 'error',
+      message: "NameError: name 'value' is not defined"
+    }]);
+  });
+
+  it('should take the column of Python syntax errors from the caret', () => {
+    const stderr = [
+      '  File "/workspace/main.py", line 1',
+      '    print("hi"',
+      '         ^',
+      "SyntaxError: '(' was never closed"
+    ].join('\n');
+
+    expect(diagnosticsParser.parse('python', stderr)).toEqual([{
+      file: 'main.py',
+      line: 1,
+      col: 6,
+      severity: 'error',
+      message: "SyntaxError: '(' was never closed"
+    }]);
+  });
+
+  it('should use the first user frame of a Node stack trace', () => {
+    const stderr = [
+      '/workspace/main.js:1',
+      'foo();',
+      '^',
+      '',
+      'ReferenceError: foo is not defined',
+      '    at Object.<anonymous> (/workspace/main.js:1:1)',
+      '    at Module._compile (node:internal/modules/cjs/loader:1256:14)'
+    ].join('\n');
+
+    expect(diagnosticsParser.parse('node', stderr)).toEqual([{
+      file: 'main.js',
+      line: 1,
+      col: 1,
+      severity: 'error',
+      message: 'ReferenceError: foo is not defined'
+    }]);
+  });
+
+  it('should parse Node stack traces without a source header', () => {
+    const stderr = [
+      'Error: boom',
+      '    at fail (/workspace/lib/util.js:4:9)',
+      '    at /workspace/main.js:2:1'
+    ].join('\n');
+
+    expect(diagnosticsParser.parse('node', stderr)).toEqual([{
+      file: 'lib/util.js',
+      line: 4,
+      col: 9,
+      severity: 'error',
+      message: 'Error: boom'
+    }]);
+  });
+
+  it('should return an empty array when output cannot be parsed', () => {
+    expect(diagnosticsParser.parse('go', 'something went wrong')).toEqual([]);
+    expect(diagnosticsParser.parse('python', 'Killed')).toEqual([]);
+    expect(diagnosticsParser.parse('rust', 'error[E0425]: cannot find value')).toEqual([]);
+    expect(diagnosticsParser.parse('node', '')).toEqual([]);
+  });
+
+  it('should parse gofmt syntax errors from stdin', () => {
+    const stderr = '<standard input>:3:1: expected declaration, found fmt\n<standard input>:5:2: expected \'}\', found \'EOF\'\n';
+
+    expect(diagnosticsParser.parseFormatter('gofmt', stderr, 'main.go')).toEqual([
+      { file: 'main.go', line: 3, col: 1, severity: 'error', message: 'expected declaration, found fmt' },
+      { file: 'main.go', line: 5, col: 2, severity: 'error', message: 'expected \'}\', found \'EOF\'' }
+    ]);
+  });
+
+  it('should parse black parse errors with and without a target version', () => {
+    expect(diagnosticsParser.parseFormatter('black', 'error: cannot format -: Cannot parse for target version Python 3.11: 2:7: def f(\n', 'main.py')).toEqual([
+      { file: 'main.py', line: 2, col: 7, severity: 'error', message: 'Cannot parse: def f(' }
+    ]);
+    expect(diagnosticsParser.parseFormatter('black', 'error: cannot format -: Cannot parse: 1:4: x = = 1', 'main.py')[0].line).toBe(1);
+  });
+
+  it('should parse prettier syntax errors without the code frame', () => {
+    const stderr = [
+      "[error] main.ts: SyntaxError: ';' expected. (1:9)",
+      '[error] > 1 | let x = y z',
+      '[error]     |         ^'
+    ].join('\n');
+
+    expect(diagnosticsParser.parseFormatter('prettier', stderr, 'main.ts')).toEqual([
+      { file: 'main.ts', line: 1, col: 9, severity: 'error', message: "SyntaxError: ';' expected." }
+    ]);
+  });
+
+  it('should return an empty array for unknown formatter output', () => {
+    expect(diagnosticsParser.parseFormatter('black', 'error: cannot format -: INTERNAL ERROR')).toEqual([]);
+    expect(diagnosticsParser.parseFormatter('rustfmt', 'error: expected item')).toEqual([]);
+  });
+});
\ No newline at end of file
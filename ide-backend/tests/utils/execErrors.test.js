@@ -0,0 +1,97 @@
+const config = require('../../config');
+const { ExecError, classify, wrap, toResponse, send, checkCodeSize, validationFailed, outcome } = require('../../utils/execErrors');
+
+describe('execErrors', () => {
+  const response = () => {
+    const res = { headers: {} };
+    res.set = jest.fn((name, value) => {
+      res.headers[name] = value;
+      return res;
+    });
+    res.status = jest.fn(() => res);
+    res.json = jest.fn(() => res);
+    return res;
+  };
+
+  describe('HTTP mapping', () => {
+    it.each([
+      ['RUNTIME_NOT_FOUND', 400, 'language'],
+      ['INVALID_CALLBACK_URL', 400, 'callback_url'],
+      ['ACCESS_DENIED', 403, null],
+      ['CONTAINER_NOT_FOUND', 404, null],
+      ['CODE_TOO_LARGE', 413, 'code'],
+      ['QUEUE_FULL', 429, null],
+      ['SHUTTING_DOWN', 503, null],
+      ['DOCKER_UNAVAILABLE', 503, null]
+    ])('should map %s to %i', (code, status, param) => {
+      const error = Object.assign(new Error('nope'), { code });
+      const res = response();
+
+      send(res, error, { requestId: 'req-1' });
+
+      expect(res.status).toHaveBeenCalledWith(status);
+      expect(res.json.mock.calls[0][0]).toMatchObject({ code, message: 'nope', requestId: 'req-1' });
+      if (status === 400) {
+        expect(res.json.mock.calls[0][0].details).toEqual([{ param, msg: 'nope' }]);
+      }
+    });
+
+    it('should treat anything unrecognized as an infrastructure fault', () => {
+      const res = response();
+
+      send(res, new Error('connect ENOENT /var/run/docker.sock'), { title: 'Code execution failed' });
+
+      expect(res.status).toHaveBeenCalledWith(500);
+      expect(res.json.mock.calls[0][0]).toMatchObject({
+        error: 'Code execution failed',
+        code: 'INTERNAL',
+        kind: 'infrastructure'
+      });
+    });
+
+    it('should set Retry-After for backpressure', () => {
+      const res = response();
+
+      send(res, Object.assign(new Error('Execution queue is full'), { code: 'QUEUE_FULL', retryAfter: 5 }));
+
+      expect(res.headers['Retry-After']).toBe('5');
+      expect(res.json.mock.calls[0][0]).toMatchObject({ error: 'Too many requests', retryAfter: 5 });
+    });
+
+    it('should keep validation details and typed errors through wrap', () => {
+      expect(toResponse(validationFailed([{ param: 'env', msg: 'bad name' }]))).toMatchObject({
+        error: 'Validation failed',
+        code: 'VALIDATION_FAILED',
+        details: [{ param: 'env', msg: 'bad name' }]
+      });
+
+      const typed = new ExecError('not_found', 'CONTAINER_NOT_FOUND', 'Container not found');
+      expect(wrap(typed, 'Execution failed')).toBe(typed);
+      expect(wrap(new Error('socket hang up'), 'Execution failed').message).toBe('Execution failed: socket hang up');
+      expect(classify(wrap(new Error('socket hang up'), 'Execution failed')).statusCode).toBe(500);
+    });
+
+    it('should reject code over the size limit with 413', () => {
+      const maxBytes = config.execution.maxCodeBytes;
+
+      expect(() => checkCodeSize('x'.repeat(maxBytes))).not.toThrow();
+      expect(() => checkCodeSize('x'.repeat(maxBytes + 1))).toThrow(expect.objectContaining({ code: 'CODE_TOO_LARGE', statusCode: 413 }));
+    });
+  });
+
+  describe('outcome', () => {
+    const finished = (fields) => ({ status: 'completed', exitCode: 0, killedReason: null, ...fields });
+
+    it('should classify how a program ended', () => {
+      expect(outcome(finished({}))).toBe('ok');
+      expect(outcome(finished({ exitCode: 1 }))).toBe('runtime_error');
+      expect(outcome(finished({ exitCode: 1, compileFailed: true }))).toBe('compile_error');
+      expect(outcome(finished({ exitCode: null, killedReason: 'timeout', timeoutPhase: 'compile', compileFailed: true }))).toBe('timeout');
+      expect(outcome(finished({ exitCode: null, killedReason: 'timeout', timeoutPhase: 'run' }))).toBe('timeout');
+      expect(outcome(finished({ exitCode: 137, killedReason: 'oom' }))).toBe('oom');
+      expect(outcome(finished({ exitCode: 1, killedReason: 'disk_limit' }))).toBe('resource_limit');
+      expect(outcome({ status: 'cancelled' })).toBe('cancelled');
+      expect(outcome({ status: 'error', error: 'stream reset' })).toBe('error');
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,113 @@
+const fs = require('fs').promises;
+const os = require('os');
+const path = require('path');
+const fileSystem = require('../../utils/fileSystem');
+
+// Workspaces are bind mounted read-write into containers, so the links in
+// these tests are what a program running there could leave behind
+describe('fileSystem symbolic links', () => {
+  const workspaceId = 'links-workspace';
+  let basePath;
+  let outside;
+  let original;
+
+  beforeEach(async () => {
+    original = { workspaceBasePath: fileSystem.workspaceBasePath, hostBasePath: fileSystem.hostBasePath };
+    basePath = await fs.mkdtemp(path.join(os.tmpdir(), 'studio-workspaces-'));
+    outside = await fs.mkdtemp(path.join(os.tmpdir(), 'studio-outside-'));
+    fileSystem.workspaceBasePath = basePath;
+    fileSystem.hostBasePath = basePath;
+
+    await fs.mkdir(path.join(basePath, workspaceId, 'src'), { recursive: true });
+    await fs.writeFile(path.join(basePath, workspaceId, 'src', 'main.js'), 'console.log(1);\n');
+    await fs.writeFile(path.join(outside, 'secret.txt'), 'WORKSPACE_SECRETS_KEY=hunter2\n');
+  });
+
+  afterEach(async () => {
+    Object.assign(fileSystem, original);
+    await fs.rm(basePath, { recursive: true, force: true });
+    await fs.rm(outside, { recursive: true, force: true });
+  });
+
+  const plant = (target, linkPath) => fs.symlink(target, path.join(basePath, workspaceId, linkPath));
+
+  it('should not read, stat or stream a file through a linked directory', async () => {
+    await plant(outside, 'r');
+
+    await expect(fileSystem.readFile(workspaceId, 'r/secret.txt')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    await expect(fileSystem.getItemStats(workspaceId, 'r/secret.txt')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    await expect(fileSystem.createReadStream(workspaceId, 'r/secret.txt')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    await expect(fileSystem.computeFileETag(workspaceId, 'r/secret.txt')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    expect(await fileSystem.exists(workspaceId, 'r/secret.txt')).toBe(false);
+  });
+
+  it('should not read a linked file, even one pointing inside the workspace', async () => {
+    await plant(path.join(outside, 'secret.txt'), 'leak.txt');
+    await plant('src/main.js', 'alias.js');
+
+    await expect(fileSystem.readFile(workspaceId, 'leak.txt')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    await expect(fileSystem.readFile(workspaceId, 'alias.js')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    expect(await fileSystem.readFile(workspaceId, 'src/main.js')).toBe('console.log(1);\n');
+  });
+
+  it('should not write through a link to a file or directory outside the workspace', async () => {
+    await plant(path.join(outside, 'secret.txt'), 'leak.txt');
+    await plant(outside, 'r');
+
+    await expect(fileSystem.writeFile(workspaceId, 'leak.txt', 'overwritten')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    await expect(fileSystem.writeFile(workspaceId, 'r/new.txt', 'planted')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    await expect(fileSystem.writeFile(workspaceId, 'r/deeper/new.txt', 'planted')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    await expect(fileSystem.copyItem(workspaceId, 'src/main.js', 'leak.txt')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+
+    expect(await fs.readFile(path.join(outside, 'secret.txt'), 'utf8')).toBe('WORKSPACE_SECRETS_KEY=hunter2\n');
+    expect(await fs.readdir(outside)).toEqual(['secret.txt']);
+  });
+
+  it('should not copy a linked file into the workspace', async () => {
+    await plant(path.join(outside, 'secret.txt'), 'leak.txt');
+
+    await expect(fileSystem.copyItem(workspaceId, 'leak.txt', 'copy.txt')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    expect(await fileSystem.exists(workspaceId, 'copy.txt')).toBe(false);
+  });
+
+  it('should leave links, dangling ones included, out of directory listings', async () => {
+    await plant(outside, 'r');
+    await plant('/nonexistent/target', 'dangling.txt');
+
+    const entries = await fileSystem.listDirectory(workspaceId);
+    expect(entries.map(entry => entry.name)).toEqual(['src']);
+    await expect(fileSystem.listDirectory(workspaceId, 'r')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+  });
+
+  it('should still delete a planted link without touching its target', async () => {
+    await plant(path.join(outside, 'secret.txt'), 'leak.txt');
+
+    await fileSystem.deleteFile(workspaceId, 'leak.txt');
+
+    expect(await fs.readFile(path.join(outside, 'secret.txt'), 'utf8')).toBe('WORKSPACE_SECRETS_KEY=hunter2\n');
+  });
+
+  // Needs a real Docker daemon: DOCKER_INTEGRATION=true npm test
+  const itDocker = process.env.DOCKER_INTEGRATION === 'true' ? it : it.skip;
+
+  itDocker('should not follow a link a container created through the workspace mount', async () => {
+    const dockerService = require('../../services/dockerService');
+    await dockerService.initialize();
+    const { containerId } = await dockerService.createContainer('node', 'links-test', 'links-test-user', { mountWorkspaceId: workspaceId });
+
+    try {
+      const { stream } = await dockerService.executeCode(containerId, "require('fs').symlinkSync('/', '/workspace/r')", 'main');
+      await new Promise((resolve, reject) => {
+        stream.on('end', resolve);
+        stream.on('error', reject);
+        stream.resume();
+      });
+
+      expect((await fs.lstat(path.join(basePath, workspaceId, 'r'))).isSymbolicLink()).toBe(true);
+      await expect(fileSystem.readFile(workspaceId, `r${path.join(outside, 'secret.txt')}`)).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+      await expect(fileSystem.writeFile(workspaceId, 'r/tmp/planted.txt', 'x')).rejects.toMatchObject({ code: 'SYMLINK_NOT_ALLOWED' });
+    } finally {
+      await dockerService.stopContainer(containerId, { force: true });
+    }
+  }, 120000);
+});
\ No newline at end of file
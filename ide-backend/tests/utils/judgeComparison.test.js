@@ -0,0 +1,70 @@
+const { compare, diff, truncate } = require('../../utils/judgeComparison');
+
+describe('judgeComparison', () => {
+  describe('compare', () => {
+    it.each([
+      // mode, actual, expected, accepted
+      ['exact', '42\n', '42\n', true],
+      ['exact', '42\r\n', '42\n', true],
+      ['exact', '1\n2\n', '1\r\n2\r\n', true],
+      ['exact', '42', '42\n', false],
+      ['exact', '42 \n', '42\n', false],
+      ['exact', '42\n\n', '42\n', false],
+      ['exact', '4 2\n', '42\n', false],
+      ['trimmed', '42 \n', '42\n', true],
+      ['trimmed', '42\t\n', '42', true],
+      ['trimmed', '1 2  \r\n3\r\n\r\n\r\n', '1 2\n3\n', true],
+      ['trimmed', '42\n\n\n', '42', true],
+      ['trimmed', ' 42\n', '42\n', false],
+      ['trimmed', '1  2\n', '1 2\n', false],
+      ['trimmed', '1\n\n2\n', '1\n2\n', false],
+      ['float', '0.3333333\n', '0.333333333\n', true],
+      ['float', '1000000.5\n', '1000000.4\n', true],
+      ['float', '1000002\n', '1000000\n', false],
+      ['float', '1e-7\n', '0\n', true],
+      ['float', '3.14 2.71\r\n', '3.14\n2.71\n', true],
+      ['float', '3.15\n', '3.14\n', false],
+      ['float', 'x = 1.0000000001\n', 'x = 1\n', true],
+      ['float', 'y = 1.0\n', 'x = 1.0\n', false],
+      ['float', '1 2\n', '1 2 3\n', false],
+      ['float', 'nan\n', '0\n', false],
+      ['float', '', '', true]
+    ])('%s: %j against %j should be %s', (mode, actual, expected, accepted) => {
+      expect(compare(actual, expected, { mode })).toBe(accepted);
+    });
+
+    it.each([
+      [1e-6, false],
+      [1e-5, true]
+    ])('float should use tolerance %s as relative for large values', (tolerance, accepted) => {
+      expect(compare('1000005', '1000000', { mode: 'float', tolerance })).toBe(accepted);
+    });
+
+    it('should compare exactly by default', () => {
+      expect(compare('42 \n', '42\n')).toBe(false);
+    });
+  });
+
+  describe('diff', () => {
+    it.each([
+      ['1\n2\n3\n', '1\n2\n4\n', { line: 3, expected: '4', actual: '3' }],
+      ['1\r\n2\r\n', '1\n3\n', { line: 2, expected: '3', actual: '2' }],
+      ['1\n', '1\n2\n', { line: 2, expected: '2', actual: '' }],
+      ['1', '1\n2', { line: 2, expected: '2', actual: null }]
+    ])('should locate the first difference between %j and %j', (actual, expected, firstDifference) => {
+      expect(diff(actual, expected, 1024).first_difference).toEqual(firstDifference);
+    });
+
+    it('should truncate both outputs to the limit', () => {
+      const result = diff('a'.repeat(100), 'b'.repeat(10), 16);
+
+      expect(result.actual).toBe('a'.repeat(16));
+      expect(result.expected).toBe('b'.repeat(10));
+      expect(result.truncated).toBe(true);
+    });
+  });
+
+  it('should not split multi-byte characters when truncating', () => {
+    expect(truncate('ééé', 3)).toEqual({ text: 'é', truncated: true });
+  });
+});
\ No newline at end of file
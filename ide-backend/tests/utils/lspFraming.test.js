@@ -0,0 +1,54 @@
+const { encodeMessage, MessageReader } = require('../../utils/lspFraming');
+
+describe('lspFraming', () => {
+  const collect = () => {
+    const messages = [];
+    const errors = [];
+    const reader = new MessageReader({
+      onMessage: message => messages.push(message),
+      onError: error => errors.push(error.message)
+    }, 1024);
+    return { reader, messages, errors };
+  };
+
+  it('should count Content-Length in bytes', () => {
+    const frame = encodeMessage({ jsonrpc: '2.0', method: 'log', params: { text: 'héllo' } });
+    const [header] = frame.toString('utf8').split('\r\n\r\n');
+    expect(header).toBe(`Content-Length: ${frame.length - header.length - 4}`);
+  });
+
+  it('should decode messages split across chunks at any byte', () => {
+    const { reader, messages } = collect();
+    const frames = Buffer.concat([
+      encodeMessage({ id: 1, result: { label: 'ünïcode' } }),
+      encodeMessage({ method: 'textDocument/publishDiagnostics', params: { diagnostics: [] } })
+    ]);
+
+    for (let i = 0; i < frames.length; i++) {
+      reader.write(frames.subarray(i, i + 1));
+    }
+
+    expect(messages).toEqual([
+      { id: 1, result: { label: 'ünïcode' } },
+      { method: 'textDocument/publishDiagnostics', params: { diagnostics: [] } }
+    ]);
+  });
+
+  it('should accept extra headers and skip bodies that are not JSON', () => {
+    const { reader, messages, errors } = collect();
+    reader.write(Buffer.from('Content-Length: 3\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n{x}'));
+    reader.write(encodeMessage({ id: 2 }));
+
+    expect(errors).toHaveLength(1);
+    expect(messages).toEqual([{ id: 2 }]);
+  });
+
+  it('should stop reading after an oversized or unframed message', () => {
+    const { reader, messages, errors } = collect();
+    reader.write(Buffer.from('Content-Length: 4096\r\n\r\n'));
+    reader.write(encodeMessage({ id: 3 }));
+
+    expect(errors[0]).toContain('exceeds 1024');
+    expect(messages).toEqual([]);
+  });
+});
\ No newline at end of file
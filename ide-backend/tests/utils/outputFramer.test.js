@@ -0,0 +1,79 @@
+const OutputFramer = require('../../utils/outputFramer');
+
+describe('OutputFramer', () => {
+  let frames;
+  let framer;
+
+  beforeEach(() => {
+    jest.useFakeTimers();
+    frames = [];
+    framer = new OutputFramer(frame => frames.push(frame));
+  });
+
+  afterEach(() => {
+    framer.close();
+    jest.useRealTimers();
+  });
+
+  it('should flush buffered output after the flush interval', () => {
+    framer.write('stdout', Buffer.from('hello '));
+    framer.write('stdout', Buffer.from('world'));
+
+    expect(frames).toHaveLength(0);
+
+    jest.advanceTimersByTime(100);
+
+    expect(frames).toEqual([{ stream: 'stdout', data: 'hello world', seq: 1 }]);
+  });
+
+  it('should flush immediately once a stream buffers 4KB', () => {
+    framer.write('stdout', Buffer.alloc(4096, 'a'));
+
+    expect(frames).toHaveLength(1);
+    expect(frames[0].data).toHaveLength(4096);
+  });
+
+  it('should split oversized writes into 4KB frames', () => {
+    framer.write('stdout', Buffer.alloc(10000, 'a'));
+
+    expect(frames.map(frame => frame.data.length)).toEqual([4096, 4096, 1808]);
+  });
+
+  it('should keep stdout and stderr in separate frames with increasing seq', () => {
+    framer.write('stdout', Buffer.from('out'));
+    framer.write('stderr', Buffer.from('err'));
+    framer.close();
+
+    expect(frames).toEqual([
+      { stream: 'stdout', data: 'out', seq: 1 },
+      { stream: 'stderr', data: 'err', seq: 2 }
+    ]);
+  });
+
+  it('should not split multi-byte characters across frames', () => {
+    const euro = Buffer.from('€');
+    framer.write('stdout', euro.subarray(0, 1));
+    jest.advanceTimersByTime(100);
+    framer.write('stdout', euro.subarray(1));
+    framer.close();
+
+    expect(frames.map(frame => frame.data).join('')).toBe('€');
+    expect(frames.every(frame => !frame.data.includes('�'))).toBe(true);
+  });
+
+  it('should ignore writes after close', () => {
+    framer.close();
+    framer.write('stdout', Buffer.from('late'));
+    jest.advanceTimersByTime(100);
+
+    expect(frames).toHaveLength(0);
+  });
+
+  it('should expose writable adapters for demuxing', () => {
+    const stdout = framer.writer('stdout');
+    expect(stdout.write(Buffer.from('x'))).toBe(true);
+    framer.close();
+
+    expect(frames).toEqual([{ stream: 'stdout', data: 'x', seq: 1 }]);
+  });
+});
\ No newline at end of file
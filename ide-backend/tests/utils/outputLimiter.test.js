@@ -0,0 +1,81 @@
+const OutputLimiter = require('../../utils/outputLimiter');
+
+describe('OutputLimiter', () => {
+  const createFramer = () => {
+    const written = { stdout: '', stderr: '' };
+    return {
+      written,
+      write: jest.fn((stream, chunk) => { written[stream] += chunk.toString(); }),
+      close: jest.fn()
+    };
+  };
+
+  it('should pass output through until the cap', () => {
+    const framer = createFramer();
+    const limiter = new OutputLimiter(framer, { limitBytes: 10 });
+
+    limiter.write('stdout', Buffer.from('hello'));
+    limiter.write('stderr', Buffer.from('oops'));
+
+    expect(framer.written).toEqual({ stdout: 'hello', stderr: 'oops' });
+    expect(limiter.isTruncated('stdout')).toBe(false);
+  });
+
+  it('should cut the stream at the cap and add a marker once', () => {
+    const framer = createFramer();
+    const limiter = new OutputLimiter(framer, { limitBytes: 10 });
+
+    limiter.write('stdout', Buffer.from('0123456'));
+    limiter.write('stdout', Buffer.from('789abc'));
+    limiter.write('stdout', Buffer.from('more'));
+
+    expect(framer.written.stdout).toBe('0123456789\n[stdout truncated after 10 bytes]\n');
+    expect(limiter.isTruncated('stdout')).toBe(true);
+    expect(limiter.getStats().stdout).toEqual({ bytes: 17, truncated: true, spilled: false, spillTruncated: false });
+  });
+
+  it('should cap each stream separately', () => {
+    const framer = createFramer();
+    const limiter = new OutputLimiter(framer, { limitBytes: 4 });
+
+    limiter.write('stdout', Buffer.from('abcdef'));
+    limiter.write('stderr', Buffer.from('err'));
+
+    expect(framer.written.stderr).toBe('err');
+    expect(limiter.isTruncated('stderr')).toBe(false);
+  });
+
+  it('should not split a multi-byte character at the cap', () => {
+    const framer = createFramer();
+    const limiter = new OutputLimiter(framer, { limitBytes: 4 });
+
+    limiter.write('stdout', Buffer.from('ab€')); // € is 3 bytes
+
+    expect(framer.written.stdout).toBe('ab\n[stdout truncated after 4 bytes]\n');
+  });
+
+  it('should send everything to the spill writer and close it', () => {
+    const framer = createFramer();
+    const spill = {
+      stdout: { bytes: 0, write: jest.fn(function(buffer) { this.bytes += buffer.length; }), close: jest.fn() },
+      stderr: { bytes: 0, write: jest.fn(), close: jest.fn() }
+    };
+    const limiter = new OutputLimiter(framer, { limitBytes: 2, spill });
+
+    limiter.write('stdout', Buffer.from('abc'));
+    limiter.write('stdout', Buffer.from('def'));
+    limiter.close();
+
+    expect(spill.stdout.write.mock.calls.map(([buffer]) => buffer.toString()).join('')).toBe('abcdef');
+    expect(spill.stdout.close).toHaveBeenCalled();
+    expect(framer.close).toHaveBeenCalled();
+    expect(limiter.getStats().stdout.spilled).toBe(true);
+    expect(limiter.getStats().stderr.spilled).toBe(false);
+  });
+
+  it('should accept writes through the demux adapter', () => {
+    const limiter = new OutputLimiter(createFramer(), { limitBytes: 1 });
+
+    expect(limiter.writer('stdout').write(Buffer.from('xyz'))).toBe(true);
+  });
+});
@@ -0,0 +1,56 @@
+const programInput = require('../../utils/programInput');
+const runtimeRegistry = require('../../services/runtimeRegistry');
+
+describe('programInput', () => {
+  describe('validateArgs', () => {
+    it('should keep args as given, shell metacharacters included', () => {
+      const result = programInput.validateArgs(['-n', '3', '$(rm -rf /); echo "hi"']);
+
+      expect(result.isValid).toBe(true);
+      expect(result.args).toEqual(['-n', '3', '$(rm -rf /); echo "hi"']);
+    });
+
+    it('should enforce the argument count limit', () => {
+      const result = programInput.validateArgs(Array.from({ length: programInput.maxArgs + 1 }, () => 'x'));
+
+      expect(result.isValid).toBe(false);
+      expect(result.errors).toContain(`Too many args (max ${programInput.maxArgs})`);
+    });
+
+    it('should reject non-strings and NUL bytes', () => {
+      const result = programInput.validateArgs([42, 'a\0b']);
+
+      expect(result.errors).toEqual(['args[0] must be a string', 'args[1] must not contain NUL bytes']);
+    });
+  });
+
+  describe('validateEnv', () => {
+    it('should accept ordinary variables', () => {
+      const result = programInput.validateEnv({ APP_MODE: 'test', _DEBUG: '1' });
+
+      expect(result.isValid).toBe(true);
+      expect(programInput.toEnv(result.env)).toEqual(['APP_MODE=test', '_DEBUG=1']);
+    });
+
+    it('should refuse to override sandbox variables', () => {
+      const result = programInput.validateEnv({ PATH: '/evil', HOME: '/', LD_PRELOAD: '/tmp/x.so', HTTPS_PROXY: 'http://me' });
+
+      expect(result.isValid).toBe(false);
+      expect(result.errors).toHaveLength(4);
+      expect(result.errors[0]).toBe("env PATH is reserved by the sandbox and can't be overridden");
+    });
+
+    it('should refuse variables the runtime defines', () => {
+      const result = programInput.validateEnv({ GOMODCACHE: '/tmp', GOEXPERIMENT: 'loopvar' }, runtimeRegistry.get('go'));
+
+      expect(result.errors).toEqual(["env GOMODCACHE is reserved by the sandbox and can't be overridden"]);
+      expect(result.env).toEqual({ GOEXPERIMENT: 'loopvar' });
+    });
+
+    it('should reject invalid names and oversized environments', () => {
+      expect(programInput.validateEnv({ 'A-B': 'x' }).errors).toEqual(['Invalid env name "A-B"']);
+      expect(programInput.validateEnv({ BIG: 'x'.repeat(programInput.maxEnvBytes) }).errors)
+        .toEqual([`env exceeds the total size limit of ${programInput.maxEnvBytes} bytes`]);
+    });
+  });
+});
\ No newline at end of file
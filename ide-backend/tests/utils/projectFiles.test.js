@@ -0,0 +1,58 @@
+const projectFiles = require('../../utils/projectFiles');
+
+describe('projectFiles', () => {
+  describe('validate', () => {
+    it('should accept nested files with an entrypoint', () => {
+      const result = projectFiles.validate({ 'main.go': 'package main', 'pkg/util/util.go': 'package util' }, 'main.go');
+
+      expect(result.isValid).toBe(true);
+      expect(Object.keys(result.files)).toEqual(['main.go', 'pkg/util/util.go']);
+    });
+
+    it('should reject path traversal and absolute paths', () => {
+      const result = projectFiles.validate({ '../secret.js': '', '/etc/passwd': '', 'a/../../b.js': '', 'main.js': '' }, 'main.js');
+
+      expect(result.isValid).toBe(false);
+      expect(result.errors.filter(error => error.includes('path traversal not allowed'))).toHaveLength(3);
+    });
+
+    it('should reject non-string contents such as symlinks', () => {
+      const result = projectFiles.validate({ 'main.js': '', 'link.js': { symlink: '/etc/passwd' } }, 'main.js');
+
+      expect(result.isValid).toBe(false);
+      expect(result.errors[0]).toContain('symlinks are not supported');
+    });
+
+    it('should reject paths that collide after normalization', () => {
+      const result = projectFiles.validate({ 'src/main.js': '', 'src/./main.js': '' }, 'src/main.js');
+
+      expect(result.isValid).toBe(false);
+      expect(result.errors[0]).toContain('Duplicate path');
+    });
+
+    it('should require the entrypoint to be one of the files', () => {
+      const result = projectFiles.validate({ 'main.js': '' }, 'index.js');
+
+      expect(result.isValid).toBe(false);
+      expect(result.errors).toContain('entrypoint "index.js" must be one of the provided files');
+    });
+
+    it('should enforce the total size limit', () => {
+      const result = projectFiles.validate({ 'main.js': 'a'.repeat(projectFiles.maxTotalBytes + 1) }, 'main.js');
+
+      expect(result.isValid).toBe(false);
+      expect(result.errors[0]).toContain('total size limit');
+    });
+  });
+
+  describe('getBuildEnv', () => {
+    it('should keep Go builds offline and prefer vendored modules', () => {
+      expect(projectFiles.getBuildEnv('go', { 'main.go': '', 'vendor/modules.txt': '' })).toContain('GOFLAGS=-mod=vendor');
+      expect(projectFiles.getBuildEnv('go', { 'main.go': '' })).toContain('GOPROXY=off');
+    });
+
+    it('should add nothing for other runtimes', () => {
+      expect(projectFiles.getBuildEnv('python', { 'main.py': '' })).toEqual([]);
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,93 @@
+const crypto = require('crypto');
+const { trace, SpanStatusCode } = require('@opentelemetry/api');
+
+class RecordedSpan {
+  constructor(name, attributes, parent) {
+    const parentContext = parent ? parent.spanContext() : null;
+    this.name = name;
+    this.attributes = { ...attributes };
+    this.parentSpanId = parentContext ? parentContext.spanId : null;
+    this.context = {
+      traceId: parentContext ? parentContext.traceId : crypto.randomBytes(16).toString('hex'),
+      spanId: crypto.randomBytes(8).toString('hex'),
+      traceFlags: 1
+    };
+    this.status = { code: SpanStatusCode.UNSET };
+    this.exceptions = [];
+    this.ended = false;
+  }
+
+  spanContext() {
+    return this.context;
+  }
+
+  setAttribute(key, value) {
+    this.attributes[key] = value;
+    return this;
+  }
+
+  setAttributes(attributes) {
+    Object.assign(this.attributes, attributes);
+    return this;
+  }
+
+  addEvent() {
+    return this;
+  }
+
+  setStatus(status) {
+    this.status = status;
+    return this;
+  }
+
+  updateName(name) {
+    this.name = name;
+    return this;
+  }
+
+  recordException(error) {
+    this.exceptions.push(error);
+  }
+
+  isRecording() {
+    return !this.ended;
+  }
+
+  end() {
+    this.ended = true;
+  }
+}
+
+/**
+ * Tracer provider that keeps every span in memory, for asserting span trees:
+ *
+ *   const recorder = new RecordingTracerProvider();
+ *   tracing.setTracerProvider(recorder);
+ *   ...
+ *   expect(recorder.childrenOf(recorder.find('request'))).toContain(...)
+ */
+class RecordingTracerProvider {
+  constructor() {
+    this.spans = [];
+  }
+
+  getTracer() {
+    return {
+      startSpan: (name, options = {}, context) => {
+        const span = new RecordedSpan(name, options.attributes, context ? trace.getSpan(context) : null);
+        this.spans.push(span);
+        return span;
+      }
+    };
+  }
+
+  find(name) {
+    return this.spans.find(span => span.name === name);
+  }
+
+  childrenOf(parent) {
+    return this.spans.filter(span => span.parentSpanId === parent.context.spanId).map(span => span.name);
+  }
+}
+
+module.exports = { RecordingTracerProvider };
\ No newline at end of file
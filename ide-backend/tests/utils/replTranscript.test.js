@@ -0,0 +1,73 @@
+const { ReplTranscript, prepareLines } = require('../../utils/replTranscript');
+
+describe('replTranscript', () => {
+  const python = { prompt: '>>> ', continuationPrompt: '... ' };
+  const node = { prompt: '> ', continuationPrompt: '... ' };
+
+  describe('ReplTranscript', () => {
+    it('should strip the echo and stop at the primary prompt', () => {
+      const transcript = new ReplTranscript({ ...python, echo: 'print(1)' });
+
+      expect(transcript.push('print(1)\r\n1\r\n>>> ')).toEqual({ text: '1\n', done: 'prompt' });
+      expect(transcript.getOutput()).toBe('1\n');
+    });
+
+    it('should report a continuation prompt for an unfinished statement', () => {
+      const transcript = new ReplTranscript({ ...python, echo: 'def f():' });
+
+      expect(transcript.push('def f():\r\n... ')).toEqual({ text: '', done: 'continuation' });
+    });
+
+    it('should handle output, echo and prompt split across chunks', () => {
+      const transcript = new ReplTranscript({ ...python, echo: 'for i in range(2): print(i)' });
+      const chunks = ['for i in ran', 'ge(2): print(i)\r', '\n0\r\n1\r\n>', '>', '> '];
+
+      const results = chunks.map(chunk => transcript.push(chunk));
+
+      expect(results.map(result => result.text).join('')).toBe('0\n1\n');
+      expect(results.map(result => result.done)).toEqual([null, null, null, null, 'prompt']);
+    });
+
+    it('should hold back a partial prompt until it is known to be output', () => {
+      const transcript = new ReplTranscript({ ...node, echo: null });
+
+      expect(transcript.push('a\n> ').done).toBe('prompt');
+
+      const other = new ReplTranscript({ ...node, echo: null });
+      expect(other.push('a\n')).toEqual({ text: 'a\n', done: null });
+      expect(other.push('>')).toEqual({ text: '', done: null });
+      expect(other.push('> b\n')).toEqual({ text: '>> b\n', done: null });
+    });
+
+    it('should ignore terminal escape sequences', () => {
+      const transcript = new ReplTranscript({ ...python, echo: 'x' });
+
+      expect(transcript.push('\x1b[?2004hx\r\n\x1b[1m42\x1b[0m\r\n\x1b[?2004l>>> ')).toEqual({ text: '42\n', done: 'prompt' });
+    });
+
+    it('should keep output that does not start with the echo', () => {
+      const transcript = new ReplTranscript({ ...python, echo: 'x' });
+
+      expect(transcript.push('Traceback\r\n>>> ')).toEqual({ text: 'Traceback\n', done: 'prompt' });
+    });
+
+    it('should tell prompts apart when one ends with the other', () => {
+      const transcript = new ReplTranscript({ prompt: '> ', continuationPrompt: '>> ', echo: null });
+
+      expect(transcript.push('>> ').done).toBe('continuation');
+    });
+  });
+
+  describe('prepareLines', () => {
+    it.each([
+      ['x = 1\ny = 2\n', {}, ['x = 1', 'y = 2']],
+      ['x = 1\r\n\r\ny = 2', {}, ['x = 1', '', 'y = 2']],
+      ['def f():\n    return 1\n\nprint(f())', { blankLineEndsBlock: true }, ['def f():', '    return 1', '', 'print(f())']],
+      ['def f():\n    a = 1\n\n    return a\n', { blankLineEndsBlock: true }, ['def f():', '    a = 1', '    return a']],
+      ['if x:\n    a()\nelse:\n    b()', { blankLineEndsBlock: true }, ['if x:', '    a()', 'else:', '    b()']],
+      ['try:\n  a()\nexcept E:\n  b()\nc()', { blankLineEndsBlock: true }, ['try:', '  a()', 'except E:', '  b()', '', 'c()']]
+    ])('should split %j', (code, options, lines) => {
+      expect(prepareLines(code, options)).toEqual(lines);
+    });
+  });
+});
\ No newline at end of file
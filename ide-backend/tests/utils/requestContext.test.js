@@ -0,0 +1,29 @@
+const requestContext = require('../../utils/requestContext');
+
+describe('requestContext', () => {
+  describe('resolveRequestId', () => {
+    it('should keep well-formed client request IDs', () => {
+      expect(requestContext.resolveRequestId('req-123.abc:1')).toBe('req-123.abc:1');
+    });
+
+    it('should generate a UUID for missing or malformed IDs', () => {
+      const uuid = /^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$/;
+
+      expect(requestContext.resolveRequestId(undefined)).toMatch(uuid);
+      expect(requestContext.resolveRequestId('bad id\nwith newline')).toMatch(uuid);
+      expect(requestContext.resolveRequestId('x'.repeat(200))).toMatch(uuid);
+    });
+  });
+
+  describe('run', () => {
+    it('should expose the request ID across async boundaries', async () => {
+      const seen = await requestContext.run({ requestId: 'req-1' }, async () => {
+        await new Promise(resolve => setTimeout(resolve, 5));
+        return requestContext.getRequestId();
+      });
+
+      expect(seen).toBe('req-1');
+      expect(requestContext.getRequestId()).toBeNull();
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,64 @@
+const SecretScrubber = require('../../utils/secretScrubber');
+
+describe('SecretScrubber', () => {
+  let written;
+  let target;
+
+  beforeEach(() => {
+    written = { stdout: '', stderr: '' };
+    target = {
+      write: (stream, chunk) => {
+        written[stream] += chunk.toString();
+      },
+      close: jest.fn()
+    };
+  });
+
+  it('should mask every exact match of a secret', () => {
+    const scrubber = new SecretScrubber(target, ['hunter2', 'sk-live-abc']);
+
+    scrubber.write('stdout', 'password=hunter2 key=sk-live-abc again hunter2\n');
+    scrubber.close();
+
+    expect(written.stdout).toBe('password=***** key=***** again *****\n');
+    expect(target.close).toHaveBeenCalled();
+  });
+
+  it('should catch a secret split across chunks', () => {
+    const scrubber = new SecretScrubber(target, ['hunter2']);
+
+    scrubber.write('stdout', 'pass: hun');
+    expect(written.stdout).toBe('pass: ');
+    scrubber.write('stdout', 'ter2!');
+    scrubber.close();
+
+    expect(written.stdout).toBe('pass: *****!');
+  });
+
+  it('should release a held prefix that never became a secret', async () => {
+    const scrubber = new SecretScrubber(target, ['hunter2'], { holdMs: 10 });
+
+    scrubber.write('stderr', 'Enter name: hu');
+    await new Promise(resolve => setTimeout(resolve, 30));
+
+    expect(written.stderr).toBe('Enter name: hu');
+    scrubber.close();
+  });
+
+  it('should prefer the longest secret at a position', () => {
+    const scrubber = new SecretScrubber(target, ['abc', 'abcdef']);
+
+    scrubber.write('stdout', 'xabcdefx');
+    scrubber.close();
+
+    expect(written.stdout).toBe('x*****x');
+  });
+
+  it('should redact tracked values until released', () => {
+    const release = SecretScrubber.track(['hunter2']);
+    expect(SecretScrubber.redactActive('login with hunter2')).toBe('login with *****');
+
+    release();
+    expect(SecretScrubber.redactActive('login with hunter2')).toBe('login with hunter2');
+  });
+});
\ No newline at end of file
@@ -0,0 +1,134 @@
+const { createParser } = require('../../utils/testResults');
+
+describe('testResults', () => {
+  const goEvents = (...events) => events.map(event => JSON.stringify(event)).join('\n') + '\n';
+
+  describe('go-test-json', () => {
+    it('should report each test as its result arrives, across chunk boundaries', () => {
+      const results = [];
+      const parser = createParser('go-test-json', result => results.push(result));
+      const stream = goEvents(
+        { Action: 'run', Package: 'example/calc', Test: 'TestAdd' },
+        { Action: 'output', Package: 'example/calc', Test: 'TestAdd', Output: '=== RUN   TestAdd\n' },
+        { Action: 'pass', Package: 'example/calc', Test: 'TestAdd', Elapsed: 0.01 },
+        { Action: 'run', Package: 'example/calc', Test: 'TestDiv' },
+        { Action: 'output', Package: 'example/calc', Test: 'TestDiv', Output: '    calc_test.go:14: got 3, want 4\n' },
+        { Action: 'output', Package: 'example/calc', Test: 'TestDiv', Output: '--- FAIL: TestDiv (0.00s)\n' },
+        { Action: 'fail', Package: 'example/calc', Test: 'TestDiv', Elapsed: 0 },
+        { Action: 'fail', Package: 'example/calc', Elapsed: 0.02 }
+      );
+
+      const split = stream.indexOf('TestDiv') + 3;
+      parser.write(Buffer.from(stream.slice(0, split)));
+      expect(results.map(result => result.name)).toEqual(['TestAdd']);
+
+      parser.write(Buffer.from(stream.slice(split)));
+      const report = parser.finish({ exitCode: 1 });
+
+      expect(results[1]).toEqual({
+        name: 'TestDiv',
+        suite: 'example/calc',
+        status: 'failed',
+        duration_ms: 0,
+        message: 'calc_test.go:14: got 3, want 4'
+      });
+      expect(report).toMatchObject({
+        status: 'failed',
+        summary: { total: 2, passed: 1, failed: 1, skipped: 0 },
+        build_output: null
+      });
+    });
+
+    it('should distinguish a build failure from failing tests', () => {
+      const parser = createParser('go-test-json');
+      parser.write(goEvents(
+        { Action: 'start', Package: 'example/calc' },
+        { Action: 'output', Package: 'example/calc', Output: 'FAIL\texample/calc [build failed]\n' },
+        { Action: 'fail', Package: 'example/calc', Elapsed: 0 }
+      ));
+
+      const report = parser.finish({ stderr: '# example/calc\n./calc.go:5:2: undefined: foo\n', exitCode: 1 });
+
+      expect(report.status).toBe('build_failed');
+      expect(report.tests).toEqual([]);
+      expect(report.build_output).toContain('undefined: foo');
+    });
+  });
+
+  describe('pytest-json', () => {
+    it('should normalize test outcomes and durations', () => {
+      const parser = createParser('pytest-json');
+      parser.write(JSON.stringify({
+        tests: [
+          { nodeid: 'test_calc.py::test_add', outcome: 'passed', setup: { duration: 0.001 }, call: { duration: 0.002 }, teardown: { duration: 0.001 } },
+          { nodeid: 'test_calc.py::test_div', outcome: 'failed', call: { duration: 0.003, crash: { message: 'assert 3 == 4' } } },
+          { nodeid: 'test_calc.py::test_big', outcome: 'skipped', setup: { duration: 0 } }
+        ],
+        collectors: [{ nodeid: 'test_calc.py', outcome: 'passed' }]
+      }));
+
+      const report = parser.finish({ exitCode: 1 });
+
+      expect(report.status).toBe('failed');
+      expect(report.summary).toEqual({ total: 3, passed: 1, failed: 1, skipped: 1 });
+      expect(report.tests[0]).toEqual({ name: 'test_add', suite: 'test_calc.py', status: 'passed', duration_ms: 4, message: null });
+      expect(report.tests[1].message).toBe('assert 3 == 4');
+    });
+
+    it('should report collection errors as a build failure', () => {
+      const parser = createParser('pytest-json');
+      parser.write(JSON.stringify({
+        tests: [],
+        collectors: [{ nodeid: 'test_calc.py', outcome: 'failed', longrepr: "E   SyntaxError: invalid syntax" }]
+      }));
+
+      expect(parser.finish({ exitCode: 2 })).toMatchObject({
+        status: 'build_failed',
+        build_output: 'E   SyntaxError: invalid syntax'
+      });
+    });
+
+    it('should flag output that is not a report', () => {
+      const parser = createParser('pytest-json');
+      parser.write('');
+
+      expect(parser.finish({ stderr: 'error: unrecognized arguments: --json-report', exitCode: 4 })).toMatchObject({
+        status: 'error',
+        build_output: 'error: unrecognized arguments: --json-report'
+      });
+    });
+  });
+
+  describe('jest-json', () => {
+    it('should separate suites that failed to load from assertion results', () => {
+      const results = [];
+      const parser = createParser('jest-json', result => results.push(result));
+      parser.write(JSON.stringify({
+        testResults: [
+          {
+            name: '/workspace/sum.test.js',
+            status: 'failed',
+            assertionResults: [
+              { fullName: 'sum adds', status: 'passed', duration: 3, failureMessages: [] },
+              { fullName: 'sum subtracts', status: 'failed', duration: 2, failureMessages: ['Expected: 1\nReceived: 2'] }
+            ]
+          },
+          { name: '/workspace/broken.test.js', status: 'failed', message: 'SyntaxError: Unexpected token', assertionResults: [] }
+        ]
+      }));
+
+      const report = parser.finish({ exitCode: 1 });
+
+      expect(results).toHaveLength(2);
+      expect(report.status).toBe('failed');
+      expect(report.tests[1]).toEqual({
+        name: 'sum subtracts',
+        suite: 'sum.test.js',
+        status: 'failed',
+        duration_ms: 2,
+        message: 'Expected: 1\nReceived: 2'
+      });
+      expect(report.build_output).toBe('SyntaxError: Unexpected token');
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,57 @@
+const { diffLines, editScript, splitLines } = require('../../utils/textDiff');
+
+describe('textDiff', () => {
+  it('should split text into lines without a phantom last line', () => {
+    expect(splitLines('a\r\nb\n')).toEqual(['a', 'b']);
+    expect(splitLines('')).toEqual([]);
+  });
+
+  it('should find a shortest edit script', () => {
+    const ops = editScript(['a', 'b', 'c', 'a', 'b', 'b', 'a'], ['c', 'b', 'a', 'b', 'a', 'c'], 100);
+
+    expect(ops.filter(entry => entry.op !== ' ')).toHaveLength(5);
+    expect(ops.filter(entry => entry.op !== '+').map(entry => entry.text)).toEqual(['a', 'b', 'c', 'a', 'b', 'b', 'a']);
+    expect(ops.filter(entry => entry.op !== '-').map(entry => entry.text)).toEqual(['c', 'b', 'a', 'b', 'a', 'c']);
+  });
+
+  it('should group changes into hunks with surrounding context', () => {
+    const oldText = 'a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n';
+    const newText = 'a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n';
+
+    const diff = diffLines(oldText, newText, { context: 2 });
+
+    expect(diff).toMatchObject({ identical: false, added: 2, removed: 1, exact: true });
+    expect(diff.hunks).toEqual([
+      {
+        oldStart: 1,
+        oldLines: 4,
+        newStart: 1,
+        newLines: 4,
+        lines: [{ op: ' ', text: 'a' }, { op: '-', text: 'b' }, { op: '+', text: 'B' }, { op: ' ', text: 'c' }, { op: ' ', text: 'd' }]
+      },
+      {
+        oldStart: 10,
+        oldLines: 2,
+        newStart: 10,
+        newLines: 3,
+        lines: [{ op: ' ', text: 'j' }, { op: ' ', text: 'k' }, { op: '+', text: 'l' }]
+      }
+    ]);
+  });
+
+  it('should report identical texts without hunks', () => {
+    expect(diffLines('same\n', 'same\n')).toEqual({ identical: true, hunks: [], added: 0, removed: 0, exact: true });
+  });
+
+  it('should number an empty side like diff -u', () => {
+    expect(diffLines('a\n', '').hunks).toEqual([{ oldStart: 1, oldLines: 1, newStart: 0, newLines: 0, lines: [{ op: '-', text: 'a' }] }]);
+  });
+
+  it('should replace everything when the texts are too different', () => {
+    const diff = diffLines('x\ny\n', 'p\nq\n', { maxEdits: 1 });
+
+    expect(diff.exact).toBe(false);
+    expect(diff.hunks).toHaveLength(1);
+    expect(diff.hunks[0].lines.map(entry => entry.op)).toEqual(['-', '-', '+', '+']);
+  });
+});
\ No newline at end of file
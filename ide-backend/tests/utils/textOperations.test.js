@@ -0,0 +1,69 @@
+const { normalize, apply, transform, transformPosition } = require('../../utils/textOperations');
+
+describe('textOperations', () => {
+  const insert = (position, text) => ({ type: 'insert', position, text });
+  const del = (position, length) => ({ type: 'delete', position, length });
+
+  // Both orders of applying two concurrent operations must give the same text
+  const converge = (text, a, b) => {
+    const left = apply(apply(text, b), transform(a, b, 'left'));
+    const right = apply(apply(text, a), transform(b, a, 'right'));
+    expect(left).toBe(right);
+    return left;
+  };
+
+  describe('apply', () => {
+    it('should apply components in sequence', () => {
+      expect(apply('hello world', [del(5, 6), insert(5, ', there')])).toBe('hello, there');
+    });
+
+    it('should reject components outside the document', () => {
+      expect(() => apply('abc', [insert(4, 'x')])).toThrow('past the end of the document');
+      expect(() => apply('abc', [del(2, 2)])).toThrow('deletes past the end');
+    });
+  });
+
+  describe('normalize', () => {
+    it('should drop empty components and unknown fields', () => {
+      expect(normalize([insert(0, ''), del(1, 0), { ...insert(2, 'x'), extra: true }])).toEqual([insert(2, 'x')]);
+    });
+
+    it('should reject malformed components', () => {
+      expect(() => normalize('ops')).toThrow('ops must be an array');
+      expect(() => normalize([{ type: 'insert', position: -1, text: 'x' }])).toThrow('non-negative integer');
+      expect(() => normalize([{ type: 'replace', position: 0 }])).toThrow('must be insert or delete');
+      expect(() => normalize([insert(0, 'a'), insert(1, 'b')], 1)).toThrow('at most 1 components');
+    });
+  });
+
+  describe('transform', () => {
+    it('should order inserts at the same position by side', () => {
+      expect(converge('ac', [insert(1, 'X')], [insert(1, 'Y')])).toBe('aXYc');
+    });
+
+    it('should keep text inserted inside a concurrently deleted range', () => {
+      expect(converge('abcdef', [del(1, 4)], [insert(3, 'XY')])).toBe('aXYf');
+    });
+
+    it('should not delete the same text twice', () => {
+      expect(converge('abcdef', [del(1, 3)], [del(2, 3)])).toBe('af');
+      expect(transform([del(2, 1)], [del(1, 3)])).toEqual([]);
+    });
+
+    it('should converge for multi-component operations', () => {
+      const a = [insert(0, '// '), del(11, 2), insert(11, 'ok')];
+      const b = [del(0, 3), insert(0, 'const'), insert(12, ';')];
+      expect(converge('let x = 10', a, b)).toBe('// const x = ok;');
+    });
+  });
+
+  describe('transformPosition', () => {
+    it('should move a cursor with the text around it', () => {
+      expect(transformPosition(5, [insert(2, 'abc')])).toBe(8);
+      expect(transformPosition(5, [insert(5, 'abc')])).toBe(8);
+      expect(transformPosition(5, [insert(6, 'abc')])).toBe(5);
+      expect(transformPosition(5, [del(1, 2)])).toBe(3);
+      expect(transformPosition(5, [del(3, 10)])).toBe(3);
+    });
+  });
+});
\ No newline at end of file
@@ -0,0 +1,71 @@
+const tracing = require('../../utils/tracing');
+const { SpanStatusCode } = require('@opentelemetry/api');
+const { RecordingTracerProvider } = require('./recordingTracer');
+
+describe('tracing', () => {
+  let recorder;
+
+  beforeEach(() => {
+    recorder = new RecordingTracerProvider();
+    tracing.setTracerProvider(recorder);
+  });
+
+  afterEach(() => {
+    tracing.setTracerProvider(null);
+  });
+
+  it('should nest spans started inside withSpan across awaits', async () => {
+    await tracing.withSpan('request', {}, async () => {
+      await new Promise(resolve => setImmediate(resolve));
+      await tracing.withSpan('child', { 'studio.runtime': 'go', 'studio.container_id': null }, async () => {});
+    });
+
+    const request = recorder.find('request');
+    expect(recorder.childrenOf(request)).toEqual(['child']);
+    expect(recorder.find('child').attributes).toEqual({ 'studio.runtime': 'go' });
+    expect(recorder.spans.every(span => span.ended)).toBe(true);
+  });
+
+  it('should continue a trace in a saved context', async () => {
+    let saved;
+    await tracing.withSpan('request', {}, async () => {
+      saved = tracing.active();
+    });
+
+    await tracing.runInContext(saved, () => tracing.withSpan('async_job.run', {}, async () => {}));
+
+    expect(recorder.childrenOf(recorder.find('request'))).toEqual(['async_job.run']);
+  });
+
+  it('should mark a span failed when its function throws', async () => {
+    await expect(tracing.withSpan('broken', {}, async () => {
+      throw new Error('boom');
+    })).rejects.toThrow('boom');
+
+    const span = recorder.find('broken');
+    expect(span.status).toEqual({ code: SpanStatusCode.ERROR, message: 'boom' });
+    expect(span.exceptions).toHaveLength(1);
+    expect(span.ended).toBe(true);
+  });
+
+  it('should round-trip traceparent headers', async () => {
+    let headers;
+    await tracing.withSpan('callback', {}, async () => {
+      headers = tracing.inject({ 'Content-Type': 'application/json' });
+    });
+
+    const { traceId, spanId } = recorder.find('callback').spanContext();
+    expect(headers.traceparent).toBe(`00-${traceId}-${spanId}-01`);
+
+    const span = tracing.startSpan('remote child', {}, tracing.extract(headers.traceparent));
+    expect(span.spanContext().traceId).toBe(traceId);
+    expect(span.parentSpanId).toBe(spanId);
+  });
+
+  it('should start a fresh trace for a malformed traceparent', () => {
+    const span = tracing.startSpan('request', {}, tracing.extract('00-not-a-trace-01'));
+
+    expect(span.parentSpanId).toBeNull();
+    expect(tracing.inject({})).toEqual({});
+  });
+});
\ No newline at end of file
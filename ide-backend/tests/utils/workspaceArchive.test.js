@@ -0,0 +1,153 @@
+const os = require('os');
+const path = require('path');
+const zlib = require('zlib');
+const fs = require('fs').promises;
+const { PassThrough, Readable } = require('stream');
+const tar = require('tar-stream');
+const fileSystem = require('../../utils/fileSystem');
+const workspaceArchive = require('../../utils/workspaceArchive');
+
+describe('workspaceArchive', () => {
+  const workspaceId = '64b7f0c2a1b2c3d4e5f60718';
+  let basePath;
+  let defaults;
+
+  const writeWorkspaceFile = async (relativePath, content) => {
+    const fullPath = path.join(basePath, workspaceId, relativePath);
+    await fs.mkdir(path.dirname(fullPath), { recursive: true });
+    await fs.writeFile(fullPath, content);
+  };
+
+  const readWorkspaceFile = (relativePath) => fs.readFile(path.join(basePath, workspaceId, relativePath), 'utf8');
+
+  const buildArchive = async (entries) => {
+    const pack = tar.pack();
+    for (const [name, content, type = 'file'] of entries) {
+      pack.entry({ name, type, ...(type === 'symlink' ? { linkname: '/etc/passwd' } : {}) }, content);
+    }
+    pack.finalize();
+
+    const chunks = [];
+    for await (const chunk of pack.pipe(zlib.createGzip())) {
+      chunks.push(chunk);
+    }
+    return Buffer.concat(chunks);
+  };
+
+  const exportArchive = async () => {
+    const { files, skipped } = await workspaceArchive.collectExportFiles(workspaceId);
+    const output = new PassThrough();
+    const chunks = [];
+    output.on('data', chunk => chunks.push(chunk));
+    await workspaceArchive.exportTo(workspaceId, files, output);
+    return { archive: Buffer.concat(chunks), files, skipped };
+  };
+
+  beforeEach(async () => {
+    basePath = await fs.mkdtemp(path.join(os.tmpdir(), 'workspace-archive-'));
+    defaults = {
+      workspaceBasePath: fileSystem.workspaceBasePath,
+      maxWorkspaceSize: fileSystem.maxWorkspaceSize,
+      maxWorkspaceFiles: fileSystem.maxWorkspaceFiles
+    };
+    fileSystem.workspaceBasePath = basePath;
+
+    await writeWorkspaceFile('main.js', 'console.log("original");');
+    await writeWorkspaceFile('src/util.js', 'module.exports = 1;');
+    await writeWorkspaceFile('node_modules/left-pad/index.js', 'module.exports = () => {};');
+  });
+
+  afterEach(async () => {
+    Object.assign(fileSystem, defaults);
+    await fs.rm(basePath, { recursive: true, force: true });
+  });
+
+  it('should export the workspace without cache directories and restore it', async () => {
+    const { archive, files } = await exportArchive();
+    expect(files.map(file => file.path)).toEqual(['main.js', 'src/util.js']);
+
+    await writeWorkspaceFile('main.js', 'console.log("changed");');
+    await writeWorkspaceFile('scratch.js', 'temporary');
+
+    const result = await workspaceArchive.restore(workspaceId, Readable.from([archive]));
+
+    expect(result).toEqual({ fileCount: 2, totalSize: expect.any(Number) });
+    expect(await readWorkspaceFile('main.js')).toBe('console.log("original");');
+    expect(await fileSystem.listFilesRecursive(workspaceId)).toEqual(['main.js', 'src/util.js']);
+  });
+
+  it('should restore into the existing workspace directory', async () => {
+    const { archive } = await exportArchive();
+    const workspacePath = path.join(basePath, workspaceId);
+    const before = await fs.stat(workspacePath);
+
+    await workspaceArchive.restore(workspaceId, Readable.from([archive]));
+
+    // Bind mounts, the watcher and the quota project all hold on to this inode
+    expect((await fs.stat(workspacePath)).ino).toBe(before.ino);
+    expect(await fs.readdir(basePath)).toEqual([workspaceId]);
+  });
+
+  it('should put the old contents back when the new ones can\'t be copied in', async () => {
+    const { archive } = await exportArchive();
+    await writeWorkspaceFile('main.js', 'console.log("changed");');
+    const copy = fs.cp;
+    jest.spyOn(fs, 'cp').mockImplementation((source, destination, options) => (
+      path.basename(source).startsWith('.restore-')
+        ? Promise.reject(Object.assign(new Error('no space left on device'), { code: 'ENOSPC' }))
+        : copy(source, destination, options)
+    ));
+
+    try {
+      await expect(workspaceArchive.restore(workspaceId, Readable.from([archive])))
+        .rejects.toMatchObject({ code: 'ENOSPC' });
+    } finally {
+      fs.cp.mockRestore();
+    }
+
+    expect(await readWorkspaceFile('main.js')).toBe('console.log("changed");');
+    expect(await fileSystem.listFilesRecursive(workspaceId)).toContain('node_modules/left-pad/index.js');
+    expect(await fs.readdir(basePath)).toEqual([workspaceId]);
+  });
+
+  it('should skip files that no longer fit in the quota on export', async () => {
+    fileSystem.maxWorkspaceSize = 30;
+
+    const { files, skipped } = await exportArchive();
+
+    expect(files.map(file => file.path)).toEqual(['main.js']);
+    expect(skipped).toEqual(['src/util.js']);
+  });
+
+  it('should reject path traversal without touching the workspace', async () => {
+    const archive = await buildArchive([['main.js', 'console.log("evil");'], ['../escape.js', 'x']]);
+
+    await expect(workspaceArchive.restore(workspaceId, Readable.from([archive])))
+      .rejects.toMatchObject({ code: 'INVALID_ARCHIVE' });
+
+    expect(await readWorkspaceFile('main.js')).toBe('console.log("original");');
+    expect(await fs.readdir(basePath)).toEqual([workspaceId]);
+  });
+
+  it('should reject symlinks and corrupt uploads', async () => {
+    const withSymlink = await buildArchive([['link', '', 'symlink']]);
+    await expect(workspaceArchive.restore(workspaceId, Readable.from([withSymlink])))
+      .rejects.toThrow("unsupported entry type 'symlink'");
+
+    const truncated = (await buildArchive([['main.js', 'console.log("new");']])).subarray(0, 20);
+    await expect(workspaceArchive.restore(workspaceId, Readable.from([truncated])))
+      .rejects.toMatchObject({ code: 'INVALID_ARCHIVE' });
+
+    expect(await readWorkspaceFile('main.js')).toBe('console.log("original");');
+    expect(await fs.readdir(basePath)).toEqual([workspaceId]);
+  });
+
+  it('should enforce the workspace file quota', async () => {
+    fileSystem.maxWorkspaceFiles = 1;
+    const archive = await buildArchive([['a.js', '1'], ['b.js', '2']]);
+
+    await expect(workspaceArchive.restore(workspaceId, Readable.from([archive])))
+      .rejects.toMatchObject({ code: 'QUOTA_EXCEEDED' });
+    expect(await fileSystem.listFilesRecursive(workspaceId)).toContain('node_modules/left-pad/index.js');
+  });
+});
\ No newline at end of file
@@ -1,4 +1,5 @@
 const webSocketService = require('../services/websocket');
+const sandboxTerminal = require('../services/sandboxTerminal');
 const firebaseTestAuth = require('./utils/firebaseTestAuth');
 
 describe('WebSocket Service', () => {
@@ -64,9 +65,53 @@ describe('WebSocket Service', () => {
   });
 });
 
+describe('WebSocket execution:start', () => {
+  afterEach(() => {
+    jest.restoreAllMocks();
+    webSocketService.userSessions.delete('socket-exec');
+  });
+
+  test('should not pass a client-supplied execution ID on', async () => {
+    const executionService = require('../services/executionService');
+    const socket = { id: 'socket-exec', emit: jest.fn(), on: jest.fn() };
+    webSocketService.userSessions.set(socket.id, { userId: 'user-1' });
+    const startExecution = jest.spyOn(executionService, 'startExecution').mockResolvedValue('server-id');
+
+    await webSocketService.handleExecutionStart(socket, { containerId: 'container-1', code: 'print(1)', executionId: 'someone-elses-id' });
+
+    const [, options] = startExecution.mock.calls[0];
+    expect(options).toMatchObject({ containerId: 'container-1', code: 'print(1)' });
+    expect(options.executionId).toBeUndefined();
+  });
+});
+
 describe('WebSocket Routes', () => {
   test('should have WebSocket routes module', () => {
     const websocketRoutes = require('../routes/websocket');
     expect(websocketRoutes).toBeDefined();
   });
+
+  describe('PTY sessions', () => {
+    afterEach(() => {
+      jest.restoreAllMocks();
+      webSocketService.userSessions.delete('socket-pty');
+    });
+
+    test('should close a terminal that finished starting after its socket disconnected', async () => {
+      const socket = { id: 'socket-pty', connected: true, emit: jest.fn() };
+      webSocketService.userSessions.set(socket.id, { userId: 'user-1', ptySessions: new Set() });
+      jest.spyOn(sandboxTerminal, 'createSession').mockImplementation(async () => {
+        // What handleDisconnection leaves behind
+        socket.connected = false;
+        webSocketService.userSessions.delete(socket.id);
+        return { sessionId: 'pty_late' };
+      });
+      const destroySession = jest.spyOn(sandboxTerminal, 'destroySession').mockResolvedValue(true);
+
+      await webSocketService.handlePtyCreate(socket, {});
+
+      expect(destroySession).toHaveBeenCalledWith('pty_late', 'client_disconnected');
+      expect(socket.emit).not.toHaveBeenCalledWith('pty:created', expect.anything());
+    });
+  });
 });
\ No newline at end of file
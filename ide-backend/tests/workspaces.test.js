@@ -3,6 +3,7 @@ const mongoose = require('mongoose');
 const app = require('../server');
 const User = require('../models/User');
 const Workspace = require('../models/Workspace');
+const fileSystem = require('../utils/fileSystem');
 const firebaseTestAuth = require('./utils/firebaseTestAuth');
 
 describe('Workspace Management API', () => {
@@ -128,6 +129,42 @@ describe('Workspace Management API', () => {
       expect(response.body.errors).toBeDefined();
     });
 
+    it('should create a workspace from a starter template', async () => {
+      const response = await request(app)
+        .post('/api/workspaces?template=go-http-server')
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ name: 'Hello Server', templateVariables: { modulePath: 'github.com/me/hello' } })
+        .expect(201);
+
+      const { workspace } = response.body.data;
+      expect(workspace.settings.runtime).toBe('go');
+      expect(workspace.createdFromTemplate).toBe('go-http-server');
+      expect(await fileSystem.readFile(workspace._id, 'go.mod')).toContain('module github.com/me/hello');
+    });
+
+    it('should reject unknown templates and oversized ones', async () => {
+      await request(app)
+        .post('/api/workspaces?template=no-such-template')
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ name: 'Missing Template' })
+        .expect(404);
+
+      const maxSize = fileSystem.maxWorkspaceSize;
+      fileSystem.maxWorkspaceSize = 10;
+      try {
+        const response = await request(app)
+          .post('/api/workspaces?template=python-script')
+          .set('Authorization', `Bearer ${authToken}`)
+          .send({ name: 'Too Big' })
+          .expect(413);
+
+        expect(response.body.code).toBe('QUOTA_EXCEEDED');
+        expect(await Workspace.findOne({ name: 'Too Big' })).toBeNull();
+      } finally {
+        fileSystem.maxWorkspaceSize = maxSize;
+      }
+    });
+
     it('should fail to create duplicate workspace name', async () => {
       // Create first workspace
       const workspaceData = {
@@ -687,4 +724,350 @@ describe('Workspace Management API', () => {
       expect(response.body.success).toBe(false);
     });
   });
+
+  describe('Workspace files API', () => {
+    let workspaceId;
+
+    beforeEach(async () => {
+      const response = await request(app)
+        .post('/api/workspaces')
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ name: 'Files Workspace' })
+        .expect(201);
+
+      workspaceId = response.body.data.workspace._id;
+    });
+
+    afterEach(async () => {
+      await fileSystem.deleteWorkspace(workspaceId);
+    });
+
+    it('should create a file and return its ETag', async () => {
+      const response = await request(app)
+        .put(`/api/workspaces/${workspaceId}/files/src/app.js`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ content: 'console.log(1);' })
+        .expect(201);
+
+      expect(response.headers.etag).toBeDefined();
+      expect(response.body.data.etag).toBe(response.headers.etag);
+
+      const read = await request(app)
+        .get(`/api/workspaces/${workspaceId}/files/src/app.js`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .expect(200);
+
+      expect(read.text).toBe('console.log(1);');
+      expect(read.headers['content-type']).toBe('text/plain; charset=utf-8');
+      expect(read.headers.etag).toBe(response.headers.etag);
+    });
+
+    it('should store raw binary uploads byte for byte', async () => {
+      const png = Buffer.concat([Buffer.from('89504e470d0a1a0a', 'hex'), Buffer.from([0, 0, 0, 13, 0xff, 0x00, 0x7f])]);
+
+      const created = await request(app)
+        .put(`/api/workspaces/${workspaceId}/files/assets/logo.png`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .set('Content-Type', 'application/octet-stream')
+        .send(png)
+        .expect(201);
+
+      expect(created.body.data.size).toBe(png.length);
+
+      const read = await request(app)
+        .get(`/api/workspaces/${workspaceId}/files/assets/logo.png`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .buffer(true)
+        .parse((res, callback) => {
+          const chunks = [];
+          res.on('data', chunk => chunks.push(chunk));
+          res.on('end', () => callback(null, Buffer.concat(chunks)));
+        })
+        .expect(200);
+
+      expect(read.headers['content-type']).toBe('image/png');
+      expect(Buffer.compare(read.body, png)).toBe(0);
+      expect(read.headers.etag).toBe(created.headers.etag);
+
+      const json = await request(app)
+        .get(`/api/workspaces/${workspaceId}/files/assets/logo.png?encoding=base64`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .expect(200);
+
+      expect(json.body.data).toMatchObject({ content: png.toString('base64'), encoding: 'base64', isBinary: true });
+
+      const listing = await request(app)
+        .get(`/api/workspaces/${workspaceId}/files/assets`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .expect(200);
+
+      expect(listing.body.data.files[0]).toMatchObject({ name: 'logo.png', size: png.length, mimeType: 'image/png', isBinary: true });
+    });
+
+    it('should serve byte ranges', async () => {
+      await request(app)
+        .put(`/api/workspaces/${workspaceId}/files/notes.txt`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .set('Content-Type', 'text/plain')
+        .send('0123456789')
+        .expect(201);
+
+      const partial = await request(app)
+        .get(`/api/workspaces/${workspaceId}/files/notes.txt`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .set('Range', 'bytes=2-5')
+        .expect(206);
+
+      expect(partial.text).toBe('2345');
+      expect(partial.headers['content-range']).toBe('bytes 2-5/10');
+
+      await request(app)
+        .get(`/api/workspaces/${workspaceId}/files/notes.txt`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .set('Range', 'bytes=20-')
+        .expect(416);
+    });
+
+    it('should stop raw uploads past the file size limit', async () => {
+      const maxFileSize = fileSystem.maxFileSize;
+      fileSystem.maxFileSize = 8;
+
+      try {
+        const response = await request(app)
+          .put(`/api/workspaces/${workspaceId}/files/big.txt`)
+          .set('Authorization', `Bearer ${authToken}`)
+          .set('Content-Type', 'text/plain')
+          .send('x'.repeat(16))
+          .expect(413);
+
+        expect(response.body.code).toBe('FILE_TOO_LARGE');
+      } finally {
+        fileSystem.maxFileSize = maxFileSize;
+      }
+
+      expect(await fileSystem.exists(workspaceId, 'big.txt')).toBe(false);
+    });
+
+    it('should reject writes with a stale If-Match', async () => {
+      const created = await request(app)
+        .put(`/api/workspaces/${workspaceId}/files/notes.md`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ content: 'v1' })
+        .expect(201);
+
+      await request(app)
+        .put(`/api/workspaces/${workspaceId}/files/notes.md`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .set('If-Match', created.headers.etag)
+        .send({ content: 'v2' })
+        .expect(200);
+
+      const response = await request(app)
+        .put(`/api/workspaces/${workspaceId}/files/notes.md`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .set('If-Match', created.headers.etag)
+        .send({ content: 'v3' })
+        .expect(412);
+
+      expect(response.body.success).toBe(false);
+    });
+
+    it('should reject path traversal', async () => {
+      await request(app)
+        .put(`/api/workspaces/${workspaceId}/files/..%2F..%2Fescape.js`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ content: 'x' })
+        .expect(400);
+    });
+
+    it('should enforce the workspace file quota', async () => {
+      const maxFiles = fileSystem.maxWorkspaceFiles;
+      fileSystem.maxWorkspaceFiles = 2; // README.md and main.js already exist
+
+      try {
+        await request(app)
+          .put(`/api/workspaces/${workspaceId}/files/extra.js`)
+          .set('Authorization', `Bearer ${authToken}`)
+          .send({ content: 'x' })
+          .expect(413);
+      } finally {
+        fileSystem.maxWorkspaceFiles = maxFiles;
+      }
+    });
+
+    it('should delete a file', async () => {
+      await request(app)
+        .delete(`/api/workspaces/${workspaceId}/files/main.js`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .expect(200);
+
+      await request(app)
+        .get(`/api/workspaces/${workspaceId}/files/main.js`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .expect(404);
+    });
+  });
+
+  describe('Workspace sharing', () => {
+    let workspaceId;
+
+    beforeEach(async () => {
+      const response = await request(app)
+        .post('/api/workspaces')
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ name: 'Shared Workspace' })
+        .expect(201);
+
+      workspaceId = response.body.data.workspace._id;
+    });
+
+    afterEach(async () => {
+      await fileSystem.deleteWorkspace(workspaceId);
+    });
+
+    const grant = (role) => request(app)
+      .post(`/api/workspaces/${workspaceId}/members`)
+      .set('Authorization', `Bearer ${authToken}`)
+      .send({ email: testUser2.email, role });
+
+    describe('as a viewer', () => {
+      beforeEach(async () => {
+        await grant('viewer').expect(201);
+      });
+
+      it('should allow reading files', async () => {
+        const response = await request(app)
+          .get(`/api/workspaces/${workspaceId}/files/main.js`)
+          .set('Authorization', `Bearer ${authToken2}`)
+          .expect(200);
+
+        expect(response.text.length).toBeGreaterThan(0);
+
+        await request(app)
+          .get(`/api/files/${workspaceId}/main.js`)
+          .set('Authorization', `Bearer ${authToken2}`)
+          .expect(200);
+      });
+
+      it('should reject file writes', async () => {
+        const response = await request(app)
+          .put(`/api/workspaces/${workspaceId}/files/main.js`)
+          .set('Authorization', `Bearer ${authToken2}`)
+          .send({ content: 'overwritten' })
+          .expect(403);
+
+        expect(response.body.role).toBe('viewer');
+
+        await request(app)
+          .delete(`/api/workspaces/${workspaceId}/files/main.js`)
+          .set('Authorization', `Bearer ${authToken2}`)
+          .expect(403);
+
+        await request(app)
+          .put(`/api/files/${workspaceId}/main.js`)
+          .set('Authorization', `Bearer ${authToken2}`)
+          .send({ content: 'overwritten' })
+          .expect(403);
+      });
+
+      it('should reject execution', async () => {
+        await request(app)
+          .post(`/api/workspaces/${workspaceId}/test`)
+          .set('Authorization', `Bearer ${authToken2}`)
+          .send({ containerId: 'container-1' })
+          .expect(403);
+      });
+
+      it('should reject managing members', async () => {
+        await request(app)
+          .post(`/api/workspaces/${workspaceId}/invites`)
+          .set('Authorization', `Bearer ${authToken2}`)
+          .send({ role: 'editor' })
+          .expect(403);
+      });
+
+      it('should allow writes once promoted to editor', async () => {
+        await grant('editor').expect(200);
+
+        await request(app)
+          .put(`/api/workspaces/${workspaceId}/files/main.js`)
+          .set('Authorization', `Bearer ${authToken2}`)
+          .send({ content: 'edited' })
+          .expect(200);
+      });
+    });
+
+    it('should list and revoke members', async () => {
+      await grant('editor').expect(201);
+
+      const list = await request(app)
+        .get(`/api/workspaces/${workspaceId}/members`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .expect(200);
+
+      expect(list.body.data.members.map(member => member.role)).toEqual(['owner', 'editor']);
+      expect(list.body.data.invites).toEqual([]);
+
+      await request(app)
+        .delete(`/api/workspaces/${workspaceId}/members/${testUser2._id}`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .expect(200);
+
+      await request(app)
+        .get(`/api/workspaces/${workspaceId}/files/main.js`)
+        .set('Authorization', `Bearer ${authToken2}`)
+        .expect(403);
+    });
+
+    it('should join through an invite link and stop accepting it once revoked', async () => {
+      const created = await request(app)
+        .post(`/api/workspaces/${workspaceId}/invites`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ role: 'viewer', expiresInHours: 1 })
+        .expect(201);
+
+      const { token, invite } = created.body.data;
+      expect(invite.tokenHash).toBeUndefined();
+
+      const accepted = await request(app)
+        .post(`/api/workspaces/invites/${token}/accept`)
+        .set('Authorization', `Bearer ${authToken2}`)
+        .expect(200);
+
+      expect(accepted.body.data.role).toBe('viewer');
+
+      await request(app)
+        .get(`/api/workspaces/${workspaceId}/files/main.js`)
+        .set('Authorization', `Bearer ${authToken2}`)
+        .expect(200);
+
+      await request(app)
+        .delete(`/api/workspaces/${workspaceId}/invites/${invite.id}`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .expect(200);
+
+      await request(app)
+        .post(`/api/workspaces/invites/${token}/accept`)
+        .set('Authorization', `Bearer ${authToken2}`)
+        .expect(404);
+    });
+
+    it('should reject expired invites', async () => {
+      const created = await request(app)
+        .post(`/api/workspaces/${workspaceId}/invites`)
+        .set('Authorization', `Bearer ${authToken}`)
+        .send({ role: 'editor' })
+        .expect(201);
+
+      await Workspace.updateOne(
+        { _id: workspaceId },
+        { $set: { 'invites.0.expiresAt': new Date(Date.now() - 1000) } }
+      );
+
+      await request(app)
+        .post(`/api/workspaces/invites/${created.body.data.token}/accept`)
+        .set('Authorization', `Bearer ${authToken2}`)
+        .expect(410);
+    });
+  });
 });
\ No newline at end of file
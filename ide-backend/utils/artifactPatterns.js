@@ -0,0 +1,84 @@
+const config = require('../config');
+
+const MAX_PATTERN_LENGTH = 256;
+
+/**
+ * Glob patterns naming the files an execution wants back, relative to
+ * /workspace: `*` matches within one path segment, `**` any number of
+ * segments and `?` one character, e.g. "out/*.png" or "reports/**".
+ * Patterns can't be absolute or climb out with "..", so they only ever
+ * resolve inside the workspace.
+ */
+class ArtifactPatterns {
+  /**
+   * Returns { isValid, errors, patterns } with patterns defaulting to []
+   */
+  validate(patterns) {
+    if (patterns === undefined || patterns === null) {
+      return { isValid: true, errors: [], patterns: [] };
+    }
+    if (!Array.isArray(patterns)) {
+      return { isValid: false, errors: ['artifacts must be an array of glob patterns'], patterns: [] };
+    }
+
+    const errors = [];
+    if (patterns.length > config.artifacts.maxPatterns) {
+      errors.push(`Too many artifact patterns (max ${config.artifacts.maxPatterns})`);
+    }
+    patterns.forEach((pattern, index) => {
+      const error = this.check(pattern);
+      if (error) {
+        errors.push(`artifacts[${index}] ${error}`);
+      }
+    });
+    return { isValid: errors.length === 0, errors, patterns: errors.length === 0 ? [...new Set(patterns)] : [] };
+  }
+
+  check(pattern) {
+    if (typeof pattern !== 'string' || pattern.length === 0 || pattern.length > MAX_PATTERN_LENGTH) {
+      return `must be a string of 1 to ${MAX_PATTERN_LENGTH} characters`;
+    }
+    if (pattern.startsWith('/') || pattern.includes('\\') || pattern.includes('\0')) {
+      return 'must be a path relative to the workspace';
+    }
+    if (pattern.split('/').some(segment => segment === '..' || segment === '.' || segment === '')) {
+      return 'must not contain "..", "." or empty path segments';
+    }
+    return null;
+  }
+
+  toRegExp(pattern) {
+    let source = '';
+    const segments = pattern.split('/');
+    segments.forEach((segment, index) => {
+      const last = index === segments.length - 1;
+      if (segment === '**') {
+        source += last ? '.*' : '(?:[^/]+/)*';
+        return;
+      }
+      source += segment.replace(/[.+^${}()|[\]\\*?]/g, (char) => {
+        if (char === '*') {
+          return '[^/]*';
+        }
+        if (char === '?') {
+          return '[^/]';
+        }
+        return `\\${char}`;
+      });
+      if (!last) {
+        source += '/';
+      }
+    });
+    return new RegExp(`^${source}$`);
+  }
+
+  /**
+   * Predicate over workspace-relative paths matching any of `patterns`
+   */
+  matcher(patterns) {
+    const expressions = patterns.map(pattern => this.toRegExp(pattern));
+    return (filePath) => expressions.some(expression => expression.test(filePath));
+  }
+}
+
+module.exports = new ArtifactPatterns();
\ No newline at end of file
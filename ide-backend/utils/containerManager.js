@@ -1,4 +1,5 @@
 const dockerService = require('../services/dockerService');
+const containerPool = require('../services/containerPool');
 const logger = require('./logger');
 
 class ContainerManager {
@@ -60,24 +61,28 @@ class ContainerManager {
   }
 
   /**
-   * Graceful shutdown
+   * Shut down after executions have drained: destroy idle pooled containers,
+   * then kill and remove every container still tracked
    */
   async shutdown() {
     logger.info('Shutting down container manager...');
 
     this.stopCleanupInterval();
 
-    // Stop all tracked containers
     try {
+      if (dockerService.isAvailable) {
+        await containerPool.shutdown();
+      }
+
       const containers = Array.from(dockerService.containers.keys());
       const stopPromises = containers.map(containerId =>
-        dockerService.stopContainer(containerId).catch(err =>
-          logger.error(`Failed to stop container ${containerId}:`, err)
+        dockerService.stopContainer(containerId, { force: true }).catch(err =>
+          logger.error(`Failed to remove container ${containerId}:`, err)
         )
       );
 
       await Promise.allSettled(stopPromises);
-      logger.info('All containers stopped');
+      logger.info(`Container manager shutdown completed, removed ${containers.length} containers`);
     } catch (error) {
       logger.error('Error during container shutdown:', error);
     }
@@ -134,7 +139,8 @@ class ContainerManager {
         containersByLanguage: {},
         containersByWorkspace: {},
         oldestContainer: null,
-        newestContainer: null
+        newestContainer: null,
+        pool: containerPool.getStats()
       };
 
       let oldest = null;
@@ -167,31 +173,6 @@ class ContainerManager {
       throw error;
     }
   }
-
-  /**
-   * Shutdown the container manager
-   */
-  async shutdown() {
-    if (this.cleanupInterval) {
-      clearInterval(this.cleanupInterval);
-      this.cleanupInterval = null;
-    }
-
-    if (dockerService.isAvailable) {
-      try {
-        // Stop all running containers
-        const containers = Array.from(dockerService.containers.keys());
-        for (const containerId of containers) {
-          await dockerService.stopContainer(containerId).catch(err =>
-            logger.warn(`Failed to stop container ${containerId}:`, err.message)
-          );
-        }
-        logger.info('Container manager shutdown completed');
-      } catch (error) {
-        logger.error('Error during container manager shutdown:', error);
-      }
-    }
-  }
 }
 
 module.exports = new ContainerManager();
\ No newline at end of file
@@ -0,0 +1,171 @@
+/**
+ * Content type sniffing for workspace files, following the WHATWG MIME
+ * sniffing algorithm as Go's http.DetectContentType implements it: the
+ * first SNIFF_LENGTH bytes are matched against known signatures, and data
+ * without binary control bytes is text/plain.
+ */
+
+const SNIFF_LENGTH = 512;
+const DEFAULT_TYPE = 'application/octet-stream';
+const TEXT_TYPE = 'text/plain; charset=utf-8';
+
+const isWhitespace = (byte) => byte === 0x09 || byte === 0x0a || byte === 0x0c || byte === 0x0d || byte === 0x20;
+const isTagTerminator = (byte) => byte === 0x20 || byte === 0x3e; // ' ' or '>'
+
+// Control bytes no text file contains (tab, newlines, form feed and escape are allowed)
+const isBinaryByte = (byte) => byte <= 0x08 || byte === 0x0b || (byte >= 0x0e && byte <= 0x1a) || (byte >= 0x1c && byte <= 0x1f);
+
+const bytes = (text) => Buffer.from(text, 'latin1');
+
+// Starts with `pattern` exactly
+const exact = (pattern, type) => {
+  const signature = bytes(pattern);
+  return (data) => (data.length >= signature.length && data.subarray(0, signature.length).equals(signature) ? type : null);
+};
+
+// `pattern` where mask bytes are 0xFF, anything where they are 0x00
+const masked = (mask, pattern, type, { skipWhitespace = false } = {}) => {
+  const maskBytes = bytes(mask);
+  const patternBytes = bytes(pattern);
+  return (data, firstNonWhitespace) => {
+    const start = skipWhitespace ? firstNonWhitespace : 0;
+    if (data.length - start < patternBytes.length) {
+      return null;
+    }
+    for (let i = 0; i < patternBytes.length; i++) {
+      if ((data[start + i] & maskBytes[i]) !== patternBytes[i]) {
+        return null;
+      }
+    }
+    return type;
+  };
+};
+
+// An HTML tag, case insensitive, after leading whitespace and followed by ' ' or '>'
+const html = (tag) => {
+  const tagBytes = bytes(tag);
+  return (data, firstNonWhitespace) => {
+    const end = firstNonWhitespace + tagBytes.length;
+    if (data.length <= end) {
+      return null;
+    }
+    for (let i = 0; i < tagBytes.length; i++) {
+      let byte = data[firstNonWhitespace + i];
+      if (tagBytes[i] >= 0x41 && tagBytes[i] <= 0x5a) {
+        byte &= 0xdf; // upper case
+      }
+      if (byte !== tagBytes[i]) {
+        return null;
+      }
+    }
+    return isTagTerminator(data[end]) ? 'text/html; charset=utf-8' : null;
+  };
+};
+
+// ISO base media file: an ftyp box naming an mp4 brand
+const mp4 = (data) => {
+  if (data.length < 12) {
+    return null;
+  }
+  const boxSize = data.readUInt32BE(0);
+  if (data.length < boxSize || boxSize % 4 !== 0 || data.toString('latin1', 4, 8) !== 'ftyp') {
+    return null;
+  }
+  for (let offset = 8; offset < boxSize; offset += 4) {
+    if (offset === 12) {
+      continue; // minor version, not a brand
+    }
+    if (data.toString('latin1', offset, offset + 3) === 'mp4') {
+      return 'video/mp4';
+    }
+  }
+  return null;
+};
+
+const text = (data, firstNonWhitespace) => {
+  for (let i = firstNonWhitespace; i < data.length; i++) {
+    if (isBinaryByte(data[i])) {
+      return null;
+    }
+  }
+  return TEXT_TYPE;
+};
+
+// In order: earlier signatures win
+const SIGNATURES = [
+  ...['<!DOCTYPE HTML', '<HTML', '<HEAD', '<SCRIPT', '<IFRAME', '<H1', '<DIV', '<FONT', '<TABLE',
+    '<A', '<STYLE', '<TITLE', '<B', '<BODY', '<BR', '<P', '<!--'].map(html),
+  masked('\xFF\xFF\xFF\xFF\xFF', '<?xml', 'text/xml; charset=utf-8', { skipWhitespace: true }),
+  exact('%PDF-', 'application/pdf'),
+  exact('%!PS-Adobe-', 'application/postscript'),
+
+  // Byte order marks
+  masked('\xFF\xFF\x00\x00', '\xFE\xFF\x00\x00', 'text/plain; charset=utf-16be'),
+  masked('\xFF\xFF\x00\x00', '\xFF\xFE\x00\x00', 'text/plain; charset=utf-16le'),
+  masked('\xFF\xFF\xFF\x00', '\xEF\xBB\xBF\x00', TEXT_TYPE),
+
+  exact('\x00\x00\x01\x00', 'image/x-icon'),
+  exact('\x00\x00\x02\x00', 'image/x-icon'),
+  exact('BM', 'image/bmp'),
+  exact('GIF87a', 'image/gif'),
+  exact('GIF89a', 'image/gif'),
+  masked('\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF\xFF\xFF', 'RIFF\x00\x00\x00\x00WEBPVP', 'image/webp'),
+  exact('\x89PNG\x0D\x0A\x1A\x0A', 'image/png'),
+  exact('\xFF\xD8\xFF', 'image/jpeg'),
+
+  masked('\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF', 'FORM\x00\x00\x00\x00AIFF', 'audio/aiff'),
+  masked('\xFF\xFF\xFF', 'ID3', 'audio/mpeg'),
+  masked('\xFF\xFF\xFF\xFF\xFF', 'OggS\x00', 'application/ogg'),
+  masked('\xFF\xFF\xFF\xFF\xFF\xFF\xFF\xFF', 'MThd\x00\x00\x00\x06', 'audio/midi'),
+  masked('\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF', 'RIFF\x00\x00\x00\x00AVI ', 'video/avi'),
+  masked('\xFF\xFF\xFF\xFF\x00\x00\x00\x00\xFF\xFF\xFF\xFF', 'RIFF\x00\x00\x00\x00WAVE', 'audio/wave'),
+  mp4,
+  exact('\x1A\x45\xDF\xA3', 'video/webm'),
+
+  masked(`${'\x00'.repeat(34)}\xFF\xFF`, `${'\x00'.repeat(34)}LP`, 'application/vnd.ms-fontobject'),
+  exact('\x00\x01\x00\x00', 'font/ttf'),
+  exact('OTTO', 'font/otf'),
+  exact('ttcf', 'font/collection'),
+  exact('wOFF', 'font/woff'),
+  exact('wOF2', 'font/woff2'),
+
+  exact('\x1F\x8B\x08', 'application/x-gzip'),
+  exact('PK\x03\x04', 'application/zip'),
+  exact('Rar!\x1A\x07\x00', 'application/x-rar-compressed'),
+  exact('Rar!\x1A\x07\x01\x00', 'application/x-rar-compressed'),
+  exact('\x00\x61\x73\x6D', 'application/wasm'),
+
+  text
+];
+
+/**
+ * MIME type of data from its first SNIFF_LENGTH bytes, always valid:
+ * application/octet-stream when nothing matches
+ * @param {Buffer} data
+ */
+const detectContentType = (data) => {
+  const head = data.subarray(0, SNIFF_LENGTH);
+  let firstNonWhitespace = 0;
+  while (firstNonWhitespace < head.length && isWhitespace(head[firstNonWhitespace])) {
+    firstNonWhitespace++;
+  }
+
+  for (const signature of SIGNATURES) {
+    const type = signature(head, firstNonWhitespace);
+    if (type) {
+      return type;
+    }
+  }
+  return DEFAULT_TYPE;
+};
+
+/**
+ * Whether an editor should leave content of this type alone rather than open it as text
+ */
+const isBinaryContentType = (type) => !type.startsWith('text/');
+
+module.exports = {
+  SNIFF_LENGTH,
+  detectContentType,
+  isBinaryContentType
+};
\ No newline at end of file
@@ -0,0 +1,55 @@
+/**
+ * CPU lists in the cpuset format Docker's CpusetCpus and the kernel use:
+ * comma separated CPU numbers and inclusive ranges, e.g. "0-3,6".
+ */
+
+const MAX_CPU = 4095;
+
+/**
+ * CPU numbers of a list, ascending and without duplicates
+ * @throws {Error} on anything that isn't a CPU list
+ */
+const parse = (list) => {
+  const cpus = new Set();
+  const text = String(list || '').trim();
+  if (!text) {
+    return [];
+  }
+
+  for (const part of text.split(',')) {
+    const match = /^\s*(\d+)(?:-(\d+))?\s*$/.exec(part);
+    if (!match) {
+      throw new Error(`Invalid CPU list "${text}"`);
+    }
+    const first = parseInt(match[1], 10);
+    const last = match[2] !== undefined ? parseInt(match[2], 10) : first;
+    if (last < first || last > MAX_CPU) {
+      throw new Error(`Invalid CPU range "${part.trim()}"`);
+    }
+    for (let cpu = first; cpu <= last; cpu++) {
+      cpus.add(cpu);
+    }
+  }
+  return [...cpus].sort((a, b) => a - b);
+};
+
+/**
+ * The shortest list naming `cpus`: consecutive CPUs become ranges
+ */
+const format = (cpus) => {
+  const sorted = [...new Set(cpus)].sort((a, b) => a - b);
+  const parts = [];
+  for (let i = 0; i < sorted.length; i++) {
+    const first = sorted[i];
+    while (i + 1 < sorted.length && sorted[i + 1] === sorted[i] + 1) {
+      i++;
+    }
+    parts.push(first === sorted[i] ? String(first) : `${first}-${sorted[i]}`);
+  }
+  return parts.join(',');
+};
+
+module.exports = {
+  parse,
+  format
+};
\ No newline at end of file
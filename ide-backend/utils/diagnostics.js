@@ -0,0 +1,204 @@
+const WORKSPACE_PREFIX = /^(?:\/workspace\/|\.\/)/;
+
+const toFile = (filePath) => filePath.replace(WORKSPACE_PREFIX, '');
+
+const diagnostic = (file, line, col, message, severity = 'error') => ({
+  file: toFile(file),
+  line: parseInt(line, 10),
+  col: col ? parseInt(col, 10) : null,
+  severity,
+  message: message.trim()
+});
+
+/**
+ * Convert compiler/interpreter output into structured diagnostics:
+ * [{ file, line, col, severity, message }]
+ */
+class DiagnosticsParser {
+  constructor() {
+    this.parsers = {
+      go: output => this.parseGo(output),
+      python: output => this.parsePython(output),
+      node: output => this.parseNode(output)
+    };
+    this.formatterParsers = {
+      gofmt: (output, file) => this.parseGofmt(output, file),
+      black: (output, file) => this.parseBlack(output, file),
+      prettier: (output, file) => this.parsePrettier(output, file)
+    };
+  }
+
+  /**
+   * Parse diagnostics for a runtime. Never throws: unknown runtimes and
+   * unparseable output produce an empty array.
+   */
+  parse(language, stderr = '') {
+    const parser = this.parsers[language];
+    if (!parser || !stderr) {
+      return [];
+    }
+
+    try {
+      return parser(stderr.replace(/\r\n/g, '\n'));
+    } catch (error) {
+      return [];
+    }
+  }
+
+  /**
+   * Parse the syntax errors a formatter (runtime `format.errors` style)
+   * reported for source it read on stdin, attributed to `file`. Never throws.
+   */
+  parseFormatter(style, stderr = '', file = 'main') {
+    const parser = this.formatterParsers[style];
+    if (!parser || !stderr) {
+      return [];
+    }
+
+    try {
+      return parser(stderr.replace(/\r\n/g, '\n'), file);
+    } catch (error) {
+      return [];
+    }
+  }
+
+  /**
+   * Go: `<standard input>:3:1: expected declaration, found foo` from gofmt
+   * and goimports, one line per error
+   */
+  parseGofmt(output, file) {
+    return output.split('\n')
+      .map(line => line.match(/^<standard input>:(\d+):(\d+): (.+)$/))
+      .filter(Boolean)
+      .map(match => diagnostic(file, match[1], match[2], match[3]));
+  }
+
+  /**
+   * Black: `error: cannot format -: Cannot parse for target version Python 3.11: 2:7: def f(`
+   * (older versions leave out the target version)
+   */
+  parseBlack(output, file) {
+    const match = output.match(/^error: cannot format -: Cannot parse(?: for target version [^:]+)?: (\d+):(\d+):(.*)$/m);
+    if (!match) {
+      return [];
+    }
+
+    const near = match[3].trim();
+    return [diagnostic(file, match[1], match[2], near ? `Cannot parse: ${near}` : 'Cannot parse')];
+  }
+
+  /**
+   * Prettier: `[error] main.ts: SyntaxError: ';' expected. (1:9)` followed
+   * by a code frame, which is left out
+   */
+  parsePrettier(output, file) {
+    const match = output.match(/^\[error\] [^:\n]+: ((?:\w*Error: )?.+?) \((\d+):(\d+)\)$/m);
+    if (!match) {
+      return [];
+    }
+
+    return [diagnostic(file, match[2], match[3], match[1])];
+  }
+
+  /**
+   * Go: `./main.go:12:5: undefined: foo` from `go build`/`go vet`, plus the
+   * first user frame of a runtime panic
+   */
+  parseGo(output) {
+    const diagnostics = [];
+    const lines = output.split('\n');
+
+    for (const line of lines) {
+      const match = line.match(/^((?:\.\/|\/workspace\/)?[^\s:]+\.go):(\d+)(?::(\d+))?: (.+)$/);
+      if (match) {
+        const severity = /^(?:warning|vet):/i.test(match[4]) ? 'warning' : 'error';
+        diagnostics.push(diagnostic(match[1], match[2], match[3], match[4], severity));
+      }
+    }
+
+    const panic = output.match(/^panic: (.+)$/m);
+    if (panic && diagnostics.length === 0) {
+      const frame = output.match(/^\s+(\/workspace\/[^\s:]+\.go):(\d+)/m);
+      if (frame) {
+        diagnostics.push(diagnostic(frame[1], frame[2], null, `panic: ${panic[1]}`));
+      }
+    }
+
+    return diagnostics;
+  }
+
+  /**
+   * Python: the innermost traceback frame in user code, with the exception line
+   * as the message. SyntaxErrors report the column from the caret marker.
+   */
+  parsePython(output) {
+    const lines = output.split('\n');
+    const frames = [];
+    let message = null;
+
+    for (let i = 0; i < lines.length; i++) {
+      const frame = lines[i].match(/^\s*File "([^"]+)", line (\d+)/);
+      if (frame) {
+        frames.push({ file: frame[1], line: frame[2], index: i });
+        continue;
+      }
+
+      const exception = lines[i].match(/^([A-Za-z_][\w.]*(?:Error|Exception|Warning|Exit|Interrupt)): ?(.*)$/);
+      if (exception) {
+        message = exception[2] ? `${exception[1]}: ${exception[2]}` : exception[1];
+      }
+    }
+
+    const userFrames = frames.filter(frame => !/(^<|\/lib\/python|site-packages)/.test(frame.file));
+    const frame = userFrames[userFrames.length - 1];
+    if (!frame || !message) {
+      return [];
+    }
+
+    // SyntaxError tracebacks echo the source line followed by a caret line
+    let col = null;
+    const source = lines[frame.index + 1];
+    const caret = lines[frame.index + 2];
+    if (source !== undefined && caret !== undefined && /^\s*\^+\s*$/.test(caret)) {
+      const indent = source.length - source.trimStart().length;
+      col = caret.indexOf('^') - indent + 1;
+    }
+
+    const severity = /Warning:/.test(message) ? 'warning' : 'error';
+    return [diagnostic(frame.file, frame.line, col > 0 ? col : null, message, severity)];
+  }
+
+  /**
+   * Node: syntax errors (`/workspace/main.js:3` header) and the first user
+   * frame of an uncaught exception's stack trace
+   */
+  parseNode(output) {
+    const lines = output.split('\n');
+    const errorIndex = lines.findIndex(line => /^(?:[A-Z]\w*)?Error(?: \[[A-Z_]+\])?: /.test(line) || /^[A-Z]\w*Error$/.test(line));
+    if (errorIndex === -1) {
+      return [];
+    }
+
+    const message = lines[errorIndex];
+
+    // Syntax errors print `file:line`, the source line and a caret before the error
+    const header = lines.slice(0, errorIndex).map(line => line.match(/^(\/?[^\s:]+\.(?:c|m)?js):(\d+)$/)).find(Boolean);
+    if (header) {
+      const headerIndex = lines.findIndex(line => line === header[0]);
+      const caret = lines[headerIndex + 2];
+      const col = caret && /^\s*\^+\s*$/.test(caret) ? caret.indexOf('^') + 1 : null;
+      return [diagnostic(header[1], header[2], col, message)];
+    }
+
+    for (const line of lines.slice(errorIndex + 1)) {
+      const frame = line.match(/^\s+at (?:.*?\()?((?:\/workspace\/|\.\/)?[^\s():]+\.(?:c|m)?js):(\d+):(\d+)\)?$/);
+      if (frame && !frame[1].startsWith('node:') && !frame[1].includes('node_modules')) {
+        return [diagnostic(frame[1], frame[2], frame[3], message)];
+      }
+    }
+
+    return [];
+  }
+}
+
+module.exports = new DiagnosticsParser();
\ No newline at end of file
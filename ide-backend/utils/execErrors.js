@@ -0,0 +1,251 @@
+const config = require('../config');
+
+/**
+ * Error model for the execution API.
+ *
+ * A program that fails to compile, crashes, times out or is OOM killed is a
+ * normal outcome: the request succeeded and the result's `status` says how
+ * the program ended (see outcome). ExecError is for requests that could not
+ * run at all; its kind decides the HTTP status:
+ *
+ *   invalid_request 400, forbidden 403, not_found 404, too_large 413,
+ *   rejected 422, rate_limited 429, unavailable 503, infrastructure 500
+ *
+ * Only infrastructure errors (Docker failing underneath us) are 5xx besides
+ * a service that is deliberately unavailable.
+ */
+const KIND_STATUS = {
+  invalid_request: 400,
+  forbidden: 403,
+  not_found: 404,
+  too_large: 413,
+  rejected: 422,
+  rate_limited: 429,
+  unavailable: 503,
+  infrastructure: 500
+};
+
+const KIND_TITLE = {
+  invalid_request: 'Validation failed',
+  forbidden: 'Access denied',
+  not_found: 'Not found',
+  too_large: 'Payload too large',
+  rejected: 'Submission rejected',
+  rate_limited: 'Too many requests',
+  unavailable: 'Service unavailable',
+  infrastructure: 'Internal error'
+};
+
+// Codes services already attach to plain errors (error.code)
+const CODE_KINDS = {
+  RUNTIME_NOT_FOUND: 'invalid_request',
+  INVALID_PROJECT: 'invalid_request',
+  INVALID_INPUT: 'invalid_request',
+  INVALID_CALLBACK_URL: 'invalid_request',
+  INVALID_VARIANTS: 'invalid_request',
+  INVALID_SECRET: 'invalid_request',
+  INVALID_CURSOR: 'invalid_request',
+  CALLBACKS_DISABLED: 'invalid_request',
+  NO_WORKSPACE_MOUNTED: 'invalid_request',
+  CODE_TOO_LARGE: 'too_large',
+  SUBMISSION_REJECTED: 'rejected',
+  ACCESS_DENIED: 'forbidden',
+  CONTAINER_NOT_FOUND: 'not_found',
+  QUEUE_FULL: 'rate_limited',
+  QUEUE_TIMEOUT: 'rate_limited',
+  ASYNC_LIMIT: 'rate_limited',
+  SHUTTING_DOWN: 'unavailable',
+  SECRETS_DISABLED: 'unavailable',
+  DOCKER_UNAVAILABLE: 'unavailable'
+};
+
+// The request field a code is about, for `details`
+const CODE_PARAMS = {
+  RUNTIME_NOT_FOUND: 'language',
+  INVALID_PROJECT: 'files',
+  INVALID_CALLBACK_URL: 'callback_url',
+  CALLBACKS_DISABLED: 'callback_url',
+  INVALID_VARIANTS: 'variants',
+  INVALID_CURSOR: 'cursor',
+  CODE_TOO_LARGE: 'code'
+};
+
+class ExecError extends Error {
+  /**
+   * @param {string} kind - One of KIND_STATUS
+   * @param {string} code - Machine-readable code, e.g. RUNTIME_NOT_FOUND
+   * @param {Object} options - { param, details, detail, retryAfter, cause }
+   */
+  constructor(kind, code, message, { param = null, details = null, detail = null, retryAfter = null, cause = null } = {}) {
+    super(message);
+    this.name = 'ExecError';
+    this.kind = KIND_STATUS[kind] ? kind : 'infrastructure';
+    this.code = code;
+    this.param = param;
+    this.details = details;
+    this.detail = detail;
+    this.retryAfter = retryAfter;
+    if (cause) {
+      this.cause = cause;
+    }
+  }
+
+  get statusCode() {
+    return KIND_STATUS[this.kind];
+  }
+}
+
+/**
+ * 400 for failed request validation, `details` as [{ param, msg }]
+ */
+const validationFailed = (details) => new ExecError(
+  'invalid_request',
+  'VALIDATION_FAILED',
+  details.map(detail => detail.msg).join('; '),
+  { details }
+);
+
+const dockerUnavailable = () => new ExecError(
+  'unavailable',
+  'DOCKER_UNAVAILABLE',
+  'Code execution is not available: Docker is not running'
+);
+
+/**
+ * Throw a 413 when single-file code is over config.execution.maxCodeBytes
+ */
+const checkCodeSize = (code) => {
+  const maxBytes = config.execution.maxCodeBytes;
+  if (typeof code === 'string' && Buffer.byteLength(code, 'utf8') > maxBytes) {
+    throw new ExecError('too_large', 'CODE_TOO_LARGE', `code exceeds the size limit of ${maxBytes} bytes`, { param: 'code' });
+  }
+};
+
+/**
+ * The ExecError for any error thrown while handling an execution request.
+ * Errors with a known `code` keep it; anything else is an infrastructure fault.
+ */
+const classify = (error) => {
+  if (error instanceof ExecError) {
+    return error;
+  }
+
+  const code = error && error.code;
+  if (typeof code === 'string' && CODE_KINDS[code]) {
+    return new ExecError(CODE_KINDS[code], code, error.message, {
+      param: error.param || CODE_PARAMS[code] || null,
+      retryAfter: error.retryAfter || null,
+      cause: error
+    });
+  }
+  return new ExecError('infrastructure', 'INTERNAL', (error && error.message) || 'Internal error', { cause: error });
+};
+
+/**
+ * Re-throw `error` as an infrastructure fault with `message` as context,
+ * unless it already says what went wrong
+ */
+const wrap = (error, message) => {
+  const classified = classify(error);
+  if (classified.kind !== 'infrastructure' || classified.code !== 'INTERNAL') {
+    return classified;
+  }
+  return new ExecError('infrastructure', 'INTERNAL', `${message}: ${classified.message}`, { cause: error });
+};
+
+/**
+ * JSON body for a failed request. `title` replaces the generic error title
+ * of infrastructure faults (e.g. 'Code execution failed').
+ */
+const toResponse = (error, { requestId = null, title = null } = {}) => {
+  const classified = classify(error);
+  const body = {
+    error: classified.kind === 'infrastructure' && title ? title : KIND_TITLE[classified.kind],
+    code: classified.code,
+    kind: classified.kind,
+    message: classified.message
+  };
+  if (classified.kind === 'invalid_request') {
+    body.details = classified.details || [{ param: classified.param, msg: classified.message }];
+  }
+  if (classified.detail) {
+    body.detail = classified.detail;
+  }
+  if (classified.retryAfter) {
+    body.retryAfter = classified.retryAfter;
+  }
+  body.requestId = requestId;
+  return body;
+};
+
+/**
+ * Send `error` as a response with the status its kind maps to
+ */
+const send = (res, error, options = {}) => {
+  const classified = classify(error);
+  if (classified.retryAfter) {
+    res.set('Retry-After', String(classified.retryAfter));
+  }
+  return res.status(classified.statusCode).json(toResponse(classified, options));
+};
+
+/**
+ * Frame for errors found after a streamed response has already started
+ */
+const toFrame = (error, requestId = null) => {
+  const classified = classify(error);
+  return {
+    event: 'error',
+    code: classified.code,
+    kind: classified.kind,
+    message: classified.message,
+    request_id: requestId
+  };
+};
+
+/**
+ * How a finished program ended, given its execution data:
+ * ok, compile_error, runtime_error, timeout, oom, resource_limit, killed,
+ * cancelled or error (the run itself broke; see executionData.error)
+ */
+const outcome = (executionData) => {
+  if (executionData.status === 'cancelled' || executionData.status === 'stopped') {
+    return 'cancelled';
+  }
+  if (executionData.status === 'error') {
+    return 'error';
+  }
+
+  switch (executionData.killedReason) {
+    case 'timeout':
+      return 'timeout';
+    case 'oom':
+      return 'oom';
+    case 'disk_limit':
+    case 'pids_limit':
+      return 'resource_limit';
+    case 'killed':
+      return 'killed';
+    default:
+      break;
+  }
+
+  if (executionData.compileFailed) {
+    return 'compile_error';
+  }
+  return executionData.exitCode === 0 ? 'ok' : 'runtime_error';
+};
+
+module.exports = {
+  ExecError,
+  KIND_STATUS,
+  classify,
+  validationFailed,
+  dockerUnavailable,
+  checkCodeSize,
+  wrap,
+  toResponse,
+  send,
+  toFrame,
+  outcome
+};
\ No newline at end of file
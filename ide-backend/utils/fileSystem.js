@@ -1,6 +1,28 @@
 const fs = require('fs').promises;
+const { createWriteStream, constants: fsConstants } = require('fs');
 const path = require('path');
+const crypto = require('crypto');
+const { EventEmitter } = require('events');
+const { pipeline, Transform } = require('stream');
 const logger = require('./logger');
+const requestContext = require('./requestContext');
+const { SNIFF_LENGTH, detectContentType, isBinaryContentType } = require('./contentType');
+
+// Open flags that refuse a symbolic link as the last path component
+const READ_FLAGS = fsConstants.O_RDONLY | fsConstants.O_NOFOLLOW;
+const WRITE_FLAGS = fsConstants.O_WRONLY | fsConstants.O_CREAT | fsConstants.O_TRUNC | fsConstants.O_NOFOLLOW;
+
+const linkError = (filePath) => {
+  const error = new Error(`Invalid file path: ${filePath} is or goes through a symbolic link`);
+  error.code = 'SYMLINK_NOT_ALLOWED';
+  return error;
+};
+
+const sizeError = (limit) => {
+  const error = new Error(`File size exceeds maximum allowed size (${limit} bytes)`);
+  error.code = 'FILE_TOO_LARGE';
+  return error;
+};
 
 /**
  * File system utilities for workspace management
@@ -9,12 +31,33 @@ class FileSystemUtils {
   constructor() {
     this.workspaceBasePath = process.env.WORKSPACE_BASE_PATH || './workspaces';
     this.maxFileSize = parseInt(process.env.MAX_FILE_SIZE) || 10 * 1024 * 1024; // 10MB default
+    this.maxWorkspaceSize = parseInt(process.env.WORKSPACE_MAX_SIZE) || 50 * 1024 * 1024; // 50MB per workspace
+    this.maxWorkspaceFiles = parseInt(process.env.WORKSPACE_MAX_FILES) || 500;
+    // Absolute path of the workspace directory as seen by the Docker daemon, for bind mounts
+    this.hostBasePath = process.env.WORKSPACE_HOST_PATH || path.resolve(this.workspaceBasePath);
     this.allowedExtensions = new Set([
       '.js', '.ts', '.jsx', '.tsx', '.json', '.html', '.css', '.scss', '.less',
       '.py', '.java', '.cpp', '.c', '.h', '.hpp', '.go', '.rs', '.php', '.rb',
       '.swift', '.kt', '.scala', '.sql', '.md', '.txt', '.xml', '.yaml', '.yml',
-      '.dockerfile', '.sh', '.bat', '.ps1', '.gitignore', '.env'
+      '.dockerfile', '.sh', '.bat', '.ps1', '.gitignore', '.env', '.mod', '.sum',
+      // Binary assets, read and written as raw bytes
+      '.png', '.jpg', '.jpeg', '.gif', '.bmp', '.webp', '.ico', '.svg', '.pdf',
+      '.db', '.sqlite', '.sqlite3', '.wasm', '.woff', '.woff2', '.ttf', '.otf'
     ]);
+    // 'write' { workspaceId, paths, requestId } before each change made
+    // through this API, so the workspace watcher can attribute the echo
+    this.changes = new EventEmitter();
+  }
+
+  /**
+   * Announce a change about to be made to `paths` (relative to the workspace)
+   */
+  noteChange(workspaceId, ...paths) {
+    this.changes.emit('write', {
+      workspaceId: workspaceId.toString(),
+      paths: paths.map(item => item.split(path.sep).join('/').replace(/^\/+|\/+$/g, '')),
+      requestId: requestContext.getRequestId()
+    });
   }
 
   /**
@@ -37,6 +80,13 @@ class FileSystemUtils {
     return path.join(this.workspaceBasePath, workspaceId.toString());
   }
 
+  /**
+   * Get the host path to bind mount a workspace into a container
+   */
+  getHostWorkspacePath(workspaceId) {
+    return path.join(this.hostBasePath, workspaceId.toString());
+  }
+
   /**
    * Get full file path within workspace
    */
@@ -45,13 +95,70 @@ class FileSystemUtils {
     const fullPath = path.join(workspacePath, filePath);
     
     // Security check: ensure file is within workspace
-    if (!fullPath.startsWith(workspacePath)) {
+    if (fullPath !== workspacePath && !fullPath.startsWith(workspacePath + path.sep)) {
       throw new Error('Invalid file path: Path traversal detected');
     }
     
     return fullPath;
   }
 
+  /**
+   * getFilePath, checked against the file system: workspaces are mounted
+   * read-write into containers, so programs can plant symbolic links to
+   * anywhere on the host. The real path of the nearest existing ancestor
+   * has to stay in the workspace and `filePath` itself may not be a link
+   * (unless `allowLink`, to remove one); either throws SYMLINK_NOT_ALLOWED.
+   */
+  async resolveFilePath(workspaceId, filePath, { allowLink = false } = {}) {
+    const fullPath = this.getFilePath(workspaceId, filePath);
+
+    let root;
+    try {
+      root = await fs.realpath(this.getWorkspacePath(workspaceId));
+    } catch (error) {
+      if (error.code === 'ENOENT') {
+        return fullPath; // nothing on disk yet to lead anywhere
+      }
+      throw error;
+    }
+
+    let ancestor = path.dirname(fullPath);
+    let real = null;
+    while (real === null) {
+      try {
+        real = await fs.realpath(ancestor);
+      } catch (error) {
+        if (error.code !== 'ENOENT' || ancestor === path.dirname(ancestor)) {
+          throw error;
+        }
+        ancestor = path.dirname(ancestor);
+      }
+    }
+    if (real !== root && !real.startsWith(root + path.sep)) {
+      throw linkError(filePath);
+    }
+
+    try {
+      if (!allowLink && (await fs.lstat(fullPath)).isSymbolicLink()) {
+        throw linkError(filePath);
+      }
+    } catch (error) {
+      if (error.code !== 'ENOENT') {
+        throw error;
+      }
+    }
+    return fullPath;
+  }
+
+  /**
+   * Open a workspace file for reading without following links, for
+   * callers that have done their own path validation
+   * @returns {Promise<FileHandle>}
+   */
+  async openFile(workspaceId, filePath) {
+    return fs.open(await this.resolveFilePath(workspaceId, filePath), READ_FLAGS);
+  }
+
   /**
    * Validate file path and extension
    */
@@ -86,11 +193,49 @@ class FileSystemUtils {
   validateFileSize(content) {
     const size = Buffer.byteLength(content, 'utf8');
     if (size > this.maxFileSize) {
-      throw new Error(`File size exceeds maximum allowed size (${this.maxFileSize} bytes)`);
+      throw sizeError(this.maxFileSize);
     }
     return size;
   }
 
+  /**
+   * Strong ETag for file content, used for If-Match concurrency checks
+   */
+  computeETag(content) {
+    return `"${crypto.createHash('sha256').update(content, 'utf8').digest('hex').slice(0, 32)}"`;
+  }
+
+  /**
+   * List every file in a workspace as relative POSIX paths
+   */
+  async listFilesRecursive(workspaceId) {
+    const workspacePath = this.getWorkspacePath(workspaceId);
+    const files = [];
+
+    const walk = async (dirPath, prefix) => {
+      const items = await fs.readdir(dirPath, { withFileTypes: true });
+
+      for (const item of items) {
+        const relativePath = prefix ? `${prefix}/${item.name}` : item.name;
+        if (item.isDirectory()) {
+          await walk(path.join(dirPath, item.name), relativePath);
+        } else if (item.isFile()) {
+          files.push(relativePath);
+        }
+      }
+    };
+
+    try {
+      await walk(workspacePath, '');
+      return files;
+    } catch (error) {
+      if (error.code === 'ENOENT') {
+        return [];
+      }
+      throw error;
+    }
+  }
+
   /**
    * Create workspace directory
    */
@@ -124,14 +269,19 @@ class FileSystemUtils {
 
   /**
    * Read file content
+   * @param {string|null} encoding - null for a Buffer of the raw bytes
    */
-  async readFile(workspaceId, filePath) {
+  async readFile(workspaceId, filePath, encoding = 'utf8') {
     this.validateFilePath(filePath);
     const fullPath = this.getFilePath(workspaceId, filePath);
     
     try {
-      const content = await fs.readFile(fullPath, 'utf8');
-      return content;
+      const handle = await this.openFile(workspaceId, filePath);
+      try {
+        return await handle.readFile(encoding ? { encoding } : {});
+      } finally {
+        await handle.close();
+      }
     } catch (error) {
       if (error.code === 'ENOENT') {
         throw new Error('File not found');
@@ -148,14 +298,22 @@ class FileSystemUtils {
     this.validateFilePath(filePath);
     const size = this.validateFileSize(content);
     const fullPath = this.getFilePath(workspaceId, filePath);
+    this.noteChange(workspaceId, filePath);
     
     try {
-      // Ensure directory exists
+      // Ensure directory exists, never through a link out of the workspace
+      await this.resolveFilePath(workspaceId, filePath);
       const dir = path.dirname(fullPath);
       await fs.mkdir(dir, { recursive: true });
       
       // Write file
-      await fs.writeFile(fullPath, content, 'utf8');
+      await this.resolveFilePath(workspaceId, filePath);
+      const handle = await fs.open(fullPath, WRITE_FLAGS, 0o644);
+      try {
+        await handle.writeFile(content, 'utf8');
+      } finally {
+        await handle.close();
+      }
       logger.info(`File written: ${fullPath} (${size} bytes)`);
       return size;
     } catch (error) {
@@ -164,14 +322,105 @@ class FileSystemUtils {
     }
   }
 
+  /**
+   * Stream a file's bytes, or those from `start` to `end` inclusive
+   */
+  async createReadStream(workspaceId, filePath, { start, end } = {}) {
+    this.validateFilePath(filePath);
+    const handle = await this.openFile(workspaceId, filePath);
+    return handle.createReadStream({ start, end });
+  }
+
+  /**
+   * Content type sniffed from the first bytes of a file
+   * @returns {Object} { mimeType, isBinary }
+   */
+  async detectFileType(workspaceId, filePath) {
+    this.validateFilePath(filePath);
+    const handle = await this.openFile(workspaceId, filePath);
+    try {
+      const buffer = Buffer.alloc(SNIFF_LENGTH);
+      const { bytesRead } = await handle.read(buffer, 0, SNIFF_LENGTH, 0);
+      const mimeType = detectContentType(buffer.subarray(0, bytesRead));
+      return { mimeType, isBinary: isBinaryContentType(mimeType) };
+    } finally {
+      await handle.close();
+    }
+  }
+
+  /**
+   * computeETag of a file's bytes, hashed as they stream
+   */
+  async computeFileETag(workspaceId, filePath) {
+    const hash = crypto.createHash('sha256');
+    for await (const chunk of await this.createReadStream(workspaceId, filePath)) {
+      hash.update(chunk);
+    }
+    return `"${hash.digest('hex').slice(0, 32)}"`;
+  }
+
+  /**
+   * Write a file from a stream without buffering it. Bytes are counted as
+   * they arrive, and more than maxFileSize aborts with FILE_TOO_LARGE. The
+   * upload lands in a hidden file next to the target that replaces it once
+   * complete, so a failed upload leaves the old content in place.
+   * @param {Function} beforeCommit - ({ size, etag }) called before the
+   *   replace; throwing discards the upload (e.g. over the quota)
+   * @returns {Object} { size, etag }
+   */
+  async writeFileStream(workspaceId, filePath, source, { beforeCommit = null } = {}) {
+    this.validateFilePath(filePath);
+    const fullPath = this.getFilePath(workspaceId, filePath);
+    const stagingPath = path.join(path.dirname(fullPath), `.${path.basename(fullPath)}.upload-${crypto.randomUUID()}`);
+    const stagingRelative = path.join(path.dirname(filePath), path.basename(stagingPath));
+    this.noteChange(workspaceId, filePath, stagingRelative);
+
+    const hash = crypto.createHash('sha256');
+    let size = 0;
+    const counter = new Transform({
+      transform: (chunk, encoding, callback) => {
+        size += chunk.length;
+        if (size > this.maxFileSize) {
+          return callback(sizeError(this.maxFileSize));
+        }
+        hash.update(chunk);
+        callback(null, chunk);
+      }
+    });
+
+    await this.resolveFilePath(workspaceId, filePath);
+    await fs.mkdir(path.dirname(fullPath), { recursive: true });
+    try {
+      // The staging file is renamed over the target, which replaces a link rather than following it
+      await this.resolveFilePath(workspaceId, filePath);
+      await new Promise((resolve, reject) => {
+        pipeline(source, counter, createWriteStream(stagingPath, { flags: WRITE_FLAGS | fsConstants.O_EXCL }), error => (error ? reject(error) : resolve()));
+      });
+
+      const result = { size, etag: `"${hash.digest('hex').slice(0, 32)}"` };
+      if (beforeCommit) {
+        await beforeCommit(result);
+      }
+      await fs.rename(stagingPath, fullPath);
+      logger.info(`File written: ${fullPath} (${size} bytes, streamed)`);
+      return result;
+    } catch (error) {
+      await fs.rm(stagingPath, { force: true });
+      throw error;
+    }
+  }
+
   /**
    * Delete file
    */
   async deleteFile(workspaceId, filePath) {
     this.validateFilePath(filePath);
     const fullPath = this.getFilePath(workspaceId, filePath);
+    this.noteChange(workspaceId, filePath);
     
     try {
+      // unlink removes a link itself, but mustn't reach through a linked directory
+      await this.resolveFilePath(workspaceId, filePath, { allowLink: true });
       await fs.unlink(fullPath);
       logger.info(`File deleted: ${fullPath}`);
     } catch (error) {
@@ -189,8 +438,10 @@ class FileSystemUtils {
   async createDirectory(workspaceId, dirPath) {
     this.validateFilePath(dirPath);
     const fullPath = this.getFilePath(workspaceId, dirPath);
+    this.noteChange(workspaceId, dirPath);
     
     try {
+      await this.resolveFilePath(workspaceId, dirPath);
       await fs.mkdir(fullPath, { recursive: true });
       logger.info(`Directory created: ${fullPath}`);
     } catch (error) {
@@ -205,8 +456,10 @@ class FileSystemUtils {
   async deleteDirectory(workspaceId, dirPath) {
     this.validateFilePath(dirPath);
     const fullPath = this.getFilePath(workspaceId, dirPath);
+    this.noteChange(workspaceId, dirPath);
     
     try {
+      await this.resolveFilePath(workspaceId, dirPath, { allowLink: true });
       await fs.rm(fullPath, { recursive: true, force: true });
       logger.info(`Directory deleted: ${fullPath}`);
     } catch (error) {
@@ -225,21 +478,34 @@ class FileSystemUtils {
     const fullPath = this.getFilePath(workspaceId, dirPath);
     
     try {
+      if (dirPath) {
+        await this.resolveFilePath(workspaceId, dirPath);
+      }
       const items = await fs.readdir(fullPath, { withFileTypes: true });
       const result = [];
       
       for (const item of items) {
+        // Links (dangling ones included) are left out rather than followed
+        if (!item.isDirectory() && !item.isFile()) {
+          continue;
+        }
         const itemPath = path.join(dirPath, item.name);
-        const stats = await fs.stat(path.join(fullPath, item.name));
+        const stats = await fs.lstat(path.join(fullPath, item.name));
         
-        result.push({
+        const entry = {
           name: item.name,
           path: itemPath,
           type: item.isDirectory() ? 'directory' : 'file',
           size: item.isFile() ? stats.size : 0,
           lastModified: stats.mtime,
           extension: item.isFile() ? path.extname(item.name) : null
-        });
+        };
+        // So the editor knows not to open e.g. a PNG as text
+        if (item.isFile()) {
+          Object.assign(entry, await this.detectFileType(workspaceId, itemPath).catch(() => ({ mimeType: null, isBinary: false })));
+        }
+
+        result.push(entry);
       }
       
       return result.sort((a, b) => {
@@ -268,8 +534,13 @@ class FileSystemUtils {
     
     const oldFullPath = this.getFilePath(workspaceId, oldPath);
     const newFullPath = this.getFilePath(workspaceId, newPath);
+    this.noteChange(workspaceId, oldPath, newPath);
     
     try {
+      // rename moves or replaces links themselves, so only the directories on the way matter
+      await this.resolveFilePath(workspaceId, oldPath, { allowLink: true });
+      await this.resolveFilePath(workspaceId, newPath, { allowLink: true });
+
       // Ensure destination directory exists
       const newDir = path.dirname(newFullPath);
       await fs.mkdir(newDir, { recursive: true });
@@ -294,13 +565,18 @@ class FileSystemUtils {
     
     const sourceFullPath = this.getFilePath(workspaceId, sourcePath);
     const destFullPath = this.getFilePath(workspaceId, destPath);
+    this.noteChange(workspaceId, destPath);
     
     try {
+      // Links inside a copied directory stay links; the source and target themselves may not be
+      await this.resolveFilePath(workspaceId, sourcePath);
+      await this.resolveFilePath(workspaceId, destPath);
+
       // Ensure destination directory exists
       const destDir = path.dirname(destFullPath);
       await fs.mkdir(destDir, { recursive: true });
       
-      const stats = await fs.stat(sourceFullPath);
+      const stats = await fs.lstat(sourceFullPath);
       
       if (stats.isDirectory()) {
         await fs.cp(sourceFullPath, destFullPath, { recursive: true });
@@ -326,7 +602,8 @@ class FileSystemUtils {
     const fullPath = this.getFilePath(workspaceId, itemPath);
     
     try {
-      const stats = await fs.stat(fullPath);
+      await this.resolveFilePath(workspaceId, itemPath);
+      const stats = await fs.lstat(fullPath);
       return {
         path: itemPath,
         type: stats.isDirectory() ? 'directory' : 'file',
@@ -350,8 +627,8 @@ class FileSystemUtils {
   async exists(workspaceId, itemPath) {
     try {
       this.validateFilePath(itemPath);
-      const fullPath = this.getFilePath(workspaceId, itemPath);
-      await fs.access(fullPath);
+      const fullPath = await this.resolveFilePath(workspaceId, itemPath);
+      await fs.lstat(fullPath);
       return true;
     } catch (error) {
       return false;
@@ -359,13 +636,21 @@ class FileSystemUtils {
   }
 
   /**
-   * Get workspace size and file count
+   * Get workspace size and file count, or those of `subPath` within it
    */
-  async getWorkspaceStats(workspaceId) {
-    const workspacePath = this.getWorkspacePath(workspaceId);
+  async getWorkspaceStats(workspaceId, subPath = '') {
+    const workspacePath = subPath ? this.getFilePath(workspaceId, subPath) : this.getWorkspacePath(workspaceId);
     
     try {
       const stats = { totalSize: 0, fileCount: 0, directoryCount: 0 };
+
+      if (subPath) {
+        await this.resolveFilePath(workspaceId, subPath);
+      }
+      const root = await fs.lstat(workspacePath);
+      if (!root.isDirectory()) {
+        return { totalSize: root.size, fileCount: 1, directoryCount: 0 };
+      }
       
       const calculateSize = async (dirPath) => {
         const items = await fs.readdir(dirPath, { withFileTypes: true });
@@ -376,9 +661,9 @@ class FileSystemUtils {
           if (item.isDirectory()) {
             stats.directoryCount++;
             await calculateSize(itemPath);
-          } else {
+          } else if (item.isFile()) {
             stats.fileCount++;
-            const itemStats = await fs.stat(itemPath);
+            const itemStats = await fs.lstat(itemPath);
             stats.totalSize += itemStats.size;
           }
         }
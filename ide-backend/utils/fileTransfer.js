@@ -0,0 +1,70 @@
+const path = require('path');
+const { pipeline } = require('stream');
+const fileSystem = require('./fileSystem');
+const logger = require('./logger');
+
+/**
+ * Whether a write request carries the file as its raw body rather than the
+ * JSON (or form) { content } the body parsers already read
+ */
+const isRawBody = (req) => req.is(['json', 'urlencoded']) === false;
+
+/**
+ * Stream a workspace file's bytes as the response, with its sniffed
+ * Content-Type. A single byte range is honoured (206, or 416 when it starts
+ * past the end); several ranges or a stale If-Range get the whole file.
+ * @param {Object} stats - fileSystem.getItemStats of the file
+ * @param {Object} options - { etag, attachment } to offer it as a download
+ */
+const sendFile = async (req, res, workspaceId, filePath, stats, { etag = null, attachment = false } = {}) => {
+  const { mimeType } = await fileSystem.detectFileType(workspaceId, filePath);
+
+  res.set({
+    'Content-Type': mimeType,
+    'Accept-Ranges': 'bytes',
+    'Last-Modified': new Date(stats.modified).toUTCString(),
+    // Workspace content is untrusted: never render it as a page of this origin
+    'X-Content-Type-Options': 'nosniff',
+    'Content-Security-Policy': "default-src 'none'; sandbox"
+  });
+  if (etag) {
+    res.set('ETag', etag);
+  }
+  if (attachment) {
+    res.attachment(path.basename(filePath));
+  }
+
+  let range = null;
+  const ifRange = req.get('If-Range');
+  if (req.get('Range') && (!ifRange || ifRange === etag)) {
+    const ranges = req.range(stats.size, { combine: true });
+    if (ranges === -1) {
+      res.set('Content-Range', `bytes */${stats.size}`);
+      return res.status(416).end();
+    }
+    if (Array.isArray(ranges) && ranges.type === 'bytes' && ranges.length === 1) {
+      range = ranges[0];
+      res.status(206).set('Content-Range', `bytes ${range.start}-${range.end}/${stats.size}`);
+    }
+  }
+
+  res.set('Content-Length', String(range ? range.end - range.start + 1 : stats.size));
+  if (req.method === 'HEAD') {
+    return res.end();
+  }
+
+  const source = await fileSystem.createReadStream(workspaceId, filePath, range || {});
+  await new Promise((resolve) => {
+    pipeline(source, res, (error) => {
+      if (error && error.code !== 'ERR_STREAM_PREMATURE_CLOSE') {
+        logger.warn(`Failed to send ${filePath} of workspace ${workspaceId}:`, error.message);
+      }
+      resolve();
+    });
+  });
+};
+
+module.exports = {
+  isRawBody,
+  sendFile
+};
\ No newline at end of file
@@ -66,6 +66,13 @@ class FileValidation {
       '.o', '.obj', '.lib', '.a'
     ]);
 
+    // Binary files workspaces may hold anyway (images, SQLite databases, ...),
+    // read and written as raw bytes by the file API
+    this.assetExtensions = new Set([
+      '.png', '.jpg', '.jpeg', '.gif', '.bmp', '.webp', '.ico', '.svg', '.pdf',
+      '.db', '.sqlite', '.sqlite3', '.wasm', '.woff', '.woff2', '.ttf', '.otf'
+    ]);
+
     // Dangerous file extensions that should be blocked (removed .js, .bat, .cmd, .ps1 for development)
     this.dangerousExtensions = new Set([
       '.exe', '.com', '.pif', '.scr', '.vbs', '.vbe',
@@ -106,8 +113,8 @@ class FileValidation {
       return false;
     }
     
-    // Allow known text/code extensions
-    if (this.languageMap[ext]) {
+    // Allow known text/code extensions and binary assets
+    if (this.languageMap[ext] || this.assetExtensions.has(ext)) {
       return true;
     }
     
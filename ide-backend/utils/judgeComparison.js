@@ -0,0 +1,97 @@
+/**
+ * Output comparison for judge mode. Every mode treats CRLF and LF the same,
+ * since expected outputs are often pasted from Windows editors:
+ *
+ *   exact   - identical text
+ *   trimmed - trailing whitespace on each line and trailing blank lines ignored
+ *   float   - whitespace-separated tokens; numeric tokens match within an
+ *             absolute or relative tolerance, anything else must be identical
+ */
+
+const COMPARISON_MODES = ['exact', 'trimmed', 'float'];
+
+const NUMBER = /^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$/;
+
+const normalizeNewlines = (text) => text.replace(/\r\n/g, '\n');
+
+const trimLines = (text) => normalizeNewlines(text)
+  .split('\n')
+  .map(line => line.replace(/\s+$/, ''))
+  .join('\n')
+  .replace(/\n+$/, '');
+
+const tokenize = (text) => trimLines(text).split(/\s+/).filter(Boolean);
+
+const numbersMatch = (actual, expected, tolerance) => {
+  const a = Number(actual);
+  const e = Number(expected);
+  const difference = Math.abs(a - e);
+  return difference <= tolerance || difference <= tolerance * Math.abs(e);
+};
+
+/**
+ * @param {string} actual - Program stdout
+ * @param {string} expected - Test case's expected stdout
+ * @param {Object} options - { mode, tolerance }
+ * @returns {boolean} Whether the output is accepted
+ */
+const compare = (actual, expected, { mode = 'exact', tolerance = 1e-6 } = {}) => {
+  if (mode === 'trimmed') {
+    return trimLines(actual) === trimLines(expected);
+  }
+
+  if (mode === 'float') {
+    const actualTokens = tokenize(actual);
+    const expectedTokens = tokenize(expected);
+    if (actualTokens.length !== expectedTokens.length) {
+      return false;
+    }
+    return expectedTokens.every((token, index) => {
+      const candidate = actualTokens[index];
+      if (NUMBER.test(token) && NUMBER.test(candidate)) {
+        return numbersMatch(candidate, token, tolerance);
+      }
+      return candidate === token;
+    });
+  }
+
+  return normalizeNewlines(actual) === normalizeNewlines(expected);
+};
+
+const truncate = (text, limit) => {
+  if (Buffer.byteLength(text) <= limit) {
+    return { text, truncated: false };
+  }
+  // Cut on a character boundary, dropping a split multi-byte sequence
+  return { text: Buffer.from(text).subarray(0, limit).toString('utf8').replace(/\uFFFD+$/, ''), truncated: true };
+};
+
+/**
+ * Describe where a rejected output went wrong: the first differing line
+ * (1-based) plus both outputs, each truncated to `limit` bytes
+ */
+const diff = (actual, expected, limit) => {
+  const actualLines = normalizeNewlines(actual).split('\n');
+  const expectedLines = normalizeNewlines(expected).split('\n');
+
+  let line = 0;
+  while (line < actualLines.length && line < expectedLines.length && actualLines[line] === expectedLines[line]) {
+    line++;
+  }
+
+  const expectedOutput = truncate(expected, limit);
+  const actualOutput = truncate(actual, limit);
+
+  return {
+    first_difference: {
+      line: line + 1,
+      expected: line < expectedLines.length ? truncate(expectedLines[line], limit).text : null,
+      actual: line < actualLines.length ? truncate(actualLines[line], limit).text : null
+    },
+    expected: expectedOutput.text,
+    actual: actualOutput.text,
+    truncated: expectedOutput.truncated || actualOutput.truncated
+  };
+};
+
+module.exports = { COMPARISON_MODES, compare, diff, truncate };
\ No newline at end of file
@@ -1,6 +1,8 @@
 const winston = require('winston');
 const path = require('path');
 const config = require('../config');
+const requestContext = require('./requestContext');
+const SecretScrubber = require('./secretScrubber');
 
 // Define log levels
 const levels = {
@@ -23,8 +25,29 @@ const colors = {
 // Tell winston that you want to link the colors
 winston.addColors(colors);
 
+// Tag every entry logged while handling a request with its request ID
+const withRequestId = winston.format((info) => {
+  const requestId = requestContext.getRequestId();
+  if (requestId && !info.requestId) {
+    info.requestId = requestId;
+  }
+  return info;
+});
+
+// Mask the workspace secrets injected into running executions
+const redactSecrets = winston.format((info) => {
+  for (const key of Object.keys(info)) {
+    if (typeof info[key] === 'string') {
+      info[key] = SecretScrubber.redactActive(info[key]);
+    }
+  }
+  return info;
+});
+
 // Define format for logs
 const format = winston.format.combine(
+  redactSecrets(),
+  withRequestId(),
   winston.format.timestamp({ format: 'YYYY-MM-DD HH:mm:ss:ms' }),
   winston.format.colorize({ all: true }),
   winston.format.printf(
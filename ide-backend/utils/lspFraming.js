@@ -0,0 +1,96 @@
+/**
+ * Base protocol framing for language servers: every JSON-RPC message on
+ * stdio is preceded by a `Content-Length: <bytes>` header block ending in
+ * \r\n\r\n. Browsers get the bare JSON, so the gateway encodes on the way
+ * in and decodes on the way out.
+ */
+
+const HEADER_END = Buffer.from('\r\n\r\n');
+
+/**
+ * Frame a JSON-RPC message for a language server's stdin
+ * @param {Object} message - JSON-RPC request, response or notification
+ * @returns {Buffer}
+ */
+const encodeMessage = (message) => {
+  const body = Buffer.from(JSON.stringify(message), 'utf8');
+  return Buffer.concat([Buffer.from(`Content-Length: ${body.length}\r\n\r\n`, 'ascii'), body]);
+};
+
+/**
+ * Incremental decoder for a language server's stdout. Chunks may split
+ * headers and bodies anywhere; Content-Length counts bytes, not characters.
+ */
+class MessageReader {
+  /**
+   * @param {Object} handlers - { onMessage(message), onError(error) }
+   * @param {number} maxMessageBytes - Larger bodies are an error (the stream can't be trusted after that)
+   */
+  constructor({ onMessage, onError = () => {} }, maxMessageBytes = 16 * 1024 * 1024) {
+    this.onMessage = onMessage;
+    this.onError = onError;
+    this.maxMessageBytes = maxMessageBytes;
+    this.buffer = Buffer.alloc(0);
+    this.contentLength = null;
+    this.failed = false;
+  }
+
+  write(chunk) {
+    if (this.failed) {
+      return;
+    }
+    this.buffer = Buffer.concat([this.buffer, chunk]);
+
+    while (!this.failed) {
+      if (this.contentLength === null) {
+        const headerEnd = this.buffer.indexOf(HEADER_END);
+        if (headerEnd === -1) {
+          if (this.buffer.length > 4096) {
+            this.fail(new Error('Language server sent a header block without an end'));
+          }
+          return;
+        }
+
+        const headers = this.buffer.subarray(0, headerEnd).toString('ascii');
+        const match = /^content-length:\s*(\d+)\s*$/im.exec(headers);
+        if (!match) {
+          this.fail(new Error(`Language server sent a message without Content-Length: ${headers}`));
+          return;
+        }
+
+        this.contentLength = parseInt(match[1], 10);
+        if (this.contentLength > this.maxMessageBytes) {
+          this.fail(new Error(`Language server message of ${this.contentLength} bytes exceeds ${this.maxMessageBytes}`));
+          return;
+        }
+        this.buffer = this.buffer.subarray(headerEnd + HEADER_END.length);
+      }
+
+      if (this.buffer.length < this.contentLength) {
+        return;
+      }
+
+      const body = this.buffer.subarray(0, this.contentLength).toString('utf8');
+      this.buffer = this.buffer.subarray(this.contentLength);
+      this.contentLength = null;
+
+      let message;
+      try {
+        message = JSON.parse(body);
+      } catch (error) {
+        // One bad body doesn't desynchronize the framing, skip it
+        this.onError(new Error(`Language server sent invalid JSON: ${error.message}`));
+        continue;
+      }
+      this.onMessage(message);
+    }
+  }
+
+  fail(error) {
+    this.failed = true;
+    this.buffer = Buffer.alloc(0);
+    this.onError(error);
+  }
+}
+
+module.exports = { encodeMessage, MessageReader };
\ No newline at end of file
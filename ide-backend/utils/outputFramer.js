@@ -0,0 +1,128 @@
+const { StringDecoder } = require('string_decoder');
+
+/**
+ * Buffers demultiplexed stdout/stderr chunks and emits them as sequenced
+ * frames: { stream, data, seq }. A stream is flushed once it has buffered
+ * maxFrameBytes, and all streams are flushed at least every flushIntervalMs.
+ */
+class OutputFramer {
+  constructor(onFrame, options = {}) {
+    this.onFrame = onFrame;
+    this.flushIntervalMs = options.flushIntervalMs || 100;
+    this.maxFrameBytes = options.maxFrameBytes || 4096;
+    this.seq = 0;
+    this.buffers = new Map(); // stream -> pending Buffer chunks
+    this.decoders = new Map(); // stream -> StringDecoder (keeps split UTF-8 sequences intact)
+    this.pendingBytes = new Map();
+    this.timer = null;
+    this.closed = false;
+  }
+
+  /**
+   * Buffer a chunk for the given stream ('stdout' or 'stderr')
+   */
+  write(stream, chunk) {
+    if (this.closed || !chunk || chunk.length === 0) {
+      return;
+    }
+
+    const buffer = Buffer.isBuffer(chunk) ? chunk : Buffer.from(String(chunk));
+    const pending = this.buffers.get(stream) || [];
+    pending.push(buffer);
+    this.buffers.set(stream, pending);
+    this.pendingBytes.set(stream, (this.pendingBytes.get(stream) || 0) + buffer.length);
+
+    if (this.pendingBytes.get(stream) >= this.maxFrameBytes) {
+      this.flushStream(stream);
+    }
+
+    if (!this.timer && this.hasPending()) {
+      this.timer = setTimeout(() => {
+        this.timer = null;
+        this.flush();
+      }, this.flushIntervalMs);
+    }
+  }
+
+  /**
+   * Writable-like adapter for a single stream, usable with docker modem.demuxStream
+   */
+  writer(stream) {
+    return {
+      write: (chunk) => {
+        this.write(stream, chunk);
+        return true;
+      }
+    };
+  }
+
+  /**
+   * Flush all buffered streams
+   */
+  flush() {
+    for (const stream of this.buffers.keys()) {
+      this.flushStream(stream);
+    }
+  }
+
+  flushStream(stream) {
+    const pending = this.buffers.get(stream);
+    if (!pending || pending.length === 0) {
+      return;
+    }
+
+    let buffer = Buffer.concat(pending);
+    this.buffers.set(stream, []);
+    this.pendingBytes.set(stream, 0);
+
+    if (!this.decoders.has(stream)) {
+      this.decoders.set(stream, new StringDecoder('utf8'));
+    }
+    const decoder = this.decoders.get(stream);
+
+    // Split oversized writes so no frame exceeds maxFrameBytes
+    while (buffer.length > 0) {
+      const slice = buffer.subarray(0, this.maxFrameBytes);
+      buffer = buffer.subarray(slice.length);
+      this.emit(stream, decoder.write(slice));
+    }
+  }
+
+  emit(stream, data) {
+    if (!data) {
+      return;
+    }
+
+    this.onFrame({ stream, data, seq: ++this.seq });
+  }
+
+  hasPending() {
+    for (const bytes of this.pendingBytes.values()) {
+      if (bytes > 0) return true;
+    }
+    return false;
+  }
+
+  /**
+   * Flush remaining output (including incomplete UTF-8 tails) and stop the timer
+   */
+  close() {
+    if (this.closed) {
+      return;
+    }
+
+    if (this.timer) {
+      clearTimeout(this.timer);
+      this.timer = null;
+    }
+
+    this.flush();
+    for (const [stream, decoder] of this.decoders.entries()) {
+      this.emit(stream, decoder.end());
+    }
+
+    this.closed = true;
+  }
+}
+
+module.exports = OutputFramer;
\ No newline at end of file
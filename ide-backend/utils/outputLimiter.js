@@ -0,0 +1,121 @@
+/**
+ * Caps how much of each output stream is buffered and forwarded. Writes are
+ * always accepted, so the container stream keeps draining after the cap:
+ * a program blocked on a full pipe would otherwise hang until its timeout.
+ * Everything past the cap is dropped (or only written to the spill file).
+ */
+
+// Cut position at or before `end` that doesn't split a UTF-8 sequence
+const utf8Boundary = (buffer, end) => {
+  while (end > 0 && end < buffer.length && (buffer[end] & 0xc0) === 0x80) {
+    end--;
+  }
+  return end;
+};
+
+class OutputLimiter {
+  /**
+   * @param {OutputFramer} framer - Receives the output that fits under the cap
+   * @param {Object} options - { limitBytes per stream, spill: { stdout, stderr } writers from outputSpill or null }
+   */
+  constructor(framer, { limitBytes, spill = null } = {}) {
+    this.framer = framer;
+    this.limitBytes = limitBytes;
+    this.spill = spill;
+    this.streams = new Map(); // stream -> { bytes, kept, truncated }
+    this.closed = false;
+  }
+
+  getStream(stream) {
+    if (!this.streams.has(stream)) {
+      this.streams.set(stream, { bytes: 0, kept: 0, truncated: false });
+    }
+    return this.streams.get(stream);
+  }
+
+  /**
+   * Write a chunk to `stream` ('stdout' or 'stderr')
+   */
+  write(stream, chunk) {
+    if (this.closed || !chunk || chunk.length === 0) {
+      return;
+    }
+
+    const buffer = Buffer.isBuffer(chunk) ? chunk : Buffer.from(String(chunk));
+    const state = this.getStream(stream);
+    state.bytes += buffer.length;
+
+    if (this.spill && this.spill[stream]) {
+      this.spill[stream].write(buffer);
+    }
+
+    if (state.truncated) {
+      return;
+    }
+
+    const room = this.limitBytes - state.kept;
+    if (buffer.length <= room) {
+      state.kept += buffer.length;
+      this.framer.write(stream, buffer);
+      return;
+    }
+
+    const kept = buffer.subarray(0, utf8Boundary(buffer, room));
+    state.kept += kept.length;
+    state.truncated = true;
+    this.framer.write(stream, kept);
+    this.framer.write(stream, `\n[${stream} truncated after ${this.limitBytes} bytes]\n`);
+  }
+
+  /**
+   * Writable-like adapter for a single stream, usable with docker modem.demuxStream
+   */
+  writer(stream) {
+    return {
+      write: (chunk) => {
+        this.write(stream, chunk);
+        return true;
+      }
+    };
+  }
+
+  isTruncated(stream) {
+    return this.streams.has(stream) && this.streams.get(stream).truncated;
+  }
+
+  /**
+   * Per-stream totals: { stdout: { bytes, truncated, spilled, spillTruncated }, stderr: ... }.
+   * `bytes` counts everything the program wrote, kept or not.
+   */
+  getStats() {
+    const stats = {};
+    for (const stream of ['stdout', 'stderr']) {
+      const state = this.getStream(stream);
+      const spill = this.spill && this.spill[stream];
+      stats[stream] = {
+        bytes: state.bytes,
+        truncated: state.truncated,
+        spilled: Boolean(spill && spill.bytes > 0 && !spill.failed),
+        spillTruncated: Boolean(spill && spill.truncated)
+      };
+    }
+    return stats;
+  }
+
+  /**
+   * Flush the framer and finish the spill files
+   */
+  close() {
+    if (this.closed) {
+      return;
+    }
+
+    this.closed = true;
+    this.framer.close();
+    if (this.spill) {
+      Object.values(this.spill).forEach(writer => writer.close());
+    }
+  }
+}
+
+module.exports = OutputLimiter;
\ No newline at end of file
@@ -0,0 +1,11 @@
+const { parentPort, workerData } = require('worker_threads');
+
+/**
+ * Applies caller supplied regexes in a worker thread, so the thread that
+ * started it can terminate a pattern that backtracks for too long (see
+ * executionDiff.applyPatterns). Posts the texts with every match replaced.
+ */
+const { texts, sources, placeholder } = workerData;
+const patterns = sources.map(source => new RegExp(source, 'g'));
+
+parentPort.postMessage(texts.map(text => patterns.reduce((result, pattern) => result.replace(pattern, placeholder), text)));
\ No newline at end of file
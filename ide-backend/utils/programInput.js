@@ -0,0 +1,149 @@
+const config = require('../config');
+
+const ENV_NAME = /^[A-Za-z_][A-Za-z0-9_]*$/;
+
+// Variables the sandbox, the runtime images or the toolchains depend on
+const RESERVED_ENV = new Set([
+  'PATH', 'HOME', 'USER', 'SHELL', 'PWD', 'LANGUAGE', 'TERM', 'HOSTNAME', 'TMPDIR',
+  'GOCACHE', 'GOPATH', 'GOMODCACHE', 'GOROOT', 'GOFLAGS', 'GOPROXY', 'GOSUMDB', 'GOTOOLCHAIN', 'GOTMPDIR',
+  'HTTP_PROXY', 'HTTPS_PROXY', 'NO_PROXY', 'ALL_PROXY', 'http_proxy', 'https_proxy', 'no_proxy', 'all_proxy',
+  'NODE_OPTIONS', 'NODE_PATH', 'npm_config_cache',
+  'PYTHONPATH', 'PYTHONHOME', 'PYTHONSTARTUP', 'PIP_FIND_LINKS',
+  'JAVA_HOME', 'JAVA_TOOL_OPTIONS', 'JDK_JAVA_OPTIONS', 'CLASSPATH',
+  'CARGO_HOME', 'RUSTUP_HOME'
+]);
+
+// Dynamic loader settings can inject code into any binary
+const RESERVED_PREFIXES = ['LD_', 'DYLD_'];
+
+/**
+ * Validation of the command-line arguments and environment variables an
+ * execution request passes to the program ({ args: [...], env: { NAME: value } }).
+ * Args are appended to the run argv, never to a shell, so they need no
+ * quoting. Env names the sandbox or the runtime defines can't be overridden.
+ */
+class ProgramInput {
+  constructor() {
+    this.maxArgs = config.execution.maxArgs;
+    this.maxArgsBytes = config.execution.maxArgsBytes;
+    this.maxEnvBytes = config.execution.maxEnvBytes;
+    this.deniedEnv = new Set(config.execution.deniedEnv);
+  }
+
+  isValidName(name) {
+    return typeof name === 'string' && ENV_NAME.test(name);
+  }
+
+  /**
+   * Names a program can't set for a runtime: the fixed list, the runtime's
+   * own env and the variables its cache mounts point
+   */
+  isReservedName(name, runtime = null) {
+    if (RESERVED_ENV.has(name) || this.deniedEnv.has(name) || RESERVED_PREFIXES.some(prefix => name.startsWith(prefix))) {
+      return true;
+    }
+    if (!runtime) {
+      return false;
+    }
+
+    const runtimeNames = [
+      ...(runtime.env || []).map(entry => entry.split('=')[0]),
+      ...(runtime.caches || []).map(cache => cache.env)
+    ];
+    return runtimeNames.includes(name);
+  }
+
+  /**
+   * Validate args and env (both optional). Returns { isValid, errors, args, env }
+   * with args defaulting to [] and env to {}.
+   */
+  validate(args, env, runtime = null) {
+    const argsResult = this.validateArgs(args);
+    const envResult = this.validateEnv(env, runtime);
+    const errors = [...argsResult.errors, ...envResult.errors];
+
+    return {
+      isValid: errors.length === 0,
+      errors,
+      args: argsResult.args,
+      env: envResult.env
+    };
+  }
+
+  validateArgs(args) {
+    const errors = [];
+    const normalized = [];
+
+    if (args === undefined || args === null) {
+      return { isValid: true, errors, args: normalized };
+    }
+    if (!Array.isArray(args)) {
+      return { isValid: false, errors: ['args must be an array of strings'], args: normalized };
+    }
+
+    if (args.length > this.maxArgs) {
+      errors.push(`Too many args (max ${this.maxArgs})`);
+    }
+
+    let totalBytes = 0;
+    args.forEach((arg, index) => {
+      if (typeof arg !== 'string') {
+        errors.push(`args[${index}] must be a string`);
+      } else if (arg.includes('\0')) {
+        errors.push(`args[${index}] must not contain NUL bytes`);
+      } else {
+        totalBytes += Buffer.byteLength(arg, 'utf8');
+        normalized.push(arg);
+      }
+    });
+
+    if (totalBytes > this.maxArgsBytes) {
+      errors.push(`args exceed the total size limit of ${this.maxArgsBytes} bytes`);
+    }
+
+    return { isValid: errors.length === 0, errors, args: normalized };
+  }
+
+  validateEnv(env, runtime = null) {
+    const errors = [];
+    const normalized = {};
+
+    if (env === undefined || env === null) {
+      return { isValid: true, errors, env: normalized };
+    }
+    if (typeof env !== 'object' || Array.isArray(env)) {
+      return { isValid: false, errors: ['env must be an object of variable name to string'], env: normalized };
+    }
+
+    let totalBytes = 0;
+    for (const [name, value] of Object.entries(env)) {
+      if (!ENV_NAME.test(name)) {
+        errors.push(`Invalid env name "${name}"`);
+      } else if (this.isReservedName(name, runtime)) {
+        errors.push(`env ${name} is reserved by the sandbox and can't be overridden`);
+      } else if (typeof value !== 'string') {
+        errors.push(`env ${name} must be a string`);
+      } else if (value.includes('\0')) {
+        errors.push(`env ${name} must not contain NUL bytes`);
+      } else {
+        totalBytes += Buffer.byteLength(`${name}=${value}`, 'utf8');
+        normalized[name] = value;
+      }
+    }
+
+    if (totalBytes > this.maxEnvBytes) {
+      errors.push(`env exceeds the total size limit of ${this.maxEnvBytes} bytes`);
+    }
+
+    return { isValid: errors.length === 0, errors, env: normalized };
+  }
+
+  /**
+   * Env map as Docker exec Env entries
+   */
+  toEnv(env = {}) {
+    return Object.entries(env || {}).map(([name, value]) => `${name}=${value}`);
+  }
+}
+
+module.exports = new ProgramInput();
\ No newline at end of file
@@ -0,0 +1,166 @@
+const path = require('path');
+const config = require('../config');
+const fileValidation = require('./fileValidation');
+
+/**
+ * Validation and packing of multi-file execution requests
+ * ({ files: { "relative/path": "contents" }, entrypoint })
+ */
+class ProjectFiles {
+  constructor() {
+    this.maxFiles = config.execution.maxFiles;
+    this.maxTotalBytes = config.execution.maxFilesBytes;
+  }
+
+  /**
+   * Normalize a relative path, rejecting traversal and absolute paths
+   */
+  normalizePath(filePath) {
+    if (typeof filePath !== 'string' || filePath.length === 0) {
+      return null;
+    }
+
+    // Reject absolute paths (POSIX and Windows) before normalizing
+    if (filePath.startsWith('/') || filePath.startsWith('\\') || /^[A-Za-z]:/.test(filePath)) {
+      return null;
+    }
+
+    const normalized = path.posix.normalize(filePath.replace(/\\/g, '/'));
+    if (normalized === '.' || normalized.startsWith('../') || normalized === '..' || normalized.endsWith('/')) {
+      return null;
+    }
+
+    return normalized;
+  }
+
+  /**
+   * Validate a files map and entrypoint. Returns { isValid, errors, files, entrypoint }
+   * with normalized paths.
+   */
+  validate(files, entrypoint) {
+    const errors = [];
+    const normalizedFiles = {};
+
+    if (!files || typeof files !== 'object' || Array.isArray(files)) {
+      return { isValid: false, errors: ['files must be an object of path to contents'] };
+    }
+
+    const entries = Object.entries(files);
+    if (entries.length === 0) {
+      errors.push('files must contain at least one file');
+    }
+
+    if (entries.length > this.maxFiles) {
+      errors.push(`Too many files (max ${this.maxFiles})`);
+    }
+
+    let totalBytes = 0;
+
+    for (const [filePath, content] of entries) {
+      const normalized = this.normalizePath(filePath);
+      if (!normalized) {
+        errors.push(`Invalid path "${filePath}": path traversal not allowed`);
+        continue;
+      }
+
+      const pathValidation = fileValidation.validateFilePath(normalized);
+      if (!pathValidation.isValid) {
+        errors.push(...pathValidation.errors.map(error => `Invalid path "${filePath}": ${error}`));
+        continue;
+      }
+
+      // Only regular file contents are accepted; anything else (e.g. symlink descriptors) is rejected
+      if (typeof content !== 'string') {
+        errors.push(`Invalid file "${filePath}": only regular file contents are allowed, symlinks are not supported`);
+        continue;
+      }
+
+      if (Object.prototype.hasOwnProperty.call(normalizedFiles, normalized)) {
+        errors.push(`Duplicate path "${filePath}"`);
+        continue;
+      }
+
+      totalBytes += Buffer.byteLength(content, 'utf8');
+      normalizedFiles[normalized] = content;
+    }
+
+    if (totalBytes > this.maxTotalBytes) {
+      errors.push(`Files exceed the total size limit of ${this.maxTotalBytes} bytes`);
+    }
+
+    const normalizedEntrypoint = this.normalizePath(entrypoint);
+    if (!entrypoint) {
+      errors.push('entrypoint is required when files are provided');
+    } else if (!normalizedEntrypoint || !Object.prototype.hasOwnProperty.call(normalizedFiles, normalizedEntrypoint)) {
+      errors.push(`entrypoint "${entrypoint}" must be one of the provided files`);
+    }
+
+    return {
+      isValid: errors.length === 0,
+      errors,
+      files: normalizedFiles,
+      entrypoint: normalizedEntrypoint,
+      totalBytes
+    };
+  }
+
+  /**
+   * Build a tar archive of the files, including parent directory entries
+   */
+  createArchive(files) {
+    const tar = require('tar-stream');
+    const pack = tar.pack();
+    const directories = new Set();
+
+    for (const filePath of Object.keys(files)) {
+      const parts = filePath.split('/').slice(0, -1);
+      for (let i = 1; i <= parts.length; i++) {
+        directories.add(parts.slice(0, i).join('/'));
+      }
+    }
+
+    for (const directory of Array.from(directories).sort()) {
+      pack.entry({ name: `${directory}/`, type: 'directory', mode: 0o755 });
+    }
+
+    for (const [filePath, content] of Object.entries(files)) {
+      pack.entry({ name: filePath, type: 'file', mode: 0o644 }, content);
+    }
+
+    pack.finalize();
+    return pack;
+  }
+
+  /**
+   * Extra environment for building a project. Containers have no network by
+   * default, so Go builds must resolve modules from vendor/ or the module
+   * cache instead of the proxy, and never run `go mod tidy`. Runtimes with
+   * networking enabled keep the default module proxy (reached via the egress proxy).
+   */
+  getBuildEnv(language, files, { networkEnabled = false } = {}) {
+    if (language !== 'go') {
+      return [];
+    }
+
+    const vendored = Object.prototype.hasOwnProperty.call(files, 'vendor/modules.txt');
+
+    return [
+      ...(networkEnabled ? [] : ['GOPROXY=off', 'GOSUMDB=off']),
+      'GOTOOLCHAIN=local',
+      `GOFLAGS=${vendored ? '-mod=vendor' : '-mod=mod'}`
+    ];
+  }
+
+  /**
+   * Add a minimal go.mod so `go build ./pkg` works for projects without one
+   */
+  withGoModule(language, files) {
+    if (language !== 'go' || Object.prototype.hasOwnProperty.call(files, 'go.mod')) {
+      return files;
+    }
+
+    return { ...files, 'go.mod': 'module workspace\n\ngo 1.21\n' };
+  }
+}
+
+module.exports = new ProjectFiles();
\ No newline at end of file
@@ -0,0 +1,111 @@
+/**
+ * Reading a REPL interpreter's terminal output one input line at a time.
+ *
+ * A snippet is sent line by line; after each line the interpreter echoes it
+ * (the PTY or its line editor does), prints whatever the statement produced
+ * and then shows either its primary prompt (ready for a new statement) or
+ * its continuation prompt (the statement isn't finished yet, e.g. inside a
+ * block or open bracket). A transcript collects the output for one line and
+ * reports which prompt ended it.
+ */
+
+// CSI and OSC sequences, then any other two-byte escape
+const ANSI_PATTERN = /\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]/g;
+
+// Keywords that continue a compound statement at the outer indentation level
+const BLOCK_CONTINUATION = /^(else|elif|except|finally)\b/;
+
+const clean = (text) => text.replace(ANSI_PATTERN, '').replace(/\r/g, '');
+
+/**
+ * Split a snippet into the lines to send. For runtimes where only an empty
+ * line ends an indented block, blank lines inside the snippet are dropped
+ * (they would end a block early) and one is inserted wherever indentation
+ * returns to the top level.
+ */
+const prepareLines = (code, { blankLineEndsBlock = false } = {}) => {
+  const lines = code.replace(/\r\n/g, '\n').replace(/\n+$/, '').split('\n');
+  if (!blankLineEndsBlock) {
+    return lines;
+  }
+
+  const result = [];
+  let indented = false;
+  for (const line of lines.filter(entry => entry.trim().length > 0)) {
+    const topLevel = !/^\s/.test(line);
+    if (topLevel && indented && !BLOCK_CONTINUATION.test(line)) {
+      result.push('');
+    }
+    indented = !topLevel;
+    result.push(line);
+  }
+  return result;
+};
+
+class ReplTranscript {
+  /**
+   * @param {Object} options - { prompt, continuationPrompt, echo: the line sent, or null when nothing is echoed }
+   */
+  constructor({ prompt, continuationPrompt, echo = null }) {
+    // Longest first, so one prompt that ends with another is still told apart
+    this.prompts = [['prompt', prompt], ['continuation', continuationPrompt]]
+      .sort((a, b) => b[1].length - a[1].length);
+    this.echo = echo;
+    this.buffer = '';
+    this.emitted = 0;
+    this.done = null; // 'prompt' | 'continuation' once a prompt ended the output
+    this.output = '';
+  }
+
+  /**
+   * Feed terminal output
+   * @returns {Object} { text: output that is safe to show now, done: prompt kind or null }
+   */
+  push(chunk) {
+    if (this.done) {
+      return { text: '', done: this.done };
+    }
+
+    this.buffer += clean(Buffer.isBuffer(chunk) ? chunk.toString('utf8') : chunk);
+
+    if (this.echo !== null) {
+      const expected = `${this.echo}\n`;
+      if (this.buffer.length < expected.length && expected.startsWith(this.buffer)) {
+        return { text: '', done: null };
+      }
+      if (this.buffer.startsWith(expected)) {
+        this.buffer = this.buffer.slice(expected.length);
+      }
+      this.echo = null;
+    }
+
+    for (const [kind, prompt] of this.prompts) {
+      if (this.buffer === prompt || this.buffer.endsWith(`\n${prompt}`)) {
+        this.done = kind;
+        this.output = this.buffer.slice(0, this.buffer.length - prompt.length);
+        return { text: this.take(this.output.length), done: kind };
+      }
+    }
+
+    // Hold back a last line that could still turn into a prompt
+    const lineStart = this.buffer.lastIndexOf('\n') + 1;
+    const tail = this.buffer.slice(lineStart);
+    const safeEnd = this.prompts.some(([, prompt]) => prompt.startsWith(tail)) ? lineStart : this.buffer.length;
+    return { text: this.take(safeEnd), done: null };
+  }
+
+  take(end) {
+    const text = end > this.emitted ? this.buffer.slice(this.emitted, end) : '';
+    this.emitted = Math.max(this.emitted, end);
+    return text;
+  }
+
+  /**
+   * Everything received so far, for a line that never reached a prompt
+   */
+  getOutput() {
+    return this.done ? this.output : this.buffer;
+  }
+}
+
+module.exports = { ReplTranscript, prepareLines, clean };
\ No newline at end of file
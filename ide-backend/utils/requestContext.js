@@ -0,0 +1,37 @@
+const { AsyncLocalStorage } = require('async_hooks');
+const crypto = require('crypto');
+
+// Client-supplied IDs are echoed into logs and headers, so keep them boring
+const REQUEST_ID_PATTERN = /^[A-Za-z0-9._:-]{1,128}$/;
+
+const storage = new AsyncLocalStorage();
+
+/**
+ * Request-scoped context (the request ID) that follows a request through
+ * every async call it makes, from the HTTP handler down to the Docker executor
+ */
+const requestContext = {
+  /**
+   * Use the caller's ID if it is well formed, otherwise generate one
+   */
+  resolveRequestId(candidate) {
+    return typeof candidate === 'string' && REQUEST_ID_PATTERN.test(candidate)
+      ? candidate
+      : crypto.randomUUID();
+  },
+
+  run(context, fn) {
+    return storage.run({ ...context }, fn);
+  },
+
+  get() {
+    return storage.getStore() || null;
+  },
+
+  getRequestId() {
+    const context = storage.getStore();
+    return context ? context.requestId : null;
+  }
+};
+
+module.exports = requestContext;
\ No newline at end of file
@@ -0,0 +1,34 @@
+/**
+ * Labels on every container and volume the backend creates, so leaked ones
+ * can be found after a crash:
+ *
+ *   studio.owner        - user the sandbox was created for ("pool" for warm containers)
+ *   studio.execution_id - unique per sandbox; also logged when the container is created
+ *   studio.created_at   - ISO timestamp, the age the reaper's grace period applies to
+ *   studio.instance     - backend instance that created it (executionSessions.instanceId);
+ *                         the reaper leaves other live instances' resources alone
+ */
+
+const OWNER = 'studio.owner';
+const EXECUTION_ID = 'studio.execution_id';
+const CREATED_AT = 'studio.created_at';
+const INSTANCE = 'studio.instance';
+
+const create = ({ owner, executionId, instance, createdAt = new Date() }) => ({
+  [OWNER]: String(owner),
+  [EXECUTION_ID]: executionId,
+  [CREATED_AT]: createdAt.toISOString(),
+  [INSTANCE]: instance
+});
+
+/**
+ * @param {Object} labels - Labels of a listed container or volume
+ * @param {number} fallbackMs - Used when the label is missing or malformed (e.g. Docker's own creation time)
+ * @returns {number} Creation time in milliseconds
+ */
+const getCreatedAt = (labels, fallbackMs = Date.now()) => {
+  const createdAt = Date.parse((labels && labels[CREATED_AT]) || '');
+  return Number.isNaN(createdAt) ? fallbackMs : createdAt;
+};
+
+module.exports = { OWNER, EXECUTION_ID, CREATED_AT, INSTANCE, create, getCreatedAt };
\ No newline at end of file
@@ -0,0 +1,173 @@
+const MASK = '*****';
+
+// Values of the secrets injected into running executions -> how many use them.
+// The logger redacts these from every entry.
+const active = new Map();
+
+const toBuffers = (values) => [...new Set(values)]
+  .filter(value => typeof value === 'string' && value.length > 0)
+  .map(value => Buffer.from(value, 'utf8'))
+  .sort((a, b) => b.length - a.length);
+
+/**
+ * Replaces exact matches of secret values in output with *****, in front of
+ * an OutputLimiter (or anything with write(stream, chunk) and close()).
+ * A secret split across chunks is still caught: the end of a chunk that
+ * could be the start of a secret is held back until the next chunk, or for
+ * at most holdMs so prompts without a newline still show up.
+ *
+ * Only exact byte matches are caught; a program can always print an encoded
+ * or reversed value.
+ */
+class SecretScrubber {
+  constructor(target, values, options = {}) {
+    this.target = target;
+    this.secrets = toBuffers(values);
+    this.maxHold = this.secrets.length > 0 ? this.secrets[0].length - 1 : 0;
+    this.holdMs = options.holdMs || 100;
+    this.held = new Map(); // stream -> Buffer that may start a secret
+    this.timer = null;
+    this.closed = false;
+  }
+
+  write(stream, chunk) {
+    if (this.closed || !chunk || chunk.length === 0) {
+      return;
+    }
+
+    const buffer = Buffer.isBuffer(chunk) ? chunk : Buffer.from(String(chunk));
+    const pending = this.held.get(stream);
+    this.held.delete(stream);
+    this.scrub(stream, pending ? Buffer.concat([pending, buffer]) : buffer);
+
+    if (this.held.size > 0 && !this.timer) {
+      this.timer = setTimeout(() => {
+        this.timer = null;
+        this.release();
+      }, this.holdMs);
+    }
+  }
+
+  writer(stream) {
+    return {
+      write: (chunk) => {
+        this.write(stream, chunk);
+        return true;
+      }
+    };
+  }
+
+  scrub(stream, buffer) {
+    let rest = buffer;
+    for (;;) {
+      const match = this.findFirst(rest);
+      if (!match) {
+        break;
+      }
+      if (match.index > 0) {
+        this.target.write(stream, rest.subarray(0, match.index));
+      }
+      this.target.write(stream, MASK);
+      rest = rest.subarray(match.index + match.length);
+    }
+
+    const hold = this.partialSuffix(rest);
+    if (hold > 0) {
+      this.held.set(stream, Buffer.from(rest.subarray(rest.length - hold)));
+      rest = rest.subarray(0, rest.length - hold);
+    }
+    if (rest.length > 0) {
+      this.target.write(stream, rest);
+    }
+  }
+
+  // Earliest secret in `buffer`, the longest one when several start there
+  findFirst(buffer) {
+    let first = null;
+    for (const secret of this.secrets) {
+      const index = buffer.indexOf(secret);
+      if (index !== -1 && (!first || index < first.index)) {
+        first = { index, length: secret.length };
+      }
+    }
+    return first;
+  }
+
+  // Length of the longest end of `buffer` that some secret starts with
+  partialSuffix(buffer) {
+    for (let length = Math.min(this.maxHold, buffer.length); length > 0; length--) {
+      const tail = buffer.subarray(buffer.length - length);
+      if (this.secrets.some(secret => secret.length > length && secret.subarray(0, length).equals(tail))) {
+        return length;
+      }
+    }
+    return 0;
+  }
+
+  // Held bytes can no longer complete a secret we'd recognize
+  release() {
+    for (const [stream, buffer] of this.held.entries()) {
+      this.target.write(stream, buffer);
+    }
+    this.held.clear();
+  }
+
+  close() {
+    if (this.closed) {
+      return;
+    }
+
+    this.closed = true;
+    if (this.timer) {
+      clearTimeout(this.timer);
+      this.timer = null;
+    }
+    this.release();
+    this.target.close();
+  }
+
+  /**
+   * Mask every secret value in a string
+   */
+  static redact(text, values) {
+    if (typeof text !== 'string' || text.length === 0) {
+      return text;
+    }
+    return toBuffers(values).reduce((result, secret) => result.split(secret.toString('utf8')).join(MASK), text);
+  }
+
+  /**
+   * Have the logger redact `values` until the returned function is called
+   */
+  static track(values) {
+    const tracked = [...new Set(values)].filter(value => typeof value === 'string' && value.length > 0);
+    tracked.forEach(value => active.set(value, (active.get(value) || 0) + 1));
+
+    let released = false;
+    return () => {
+      if (released) {
+        return;
+      }
+      released = true;
+      for (const value of tracked) {
+        const count = active.get(value) - 1;
+        if (count > 0) {
+          active.set(value, count);
+        } else {
+          active.delete(value);
+        }
+      }
+    };
+  }
+
+  /**
+   * Mask the secrets of running executions (used by the logger)
+   */
+  static redactActive(text) {
+    return active.size > 0 ? SecretScrubber.redact(text, [...active.keys()]) : text;
+  }
+}
+
+SecretScrubber.MASK = MASK;
+
+module.exports = SecretScrubber;
\ No newline at end of file
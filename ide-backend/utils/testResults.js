@@ -0,0 +1,250 @@
+/**
+ * Parsers that turn native test runner output into one report shape:
+ *
+ *   {
+ *     status: 'passed' | 'failed' | 'build_failed' | 'error',
+ *     summary: { total, passed, failed, skipped },
+ *     tests: [{ name, suite, status: 'passed'|'failed'|'skipped', duration_ms, message }],
+ *     build_output: string | null
+ *   }
+ *
+ * `build_failed` means nothing ran because the code didn't compile or the
+ * test files couldn't be collected; `error` means the runner's output could
+ * not be understood at all. Every parser takes an `onResult` callback that
+ * receives each test as soon as its result is known.
+ */
+
+const GO_STATUS = { pass: 'passed', fail: 'failed', skip: 'skipped' };
+const PYTEST_STATUS = { passed: 'passed', xpassed: 'passed', failed: 'failed', error: 'failed', skipped: 'skipped', xfailed: 'skipped' };
+const JEST_STATUS = { passed: 'passed', failed: 'failed', pending: 'skipped', skipped: 'skipped', todo: 'skipped', disabled: 'skipped' };
+
+// Reports are parsed in memory; anything bigger is not a report we want
+const MAX_REPORT_BYTES = 8 * 1024 * 1024;
+
+const summarize = (tests) => ({
+  total: tests.length,
+  passed: tests.filter(test => test.status === 'passed').length,
+  failed: tests.filter(test => test.status === 'failed').length,
+  skipped: tests.filter(test => test.status === 'skipped').length
+});
+
+const report = (status, tests, buildOutput) => ({
+  status,
+  summary: summarize(tests),
+  tests,
+  build_output: buildOutput && buildOutput.trim() ? buildOutput.trim() : null
+});
+
+/**
+ * Incremental parser for `go test -json` (test2json). Lines can arrive split
+ * across chunks; each test is reported when its pass/fail/skip event arrives.
+ */
+class GoTestParser {
+  constructor(onResult = () => {}) {
+    this.onResult = onResult;
+    this.pending = '';
+    this.tests = [];
+    this.output = new Map(); // "pkg test" -> output lines
+    this.buildOutput = [];
+    this.buildFailed = false;
+  }
+
+  write(chunk) {
+    this.pending += chunk.toString('utf8');
+    const lines = this.pending.split('\n');
+    this.pending = lines.pop();
+    lines.forEach(line => this.handleLine(line));
+  }
+
+  handleLine(line) {
+    if (!line.trim()) {
+      return;
+    }
+
+    let event;
+    try {
+      event = JSON.parse(line);
+    } catch (error) {
+      // Compiler errors and `go: ...` messages are plain text
+      this.buildOutput.push(line);
+      return;
+    }
+
+    const { Action: action, Package: pkg, Test: test, Output: output } = event;
+
+    if (action === 'build-output') {
+      this.buildOutput.push(output.replace(/\n$/, ''));
+      return;
+    }
+    if (action === 'build-fail' || (!test && action === 'output' && /\[(build|setup) failed\]/.test(output))) {
+      this.buildFailed = true;
+      return;
+    }
+
+    if (!test) {
+      return;
+    }
+
+    const key = `${pkg} ${test}`;
+    if (action === 'output') {
+      if (!this.output.has(key)) {
+        this.output.set(key, []);
+      }
+      this.output.get(key).push(output);
+      return;
+    }
+
+    if (GO_STATUS[action]) {
+      const status = GO_STATUS[action];
+      const result = {
+        name: test,
+        suite: pkg,
+        status,
+        duration_ms: Math.round((event.Elapsed || 0) * 1000),
+        message: status === 'failed' ? this.failureMessage(this.output.get(key)) : null
+      };
+      this.output.delete(key);
+      this.tests.push(result);
+      this.onResult(result);
+    }
+  }
+
+  // Drop the runner's own "=== RUN" / "--- FAIL" framing, keep what the test logged
+  failureMessage(lines = []) {
+    const message = lines
+      .filter(line => !/^\s*(=== (RUN|PAUSE|CONT)|--- (FAIL|PASS|SKIP))/.test(line))
+      .join('')
+      .trim();
+    return message || null;
+  }
+
+  finish({ stderr = '', exitCode = null } = {}) {
+    if (this.pending) {
+      this.handleLine(this.pending);
+      this.pending = '';
+    }
+
+    const buildOutput = [...this.buildOutput, stderr].filter(Boolean).join('\n');
+    const failed = this.tests.some(test => test.status === 'failed');
+
+    if (this.tests.length === 0 && (this.buildFailed || (exitCode !== 0 && exitCode !== null))) {
+      return report('build_failed', this.tests, buildOutput);
+    }
+    return report(failed || this.buildFailed ? 'failed' : 'passed', this.tests, buildOutput);
+  }
+}
+
+/**
+ * Runners that print one JSON document when they are done (pytest-json-report, jest --json)
+ */
+class JsonReportParser {
+  constructor(format, onResult = () => {}) {
+    this.format = format;
+    this.onResult = onResult;
+    this.chunks = [];
+    this.size = 0;
+  }
+
+  write(chunk) {
+    const buffer = Buffer.isBuffer(chunk) ? chunk : Buffer.from(String(chunk));
+    this.size += buffer.length;
+    if (this.size <= MAX_REPORT_BYTES) {
+      this.chunks.push(buffer);
+    }
+  }
+
+  finish({ stderr = '' } = {}) {
+    if (this.size > MAX_REPORT_BYTES) {
+      return report('error', [], `Test report exceeds ${MAX_REPORT_BYTES} bytes`);
+    }
+
+    let document;
+    try {
+      document = JSON.parse(Buffer.concat(this.chunks).toString('utf8'));
+    } catch (error) {
+      return report('error', [], stderr || 'Test runner did not produce a report');
+    }
+
+    const { tests, buildErrors } = this.format === 'pytest-json'
+      ? this.fromPytest(document)
+      : this.fromJest(document);
+
+    tests.forEach(test => this.onResult(test));
+
+    const buildOutput = buildErrors.join('\n\n');
+    if (tests.length === 0 && buildErrors.length > 0) {
+      return report('build_failed', tests, buildOutput);
+    }
+
+    const failed = buildErrors.length > 0 || tests.some(test => test.status === 'failed');
+    return report(failed ? 'failed' : 'passed', tests, buildOutput);
+  }
+
+  fromPytest(document) {
+    const phaseMessage = (phase) => phase && ((phase.crash && phase.crash.message) || phase.longrepr || null);
+
+    const tests = (document.tests || []).map(test => {
+      const [suite, ...name] = test.nodeid.split('::');
+      const duration = ['setup', 'call', 'teardown']
+        .reduce((total, phase) => total + ((test[phase] && test[phase].duration) || 0), 0);
+      const status = PYTEST_STATUS[test.outcome] || 'failed';
+
+      return {
+        name: name.join('::') || suite,
+        suite,
+        status,
+        duration_ms: Math.round(duration * 1000),
+        message: status === 'failed'
+          ? phaseMessage(test.call) || phaseMessage(test.setup) || phaseMessage(test.teardown)
+          : null
+      };
+    });
+
+    // Import and syntax errors fail collection before any test runs
+    const buildErrors = (document.collectors || [])
+      .filter(collector => collector.outcome === 'failed')
+      .map(collector => collector.longrepr || `Failed to collect ${collector.nodeid}`);
+
+    return { tests, buildErrors };
+  }
+
+  fromJest(document) {
+    const tests = [];
+    const buildErrors = [];
+
+    for (const suite of document.testResults || []) {
+      const file = (suite.name || '').replace(/^\/workspace\//, '');
+      const assertions = suite.assertionResults || [];
+
+      // A suite that failed without running any assertion didn't load (syntax error, bad import)
+      if (suite.status === 'failed' && assertions.length === 0) {
+        buildErrors.push(suite.message || `Test suite failed to run: ${file}`);
+        continue;
+      }
+
+      for (const assertion of assertions) {
+        const status = JEST_STATUS[assertion.status] || 'failed';
+        tests.push({
+          name: assertion.fullName || assertion.title,
+          suite: file,
+          status,
+          duration_ms: assertion.duration || 0,
+          message: status === 'failed' ? (assertion.failureMessages || []).join('\n') || null : null
+        });
+      }
+    }
+
+    return { tests, buildErrors };
+  }
+}
+
+/**
+ * Parser for a runtime's test format
+ * @param {string} format - go-test-json, pytest-json or jest-json
+ * @param {Function} onResult - Called with each test result as it becomes known
+ */
+const createParser = (format, onResult) => (
+  format === 'go-test-json' ? new GoTestParser(onResult) : new JsonReportParser(format, onResult)
+);
+
+module.exports = { createParser, GoTestParser, JsonReportParser };
\ No newline at end of file
@@ -0,0 +1,158 @@
+/**
+ * Line diffs in unified diff form, as structured hunks:
+ *
+ *   { oldStart, oldLines, newStart, newLines, lines: [{ op, text }] }
+ *
+ * where op is ' ' (context), '-' (only in the old text) or '+' (only in the
+ * new one) and line numbers are 1-based like `diff -u`.
+ */
+
+const splitLines = (text) => {
+  if (!text) {
+    return [];
+  }
+  const lines = text.replace(/\r\n/g, '\n').split('\n');
+  if (lines[lines.length - 1] === '') {
+    lines.pop();
+  }
+  return lines;
+};
+
+/**
+ * Shortest edit script between two line arrays (Myers' O(ND) algorithm) as
+ * [{ op, text }], or null when it takes more than maxEdits insertions and
+ * deletions
+ */
+const editScript = (a, b, maxEdits) => {
+  const n = a.length;
+  const m = b.length;
+  const max = Math.min(n + m, maxEdits);
+  const offset = max + 1;
+  const v = new Int32Array(2 * max + 3);
+  const trace = [];
+
+  for (let d = 0; d <= max; d++) {
+    trace.push(v.slice());
+    for (let k = -d; k <= d; k += 2) {
+      let x = (k === -d || (k !== d && v[offset + k - 1] < v[offset + k + 1]))
+        ? v[offset + k + 1]
+        : v[offset + k - 1] + 1;
+      let y = x - k;
+      while (x < n && y < m && a[x] === b[y]) {
+        x++;
+        y++;
+      }
+      v[offset + k] = x;
+
+      if (x >= n && y >= m) {
+        return backtrack(trace, offset, a, b);
+      }
+    }
+  }
+
+  return null;
+};
+
+// Walk the saved V arrays back from the end to recover the edits
+const backtrack = (trace, offset, a, b) => {
+  const ops = [];
+  let x = a.length;
+  let y = b.length;
+
+  for (let d = trace.length - 1; d >= 0; d--) {
+    const v = trace[d];
+    const k = x - y;
+    const prevK = (k === -d || (k !== d && v[offset + k - 1] < v[offset + k + 1])) ? k + 1 : k - 1;
+    const prevX = v[offset + prevK];
+    const prevY = prevX - prevK;
+
+    while (x > prevX && y > prevY) {
+      ops.push({ op: ' ', text: a[x - 1] });
+      x--;
+      y--;
+    }
+    if (d > 0) {
+      ops.push(x === prevX ? { op: '+', text: b[y - 1] } : { op: '-', text: a[x - 1] });
+    }
+    x = prevX;
+    y = prevY;
+  }
+
+  return ops.reverse();
+};
+
+/**
+ * Group an edit script into hunks with up to `context` unchanged lines
+ * around each change
+ */
+const toHunks = (ops, context) => {
+  const include = new Array(ops.length).fill(false);
+  ops.forEach((entry, index) => {
+    if (entry.op !== ' ') {
+      for (let i = Math.max(0, index - context); i <= Math.min(ops.length - 1, index + context); i++) {
+        include[i] = true;
+      }
+    }
+  });
+
+  const hunks = [];
+  let oldLine = 0;
+  let newLine = 0;
+  let hunk = null;
+
+  ops.forEach((entry, index) => {
+    if (include[index]) {
+      if (!hunk) {
+        hunk = { oldStart: oldLine + 1, oldLines: 0, newStart: newLine + 1, newLines: 0, lines: [] };
+        hunks.push(hunk);
+      }
+      hunk.lines.push(entry);
+      hunk.oldLines += entry.op === '+' ? 0 : 1;
+      hunk.newLines += entry.op === '-' ? 0 : 1;
+    } else {
+      hunk = null;
+    }
+    oldLine += entry.op === '+' ? 0 : 1;
+    newLine += entry.op === '-' ? 0 : 1;
+  });
+
+  // `diff -u` numbers an empty side after the line it would follow
+  for (const entry of hunks) {
+    entry.oldStart -= entry.oldLines === 0 ? 1 : 0;
+    entry.newStart -= entry.newLines === 0 ? 1 : 0;
+  }
+  return hunks;
+};
+
+/**
+ * Diff two texts line by line
+ * @param {Object} options - { context, maxEdits }
+ * @returns {Object} { identical, hunks, added, removed, exact } where exact
+ *   is false for texts too different to diff in maxEdits, which come back
+ *   as a single hunk replacing everything
+ */
+const diffLines = (oldText, newText, { context = 3, maxEdits = 1000 } = {}) => {
+  const a = splitLines(oldText);
+  const b = splitLines(newText);
+
+  let ops = editScript(a, b, maxEdits);
+  const exact = ops !== null;
+  if (!exact) {
+    ops = [...a.map(text => ({ op: '-', text })), ...b.map(text => ({ op: '+', text }))];
+  }
+
+  const hunks = toHunks(ops, context);
+  return {
+    identical: hunks.length === 0,
+    hunks,
+    added: ops.filter(entry => entry.op === '+').length,
+    removed: ops.filter(entry => entry.op === '-').length,
+    exact
+  };
+};
+
+module.exports = {
+  splitLines,
+  editScript,
+  diffLines
+};
\ No newline at end of file
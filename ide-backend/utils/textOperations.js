@@ -0,0 +1,167 @@
+/**
+ * Operational transform over plain text. An operation is a list of
+ * components applied one after another, each relative to the text the
+ * previous component left behind:
+ *
+ *   { type: 'insert', position, text }
+ *   { type: 'delete', position, length }
+ *
+ * Positions count UTF-16 code units, the same as JavaScript string indices
+ * and browser editors. transform(a, b, side) rewrites `a` so it applies
+ * after the concurrent `b`; `side` breaks ties between inserts at the same
+ * position ('left' goes first).
+ */
+
+const invalid = (message) => {
+  const error = new Error(message);
+  error.code = 'INVALID_OPERATION';
+  return error;
+};
+
+const isPosition = (value) => Number.isInteger(value) && value >= 0;
+
+/**
+ * Validate untrusted components and drop the ones that do nothing
+ * @param {Array} ops - Components as received from a client
+ * @param {number} maxComponents - Upper bound on the list length
+ * @returns {Array} Clean copies of the components
+ */
+const normalize = (ops, maxComponents = Infinity) => {
+  if (!Array.isArray(ops)) {
+    throw invalid('ops must be an array');
+  }
+  if (ops.length > maxComponents) {
+    throw invalid(`An operation may have at most ${maxComponents} components`);
+  }
+
+  return ops.map((op, index) => {
+    if (!op || !isPosition(op.position)) {
+      throw invalid(`ops[${index}].position must be a non-negative integer`);
+    }
+    if (op.type === 'insert') {
+      if (typeof op.text !== 'string') {
+        throw invalid(`ops[${index}].text must be a string`);
+      }
+      return { type: 'insert', position: op.position, text: op.text };
+    }
+    if (op.type === 'delete') {
+      if (!isPosition(op.length)) {
+        throw invalid(`ops[${index}].length must be a non-negative integer`);
+      }
+      return { type: 'delete', position: op.position, length: op.length };
+    }
+    throw invalid(`ops[${index}].type must be insert or delete`);
+  }).filter(op => (op.type === 'insert' ? op.text.length > 0 : op.length > 0));
+};
+
+/**
+ * Apply an operation to a document
+ * @throws INVALID_OPERATION if a component falls outside the text
+ */
+const apply = (text, ops) => ops.reduce((current, op, index) => {
+  if (op.type === 'insert') {
+    if (op.position > current.length) {
+      throw invalid(`ops[${index}] inserts at ${op.position} past the end of the document (${current.length})`);
+    }
+    return current.slice(0, op.position) + op.text + current.slice(op.position);
+  }
+
+  if (op.position + op.length > current.length) {
+    throw invalid(`ops[${index}] deletes past the end of the document (${current.length})`);
+  }
+  return current.slice(0, op.position) + current.slice(op.position + op.length);
+}, text);
+
+// Transform one component against another concurrent one; a delete that
+// spans an insert splits around it, so the result is a list
+const transformComponent = (op, other, side) => {
+  if (op.type === 'insert') {
+    if (other.type === 'insert') {
+      const shift = other.position < op.position || (other.position === op.position && side === 'right');
+      return [shift ? { ...op, position: op.position + other.text.length } : op];
+    }
+    if (op.position <= other.position) {
+      return [op];
+    }
+    // After the deleted range, or inside it (the insert survives at its start)
+    return [{ ...op, position: Math.max(op.position - other.length, other.position) }];
+  }
+
+  const end = op.position + op.length;
+
+  if (other.type === 'insert') {
+    if (other.position <= op.position) {
+      return [{ ...op, position: op.position + other.text.length }];
+    }
+    if (other.position >= end) {
+      return [op];
+    }
+    // Delete around the inserted text, never the text itself
+    const before = other.position - op.position;
+    return [
+      { type: 'delete', position: op.position, length: before },
+      { type: 'delete', position: op.position + other.text.length, length: op.length - before }
+    ];
+  }
+
+  const otherEnd = other.position + other.length;
+  if (end <= other.position) {
+    return [op];
+  }
+  if (op.position >= otherEnd) {
+    return [{ ...op, position: op.position - other.length }];
+  }
+
+  // Overlapping deletes: only remove what the other one left
+  const overlap = Math.min(end, otherEnd) - Math.max(op.position, other.position);
+  const length = op.length - overlap;
+  return length > 0 ? [{ type: 'delete', position: Math.min(op.position, other.position), length }] : [];
+};
+
+const flip = (side) => (side === 'left' ? 'right' : 'left');
+
+// Transform two concurrent operations against each other: returns [a', b']
+// with apply(apply(text, b), a') === apply(apply(text, a), b')
+const transformPair = (a, b, side) => {
+  if (a.length === 0 || b.length === 0) {
+    return [a, b];
+  }
+
+  if (a.length > 1) {
+    const [head, bAfterHead] = transformPair([a[0]], b, side);
+    const [rest, bAfterA] = transformPair(a.slice(1), bAfterHead, side);
+    return [head.concat(rest), bAfterA];
+  }
+
+  if (b.length > 1) {
+    const [aAfterHead, head] = transformPair(a, [b[0]], side);
+    const [aAfterB, rest] = transformPair(aAfterHead, b.slice(1), side);
+    return [aAfterB, head.concat(rest)];
+  }
+
+  return [transformComponent(a[0], b[0], side), transformComponent(b[0], a[0], flip(side))];
+};
+
+/**
+ * Rewrite `ops` so it applies after the concurrent `against`
+ * @param {Array} ops - Operation to transform
+ * @param {Array} against - Operation already applied
+ * @param {string} side - 'left' if `ops` wins ties at the same position, otherwise 'right'
+ */
+const transform = (ops, against, side = 'right') => transformPair(ops, against, side)[0];
+
+/**
+ * Where a cursor ends up after an operation. Text inserted at the cursor
+ * pushes it right.
+ */
+const transformPosition = (position, ops) => ops.reduce((current, op) => {
+  if (op.type === 'insert') {
+    return op.position <= current ? current + op.text.length : current;
+  }
+  if (op.position >= current) {
+    return current;
+  }
+  return current - Math.min(op.length, current - op.position);
+}, position);
+
+module.exports = { normalize, apply, transform, transformPosition };
\ No newline at end of file
@@ -0,0 +1,157 @@
+const { AsyncLocalStorage } = require('async_hooks');
+const { trace, ROOT_CONTEXT, SpanStatusCode, isSpanContextValid } = require('@opentelemetry/api');
+const config = require('../config');
+const logger = require('./logger');
+
+const TRACER_NAME = 'studio-backend';
+const TRACEPARENT_PATTERN = /^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$/;
+
+const storage = new AsyncLocalStorage();
+
+// OTel rejects null attribute values; leave unknown ones out instead
+const withoutEmpty = (attributes = {}) => Object.fromEntries(
+  Object.entries(attributes).filter(([, value]) => value !== null && value !== undefined)
+);
+
+/**
+ * OpenTelemetry tracing for the request -> queue -> container -> exec path.
+ * The active span follows a request through its async calls the way
+ * requestContext does, so spans nest correctly without a global context
+ * manager. Spans go to the no-op tracer unless OTLP export is configured
+ * (config.tracing) or a test injects its own provider:
+ *
+ *   tracing.setTracerProvider(recorder);
+ */
+const tracing = {
+  provider: null,
+
+  /**
+   * Export spans over OTLP/HTTP when configured. The endpoint, headers and
+   * timeouts come from the standard OTEL_EXPORTER_OTLP_* variables.
+   */
+  initialize() {
+    if (!config.tracing.enabled || this.provider) {
+      return;
+    }
+
+    const { NodeTracerProvider } = require('@opentelemetry/sdk-trace-node');
+    const { BatchSpanProcessor } = require('@opentelemetry/sdk-trace-base');
+    const { OTLPTraceExporter } = require('@opentelemetry/exporter-trace-otlp-http');
+    const { Resource } = require('@opentelemetry/resources');
+
+    this.setTracerProvider(new NodeTracerProvider({
+      resource: new Resource({ 'service.name': config.tracing.serviceName }),
+      spanProcessors: [new BatchSpanProcessor(new OTLPTraceExporter())]
+    }));
+    logger.info(`Exporting traces over OTLP as ${config.tracing.serviceName}`);
+  },
+
+  setTracerProvider(provider) {
+    this.provider = provider;
+  },
+
+  getTracer() {
+    return (this.provider || trace.getTracerProvider()).getTracer(TRACER_NAME);
+  },
+
+  /**
+   * Context of the active span, to continue a trace later (async jobs)
+   */
+  active() {
+    return storage.getStore() || ROOT_CONTEXT;
+  },
+
+  runInContext(context, fn) {
+    return storage.run(context || ROOT_CONTEXT, fn);
+  },
+
+  runWithSpan(span, fn) {
+    return storage.run(trace.setSpan(this.active(), span), fn);
+  },
+
+  /**
+   * Start a span, a child of the active one unless `context` says otherwise.
+   * End it with endSpan.
+   */
+  startSpan(name, attributes = {}, context = this.active()) {
+    return this.getTracer().startSpan(name, { attributes: withoutEmpty(attributes) }, context);
+  },
+
+  /**
+   * Set attributes, skipping null and undefined values
+   */
+  setAttributes(span, attributes) {
+    if (span) {
+      span.setAttributes(withoutEmpty(attributes));
+    }
+  },
+
+  /**
+   * End a span, marking it failed when `error` (an Error or a message) is given
+   */
+  endSpan(span, attributes = {}, error = null) {
+    if (!span) {
+      return;
+    }
+
+    this.setAttributes(span, attributes);
+    if (error) {
+      if (error instanceof Error) {
+        span.recordException(error);
+      }
+      span.setStatus({ code: SpanStatusCode.ERROR, message: error instanceof Error ? error.message : String(error) });
+    }
+    span.end();
+  },
+
+  /**
+   * Run `fn(span)` as the active span, ending it when `fn` settles
+   */
+  async withSpan(name, attributes, fn) {
+    const span = this.startSpan(name, attributes);
+    try {
+      const result = await this.runWithSpan(span, () => fn(span));
+      this.endSpan(span);
+      return result;
+    } catch (error) {
+      this.endSpan(span, {}, error);
+      throw error;
+    }
+  },
+
+  /**
+   * Add a W3C traceparent for the active span to outgoing request headers
+   */
+  inject(headers = {}) {
+    const span = trace.getSpan(this.active());
+    const spanContext = span && span.spanContext();
+    if (spanContext && isSpanContextValid(spanContext)) {
+      headers.traceparent = `00-${spanContext.traceId}-${spanContext.spanId}-${(spanContext.traceFlags & 0xff).toString(16).padStart(2, '0')}`;
+    }
+    return headers;
+  },
+
+  /**
+   * Context continuing an incoming traceparent header, or a fresh trace
+   */
+  extract(traceparent) {
+    const match = typeof traceparent === 'string' && TRACEPARENT_PATTERN.exec(traceparent.trim());
+    if (!match) {
+      return ROOT_CONTEXT;
+    }
+
+    const spanContext = { traceId: match[1], spanId: match[2], traceFlags: parseInt(match[3], 16), isRemote: true };
+    return isSpanContextValid(spanContext) ? trace.setSpanContext(ROOT_CONTEXT, spanContext) : ROOT_CONTEXT;
+  },
+
+  /**
+   * Flush spans still waiting for export
+   */
+  async shutdown() {
+    if (this.provider && typeof this.provider.shutdown === 'function') {
+      await this.provider.shutdown();
+    }
+  }
+};
+
+module.exports = tracing;
\ No newline at end of file
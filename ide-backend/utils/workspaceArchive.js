@@ -0,0 +1,259 @@
+const fs = require('fs').promises;
+const path = require('path');
+const zlib = require('zlib');
+const crypto = require('crypto');
+const { pipeline } = require('stream');
+const tar = require('tar-stream');
+const fileSystem = require('./fileSystem');
+const fileValidation = require('./fileValidation');
+const logger = require('./logger');
+
+// Dependency and build caches are reproducible, so they stay out of exports
+const EXCLUDED_DIRS = new Set([
+  'node_modules', '.cache', '__pycache__', '.pytest_cache', '.mypy_cache', '.gradle', '.venv'
+]);
+
+/**
+ * Export a workspace directory as tar.gz and restore one from an uploaded
+ * tarball. Restores extract into a staging directory next to the workspace
+ * and only replace its contents once every entry has passed path, size and
+ * quota checks, so a rejected upload leaves the workspace untouched.
+ */
+class WorkspaceArchive {
+  /**
+   * Files to export: everything outside EXCLUDED_DIRS, skipping files over
+   * the per-file limit and whatever no longer fits in the workspace quota
+   * @returns {Object} { files: [{ path, size, mtime }], skipped: [path] }
+   */
+  async collectExportFiles(workspaceId) {
+    const root = fileSystem.getWorkspacePath(workspaceId);
+    const files = [];
+    const skipped = [];
+    let totalSize = 0;
+
+    const walk = async (dir, prefix) => {
+      const items = await fs.readdir(dir, { withFileTypes: true });
+      items.sort((a, b) => a.name.localeCompare(b.name));
+
+      for (const item of items) {
+        const relativePath = prefix ? `${prefix}/${item.name}` : item.name;
+        const fullPath = path.join(dir, item.name);
+
+        if (item.isDirectory()) {
+          if (!EXCLUDED_DIRS.has(item.name)) {
+            await walk(fullPath, relativePath);
+          }
+        } else if (item.isFile()) {
+          const stats = await fs.stat(fullPath);
+          if (stats.size > fileSystem.maxFileSize || totalSize + stats.size > fileSystem.maxWorkspaceSize) {
+            skipped.push(relativePath);
+            continue;
+          }
+          totalSize += stats.size;
+          files.push({ path: relativePath, size: stats.size, mtime: stats.mtime });
+        }
+      }
+    };
+
+    try {
+      await walk(root, '');
+    } catch (error) {
+      if (error.code !== 'ENOENT') {
+        throw error;
+      }
+    }
+
+    return { files, skipped };
+  }
+
+  /**
+   * Stream a tar.gz of the workspace into `output`
+   * @param {Array} files - Entries from collectExportFiles
+   */
+  async exportTo(workspaceId, files, output) {
+    const pack = tar.pack();
+    const done = new Promise((resolve, reject) => {
+      pipeline(pack, zlib.createGzip(), output, (error) => (error ? reject(error) : resolve()));
+    });
+
+    const write = async () => {
+      for (const file of files) {
+        // A file replaced by a link since it was listed fails here instead of leaking its target
+        const handle = await fileSystem.openFile(workspaceId, file.path);
+        const content = await handle.readFile().finally(() => handle.close());
+        await new Promise((resolve, reject) => {
+          pack.entry({ name: file.path, size: content.length, mtime: file.mtime, mode: 0o644 }, content, (error) => (
+            error ? reject(error) : resolve()
+          ));
+        });
+      }
+      pack.finalize();
+    };
+
+    // A failed read or a client that went away ends the pipeline with that error
+    write().catch(error => pack.destroy(error));
+    return done;
+  }
+
+  /**
+   * Replace a workspace with the contents of a tarball
+   * @param {Stream} input - Uploaded archive
+   * @param {Object} options - { gzip: whether the upload is gzip-compressed }
+   * @returns {Object} { fileCount, totalSize }
+   */
+  async restore(workspaceId, input, { gzip = true } = {}) {
+    const workspacePath = fileSystem.getWorkspacePath(workspaceId);
+    const suffix = `${workspaceId}-${crypto.randomUUID()}`;
+    const stagingPath = path.join(path.dirname(workspacePath), `.restore-${suffix}`);
+
+    await fs.mkdir(stagingPath, { recursive: true });
+
+    try {
+      const result = await this.extract(input, stagingPath, { gzip });
+      await this.swap(workspacePath, stagingPath, suffix);
+      logger.info(`Restored workspace ${workspaceId} from archive (${result.fileCount} files, ${result.totalSize} bytes)`);
+      return result;
+    } catch (error) {
+      await fs.rm(stagingPath, { recursive: true, force: true });
+      throw error;
+    }
+  }
+
+  /**
+   * Extract and validate every entry into the staging directory
+   */
+  extract(input, stagingPath, { gzip }) {
+    const extract = tar.extract();
+    let fileCount = 0;
+    let totalSize = 0;
+
+    extract.on('entry', (header, stream, next) => {
+      // Destroying the extractor errors the current entry too; the pipeline reports it
+      stream.on('error', () => {});
+
+      const fail = (message) => {
+        stream.resume();
+        extract.destroy(this.invalid(message));
+      };
+
+      const name = header.name.replace(/^(\.\/)+/, '').replace(/\/+$/, '');
+      if (!name) {
+        stream.resume();
+        return next();
+      }
+
+      const validation = fileValidation.validateFilePath(name);
+      if (!validation.isValid) {
+        return fail(`${name}: ${validation.errors.join(', ')}`);
+      }
+
+      const target = path.join(stagingPath, name);
+      if (!target.startsWith(stagingPath + path.sep)) {
+        return fail(`${name}: Path traversal not allowed`);
+      }
+
+      if (header.type === 'directory') {
+        stream.resume();
+        fs.mkdir(target, { recursive: true }).then(() => next(), next);
+        return;
+      }
+
+      if (header.type !== 'file') {
+        return fail(`${name}: unsupported entry type '${header.type}'`);
+      }
+
+      if (header.size > fileSystem.maxFileSize) {
+        return fail(`${name}: file size exceeds maximum allowed size (${fileSystem.maxFileSize} bytes)`);
+      }
+
+      fileCount++;
+      totalSize += header.size;
+      if (fileCount > fileSystem.maxWorkspaceFiles) {
+        return extract.destroy(this.quotaExceeded(`Workspace file limit exceeded (max ${fileSystem.maxWorkspaceFiles} files)`));
+      }
+      if (totalSize > fileSystem.maxWorkspaceSize) {
+        return extract.destroy(this.quotaExceeded(`Workspace size limit exceeded (max ${fileSystem.maxWorkspaceSize} bytes)`));
+      }
+
+      const chunks = [];
+      stream.on('data', chunk => chunks.push(chunk));
+      stream.on('end', async () => {
+        try {
+          const content = Buffer.concat(chunks);
+          const contentValidation = fileValidation.validateFileContent(content.toString('utf8'), name);
+          if (!contentValidation.isValid) {
+            return fail(`${name}: ${contentValidation.errors.join(', ')}`);
+          }
+
+          await fs.mkdir(path.dirname(target), { recursive: true });
+          await fs.writeFile(target, content);
+          next();
+        } catch (error) {
+          next(error);
+        }
+      });
+    });
+
+    const stages = gzip ? [input, zlib.createGunzip(), extract] : [input, extract];
+
+    return new Promise((resolve, reject) => {
+      pipeline(...stages, (error) => {
+        if (error) {
+          // zlib and tar parse failures mean the upload itself is broken
+          return reject(error.code === 'INVALID_ARCHIVE' || error.code === 'QUOTA_EXCEEDED'
+            ? error
+            : this.invalid(`Archive could not be read: ${error.message}`));
+        }
+        resolve({ fileCount, totalSize });
+      });
+    });
+  }
+
+  /**
+   * Put the staged tree in place of the workspace's contents. The workspace
+   * directory itself stays: containers bind mount it, the workspace watcher
+   * watches it and its quota project is set on it, none of which would follow
+   * a new directory renamed over it. The old contents are copied aside first
+   * and copied back if the new ones can't be.
+   */
+  async swap(workspacePath, stagingPath, suffix) {
+    const previousPath = path.join(path.dirname(workspacePath), `.previous-${suffix}`);
+    await fs.mkdir(workspacePath, { recursive: true });
+    // Links are copied as links: whatever a container left there isn't followed
+    await fs.cp(workspacePath, previousPath, { recursive: true, verbatimSymlinks: true });
+
+    try {
+      await this.clear(workspacePath);
+      await fs.cp(stagingPath, workspacePath, { recursive: true });
+    } catch (error) {
+      await this.clear(workspacePath);
+      await fs.cp(previousPath, workspacePath, { recursive: true, verbatimSymlinks: true });
+      throw error;
+    } finally {
+      await fs.rm(previousPath, { recursive: true, force: true });
+    }
+
+    await fs.rm(stagingPath, { recursive: true, force: true });
+  }
+
+  // Remove everything inside a directory, but not the directory
+  async clear(dirPath) {
+    for (const name of await fs.readdir(dirPath)) {
+      await fs.rm(path.join(dirPath, name), { recursive: true, force: true });
+    }
+  }
+
+  invalid(message) {
+    const error = new Error(message);
+    error.code = 'INVALID_ARCHIVE';
+    return error;
+  }
+
+  quotaExceeded(message) {
+    const error = new Error(message);
+    error.code = 'QUOTA_EXCEEDED';
+    return error;
+  }
+}
+
+module.exports = new WorkspaceArchive();
\ No newline at end of file
@@ -62,13 +62,17 @@ const useExecutionStore = create(
           executionError: null 
         });
 
-        const executionId = crypto.randomUUID();
+        // The server assigns the execution ID; execution:started carries it
+        // along with our request ID
+        const requestId = crypto.randomUUID();
+        let executionId = null;
         
         // Set up WebSocket event listeners
         const ws = websocketService.getSocket();
         
         const handleExecutionStarted = (data) => {
-          if (data.executionId === executionId) {
+          if (data.requestId === requestId) {
+            executionId = data.executionId;
             set({ 
               activeExecution: data,
               executions: new Map(get().executions).set(executionId, {
@@ -81,7 +85,7 @@ const useExecutionStore = create(
         };
 
         const handleExecutionOutput = (data) => {
-          if (data.executionId === executionId) {
+          if (executionId && data.executionId === executionId) {
             set((state) => ({
               executionOutput: state.executionOutput + data.output,
               executions: new Map(state.executions).set(executionId, {
@@ -93,7 +97,7 @@ const useExecutionStore = create(
         };
 
         const handleExecutionCompleted = (data) => {
-          if (data.executionId === executionId) {
+          if (executionId && data.executionId === executionId) {
             set((state) => ({
               isExecuting: false,
               activeExecution: null,
@@ -114,7 +118,11 @@ const useExecutionStore = create(
         };
 
         const handleExecutionError = (data) => {
-          if (data.executionId === executionId) {
+          // Errors before the start carry only our request ID
+          if (data.requestId === requestId) {
+            executionId = data.executionId;
+          }
+          if (executionId && data.executionId === executionId) {
             set((state) => ({
               isExecuting: false,
               activeExecution: null,
@@ -136,7 +144,7 @@ const useExecutionStore = create(
         };
 
         const handleExecutionStopped = (data) => {
-          if (data.executionId === executionId) {
+          if (executionId && data.executionId === executionId) {
             set((state) => ({
               isExecuting: false,
               activeExecution: null,
@@ -168,10 +176,10 @@ const useExecutionStore = create(
           containerId,
           code,
           filename,
-          executionId
+          requestId
         });
 
-        return executionId;
+        return requestId;
       } catch (error) {
         set({ 
           isExecuting: false, 